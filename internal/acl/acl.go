@@ -0,0 +1,299 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package acl restricts what masters may do: which function codes an upstream
+// accepts, and which masters may write to which slaves and addresses.
+//
+// Once any write rule is configured, a write from a network master is only forwarded
+// if a rule covers its client address or identity, the slave and every address written.
+// Reads, and requests of serial masters and services inside the process, which
+// carry no client address, are not restricted.
+package acl
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// span is an inclusive range of addresses.
+type span struct {
+	first, last uint16
+}
+
+type rule struct {
+	clients    *transport.Allowlist // nil matches every client
+	identities map[string]bool      // nil matches every identity
+	slaves     [256]bool
+	addresses  []span // nil matches every address
+}
+
+// WriteACL holds the write rules of a gateway instance.
+type WriteACL struct {
+	rules []rule
+}
+
+// Write describes a write request, for matching and for the audit log.
+type Write struct {
+	Address  uint16
+	Quantity uint16
+}
+
+// New creates an ACL from its rules. No rules returns nil, which allows every write.
+func New(cfgs []config.WriteRuleConfig) (*WriteACL, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	a := &WriteACL{}
+	for i, cfg := range cfgs {
+		var r rule
+		var err error
+		if r.clients, err = transport.ParseAllowlist(cfg.Clients); err != nil {
+			return nil, fmt.Errorf("write rule %d: %w", i, err)
+		}
+		for _, id := range cfg.Identities {
+			if r.identities == nil {
+				r.identities = make(map[string]bool)
+			}
+			r.identities[id] = true
+		}
+		ids, err := parseSlaveIDs(cfg.SlaveIDs)
+		if err != nil {
+			return nil, fmt.Errorf("write rule %d: %w", i, err)
+		}
+		for _, id := range ids {
+			r.slaves[id] = true
+		}
+		if r.addresses, err = parseSpans(cfg.Addresses); err != nil {
+			return nil, fmt.Errorf("write rule %d: %w", i, err)
+		}
+		a.rules = append(a.rules, r)
+	}
+	return a, nil
+}
+
+// Allows reports whether the master of a request, as found in ctx, may send req to
+// slaveID. The write is returned for requests that write, so a denial can be logged in detail.
+func (a *WriteACL) Allows(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (Write, bool) {
+	w, isWrite := ParseWrite(req)
+	client := transport.ClientFromContext(ctx)
+	if a == nil || !isWrite || client == nil {
+		return w, true
+	}
+	identity := transport.IdentityFromContext(ctx)
+	for _, r := range a.rules {
+		if r.slaves[slaveID] && r.clients.Allows(client) && r.matchesIdentity(identity) && r.covers(w) {
+			return w, true
+		}
+	}
+	return w, false
+}
+
+func (r rule) matchesIdentity(identity string) bool {
+	return r.identities == nil || r.identities[identity]
+}
+
+func (r rule) covers(w Write) bool {
+	if r.addresses == nil {
+		return true
+	}
+	last := uint32(w.Address) + uint32(w.Quantity) - 1
+	for _, s := range r.addresses {
+		if w.Address >= s.first && last <= uint32(s.last) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWrite returns the addresses written by req, and false if req doesn't write.
+// Malformed writes count as a write of their first address, so they are still checked.
+func ParseWrite(req modbus.ProtocolDataUnit) (Write, bool) {
+	d := req.Data
+	u16 := func(i int) uint16 {
+		if len(d) < i+2 {
+			return 0
+		}
+		return binary.BigEndian.Uint16(d[i:])
+	}
+
+	switch req.FunctionCode {
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeMaskWriteRegister:
+		return Write{Address: u16(0), Quantity: 1}, true
+	case modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters:
+		return Write{Address: u16(0), Quantity: max(u16(2), 1)}, true
+	case modbus.FuncCodeReadWriteMultipleRegisters:
+		return Write{Address: u16(4), Quantity: max(u16(6), 1)}, true
+	}
+	return Write{}, false
+}
+
+// parseSlaveIDs parses "1,2,5-10", an empty string matches every slave.
+func parseSlaveIDs(s string) ([]byte, error) {
+	if strings.TrimSpace(s) == "" {
+		s = "0-255"
+	}
+	spans, err := parseSpans(s)
+	if err != nil {
+		return nil, err
+	}
+	var ids []byte
+	for _, sp := range spans {
+		if sp.last > 255 {
+			return nil, fmt.Errorf("slave ID out of range: %d", sp.last)
+		}
+		for id := int(sp.first); id <= int(sp.last); id++ {
+			ids = append(ids, byte(id))
+		}
+	}
+	return ids, nil
+}
+
+// parseSpans parses "0-99,200" into ranges, an empty string returns nil.
+func parseSpans(s string) ([]span, error) {
+	var spans []span
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.ParseUint(strings.TrimSpace(first), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", part, err)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.ParseUint(strings.TrimSpace(last), 0, 16); err != nil {
+				return nil, fmt.Errorf("invalid range %q: %w", part, err)
+			}
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("start of range %d is greater than end %d", lo, hi)
+		}
+		spans = append(spans, span{first: uint16(lo), last: uint16(hi)})
+	}
+	return spans, nil
+}
+
+// Functions is a set of function codes.
+type Functions [128]bool
+
+// parseFunctions parses function codes, e.g. "1-4,6,16". It reports false for an empty list.
+func parseFunctions(codes string) (Functions, bool, error) {
+	var f Functions
+	spans, err := parseSpans(codes)
+	if err != nil {
+		return f, false, fmt.Errorf("invalid function codes: %w", err)
+	}
+	for _, s := range spans {
+		if s.first == 0 || s.last > 127 {
+			return f, false, fmt.Errorf("function code out of range: %s", codes)
+		}
+		for fc := s.first; fc <= s.last; fc++ {
+			f[fc] = true
+		}
+	}
+	return f, len(spans) > 0, nil
+}
+
+// ParseFunctions parses the function codes a route serves: those in allow, all if it
+// is empty, except those in deny. It returns nil if both are empty.
+func ParseFunctions(allow, deny string) (*Functions, error) {
+	allowed, restricted, err := parseFunctions(allow)
+	if err != nil {
+		return nil, err
+	}
+	denied, excluded, err := parseFunctions(deny)
+	if err != nil {
+		return nil, err
+	}
+	if !restricted && !excluded {
+		return nil, nil
+	}
+	f := new(Functions)
+	for fc := 1; fc < len(f); fc++ {
+		f[fc] = (allowed[fc] || !restricted) && !denied[fc]
+	}
+	return f, nil
+}
+
+// Allows reports whether fc is in the set. A nil set allows every function code.
+func (f *Functions) Allows(fc byte) bool {
+	return f == nil || (fc < 128 && f[fc])
+}
+
+// Intersects reports whether a function code is in both sets.
+func (f *Functions) Intersects(other *Functions) bool {
+	for fc := byte(1); fc < 128; fc++ {
+		if f.Allows(fc) && other.Allows(fc) {
+			return true
+		}
+	}
+	return false
+}
+
+// functionFilter rejects requests of an upstream whose function code is not allowed
+// with Illegal Function, before they are routed.
+type functionFilter struct {
+	transport.Upstream
+	allowed Functions
+}
+
+// NewFunctionFilter restricts us to the function codes in codes, e.g. "1-4,6,16".
+// An empty list returns us unchanged.
+func NewFunctionFilter(us transport.Upstream, codes string) (transport.Upstream, error) {
+	allowed, restricted, err := parseFunctions(codes)
+	if err != nil {
+		return nil, err
+	}
+	if !restricted {
+		return us, nil
+	}
+	return &functionFilter{Upstream: us, allowed: allowed}, nil
+}
+
+// Start starts the upstream with the filter in front of handler.
+func (f *functionFilter) Start(ctx context.Context, handler transport.RequestHandler) error {
+	return f.Upstream.Start(ctx, f.allowed.filter(handler))
+}
+
+// FunctionMiddleware returns a middleware answering requests whose function code
+// is not in codes, e.g. "1-4,6,16", with Illegal Function. An empty list allows all.
+func FunctionMiddleware(codes string) (transport.Middleware, error) {
+	allowed, restricted, err := parseFunctions(codes)
+	if err != nil {
+		return nil, err
+	}
+	if !restricted {
+		return func(next transport.RequestHandler) transport.RequestHandler { return next }, nil
+	}
+	return allowed.filter, nil
+}
+
+// filter passes the requests with an allowed function code to next.
+func (f Functions) filter(next transport.RequestHandler) transport.RequestHandler {
+	return func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if !f.Allows(req.FunctionCode) {
+			transport.Logger(ctx).Warn("Function code denied", "audit", "function_denied", "client", clientName(ctx),
+				"identity", transport.IdentityFromContext(ctx), "slaveID", slaveID, "func", req.FunctionCode)
+			return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+		}
+		return next(ctx, slaveID, req)
+	}
+}
+
+// clientName names the master of a request for the audit log.
+func clientName(ctx context.Context) string {
+	if addr := transport.ClientFromContext(ctx); addr != nil {
+		return addr.String()
+	}
+	return "serial"
+}
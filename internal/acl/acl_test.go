@@ -0,0 +1,181 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package acl
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func TestWriteACL(t *testing.T) {
+	a, err := New([]config.WriteRuleConfig{
+		{Clients: []string{"10.1.0.0/16"}, SlaveIDs: "1-10", Addresses: "0-99,200"},
+		{Clients: []string{"192.168.5.7"}},
+		{Identities: []string{"scada-primary"}, SlaveIDs: "20"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := func(ip string) context.Context {
+		return transport.WithClient(context.Background(), &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000})
+	}
+	scada := from("10.1.2.3")
+	engineer := from("192.168.5.7")
+	other := from("10.2.0.1")
+	primary := transport.WithIdentity(other, "scada-primary")
+	backup := transport.WithIdentity(other, "scada-backup")
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		slave byte
+		req   pdu.Request
+		want  bool
+	}{
+		{"read from anyone", other, 1, pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 10}, true},
+		{"serial master", context.Background(), 1, pdu.WriteSingleRegisterRequest{Address: 500, Value: 1}, true},
+		{"write in range", scada, 3, pdu.WriteMultipleRegistersRequest{Address: 90, Values: make([]uint16, 10)}, true},
+		{"write across range end", scada, 3, pdu.WriteMultipleRegistersRequest{Address: 95, Values: make([]uint16, 10)}, false},
+		{"single address", scada, 3, pdu.WriteSingleCoilRequest{Address: 200, Value: true}, true},
+		{"other slave", scada, 11, pdu.WriteSingleRegisterRequest{Address: 1, Value: 1}, false},
+		{"other client", other, 3, pdu.WriteSingleRegisterRequest{Address: 1, Value: 1}, false},
+		{"unrestricted rule", engineer, 200, pdu.WriteSingleRegisterRequest{Address: 9000, Value: 1}, true},
+		{"identity", primary, 20, pdu.WriteSingleRegisterRequest{Address: 1, Value: 1}, true},
+		{"other identity", backup, 20, pdu.WriteSingleRegisterRequest{Address: 1, Value: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := a.Allows(tt.ctx, tt.slave, tt.req.PDU()); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var none *WriteACL
+	if _, ok := none.Allows(other, 1, pdu.WriteSingleRegisterRequest{}.PDU()); !ok {
+		t.Error("nil ACL denies writes")
+	}
+}
+
+func TestParseWrite(t *testing.T) {
+	w, ok := ParseWrite(pdu.WriteMultipleCoilsRequest{Address: 16, Values: make([]bool, 12)}.PDU())
+	if !ok || w != (Write{Address: 16, Quantity: 12}) {
+		t.Errorf("ParseWrite(0x0F) = %+v, %v", w, ok)
+	}
+	// Read/write multiple registers writes at the second address pair
+	req := modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeReadWriteMultipleRegisters,
+		Data:         []byte{0, 1, 0, 2, 0, 30, 0, 4, 8, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	if w, ok := ParseWrite(req); !ok || w != (Write{Address: 30, Quantity: 4}) {
+		t.Errorf("ParseWrite(0x17) = %+v, %v", w, ok)
+	}
+	if _, ok := ParseWrite(pdu.ReadCoilsRequest{Quantity: 1}.PDU()); ok {
+		t.Error("ParseWrite(0x01) reports a write")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []config.WriteRuleConfig{
+		{Clients: []string{"10.0.0.0/40"}},
+		{SlaveIDs: "5-300"},
+		{Addresses: "100-50"},
+		{Addresses: "x"},
+	} {
+		if _, err := New([]config.WriteRuleConfig{cfg}); err == nil {
+			t.Errorf("New(%+v) accepted an invalid rule", cfg)
+		}
+	}
+}
+
+// fakeUpstream hands its handler to the test instead of serving masters.
+type fakeUpstream struct {
+	handler transport.RequestHandler
+}
+
+func (u *fakeUpstream) Start(ctx context.Context, handler transport.RequestHandler) error {
+	u.handler = handler
+	return nil
+}
+
+func (u *fakeUpstream) Close() error { return nil }
+
+func TestFunctionFilter(t *testing.T) {
+	inner := &fakeUpstream{}
+	us, err := NewFunctionFilter(inner, "1-4,6,16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.Start(context.Background(), func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return req, nil
+	})
+
+	for _, tt := range []struct {
+		fc   byte
+		want bool
+	}{{3, true}, {6, true}, {16, true}, {5, false}, {15, false}, {0x2B, false}, {0x90, false}} {
+		_, err := inner.handler(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: tt.fc})
+		if got := err == nil; got != tt.want {
+			t.Errorf("function code %d allowed = %v, want %v", tt.fc, got, tt.want)
+		}
+		if err != nil && modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalFunction {
+			t.Errorf("function code %d error = %v, want Illegal Function", tt.fc, err)
+		}
+	}
+
+	if us, _ := NewFunctionFilter(inner, ""); us != transport.Upstream(inner) {
+		t.Error("empty function code list wraps the upstream")
+	}
+	for _, codes := range []string{"0", "1-200", "read"} {
+		if _, err := NewFunctionFilter(inner, codes); err == nil {
+			t.Errorf("NewFunctionFilter(%q) accepted invalid codes", codes)
+		}
+	}
+
+	mw, err := FunctionMiddleware("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return req, nil
+	})
+	if _, err := h(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 6}); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalFunction {
+		t.Errorf("middleware passed a denied function code, error %v", err)
+	}
+}
+
+func TestParseFunctions(t *testing.T) {
+	if f, err := ParseFunctions("", ""); f != nil || err != nil {
+		t.Errorf("ParseFunctions() = %v, %v, want nil", f, err)
+	}
+	writes, err := ParseFunctions("5,6,15,16", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads, err := ParseFunctions("", "5,6,15,16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		fc            byte
+		write, others bool
+	}{{3, false, true}, {6, true, false}, {16, true, false}, {0x2B, false, true}, {0x90, false, false}} {
+		if writes.Allows(tt.fc) != tt.write || reads.Allows(tt.fc) != tt.others {
+			t.Errorf("function code %d allowed = %v, %v, want %v, %v", tt.fc, writes.Allows(tt.fc), reads.Allows(tt.fc), tt.write, tt.others)
+		}
+	}
+	if writes.Intersects(reads) || !writes.Intersects(nil) {
+		t.Error("Intersects() of disjoint sets, or a set and all codes, is wrong")
+	}
+	if _, err := ParseFunctions("1-4", "200"); err == nil {
+		t.Error("ParseFunctions() accepted an invalid denied code")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package acl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Tables of the data model, as named in scrub rules.
+const (
+	TableCoil            = "coil"
+	TableDiscreteInput   = "discrete_input"
+	TableHoldingRegister = "holding_register"
+	TableInputRegister   = "input_register"
+)
+
+// readTables are the tables read by each function code. The start address of the
+// read is the first field of all these requests.
+var readTables = map[byte]string{
+	modbus.FuncCodeReadCoils:                  TableCoil,
+	modbus.FuncCodeReadDiscreteInputs:         TableDiscreteInput,
+	modbus.FuncCodeReadHoldingRegisters:       TableHoldingRegister,
+	modbus.FuncCodeReadInputRegisters:         TableInputRegister,
+	modbus.FuncCodeReadWriteMultipleRegisters: TableHoldingRegister,
+}
+
+type scrubRule struct {
+	slaves    [256]bool
+	table     string // Empty matches every table
+	addresses []span
+}
+
+// diode turns an upstream facing a less trusted network into a one-way view of the
+// slaves: writes are refused, and configured addresses read back as zero.
+type diode struct {
+	transport.Upstream
+	readOnly bool
+	scrub    []scrubRule
+}
+
+// NewDiode refuses every request of us but reads if readOnly is set, and zeroes the
+// values of the scrub rules in responses. Without either us is returned unchanged.
+func NewDiode(us transport.Upstream, readOnly bool, scrub []config.ScrubConfig) (transport.Upstream, error) {
+	if !readOnly && len(scrub) == 0 {
+		return us, nil
+	}
+	d := &diode{Upstream: us, readOnly: readOnly}
+	for i, cfg := range scrub {
+		var r scrubRule
+		switch cfg.Table {
+		case "", TableCoil, TableDiscreteInput, TableHoldingRegister, TableInputRegister:
+			r.table = cfg.Table
+		default:
+			return nil, fmt.Errorf("scrub rule %d: unknown table %q", i, cfg.Table)
+		}
+		ids, err := parseSlaveIDs(cfg.SlaveIDs)
+		if err != nil {
+			return nil, fmt.Errorf("scrub rule %d: %w", i, err)
+		}
+		for _, id := range ids {
+			r.slaves[id] = true
+		}
+		if r.addresses, err = parseSpans(cfg.Addresses); err != nil {
+			return nil, fmt.Errorf("scrub rule %d: %w", i, err)
+		}
+		if len(r.addresses) == 0 {
+			return nil, fmt.Errorf("scrub rule %d: no addresses", i)
+		}
+		d.scrub = append(d.scrub, r)
+	}
+	return d, nil
+}
+
+// Start starts the upstream with the diode in front of handler.
+func (d *diode) Start(ctx context.Context, handler transport.RequestHandler) error {
+	return d.Upstream.Start(ctx, func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if d.readOnly && !isRead(req) {
+			transport.Logger(ctx).Warn("Request to read-only upstream denied", "audit", "read_only", "client", clientName(ctx),
+				"identity", transport.IdentityFromContext(ctx), "slaveID", slaveID, "func", req.FunctionCode)
+			return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+		}
+		resp, err := handler(ctx, slaveID, req)
+		if err != nil || resp.FunctionCode != req.FunctionCode {
+			return resp, err
+		}
+		return d.scrubResponse(slaveID, req, resp), nil
+	})
+}
+
+// isRead reports whether a read-only upstream accepts req: a read without side
+// effects on the slave.
+func isRead(req modbus.ProtocolDataUnit) bool {
+	if req.FunctionCode == modbus.FuncCodeReadDeviceIdentification {
+		// Encapsulated interface transport also carries CANopen requests
+		return len(req.Data) > 0 && req.Data[0] == 0x0E
+	}
+	return modbus.IsRead(req.FunctionCode)
+}
+
+// scrubResponse zeroes the values of resp covered by a scrub rule, on a copy.
+func (d *diode) scrubResponse(slaveID byte, req, resp modbus.ProtocolDataUnit) modbus.ProtocolDataUnit {
+	table, ok := readTables[req.FunctionCode]
+	if !ok || len(req.Data) < 4 || len(resp.Data) < 1 {
+		return resp
+	}
+	address := uint32(req.Data[0])<<8 | uint32(req.Data[1])
+	values := resp.Data[1:]
+	if int(resp.Data[0]) != len(values) {
+		return resp
+	}
+
+	var data []byte
+	isBits := table == TableCoil || table == TableDiscreteInput
+	for _, r := range d.scrub {
+		if !r.slaves[slaveID] || (r.table != "" && r.table != table) {
+			continue
+		}
+		for _, s := range r.addresses {
+			first := max(uint32(s.first), address)
+			for a := first; a <= uint32(s.last); a++ {
+				i := int(a - address)
+				if (isBits && i/8 >= len(values)) || (!isBits && 2*i+1 >= len(values)) {
+					break
+				}
+				if data == nil {
+					data = append([]byte(nil), resp.Data...)
+				}
+				if isBits {
+					data[1+i/8] &^= 1 << (i % 8)
+				} else {
+					data[1+2*i], data[2+2*i] = 0, 0
+				}
+			}
+		}
+	}
+	if data == nil {
+		return resp
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: resp.FunctionCode, Data: data}
+}
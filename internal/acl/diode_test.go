@@ -0,0 +1,104 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package acl
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func TestDiode_ReadOnly(t *testing.T) {
+	inner := &fakeUpstream{}
+	us, err := NewDiode(inner, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.Start(context.Background(), func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return req, nil
+	})
+
+	for _, tt := range []struct {
+		req  modbus.ProtocolDataUnit
+		want bool
+	}{
+		{pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 1}.PDU(), true},
+		{pdu.ReadCoilsRequest{Address: 0, Quantity: 1}.PDU(), true},
+		{modbus.ProtocolDataUnit{FunctionCode: 0x2B, Data: []byte{0x0E, 1, 0}}, true},
+		{modbus.ProtocolDataUnit{FunctionCode: 0x2B, Data: []byte{0x0D, 0, 0}}, false},
+		{pdu.WriteSingleRegisterRequest{Address: 0, Value: 1}.PDU(), false},
+		{pdu.WriteSingleCoilRequest{Address: 0, Value: true}.PDU(), false},
+		{modbus.ProtocolDataUnit{FunctionCode: 0x17, Data: []byte{0, 0, 0, 1, 0, 0, 0, 1, 2, 0, 1}}, false},
+		{modbus.ProtocolDataUnit{FunctionCode: 0x08, Data: []byte{0, 1, 0, 0}}, false},
+	} {
+		_, err := inner.handler(context.Background(), 1, tt.req)
+		if got := err == nil; got != tt.want {
+			t.Errorf("function code %d allowed = %v, want %v", tt.req.FunctionCode, got, tt.want)
+		}
+		if err != nil && modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalFunction {
+			t.Errorf("function code %d error = %v, want Illegal Function", tt.req.FunctionCode, err)
+		}
+	}
+
+	if us, _ := NewDiode(inner, false, nil); us != transport.Upstream(inner) {
+		t.Error("diode without read-only or scrub rules wraps the upstream")
+	}
+}
+
+func TestDiode_Scrub(t *testing.T) {
+	inner := &fakeUpstream{}
+	us, err := NewDiode(inner, false, []config.ScrubConfig{
+		{SlaveIDs: "1", Table: TableHoldingRegister, Addresses: "101-102"},
+		{Addresses: "3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answered []byte
+	us.Start(context.Background(), func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: answered}, nil
+	})
+
+	tests := []struct {
+		name    string
+		slaveID byte
+		req     modbus.ProtocolDataUnit
+		resp    []byte
+		want    []byte
+	}{
+		{"registers", 1, pdu.ReadHoldingRegistersRequest{Address: 100, Quantity: 4}.PDU(),
+			[]byte{8, 0, 1, 0, 2, 0, 3, 0, 4}, []byte{8, 0, 1, 0, 0, 0, 0, 0, 4}},
+		{"other slave", 2, pdu.ReadHoldingRegistersRequest{Address: 100, Quantity: 4}.PDU(),
+			[]byte{8, 0, 1, 0, 2, 0, 3, 0, 4}, []byte{8, 0, 1, 0, 2, 0, 3, 0, 4}},
+		{"other table", 1, pdu.ReadInputRegistersRequest{Address: 100, Quantity: 4}.PDU(),
+			[]byte{8, 0, 1, 0, 2, 0, 3, 0, 4}, []byte{8, 0, 1, 0, 2, 0, 3, 0, 4}},
+		{"every table", 2, pdu.ReadInputRegistersRequest{Address: 2, Quantity: 2}.PDU(),
+			[]byte{4, 0, 1, 0, 2}, []byte{4, 0, 1, 0, 0}},
+		{"coils", 1, pdu.ReadCoilsRequest{Address: 0, Quantity: 8}.PDU(),
+			[]byte{1, 0xFF}, []byte{1, 0xF7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answered = tt.resp
+			resp, err := inner.handler(context.Background(), tt.slaveID, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(resp.Data, tt.want) {
+				t.Errorf("response = % X, want % X", resp.Data, tt.want)
+			}
+		})
+	}
+
+	for _, cfg := range []config.ScrubConfig{{Addresses: ""}, {Table: "registers", Addresses: "1"}, {SlaveIDs: "300", Addresses: "1"}} {
+		if _, err := NewDiode(inner, false, []config.ScrubConfig{cfg}); err == nil {
+			t.Errorf("NewDiode(%+v) error = nil", cfg)
+		}
+	}
+}
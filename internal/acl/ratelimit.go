@@ -0,0 +1,115 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package acl
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// maxBuckets bounds the clients tracked before idle ones are forgotten.
+const maxBuckets = 1024
+
+// bucket is a token bucket of one client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// writeLimiter answers writes of a client beyond its rate with Server Device Busy,
+// so a runaway script can't cycle relays. Reads are not limited.
+type writeLimiter struct {
+	transport.Upstream
+	rate  float64 // Writes per second
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewWriteLimiter limits every client of us to rate writes per second, with bursts
+// of up to burst writes. A burst of 0 allows one second worth of writes. A rate of 0
+// returns us unchanged.
+func NewWriteLimiter(us transport.Upstream, rate float64, burst int) (transport.Upstream, error) {
+	if rate == 0 {
+		return us, nil
+	}
+	if rate < 0 || burst < 0 {
+		return nil, fmt.Errorf("invalid write rate %v with burst %d", rate, burst)
+	}
+	b := float64(burst)
+	if burst == 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &writeLimiter{Upstream: us, rate: rate, burst: b, now: time.Now, buckets: make(map[string]*bucket)}, nil
+}
+
+// Start starts the upstream with the limiter in front of handler.
+func (l *writeLimiter) Start(ctx context.Context, handler transport.RequestHandler) error {
+	return l.Upstream.Start(ctx, func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if _, isWrite := ParseWrite(req); isWrite && !l.allow(clientKey(ctx)) {
+			transport.Logger(ctx).Warn("Write rate limit exceeded", "audit", "write_rate_limited", "client", clientName(ctx),
+				"identity", transport.IdentityFromContext(ctx), "slaveID", slaveID, "func", req.FunctionCode)
+			return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeServerDeviceBusy}
+		}
+		return handler(ctx, slaveID, req)
+	})
+}
+
+// allow takes a token from the bucket of key.
+func (l *writeLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.forgetIdle(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// forgetIdle drops the buckets that have refilled, they behave like new ones.
+func (l *writeLimiter) forgetIdle(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey identifies the client a request is limited as: its identity, else its
+// IP address, so reconnecting from another port doesn't reset the limit.
+func clientKey(ctx context.Context) string {
+	if identity := transport.IdentityFromContext(ctx); identity != "" {
+		return "identity:" + identity
+	}
+	addr := transport.ClientFromContext(ctx)
+	if addr == nil {
+		return "serial"
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
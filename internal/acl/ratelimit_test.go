@@ -0,0 +1,74 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package acl
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func TestWriteLimiter(t *testing.T) {
+	inner := &fakeUpstream{}
+	us, err := NewWriteLimiter(inner, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := us.(*writeLimiter)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	l.Start(context.Background(), func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return req, nil
+	})
+
+	from := func(addr string) context.Context {
+		a, _ := net.ResolveTCPAddr("tcp", addr)
+		return transport.WithClient(context.Background(), a)
+	}
+	runaway, other := from("10.0.0.1:5000"), from("10.0.0.2:5000")
+	write := pdu.WriteSingleCoilRequest{Address: 1, Value: true}.PDU()
+	read := pdu.ReadCoilsRequest{Address: 1, Quantity: 1}.PDU()
+
+	for i := 0; i < 5; i++ {
+		if _, err := inner.handler(runaway, 1, write); err != nil {
+			t.Fatalf("write %d within the burst = %v", i, err)
+		}
+	}
+	if _, err := inner.handler(runaway, 1, write); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeServerDeviceBusy {
+		t.Errorf("write beyond the limit = %v, want Server Device Busy", err)
+	}
+	// Another port of the same host shares the limit, other clients and reads don't
+	if _, err := inner.handler(from("10.0.0.1:5001"), 1, write); err == nil {
+		t.Error("reconnecting client got a fresh limit")
+	}
+	if _, err := inner.handler(other, 1, write); err != nil {
+		t.Errorf("write of another client = %v", err)
+	}
+	if _, err := inner.handler(runaway, 1, read); err != nil {
+		t.Errorf("read of a limited client = %v", err)
+	}
+
+	now = now.Add(200 * time.Millisecond)
+	if _, err := inner.handler(runaway, 1, write); err != nil {
+		t.Errorf("write after a token refilled = %v", err)
+	}
+	if _, err := inner.handler(runaway, 1, write); err == nil {
+		t.Error("second write after one token refilled was allowed")
+	}
+}
+
+func TestNewWriteLimiter(t *testing.T) {
+	inner := &fakeUpstream{}
+	if us, _ := NewWriteLimiter(inner, 0, 0); us != transport.Upstream(inner) {
+		t.Error("zero rate wraps the upstream")
+	}
+	if _, err := NewWriteLimiter(inner, -1, 0); err == nil {
+		t.Error("NewWriteLimiter accepted a negative rate")
+	}
+}
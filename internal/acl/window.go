@@ -0,0 +1,152 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package acl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// window is a recurring period of the week in local time. A window ending
+// before it starts runs past midnight into the next day.
+type window struct {
+	days     [7]bool // By the day the window starts on
+	from, to time.Duration
+}
+
+func parseWindows(cfgs []config.WindowConfig) ([]window, error) {
+	var windows []window
+	for i, cfg := range cfgs {
+		var w window
+		var err error
+		if w.days, err = parseDays(cfg.Days); err != nil {
+			return nil, fmt.Errorf("window %d: %w", i, err)
+		}
+		if w.from, err = parseClock(cfg.From); err != nil {
+			return nil, fmt.Errorf("window %d: %w", i, err)
+		}
+		if w.to, err = parseClock(cfg.To); err != nil {
+			return nil, fmt.Errorf("window %d: %w", i, err)
+		}
+		if w.to == 0 {
+			w.to = 24 * time.Hour
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseDays parses "mon-fri,sun", an empty string means every day.
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	if strings.TrimSpace(s) == "" {
+		s = "sun-sat"
+	}
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			last = first
+		}
+		lo, ok1 := weekdays[strings.TrimSpace(first)]
+		hi, ok2 := weekdays[strings.TrimSpace(last)]
+		if !ok1 || !ok2 {
+			return days, fmt.Errorf("invalid days %q", part)
+		}
+		for d := lo; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == hi {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses "HH:MM" into the time since midnight, an empty string is midnight.
+func parseClock(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w window) contains(t time.Time) bool {
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	today := t.Weekday()
+	if w.from < w.to {
+		return w.days[today] && clock >= w.from && clock < w.to
+	}
+	yesterday := (today + 6) % 7
+	return (w.days[today] && clock >= w.from) || (w.days[yesterday] && clock < w.to)
+}
+
+func inWindows(windows []window, t time.Time) bool {
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowFilter rejects requests of an upstream outside its time windows with Illegal Function,
+// which the specification allows for a server in the wrong state to process a request.
+type windowFilter struct {
+	transport.Upstream
+	access []window // Any request, nil allows all times
+	writes []window // Writes, nil allows all times
+	now    func() time.Time
+}
+
+// NewWindowFilter restricts all requests of us to the access windows and writes to the
+// write windows. Without windows us is returned unchanged.
+func NewWindowFilter(us transport.Upstream, access, writes []config.WindowConfig) (transport.Upstream, error) {
+	if len(access) == 0 && len(writes) == 0 {
+		return us, nil
+	}
+	f := &windowFilter{Upstream: us, now: time.Now}
+	var err error
+	if f.access, err = parseWindows(access); err != nil {
+		return nil, fmt.Errorf("invalid access windows: %w", err)
+	}
+	if f.writes, err = parseWindows(writes); err != nil {
+		return nil, fmt.Errorf("invalid write windows: %w", err)
+	}
+	return f, nil
+}
+
+// Start starts the upstream with the filter in front of handler.
+func (f *windowFilter) Start(ctx context.Context, handler transport.RequestHandler) error {
+	return f.Upstream.Start(ctx, func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		now := f.now()
+		denied := ""
+		if f.access != nil && !inWindows(f.access, now) {
+			denied = "outside_access_window"
+		} else if _, isWrite := ParseWrite(req); isWrite && f.writes != nil && !inWindows(f.writes, now) {
+			denied = "outside_write_window"
+		}
+		if denied != "" {
+			transport.Logger(ctx).Warn("Request outside time window denied", "audit", denied, "client", clientName(ctx),
+				"identity", transport.IdentityFromContext(ctx), "slaveID", slaveID, "func", req.FunctionCode)
+			return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+		}
+		return handler(ctx, slaveID, req)
+	})
+}
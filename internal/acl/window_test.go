@@ -0,0 +1,101 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package acl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+// at returns a time in the week of Monday, 5 January 2026.
+func at(day int, clock string) time.Time {
+	c, _ := time.Parse("15:04", clock)
+	return time.Date(2026, time.January, 5+day, c.Hour(), c.Minute(), 0, 0, time.Local)
+}
+
+func TestWindow_Contains(t *testing.T) {
+	windows, err := parseWindows([]config.WindowConfig{
+		{Days: "mon-fri", From: "08:00", To: "17:00"},
+		{Days: "sat", From: "22:00", To: "02:00"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		time time.Time
+		want bool
+	}{
+		{at(0, "08:00"), true},
+		{at(0, "07:59"), false},
+		{at(4, "16:59"), true},
+		{at(4, "17:00"), false},
+		{at(5, "12:00"), false},
+		{at(5, "23:30"), true},
+		{at(6, "01:59"), true}, // Sunday morning, in Saturday's window
+		{at(6, "02:00"), false},
+	}
+	for _, tt := range tests {
+		if got := inWindows(windows, tt.time); got != tt.want {
+			t.Errorf("%s in windows = %v, want %v", tt.time.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseWindows_Invalid(t *testing.T) {
+	for _, cfg := range []config.WindowConfig{
+		{Days: "monday"},
+		{From: "8am"},
+		{To: "25:00"},
+	} {
+		if _, err := parseWindows([]config.WindowConfig{cfg}); err == nil {
+			t.Errorf("parseWindows(%+v) accepted an invalid window", cfg)
+		}
+	}
+	days, err := parseDays("fri-mon")
+	if err != nil || days != [7]bool{true, true, false, false, false, true, true} {
+		t.Errorf("parseDays(fri-mon) = %v, %v", days, err)
+	}
+}
+
+func TestWindowFilter(t *testing.T) {
+	inner := &fakeUpstream{}
+	us, err := NewWindowFilter(inner, nil, []config.WindowConfig{{Days: "sun", From: "02:00", To: "04:00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := us.(*windowFilter)
+	f.Start(context.Background(), func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return req, nil
+	})
+	read := pdu.ReadHoldingRegistersRequest{Quantity: 1}.PDU()
+	write := pdu.WriteSingleRegisterRequest{Value: 1}.PDU()
+
+	f.now = func() time.Time { return at(2, "10:00") }
+	if _, err := inner.handler(context.Background(), 1, read); err != nil {
+		t.Errorf("read outside the write window = %v", err)
+	}
+	if _, err := inner.handler(context.Background(), 1, write); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalFunction {
+		t.Errorf("write outside the write window = %v, want Illegal Function", err)
+	}
+	f.now = func() time.Time { return at(6, "03:00") }
+	if _, err := inner.handler(context.Background(), 1, write); err != nil {
+		t.Errorf("write in the maintenance window = %v", err)
+	}
+
+	inner = &fakeUpstream{}
+	us, _ = NewWindowFilter(inner, []config.WindowConfig{{Days: "mon-fri"}}, nil)
+	f = us.(*windowFilter)
+	f.Start(context.Background(), func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return req, nil
+	})
+	f.now = func() time.Time { return at(5, "10:00") }
+	if _, err := inner.handler(context.Background(), 1, read); err == nil {
+		t.Error("read outside the access window was served")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package alarm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+const actionTimeout = 5 * time.Second
+
+// State is the state an alarm transitioned to.
+type State string
+
+const (
+	StateRaised  State = "raised"
+	StateCleared State = "cleared"
+)
+
+// Event describes an alarm transition.
+type Event struct {
+	Gateway   string    `json:"gateway"`
+	Rule      string    `json:"rule"`
+	State     State     `json:"state"`
+	Condition string    `json:"condition"`
+	Tag       string    `json:"tag"`
+	Value     any       `json:"value"`
+	Time      time.Time `json:"time"`
+}
+
+// action is executed on every alarm transition.
+type action interface {
+	fire(ctx context.Context, ev Event) error
+}
+
+func newAction(cfg config.ActionConfig, tags []tag.Tag, handler transport.RequestHandler) (action, error) {
+	switch cfg.Type {
+	case "log", "":
+		return logAction{}, nil
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook action requires url")
+		}
+		return &webhookAction{url: cfg.URL, client: &http.Client{Timeout: actionTimeout}}, nil
+	case "mqtt":
+		if cfg.Broker == "" || cfg.Topic == "" {
+			return nil, fmt.Errorf("mqtt action requires broker and topic")
+		}
+		return newMQTTAction(cfg.Broker, cfg.Topic), nil
+	case "write":
+		t, ok := tag.Lookup(tags, cfg.Tag)
+		if !ok {
+			return nil, fmt.Errorf("write action references unknown tag: %s", cfg.Tag)
+		}
+		if !t.Table.Writable() {
+			return nil, fmt.Errorf("write action tag %s is read-only", cfg.Tag)
+		}
+		return &writeAction{tag: t, value: cfg.Value, clearValue: cfg.ClearValue, handler: handler}, nil
+	default:
+		return nil, fmt.Errorf("unknown action type: %s", cfg.Type)
+	}
+}
+
+// logAction records the event in the gateway log.
+type logAction struct{}
+
+func (logAction) fire(ctx context.Context, ev Event) error {
+	level := slog.LevelWarn
+	if ev.State == StateCleared {
+		level = slog.LevelInfo
+	}
+	slog.Log(ctx, level, "Alarm "+string(ev.State), "gateway", ev.Gateway, "rule", ev.Rule, "condition", ev.Condition, "tag", ev.Tag, "value", ev.Value)
+	return nil
+}
+
+// webhookAction POSTs the event as JSON.
+type webhookAction struct {
+	url    string
+	client *http.Client
+}
+
+func (a *webhookAction) fire(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// mqttAction publishes the event as JSON to an alarm topic.
+type mqttAction struct {
+	topic  string
+	client mqtt.Client
+}
+
+func newMQTTAction(broker, topic string) *mqttAction {
+	opts := mqtt.NewClientOptions().AddBroker(broker)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	client := mqtt.NewClient(opts)
+	client.Connect()
+	return &mqttAction{topic: topic, client: client}
+}
+
+func (a *mqttAction) fire(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	token := a.client.Publish(a.topic, 1, false, body)
+	if !token.WaitTimeout(actionTimeout) {
+		return fmt.Errorf("publish timed out")
+	}
+	return token.Error()
+}
+
+func (a *mqttAction) Close() {
+	a.client.Disconnect(250)
+}
+
+// writeAction writes a tag, e.g. to switch on a horn coil.
+type writeAction struct {
+	tag        tag.Tag
+	value      any
+	clearValue any
+	handler    transport.RequestHandler
+}
+
+func (a *writeAction) fire(ctx context.Context, ev Event) error {
+	v := a.value
+	if ev.State == StateCleared {
+		if a.clearValue == nil {
+			return nil
+		}
+		v = a.clearValue
+	}
+	return tag.Write(ctx, a.handler, a.tag, v)
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package alarm evaluates threshold rules on tags and fires actions when alarms
+// are raised or cleared.
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// rule is a parsed RuleConfig with its evaluation state.
+type rule struct {
+	name    string
+	cond    condition
+	hold    time.Duration
+	actions []action
+
+	pendingSince time.Time // when the condition started to hold
+	active       bool
+}
+
+// Engine implements gateway.Service, periodically evaluating alarm rules.
+type Engine struct {
+	gateway  string
+	interval time.Duration
+	handler  transport.RequestHandler
+	tags     []tag.Tag // tags referenced by the rules
+	rules    []*rule
+}
+
+// NewEngine creates an alarm engine for a gateway.
+func NewEngine(gateway string, cfg config.AlarmConfig, tags []tag.Tag, handler transport.RequestHandler) (*Engine, error) {
+	e := &Engine{
+		gateway:  gateway,
+		interval: cfg.Interval,
+		handler:  handler,
+	}
+	used := make(map[string]struct{})
+	for _, rc := range cfg.Rules {
+		cond, err := parseCondition(rc.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rc.Name, err)
+		}
+		t, ok := tag.Lookup(tags, cond.tag)
+		if !ok {
+			return nil, fmt.Errorf("rule %s: unknown tag: %s", rc.Name, cond.tag)
+		}
+		if _, ok := used[t.Name]; !ok {
+			used[t.Name] = struct{}{}
+			e.tags = append(e.tags, t)
+		}
+
+		r := &rule{name: rc.Name, cond: cond, hold: rc.For}
+		for _, ac := range rc.Actions {
+			a, err := newAction(ac, tags, handler)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rc.Name, err)
+			}
+			r.actions = append(r.actions, a)
+		}
+		if len(r.actions) == 0 {
+			r.actions = []action{logAction{}}
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+// Run evaluates the rules every interval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context) error {
+	defer e.close()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			samples, errs := tag.ReadAll(ctx, e.handler, e.tags)
+			for name, err := range errs {
+				slog.Debug("Alarm engine failed to read tag", "gateway", e.gateway, "tag", name, "err", err)
+			}
+			e.evaluate(ctx, samples, time.Now())
+		}
+	}
+}
+
+// evaluate advances every rule whose tag was sampled.
+// Rules whose tag could not be read keep their state until the next successful read.
+func (e *Engine) evaluate(ctx context.Context, samples []tag.Sample, now time.Time) {
+	values := make(map[string]any, len(samples))
+	for _, s := range samples {
+		values[s.Tag] = s.Value
+	}
+
+	for _, r := range e.rules {
+		v, ok := values[r.cond.tag]
+		if !ok {
+			continue
+		}
+		holds, err := r.cond.eval(v)
+		if err != nil {
+			slog.Warn("Failed to evaluate alarm rule", "gateway", e.gateway, "rule", r.name, "err", err)
+			continue
+		}
+
+		switch {
+		case holds && r.pendingSince.IsZero():
+			r.pendingSince = now
+		case !holds:
+			r.pendingSince = time.Time{}
+		}
+
+		if holds && !r.active && now.Sub(r.pendingSince) >= r.hold {
+			r.active = true
+			e.fire(ctx, r, StateRaised, v, now)
+		} else if !holds && r.active {
+			r.active = false
+			e.fire(ctx, r, StateCleared, v, now)
+		}
+	}
+}
+
+func (e *Engine) fire(ctx context.Context, r *rule, state State, value any, now time.Time) {
+	ev := Event{
+		Gateway:   e.gateway,
+		Rule:      r.name,
+		State:     state,
+		Condition: r.cond.String(),
+		Tag:       r.cond.tag,
+		Value:     value,
+		Time:      now,
+	}
+	for _, a := range r.actions {
+		actx, cancel := context.WithTimeout(ctx, actionTimeout)
+		if err := a.fire(actx, ev); err != nil {
+			slog.Error("Alarm action failed", "gateway", e.gateway, "rule", r.name, "action", fmt.Sprintf("%T", a), "err", err)
+		}
+		cancel()
+	}
+}
+
+func (e *Engine) close() {
+	for _, r := range e.rules {
+		for _, a := range r.actions {
+			if c, ok := a.(interface{ Close() }); ok {
+				c.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package alarm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/tag"
+)
+
+type recordAction struct {
+	events []Event
+}
+
+func (a *recordAction) fire(ctx context.Context, ev Event) error {
+	a.events = append(a.events, ev)
+	return nil
+}
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    condition
+		wantErr bool
+	}{
+		{"temp > 80", condition{"temp", ">", 80}, false},
+		{"temp>=80.5", condition{"temp", ">=", 80.5}, false},
+		{"door == true", condition{"door", "==", 1}, false},
+		{"level != 0", condition{"level", "!=", 0}, false},
+		{"temp 80", condition{}, true},
+		{"> 80", condition{}, true},
+		{"temp > hot", condition{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCondition(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCondition(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCondition(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEngine_HoldDuration(t *testing.T) {
+	rec := &recordAction{}
+	e := &Engine{
+		gateway: "gw",
+		rules: []*rule{{
+			name:    "overheat",
+			cond:    condition{"temp", ">", 80},
+			hold:    30 * time.Second,
+			actions: []action{rec},
+		}},
+	}
+
+	t0 := time.Unix(1700000000, 0)
+	step := func(v uint16, at time.Duration) {
+		e.evaluate(context.Background(), []tag.Sample{{Tag: "temp", Value: v}}, t0.Add(at))
+	}
+
+	step(85, 0)
+	step(85, 10*time.Second)
+	step(70, 20*time.Second) // condition broken, timer restarts
+	step(85, 25*time.Second)
+	step(85, 50*time.Second)
+	if len(rec.events) != 0 {
+		t.Fatalf("Alarm raised too early: %+v", rec.events)
+	}
+
+	step(85, 55*time.Second)
+	if len(rec.events) != 1 || rec.events[0].State != StateRaised {
+		t.Fatalf("Expected alarm to be raised, got %+v", rec.events)
+	}
+
+	step(90, 60*time.Second) // still active, no duplicate event
+	step(60, 70*time.Second)
+	if len(rec.events) != 2 || rec.events[1].State != StateCleared {
+		t.Fatalf("Expected alarm to be cleared, got %+v", rec.events)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package alarm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condition compares a tag value against a constant, e.g. "temp > 80".
+type condition struct {
+	tag       string
+	op        string
+	threshold float64
+}
+
+// operators ordered so that two-character operators are matched first.
+var operators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+func parseCondition(expr string) (condition, error) {
+	for _, op := range operators {
+		lhs, rhs, ok := strings.Cut(expr, op)
+		if !ok {
+			continue
+		}
+		name := strings.TrimSpace(lhs)
+		if name == "" {
+			return condition{}, fmt.Errorf("missing tag name in condition %q", expr)
+		}
+		threshold, err := parseOperand(strings.TrimSpace(rhs))
+		if err != nil {
+			return condition{}, fmt.Errorf("invalid value in condition %q: %w", expr, err)
+		}
+		return condition{tag: name, op: op, threshold: threshold}, nil
+	}
+	return condition{}, fmt.Errorf("no comparison operator in condition %q", expr)
+}
+
+func parseOperand(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "true", "on":
+		return 1, nil
+	case "false", "off":
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// eval reports whether the condition holds for the value.
+func (c condition) eval(value any) (bool, error) {
+	v, ok := number(value)
+	if !ok {
+		return false, fmt.Errorf("tag %s: cannot compare %T", c.tag, value)
+	}
+	switch c.op {
+	case ">":
+		return v > c.threshold, nil
+	case ">=":
+		return v >= c.threshold, nil
+	case "<":
+		return v < c.threshold, nil
+	case "<=":
+		return v <= c.threshold, nil
+	case "==":
+		return v == c.threshold, nil
+	case "!=":
+		return v != c.threshold, nil
+	}
+	return false, fmt.Errorf("unknown operator %s", c.op)
+}
+
+func (c condition) String() string {
+	return fmt.Sprintf("%s %s %v", c.tag, c.op, c.threshold)
+}
+
+func number(value any) (float64, bool) {
+	switch x := value.(type) {
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	case uint16:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
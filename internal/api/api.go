@@ -0,0 +1,160 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package api serves the HTTP management API. Features register their read-only
+// endpoints with Handle, writable ones with HandleWrite, and probes with
+// HandleCheck; responses are JSON.
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take once the API stops.
+const shutdownTimeout = 5 * time.Second
+
+// Server is the management API server.
+type Server struct {
+	addr string
+	mux  *http.ServeMux
+}
+
+// New creates a server listening on the configured address once Run is called.
+func New(cfg config.APIConfig) *Server {
+	return &Server{addr: cfg.Address, mux: http.NewServeMux()}
+}
+
+// StatusError is an error answered with its status code rather than 500.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string { return e.Err.Error() }
+func (e *StatusError) Unwrap() error { return e.Err }
+
+// Handle registers a GET endpoint. fn returns the value to encode as JSON.
+func (s *Server) Handle(path string, fn func(r *http.Request) (any, error)) {
+	s.HandleWrite(path, fn, nil)
+}
+
+// HandleWrite registers an endpoint answering GET with get and PUT with put, which
+// decodes the request body itself. Both return the value to encode as JSON. A nil
+// put leaves the endpoint read-only.
+func (s *Server) HandleWrite(path string, get, put func(r *http.Request) (any, error)) {
+	allow := "GET, HEAD"
+	if put != nil {
+		allow += ", PUT"
+	}
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		fn := get
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		case r.Method == http.MethodPut && put != nil:
+			fn = put
+		default:
+			w.Header().Set("Allow", allow)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		v, err := fn(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			var se *StatusError
+			if errors.As(err, &se) {
+				status = se.Code
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	})
+}
+
+// HandleCheck registers a GET endpoint for probes, such as a Kubernetes readiness
+// probe. It answers 200 if fn reports the check passed and 503 otherwise, with the
+// value fn returns encoded as JSON.
+func (s *Server) HandleCheck(path string, fn func(r *http.Request) (any, bool)) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		v, ok := fn(r)
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, v)
+	})
+}
+
+//go:embed dashboard.html
+var dashboard []byte
+
+// ServeDashboard serves the live traffic dashboard at /. The page polls /api/report,
+// /api/routes and /api/transactions, which have to be registered as well.
+func (s *Server) ServeDashboard() {
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			writeError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboard)
+	})
+}
+
+// ServeHTTP lets the API be mounted elsewhere or tested without listening.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Run serves the API until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Management API listening", "address", ln.Addr().String())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,344 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package audit keeps a trail of the writes forwarded through the gateway, for
+// change management.
+//
+// The trail is an append-only file of JSON lines, one per write request, whether
+// the device took it or not, with its result. Each entry carries the SHA-256
+// hash of the previous one and its own hash over both, so removing or editing an
+// entry breaks the chain, which Verify detects. Old values are those last read
+// through the gateway, if any.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// genesis is the previous hash of the first entry.
+var genesis = hex.EncodeToString(make([]byte, sha256.Size))
+
+// hashSuffix matches the hash appended to the JSON of an entry.
+var hashSuffix = regexp.MustCompile(`,"hash":"([0-9a-f]{64})"}$`)
+
+// Tables of the values written.
+const (
+	TableCoil            = "coil"
+	TableHoldingRegister = "holding_register"
+)
+
+// Entry is a write in the trail.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Gateway  string    `json:"gateway"`
+	Client   string    `json:"client,omitempty"`   // Address of a network master
+	Identity string    `json:"identity,omitempty"` // Name of an authenticated master
+	SlaveID  byte      `json:"slave_id"`
+	Function byte      `json:"function"`
+	Table    string    `json:"table"`
+	Address  uint16    `json:"address"`
+	Old      []*uint16 `json:"old,omitempty"` // Per address, null if never read through the gateway
+	New      []uint16  `json:"new,omitempty"` // Missing for a mask write of an unknown value
+	AndMask  *uint16   `json:"and_mask,omitempty"`
+	OrMask   *uint16   `json:"or_mask,omitempty"`
+	Result   string    `json:"result"` // "ok", or why the write failed
+	Prev     string    `json:"prev"`
+}
+
+type key struct {
+	gateway string
+	slaveID byte
+	table   string
+	address uint16
+}
+
+// Trail appends writes to a file and remembers values read, to record old values.
+type Trail struct {
+	mu    sync.Mutex
+	f     *os.File
+	prev  string
+	known map[key]uint16
+	now   func() time.Time
+}
+
+// Open opens the trail at path, continuing the chain of an existing file.
+func Open(path string) (*Trail, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	prev, complete, err := lastHash(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit trail %s: %w", path, err)
+	}
+	if !complete {
+		// A crash cut the last entry short; Verify reports it, the chain goes on from the one before
+		if _, err := f.WriteString("\n"); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &Trail{f: f, prev: prev, known: make(map[key]uint16), now: time.Now}, nil
+}
+
+// lastHash returns the hash of the last complete entry of f, and whether f ends with one.
+func lastHash(f *os.File) (string, bool, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", false, err
+	}
+	prev, complete := genesis, true
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			complete = line[len(line)-1] == '\n'
+			if m := hashSuffix.FindSubmatch(bytes.TrimSpace(line)); m != nil && complete {
+				prev = string(m[1])
+			}
+		}
+		if err == io.EOF {
+			return prev, complete, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+}
+
+// Close closes the file.
+func (t *Trail) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+// Observe records a request answered with resp or failed with err: writes are
+// appended to the trail with their result, reads of coils and holding registers
+// answered are remembered as the old values of later writes.
+func (t *Trail) Observe(ctx context.Context, gateway string, slaveID byte, req, resp modbus.ProtocolDataUnit, err error) error {
+	if t == nil {
+		return nil
+	}
+	if err == nil && resp.FunctionCode != req.FunctionCode {
+		err = exception(resp)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := parseWrite(req)
+	if !ok {
+		if err == nil {
+			t.remember(gateway, slaveID, req, resp)
+		}
+		return nil
+	}
+	e.Result = "ok"
+	if err != nil {
+		e.Result = err.Error()
+	}
+	e.Time = t.now().UTC()
+	e.Gateway = gateway
+	e.SlaveID = slaveID
+	e.Function = req.FunctionCode
+	if addr := transport.ClientFromContext(ctx); addr != nil {
+		e.Client = addr.String()
+	}
+	e.Identity = transport.IdentityFromContext(ctx)
+
+	count := len(e.New)
+	if e.AndMask != nil {
+		count = 1
+	}
+	var anyKnown bool
+	old := make([]*uint16, count)
+	for i := range old {
+		if v, ok := t.known[key{gateway, slaveID, e.Table, e.Address + uint16(i)}]; ok {
+			old[i], anyKnown = &v, true
+		}
+	}
+	if anyKnown {
+		e.Old = old
+	}
+	if err != nil {
+		// The values stay as they were, as far as the gateway knows
+		return t.append(e)
+	}
+	if e.AndMask != nil {
+		delete(t.known, key{gateway, slaveID, e.Table, e.Address})
+		if old[0] != nil {
+			e.New = []uint16{*old[0]&*e.AndMask | *e.OrMask&^*e.AndMask}
+		}
+	}
+	for i, v := range e.New {
+		t.known[key{gateway, slaveID, e.Table, e.Address + uint16(i)}] = v
+	}
+	// Read/write multiple registers reads after writing
+	t.remember(gateway, slaveID, req, resp)
+	return t.append(e)
+}
+
+// exception returns the error of an exception response.
+func exception(resp modbus.ProtocolDataUnit) error {
+	e := &modbus.Error{FunctionCode: resp.FunctionCode}
+	if len(resp.Data) > 0 {
+		e.ExceptionCode = resp.Data[0]
+	}
+	return e
+}
+
+// append writes e to the file, chained to the previous entry.
+func (t *Trail) append(e Entry) error {
+	e.Prev = t.prev
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	hash := entryHash(line)
+	line = append(line[:len(line)-1], fmt.Sprintf(`,"hash":"%s"}`+"\n", hash)...)
+	if _, err := t.f.Write(line); err != nil {
+		return err
+	}
+	t.prev = hash
+	return t.f.Sync()
+}
+
+// entryHash hashes the JSON of an entry without its hash, which includes the previous hash.
+func entryHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// remember stores the values of coils and holding registers read.
+func (t *Trail) remember(gateway string, slaveID byte, req, resp modbus.ProtocolDataUnit) {
+	if len(req.Data) < 4 || len(resp.Data) < 1 {
+		return
+	}
+	address := binary.BigEndian.Uint16(req.Data)
+	quantity := binary.BigEndian.Uint16(req.Data[2:])
+	data := resp.Data[1:]
+	if int(resp.Data[0]) != len(data) {
+		return
+	}
+	switch req.FunctionCode {
+	case modbus.FuncCodeReadCoils:
+		for i := 0; i < int(quantity) && i/8 < len(data); i++ {
+			t.known[key{gateway, slaveID, TableCoil, address + uint16(i)}] = uint16(data[i/8]>>(i%8)) & 1
+		}
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadWriteMultipleRegisters:
+		for i := 0; i < int(quantity) && 2*i+1 < len(data); i++ {
+			t.known[key{gateway, slaveID, TableHoldingRegister, address + uint16(i)}] = binary.BigEndian.Uint16(data[2*i:])
+		}
+	}
+}
+
+// parseWrite decodes the table, address and values of a write request.
+func parseWrite(req modbus.ProtocolDataUnit) (Entry, bool) {
+	d := req.Data
+	switch req.FunctionCode {
+	case modbus.FuncCodeWriteSingleCoil:
+		if len(d) < 4 {
+			return Entry{}, false
+		}
+		var v uint16
+		if binary.BigEndian.Uint16(d[2:]) == 0xFF00 {
+			v = 1
+		}
+		return Entry{Table: TableCoil, Address: binary.BigEndian.Uint16(d), New: []uint16{v}}, true
+	case modbus.FuncCodeWriteSingleRegister:
+		if len(d) < 4 {
+			return Entry{}, false
+		}
+		return Entry{Table: TableHoldingRegister, Address: binary.BigEndian.Uint16(d), New: []uint16{binary.BigEndian.Uint16(d[2:])}}, true
+	case modbus.FuncCodeWriteMultipleCoils:
+		if len(d) < 5 {
+			return Entry{}, false
+		}
+		quantity, bits := int(binary.BigEndian.Uint16(d[2:])), d[5:]
+		e := Entry{Table: TableCoil, Address: binary.BigEndian.Uint16(d)}
+		for i := 0; i < quantity && i/8 < len(bits); i++ {
+			e.New = append(e.New, uint16(bits[i/8]>>(i%8))&1)
+		}
+		return e, true
+	case modbus.FuncCodeWriteMultipleRegisters:
+		if len(d) < 5 {
+			return Entry{}, false
+		}
+		return Entry{Table: TableHoldingRegister, Address: binary.BigEndian.Uint16(d), New: registers(d[5:], binary.BigEndian.Uint16(d[2:]))}, true
+	case modbus.FuncCodeReadWriteMultipleRegisters:
+		if len(d) < 9 {
+			return Entry{}, false
+		}
+		return Entry{Table: TableHoldingRegister, Address: binary.BigEndian.Uint16(d[4:]), New: registers(d[9:], binary.BigEndian.Uint16(d[6:]))}, true
+	case modbus.FuncCodeMaskWriteRegister:
+		if len(d) < 6 {
+			return Entry{}, false
+		}
+		and, or := binary.BigEndian.Uint16(d[2:]), binary.BigEndian.Uint16(d[4:])
+		return Entry{Table: TableHoldingRegister, Address: binary.BigEndian.Uint16(d), AndMask: &and, OrMask: &or}, true
+	}
+	return Entry{}, false
+}
+
+func registers(b []byte, quantity uint16) []uint16 {
+	var values []uint16
+	for i := 0; i < int(quantity) && 2*i+1 < len(b); i++ {
+		values = append(values, binary.BigEndian.Uint16(b[2*i:]))
+	}
+	return values
+}
+
+// ErrTampered means an entry of a trail was changed, removed or inserted.
+var ErrTampered = errors.New("audit trail tampered")
+
+// Verify checks the chain of a trail and returns the number of entries in it.
+func Verify(r io.Reader) (int, error) {
+	prev := genesis
+	n := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Bytes()
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		m := hashSuffix.FindSubmatchIndex(text)
+		if m == nil {
+			return n, fmt.Errorf("%w: line %d has no hash", ErrTampered, line)
+		}
+		hash := string(text[m[2]:m[3]])
+		body := append(append([]byte(nil), text[:m[0]]...), '}')
+		var e Entry
+		if err := json.Unmarshal(body, &e); err != nil {
+			return n, fmt.Errorf("%w: line %d: %v", ErrTampered, line, err)
+		}
+		if e.Prev != prev {
+			return n, fmt.Errorf("%w: line %d does not follow the previous entry", ErrTampered, line)
+		}
+		if entryHash(body) != hash {
+			return n, fmt.Errorf("%w: line %d does not match its hash", ErrTampered, line)
+		}
+		prev = hash
+		n++
+	}
+	return n, scanner.Err()
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func entries(t *testing.T, path string) []Entry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []Entry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// ok answers a request like a slave accepting it.
+func ok(req modbus.ProtocolDataUnit, data ...byte) modbus.ProtocolDataUnit {
+	if data == nil {
+		data = req.Data[:4]
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: data}
+}
+
+func TestTrail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	trail, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scada := transport.WithIdentity(transport.WithClient(context.Background(), &net.TCPAddr{IP: net.ParseIP("10.1.0.5"), Port: 5000}), "scada-primary")
+
+	read := pdu.ReadHoldingRegistersRequest{Address: 10, Quantity: 2}.PDU()
+	trail.Observe(scada, "plant", 1, read, ok(read, 4, 0, 7, 0, 8), nil)
+	write := pdu.WriteMultipleRegistersRequest{Address: 11, Values: []uint16{80, 90}}.PDU()
+	trail.Observe(scada, "plant", 1, write, ok(write), nil)
+	coil := pdu.WriteSingleCoilRequest{Address: 3, Value: true}.PDU()
+	trail.Observe(context.Background(), "plant", 2, coil, ok(coil), nil)
+	// Failed writes are recorded with their result, and don't change the values known
+	trail.Observe(scada, "plant", 1, write, modbus.ProtocolDataUnit{FunctionCode: write.FunctionCode | 0x80, Data: []byte{2}}, nil)
+	retry := pdu.WriteSingleRegisterRequest{Address: 11, Value: 81}.PDU()
+	trail.Observe(scada, "plant", 1, retry, modbus.ProtocolDataUnit{}, modbus.ErrTimeout)
+	trail.Close()
+
+	list := entries(t, path)
+	if len(list) != 4 {
+		t.Fatalf("trail has %d entries, want 4", len(list))
+	}
+	if list[0].Result != "ok" || list[2].Result != "modbus: exception '2' (illegal data address), function '16'" {
+		t.Errorf("results %q and %q", list[0].Result, list[2].Result)
+	}
+	if e := list[3]; e.Result != modbus.ErrTimeout.Error() || len(e.Old) != 1 || *e.Old[0] != 80 || e.New[0] != 81 {
+		t.Errorf("failed write = %+v, want old value 80 of the last write taken", e)
+	}
+	e := list[0]
+	if e.Client != "10.1.0.5:5000" || e.Identity != "scada-primary" || e.SlaveID != 1 || e.Table != TableHoldingRegister || e.Address != 11 {
+		t.Errorf("entry = %+v", e)
+	}
+	if len(e.Old) != 2 || e.Old[0] == nil || *e.Old[0] != 8 || e.Old[1] != nil {
+		t.Errorf("old values = %v, want [8 null]", e.Old)
+	}
+	if len(e.New) != 2 || e.New[0] != 80 || e.New[1] != 90 {
+		t.Errorf("new values = %v", e.New)
+	}
+	if list[1].Old != nil || list[1].Table != TableCoil || list[1].New[0] != 1 || list[1].Client != "" {
+		t.Errorf("coil entry = %+v", list[1])
+	}
+
+	// Reopening continues the chain
+	trail, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail.Observe(context.Background(), "plant", 2, coil, ok(coil), nil)
+	trail.Close()
+	data, _ := os.ReadFile(path)
+	if n, err := Verify(bytes.NewReader(data)); n != 5 || err != nil {
+		t.Errorf("Verify() = %d, %v", n, err)
+	}
+}
+
+func TestTrail_MaskWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	trail, _ := Open(path)
+	read := pdu.ReadHoldingRegistersRequest{Address: 4, Quantity: 1}.PDU()
+	trail.Observe(context.Background(), "plant", 1, read, ok(read, 2, 0x00, 0x12), nil)
+	mask := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeMaskWriteRegister, Data: []byte{0, 4, 0, 0xF2, 0, 0x25}}
+	trail.Observe(context.Background(), "plant", 1, mask, ok(mask, mask.Data...), nil)
+	unread := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeMaskWriteRegister, Data: []byte{0, 5, 0, 0xF2, 0, 0x25}}
+	trail.Observe(context.Background(), "plant", 1, unread, ok(unread, unread.Data...), nil)
+	trail.Close()
+
+	list := entries(t, path)
+	// The example of the specification: 0x12 AND 0xF2 OR (0x25 AND NOT 0xF2) = 0x17
+	if *list[0].Old[0] != 0x12 || list[0].New[0] != 0x17 {
+		t.Errorf("mask write = %+v", list[0])
+	}
+	if list[1].Old != nil || list[1].New != nil || *list[1].AndMask != 0xF2 {
+		t.Errorf("mask write of an unknown value = %+v", list[1])
+	}
+}
+
+func TestVerify_Tampered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	trail, _ := Open(path)
+	for i := uint16(0); i < 3; i++ {
+		w := pdu.WriteSingleRegisterRequest{Address: i, Value: 100}.PDU()
+		trail.Observe(context.Background(), "plant", 1, w, ok(w), nil)
+	}
+	trail.Close()
+	data, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(data), "\n")
+
+	edited := strings.Replace(string(data), `"new":[100]`, `"new":[101]`, 1)
+	removed := lines[0] + lines[2]
+	for name, text := range map[string]string{"edited": edited, "removed": removed, "truncated": string(data[:len(data)-20])} {
+		if _, err := Verify(strings.NewReader(text)); !errors.Is(err, ErrTampered) {
+			t.Errorf("Verify(%s) = %v, want ErrTampered", name, err)
+		}
+	}
+}
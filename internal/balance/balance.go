@@ -0,0 +1,159 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package balance spreads reads across identical downstreams, such as redundant data
+// concentrators serving the same values, so no single one carries all the polling.
+//
+// Members are picked in turn, or by the fewest requests in flight. A member failing
+// consecutively by timeout or connection is taken out of rotation for a cooldown,
+// after which the next request picking it decides whether it stays. Requests other
+// than reads are refused with Illegal Function: a write would reach one member only
+// and leave the others stale.
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Strategies picking the member of a request.
+const (
+	RoundRobin = "round_robin"
+	LeastBusy  = "least_busy"
+)
+
+// ErrNoMember is returned while every member is out of rotation. It is a connection
+// error, answered with Gateway Target Device Failed to Respond.
+var ErrNoMember = fmt.Errorf("%w: no member in rotation", modbus.ErrConnection)
+
+type member struct {
+	transport.Downstream
+	name     string
+	inFlight int
+	failures int       // Consecutive
+	outSince time.Time // Zero while in rotation
+}
+
+// Balancer is a group of members answering as one downstream.
+type Balancer struct {
+	cfg config.BalanceConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	members []*member
+	next    int // Member round robin starts looking at
+}
+
+// New creates a balancer of members, labeled by names in logs.
+func New(members []transport.Downstream, names []string, cfg config.BalanceConfig) (*Balancer, error) {
+	if cfg.Strategy != RoundRobin && cfg.Strategy != LeastBusy {
+		return nil, fmt.Errorf("unknown load balancing strategy %q, want %q or %q", cfg.Strategy, RoundRobin, LeastBusy)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("load balancing needs members")
+	}
+	b := &Balancer{cfg: cfg, now: time.Now}
+	for i, ds := range members {
+		b.members = append(b.members, &member{Downstream: ds, name: names[i]})
+	}
+	return b, nil
+}
+
+// Send forwards a read to a member in rotation.
+func (b *Balancer) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if !modbus.IsRead(req.FunctionCode) {
+		return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+	}
+	m := b.pick()
+	if m == nil {
+		return modbus.ProtocolDataUnit{}, ErrNoMember
+	}
+	resp, err := m.Send(ctx, slaveID, req)
+	b.record(ctx, m, err)
+	return resp, err
+}
+
+// pick chooses the member of the next request and counts it in flight, nil if none is in rotation.
+func (b *Balancer) pick() *member {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	var picked *member
+	for i := range b.members {
+		m := b.members[(b.next+i)%len(b.members)]
+		if !m.outSince.IsZero() && now.Sub(m.outSince) < b.cfg.Cooldown {
+			continue
+		}
+		if picked == nil || (b.cfg.Strategy == LeastBusy && m.inFlight < picked.inFlight) {
+			picked = m
+		}
+		if b.cfg.Strategy == RoundRobin {
+			break
+		}
+	}
+	if picked == nil {
+		return nil
+	}
+	b.next = (b.indexOf(picked) + 1) % len(b.members)
+	picked.inFlight++
+	return picked
+}
+
+func (b *Balancer) indexOf(m *member) int {
+	for i, other := range b.members {
+		if other == m {
+			return i
+		}
+	}
+	return 0
+}
+
+// record counts the outcome of a request to m, taking it out of rotation after consecutive failures.
+func (b *Balancer) record(ctx context.Context, m *member, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m.inFlight--
+	if !errors.Is(err, modbus.ErrTimeout) && !errors.Is(err, modbus.ErrConnection) && !errors.Is(err, context.DeadlineExceeded) {
+		if !m.outSince.IsZero() {
+			transport.Logger(ctx).Info("Member back in rotation", "member", m.name)
+		}
+		m.failures = 0
+		m.outSince = time.Time{}
+		return
+	}
+	m.failures++
+	if m.failures >= b.cfg.Failures {
+		if m.outSince.IsZero() {
+			transport.Logger(ctx).Warn("Member out of rotation", "member", m.name, "failures", m.failures, "cooldown", b.cfg.Cooldown)
+		}
+		m.outSince = b.now()
+	}
+}
+
+// Connect connects all members. The balancer works while any of them is connected.
+func (b *Balancer) Connect(ctx context.Context) error {
+	var errs []error
+	for _, m := range b.members {
+		if err := m.Connect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all members.
+func (b *Balancer) Close() error {
+	var errs []error
+	for _, m := range b.members {
+		errs = append(errs, m.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package balance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// concentrator answers with its marker, or fails with err. With hold set, requests
+// wait for it to be closed.
+type concentrator struct {
+	marker byte
+	err    error
+	hold   chan struct{}
+}
+
+func (c *concentrator) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if c.hold != nil {
+		<-c.hold
+	}
+	if c.err != nil {
+		return modbus.ProtocolDataUnit{}, c.err
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, c.marker}}, nil
+}
+
+func (c *concentrator) Connect(ctx context.Context) error { return nil }
+func (c *concentrator) Close() error                      { return nil }
+
+var readRequest = modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+
+func newBalancer(t *testing.T, strategy string, members ...*concentrator) *Balancer {
+	t.Helper()
+	var ds []transport.Downstream
+	var names []string
+	for _, m := range members {
+		ds = append(ds, m)
+		names = append(names, string('a'+m.marker-1))
+	}
+	b, err := New(ds, names, config.BalanceConfig{Strategy: strategy, Failures: 2, Cooldown: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func markers(b *Balancer, n int) []byte {
+	var got []byte
+	for i := 0; i < n; i++ {
+		resp, err := b.Send(context.Background(), 1, readRequest)
+		if err != nil {
+			got = append(got, 0)
+			continue
+		}
+		got = append(got, resp.Data[2])
+	}
+	return got
+}
+
+func TestBalancer_RoundRobin(t *testing.T) {
+	a, b, c := &concentrator{marker: 1}, &concentrator{marker: 2, err: modbus.ErrTimeout}, &concentrator{marker: 3}
+	lb := newBalancer(t, RoundRobin, a, b, c)
+	now := time.Now()
+	lb.now = func() time.Time { return now }
+
+	// b fails twice, then is out of rotation
+	if got, want := string(markers(lb, 8)), "\x01\x00\x03\x01\x00\x03\x01\x03"; got != want {
+		t.Errorf("answered by % X, want % X", got, want)
+	}
+
+	// After the cooldown it is tried again, and stays once it answers
+	now = now.Add(10 * time.Second)
+	b.err = nil
+	if got, want := string(markers(lb, 3)), "\x01\x02\x03"; got != want {
+		t.Errorf("answered after cooldown by % X, want % X", got, want)
+	}
+}
+
+func TestBalancer_LeastBusy(t *testing.T) {
+	a, b := &concentrator{marker: 1, hold: make(chan struct{})}, &concentrator{marker: 2}
+	lb := newBalancer(t, LeastBusy, a, b)
+
+	done := make(chan struct{})
+	go func() {
+		lb.Send(context.Background(), 1, readRequest) // Held by a
+		close(done)
+	}()
+	busy := func() bool {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		return lb.members[0].inFlight > 0
+	}
+	for !busy() {
+		time.Sleep(time.Millisecond)
+	}
+	if got := string(markers(lb, 3)); got != "\x02\x02\x02" {
+		t.Errorf("answered while a is busy by % X, want b only", got)
+	}
+	close(a.hold)
+	<-done
+}
+
+func TestBalancer_Refused(t *testing.T) {
+	lb := newBalancer(t, RoundRobin, &concentrator{marker: 1, err: modbus.ErrConnection})
+	write := modbus.ProtocolDataUnit{FunctionCode: 0x06, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+	if _, err := lb.Send(context.Background(), 1, write); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalFunction {
+		t.Errorf("write error = %v, want Illegal Function", err)
+	}
+
+	markers(lb, 2)
+	if _, err := lb.Send(context.Background(), 1, readRequest); !errors.Is(err, ErrNoMember) {
+		t.Errorf("read with no member in rotation error = %v, want ErrNoMember", err)
+	}
+	if _, err := New([]transport.Downstream{&concentrator{}}, []string{"a"}, config.BalanceConfig{Strategy: "random"}); err == nil {
+		t.Error("New() with an unknown strategy succeeded")
+	}
+}
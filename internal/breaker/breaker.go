@@ -0,0 +1,151 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package breaker fails requests to a downstream fast while it is down, instead of
+// letting every master wait for the timeout, and tells readiness probes about it.
+//
+// The breaker opens after consecutive timeouts or connection failures. Once the
+// cooldown has passed, a single request probes the downstream: success closes the
+// breaker, failure keeps it open for another cooldown. Exception responses show
+// the slave is alive and count as success.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// ErrOpen is returned for requests refused while the breaker is open. It is a
+// connection error, answered with Gateway Target Device Failed to Respond.
+var ErrOpen = fmt.Errorf("%w: circuit breaker open", modbus.ErrConnection)
+
+// Downstream is a downstream behind a circuit breaker.
+type Downstream struct {
+	transport.Downstream
+	cfg config.BreakerConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	failures int       // Consecutive
+	openedAt time.Time // Zero while closed
+	probing  bool
+}
+
+// Wrap returns ds behind a breaker.
+func Wrap(ds transport.Downstream, cfg config.BreakerConfig) *Downstream {
+	return &Downstream{Downstream: ds, cfg: cfg, now: time.Now}
+}
+
+// Open reports whether the breaker is open, including while a request probes the downstream.
+func (d *Downstream) Open() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.openedAt.IsZero()
+}
+
+// States of a breaker, as reported by State.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open" // The cooldown has passed, the next request probes the downstream
+)
+
+// State reports the state of the breaker.
+func (d *Downstream) State() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case d.openedAt.IsZero():
+		return StateClosed
+	case d.probing || d.now().Sub(d.openedAt) >= d.cfg.Cooldown:
+		return StateHalfOpen
+	}
+	return StateOpen
+}
+
+// Failures returns the number of consecutive failures.
+func (d *Downstream) Failures() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.failures
+}
+
+// Send forwards the request unless the breaker is open.
+func (d *Downstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	pass, probe := d.allow()
+	if !pass {
+		return modbus.ProtocolDataUnit{}, ErrOpen
+	}
+	resp, err := d.Downstream.Send(ctx, slaveID, req)
+	d.record(ctx, probe, err)
+	return resp, err
+}
+
+// Report takes the state of a connection supervised in the background: the breaker
+// opens as it goes down, without waiting for requests to fail, and closes once it is
+// up again.
+func (d *Downstream) Report(up bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case up:
+		d.failures = 0
+		d.openedAt = time.Time{}
+	case d.openedAt.IsZero():
+		d.openedAt = d.now()
+	}
+}
+
+// allow reports whether a request may pass, and whether it is the probe once the
+// cooldown is over.
+func (d *Downstream) allow() (pass, probe bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.openedAt.IsZero() {
+		return true, false
+	}
+	if d.probing || d.now().Sub(d.openedAt) < d.cfg.Cooldown {
+		return false, false
+	}
+	d.probing = true
+	return true, true
+}
+
+// record counts the outcome of a request that passed. Requests still in flight as
+// the breaker opened leave it to the probe.
+func (d *Downstream) record(ctx context.Context, probe bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if probe {
+		d.probing = false
+	} else if !d.openedAt.IsZero() {
+		return
+	}
+
+	var exception *modbus.Error
+	switch {
+	case err == nil, errors.As(err, &exception):
+		if !d.openedAt.IsZero() {
+			transport.Logger(ctx).Info("Circuit breaker closed", "failures", d.failures)
+		}
+		d.failures = 0
+		d.openedAt = time.Time{}
+	case errors.Is(err, modbus.ErrTimeout), errors.Is(err, modbus.ErrConnection), errors.Is(err, context.DeadlineExceeded):
+		d.failures++
+		if probe {
+			d.openedAt = d.now()
+			transport.Logger(ctx).Warn("Circuit breaker probe failed", "err", err, "cooldown", d.cfg.Cooldown)
+		} else if d.openedAt.IsZero() && d.failures >= d.cfg.Failures {
+			d.openedAt = d.now()
+			transport.Logger(ctx).Warn("Circuit breaker opened", "failures", d.failures, "cooldown", d.cfg.Cooldown)
+		}
+	}
+}
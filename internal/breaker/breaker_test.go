@@ -0,0 +1,166 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// failingDownstream answers with err and counts the requests reaching it.
+type failingDownstream struct {
+	err  error
+	sent int
+}
+
+func (f *failingDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	f.sent++
+	if f.err != nil {
+		return modbus.ProtocolDataUnit{}, f.err
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, 0x01}}, nil
+}
+
+func (f *failingDownstream) Connect(ctx context.Context) error { return nil }
+func (f *failingDownstream) Close() error                      { return nil }
+
+var readRequest = modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+
+func TestBreaker(t *testing.T) {
+	inner := &failingDownstream{err: modbus.ErrTimeout}
+	b := Wrap(inner, config.BreakerConfig{Failures: 3, Cooldown: 10 * time.Second})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	send := func() error {
+		_, err := b.Send(context.Background(), 1, readRequest)
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := send(); !errors.Is(err, modbus.ErrTimeout) {
+			t.Fatalf("request %d error = %v", i, err)
+		}
+	}
+	if !b.Open() {
+		t.Fatal("breaker closed after 3 timeouts")
+	}
+	if err := send(); !errors.Is(err, ErrOpen) || inner.sent != 3 {
+		t.Fatalf("open breaker error = %v, %d requests sent", err, inner.sent)
+	}
+	if modbus.ExceptionCodeOf(ErrOpen) != modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond {
+		t.Errorf("ErrOpen answered with exception %d", modbus.ExceptionCodeOf(ErrOpen))
+	}
+
+	if state := b.State(); state != StateOpen || b.Failures() != 3 {
+		t.Errorf("State() = %s after %d failures, want open after 3", state, b.Failures())
+	}
+
+	// A failed probe keeps the breaker open for another cooldown
+	now = now.Add(10 * time.Second)
+	if state := b.State(); state != StateHalfOpen {
+		t.Errorf("State() after cooldown = %s, want half_open", state)
+	}
+	if err := send(); !errors.Is(err, modbus.ErrTimeout) || inner.sent != 4 {
+		t.Fatalf("probe error = %v, %d requests sent", err, inner.sent)
+	}
+	if err := send(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("request after failed probe error = %v", err)
+	}
+
+	// A successful probe closes it
+	now = now.Add(10 * time.Second)
+	inner.err = nil
+	if err := send(); err != nil || b.Open() {
+		t.Fatalf("probe error = %v, open = %v", err, b.Open())
+	}
+	if state := b.State(); state != StateClosed || b.Failures() != 0 {
+		t.Errorf("State() after successful probe = %s with %d failures, want closed", state, b.Failures())
+	}
+}
+
+// blockingDownstream hands each request to the test, which answers it.
+type blockingDownstream struct {
+	requests chan chan error
+}
+
+func (b *blockingDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	answer := make(chan error)
+	b.requests <- answer
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, 0x01}}, <-answer
+}
+
+func (b *blockingDownstream) Connect(ctx context.Context) error { return nil }
+func (b *blockingDownstream) Close() error                      { return nil }
+
+func TestBreaker_LateRequest(t *testing.T) {
+	inner := &blockingDownstream{requests: make(chan chan error)}
+	b := Wrap(inner, config.BreakerConfig{Failures: 1, Cooldown: 10 * time.Second})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	send := func(done chan<- error) {
+		_, err := b.Send(context.Background(), 1, readRequest)
+		done <- err
+	}
+
+	// A request in flight as the breaker opens answers while the probe is in flight
+	late, probe := make(chan error), make(chan error)
+	go send(late)
+	lateAnswer := <-inner.requests
+	b.Report(false)
+	now = now.Add(10 * time.Second)
+	go send(probe)
+	probeAnswer := <-inner.requests
+	lateAnswer <- nil
+	if err := <-late; err != nil {
+		t.Fatalf("late request error = %v", err)
+	}
+	second := make(chan error)
+	go send(second)
+	select {
+	case err := <-second:
+		if !errors.Is(err, ErrOpen) {
+			t.Fatalf("request while the probe is in flight error = %v", err)
+		}
+	case <-inner.requests:
+		t.Fatal("second probe passed while the first is in flight")
+	}
+
+	// The probe decides
+	probeAnswer <- nil
+	if err := <-probe; err != nil || b.State() != StateClosed {
+		t.Errorf("probe error = %v, state %s", err, b.State())
+	}
+}
+
+func TestBreaker_Exceptions(t *testing.T) {
+	inner := &failingDownstream{err: &modbus.Error{FunctionCode: 0x83, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}}
+	b := Wrap(inner, config.BreakerConfig{Failures: 1, Cooldown: time.Second})
+	for i := 0; i < 3; i++ {
+		b.Send(context.Background(), 1, readRequest)
+	}
+	inner.err = context.Canceled
+	b.Send(context.Background(), 1, readRequest)
+	if b.Open() {
+		t.Error("breaker opened on exceptions and cancellation")
+	}
+}
+
+func TestBreaker_Report(t *testing.T) {
+	inner := &failingDownstream{}
+	b := Wrap(inner, config.BreakerConfig{Failures: 3, Cooldown: 10 * time.Second})
+
+	b.Report(false)
+	if _, err := b.Send(context.Background(), 1, readRequest); !errors.Is(err, ErrOpen) || inner.sent != 0 {
+		t.Fatalf("error after the connection went down = %v, %d requests sent", err, inner.sent)
+	}
+	b.Report(true)
+	if _, err := b.Send(context.Background(), 1, readRequest); err != nil || b.State() != StateClosed {
+		t.Errorf("error after the connection came up = %v, state %s", err, b.State())
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package cache answers repeated reads of a downstream from the responses of earlier
+// ones, so masters polling the same registers don't each load a slow bus.
+//
+// Responses to reads of coils, discrete inputs and registers are kept for a TTL per
+// slave, function code, address and quantity. Identical reads arriving while one is
+// forwarded wait for its response instead of being sent as well. Any other request
+// to a slave, such as a write, drops what is cached for it. Exceptions and errors are
+// not cached.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+type key struct {
+	slaveID  byte
+	function byte
+	data     string // Address and quantity
+}
+
+type entry struct {
+	resp    modbus.ProtocolDataUnit
+	expires time.Time
+	err     error
+	done    chan struct{} // Closed once the response arrived, then nil
+}
+
+// Downstream is a downstream whose read responses are cached.
+type Downstream struct {
+	transport.Downstream
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[key]*entry
+	swept   time.Time
+}
+
+// Wrap returns ds with its read responses cached for ttl.
+func Wrap(ds transport.Downstream, ttl time.Duration) *Downstream {
+	return &Downstream{Downstream: ds, ttl: ttl, now: time.Now, entries: make(map[key]*entry)}
+}
+
+func cacheable(req modbus.ProtocolDataUnit) bool {
+	switch req.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters:
+		return len(req.Data) == 4
+	}
+	return false
+}
+
+// Send answers a read from the cache while fresh, and forwards other requests.
+func (d *Downstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if !cacheable(req) {
+		d.invalidate(slaveID)
+		return d.Downstream.Send(ctx, slaveID, req)
+	}
+
+	k := key{slaveID: slaveID, function: req.FunctionCode, data: string(req.Data)}
+	d.mu.Lock()
+	now := d.now()
+	d.sweep(now)
+	if e, ok := d.entries[k]; ok && (e.done != nil || now.Before(e.expires)) {
+		done := e.done
+		d.mu.Unlock()
+		if done != nil {
+			// The same read is on its way to the downstream
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return modbus.ProtocolDataUnit{}, ctx.Err()
+			}
+		}
+		transport.Logger(ctx).Debug("Read served from cache", "slaveID", slaveID, "func", req.FunctionCode)
+		return clone(e.resp), e.err
+	}
+	e := &entry{done: make(chan struct{})}
+	d.entries[k] = e
+	d.mu.Unlock()
+
+	resp, err := d.Downstream.Send(ctx, slaveID, req)
+
+	d.mu.Lock()
+	e.resp, e.err = clone(resp), err
+	e.expires = d.now().Add(d.ttl)
+	if (err != nil || resp.FunctionCode != req.FunctionCode) && d.entries[k] == e {
+		delete(d.entries, k)
+	}
+	close(e.done)
+	e.done = nil
+	d.mu.Unlock()
+	return resp, err
+}
+
+// invalidate drops the entries of slaveID, which a request may have changed. Reads
+// on their way are dropped too, they may have been answered before the change.
+func (d *Downstream) invalidate(slaveID byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k := range d.entries {
+		if k.slaveID == slaveID {
+			delete(d.entries, k)
+		}
+	}
+}
+
+// sweep drops expired entries, at most once per TTL. Caller must hold the mutex.
+func (d *Downstream) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.ttl {
+		return
+	}
+	d.swept = now
+	for k, e := range d.entries {
+		if e.done == nil && !now.Before(e.expires) {
+			delete(d.entries, k)
+		}
+	}
+}
+
+func clone(pdu modbus.ProtocolDataUnit) modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: bytes.Clone(pdu.Data)}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// countingDownstream answers reads with the number of requests it got so far.
+type countingDownstream struct {
+	mu      sync.Mutex
+	sent    int
+	release chan struct{} // Closed to let requests through, nil to answer right away
+}
+
+func (c *countingDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	c.mu.Lock()
+	c.sent++
+	n := c.sent
+	c.mu.Unlock()
+	if c.release != nil {
+		<-c.release
+	}
+	if pdu.Data[0] == 0xFF {
+		return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: pdu.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, byte(n)}}, nil
+}
+
+func (c *countingDownstream) Connect(ctx context.Context) error { return nil }
+func (c *countingDownstream) Close() error                      { return nil }
+
+func read(address byte) modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{address, 0x00, 0x00, 0x01}}
+}
+
+func TestCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := &countingDownstream{}
+	d := Wrap(c, time.Second)
+	d.now = func() time.Time { return now }
+
+	value := func(slaveID byte, req modbus.ProtocolDataUnit) byte {
+		t.Helper()
+		resp, err := d.Send(context.Background(), slaveID, req)
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		return resp.Data[2]
+	}
+
+	if v := value(1, read(0)); v != 1 {
+		t.Errorf("first read = %d, want 1", v)
+	}
+	if v := value(1, read(0)); v != 1 {
+		t.Errorf("read within TTL = %d, want cached 1", v)
+	}
+	if v := value(2, read(0)); v != 2 {
+		t.Errorf("read of another slave = %d, want 2", v)
+	}
+	if v := value(1, read(1)); v != 3 {
+		t.Errorf("read of another address = %d, want 3", v)
+	}
+
+	now = now.Add(time.Second)
+	if v := value(1, read(0)); v != 4 {
+		t.Errorf("read after TTL = %d, want 4", v)
+	}
+	value(2, read(0))
+
+	// A write drops the entries of its slave only
+	write := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0x00, 0x00, 0x00, 0x07}}
+	value(1, write)
+	if v := value(1, read(0)); v != 7 {
+		t.Errorf("read after write = %d, want 7", v)
+	}
+	if v := value(2, read(0)); v != 5 {
+		t.Errorf("read of other slave after write = %d, want cached 5", v)
+	}
+
+	// Exceptions are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := d.Send(context.Background(), 1, read(0xFF)); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataAddress {
+			t.Errorf("read of invalid address error = %v", err)
+		}
+	}
+	if c.sent != 9 {
+		t.Errorf("%d requests sent to the downstream, want 9", c.sent)
+	}
+}
+
+func TestCache_Coalesces(t *testing.T) {
+	c := &countingDownstream{release: make(chan struct{})}
+	d := Wrap(c, time.Second)
+
+	var wg sync.WaitGroup
+	values := make([]byte, 4)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := d.Send(context.Background(), 1, read(0))
+			if err != nil {
+				t.Errorf("Send() error = %v", err)
+				return
+			}
+			values[i] = resp.Data[2]
+		}(i)
+	}
+	// Let the first read reach the downstream before it answers
+	for {
+		c.mu.Lock()
+		sent := c.sent
+		c.mu.Unlock()
+		if sent > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(c.release)
+	wg.Wait()
+
+	if c.sent != 1 {
+		t.Errorf("%d requests sent for identical reads, want 1", c.sent)
+	}
+	for i, v := range values {
+		if v != 1 {
+			t.Errorf("read %d = %d, want 1", i, v)
+		}
+	}
+}
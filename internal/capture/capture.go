@@ -0,0 +1,286 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package capture records the frames of a gateway, upstream and downstream, with
+// their time and direction, for offline analysis.
+//
+// Frames go to a file rotated by size, either pcapng or JSON lines. pcapng files
+// use Wireshark's exported PDU link type naming the Modbus/TCP or Modbus RTU
+// dissector, so Wireshark decodes them without configuration. Each frame carries
+// a comment of its direction and the correlation ID of its request, as frame
+// tracing logs them.
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/logfile"
+	"github.com/ffutop/modbus-gateway/modbus/crc"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Formats of capture files
+const (
+	FormatPcapng = "pcapng"
+	FormatJSONL  = "jsonl"
+)
+
+// Recorder writes the frames passed to it to a capture file while enabled. It is a
+// transport.FrameSink.
+type Recorder struct {
+	gateway string
+	format  string
+	enabled atomic.Bool
+
+	mu      sync.Mutex
+	out     *logfile.File
+	buf     bytes.Buffer
+	failing bool // Whether the last write failed, to log failures once
+
+	now func() time.Time // For tests
+}
+
+// New opens the capture file of a gateway, which is rotated after cfg.MaxSize
+// megabytes. Frames are recorded once enabled, from the start if cfg.Enabled.
+func New(gateway string, cfg config.CaptureConfig) (*Recorder, error) {
+	if cfg.Format != FormatPcapng && cfg.Format != FormatJSONL {
+		return nil, fmt.Errorf("unknown capture format %q", cfg.Format)
+	}
+	out, err := logfile.Open(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	out.MaxSize = int64(cfg.MaxSize) << 20
+	out.MaxBackups = cfg.MaxBackups
+	if cfg.Format == FormatPcapng {
+		out.Header = pcapngHeader()
+	}
+	r := &Recorder{gateway: gateway, format: cfg.Format, out: out, now: time.Now}
+	r.enabled.Store(cfg.Enabled)
+	return r, nil
+}
+
+// Enable starts or stops recording.
+func (r *Recorder) Enable(on bool) {
+	if r.enabled.Swap(on) != on {
+		slog.Info("Frame capture", "gateway", r.gateway, "enabled", on, "file", r.out.Path)
+	}
+}
+
+// Enabled reports whether frames are recorded.
+func (r *Recorder) Enabled() bool {
+	return r.enabled.Load()
+}
+
+// File returns the path of the capture file.
+func (r *Recorder) File() string {
+	return r.out.Path
+}
+
+// Format returns the format of the capture file, FormatPcapng or FormatJSONL.
+func (r *Recorder) Format() string {
+	return r.format
+}
+
+// Frame records adu if enabled. dir is one of the directions of package transport.
+func (r *Recorder) Frame(dir string, cid uint64, adu []byte) {
+	if !r.Enabled() {
+		return
+	}
+	t := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf.Reset()
+	if r.format == FormatPcapng {
+		writeBlock(&r.buf, t, dir, cid, adu)
+	} else {
+		line, _ := json.Marshal(record{Time: t, Gateway: r.gateway, Dir: dir, CID: cid, Framing: framing(adu), ADU: hex.EncodeToString(adu)})
+		r.buf.Write(append(line, '\n'))
+	}
+	_, err := r.out.Write(r.buf.Bytes())
+	if err != nil && !r.failing {
+		slog.Warn("Failed to write frame capture", "gateway", r.gateway, "file", r.out.Path, "err", err)
+	}
+	r.failing = err != nil
+}
+
+// Close closes the capture file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.out.Close()
+}
+
+// record is a frame in a JSON lines capture.
+type record struct {
+	Time    time.Time `json:"time"`
+	Gateway string    `json:"gateway"`
+	Dir     string    `json:"dir"`
+	CID     uint64    `json:"cid"`
+	Framing string    `json:"framing"` // "tcp" for an MBAP header, "rtu" for a trailing CRC
+	ADU     string    `json:"adu"`     // In hex
+}
+
+// framing tells the framing of adu: RTU frames end with their CRC, which the frames
+// of Modbus/TCP and UDP hardly ever happen to.
+func framing(adu []byte) string {
+	if len(adu) >= 4 {
+		var c crc.CRC
+		sum := c.Reset().PushBytes(adu[:len(adu)-2]).Value()
+		if binary.LittleEndian.Uint16(adu[len(adu)-2:]) == sum {
+			return "rtu"
+		}
+	}
+	return "tcp"
+}
+
+// pcapng block types and options, see
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html
+const (
+	blockSection   = 0x0A0D0D0A
+	blockInterface = 0x00000001
+	blockPacket    = 0x00000006
+	byteOrderMagic = 0x1A2B3C4D
+
+	optEnd     = 0
+	optComment = 1
+	optFlags   = 2 // Of enhanced packet blocks, direction in the lowest two bits
+
+	flagInbound  = 1
+	flagOutbound = 2
+)
+
+// linkTypeUpperPDU is Wireshark's exported PDU link type: each packet starts with
+// tags naming the dissector of the data that follows.
+const linkTypeUpperPDU = 252
+
+// Exported PDU tags, see wiretap/exported_pdu.h of Wireshark.
+const (
+	tagEnd           = 0
+	tagDissectorName = 12
+	tagPortType      = 24
+	tagSrcPort       = 25
+	tagDstPort       = 26
+
+	portTypeTCP = 2
+)
+
+// Ports of the frames: requests go to modbusPort, responses come from it. The legs
+// from masters and to devices get different ports of their own, so Wireshark
+// doesn't match a request of one leg with a response of the other.
+const (
+	modbusPort     = 502
+	upstreamPort   = 49152
+	downstreamPort = 49153
+)
+
+// pcapngHeader returns the section header and the interface description written at
+// the start of every capture file.
+func pcapngHeader() []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	b.Write(le.AppendUint32(nil, blockSection))
+	b.Write(le.AppendUint32(nil, 28))
+	b.Write(le.AppendUint32(nil, byteOrderMagic))
+	b.Write(le.AppendUint16(nil, 1)) // Version 1.0
+	b.Write(le.AppendUint16(nil, 0))
+	b.Write(le.AppendUint64(nil, ^uint64(0))) // Section length unknown
+	b.Write(le.AppendUint32(nil, 28))
+
+	b.Write(le.AppendUint32(nil, blockInterface))
+	b.Write(le.AppendUint32(nil, 20))
+	b.Write(le.AppendUint16(nil, linkTypeUpperPDU))
+	b.Write(le.AppendUint16(nil, 0))
+	b.Write(le.AppendUint32(nil, 0)) // No snap length
+	b.Write(le.AppendUint32(nil, 20))
+	return b.Bytes()
+}
+
+// writeBlock writes adu as an enhanced packet block, with timestamps in microseconds.
+func writeBlock(b *bytes.Buffer, t time.Time, dir string, cid uint64, adu []byte) {
+	data := exportedPDU(dir, adu)
+	comment := fmt.Sprintf("%s, request %d", dir, cid)
+	flags := uint32(flagInbound)
+	if dir == transport.UpstreamTx || dir == transport.DownstreamTx {
+		flags = flagOutbound
+	}
+
+	size := 28 + padded(len(data)) + 4 + padded(len(comment)) + 4 + 4 + 4 + 4
+	le := binary.LittleEndian
+	ts := uint64(t.UnixMicro())
+	b.Write(le.AppendUint32(nil, blockPacket))
+	b.Write(le.AppendUint32(nil, uint32(size)))
+	b.Write(le.AppendUint32(nil, 0)) // Interface
+	b.Write(le.AppendUint32(nil, uint32(ts>>32)))
+	b.Write(le.AppendUint32(nil, uint32(ts)))
+	b.Write(le.AppendUint32(nil, uint32(len(data))))
+	b.Write(le.AppendUint32(nil, uint32(len(data))))
+	b.Write(data)
+	pad(b, len(data))
+
+	b.Write(le.AppendUint16(nil, optComment))
+	b.Write(le.AppendUint16(nil, uint16(len(comment))))
+	b.WriteString(comment)
+	pad(b, len(comment))
+	b.Write(le.AppendUint16(nil, optFlags))
+	b.Write(le.AppendUint16(nil, 4))
+	b.Write(le.AppendUint32(nil, flags))
+	b.Write(le.AppendUint16(nil, optEnd))
+	b.Write(le.AppendUint16(nil, 0))
+	b.Write(le.AppendUint32(nil, uint32(size)))
+}
+
+// exportedPDU returns adu prefixed with the exported PDU tags of its dissector and
+// ports. The tags are big endian, unlike the blocks of the file.
+func exportedPDU(dir string, adu []byte) []byte {
+	dissector := "mbtcp"
+	if framing(adu) == "rtu" {
+		dissector = "mbrtu"
+	}
+	client := uint32(upstreamPort)
+	if dir == transport.DownstreamTx || dir == transport.DownstreamRx {
+		client = downstreamPort
+	}
+	src, dst := client, uint32(modbusPort)
+	if dir == transport.UpstreamTx || dir == transport.DownstreamRx {
+		src, dst = dst, src
+	}
+
+	var b bytes.Buffer
+	be := binary.BigEndian
+	b.Write(be.AppendUint16(nil, tagDissectorName))
+	b.Write(be.AppendUint16(nil, uint16(padded(len(dissector)))))
+	b.WriteString(dissector)
+	pad(&b, len(dissector))
+	for _, tag := range [][2]uint32{{tagPortType, portTypeTCP}, {tagSrcPort, src}, {tagDstPort, dst}} {
+		b.Write(be.AppendUint16(nil, uint16(tag[0])))
+		b.Write(be.AppendUint16(nil, 4))
+		b.Write(be.AppendUint32(nil, tag[1]))
+	}
+	b.Write(be.AppendUint16(nil, tagEnd))
+	b.Write(be.AppendUint16(nil, 0))
+	b.Write(adu)
+	return b.Bytes()
+}
+
+// padded returns n rounded up to a multiple of 4.
+func padded(n int) int {
+	return (n + 3) &^ 3
+}
+
+// pad writes the zeros padding n bytes to a multiple of 4.
+func pad(b *bytes.Buffer, n int) {
+	b.Write(make([]byte, padded(n)-n))
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+var (
+	tcpRequest  = []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x02}
+	rtuRequest  = []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x0B}
+	rtuResponse = []byte{0x01, 0x03, 0x04, 0x00, 0x0A, 0x00, 0x0B, 0x9B, 0xF6}
+)
+
+func TestRecorder_JSONL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "plant.jsonl")
+	r, err := New("plant", config.CaptureConfig{File: file, Format: FormatJSONL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	ctx := transport.TraceRequest(transport.WithFrameSink(context.Background(), r))
+	transport.TraceFrame(ctx, transport.UpstreamRx, tcpRequest) // Not yet enabled
+	r.Enable(true)
+	transport.TraceFrame(ctx, transport.UpstreamRx, tcpRequest)
+	transport.TraceFrame(ctx, transport.DownstreamTx, rtuRequest)
+	r.Enable(false)
+	transport.TraceFrame(ctx, transport.DownstreamRx, rtuResponse)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []record
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var rec record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", s.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("recorded %d frames, want the 2 while enabled: %+v", len(records), records)
+	}
+	want := record{Time: now, Gateway: "plant", Dir: transport.UpstreamRx, CID: records[0].CID, Framing: "tcp", ADU: "000100000006010300000002"}
+	if records[0] != want || records[0].CID == 0 {
+		t.Errorf("first frame = %+v, want %+v", records[0], want)
+	}
+	if rec := records[1]; rec.Dir != transport.DownstreamTx || rec.Framing != "rtu" || rec.CID != records[0].CID {
+		t.Errorf("second frame = %+v, want an RTU frame of the same request", rec)
+	}
+}
+
+func TestRecorder_Pcapng(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "plant.pcapng")
+	r, err := New("plant", config.CaptureConfig{File: file, Format: FormatPcapng, Enabled: true, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.out.MaxSize = 450 // Three frames to a file
+
+	ctx := transport.TraceRequest(transport.WithFrameSink(context.Background(), r))
+	frames := [][]byte{tcpRequest, rtuRequest, rtuResponse, tcpRequest}
+	dirs := []string{transport.UpstreamRx, transport.DownstreamTx, transport.DownstreamRx, transport.UpstreamTx}
+	for i, adu := range frames {
+		transport.TraceFrame(ctx, dirs[i], adu)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := filepath.Glob(file + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+	first := readPcapng(t, backups[0])
+	second := readPcapng(t, file)
+	if len(first) != 3 || len(second) != 1 {
+		t.Fatalf("files hold %d and %d frames, want 3 and 1", len(first), len(second))
+	}
+	for i, data := range append(first, second...) {
+		if !bytes.HasSuffix(data, frames[i]) {
+			t.Errorf("frame %d = % X, want it to end with % X", i, data, frames[i])
+		}
+		dissector := "mbtcp"
+		if i == 1 || i == 2 {
+			dissector = "mbrtu"
+		}
+		if name := string(bytes.TrimRight(data[4:12], "\x00")); name != dissector {
+			t.Errorf("frame %d dissector = %q, want %q", i, name, dissector)
+		}
+	}
+}
+
+// readPcapng returns the packet data of the enhanced packet blocks of a file, which
+// must start with a section header and an interface of the exported PDU link type.
+func readPcapng(t *testing.T, file string) [][]byte {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	if len(b) < 48 || le.Uint32(b) != blockSection || le.Uint32(b[8:]) != byteOrderMagic {
+		t.Fatalf("%s doesn't start with a section header", file)
+	}
+	if le.Uint32(b[28:]) != blockInterface || le.Uint16(b[36:]) != linkTypeUpperPDU {
+		t.Fatalf("%s has no interface of link type %d", file, linkTypeUpperPDU)
+	}
+	var packets [][]byte
+	for b = b[48:]; len(b) > 0; {
+		size := le.Uint32(b[4:])
+		if size > uint32(len(b)) || le.Uint32(b[size-4:]) != size {
+			t.Fatalf("%s: block of invalid size %d", file, size)
+		}
+		if le.Uint32(b) == blockPacket {
+			packets = append(packets, b[28:28+le.Uint32(b[20:])])
+		}
+		b = b[size:]
+	}
+	return packets
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package chaos injects faults into a downstream: latency, requests that are never
+// answered, responses failing their CRC check and dropped connections. It hardens
+// master retry logic and the gateway's own error paths against a misbehaving bus
+// without having to unplug cables.
+//
+// Faults surface as the errors the transports themselves return, wrapping
+// modbus.ErrTimeout, modbus.ErrCRC and modbus.ErrConnection.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+type fault int
+
+const (
+	none fault = iota
+	drop
+	corrupt
+	disconnect
+)
+
+func (f fault) String() string {
+	switch f {
+	case drop:
+		return "drop"
+	case corrupt:
+		return "corrupt"
+	case disconnect:
+		return "disconnect"
+	default:
+		return "none"
+	}
+}
+
+// Downstream wraps a transport.Downstream, injecting the configured faults.
+type Downstream struct {
+	transport.Downstream
+	cfg config.ChaosConfig
+
+	mu   sync.Mutex // rand.Rand is not safe for concurrent use
+	rand *rand.Rand
+}
+
+// Wrap returns ds with fault injection. The rates must lie between 0 and 1 and
+// add up to at most 1, as a request suffers at most one fault.
+func Wrap(ds transport.Downstream, cfg config.ChaosConfig) (*Downstream, error) {
+	sum := 0.0
+	for _, r := range []struct {
+		name string
+		rate float64
+	}{{"drop_rate", cfg.DropRate}, {"corrupt_rate", cfg.CorruptRate}, {"disconnect_rate", cfg.DisconnectRate}} {
+		if r.rate < 0 || r.rate > 1 {
+			return nil, fmt.Errorf("chaos: %s %v out of range [0, 1]", r.name, r.rate)
+		}
+		sum += r.rate
+	}
+	if sum > 1 {
+		return nil, fmt.Errorf("chaos: fault rates add up to %v, more than 1", sum)
+	}
+	if cfg.Latency < 0 || cfg.Jitter < 0 {
+		return nil, fmt.Errorf("chaos: negative latency or jitter")
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Downstream{Downstream: ds, cfg: cfg, rand: rand.New(rand.NewSource(seed))}, nil
+}
+
+// roll draws the delay and the fault of one request.
+func (d *Downstream) roll() (time.Duration, fault) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delay := d.cfg.Latency
+	if d.cfg.Jitter > 0 {
+		delay += time.Duration(d.rand.Int63n(int64(d.cfg.Jitter) + 1))
+	}
+
+	r := d.rand.Float64()
+	switch {
+	case r < d.cfg.DropRate:
+		return delay, drop
+	case r < d.cfg.DropRate+d.cfg.CorruptRate:
+		return delay, corrupt
+	case r < d.cfg.DropRate+d.cfg.CorruptRate+d.cfg.DisconnectRate:
+		return delay, disconnect
+	}
+	return delay, none
+}
+
+// Send forwards the request after the injected delay, unless a fault strikes.
+// Dropped requests and closed connections never reach the device, corrupted
+// responses do and are discarded afterwards.
+func (d *Downstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	delay, f := d.roll()
+	if f != none {
+		transport.Logger(ctx).Debug("Injecting fault", "fault", f, "func", req.FunctionCode)
+	}
+	if delay > 0 {
+		if err := sleep(ctx, delay); err != nil {
+			return modbus.ProtocolDataUnit{}, modbus.IOError(err)
+		}
+	}
+
+	switch f {
+	case drop:
+		if err := sleep(ctx, d.cfg.Timeout); err != nil {
+			return modbus.ProtocolDataUnit{}, modbus.IOError(err)
+		}
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("%w: chaos: request dropped", modbus.ErrTimeout)
+	case disconnect:
+		d.Downstream.Close()
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("%w: chaos: connection closed", modbus.ErrConnection)
+	}
+
+	resp, err := d.Downstream.Send(ctx, slaveID, req)
+	if err == nil && f == corrupt {
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("%w: chaos: response corrupted", modbus.ErrCRC)
+	}
+	return resp, err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
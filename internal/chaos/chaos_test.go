@@ -0,0 +1,125 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// countingDownstream answers every request and counts requests and closes.
+type countingDownstream struct {
+	sent, closed int
+}
+
+func (c *countingDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	c.sent++
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, 0x01}}, nil
+}
+
+func (c *countingDownstream) Connect(ctx context.Context) error { return nil }
+func (c *countingDownstream) Close() error                      { c.closed++; return nil }
+
+var readRequest = modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          config.ChaosConfig
+		want         error
+		sent, closed int
+	}{
+		{"none", config.ChaosConfig{Latency: time.Millisecond}, nil, 1, 0},
+		{"drop", config.ChaosConfig{DropRate: 1, Timeout: time.Millisecond}, modbus.ErrTimeout, 0, 0},
+		{"corrupt", config.ChaosConfig{CorruptRate: 1}, modbus.ErrCRC, 1, 0},
+		{"disconnect", config.ChaosConfig{DisconnectRate: 1}, modbus.ErrConnection, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &countingDownstream{}
+			d, err := Wrap(inner, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = d.Send(context.Background(), 1, readRequest)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if inner.sent != tt.sent || inner.closed != tt.closed {
+				t.Errorf("sent %d closed %d, want %d and %d", inner.sent, inner.closed, tt.sent, tt.closed)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	d, err := Wrap(&countingDownstream{}, config.ChaosConfig{Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := d.Send(context.Background(), 1, readRequest); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("request took %v, want at least 20ms", elapsed)
+	}
+
+	// A request is abandoned once its context ends, like on a real bus.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := d.Send(ctx, 1, readRequest); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestDropHonoursDeadline(t *testing.T) {
+	d, err := Wrap(&countingDownstream{}, config.ChaosConfig{DropRate: 1, Timeout: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.Send(ctx, 1, readRequest); !errors.Is(err, modbus.ErrTimeout) {
+		t.Errorf("err = %v, want timeout", err)
+	}
+}
+
+func TestRates(t *testing.T) {
+	d, err := Wrap(&countingDownstream{}, config.ChaosConfig{DropRate: 0.2, CorruptRate: 0.3, Seed: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[fault]int{}
+	for i := 0; i < 10000; i++ {
+		_, f := d.roll()
+		counts[f]++
+	}
+	for f, want := range map[fault]int{drop: 2000, corrupt: 3000, none: 5000} {
+		if got := counts[f]; got < want-300 || got > want+300 {
+			t.Errorf("%v: %d of 10000, want about %d", f, got, want)
+		}
+	}
+	if counts[disconnect] != 0 {
+		t.Errorf("disconnect: %d, want 0", counts[disconnect])
+	}
+}
+
+func TestWrap_Invalid(t *testing.T) {
+	for _, cfg := range []config.ChaosConfig{
+		{DropRate: -0.1},
+		{CorruptRate: 1.5},
+		{DropRate: 0.6, DisconnectRate: 0.6},
+		{Latency: -time.Second},
+	} {
+		if _, err := Wrap(&countingDownstream{}, cfg); err == nil {
+			t.Errorf("Wrap(%+v) succeeded", cfg)
+		}
+	}
+}
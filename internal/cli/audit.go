@@ -0,0 +1,45 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ffutop/modbus-gateway/internal/audit"
+)
+
+func init() {
+	register(Command{Name: "verify-audit", Summary: "Check that a write audit trail was not tampered with", Run: runVerifyAudit})
+}
+
+func runVerifyAudit(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway verify-audit file")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := audit.Verify(f)
+	if err != nil {
+		return fmt.Errorf("%w, %d entries before it are intact", err, n)
+	}
+	fmt.Fprintf(stdout, "%d entries intact\n", n)
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func init() {
+	register(Command{Name: "bench", Summary: "Measure throughput and latency of a device or gateway", Run: runBench})
+}
+
+func runBench(args []string, stdout io.Writer) error {
+	var t target
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	t.register(fs)
+	concurrency := fs.Int("concurrency", 1, "number of parallel connections")
+	duration := fs.Duration("duration", 10*time.Second, "how long to run")
+	requests := fs.Int("requests", 0, "stop after this many requests, 0 runs for -duration")
+	count := fs.Int("count", 1, "number of values per request")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway bench -target url [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("invalid concurrency %d", *concurrency)
+	}
+	if err := t.parseURL(); err != nil {
+		return err
+	}
+	if t.rtu != "" && *concurrency > 1 {
+		return fmt.Errorf("a serial port can't be shared, use -concurrency 1 with -rtu")
+	}
+
+	tg, err := t.tag()
+	if err != nil {
+		return err
+	}
+	var req pdu.Request
+	switch t.fc {
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteMultipleCoils,
+		modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeWriteMultipleRegisters:
+		req, err = writeRequest(tg, t.fc, strings.Fields(strings.Repeat("0 ", *count)))
+	default:
+		req, err = readRequest(tg, *count)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	// Connect all workers up front so dialing doesn't count against latency
+	conns := make([]transport.Downstream, *concurrency)
+	for i := range conns {
+		if conns[i], err = t.connect(ctx); err != nil {
+			return err
+		}
+		defer conns[i].Close()
+	}
+
+	fmt.Fprintf(stdout, "-- Benchmarking slave %d with %d connections, function 0x%02X\n", tg.SlaveID, *concurrency, req.PDU().FunctionCode)
+	res := load(ctx, conns, *requests, func(ctx context.Context, ds transport.Downstream) error {
+		_, err := send(ctx, ds, t.timeout, tg.SlaveID, req)
+		return err
+	})
+	res.report(stdout)
+	return nil
+}
+
+// result collects the outcome of a load run.
+type result struct {
+	elapsed   time.Duration
+	latencies []time.Duration // of successful requests
+	errors    map[string]int  // by class
+}
+
+// load sends requests through every connection in parallel until ctx is done
+// or limit requests were sent, if limit is positive.
+func load(ctx context.Context, conns []transport.Downstream, limit int, do func(context.Context, transport.Downstream) error) *result {
+	res := &result{errors: make(map[string]int)}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		sent int
+	)
+	start := time.Now()
+	for _, ds := range conns {
+		wg.Add(1)
+		go func(ds transport.Downstream) {
+			defer wg.Done()
+			var latencies []time.Duration
+			errs := make(map[string]int)
+			defer func() {
+				mu.Lock()
+				res.latencies = append(res.latencies, latencies...)
+				for class, n := range errs {
+					res.errors[class] += n
+				}
+				mu.Unlock()
+			}()
+
+			for ctx.Err() == nil {
+				if limit > 0 {
+					mu.Lock()
+					if sent >= limit {
+						mu.Unlock()
+						return
+					}
+					sent++
+					mu.Unlock()
+				}
+
+				begin := time.Now()
+				err := do(ctx, ds)
+				if err == nil {
+					latencies = append(latencies, time.Since(begin))
+				} else if ctx.Err() == nil {
+					errs[errorClass(err)]++
+				}
+			}
+		}(ds)
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// errorClass names the class of a failed request for the report.
+func errorClass(err error) string {
+	var e *modbus.Error
+	if errors.As(err, &e) {
+		return fmt.Sprintf("exception %d", e.ExceptionCode)
+	}
+	return modbus.Classify(err)
+}
+
+func (r *result) report(w io.Writer) {
+	var failed int
+	classes := make([]string, 0, len(r.errors))
+	for class, n := range r.errors {
+		failed += n
+		classes = append(classes, fmt.Sprintf("%s %d", class, n))
+	}
+	sort.Strings(classes)
+
+	fmt.Fprintf(w, "Requests:   %d (%d failed)\n", len(r.latencies)+failed, failed)
+	fmt.Fprintf(w, "Duration:   %v\n", r.elapsed.Round(time.Millisecond))
+	if r.elapsed > 0 {
+		fmt.Fprintf(w, "Throughput: %.1f req/s\n", float64(len(r.latencies))/r.elapsed.Seconds())
+	}
+	if len(r.latencies) > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		var sum time.Duration
+		for _, d := range r.latencies {
+			sum += d
+		}
+		fmt.Fprintf(w, "Latency:    min %v  avg %v  p50 %v  p90 %v  p99 %v  max %v\n",
+			round(r.latencies[0]), round(sum/time.Duration(len(r.latencies))),
+			round(r.percentile(50)), round(r.percentile(90)), round(r.percentile(99)), round(r.latencies[len(r.latencies)-1]))
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "Errors:     %s\n", strings.Join(classes, ", "))
+	}
+}
+
+// percentile expects the latencies to be sorted.
+func (r *result) percentile(p int) time.Duration {
+	i := (len(r.latencies)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return r.latencies[i]
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package cli implements the subcommands of the modbus-gateway binary,
+// such as poll and write for testing devices from the field.
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Command is a subcommand of the binary.
+type Command struct {
+	Name    string
+	Summary string
+	Run     func(args []string, stdout io.Writer) error
+}
+
+var commands = make(map[string]Command)
+
+func register(c Command) {
+	commands[c.Name] = c
+}
+
+// Lookup returns the subcommand with the given name.
+func Lookup(name string) (Command, bool) {
+	c, ok := commands[name]
+	return c, ok
+}
+
+// Usage writes the list of subcommands.
+func Usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage: modbus-gateway [-config file] | <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].Summary)
+	}
+}
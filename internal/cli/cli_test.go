@@ -0,0 +1,410 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/audit"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport/local"
+	"github.com/ffutop/modbus-gateway/transport/tcp"
+)
+
+// startSlave serves a memory backed local slave over Modbus TCP.
+func startSlave(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	slave := local.NewClient(config.LocalConfig{})
+	go tcp.NewServer(addr).Start(ctx, slave.Send)
+
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("slave did not start on %s", addr)
+	return ""
+}
+
+func run(t *testing.T, name string, args ...string) (string, error) {
+	t.Helper()
+	cmd, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("command %s not registered", name)
+	}
+	var out bytes.Buffer
+	err := cmd.Run(args, &out)
+	return out.String(), err
+}
+
+func TestPollWrite(t *testing.T) {
+	addr := startSlave(t)
+
+	tests := []struct {
+		name  string
+		write []string
+		poll  []string
+		want  []string
+	}{
+		{
+			name:  "registers",
+			write: []string{"-addr", "10", "100", "200"},
+			poll:  []string{"-addr", "10", "-count", "2"},
+			want:  []string{"[10]: 100", "[11]: 200"},
+		},
+		{
+			name:  "float32 CDAB",
+			write: []string{"-addr", "40021", "-type", "float32", "-order", "CDAB", "1.5"},
+			poll:  []string{"-addr", "40021", "-type", "float32", "-order", "CDAB"},
+			want:  []string{"[20]: 1.5"},
+		},
+		{
+			name:  "coils",
+			write: []string{"-fc", "15", "-addr", "3", "on", "0", "1"},
+			poll:  []string{"-fc", "1", "-addr", "3", "-count", "3"},
+			want:  []string{"[3]: 1", "[4]: 0", "[5]: 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := run(t, "write", append([]string{"-tcp", addr}, tt.write...)...); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			out, err := run(t, "poll", append([]string{"-tcp", addr}, tt.poll...)...)
+			if err != nil {
+				t.Fatalf("poll error = %v", err)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(out, line+"\n") {
+					t.Errorf("poll output missing %q:\n%s", line, out)
+				}
+			}
+		})
+	}
+
+	out, err := run(t, "read", "-target", "tcp://"+addr, "-addr", "10", "-type", "uint32")
+	if err != nil || !strings.Contains(out, "[10]: 6553800\n") {
+		t.Errorf("read = %v\n%s", err, out)
+	}
+}
+
+func TestPollWrite_Errors(t *testing.T) {
+	addr := startSlave(t)
+
+	if _, err := run(t, "poll", "-addr", "0"); err == nil {
+		t.Error("poll without device expected error")
+	}
+	if _, err := run(t, "write", "-tcp", addr, "-addr", "30001", "1"); err == nil {
+		t.Error("write to input register expected error")
+	}
+	if _, err := run(t, "write", "-tcp", addr, "-addr", "0", "70000"); err == nil {
+		t.Error("write out of uint16 range expected error")
+	}
+	if _, err := run(t, "poll", "-tcp", addr, "-addr", "0", "-count", "126"); err == nil {
+		t.Error("poll beyond register limit expected error")
+	}
+	if _, err := run(t, "read", "-tcp", addr, "-loop", "1s"); err == nil {
+		t.Error("read with -loop expected error")
+	}
+}
+
+func TestBench(t *testing.T) {
+	addr := startSlave(t)
+
+	out, err := run(t, "bench", "-target", "tcp://"+addr, "-concurrency", "4", "-requests", "50", "-count", "10")
+	if err != nil {
+		t.Fatalf("bench error = %v", err)
+	}
+	for _, want := range []string{"Requests:   50 (0 failed)", "Throughput:", "p99"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("bench output missing %q:\n%s", want, out)
+		}
+	}
+
+	if _, err := run(t, "bench", "-target", "rtu:///dev/null", "-concurrency", "2"); err == nil {
+		t.Error("bench with shared serial port expected error")
+	}
+}
+
+func TestPlay(t *testing.T) {
+	addr := startSlave(t)
+	dir := t.TempDir()
+
+	csvScript := filepath.Join(dir, "poll.csv")
+	os.WriteFile(csvScript, []byte(`time,slave_id,function_code,address,count,values
+# write two registers, then read them back
+0s,1,16,40101,,7 0x0102
+20ms,1,3,100,2,
+`), 0644)
+	out, err := run(t, "play", "-target", "tcp://"+addr, csvScript)
+	if err != nil {
+		t.Fatalf("play csv error = %v", err)
+	}
+	if !strings.Contains(out, "fc 3: 040007"+"0102") || !strings.Contains(out, "-- 2 requests, 0 failed") {
+		t.Errorf("play csv output:\n%s", out)
+	}
+
+	yamlScript := filepath.Join(dir, "poll.yaml")
+	os.WriteFile(yamlScript, []byte(`requests:
+  - time: 0s
+    slave_id: 1
+    function_code: 5
+    address: "7"
+    values: [1]
+  - time: 10ms
+    slave_id: 1
+    function_code: 1
+    address: "7"
+`), 0644)
+	out, err = run(t, "play", "-target", "tcp://"+addr, "-repeat", "2", yamlScript)
+	if err != nil {
+		t.Fatalf("play yaml error = %v", err)
+	}
+	if strings.Count(out, "fc 1: 0101") != 2 || !strings.Contains(out, "-- 4 requests, 0 failed") {
+		t.Errorf("play yaml output:\n%s", out)
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	os.WriteFile(bad, []byte("0s,1,6,0,,\n"), 0644)
+	if _, err := run(t, "play", "-target", "tcp://"+addr, bad); err == nil {
+		t.Error("play with missing write value expected error")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slave := local.NewClient(config.LocalConfig{})
+	go tcp.NewServer(addr).Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if slaveID > 3 && slaveID != 7 {
+			return modbus.ProtocolDataUnit{}, modbus.ErrTimeout
+		}
+		return slave.Send(ctx, slaveID, pdu)
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	out, err := run(t, "discover", "-tcp", addr, "-ids", "1-10")
+	if err != nil {
+		t.Fatalf("discover error = %v\n%s", err, out)
+	}
+	for _, want := range []string{"# slave 7 answered", `type: "tcp"`, `slave_ids: "1-3,7"`, `address: "` + addr + `"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("discover output lacks %q:\n%s", want, out)
+		}
+	}
+
+	_, port, _ := net.SplitHostPort(addr)
+	out, err = run(t, "discover", "-subnet", "127.0.0.1/32", "-port", port, "-ids", "6-7")
+	if err != nil {
+		t.Fatalf("discover -subnet error = %v\n%s", err, out)
+	}
+	if !strings.Contains(out, `slave_ids: "7"`) || !strings.Contains(out, `name: "127.0.0.1"`) {
+		t.Errorf("discover -subnet output:\n%s", out)
+	}
+}
+
+func TestScan(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slave := local.NewClient(config.LocalConfig{})
+	var fc atomic.Uint32
+	go tcp.NewServer(addr).Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		fc.Store(uint32(pdu.FunctionCode))
+		switch slaveID {
+		case 2:
+			return slave.Send(ctx, slaveID, pdu)
+		case 5:
+			return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: pdu.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+		}
+		return modbus.ProtocolDataUnit{}, modbus.ErrTimeout
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	out, err := run(t, "scan", "-target", "tcp://"+addr, "-ids", "1-6", "-fc", "4", "-addr", "100")
+	if err != nil {
+		t.Fatalf("scan error = %v\n%s", err, out)
+	}
+	if fc := fc.Load(); fc != modbus.FuncCodeReadInputRegisters {
+		t.Errorf("scan probed with function %d, want 4", fc)
+	}
+	for _, want := range []string{"function 0x04 at address 100", "exception: ", "# 2 slaves answered", `slave_ids: "2,5"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scan output lacks %q:\n%s", want, out)
+		}
+	}
+
+	if _, err := run(t, "scan", "-tcp", addr, "-fc", "6"); err == nil {
+		t.Error("scan with a write function code succeeded")
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	dir := t.TempDir()
+	cfg := `gateways:
+  - name: "plant"
+    upstreams:
+      - type: "tcp"
+        tcp:
+          address: "127.0.0.1:0"
+      - type: "tcp"
+        tcp:
+          address: "` + busy.Addr().String() + `"
+    downstreams:
+      - type: "rtu"
+        serial:
+          device: "` + filepath.Join(dir, "ttyUSB9") + `"
+      - type: "local"
+        local:
+          persistence:
+            type: "file"
+            path: "` + filepath.Join(dir, "slave.dat") + `"
+        record: "` + filepath.Join(dir, "missing", "rec.jsonl") + `"
+`
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, "doctor", "-config", file)
+	if err == nil || !strings.Contains(err.Error(), "3 of 6 checks failed") {
+		t.Errorf("doctor error = %v", err)
+	}
+	for _, want := range []string{
+		"[ OK ] configuration",
+		"[ OK ] listen 127.0.0.1:0",
+		"[FAIL] listen " + busy.Addr().String(),
+		"[FAIL] serial device " + filepath.Join(dir, "ttyUSB9") + ": does not exist",
+		"[ OK ] persistence " + filepath.Join(dir, "slave.dat"),
+		"fix: mkdir -p " + filepath.Join(dir, "missing"),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("doctor output lacks %q:\n%s", want, out)
+		}
+	}
+
+	out, err = run(t, "doctor", "-config", filepath.Join(dir, "none.yaml"))
+	if err == nil || !strings.Contains(out, "[FAIL] configuration") {
+		t.Errorf("doctor without config = %v\n%s", err, out)
+	}
+}
+
+func TestVerifyAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	trail, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0, 1, 0, 2}}
+	trail.Observe(context.Background(), "plant", 1, write, write, nil)
+	trail.Close()
+
+	out, err := run(t, "verify-audit", path)
+	if err != nil || !strings.Contains(out, "1 entries intact") {
+		t.Errorf("verify-audit = %q, %v", out, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(data, []byte(`"slave_id":1`), []byte(`"slave_id":2`), 1), 0o600)
+	if _, err := run(t, "verify-audit", path); err == nil {
+		t.Error("verify-audit accepted an edited trail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := `gateways:
+  - name: "plant"
+    upstreams:
+      - type: "tcp"
+        tcp:
+          address: "0.0.0.0:1502"
+    downstream:
+      type: "tcp"
+    downstreams:
+      - type: "rtu"
+        slave_ids: "1-3"
+        serial:
+          device: "/dev/ttyUSB0"
+          baud_rate: 19300
+      - type: "tcp"
+        slave_ids: "3,4"
+        tcp:
+          adress: "192.168.1.10:502"
+  - name: "bridge"
+    upstreams:
+      - type: "tcp"
+        tcp:
+          address: ":1502"
+    downstreams:
+      - type: "tcp"
+        tcp:
+          address: "192.168.1.11:502"
+`
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, "validate", "-config", file)
+	if err == nil || !strings.Contains(err.Error(), "6 problems found") {
+		t.Errorf("validate error = %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		`gateways[0].downstream: unknown key, did you mean "downstreams"?`,
+		`gateways[0].downstreams[1].tcp.adress: unknown key, did you mean "address"?`,
+		"gateways[0].downstreams[0].serial.baud_rate: 19300 is not a standard rate",
+		"gateways[0].downstreams[1].tcp.address: missing",
+		"gateways[0].downstreams[1].slave_ids: slave ID 3 is also routed to gateways[0].downstreams[0]",
+		"gateways[1].upstreams[0].tcp.address: :1502 is also bound by gateways[0].upstreams[0]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("validate output lacks %q:\n%s", want, out)
+		}
+	}
+
+	// The example shipped with the gateway is valid
+	if out, err := run(t, "validate", "-config", filepath.Join("..", "..", "config.yaml")); err != nil {
+		t.Errorf("validate config.yaml = %v\n%s", err, out)
+	}
+}
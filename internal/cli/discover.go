@@ -0,0 +1,250 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/discovery"
+	engine "github.com/ffutop/modbus-gateway/internal/gateway"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// maxSubnetHosts bounds -subnet to a /16 of IPv4 addresses.
+const maxSubnetHosts = 1 << 16
+
+func init() {
+	register(Command{Name: "discover", Summary: "Scan a bus or subnet for slaves and suggest downstreams", Run: runDiscover})
+}
+
+// found is a downstream with the slaves that answered on it.
+type found struct {
+	cfg config.DownstreamConfig
+	ids []byte
+}
+
+func runDiscover(args []string, stdout io.Writer) error {
+	var t target
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	t.register(fs)
+	fs.Lookup("timeout").DefValue = "200ms"
+	t.timeout = 200 * time.Millisecond
+	ids := fs.String("ids", "", "slave IDs to probe, default 1-247 on a bus and 1 on a subnet")
+	subnet := fs.String("subnet", "", "scan this `CIDR` for Modbus TCP devices instead of a single target")
+	port := fs.Int("port", 502, "TCP port probed with -subnet")
+	parallel := fs.Int("parallel", 64, "hosts probed in parallel with -subnet")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway discover -target url | -subnet cidr [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	probe := *ids
+	if probe == "" {
+		probe = "1-247"
+		if *subnet != "" {
+			probe = "1"
+		}
+	}
+	slaveIDs, err := engine.ParseSlaveIDs(probe)
+	if err != nil {
+		return err
+	}
+	if len(slaveIDs) == 0 {
+		return fmt.Errorf("no slave IDs to probe")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var results []found
+	if *subnet != "" {
+		prefix, err := netip.ParsePrefix(*subnet)
+		if err != nil {
+			return err
+		}
+		if *parallel < 1 {
+			return fmt.Errorf("invalid parallel %d", *parallel)
+		}
+		results, err = scanSubnet(ctx, stdout, prefix.Masked(), *port, *parallel, slaveIDs, t.timeout)
+		if err != nil {
+			return err
+		}
+	} else {
+		ds, err := t.connect(ctx)
+		if err != nil {
+			return err
+		}
+		defer ds.Close()
+		cfg := t.downstreamConfig()
+		fmt.Fprintf(stdout, "# Probing slaves %s on %s\n", discovery.FormatSlaveIDs(slaveIDs), describe(cfg))
+		present, err := discovery.Scan(ctx, ds, slaveIDs, t.timeout, func(id byte) {
+			fmt.Fprintf(stdout, "# slave %d answered\n", id)
+		})
+		if err != nil {
+			return err
+		}
+		if len(present) > 0 {
+			results = append(results, found{cfg: cfg, ids: present})
+		}
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintln(stdout, "# No slaves found")
+		return nil
+	}
+	writeDownstreams(stdout, results)
+	return nil
+}
+
+func describe(cfg config.DownstreamConfig) string {
+	if cfg.Type == "rtu" {
+		return cfg.Serial.Device
+	}
+	return cfg.Tcp.Address
+}
+
+// scanSubnet looks for hosts accepting connections on port and probes the slave IDs on each.
+func scanSubnet(ctx context.Context, stdout io.Writer, prefix netip.Prefix, port, parallel int, ids []byte, timeout time.Duration) ([]found, error) {
+	var hosts []netip.Addr
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		if len(hosts) == maxSubnetHosts {
+			return nil, fmt.Errorf("subnet %s is too large, at most %d hosts are scanned", prefix, maxSubnetHosts)
+		}
+		hosts = append(hosts, addr)
+	}
+	// Skip the network and broadcast addresses of IPv4 subnets
+	if prefix.Addr().Is4() && prefix.Bits() < 31 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	fmt.Fprintf(stdout, "# Probing %d hosts of %s on port %d\n", len(hosts), prefix, port)
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make([]*found, len(hosts))
+		next    = make(chan int)
+	)
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				address := net.JoinHostPort(hosts[i].String(), strconv.Itoa(port))
+				f := probeHost(ctx, address, ids, timeout)
+				if f == nil {
+					continue
+				}
+				mu.Lock()
+				fmt.Fprintf(stdout, "# %s answered for slaves %s\n", address, discovery.FormatSlaveIDs(f.ids))
+				mu.Unlock()
+				results[i] = f
+			}
+		}()
+	}
+	for i := range hosts {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var list []found
+	for _, f := range results {
+		if f != nil {
+			list = append(list, *f)
+		}
+	}
+	return list, nil
+}
+
+// probeHost returns the slaves answering at a Modbus TCP address, or nil if none do.
+func probeHost(ctx context.Context, address string, ids []byte, timeout time.Duration) *found {
+	if ctx.Err() != nil {
+		return nil
+	}
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil
+	}
+	conn.Close()
+
+	cfg := config.DownstreamConfig{Type: "tcp", Tcp: config.TcpConfig{Address: address}}
+	ds, err := transport.NewDownstream(cfg)
+	if err != nil {
+		return nil
+	}
+	defer ds.Close()
+	present, _ := discovery.Scan(ctx, ds, ids, timeout, nil)
+	if len(present) == 0 {
+		return nil
+	}
+	return &found{cfg: cfg, ids: present}
+}
+
+// writeDownstreams prints the downstreams section of a gateway configuration.
+func writeDownstreams(w io.Writer, results []found) {
+	seen := make(map[byte]bool)
+	fmt.Fprintln(w, "downstreams:")
+	for _, r := range results {
+		var dup []byte
+		for _, id := range r.ids {
+			if seen[id] {
+				dup = append(dup, id)
+			}
+			seen[id] = true
+		}
+		if len(dup) > 0 {
+			fmt.Fprintf(w, "  # slave IDs %s are already routed above, move this downstream to another gateway\n", discovery.FormatSlaveIDs(dup))
+		}
+
+		cfg := r.cfg
+		fmt.Fprintf(w, "  - name: %q\n", downstreamName(cfg))
+		fmt.Fprintf(w, "    type: %q\n", cfg.Type)
+		fmt.Fprintf(w, "    slave_ids: %q\n", discovery.FormatSlaveIDs(r.ids))
+		if cfg.Type == "rtu" {
+			fmt.Fprintln(w, "    serial:")
+			fmt.Fprintf(w, "      device: %q\n", cfg.Serial.Device)
+			fmt.Fprintf(w, "      baud_rate: %d\n", cfg.Serial.BaudRate)
+			fmt.Fprintf(w, "      data_bits: %d\n", cfg.Serial.DataBits)
+			fmt.Fprintf(w, "      parity: %q\n", cfg.Serial.Parity)
+			fmt.Fprintf(w, "      stop_bits: %d\n", cfg.Serial.StopBits)
+		} else {
+			fmt.Fprintln(w, "    tcp:")
+			fmt.Fprintf(w, "      address: %q\n", cfg.Tcp.Address)
+		}
+	}
+}
+
+func downstreamName(cfg config.DownstreamConfig) string {
+	if cfg.Type == "rtu" {
+		return filepath.Base(cfg.Serial.Device)
+	}
+	host, _, err := net.SplitHostPort(cfg.Tcp.Address)
+	if err != nil {
+		return cfg.Tcp.Address
+	}
+	return host
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+)
+
+func init() {
+	register(Command{Name: "doctor", Summary: "Check the environment a configuration needs and suggest fixes", Run: runDoctor})
+}
+
+// doctor prints the outcome of each check, with a fix for those that failed.
+type doctor struct {
+	w      io.Writer
+	passed map[string]bool // Outcome by check name
+	checks int
+	failed int
+}
+
+// check runs fn once per name, prints its outcome and reports whether it passed.
+func (d *doctor) check(name string, fn func() (fix string, err error)) bool {
+	if passed, ok := d.passed[name]; ok {
+		return passed
+	}
+	d.checks++
+
+	fix, err := fn()
+	d.passed[name] = err == nil
+	if err == nil {
+		fmt.Fprintf(d.w, "[ OK ] %s\n", name)
+		return true
+	}
+	d.failed++
+	fmt.Fprintf(d.w, "[FAIL] %s: %v\n", name, err)
+	if fix != "" {
+		fmt.Fprintf(d.w, "       fix: %s\n", fix)
+	}
+	return false
+}
+
+func runDoctor(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	configFile := fs.String("config", "", "Path to config file, searched like the gateway does if omitted")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway doctor [-config file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	d := &doctor{w: stdout, passed: make(map[string]bool)}
+	var cfg *config.Config
+	d.check("configuration", func() (string, error) {
+		var err error
+		cfg, err = config.LoadConfig(*configFile)
+		if err != nil {
+			return "pass -config, or place config.yaml in /etc/modbusgw/, $HOME/.modbusgw/ or the working directory", err
+		}
+		return "", nil
+	})
+	if cfg != nil {
+		d.run(cfg)
+	}
+
+	if d.failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", d.failed, d.checks)
+	}
+	return nil
+}
+
+// run checks the devices, listeners and files of every gateway.
+func (d *doctor) run(cfg *config.Config) {
+	if cfg.Log.File != "" {
+		d.check("log file "+cfg.Log.File, func() (string, error) { return checkWritable(cfg.Log.File) })
+	}
+	if cfg.Audit.File != "" {
+		d.check("audit trail "+cfg.Audit.File, func() (string, error) { return checkWritable(cfg.Audit.File) })
+	}
+	if cfg.API.Address != "" {
+		d.check("management API "+cfg.API.Address, func() (string, error) { return checkListen("tcp", cfg.API.Address) })
+	}
+
+	for _, gw := range cfg.Gateways {
+		for _, up := range gw.Upstreams {
+			switch up.Type {
+			case "rtu":
+				d.serial(up.Serial.Device)
+			case "udp":
+				address := up.Tcp.Address
+				d.check("listen udp "+address, func() (string, error) { return checkListen("udp", address) })
+			case "tcp", "rtu-over-tcp":
+				address := up.Tcp.Address
+				d.check("listen "+address, func() (string, error) { return checkListen("tcp", address) })
+				for _, file := range []string{up.TLS.CertFile, up.TLS.KeyFile, up.TLS.ClientCAFile} {
+					if file != "" {
+						d.check("TLS file "+file, func() (string, error) { return checkReadable(file) })
+					}
+				}
+			}
+		}
+
+		// Backups and load balanced members are checked like other downstreams
+		downstreams := slices.Clone(gw.Downstreams)
+		for _, ds := range gw.Downstreams {
+			downstreams = append(downstreams, ds.Backups...)
+			downstreams = append(downstreams, ds.Balance.Members...)
+		}
+		for _, ds := range downstreams {
+			switch ds.Type {
+			case "rtu":
+				d.serial(ds.Serial.Device)
+			case "tcp", "rtu-over-tcp":
+				for _, file := range []string{ds.TLS.CAFile, ds.TLS.CertFile, ds.TLS.KeyFile} {
+					if file != "" {
+						d.check("TLS file "+file, func() (string, error) { return checkReadable(file) })
+					}
+				}
+			case "local":
+				if p := ds.Local.Persistence; (p.Type == "file" || p.Type == "mmap" || p.Type == "bolt") && p.Path != "" {
+					d.check("persistence "+p.Path, func() (string, error) { return checkWritable(p.Path) })
+				}
+			case "replay":
+				file := ds.Replay.File
+				d.check("replay file "+file, func() (string, error) { return checkReadable(file) })
+			}
+			if ds.Record != "" {
+				file := ds.Record
+				d.check("record file "+file, func() (string, error) { return checkWritable(file) })
+			}
+			if ds.Script != "" {
+				file := ds.Script
+				d.check("script "+file, func() (string, error) { return checkReadable(file) })
+			}
+		}
+
+		for _, file := range []string{gw.Cloud.CertFile, gw.Cloud.KeyFile, gw.Cloud.CAFile} {
+			if file != "" {
+				d.check("cloud credentials "+file, func() (string, error) { return checkReadable(file) })
+			}
+		}
+	}
+}
+
+// serial checks that a serial device exists, can be opened and is not held by another process.
+func (d *doctor) serial(device string) {
+	ok := d.check("serial device "+device, func() (string, error) {
+		info, err := os.Stat(device)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "check the adapter is plugged in, ls /dev/serial/by-id/ lists the serial adapters found", fmt.Errorf("does not exist")
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeCharDevice == 0 {
+			return "point serial.device at a character device such as /dev/ttyUSB0", fmt.Errorf("not a character device")
+		}
+		if err := accessRW(device); err != nil {
+			return permissionFix(device, info), err
+		}
+		return "", nil
+	})
+	if !ok {
+		return
+	}
+
+	d.check("serial device "+device+" not in use", func() (string, error) {
+		holders := deviceHolders(device)
+		if len(holders) == 0 {
+			return "", nil
+		}
+		names := make([]string, len(holders))
+		for i, h := range holders {
+			names[i] = fmt.Sprintf("%s (pid %d)", h.name, h.pid)
+		}
+		fix := "stop " + strings.Join(names, ", ")
+		for _, h := range holders {
+			if h.name == "ModemManager" {
+				fix = "ModemManager probes serial adapters, sudo systemctl disable --now ModemManager"
+			}
+		}
+		return fix, fmt.Errorf("held by %s", strings.Join(names, ", "))
+	})
+}
+
+// checkListen binds address on the network, tcp or udp, and releases it right away.
+func checkListen(network, address string) (string, error) {
+	var ln io.Closer
+	var err error
+	if network == "udp" {
+		ln, err = net.ListenPacket(network, address)
+	} else {
+		ln, err = net.Listen(network, address)
+	}
+	if err == nil {
+		ln.Close()
+		return "", nil
+	}
+	switch {
+	case errors.Is(err, syscall.EACCES):
+		exe, exeErr := os.Executable()
+		if exeErr != nil {
+			exe = "modbus-gateway"
+		}
+		return fmt.Sprintf("ports below 1024 need CAP_NET_BIND_SERVICE: sudo setcap cap_net_bind_service=+ep %s, or AmbientCapabilities=CAP_NET_BIND_SERVICE in the systemd unit", exe), err
+	case errors.Is(err, syscall.EADDRINUSE):
+		_, port, _ := net.SplitHostPort(address)
+		return fmt.Sprintf("stop the process listening there, ss -l%snp 'sport = :%s' shows it; a running gateway holds its own ports", network[:1], port), err
+	case errors.Is(err, syscall.EADDRNOTAVAIL):
+		return "listen on an address of this host, or 0.0.0.0 for all", err
+	}
+	return "", err
+}
+
+// checkWritable reports whether path can be written, or created if it doesn't exist yet.
+func checkWritable(path string) (string, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+		return "", nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("sudo chown $USER %s", path), err
+	}
+
+	dir := filepath.Dir(path)
+	f, err = os.CreateTemp(dir, ".modbus-gateway-doctor-*")
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("mkdir -p %s", dir), fmt.Errorf("directory %s does not exist", dir)
+	}
+	if err != nil {
+		return fmt.Sprintf("sudo chown $USER %s, or pick a writable directory", dir), err
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return "", nil
+}
+
+// checkReadable reports whether path can be read.
+func checkReadable(path string) (string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "check the path, relative paths are resolved from the working directory", fmt.Errorf("does not exist")
+	}
+	if err != nil {
+		return fmt.Sprintf("sudo chmod o+r %s, or run the gateway as its owner", path), err
+	}
+	f.Close()
+	return "", nil
+}
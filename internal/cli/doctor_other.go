@@ -0,0 +1,35 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+//go:build !unix
+
+package cli
+
+import (
+	"io/fs"
+	"os"
+)
+
+type holder struct {
+	pid  int
+	name string
+}
+
+// accessRW opens path to find out whether it may be used.
+func accessRW(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func permissionFix(device string, info fs.FileInfo) string {
+	return "run the gateway as a user allowed to open " + device
+}
+
+// deviceHolders can't look at the open files of other processes here.
+func deviceHolders(device string) []holder {
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+//go:build unix
+
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// holder is a process with a device open.
+type holder struct {
+	pid  int
+	name string
+}
+
+// accessRW reports whether the current user may open path for reading and writing.
+func accessRW(path string) error {
+	const rw = 0x4 | 0x2 // R_OK | W_OK
+	return syscall.Access(path, rw)
+}
+
+// permissionFix suggests joining the group owning device, e.g. dialout.
+func permissionFix(device string, info fs.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "run the gateway as a user allowed to open " + device
+	}
+	group := strconv.FormatUint(uint64(st.Gid), 10)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return fmt.Sprintf("sudo usermod -aG %s $USER, then log in again", group)
+}
+
+// deviceHolders lists the other processes with device open, as far as procfs
+// lets us see them. Processes of other users are only visible to root.
+func deviceHolders(device string) []holder {
+	target, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return nil
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var holders []holder
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		fds, err := os.ReadDir(filepath.Join("/proc", p.Name(), "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join("/proc", p.Name(), "fd", fd.Name()))
+			if err != nil || link != target {
+				continue
+			}
+			comm, _ := os.ReadFile(filepath.Join("/proc", p.Name(), "comm"))
+			holders = append(holders, holder{pid: pid, name: strings.TrimSpace(string(comm))})
+			break
+		}
+	}
+	return holders
+}
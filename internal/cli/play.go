@@ -0,0 +1,244 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	register(Command{Name: "play", Summary: "Replay a timed script of requests from a CSV or YAML file", Run: runPlay})
+}
+
+// step is a scripted request, sent At after the start of the script.
+type step struct {
+	At           time.Duration `mapstructure:"time"`
+	SlaveID      byte          `mapstructure:"slave_id"`
+	FunctionCode byte          `mapstructure:"function_code"`
+	Address      string        `mapstructure:"address"`
+	Count        uint16        `mapstructure:"count"`
+	Values       []uint16      `mapstructure:"values"`
+}
+
+// request builds the request of the step.
+func (s step) request() (pdu.Request, error) {
+	_, addr, err := tag.ParseAddress("", s.Address)
+	if err != nil {
+		return nil, err
+	}
+	count := s.Count
+	if count == 0 {
+		count = 1
+	}
+
+	var req pdu.Request
+	switch s.FunctionCode {
+	case modbus.FuncCodeReadCoils:
+		req = pdu.ReadCoilsRequest{Address: addr, Quantity: count}
+	case modbus.FuncCodeReadDiscreteInputs:
+		req = pdu.ReadDiscreteInputsRequest{Address: addr, Quantity: count}
+	case modbus.FuncCodeReadHoldingRegisters:
+		req = pdu.ReadHoldingRegistersRequest{Address: addr, Quantity: count}
+	case modbus.FuncCodeReadInputRegisters:
+		req = pdu.ReadInputRegistersRequest{Address: addr, Quantity: count}
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister:
+		if len(s.Values) != 1 {
+			return nil, fmt.Errorf("function code %d writes exactly one value", s.FunctionCode)
+		}
+		if s.FunctionCode == modbus.FuncCodeWriteSingleCoil {
+			req = pdu.WriteSingleCoilRequest{Address: addr, Value: s.Values[0] != 0}
+		} else {
+			req = pdu.WriteSingleRegisterRequest{Address: addr, Value: s.Values[0]}
+		}
+	case modbus.FuncCodeWriteMultipleCoils:
+		bits := make([]bool, len(s.Values))
+		for i, v := range s.Values {
+			bits[i] = v != 0
+		}
+		req = pdu.WriteMultipleCoilsRequest{Address: addr, Values: bits}
+	case modbus.FuncCodeWriteMultipleRegisters:
+		req = pdu.WriteMultipleRegistersRequest{Address: addr, Values: s.Values}
+	default:
+		return nil, fmt.Errorf("unsupported function code %d", s.FunctionCode)
+	}
+
+	// Let the parser check the quantity limits, so the script fails before anything is sent
+	if _, err := pdu.ParseRequest(req.PDU()); err != nil {
+		return nil, fmt.Errorf("invalid quantity for function code %d", s.FunctionCode)
+	}
+	return req, nil
+}
+
+func runPlay(args []string, stdout io.Writer) error {
+	var t target
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	t.register(fs)
+	repeat := fs.Int("repeat", 1, "number of times to play the script, 0 repeats until interrupted")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway play -target url [flags] script.csv|script.yaml")
+		fmt.Fprintln(fs.Output(), "\nCSV columns: time,slave_id,function_code,address,count,values (space separated)")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one script file")
+	}
+
+	steps, err := loadScript(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	reqs := make([]pdu.Request, len(steps))
+	for i, s := range steps {
+		if reqs[i], err = s.request(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ds, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	var sent, failed int
+	defer func() {
+		fmt.Fprintf(stdout, "-- %d requests, %d failed\n", sent, failed)
+	}()
+	for run := 0; *repeat == 0 || run < *repeat; run++ {
+		start := time.Now()
+		for i, s := range steps {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(start.Add(s.At))):
+			}
+
+			begin := time.Now()
+			resp, err := send(ctx, ds, t.timeout, s.SlaveID, reqs[i])
+			sent++
+			prefix := fmt.Sprintf("+%.3fs slave %d fc %d", begin.Sub(start).Seconds(), s.SlaveID, s.FunctionCode)
+			if err != nil {
+				failed++
+				fmt.Fprintf(stdout, "%s: %v\n", prefix, err)
+				continue
+			}
+			fmt.Fprintf(stdout, "%s: %s (%v)\n", prefix, hex.EncodeToString(resp.Data), round(time.Since(begin)))
+		}
+	}
+	return nil
+}
+
+// loadScript reads the steps of a script, a CSV file unless its extension says YAML.
+func loadScript(path string) ([]step, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, err
+		}
+		var script struct {
+			Requests []step `mapstructure:"requests"`
+		}
+		if err := v.Unmarshal(&script); err != nil {
+			return nil, err
+		}
+		return script.Requests, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []step
+	for i, rec := range records {
+		if i == 0 && strings.EqualFold(rec[0], "time") {
+			continue // header
+		}
+		s, err := parseStep(rec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: record %d: %w", path, i+1, err)
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
+
+func parseStep(rec []string) (step, error) {
+	if len(rec) < 4 {
+		return step{}, fmt.Errorf("expected at least time, slave_id, function_code and address")
+	}
+	field := func(i int) string {
+		if i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var s step
+	var err error
+	if s.At, err = time.ParseDuration(field(0)); err != nil {
+		return step{}, err
+	}
+	slaveID, err := strconv.ParseUint(field(1), 10, 8)
+	if err != nil {
+		return step{}, fmt.Errorf("invalid slave ID: %w", err)
+	}
+	fc, err := strconv.ParseUint(field(2), 0, 8)
+	if err != nil {
+		return step{}, fmt.Errorf("invalid function code: %w", err)
+	}
+	s.SlaveID, s.FunctionCode, s.Address = byte(slaveID), byte(fc), field(3)
+	if c := field(4); c != "" {
+		count, err := strconv.ParseUint(c, 10, 16)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid count: %w", err)
+		}
+		s.Count = uint16(count)
+	}
+	for _, v := range strings.Fields(field(5)) {
+		n, err := strconv.ParseUint(v, 0, 16)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid value %q: %w", v, err)
+		}
+		s.Values = append(s.Values, uint16(n))
+	}
+	return s, nil
+}
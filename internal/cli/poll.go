@@ -0,0 +1,164 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func init() {
+	register(Command{Name: "poll", Summary: "Read coils or registers from a device", Run: runPoll})
+	register(Command{Name: "read", Summary: "Read coils or registers from a device once", Run: runRead})
+}
+
+func runPoll(args []string, stdout io.Writer) error {
+	return pollCommand("poll", args, stdout)
+}
+
+// runRead is poll without -loop, a single read.
+func runRead(args []string, stdout io.Writer) error {
+	return pollCommand("read", args, stdout)
+}
+
+func pollCommand(name string, args []string, stdout io.Writer) error {
+	var t target
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	t.register(fs)
+	count := fs.Int("count", 1, "number of values to read")
+	loop := new(time.Duration)
+	if name == "poll" {
+		fs.DurationVar(loop, "loop", 0, "poll repeatedly at this interval until interrupted")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: modbus-gateway %s -tcp host:port | -rtu-over-tcp host:port | -udp host:port | -rtu device [flags]\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tg, err := t.tag()
+	if err != nil {
+		return err
+	}
+	if *count < 1 {
+		return fmt.Errorf("invalid count %d", *count)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ds, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	fmt.Fprintf(stdout, "-- Polling slave %d, %s %d\n", tg.SlaveID, tg.Table, tg.Address)
+	for {
+		values, err := read(ctx, ds, t.timeout, tg, *count)
+		if err != nil {
+			if *loop == 0 {
+				return err
+			}
+			fmt.Fprintf(stdout, "Read failed: %v\n", err)
+		}
+		step := tg.Quantity()
+		if tg.Table == tag.TableCoils || tg.Table == tag.TableDiscreteInputs {
+			step = 1
+		}
+		for i, v := range values {
+			fmt.Fprintf(stdout, "[%d]: %v\n", int(tg.Address)+i*int(step), v)
+		}
+
+		if *loop == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*loop):
+		}
+	}
+}
+
+// read reads count consecutive values starting at the tag with a single request.
+func read(ctx context.Context, ds transport.Downstream, timeout time.Duration, t tag.Tag, count int) ([]any, error) {
+	req, err := readRequest(t, count)
+	if err != nil {
+		return nil, err
+	}
+	n := count * int(t.Quantity())
+
+	resp, err := send(ctx, ds, timeout, t.SlaveID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, count)
+	if t.Table == tag.TableCoils || t.Table == tag.TableDiscreteInputs {
+		bits, err := pdu.ParseReadBits(resp, uint16(count))
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range bits {
+			if b {
+				values[i] = 1
+			} else {
+				values[i] = 0
+			}
+		}
+		return values, nil
+	}
+
+	data, err := pdu.RegisterBytes(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < n*2 {
+		return nil, fmt.Errorf("short response: %d bytes for %d registers", len(data), n)
+	}
+	size := int(t.Quantity()) * 2
+	for i := range values {
+		if values[i], err = t.Decode(data[i*size : (i+1)*size]); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// readRequest builds the request reading count consecutive values starting at the tag.
+func readRequest(t tag.Tag, count int) (pdu.Request, error) {
+	switch t.Table {
+	case tag.TableCoils, tag.TableDiscreteInputs:
+		if count > pdu.MaxReadBits {
+			return nil, fmt.Errorf("count %d exceeds %d bits", count, pdu.MaxReadBits)
+		}
+		if t.Table == tag.TableCoils {
+			return pdu.ReadCoilsRequest{Address: t.Address, Quantity: uint16(count)}, nil
+		}
+		return pdu.ReadDiscreteInputsRequest{Address: t.Address, Quantity: uint16(count)}, nil
+	default:
+		n := count * int(t.Quantity())
+		if n > pdu.MaxReadRegisters {
+			return nil, fmt.Errorf("%d values of %s need %d registers, at most %d fit a request", count, t.Type, n, pdu.MaxReadRegisters)
+		}
+		if t.Table == tag.TableHoldingRegisters {
+			return pdu.ReadHoldingRegistersRequest{Address: t.Address, Quantity: uint16(n)}, nil
+		}
+		return pdu.ReadInputRegistersRequest{Address: t.Address, Quantity: uint16(n)}, nil
+	}
+}
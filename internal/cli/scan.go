@@ -0,0 +1,116 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/discovery"
+	engine "github.com/ffutop/modbus-gateway/internal/gateway"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+func init() {
+	register(Command{Name: "scan", Summary: "Probe the slave IDs of a bus and report their response times", Run: runScan})
+}
+
+func runScan(args []string, stdout io.Writer) error {
+	var t target
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	t.register(fs)
+	fs.Lookup("timeout").DefValue = "200ms"
+	t.timeout = 200 * time.Millisecond
+	fs.Lookup("fc").DefValue = "3"
+	t.fc = modbus.FuncCodeReadHoldingRegisters
+	ids := fs.String("ids", "1-247", "slave IDs to probe")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway scan -device /dev/ttyUSB0 | -target url [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if t.fc < 1 || t.fc > 4 {
+		return fmt.Errorf("invalid function code %d, scan reads with 1 to 4", t.fc)
+	}
+	tg, err := t.tag()
+	if err != nil {
+		return err
+	}
+	req, err := readRequest(tg, 1)
+	if err != nil {
+		return err
+	}
+	slaveIDs, err := engine.ParseSlaveIDs(*ids)
+	if err != nil {
+		return err
+	}
+	if len(slaveIDs) == 0 {
+		return fmt.Errorf("no slave IDs to probe")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ds, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	cfg := t.downstreamConfig()
+	probe := req.PDU()
+	where := describe(cfg)
+	if cfg.Type == "rtu" {
+		where = fmt.Sprintf("%s at %d baud", where, cfg.Serial.BaudRate)
+	}
+	fmt.Fprintf(stdout, "# Probing slaves %s on %s, function 0x%02X at address %d\n", discovery.FormatSlaveIDs(slaveIDs), where, probe.FunctionCode, tg.Address)
+	fmt.Fprintf(stdout, "%5s  %9s  %s\n", "SLAVE", "TIME", "ANSWER")
+
+	start := time.Now()
+	var present []byte
+	var fastest, slowest, total time.Duration
+	for _, id := range slaveIDs {
+		answer, ok, err := discovery.ProbeWith(ctx, ds, id, probe, t.timeout)
+		if ctx.Err() != nil {
+			break // Interrupted, report what was found
+		}
+		if err != nil {
+			return fmt.Errorf("slave %d: %w", id, err)
+		}
+		if !ok {
+			continue
+		}
+		result := "data"
+		if answer.Exception != nil {
+			result = "exception: " + answer.Exception.Error()
+		}
+		fmt.Fprintf(stdout, "%5d  %9s  %s\n", id, answer.Elapsed.Round(100*time.Microsecond), result)
+
+		if len(present) == 0 || answer.Elapsed < fastest {
+			fastest = answer.Elapsed
+		}
+		slowest = max(slowest, answer.Elapsed)
+		total += answer.Elapsed
+		present = append(present, id)
+	}
+
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if len(present) == 0 {
+		fmt.Fprintf(stdout, "# No slaves answered, in %s\n", elapsed)
+		return nil
+	}
+	fmt.Fprintf(stdout, "# %d slaves answered in %s, response time min %s, avg %s, max %s\n", len(present), elapsed,
+		fastest.Round(100*time.Microsecond), (total / time.Duration(len(present))).Round(100*time.Microsecond), slowest.Round(100*time.Microsecond))
+	writeDownstreams(stdout, []found{{cfg: cfg, ids: present}})
+	return nil
+}
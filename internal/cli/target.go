@@ -0,0 +1,162 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/transport"
+
+	_ "github.com/ffutop/modbus-gateway/transport/rtu"
+	_ "github.com/ffutop/modbus-gateway/transport/rtu-over-tcp"
+	_ "github.com/ffutop/modbus-gateway/transport/tcp"
+	_ "github.com/ffutop/modbus-gateway/transport/udp"
+)
+
+// target holds the flags selecting the device a command talks to.
+type target struct {
+	url        string
+	tcp        string
+	rtuOverTCP string
+	udp        string
+	rtu        string
+	serial     config.SerialConfig
+	timeout    time.Duration
+
+	slave  uint
+	fc     uint
+	addr   string
+	typ    string
+	order  string
+	length int
+}
+
+func (t *target) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.url, "target", "", "device `url`: tcp://host:port, rtu-over-tcp://host:port, udp://host:port or rtu:///dev/ttyUSB0")
+	fs.StringVar(&t.tcp, "tcp", "", "Modbus TCP device `host:port`")
+	fs.StringVar(&t.rtuOverTCP, "rtu-over-tcp", "", "RTU over TCP device `host:port`")
+	fs.StringVar(&t.udp, "udp", "", "Modbus UDP device `host:port`")
+	fs.StringVar(&t.rtu, "rtu", "", "serial `device` for Modbus RTU, e.g. /dev/ttyUSB0")
+	fs.StringVar(&t.rtu, "device", "", "serial `device`, same as -rtu")
+	fs.IntVar(&t.serial.BaudRate, "baud", 9600, "serial baud rate")
+	fs.IntVar(&t.serial.DataBits, "databits", 8, "serial data bits")
+	fs.StringVar(&t.serial.Parity, "parity", "N", "serial parity (N, E or O)")
+	fs.IntVar(&t.serial.StopBits, "stopbits", 1, "serial stop bits")
+	fs.DurationVar(&t.timeout, "timeout", time.Second, "response timeout")
+
+	fs.UintVar(&t.slave, "slave", 1, "slave ID")
+	fs.UintVar(&t.fc, "fc", 0, "function code, derived from a Modicon reference in -addr if omitted")
+	fs.StringVar(&t.addr, "addr", "0", "protocol address (decimal or 0x hex) or Modicon reference like 40001")
+	fs.StringVar(&t.typ, "type", "uint16", "register data type, e.g. int16, uint32, float32, string")
+	fs.StringVar(&t.order, "order", "ABCD", "byte order of multi-register values (ABCD, CDAB, BADC, DCBA)")
+	fs.IntVar(&t.length, "length", 0, "number of registers of a string")
+}
+
+// connect creates and connects the downstream selected by the flags.
+func (t *target) connect(ctx context.Context) (transport.Downstream, error) {
+	if err := t.parseURL(); err != nil {
+		return nil, err
+	}
+
+	if t.tcp == "" && t.rtuOverTCP == "" && t.udp == "" && t.rtu == "" {
+		return nil, fmt.Errorf("one of -target, -tcp, -rtu-over-tcp, -udp or -rtu is required")
+	}
+
+	ds, err := transport.NewDownstream(t.downstreamConfig())
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// downstreamConfig describes the target as a downstream of a gateway.
+func (t *target) downstreamConfig() config.DownstreamConfig {
+	var cfg config.DownstreamConfig
+	switch {
+	case t.tcp != "":
+		cfg.Type, cfg.Tcp.Address = "tcp", t.tcp
+	case t.rtuOverTCP != "":
+		cfg.Type, cfg.Tcp.Address = "rtu-over-tcp", t.rtuOverTCP
+	case t.udp != "":
+		cfg.Type, cfg.Tcp.Address = "udp", t.udp
+	default:
+		cfg.Type, cfg.Serial = "rtu", t.serial
+		cfg.Serial.Device = t.rtu
+		cfg.Serial.Parity = strings.ToUpper(cfg.Serial.Parity)
+		cfg.Serial.Timeout = t.timeout
+	}
+	return cfg
+}
+
+// parseURL sets the transport flag matching -target.
+func (t *target) parseURL() error {
+	if t.url == "" {
+		return nil
+	}
+	scheme, addr, ok := strings.Cut(t.url, "://")
+	if !ok || addr == "" {
+		return fmt.Errorf("invalid target %q, expected scheme://address", t.url)
+	}
+	switch scheme {
+	case "tcp":
+		t.tcp = addr
+	case "rtu-over-tcp":
+		t.rtuOverTCP = addr
+	case "udp":
+		t.udp = addr
+	case "rtu":
+		t.rtu = addr
+	default:
+		return fmt.Errorf("unsupported target scheme %q", scheme)
+	}
+	return nil
+}
+
+// tag describes the addressed data point as a tag, so values are decoded like configured tags.
+func (t *target) tag() (tag.Tag, error) {
+	if t.slave > 255 {
+		return tag.Tag{}, fmt.Errorf("invalid slave ID %d", t.slave)
+	}
+	var table string
+	switch t.fc {
+	case 0:
+	case 1, 5, 15:
+		table = "coils"
+	case 2:
+		table = "discrete_inputs"
+	case 3, 6, 16:
+		table = "holding_registers"
+	case 4:
+		table = "input_registers"
+	default:
+		return tag.Tag{}, fmt.Errorf("unsupported function code %d", t.fc)
+	}
+	resolved, _, err := tag.ParseAddress(table, t.addr)
+	if err != nil {
+		return tag.Tag{}, err
+	}
+	typ := t.typ
+	if resolved == tag.TableCoils || resolved == tag.TableDiscreteInputs {
+		typ = ""
+	}
+	return tag.New(config.TagConfig{
+		Name:      "cli",
+		SlaveID:   byte(t.slave),
+		Table:     table,
+		Address:   t.addr,
+		Type:      typ,
+		ByteOrder: t.order,
+		Length:    t.length,
+	})
+}
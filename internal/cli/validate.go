@@ -0,0 +1,310 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+
+	"github.com/ffutop/modbus-gateway/internal/acl"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	engine "github.com/ffutop/modbus-gateway/internal/gateway"
+	"github.com/ffutop/modbus-gateway/internal/partition"
+	"github.com/ffutop/modbus-gateway/internal/remap"
+	"github.com/ffutop/modbus-gateway/transport"
+
+	_ "github.com/ffutop/modbus-gateway/transport/local"
+	_ "github.com/ffutop/modbus-gateway/transport/replay"
+)
+
+func init() {
+	register(Command{Name: "validate", Summary: "Check a configuration for mistakes without starting it", Run: runValidate})
+}
+
+// baudRates are the rates serial adapters support.
+var baudRates = []int{300, 600, 1200, 2400, 4800, 9600, 14400, 19200, 38400, 57600, 115200, 230400, 460800, 921600}
+
+func runValidate(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configFile := fs.String("config", "", "Path to config file or conf.d directory, searched like the gateway does if omitted")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway validate [-config file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, file, issues, err := config.Check(*configFile)
+	if err != nil {
+		return err
+	}
+	v := &validator{devices: make(map[string]string)}
+	v.issues = issues
+	v.run(cfg)
+
+	for _, issue := range v.issues {
+		fmt.Fprintln(stdout, issue)
+	}
+	if len(v.issues) > 0 {
+		return fmt.Errorf("%d problems found in %s", len(v.issues), file)
+	}
+	fmt.Fprintf(stdout, "%s is valid: %d gateways\n", file, len(cfg.Gateways))
+	return nil
+}
+
+// validator collects the issues of a configuration. Only what fails without a device
+// is checked, doctor checks the environment.
+type validator struct {
+	issues  []config.Issue
+	binds   []bind
+	devices map[string]string // Path of the upstream or downstream using a serial device
+}
+
+// bind is an address an upstream listens on.
+type bind struct {
+	network, host, port string
+	path                string // Of the upstream
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.issues = append(v.issues, config.Issue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) run(cfg *config.Config) {
+	if len(cfg.Gateways) == 0 {
+		v.add("gateways", "no gateways configured")
+	}
+	if f := cfg.Log.Format; f != "" && f != "text" && f != "json" {
+		v.add("log.format", "%q, want text or json", f)
+	}
+	v.level("log.level", cfg.Log.Level)
+	if e := cfg.Tracing.Endpoint; e != "" {
+		if u, err := url.Parse(e); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("tracing.endpoint", "%q, want an http or https URL", e)
+		}
+	}
+	if r := cfg.Tracing.SampleRate; r < 0 || r > 1 {
+		v.add("tracing.sample_rate", "%g, want a fraction from 0 to 1", r)
+	}
+	names := make(map[string]string)
+	captures := make(map[string]string) // Path of the gateway by capture file
+	for i, gw := range cfg.Gateways {
+		path := fmt.Sprintf("gateways[%d]", i)
+		if other, ok := names[gw.Name]; ok {
+			v.add(path+".name", "%q is the name of %s too", gw.Name, other)
+		}
+		names[gw.Name] = path
+		v.level(path+".log.level", gw.Log.Level)
+		if file := gw.Capture.File; file != "" {
+			if f := gw.Capture.Format; f != "" && f != "pcapng" && f != "jsonl" {
+				v.add(path+".capture.format", "%q, want pcapng or jsonl", f)
+			}
+			if other, ok := captures[file]; ok {
+				v.add(path+".capture.file", "%s is also written by %s", file, other)
+			}
+			captures[file] = path
+		}
+
+		for j, up := range gw.Upstreams {
+			v.upstream(fmt.Sprintf("%s.upstreams[%d]", path, j), up)
+		}
+		if _, err := acl.New(gw.WriteACL); err != nil {
+			v.add(path+".write_acl", "%v", err)
+		}
+		if len(gw.Downstreams) == 0 {
+			v.add(path+".downstreams", "no downstreams, the gateway is skipped")
+		}
+		v.routes(path, gw.Downstreams)
+	}
+}
+
+// level checks a log level.
+func (v *validator) level(path, level string) {
+	switch level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		v.add(path, "%q, want debug, info, warn or error", level)
+	}
+}
+
+// upstream checks an upstream as the gateway creates it, and that no other binds its
+// address or serial device.
+func (v *validator) upstream(path string, up config.UpstreamConfig) {
+	us, err := transport.NewUpstream(up)
+	if err == nil {
+		us, err = acl.NewFunctionFilter(us, up.FunctionCodes)
+	}
+	if err == nil {
+		us, err = acl.NewDiode(us, up.ReadOnly, up.Scrub)
+	}
+	if err == nil {
+		us, err = acl.NewWindowFilter(us, up.AccessWindows, up.WriteWindows)
+	}
+	if err == nil {
+		_, err = acl.NewWriteLimiter(us, up.WriteRate, up.WriteBurst)
+	}
+	if err != nil {
+		v.add(path, "%v", err)
+	}
+
+	switch up.Type {
+	case "rtu":
+		v.serial(path+".serial", up.Serial)
+	case "tcp", "rtu-over-tcp", "udp":
+		network := "tcp"
+		if up.Type == "udp" {
+			network = "udp"
+		}
+		v.listen(path+".tcp.address", network, up.Tcp.Address)
+	}
+}
+
+// listen checks an address to listen on, and that no other upstream binds it.
+func (v *validator) listen(path, network, address string) {
+	if address == "" {
+		v.add(path, "missing, the address to listen on")
+		return
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		v.add(path, "%v", err)
+		return
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "" // All interfaces
+	}
+	// A listener on all interfaces conflicts with any of the same port
+	for _, b := range v.binds {
+		if b.network == network && b.port == port && port != "0" && (b.host == host || b.host == "" || host == "") {
+			v.add(path, "%s is also bound by %s", address, b.path)
+			return
+		}
+	}
+	v.binds = append(v.binds, bind{network: network, host: host, port: port, path: path})
+}
+
+// serial checks the settings of a serial port, and that no other transport uses it.
+func (v *validator) serial(path string, s config.SerialConfig) {
+	if s.Device == "" {
+		v.add(path+".device", "missing, the serial device such as /dev/ttyUSB0")
+	} else if other, ok := v.devices[s.Device]; ok {
+		v.add(path+".device", "%s is also used by %s", s.Device, other)
+	} else {
+		v.devices[s.Device] = path
+	}
+	if s.BaudRate != 0 && !slices.Contains(baudRates, s.BaudRate) {
+		v.add(path+".baud_rate", "%d is not a standard rate, such as 9600, 19200 or 115200", s.BaudRate)
+	}
+	if s.DataBits != 0 && (s.DataBits < 5 || s.DataBits > 8) {
+		v.add(path+".data_bits", "%d, want 5 to 8", s.DataBits)
+	}
+	if s.StopBits != 0 && s.StopBits != 1 && s.StopBits != 2 {
+		v.add(path+".stop_bits", "%d, want 1 or 2", s.StopBits)
+	}
+	if s.Parity != "" && s.Parity != "N" && s.Parity != "E" && s.Parity != "O" {
+		v.add(path+".parity", "%q, want N, E or O", s.Parity)
+	}
+}
+
+// downstream checks a downstream as the gateway creates it, and its backups and members.
+func (v *validator) downstream(path string, ds config.DownstreamConfig) {
+	if ds.Type != "load_balance" {
+		if _, err := transport.NewDownstream(ds); err != nil {
+			v.add(path, "%v", err)
+		}
+	}
+	switch ds.Type {
+	case "rtu":
+		v.serial(path+".serial", ds.Serial)
+	case "tcp", "rtu-over-tcp", "udp":
+		if ds.Tcp.Address == "" {
+			v.add(path+".tcp.address", "missing, the address of the device")
+		} else if _, _, err := net.SplitHostPort(ds.Tcp.Address); err != nil {
+			v.add(path+".tcp.address", "%v", err)
+		}
+	case "load_balance":
+		if len(ds.Balance.Members) == 0 {
+			v.add(path+".load_balance.members", "no members to balance")
+		}
+	}
+	if _, _, err := partition.ParseOffsets(ds); err != nil {
+		v.add(path+".address_offsets", "%v", err)
+	}
+	for i, b := range ds.Backups {
+		v.downstream(fmt.Sprintf("%s.backups[%d]", path, i), b)
+	}
+	for i, m := range ds.Balance.Members {
+		v.downstream(fmt.Sprintf("%s.load_balance.members[%d]", path, i), m)
+	}
+}
+
+// routes checks the downstreams of a gateway and the slave IDs routed to them. A
+// slave ID may only be shared by downstreams serving parts of it, and one downstream
+// may serve all slave IDs the others don't.
+func (v *validator) routes(path string, downstreams []config.DownstreamConfig) {
+	routed := make(map[byte]string) // Path of the downstream serving the whole slave
+	var defaultRoute string         // Path of the downstream serving all others
+	for i, ds := range downstreams {
+		dsPath := fmt.Sprintf("%s.downstreams[%d]", path, i)
+		v.downstream(dsPath, ds)
+		if f := ds.Probe.Function; ds.Probe.Interval > 0 && f > 4 {
+			v.add(dsPath+".probe.function", "%d, want a read of 1 to 4", f)
+		}
+
+		ranges, err := partition.ParseRanges(ds.AddressRanges)
+		if err != nil {
+			v.add(dsPath+".address_ranges", "%v", err)
+		}
+		functions, err := acl.ParseFunctions(ds.AllowFunctionCodes, ds.DenyFunctionCodes)
+		if err != nil {
+			v.add(dsPath+".allow_function_codes", "%v", err)
+		}
+		var ids []byte
+		all := engine.AllSlaveIDs(ds.SlaveIDs)
+		if !all {
+			if ids, err = engine.ParseSlaveIDs(ds.SlaveIDs); err != nil {
+				v.add(dsPath+".slave_ids", "%v", err)
+			}
+		}
+		mapped, err := remap.Parse(ds.SlaveIDMap)
+		if err != nil {
+			v.add(dsPath+".slave_id_map", "%v", err)
+		}
+		for id := range mapped {
+			ids = append(ids, id)
+		}
+		if ds.Discover.SlaveIDs != "" {
+			if _, err := engine.ParseSlaveIDs(ds.Discover.SlaveIDs); err != nil {
+				v.add(dsPath+".discover.slave_ids", "%v", err)
+			}
+		}
+
+		// A downstream without slave IDs serves all the others don't
+		if all || (len(ids) == 0 && ds.Discover.SlaveIDs == "") {
+			if defaultRoute != "" {
+				v.add(dsPath+".slave_ids", "serves all slave IDs like %s, give one of them slave_ids", defaultRoute)
+			}
+			defaultRoute = dsPath
+		}
+		if len(ranges) > 0 || functions != nil {
+			continue
+		}
+		for _, id := range ids {
+			if other, ok := routed[id]; ok && other == dsPath {
+				v.add(dsPath+".slave_ids", "slave ID %d is listed twice", id)
+				continue
+			} else if ok {
+				v.add(dsPath+".slave_ids", "slave ID %d is also routed to %s, share it with address_ranges or allow_function_codes", id, other)
+				continue
+			}
+			routed[id] = dsPath
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func init() {
+	register(Command{Name: "write", Summary: "Write coils or holding registers of a device", Run: runWrite})
+}
+
+func runWrite(args []string, stdout io.Writer) error {
+	var t target
+	fs := flag.NewFlagSet("write", flag.ContinueOnError)
+	t.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: modbus-gateway write -tcp host:port | -rtu-over-tcp host:port | -udp host:port | -rtu device [flags] value...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no values to write")
+	}
+
+	tg, err := t.tag()
+	if err != nil {
+		return err
+	}
+	req, err := writeRequest(tg, t.fc, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	ds, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	if _, err := send(ctx, ds, t.timeout, tg.SlaveID, req); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Written %d values to slave %d, %s %d\n", fs.NArg(), tg.SlaveID, tg.Table, tg.Address)
+	return nil
+}
+
+// writeRequest encodes the values as the tag's type. Single values use FC5 or FC6
+// unless -fc asks for FC15 or FC16.
+func writeRequest(t tag.Tag, fc uint, args []string) (pdu.Request, error) {
+	switch t.Table {
+	case tag.TableCoils:
+		values := make([]bool, len(args))
+		for i, arg := range args {
+			v, err := parseBool(arg)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		if len(values) == 1 && fc != modbus.FuncCodeWriteMultipleCoils {
+			return pdu.WriteSingleCoilRequest{Address: t.Address, Value: values[0]}, nil
+		}
+		if len(values) > pdu.MaxWriteBits {
+			return nil, fmt.Errorf("at most %d coils fit a request", pdu.MaxWriteBits)
+		}
+		return pdu.WriteMultipleCoilsRequest{Address: t.Address, Values: values}, nil
+
+	case tag.TableHoldingRegisters:
+		var data []byte
+		for _, arg := range args {
+			b, err := t.Encode(parseValue(t, arg))
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, b...)
+		}
+		regs := pdu.DecodeRegisters(data)
+		if len(regs) == 1 && fc != modbus.FuncCodeWriteMultipleRegisters {
+			return pdu.WriteSingleRegisterRequest{Address: t.Address, Value: regs[0]}, nil
+		}
+		if len(regs) > pdu.MaxWriteRegisters {
+			return nil, fmt.Errorf("%d registers exceed the %d that fit a request", len(regs), pdu.MaxWriteRegisters)
+		}
+		return pdu.WriteMultipleRegistersRequest{Address: t.Address, Values: regs}, nil
+
+	default:
+		return nil, fmt.Errorf("%s table is read-only", t.Table)
+	}
+}
+
+// parseValue converts a command line argument to what Tag.Encode expects,
+// keeping 64-bit integers exact.
+func parseValue(t tag.Tag, s string) any {
+	if t.Type == tag.TypeString {
+		return s
+	}
+	if t.Type == tag.TypeUint64 {
+		if u, err := strconv.ParseUint(s, 0, 64); err == nil {
+			return u
+		}
+	}
+	if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "on", "true":
+		return true, nil
+	case "0", "off", "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid coil value %q, use 1/0, on/off or true/false", s)
+	}
+}
+
+// send issues a request with the response timeout and turns exception responses into errors.
+func send(ctx context.Context, ds transport.Downstream, timeout time.Duration, slaveID byte, req pdu.Request) (modbus.ProtocolDataUnit, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	p := req.PDU()
+	resp, err := ds.Send(ctx, slaveID, p)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	if err := pdu.CheckResponse(p.FunctionCode, resp); err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// source is a configuration file read, with the settings it holds itself.
+type source struct {
+	file     string
+	settings map[string]any
+}
+
+// confFiles returns the YAML files of a conf.d directory, sorted by name. A missing
+// directory has none.
+func confFiles(dir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// merge merges the files of the conf.d directory dir into v, which read the sources
+// so far, in the order of their names. Their gateways are added to the others, other
+// settings override those read before. A gateway name may only be used in one file.
+func merge(v *viper.Viper, file, dir string, sources []source) (*viper.Viper, string, []source, error) {
+	files, err := confFiles(dir)
+	if err != nil {
+		return nil, file, nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	if len(sources) == 0 && len(files) == 0 {
+		return nil, file, nil, fmt.Errorf("failed to read config: no YAML files in %s: %w", dir, fs.ErrNotExist)
+	}
+	if len(files) == 0 {
+		return v, file, sources, nil
+	}
+
+	var gateways []any
+	defined := make(map[string]string) // File defining each gateway
+	add := func(src source) error {
+		list, _ := src.settings["gateways"].([]any)
+		for _, gw := range list {
+			m, _ := toMap(gw)
+			name, ok := m["name"].(string)
+			if !ok {
+				continue
+			}
+			if other, ok := defined[name]; ok && other != src.file {
+				return fmt.Errorf("gateway %q is defined in both %s and %s", name, other, src.file)
+			}
+			defined[name] = src.file
+		}
+		gateways = append(gateways, list...)
+		return nil
+	}
+	for _, src := range sources {
+		if err := add(src); err != nil {
+			return nil, file, nil, err
+		}
+	}
+	for _, f := range files {
+		fv := viper.New()
+		fv.SetConfigFile(f)
+		if err := fv.ReadInConfig(); err != nil {
+			return nil, file, nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		src := source{file: f, settings: fv.AllSettings()}
+		if err := add(src); err != nil {
+			return nil, file, nil, err
+		}
+		rest := maps.Clone(src.settings)
+		delete(rest, "gateways")
+		if err := v.MergeConfigMap(rest); err != nil {
+			return nil, file, nil, fmt.Errorf("failed to merge %s: %w", f, err)
+		}
+		sources = append(sources, src)
+	}
+	if err := v.MergeConfigMap(map[string]any{"gateways": gateways}); err != nil {
+		return nil, file, nil, fmt.Errorf("failed to merge %s: %w", dir, err)
+	}
+	return v, file, sources, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_ConfD(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gateway := func(name string) string {
+		return "gateways:\n  - name: \"" + name + "\"\n    downstreams:\n      - type: \"tcp\"\n        tcp:\n          address: \"10.0.0.1:502\"\n"
+	}
+	write("config.yaml", gateway("meter")+"log:\n  level: \"debug\"\n")
+	write("conf.d/20-solar.yaml", gateway("solar"))
+	write("conf.d/10-heatpump.yml", gateway("heatpump")+"log:\n  file: \"/var/log/modbusgw.log\"\n")
+	write("conf.d/README", "not a config")
+
+	cfg, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+	var names []string
+	for _, gw := range cfg.Gateways {
+		names = append(names, gw.Name)
+	}
+	if got := strings.Join(names, ","); got != "meter,heatpump,solar" {
+		t.Errorf("gateways = %s, want the main file's, then conf.d's by file name", got)
+	}
+	if cfg.Log.Level != "debug" || cfg.Log.File != "/var/log/modbusgw.log" {
+		t.Errorf("log = %+v, want settings merged", cfg.Log)
+	}
+
+	// The directory alone
+	cfg, err = LoadConfig(filepath.Join(dir, "conf.d"))
+	if err != nil || len(cfg.Gateways) != 2 {
+		t.Errorf("LoadConfig() of conf.d = %v, %v", cfg, err)
+	}
+
+	// Unknown keys name their file
+	write("conf.d/20-solar.yaml", gateway("solar")+"    downstream: {}\n")
+	_, err = LoadConfig(filepath.Join(dir, "config.yaml"))
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) || len(unknown.Keys) != 1 || unknown.Keys[0].File != filepath.Join(dir, "conf.d/20-solar.yaml") || unknown.Keys[0].Path != "gateways[0].downstream" {
+		t.Errorf("LoadConfig() error = %v, want downstream unknown in 20-solar.yaml", err)
+	}
+
+	write("conf.d/20-solar.yaml", gateway("heatpump"))
+	if _, err := LoadConfig(filepath.Join(dir, "config.yaml")); err == nil || !strings.Contains(err.Error(), `gateway "heatpump" is defined in both`) {
+		t.Errorf("LoadConfig() with a gateway in two files error = %v", err)
+	}
+}
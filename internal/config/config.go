@@ -6,6 +6,8 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -16,12 +18,57 @@ import (
 type Config struct {
 	Gateways []GatewayConfig `mapstructure:"gateways"`
 	Log      LogConfig       `mapstructure:"log"`
+	API      APIConfig       `mapstructure:"api"`
+	Audit    AuditConfig     `mapstructure:"audit"`
+	Tracing  TracingConfig   `mapstructure:"tracing"`
+
+	// Names and values that ${NAME} in other values expands to, besides environment
+	// variables: a YAML, JSON or .env file, or a directory of files, one per secret
+	SecretsFile string `mapstructure:"secrets_file"`
+
+	Legacy bool `mapstructure:"-"` // Translated from a flat LegacyConfig, which is deprecated
+}
+
+// AuditConfig defines the trail of writes forwarded through the gateways
+type AuditConfig struct {
+	File string `mapstructure:"file"` // Append-only, hash-chained JSON lines, empty disables the trail
+}
+
+// TracingConfig defines the export of the spans of requests to OpenTelemetry
+type TracingConfig struct {
+	Endpoint    string            `mapstructure:"endpoint"`     // OTLP/HTTP collector, e.g. "http://otel-collector:4318", empty disables tracing
+	Headers     map[string]string `mapstructure:"headers"`      // Added to every export, e.g. Authorization
+	ServiceName string            `mapstructure:"service_name"` // service.name of the spans, default "modbus-gateway"
+	SampleRate  float64           `mapstructure:"sample_rate"`  // Fraction of the requests traced, default 1
+	Interval    time.Duration     `mapstructure:"interval"`     // Export interval, default 5s
+	Timeout     time.Duration     `mapstructure:"timeout"`      // Time an export may take, default 10s
+	BufferSize  int               `mapstructure:"buffer_size"`  // Spans kept until exported, default 10000
+}
+
+// APIConfig defines the HTTP management API
+type APIConfig struct {
+	Address string `mapstructure:"address"` // e.g. "127.0.0.1:8080", empty disables the API
+	Writes  bool   `mapstructure:"writes"`  // Accept writes of named points at /api/tags/{gateway}/{name}
+
+	// Serve a live traffic dashboard at /, which shows the values read and written
+	Dashboard    bool `mapstructure:"dashboard"`
+	Transactions int  `mapstructure:"transactions"` // Last transactions kept per gateway for the dashboard, default 100
 }
 
 // LogConfig defines logging configuration
 type LogConfig struct {
-	Level string `mapstructure:"level"` // debug, info, warn, error
-	File  string `mapstructure:"file"`  // Log file path
+	Level  string `mapstructure:"level"`  // debug, info, warn, error
+	File   string `mapstructure:"file"`   // Log file path, empty or "-" for stdout
+	Format string `mapstructure:"format"` // "text" (default) or "json"
+	Stdout bool   `mapstructure:"stdout"` // Log to stdout as well as to File, e.g. for journald
+
+	// File rotation: after MaxSize megabytes or MaxAge, the file is renamed with the
+	// time appended, and compressed if Compress is set. MaxBackups rotated files are
+	// kept, 0 keeps all
+	MaxSize    int           `mapstructure:"max_size"`
+	MaxAge     time.Duration `mapstructure:"max_age"`
+	MaxBackups int           `mapstructure:"max_backups"`
+	Compress   bool          `mapstructure:"compress"`
 }
 
 // GatewayConfig defines a single gateway instance
@@ -29,51 +76,514 @@ type GatewayConfig struct {
 	Name        string             `mapstructure:"name"`
 	Upstreams   []UpstreamConfig   `mapstructure:"upstreams"`
 	Downstreams []DownstreamConfig `mapstructure:"downstreams"`
+	Tags        []TagConfig        `mapstructure:"tags"`      // Named data points used by connectors
+	Registers   []TagConfig        `mapstructure:"registers"` // Register map of named points, along with the tags
+	Cloud       CloudConfig        `mapstructure:"cloud"`     // Optional cloud IoT connector
+	MQTT        MQTTConfig         `mapstructure:"mqtt"`      // Optional publishing of tag values to an MQTT broker
+	Influx      InfluxConfig       `mapstructure:"influx"`    // Optional export of tag values to a historian
+	Alarms      AlarmConfig        `mapstructure:"alarms"`
+	SunSpec     []SunSpecConfig    `mapstructure:"sunspec"` // Devices scanned for SunSpec models to generate tags
+	LoadGen     LoadGenConfig      `mapstructure:"loadgen"` // Synthetic traffic against the gateway's own routes
+	DeviceID    DeviceIDConfig     `mapstructure:"device_identification"`
+	WriteACL    []WriteRuleConfig  `mapstructure:"write_acl"` // Writes allowed to network masters, empty allows all
+	Log         GatewayLogConfig   `mapstructure:"log"`
+	Capture     CaptureConfig      `mapstructure:"capture"` // Optional recording of all frames for offline analysis
+}
+
+// GatewayLogConfig defines the logging of one gateway
+type GatewayLogConfig struct {
+	Level       string `mapstructure:"level"`        // Overrides the global log level for this gateway
+	TraceFrames bool   `mapstructure:"trace_frames"` // Log every upstream and downstream ADU in hex with the ID of its request
+}
+
+// CaptureConfig defines the recording of the frames of one gateway, upstream and
+// downstream, to a file rotated by size
+type CaptureConfig struct {
+	File       string `mapstructure:"file"`        // e.g. "plant.pcapng", empty disables capturing
+	Format     string `mapstructure:"format"`      // "pcapng" for Wireshark or "jsonl", by default after the extension of File
+	Enabled    bool   `mapstructure:"enabled"`     // Capture from the start, rather than once enabled through the API
+	MaxSize    int    `mapstructure:"max_size"`    // Megabytes after which the file is rotated, default 100
+	MaxBackups int    `mapstructure:"max_backups"` // Rotated files kept, 0 keeps all
+}
+
+// WriteRuleConfig allows writes from some masters to some slaves and addresses
+type WriteRuleConfig struct {
+	Clients    []string `mapstructure:"clients"`    // Networks or addresses of masters, e.g. ["10.1.0.0/16"], empty matches all
+	Identities []string `mapstructure:"identities"` // Names of masters authenticated by TLS client certificates, empty matches all
+	SlaveIDs   string   `mapstructure:"slave_ids"`  // e.g. "1-10", empty matches all
+	Addresses  string   `mapstructure:"addresses"`  // Protocol addresses written, e.g. "0-99,200", empty matches all
+}
+
+// DeviceIDConfig defines the cache of Read Device Identification (0x2B/0x0E) responses
+type DeviceIDConfig struct {
+	Cache bool          `mapstructure:"cache"` // Answer repeated queries from the gateway and collect an asset inventory
+	TTL   time.Duration `mapstructure:"ttl"`   // How long a response is served from the cache, 0 keeps it until restart
+}
+
+// TagConfig defines a named data point on a slave device
+type TagConfig struct {
+	Name    string `mapstructure:"name"`
+	SlaveID byte   `mapstructure:"slave_id"`
+	Table   string `mapstructure:"table"`   // "coil", "discrete_input", "holding_register" (default), "input_register"
+	Address string `mapstructure:"address"` // Protocol address, or a Modicon reference like "40001" when Table is empty
+
+	// Register decoding, ignored for coils and discrete inputs
+	Type      string  `mapstructure:"type"`       // "uint16" (default), "int16", "uint32", "int32", "uint64", "int64", "float32", "float64", "string"
+	ByteOrder string  `mapstructure:"byte_order"` // "ABCD" (default), "CDAB", "BADC", "DCBA"
+	Length    int     `mapstructure:"length"`     // Number of registers of a string
+	Unit      string  `mapstructure:"unit"`       // Unit of the value, e.g. "W", announced to home automation
+	Scale     float64 `mapstructure:"scale"`      // Multiplier turning raw values into engineering units, e.g. 0.1
+
+	// Publish filtering, a new value is only exported when it moved outside the deadband
+	Deadband        float64       `mapstructure:"deadband"`         // Absolute change required
+	DeadbandPercent float64       `mapstructure:"deadband_percent"` // Change required relative to the last published value
+	MinInterval     time.Duration `mapstructure:"min_interval"`     // Minimum time between two publishes
+}
+
+// MQTTConfig defines the publishing of tag values to an MQTT broker, such as the one
+// of a home automation system. Values are published as JSON when polled outside their
+// deadband, and right after a write through the gateway changed them.
+type MQTTConfig struct {
+	Broker   string        `mapstructure:"broker"`    // e.g. "tcp://homeassistant.local:1883", empty disables publishing
+	ClientID string        `mapstructure:"client_id"` // Default "modbus-gateway-" and the gateway name
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	Topic    string        `mapstructure:"topic"`    // Topic of a tag, "{gateway}" and "{tag}" are replaced, default "modbus-gateway/{gateway}/{tag}"
+	QoS      byte          `mapstructure:"qos"`      // 0, 1 or 2, default 0
+	Retain   bool          `mapstructure:"retain"`   // Brokers keep the last value for new subscribers
+	Interval time.Duration `mapstructure:"interval"` // Tag polling interval, default 10s
+
+	// Announce the tags to Home Assistant by MQTT discovery, as sensors of one device
+	HomeAssistant   bool   `mapstructure:"home_assistant"`
+	DiscoveryPrefix string `mapstructure:"discovery_prefix"` // Default "homeassistant"
+}
+
+// InfluxConfig defines the export of tag values in line protocol, to InfluxDB or any
+// other sink accepting it over HTTP or UDP. A point is written per tag, tagged with
+// the gateway, slave ID and tag name, when it moved outside the deadband.
+type InfluxConfig struct {
+	URL         string            `mapstructure:"url"`         // e.g. "http://influxdb:8086" or "udp://telegraf:8089", empty disables the export
+	Bucket      string            `mapstructure:"bucket"`      // InfluxDB 2 bucket, written with org and token
+	Org         string            `mapstructure:"org"`         // InfluxDB 2 organization
+	Token       string            `mapstructure:"token"`       // InfluxDB 2 API token
+	Database    string            `mapstructure:"database"`    // InfluxDB 1 database, written with username and password
+	Username    string            `mapstructure:"username"`    // InfluxDB 1 user
+	Password    string            `mapstructure:"password"`    // InfluxDB 1 password
+	Measurement string            `mapstructure:"measurement"` // Measurement of the points, "{gateway}" and "{tag}" are replaced, default "modbus"
+	Tags        map[string]string `mapstructure:"tags"`        // Tags added to every point, e.g. site: "plant1"
+	Interval    time.Duration     `mapstructure:"interval"`    // Tag polling interval, default 10s
+	Timeout     time.Duration     `mapstructure:"timeout"`     // Time a write may take, default 5s
+	BufferSize  int               `mapstructure:"buffer_size"` // Points kept while the sink is unreachable, default 10000
+}
+
+// CloudConfig defines the connection to a cloud IoT platform
+type CloudConfig struct {
+	Provider        string        `mapstructure:"provider"`          // "aws" or "azure", empty disables the connector
+	Endpoint        string        `mapstructure:"endpoint"`          // e.g. "xxx-ats.iot.eu-west-1.amazonaws.com" or "myhub.azure-devices.net"
+	DeviceID        string        `mapstructure:"device_id"`         // AWS thing name or Azure device ID
+	CertFile        string        `mapstructure:"cert_file"`         // X.509 client certificate
+	KeyFile         string        `mapstructure:"key_file"`          // X.509 client key
+	CAFile          string        `mapstructure:"ca_file"`           // Optional root CA bundle
+	SharedAccessKey string        `mapstructure:"shared_access_key"` // Azure symmetric key (instead of X.509)
+	Interval        time.Duration `mapstructure:"interval"`          // Tag publish interval
+	BufferSize      int           `mapstructure:"buffer_size"`       // Messages kept while offline
 }
 
 // UpstreamConfig defines a master connecting to the gateway
 type UpstreamConfig struct {
-	Type   string       `mapstructure:"type"`   // "tcp" or "rtu"
-	Tcp    TcpConfig    `mapstructure:"tcp"`    // Used if Type is "tcp"
+	Type   string       `mapstructure:"type"`   // "tcp", "rtu", "rtu-over-tcp", "udp" or a registered custom type
+	Tcp    TcpConfig    `mapstructure:"tcp"`    // Used if Type is "tcp", "rtu-over-tcp" or "udp"
 	Serial SerialConfig `mapstructure:"serial"` // Used if Type is "rtu"
+	TLS    TLSConfig    `mapstructure:"tls"`    // Optional for "tcp" and "rtu-over-tcp"
+
+	// Clients accepted by "tcp", "rtu-over-tcp" and "udp", e.g. ["10.1.0.0/16", "192.168.5.7"], empty accepts all
+	AllowedClients []string `mapstructure:"allowed_clients"`
+	// Clients rejected even if allowed, e.g. a host inside an allowed subnet
+	DeniedClients []string `mapstructure:"denied_clients"`
+	// Function codes the masters may use, e.g. "1-4" for reads only, empty allows all
+	FunctionCodes string `mapstructure:"function_codes"`
+	// Times the upstream serves requests at all, and writes, empty allows all times
+	AccessWindows []WindowConfig `mapstructure:"access_windows"`
+	WriteWindows  []WindowConfig `mapstructure:"write_windows"`
+	// Writes per second of each client, beyond which the gateway answers Server Busy, 0 is unlimited
+	WriteRate  float64 `mapstructure:"write_rate"`
+	WriteBurst int     `mapstructure:"write_burst"` // Writes allowed at once, default one second worth
+	// Refuse everything but reads, for an upstream facing a less trusted network
+	ReadOnly bool `mapstructure:"read_only"`
+	// Values read back as zero through this upstream
+	Scrub []ScrubConfig `mapstructure:"scrub"`
+	// Connections to "tcp" and "rtu-over-tcp" served at once, others are closed on accept, 0 is unlimited
+	MaxConnections int `mapstructure:"max_connections"`
+	// Close connections to "tcp" and "rtu-over-tcp" without a request for this long, 0 never
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	// Serve the requests of all masters of "rtu-over-tcp" one at a time, in arrival order
+	Serialize bool `mapstructure:"serialize"`
+}
+
+// ScrubConfig defines values hidden from the masters of an upstream
+type ScrubConfig struct {
+	SlaveIDs  string `mapstructure:"slave_ids"` // e.g. "1,5-10", empty means all
+	Table     string `mapstructure:"table"`     // "coil", "discrete_input", "holding_register" or "input_register", empty means all
+	Addresses string `mapstructure:"addresses"` // e.g. "100-199"
+}
+
+// TLSConfig defines TLS on a TCP upstream, with masters authenticated by client certificates
+type TLSConfig struct {
+	CertFile     string           `mapstructure:"cert_file"`      // Server certificate, empty disables TLS
+	KeyFile      string           `mapstructure:"key_file"`       // Server key
+	ClientCAFile string           `mapstructure:"client_ca_file"` // CA bundle verifying client certificates, required if set
+	Identities   []IdentityConfig `mapstructure:"identities"`     // Names of client certificates, empty names them by common name
+
+	// Refuse to start unless masters are authenticated, as Modbus/TCP Security requires
+	RequireClientCert bool `mapstructure:"require_client_cert"`
+}
+
+// DialTLSConfig defines TLS on the connections of a TCP downstream, for devices and
+// cloud endpoints that require it
+type DialTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`              // Dial with TLS, implied by the other settings
+	ServerName         string `mapstructure:"server_name"`          // Name the server certificate is verified against, default the host of the address
+	CAFile             string `mapstructure:"ca_file"`              // CA bundle verifying the server certificate, default the system roots
+	CertFile           string `mapstructure:"cert_file"`            // Client certificate, for servers authenticating the gateway
+	KeyFile            string `mapstructure:"key_file"`             // Client key
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Accept any server certificate, for testing only
+}
+
+// IdentityConfig names the masters presenting a matching client certificate
+type IdentityConfig struct {
+	Name       string `mapstructure:"name"`        // e.g. "scada-primary", referenced by write_acl
+	CommonName string `mapstructure:"common_name"` // Subject CN to match
+	SAN        string `mapstructure:"san"`         // DNS name, email, IP or URI subject alternative name to match
+}
+
+// WindowConfig defines a recurring period of the week in local time, e.g. a maintenance window
+type WindowConfig struct {
+	Days string `mapstructure:"days"` // e.g. "mon-fri,sun", empty means every day
+	From string `mapstructure:"from"` // "HH:MM", empty is midnight
+	To   string `mapstructure:"to"`   // "HH:MM", before From runs past midnight, empty is midnight
 }
 
 // DownstreamConfig defines the slave the gateway connects to
 type DownstreamConfig struct {
-	Name     string       `mapstructure:"name"`      // Optional name for logging
-	Type     string       `mapstructure:"type"`      // "tcp", "rtu", or "local"
-	SlaveIDs string       `mapstructure:"slave_ids"` // Routing rules: "1", "1,2", "1-10"
-	Tcp      TcpConfig    `mapstructure:"tcp"`       // Used if Type is "tcp"
-	Serial   SerialConfig `mapstructure:"serial"`    // Used if Type is "rtu"
-	Local    LocalConfig  `mapstructure:"local"`     // Used if Type is "local"
+	Name     string         `mapstructure:"name"`      // Optional name for logging
+	Type     string         `mapstructure:"type"`      // "tcp", "rtu", "rtu-over-tcp", "udp", "local", "replay", "load_balance" or a registered custom type
+	SlaveIDs string         `mapstructure:"slave_ids"` // Routing rules: "1", "1,2", "1-10"
+	Tcp      TcpConfig      `mapstructure:"tcp"`       // Used if Type is "tcp", "rtu-over-tcp" or "udp"
+	TLS      DialTLSConfig  `mapstructure:"tls"`       // Optional for "tcp" and "rtu-over-tcp"
+	Serial   SerialConfig   `mapstructure:"serial"`    // Used if Type is "rtu"
+	Local    LocalConfig    `mapstructure:"local"`     // Used if Type is "local"
+	Replay   ReplayConfig   `mapstructure:"replay"`    // Used if Type is "replay"
+	Script   string         `mapstructure:"script"`    // Optional Lua file with on_request/on_response hooks
+	Record   string         `mapstructure:"record"`    // Optional file the responses of this downstream are recorded to, for later replay
+	Chaos    ChaosConfig    `mapstructure:"chaos"`     // Optional fault injection, for testing
+	Discover DiscoverConfig `mapstructure:"discover"`  // Optional route discovery at runtime
+	Breaker  BreakerConfig  `mapstructure:"breaker"`   // Optional circuit breaker, failing requests fast while the downstream is down
+	Required bool           `mapstructure:"required"`  // The gateway reports unready while the breaker is open, enables a breaker
+	Probe    ProbeConfig    `mapstructure:"probe"`     // Optional periodic read checking the downstream answers, for readiness
+	Queue    QueueConfig    `mapstructure:"queue"`     // Optional bound on the requests waiting for the downstream
+	Cache    CacheConfig    `mapstructure:"cache"`     // Optional cache of read responses
+	Mirror   MirrorConfig   `mapstructure:"mirror"`    // Optional blocks polled in the background, answering reads of them
+
+	// Downstreams taking over the slaves of this one while it fails, in order of
+	// preference. They share its slave ID map and address offsets, their own
+	// slave_ids are ignored
+	Backups  []DownstreamConfig `mapstructure:"backups"`
+	Failover FailoverConfig     `mapstructure:"failover"` // When to switch to a backup and back
+
+	// Used if Type is "load_balance", members answering for the slaves of this downstream
+	Balance BalanceConfig `mapstructure:"load_balance"`
+
+	// Time an attempt at a request may take, default 2s. Attempts failing by timeout,
+	// connection or frame errors are retried, reads only unless RetryWrites is set
+	Timeout      time.Duration `mapstructure:"timeout"`
+	Retries      int           `mapstructure:"retries"`       // Attempts after the first, default 0
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"` // Wait before the first retry, doubling for each next one, default 100ms
+	RetryWrites  bool          `mapstructure:"retry_writes"`  // Retry writes too, for devices where repeating one is harmless
+
+	// Slave IDs masters address mapped to the unit IDs of the devices, e.g. "10:1, 11:2",
+	// routed to this downstream in addition to SlaveIDs
+	SlaveIDMap string `mapstructure:"slave_id_map"`
+
+	// Addresses of its slaves this downstream serves, so downstreams can share slave IDs,
+	// e.g. devices merged behind one unit ID. Empty serves the addresses no other claims
+	AddressRanges []AddressRangeConfig `mapstructure:"address_ranges"`
+
+	// Function codes this downstream serves, e.g. "5,6,15,16" to take the writes of its
+	// slaves while another downstream of the same slave IDs serves the reads. Empty
+	// allows all, the others are answered with Illegal Function unless another serves them
+	AllowFunctionCodes string `mapstructure:"allow_function_codes"`
+	DenyFunctionCodes  string `mapstructure:"deny_function_codes"` // Function codes this downstream doesn't serve, e.g. "5,6,15,16"
+
+	// Added to the addresses of requests forwarded to this downstream, and taken off
+	// those write responses echo, e.g. -1000 for a device whose map is shifted by 1000.
+	// AddressOffsets overrides it by table: coil, discrete_input, holding_register or
+	// input_register. Backups share the offsets of their primary
+	AddressOffset  int            `mapstructure:"address_offset"`
+	AddressOffsets map[string]int `mapstructure:"address_offsets"`
+
+	// Register values are exchanged with the device with the registers of each pair
+	// swapped, for devices storing 32-bit values low word first, and with the bytes
+	// of each register swapped, for little-endian registers
+	WordSwap bool `mapstructure:"word_swap"`
+	ByteSwap bool `mapstructure:"byte_swap"`
+}
+
+// AddressRangeConfig is a range of a table routed to a downstream
+type AddressRangeConfig struct {
+	Table     string `mapstructure:"table"`     // coil, discrete_input, holding_register or input_register, empty for all four
+	Addresses string `mapstructure:"addresses"` // Protocol addresses the master sends, e.g. "100-199"
+	Offset    int    `mapstructure:"offset"`    // Added to the addresses forwarded, e.g. -100 to read 100-199 from 0-99 of the device
+}
+
+// BalanceConfig spreads reads across identical downstreams, such as redundant data
+// concentrators. Members failing consecutively are taken out of rotation for a
+// cooldown. Requests other than reads are refused, as they would reach one member only.
+type BalanceConfig struct {
+	Members  []DownstreamConfig `mapstructure:"members"`
+	Strategy string             `mapstructure:"strategy"` // "round_robin" (default) or "least_busy", the member with the fewest requests in flight
+	Failures int                `mapstructure:"failures"` // Consecutive timeouts or connection failures taking a member out of rotation, default 3
+	Cooldown time.Duration      `mapstructure:"cooldown"` // Time out of rotation before a request tries the member again, default 10s
+}
+
+// FailoverConfig defines when a downstream with backups fails over. Requests go to
+// the next downstream after consecutive timeouts or connection failures; while a
+// backup serves, the primary is probed with a read and takes over again once it answers.
+type FailoverConfig struct {
+	Failures int           `mapstructure:"failures"` // Consecutive failures switching to the next downstream, default 3
+	Interval time.Duration `mapstructure:"interval"` // Between probes of the primary while failed over, default 5s
+	SlaveID  byte          `mapstructure:"slave_id"` // Slave probed, default the lowest of slave_ids
+	Function byte          `mapstructure:"function"` // Read function code of probes, 1 to 4, default 3
+	Address  uint16        `mapstructure:"address"`  // Coil or register read by probes
+}
+
+// BreakerConfig defines a circuit breaker. It opens after consecutive timeouts or
+// connection failures, then lets one request probe the downstream per cooldown.
+type BreakerConfig struct {
+	Failures int           `mapstructure:"failures"` // Consecutive failures opening the breaker, 0 disables it unless required, then 5
+	Cooldown time.Duration `mapstructure:"cooldown"` // Time open before a request probes the downstream, default 10s
+}
+
+// QueueConfig bounds the requests waiting for a downstream. Requests finding the
+// queue full are answered with Server Device Busy.
+type QueueConfig struct {
+	Depth       int `mapstructure:"depth"`       // Requests waiting beyond those in flight, 0 disables the queue
+	Concurrency int `mapstructure:"concurrency"` // Requests sent to the downstream at once, default 1
+}
+
+// CacheConfig caches the responses to reads of coils, discrete inputs and registers.
+type CacheConfig struct {
+	TTL time.Duration `mapstructure:"ttl"` // Time a response answers identical reads, 0 disables the cache
+}
+
+// MirrorConfig polls blocks of a downstream in the background into a copy in the
+// gateway, which answers reads within a block while its last poll is recent.
+// Writes and other requests still reach the device.
+type MirrorConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // Between polls of a block, default 1s
+	MaxAge   time.Duration `mapstructure:"max_age"`  // Age of a poll beyond which reads go to the device, default 3 intervals
+	Blocks   []BlockConfig `mapstructure:"blocks"`   // Empty disables mirroring
+
+	// Writes the device confirms update the copy, which keeps answering reads,
+	// instead of sending reads to the device until the next poll
+	WriteThrough bool `mapstructure:"write_through"`
+}
+
+// BlockConfig is a range of a table of a slave, read with one request.
+type BlockConfig struct {
+	SlaveID  byte   `mapstructure:"slave_id"`
+	Table    string `mapstructure:"table"` // coil, discrete_input, holding_register or input_register
+	Address  uint16 `mapstructure:"address"`
+	Quantity uint16 `mapstructure:"quantity"`
+}
+
+// DiscoverConfig defines the slaves probed on a downstream once it is connected.
+// Those answering are routed to the downstream, in addition to its slave_ids.
+type DiscoverConfig struct {
+	SlaveIDs string        `mapstructure:"slave_ids"` // e.g. "1-247", empty disables discovery
+	Timeout  time.Duration `mapstructure:"timeout"`   // Wait per probed slave, default 500ms
+}
+
+// ChaosConfig injects faults into a downstream, to exercise master retry logic and
+// the gateway's error paths. Rates are probabilities between 0 and 1 per request.
+type ChaosConfig struct {
+	Latency        time.Duration `mapstructure:"latency"`         // Delay added to every request
+	Jitter         time.Duration `mapstructure:"jitter"`          // Random extra delay, up to this value
+	DropRate       float64       `mapstructure:"drop_rate"`       // Requests that are never answered
+	CorruptRate    float64       `mapstructure:"corrupt_rate"`    // Responses discarded as if their CRC was wrong
+	DisconnectRate float64       `mapstructure:"disconnect_rate"` // Requests that close the downstream connection
+	Timeout        time.Duration `mapstructure:"timeout"`         // How long a dropped request waits at most, default 1s
+	Seed           int64         `mapstructure:"seed"`            // Random seed for reproducible runs, 0 picks one
+}
+
+// Enabled reports whether any fault is configured.
+func (c ChaosConfig) Enabled() bool {
+	return c.Latency > 0 || c.Jitter > 0 || c.DropRate > 0 || c.CorruptRate > 0 || c.DisconnectRate > 0
+}
+
+// ReplayConfig defines a downstream answering from a recording
+type ReplayConfig struct {
+	File string `mapstructure:"file"` // Recording written by a downstream's "record" option
 }
 
 // LocalConfig defines settings for local modbus slave device
 type LocalConfig struct {
 	Device      string            `mapstructure:"device"`
+	Profile     string            `mapstructure:"profile"` // Simulated device, "energy_meter", "inverter" or a YAML file, under the settings below
 	Persistence PersistenceConfig `mapstructure:"persistence"`
+	ServerID    ServerIDConfig    `mapstructure:"server_id"` // Answer to Report Server ID (0x11)
+
+	// Answer to Read Device Identification (0x2B/0x0E)
+	DeviceInfo DeviceInfoConfig `mapstructure:"device_info"`
+
+	// Queues read with Read FIFO Queue (0x18), filled by writing holding registers
+	// to their pointer address
+	FIFOQueues []FIFOQueueConfig `mapstructure:"fifo_queues"`
+
+	// Addresses served by table, e.g. holding_register: "0-99, 1000-1019", the others
+	// answered with Illegal Data Address like a real device. Tables: coil,
+	// discrete_input, holding_register or input_register; those not listed serve all.
+	// FIFO pointer addresses are always served
+	ValidAddresses map[string]string `mapstructure:"valid_addresses"`
+
+	// Values the slave starts with, such as model numbers and scaling registers,
+	// written at each start over those persisted. The file, CSV or YAML, adds more
+	InitialValues     []InitialValueConfig `mapstructure:"initial_values"`
+	InitialValuesFile string               `mapstructure:"initial_values_file"`
+
+	// Values computed by Lua expressions each time they are read, to simulate a
+	// dynamic device, e.g. "math.floor(sin(t) * 1000)" or "hr(1) * 10"
+	Expressions []ExpressionConfig `mapstructure:"expressions"`
+
+	// Slaves with their own data model, by unit ID, to simulate a whole bus. A unit
+	// has its own settings like those above, none are shared; the slave IDs routed to
+	// the downstream without a unit share the data model of the settings above
+	Units []LocalUnitConfig `mapstructure:"units"`
+}
+
+// LocalUnitConfig is a slave of a local downstream with its own data model
+type LocalUnitConfig struct {
+	SlaveID     byte `mapstructure:"slave_id"`
+	LocalConfig `mapstructure:",squash"`
+}
+
+// ExpressionConfig computes a value of a table of a local slave
+type ExpressionConfig struct {
+	Table   string `mapstructure:"table"`   // coil, discrete_input, holding_register or input_register
+	Address uint16 `mapstructure:"address"` // Of the value computed
+	Expr    string `mapstructure:"expr"`    // Lua expression, see package expr
+}
+
+// InitialValueConfig presets consecutive values of a table of a local slave
+type InitialValueConfig struct {
+	Table   string   `mapstructure:"table"`   // coil, discrete_input, holding_register or input_register
+	Address uint16   `mapstructure:"address"` // Of the first value
+	Values  []uint16 `mapstructure:"values"`  // Registers, or 0 and 1 for bits
+}
+
+// FIFOQueueConfig defines a FIFO queue of a local slave, holding up to 31 registers
+type FIFOQueueConfig struct {
+	Address     uint16 `mapstructure:"address"`       // FIFO pointer address
+	ClearOnRead bool   `mapstructure:"clear_on_read"` // Empty the queue once read, instead of keeping the last 31 values
+}
+
+// DeviceInfoConfig defines the basic objects a local slave reports with Read
+// Device Identification. Empty ones report the defaults of the gateway.
+type DeviceInfoConfig struct {
+	VendorName  string `mapstructure:"vendor_name"`  // Default "modbus-gateway"
+	ProductCode string `mapstructure:"product_code"` // Default "local-slave"
+	Revision    string `mapstructure:"revision"`     // Major and minor revision, default "1.0"
+}
+
+// ServerIDConfig defines the answer of a local slave to Report Server ID
+type ServerIDConfig struct {
+	ID         string `mapstructure:"id"`         // Device specific server ID as hex, e.g. "0A01", default "01"
+	Stopped    bool   `mapstructure:"stopped"`    // Report the run indicator OFF instead of ON
+	Additional string `mapstructure:"additional"` // Additional data as text, e.g. a product name
 }
 
 // PersistenceConfig defines data storage settings
 type PersistenceConfig struct {
-	Type string `mapstructure:"type"` // "memory", "file", "mmap"
-	Path string `mapstructure:"path"` // File path for "file/mmap" type
+	Type string `mapstructure:"type"` // "memory", "file", a snapshot and a write-ahead log at path + ".wal", "mmap" or "bolt", a crash-safe embedded database
+	Path string `mapstructure:"path"` // File path for "file/mmap/bolt" type
+
+	// When writes are synced to storage: "always" (default) before each is answered,
+	// or queued for the background writer of "sql", "interval" every sync_interval
+	// (default 1s), coalescing bursts, or "on_shutdown" only when the gateway stops
+	// or reloads. Writes not synced yet are lost in a crash
+	SyncMode     string        `mapstructure:"sync_mode"`
+	SyncInterval time.Duration `mapstructure:"sync_interval"`
 }
 
 // TcpConfig defines TCP settings
 type TcpConfig struct {
 	Address string `mapstructure:"address"` // e.g. "0.0.0.0:502" or "192.168.1.100:502"
+
+	// Checks of the responses of a "tcp" or "udp" downstream: "strict" requires the
+	// transaction and unit ID of the request, "transaction_id" (default) only the
+	// transaction ID, "none" takes responses in order, for devices echoing wrong IDs,
+	// and is not available over UDP
+	Verify string `mapstructure:"verify"`
+
+	// Connections of a "tcp" downstream to the device, and requests sent on each before
+	// their responses arrive, both default 1. More than one in flight needs a verify level
+	// checking transaction IDs, which match responses to requests. For a "tcp" upstream,
+	// MaxInFlight bounds the pipelined requests of one master handled at once, for a
+	// "udp" upstream the requests of all masters, default 16
+	PoolSize    int           `mapstructure:"pool_size"`
+	MaxInFlight int           `mapstructure:"max_in_flight"`
+	KeepAlive   time.Duration `mapstructure:"keep_alive"` // Period of TCP keep-alive probes, 0 for the system default
+
+	// Requests of a "udp" downstream without a response this long are sent again, with
+	// the same transaction ID, until their timeout; reads only unless retry_writes is set.
+	// Default 500ms
+	RetransmitInterval time.Duration `mapstructure:"retransmit_interval"`
+
+	// An "rtu-over-tcp" downstream redials a lost connection in the background, waiting
+	// ReconnectBackoff (default 1s) and doubling the wait after each failed attempt up to
+	// MaxReconnectBackoff (default 30s), and reports connection state to its breaker
+	ReconnectBackoff    time.Duration   `mapstructure:"reconnect_backoff"`
+	MaxReconnectBackoff time.Duration   `mapstructure:"max_reconnect_backoff"`
+	Heartbeat           HeartbeatConfig `mapstructure:"heartbeat"` // Optional reads checking an idle "rtu-over-tcp" connection
+}
+
+// HeartbeatConfig defines reads sent on a connection while it is idle, to find a dead
+// device or link before a request does. A response, exceptions included, shows the
+// device alive, a timeout drops the connection.
+type HeartbeatConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // Idle time before a heartbeat, 0 disables them
+	SlaveID  byte          `mapstructure:"slave_id"` // Slave read, default the lowest of slave_ids
+	Function byte          `mapstructure:"function"` // Read function code, 1 to 4, default 3
+	Address  uint16        `mapstructure:"address"`  // Coil or register read
+}
+
+// ProbeConfig defines a read sent periodically to check a downstream answers. A
+// gateway with probed downstreams is ready once one of them answers
+type ProbeConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // Between probes, 0 disables them
+	SlaveID  byte          `mapstructure:"slave_id"` // Slave read, default the lowest of slave_ids
+	Function byte          `mapstructure:"function"` // Read function code, 1 to 4, default 3
+	Address  uint16        `mapstructure:"address"`  // Coil or register read
 }
 
 // SerialConfig defines RTU settings
 type SerialConfig struct {
-	Device    string        `mapstructure:"device"`
+	Device    string        `mapstructure:"device"` // Path, or a pattern like "/dev/serial/by-id/usb-FTDI_*" finding a renamed adapter again
 	BaudRate  int           `mapstructure:"baud_rate"`
 	DataBits  int           `mapstructure:"data_bits"`
 	Parity    string        `mapstructure:"parity"`
 	StopBits  int           `mapstructure:"stop_bits"`
 	Timeout   time.Duration `mapstructure:"timeout"`
-	RqstPause time.Duration `mapstructure:"rqst_pause"` // Pause between requests
+	RqstPause time.Duration `mapstructure:"rqst_pause"` // Bus idle time between transactions, default 100ms
+
+	// Port lifecycle of downstreams
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"` // Close the port after this long without requests, default 60s, negative never closes
+	KeepOpen    bool          `mapstructure:"keep_open"`    // Hold the port open for good, as reopening some USB adapters drops the first frame
+
+	// A downstream's port is closed once the device fails, e.g. a USB adapter unplugged,
+	// and opened again with the next request. Failed attempts hold off the next for
+	// ReopenBackoff, default 1s, doubling up to MaxReopenBackoff, default 30s
+	ReopenBackoff    time.Duration `mapstructure:"reopen_backoff"`
+	MaxReopenBackoff time.Duration `mapstructure:"max_reopen_backoff"`
 
 	// RS485 specific
 	RS485              bool          `mapstructure:"rs485"`
@@ -82,52 +592,240 @@ type SerialConfig struct {
 	RtsHighDuringSend  bool          `mapstructure:"rts_high_during_send"`
 	RtsHighAfterSend   bool          `mapstructure:"rts_high_after_send"`
 	RxDuringTx         bool          `mapstructure:"rx_during_tx"`
+	Echo               bool          `mapstructure:"echo"` // The adapter echoes what is sent, downstreams read it back before the response
+}
+
+// AlarmConfig defines threshold rules evaluated on tags
+type AlarmConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // Evaluation interval
+	Rules    []RuleConfig  `mapstructure:"rules"`
 }
 
-// LoadConfig loads configuration from file
+// RuleConfig defines a single alarm rule
+type RuleConfig struct {
+	Name      string         `mapstructure:"name"`
+	Condition string         `mapstructure:"condition"` // e.g. "temp > 80"
+	For       time.Duration  `mapstructure:"for"`       // How long the condition must hold before the alarm is raised
+	Actions   []ActionConfig `mapstructure:"actions"`
+}
+
+// ActionConfig defines what happens when an alarm is raised or cleared
+type ActionConfig struct {
+	Type       string      `mapstructure:"type"`        // "log", "webhook", "mqtt" or "write"
+	URL        string      `mapstructure:"url"`         // Used if Type is "webhook"
+	Broker     string      `mapstructure:"broker"`      // Used if Type is "mqtt", e.g. "tcp://localhost:1883"
+	Topic      string      `mapstructure:"topic"`       // Used if Type is "mqtt"
+	Tag        string      `mapstructure:"tag"`         // Used if Type is "write"
+	Value      interface{} `mapstructure:"value"`       // Written when the alarm is raised
+	ClearValue interface{} `mapstructure:"clear_value"` // Written when the alarm is cleared (optional)
+}
+
+// SunSpecConfig defines a SunSpec device whose models are turned into tags
+type SunSpecConfig struct {
+	SlaveID     byte    `mapstructure:"slave_id"`
+	BaseAddress *uint16 `mapstructure:"base_address"` // Register of the "SunS" marker, scans 40000, 0 and 50000 if unset
+	Prefix      string  `mapstructure:"prefix"`       // Prefix of generated tag names, defaults to "sunspec<slave_id>"
+}
+
+// LoadGenConfig defines synthetic traffic generated inside the gateway to validate its headroom
+type LoadGenConfig struct {
+	Rate           float64             `mapstructure:"rate"`            // Requests per second, 0 disables load generation
+	Duration       time.Duration       `mapstructure:"duration"`        // How long to generate, 0 runs until shutdown
+	Concurrency    int                 `mapstructure:"concurrency"`     // Requests in flight at most
+	ReportInterval time.Duration       `mapstructure:"report_interval"` // Interval of progress reports in the log
+	Patterns       []LoadPatternConfig `mapstructure:"patterns"`
+}
+
+// LoadPatternConfig defines one kind of generated request, picked in proportion to its weight
+type LoadPatternConfig struct {
+	SlaveIDs     string `mapstructure:"slave_ids"`     // e.g. "1-10", a random one is used per request
+	FunctionCode byte   `mapstructure:"function_code"` // 1-6, 15 or 16
+	Address      string `mapstructure:"address"`       // First address, or a Modicon reference
+	Span         uint16 `mapstructure:"span"`          // Requests start at a random offset below span from Address
+	Count        uint16 `mapstructure:"count"`         // Coils or registers per request
+	Value        uint16 `mapstructure:"value"`         // Value written by write function codes
+	Weight       int    `mapstructure:"weight"`
+}
+
+// LoadConfig loads configuration from file. Keys the configuration doesn't define
+// are rejected with an *UnknownKeysError, as a misspelled key would otherwise leave
+// its setting at the default unnoticed.
 func LoadConfig(configFile string) (*Config, error) {
+	config, file, issues, err := Check(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(issues) > 0 {
+		return nil, &UnknownKeysError{File: file, Keys: issues}
+	}
+	return config, nil
+}
+
+// searchPaths are the directories searched for config.yaml, or a conf.d directory.
+var searchPaths = []string{"/etc/modbusgw/", "$HOME/.modbusgw", "."}
+
+// read reads the config file, searched in the usual places if configFile is empty,
+// and merges the files of the conf.d directory next to it. configFile may be such a
+// directory too. It returns the file or directory read, and the files merged.
+func read(configFile string) (*viper.Viper, string, []source, error) {
 	v := viper.New()
 
+	// Set defaults
+	v.SetDefault("log.level", "info")
+
+	if info, err := os.Stat(configFile); err == nil && info.IsDir() {
+		return merge(v, configFile, configFile, nil)
+	}
 	if configFile != "" {
 		v.SetConfigFile(configFile)
+		if filepath.Ext(configFile) == ".conf" {
+			v.SetConfigType("properties") // mbusd's "key = value" lines
+		}
 	} else {
 		v.SetConfigName("config")
 		v.SetConfigType("yaml")
-		v.AddConfigPath("/etc/modbusgw/")
-		v.AddConfigPath("$HOME/.modbusgw")
-		v.AddConfigPath(".")
+		for _, dir := range searchPaths {
+			v.AddConfigPath(dir)
+		}
 	}
 
-	// Set defaults
-	v.SetDefault("log.level", "info")
-
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("failed to found config file: %w", err)
+			return nil, configFile, nil, fmt.Errorf("failed to found config file: %w", err)
+		}
+		// Without config.yaml, gateways may all be defined in a conf.d directory
+		for _, dir := range searchPaths {
+			dir = filepath.Join(os.ExpandEnv(dir), "conf.d")
+			if files, _ := confFiles(dir); len(files) > 0 {
+				return merge(v, dir, dir, nil)
+			}
 		}
 
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, configFile, nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+	file := v.ConfigFileUsed()
+	return merge(v, file, filepath.Join(filepath.Dir(file), "conf.d"), []source{{file: file, settings: v.AllSettings()}})
+}
 
-	var config Config
-	if err := v.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+// Fixup fills in defaults and normalizes values. LoadConfig calls it,
+// configs built programmatically must call it before use. It is idempotent.
+func (c *Config) Fixup() {
+	if c.API.Dashboard && c.API.Transactions == 0 {
+		c.API.Transactions = 100
 	}
+	fixupTracing(&c.Tracing)
 
-	// Validate / Fixups
-	for i := range config.Gateways {
-		gw := &config.Gateways[i]
+	for i := range c.Gateways {
+		gw := &c.Gateways[i]
 
 		for j := range gw.Downstreams {
-			fixupSerial(&gw.Downstreams[j].Serial)
+			fixupDownstream(&gw.Downstreams[j])
 		}
 
 		for j := range gw.Upstreams {
 			fixupSerial(&gw.Upstreams[j].Serial)
 		}
+
+		fixupCloud(&gw.Cloud)
+		fixupMQTT(&gw.MQTT, gw.Name)
+		fixupInflux(&gw.Influx)
+
+		if gw.Alarms.Interval == 0 {
+			gw.Alarms.Interval = time.Second
+		}
+
+		fixupLoadGen(&gw.LoadGen)
+		fixupCapture(&gw.Capture)
+
+		for j := range gw.SunSpec {
+			if gw.SunSpec[j].Prefix == "" {
+				gw.SunSpec[j].Prefix = fmt.Sprintf("sunspec%d", gw.SunSpec[j].SlaveID)
+			}
+		}
+	}
+}
+
+func fixupTracing(t *TracingConfig) {
+	if t.ServiceName == "" {
+		t.ServiceName = "modbus-gateway"
+	}
+	if t.SampleRate == 0 {
+		t.SampleRate = 1
+	}
+	if t.Interval == 0 {
+		t.Interval = 5 * time.Second
+	}
+	if t.Timeout == 0 {
+		t.Timeout = 10 * time.Second
+	}
+	if t.BufferSize == 0 {
+		t.BufferSize = 10000
+	}
+}
+
+func fixupCapture(c *CaptureConfig) {
+	if c.Format == "" {
+		c.Format = "pcapng"
+		if ext := filepath.Ext(c.File); ext == ".jsonl" || ext == ".json" {
+			c.Format = "jsonl"
+		}
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = 100
+	}
+}
+
+func fixupDownstream(ds *DownstreamConfig) {
+	fixupSerial(&ds.Serial)
+	if ds.Chaos.Timeout == 0 {
+		ds.Chaos.Timeout = time.Second
+	}
+	if ds.Discover.Timeout == 0 {
+		ds.Discover.Timeout = 500 * time.Millisecond
+	}
+	if ds.Timeout == 0 {
+		ds.Timeout = 2 * time.Second
+	}
+	if ds.RetryBackoff == 0 {
+		ds.RetryBackoff = 100 * time.Millisecond
+	}
+	fixupBreaker(ds)
+	fixupMirror(&ds.Mirror)
+	if ds.Probe.Function == 0 {
+		ds.Probe.Function = 3
+	}
+	fixupPersistence(&ds.Local.Persistence)
+	for i := range ds.Local.Units {
+		fixupPersistence(&ds.Local.Units[i].Persistence)
 	}
 
-	return &config, nil
+	for i := range ds.Backups {
+		fixupDownstream(&ds.Backups[i])
+	}
+	for i := range ds.Balance.Members {
+		fixupDownstream(&ds.Balance.Members[i])
+	}
+	if ds.Balance.Strategy == "" {
+		ds.Balance.Strategy = "round_robin"
+	}
+	if ds.Balance.Failures == 0 {
+		ds.Balance.Failures = 3
+	}
+	if ds.Balance.Cooldown == 0 {
+		ds.Balance.Cooldown = 10 * time.Second
+	}
+	if ds.Failover.Failures == 0 {
+		ds.Failover.Failures = 3
+	}
+	if ds.Failover.Interval == 0 {
+		ds.Failover.Interval = 5 * time.Second
+	}
+	if ds.Failover.Function == 0 {
+		ds.Failover.Function = 3
+	}
+	if ds.Tcp.Heartbeat.Function == 0 {
+		ds.Tcp.Heartbeat.Function = 3
+	}
 }
 
 func fixupSerial(s *SerialConfig) {
@@ -139,3 +837,87 @@ func fixupSerial(s *SerialConfig) {
 		s.RqstPause = 100 * time.Millisecond
 	}
 }
+
+func fixupBreaker(ds *DownstreamConfig) {
+	if ds.Required && ds.Breaker.Failures == 0 {
+		ds.Breaker.Failures = 5
+	}
+	if ds.Breaker.Cooldown == 0 {
+		ds.Breaker.Cooldown = 10 * time.Second
+	}
+}
+
+func fixupPersistence(p *PersistenceConfig) {
+	if p.SyncMode == "" {
+		p.SyncMode = "always"
+	}
+	if p.SyncInterval == 0 {
+		p.SyncInterval = time.Second
+	}
+}
+
+func fixupMirror(m *MirrorConfig) {
+	if m.Interval == 0 {
+		m.Interval = time.Second
+	}
+	if m.MaxAge == 0 {
+		m.MaxAge = 3 * m.Interval
+	}
+}
+
+func fixupLoadGen(l *LoadGenConfig) {
+	if l.Concurrency == 0 {
+		l.Concurrency = 1
+	}
+	if l.ReportInterval == 0 {
+		l.ReportInterval = 10 * time.Second
+	}
+	for i := range l.Patterns {
+		if l.Patterns[i].Count == 0 {
+			l.Patterns[i].Count = 1
+		}
+		if l.Patterns[i].Weight == 0 {
+			l.Patterns[i].Weight = 1
+		}
+	}
+}
+
+func fixupMQTT(m *MQTTConfig, gateway string) {
+	if m.ClientID == "" {
+		m.ClientID = "modbus-gateway-" + gateway
+	}
+	if m.Topic == "" {
+		m.Topic = "modbus-gateway/{gateway}/{tag}"
+	}
+	if m.Interval == 0 {
+		m.Interval = 10 * time.Second
+	}
+	if m.DiscoveryPrefix == "" {
+		m.DiscoveryPrefix = "homeassistant"
+	}
+}
+
+func fixupInflux(i *InfluxConfig) {
+	if i.Measurement == "" {
+		i.Measurement = "modbus"
+	}
+	if i.Interval == 0 {
+		i.Interval = 10 * time.Second
+	}
+	if i.Timeout == 0 {
+		i.Timeout = 5 * time.Second
+	}
+	if i.BufferSize == 0 {
+		i.BufferSize = 10000
+	}
+}
+
+func fixupCloud(c *CloudConfig) {
+	c.Provider = strings.ToLower(c.Provider)
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.BufferSize == 0 {
+		c.BufferSize = 1000
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// expander expands ${NAME} in configuration values, so one file serves several
+// sites. NAME is looked up in the environment, then in the secrets file.
+// ${NAME:-default} falls back to default if NAME is set in neither, and $$ is a $.
+type expander struct {
+	secrets map[string]string // By lower case name
+}
+
+// newExpander reads the secrets file of the configuration v read, if it names one.
+// A relative path is relative to the configuration file. The secrets file holds
+// names and values in any format configurations may have, e.g. YAML or .env, or is
+// a directory of files named after the secret they hold, as Docker and Kubernetes
+// mount secrets.
+func newExpander(v *viper.Viper) (*expander, error) {
+	e := &expander{secrets: make(map[string]string)}
+	file, err := e.expand(v.GetString("secrets_file"))
+	if err != nil {
+		return nil, fmt.Errorf("secrets_file: %w", err)
+	} else if file == "" {
+		return e, nil
+	}
+	if !filepath.IsAbs(file) && v.ConfigFileUsed() != "" {
+		file = filepath.Join(filepath.Dir(v.ConfigFileUsed()), file)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secrets file: %w", err)
+		}
+		for _, entry := range entries {
+			// Kubernetes links the files to hidden directories like ..data
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join(file, entry.Name()))
+			if err != nil {
+				if entry.IsDir() {
+					continue
+				}
+				return nil, fmt.Errorf("failed to read secret: %w", err)
+			}
+			e.secrets[strings.ToLower(entry.Name())] = strings.TrimRight(string(b), "\r\n")
+		}
+		return e, nil
+	}
+
+	s := viper.New()
+	s.SetConfigFile(file)
+	if strings.HasPrefix(filepath.Base(file), ".env") || filepath.Ext(file) == ".env" {
+		s.SetConfigType("env")
+	}
+	if err := s.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	for _, key := range s.AllKeys() {
+		e.secrets[key] = s.GetString(key)
+	}
+	return e, nil
+}
+
+// expand expands the references in s.
+func (e *expander) expand(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			name, def, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+			value, ok := e.lookup(name)
+			if !ok && !hasDefault {
+				return "", fmt.Errorf("${%s}: neither an environment variable nor a secret", name)
+			} else if !ok {
+				value = def
+			}
+			b.WriteString(value)
+			i += end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+func (e *expander) lookup(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	value, ok := e.secrets[strings.ToLower(name)]
+	return value, ok
+}
+
+// decodeHook expands string values before viper's own conversions, so a reference
+// may stand for a number or duration too.
+func (e *expander) decodeHook() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		func(from, to reflect.Kind, data any) (any, error) {
+			if s, ok := data.(string); ok && from == reflect.String {
+				return e.expand(s)
+			}
+			return data, nil
+		},
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+}
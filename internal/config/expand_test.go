@@ -0,0 +1,84 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_Expand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PLC_HOST", "10.0.0.7")
+	t.Setenv("RETRIES", "2")
+	cfg := `secrets_file: "secrets"
+gateways:
+  - name: "plant"
+    upstreams:
+      - type: "tcp"
+        tcp:
+          address: "${LISTEN:-:502}"
+        tls:
+          key_file: "/etc/tls/${key_name}"
+    downstreams:
+      - type: "tcp"
+        tcp:
+          address: "${PLC_HOST}:502"
+        timeout: "${TIMEOUT:-1500ms}"
+        retries: "${RETRIES}"
+    mqtt:
+      password: "$${literal}"
+`
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Mounted like a Kubernetes secret
+	if err := os.MkdirAll(filepath.Join(dir, "secrets", "..data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secrets", "key_name"), []byte("site.key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+	gw := config.Gateways[0]
+	if got := gw.Upstreams[0].Tcp.Address; got != ":502" {
+		t.Errorf("upstream address = %q, want the default :502", got)
+	}
+	if got := gw.Upstreams[0].TLS.KeyFile; got != "/etc/tls/site.key" {
+		t.Errorf("key file = %q, want the secret expanded", got)
+	}
+	ds := gw.Downstreams[0]
+	if ds.Tcp.Address != "10.0.0.7:502" || ds.Timeout != 1500*time.Millisecond || ds.Retries != 2 {
+		t.Errorf("downstream address %q, timeout %v, retries %d", ds.Tcp.Address, ds.Timeout, ds.Retries)
+	}
+	if got := gw.MQTT.Password; got != "${literal}" {
+		t.Errorf("password = %q, want $$ kept as $", got)
+	}
+
+	// A secrets file of names and values, an unset name fails
+	if err := os.WriteFile(filepath.Join(dir, "secrets.yaml"), []byte("key_name: other.key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg = strings.Replace(cfg, `"secrets"`, `"secrets.yaml"`, 1)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if config, err := LoadConfig(filepath.Join(dir, "config.yaml")); err != nil || config.Gateways[0].Upstreams[0].TLS.KeyFile != "/etc/tls/other.key" {
+		t.Errorf("LoadConfig() with a YAML secrets file = %v", err)
+	}
+	cfg = strings.Replace(cfg, "${PLC_HOST}", "${PLC_ADDR}", 1)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "config.yaml")); err == nil || !strings.Contains(err.Error(), "${PLC_ADDR}") {
+		t.Errorf("LoadConfig() with an unset name error = %v", err)
+	}
+}
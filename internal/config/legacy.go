@@ -0,0 +1,119 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LegacyConfig is the flat configuration of a single gateway serving one serial line
+// to Modbus TCP masters, as mbusd reads it from its flags and configuration file. It
+// is deprecated, Config translates it to a gateway with one upstream and one
+// downstream serving every slave ID.
+type LegacyConfig struct {
+	Device     string `mapstructure:"device"`      // Serial device, e.g. "/dev/ttyUSB0"
+	Speed      int    `mapstructure:"speed"`       // Baud rate, default 9600
+	Mode       string `mapstructure:"mode"`        // Data bits, parity and stop bits, default "8n1"
+	TrxControl string `mapstructure:"trx_control"` // "addc" for adapters switching direction themselves, "rts" or "sysfs_*" for RS485 by RTS
+	Address    string `mapstructure:"address"`     // Address to listen on, default all interfaces
+	Port       int    `mapstructure:"port"`        // Default 502
+	MaxConn    int    `mapstructure:"maxconn"`     // Connections served at once, default 32
+	Retries    *int   `mapstructure:"retries"`     // Default 3
+	Pause      int    `mapstructure:"pause"`       // Milliseconds between requests, default 100
+	Wait       int    `mapstructure:"wait"`        // Milliseconds to wait for a response, default 500
+	Timeout    *int   `mapstructure:"timeout"`     // Seconds a connection may idle, default 60, 0 never closes
+	LogLevel   *int   `mapstructure:"loglevel"`    // 0 to 9, default 2
+	LogFile    string `mapstructure:"logfile"`
+}
+
+// Config translates the flat configuration, filling in mbusd's defaults. The config
+// is marked Legacy, it must be fixed up before use like others.
+func (l LegacyConfig) Config() (*Config, error) {
+	if l.Device == "" {
+		return nil, fmt.Errorf("device missing, the serial device such as /dev/ttyUSB0")
+	}
+	serial := SerialConfig{Device: l.Device, BaudRate: l.Speed, DataBits: 8, Parity: "N", StopBits: 1}
+	if serial.BaudRate == 0 {
+		serial.BaudRate = 9600
+	}
+	if l.Mode != "" {
+		var err error
+		if serial.DataBits, serial.Parity, serial.StopBits, err = parseMode(l.Mode); err != nil {
+			return nil, err
+		}
+	}
+	if trx := strings.ToLower(l.TrxControl); trx == "rts" || strings.HasPrefix(trx, "sysfs") {
+		serial.RS485 = true
+		serial.RtsHighDuringSend = true
+	} else if trx != "" && trx != "addc" {
+		return nil, fmt.Errorf("trx_control %q, want addc, rts or sysfs_0", l.TrxControl)
+	}
+	serial.RqstPause = legacyMillis(l.Pause, 100)
+
+	up := UpstreamConfig{Type: "tcp", MaxConnections: l.MaxConn, IdleTimeout: 60 * time.Second}
+	port := l.Port
+	if port == 0 {
+		port = 502
+	}
+	up.Tcp.Address = net.JoinHostPort(l.Address, strconv.Itoa(port))
+	if up.MaxConnections == 0 {
+		up.MaxConnections = 32
+	}
+	if l.Timeout != nil {
+		up.IdleTimeout = time.Duration(*l.Timeout) * time.Second
+	}
+
+	ds := DownstreamConfig{Type: "rtu", Serial: serial, Retries: 3, Timeout: legacyMillis(l.Wait, 500)}
+	if l.Retries != nil {
+		ds.Retries = *l.Retries
+	}
+
+	config := &Config{
+		Gateways: []GatewayConfig{{
+			Name:        "default",
+			Upstreams:   []UpstreamConfig{up},
+			Downstreams: []DownstreamConfig{ds}, // No slave IDs, all are routed to it
+		}},
+		Log:    LogConfig{Level: "info", File: l.LogFile},
+		Legacy: true,
+	}
+	if l.LogLevel != nil {
+		config.Log.Level = legacyLogLevel(*l.LogLevel)
+	}
+	return config, nil
+}
+
+// parseMode parses a serial mode like "8n1" or "7E2".
+func parseMode(mode string) (dataBits int, parity string, stopBits int, err error) {
+	if len(mode) != 3 || mode[0] < '5' || mode[0] > '8' || !strings.ContainsAny(mode[1:2], "nNeEoO") || (mode[2] != '1' && mode[2] != '2') {
+		return 0, "", 0, fmt.Errorf("mode %q, want data bits, parity and stop bits like 8n1", mode)
+	}
+	return int(mode[0] - '0'), strings.ToUpper(mode[1:2]), int(mode[2] - '0'), nil
+}
+
+// legacyMillis returns ms milliseconds, or def if ms is 0.
+func legacyMillis(ms, def int) time.Duration {
+	if ms == 0 {
+		ms = def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// legacyLogLevel maps mbusd's verbosity, 0 to 9, to a log level.
+func legacyLogLevel(level int) string {
+	switch {
+	case level <= 1:
+		return "error"
+	case level == 2:
+		return "warn"
+	case level <= 4:
+		return "info"
+	}
+	return "debug"
+}
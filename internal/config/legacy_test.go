@@ -0,0 +1,74 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_Legacy(t *testing.T) {
+	// An mbusd configuration file as is
+	file := filepath.Join(t.TempDir(), "mbusd.conf")
+	conf := `# mbusd configuration
+device = /dev/ttyUSB0
+speed = 19200
+mode = 8e1
+trx_control = rts
+port = 1502
+retries = 0
+wait = 300
+timeout = 0
+loglevel = 5
+`
+	if err := os.WriteFile(file, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+	if !cfg.Legacy || len(cfg.Gateways) != 1 {
+		t.Fatalf("config = %+v, want one legacy gateway", cfg)
+	}
+	gw := cfg.Gateways[0]
+	if len(gw.Upstreams) != 1 || len(gw.Downstreams) != 1 {
+		t.Fatalf("gateway = %+v, want one upstream and one downstream", gw)
+	}
+	up, ds := gw.Upstreams[0], gw.Downstreams[0]
+	if up.Type != "tcp" || up.Tcp.Address != ":1502" || up.MaxConnections != 32 || up.IdleTimeout != 0 {
+		t.Errorf("upstream = %+v", up)
+	}
+	if ds.Type != "rtu" || ds.SlaveIDs != "" || ds.Retries != 0 || ds.Timeout != 300*time.Millisecond {
+		t.Errorf("downstream = %+v", ds)
+	}
+	s := ds.Serial
+	if s.Device != "/dev/ttyUSB0" || s.BaudRate != 19200 || s.DataBits != 8 || s.Parity != "E" || s.StopBits != 1 || !s.RS485 || s.RqstPause != 100*time.Millisecond {
+		t.Errorf("serial = %+v", s)
+	}
+	if cfg.Log.Level != "debug" {
+		t.Errorf("log level = %q, want debug", cfg.Log.Level)
+	}
+
+	// The same keys in YAML, misspelled ones are rejected like in others
+	file = filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("device: /dev/ttyS0\nsped: 9600\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(file)
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) || len(unknown.Keys) != 1 || unknown.Keys[0].String() != `sped: unknown key, did you mean "speed"?` {
+		t.Errorf("LoadConfig() error = %v, want sped unknown", err)
+	}
+
+	if err := os.WriteFile(file, []byte("device: /dev/ttyS0\nmode: 9x1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(file); err == nil {
+		t.Error("LoadConfig() of mode 9x1 succeeded")
+	}
+}
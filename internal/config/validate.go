@@ -0,0 +1,219 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Issue is a problem found in a configuration, at the path of its key, e.g.
+// "gateways[0].downstreams[1].slave_ids". File is set if the configuration was
+// merged from several files.
+type Issue struct {
+	File    string
+	Path    string
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.File != "" {
+		return i.File + ": " + i.Path + ": " + i.Message
+	}
+	return i.Path + ": " + i.Message
+}
+
+// UnknownKeysError lists the keys of a configuration file it doesn't define.
+type UnknownKeysError struct {
+	File string
+	Keys []Issue
+}
+
+func (e *UnknownKeysError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unknown keys in %s:", e.File)
+	for _, key := range e.Keys {
+		b.WriteString("\n\t" + key.String())
+	}
+	return b.String()
+}
+
+// Check loads the configuration like LoadConfig, but returns the keys it doesn't
+// define as issues instead of failing, so they can be reported along with others.
+// It returns the file read, or the conf.d directory if there is no main file.
+func Check(configFile string) (*Config, string, []Issue, error) {
+	v, file, sources, err := read(configFile)
+	if err != nil {
+		return nil, file, nil, err
+	}
+	e, err := newExpander(v)
+	if err != nil {
+		return nil, file, nil, err
+	}
+	if !v.IsSet("gateways") && v.IsSet("device") {
+		return checkLegacy(v, e, file)
+	}
+	var config Config
+	if err := v.Unmarshal(&config, e.decodeHook()); err != nil {
+		return nil, file, nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	config.Fixup()
+
+	// Keys are checked file by file, as gateways are numbered in theirs
+	var issues []Issue
+	for _, src := range sources {
+		var found []Issue
+		unknownKeys(src.settings, reflect.TypeOf(config), "", &found)
+		sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+		for _, issue := range found {
+			if len(sources) > 1 {
+				issue.File = src.file
+			}
+			issues = append(issues, issue)
+		}
+	}
+	return &config, file, issues, nil
+}
+
+// checkLegacy checks a flat configuration, and translates it.
+func checkLegacy(v *viper.Viper, e *expander, file string) (*Config, string, []Issue, error) {
+	var legacy LegacyConfig
+	if err := v.Unmarshal(&legacy, e.decodeHook()); err != nil {
+		return nil, file, nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	config, err := legacy.Config()
+	if err != nil {
+		return nil, file, nil, fmt.Errorf("invalid flat config %s: %w", file, err)
+	}
+	config.Fixup()
+
+	settings := v.AllSettings()
+	if !v.InConfig("log") {
+		delete(settings, "log") // Only defaulted
+	}
+	var issues []Issue
+	unknownKeys(settings, reflect.TypeOf(legacy), "", &issues)
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return config, file, issues, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// unknownKeys reports the keys of value, read from the file at path, that t has no
+// field for. Keys compare case-insensitively, as the file is read.
+func unknownKeys(value any, t reflect.Type, path string, issues *[]Issue) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == durationType || t == reflect.TypeOf(time.Time{}) {
+			return
+		}
+		m, ok := toMap(value)
+		if !ok {
+			return // Type errors are left to unmarshaling
+		}
+		fields := make(map[string]reflect.Type)
+		addFields(t, fields)
+		for key, v := range m {
+			ft, ok := fields[strings.ToLower(key)]
+			if !ok {
+				*issues = append(*issues, Issue{Path: join(path, key), Message: unknownMessage(key, fields)})
+				continue
+			}
+			unknownKeys(v, ft, join(path, key), issues)
+		}
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), issues)
+		}
+	}
+}
+
+// addFields adds the keys of the fields of struct t to fields, those of squashed
+// embedded structs as their own.
+func addFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if opts == "squash" && f.Type.Kind() == reflect.Struct {
+			addFields(f.Type, fields)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+}
+
+// toMap returns value as a map with string keys, as decoded from YAML or JSON.
+func toMap(value any) (map[string]any, bool) {
+	switch m := value.(type) {
+	case map[string]any:
+		return m, true
+	case map[any]any:
+		out := make(map[string]any, len(m))
+		for k, v := range m {
+			out[fmt.Sprint(k)] = v
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// unknownMessage describes an unknown key, suggesting the known one closest to it.
+func unknownMessage(key string, fields map[string]reflect.Type) string {
+	key = strings.ToLower(key)
+	best, bestDistance := "", 3 // Suggestions differ in at most 2 edits
+	for name := range fields {
+		d := distance(key, name)
+		if d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return "unknown key"
+	}
+	return fmt.Sprintf("unknown key, did you mean %q?", best)
+}
+
+// distance returns the Levenshtein distance of a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
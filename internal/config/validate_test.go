@@ -0,0 +1,76 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_UnknownKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := `gateways:
+  - name: "plant"
+    downstream:
+      type: "tcp"
+    downstreams:
+      - type: "tcp"
+        tcp:
+          address: "192.168.1.10:502"
+        labels:
+          site: "north"
+      - type: "local"
+        local:
+          units:
+            - slave_id: 2
+              profile: "inverter"
+              profle: "inverter"
+    influx:
+      tags:
+        site: "north"
+log:
+  levle: "debug"
+`
+	if err := os.WriteFile(file, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig(file)
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("LoadConfig() error = %v, want unknown keys", err)
+	}
+	want := []string{
+		`gateways[0].downstream: unknown key, did you mean "downstreams"?`,
+		`gateways[0].downstreams[0].labels: unknown key`,
+		`gateways[0].downstreams[1].local.units[0].profle: unknown key, did you mean "profile"?`,
+		`log.levle: unknown key, did you mean "level"?`,
+	}
+	if len(unknown.Keys) != len(want) {
+		t.Fatalf("unknown keys = %v, want %d", unknown.Keys, len(want))
+	}
+	for i, key := range unknown.Keys {
+		if key.String() != want[i] {
+			t.Errorf("unknown key %d = %q, want %q", i, key, want[i])
+		}
+	}
+	if !strings.Contains(err.Error(), file) {
+		t.Errorf("error %q doesn't name the file", err)
+	}
+
+	// Free-form maps take any key
+	cfg = strings.Replace(cfg, "    downstream:\n      type: \"tcp\"\n", "", 1)
+	cfg = strings.Replace(cfg, "        labels:\n          site: \"north\"\n", "", 1)
+	cfg = strings.Replace(cfg, "levle", "level", 1)
+	cfg = strings.Replace(cfg, "              profle: \"inverter\"\n", "", 1)
+	if err := os.WriteFile(file, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(file); err != nil {
+		t.Errorf("LoadConfig() of a valid file = %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cloud
+
+// message is a payload waiting to be published to the cloud.
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// buffer is a bounded FIFO of messages kept while the cloud is unreachable.
+// When full, the oldest message is discarded so that the most recent state survives.
+type buffer struct {
+	items []message
+	size  int
+}
+
+func newBuffer(size int) *buffer {
+	return &buffer{size: size}
+}
+
+// push appends a message and reports whether an older message was dropped to make room.
+func (b *buffer) push(m message) (dropped bool) {
+	if len(b.items) >= b.size {
+		b.items = b.items[1:]
+		dropped = true
+	}
+	b.items = append(b.items, m)
+	return
+}
+
+// peek returns the oldest message without removing it.
+func (b *buffer) peek() (message, bool) {
+	if len(b.items) == 0 {
+		return message{}, false
+	}
+	return b.items[0], true
+}
+
+// pop removes the oldest message.
+func (b *buffer) pop() {
+	if len(b.items) > 0 {
+		b.items[0] = message{}
+		b.items = b.items[1:]
+	}
+}
+
+func (b *buffer) len() int {
+	return len(b.items)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package cloud connects a gateway to AWS IoT Core or Azure IoT Hub.
+// Tag values are published periodically and desired-state writes from the cloud
+// are forwarded to the slaves through the gateway's routing table.
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+const (
+	publishTimeout = 10 * time.Second
+	writeTimeout   = 5 * time.Second
+)
+
+// Connector implements gateway.Service for a cloud IoT platform.
+type Connector struct {
+	cfg      config.CloudConfig
+	tags     *tag.Registry
+	handler  transport.RequestHandler
+	provider provider
+	buffer   *buffer
+	filter   *tag.Filter
+
+	client    mqtt.Client
+	connected chan struct{}
+	log       *slog.Logger // Labeled with the gateway once running
+}
+
+// NewConnector creates a cloud connector publishing the tags of the registry.
+// Requests are issued through handler, normally the owning gateway's Handle method.
+func NewConnector(cfg config.CloudConfig, tags *tag.Registry, handler transport.RequestHandler) (*Connector, error) {
+	p, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Connector{
+		cfg:       cfg,
+		tags:      tags,
+		handler:   handler,
+		provider:  p,
+		buffer:    newBuffer(cfg.BufferSize),
+		filter:    tag.NewFilter(tags.Tags()),
+		connected: make(chan struct{}, 1),
+		log:       slog.Default(),
+	}, nil
+}
+
+// Run connects to the cloud and publishes tag samples until ctx is cancelled.
+func (c *Connector) Run(ctx context.Context) error {
+	c.log = transport.Logger(ctx)
+	opts := mqtt.NewClientOptions()
+	if err := c.provider.configure(opts); err != nil {
+		return err
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetCleanSession(true)
+	// Writes may wait on slow serial slaves, don't block the MQTT router with them.
+	opts.SetOrderMatters(false)
+	opts.SetOnConnectHandler(func(cl mqtt.Client) {
+		c.log.Info("Connected to cloud", "provider", c.cfg.Provider, "endpoint", c.cfg.Endpoint)
+		c.subscribe(ctx, cl)
+		select {
+		case c.connected <- struct{}{}:
+		default:
+		}
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		c.log.Warn("Lost connection to cloud, buffering messages", "provider", c.cfg.Provider, "err", err)
+	})
+
+	c.client = mqtt.NewClient(opts)
+	// With ConnectRetry the token only completes once connected, so don't wait for it.
+	c.client.Connect()
+	defer c.client.Disconnect(250)
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.connected:
+			c.flush()
+		case <-ticker.C:
+			c.sample(ctx)
+			c.flush()
+		}
+	}
+}
+
+// sample reads all tags and queues a telemetry message.
+func (c *Connector) sample(ctx context.Context) {
+	samples, errs := tag.ReadAll(ctx, c.handler, c.tags.Tags())
+	for name, err := range errs {
+		c.log.Warn("Failed to read tag", "tag", name, "err", err)
+	}
+	samples = c.filter.Apply(samples)
+	if len(samples) == 0 {
+		return
+	}
+
+	msg, err := c.provider.telemetry(samples)
+	if err != nil {
+		c.log.Error("Failed to encode telemetry", "err", err)
+		return
+	}
+	if dropped := c.buffer.push(msg); dropped {
+		c.log.Warn("Cloud buffer full, dropped oldest message", "size", c.cfg.BufferSize)
+	}
+}
+
+// flush publishes buffered messages in order until the buffer is empty or a publish fails.
+func (c *Connector) flush() {
+	for c.client.IsConnectionOpen() {
+		msg, ok := c.buffer.peek()
+		if !ok {
+			return
+		}
+		if err := c.publish(msg); err != nil {
+			c.log.Warn("Failed to publish to cloud", "topic", msg.topic, "pending", c.buffer.len(), "err", err)
+			return
+		}
+		c.buffer.pop()
+	}
+}
+
+func (c *Connector) publish(msg message) error {
+	token := c.client.Publish(msg.topic, 1, false, msg.payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("publish timed out")
+	}
+	return token.Error()
+}
+
+func (c *Connector) subscribe(ctx context.Context, cl mqtt.Client) {
+	for _, topic := range c.provider.subscriptions() {
+		token := cl.Subscribe(topic, 1, func(_ mqtt.Client, m mqtt.Message) {
+			reply := c.provider.handle(m.Topic(), m.Payload(), func(values map[string]any) error {
+				return c.apply(ctx, values)
+			})
+			if reply != nil {
+				cl.Publish(reply.topic, 0, false, reply.payload)
+			}
+		})
+		if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+			c.log.Error("Failed to subscribe", "topic", topic, "err", token.Error())
+		}
+	}
+}
+
+// apply writes desired tag values to the slaves.
+func (c *Connector) apply(ctx context.Context, values map[string]any) error {
+	var errs []error
+	for name, v := range values {
+		t, ok := c.tags.Lookup(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown tag: %s", name))
+			continue
+		}
+		wctx, cancel := context.WithTimeout(ctx, writeTimeout)
+		err := tag.Write(wctx, c.handler, t, v)
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.log.Info("Applied cloud write", "tag", name, "value", v)
+	}
+	return errors.Join(errs...)
+}
+
+func logWriteError(topic string, err error) {
+	slog.Error("Failed to handle cloud write", "topic", topic, "err", err)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package cloud
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+)
+
+func TestBuffer_DropsOldest(t *testing.T) {
+	b := newBuffer(2)
+	b.push(message{topic: "a"})
+	b.push(message{topic: "b"})
+	if dropped := b.push(message{topic: "c"}); !dropped {
+		t.Error("Expected oldest message to be dropped")
+	}
+
+	for _, want := range []string{"b", "c"} {
+		m, ok := b.peek()
+		if !ok || m.topic != want {
+			t.Fatalf("peek() = %q, %v; want %q", m.topic, ok, want)
+		}
+		b.pop()
+	}
+	if _, ok := b.peek(); ok {
+		t.Error("Expected empty buffer")
+	}
+}
+
+func TestSASToken(t *testing.T) {
+	// Key "secret" in base64
+	token, err := sasToken("myhub.azure-devices.net/devices/dev1", "c2VjcmV0", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "SharedAccessSignature sr=myhub.azure-devices.net%2Fdevices%2Fdev1&sig=") {
+		t.Errorf("Unexpected token: %s", token)
+	}
+	if !strings.HasSuffix(token, "&se=1700000000") {
+		t.Errorf("Unexpected expiry in token: %s", token)
+	}
+
+	if _, err := sasToken("r", "not base64!", time.Now()); err == nil {
+		t.Error("Expected error for invalid key")
+	}
+}
+
+func TestAWSProvider(t *testing.T) {
+	p := &awsProvider{cfg: config.CloudConfig{DeviceID: "pump-1"}}
+
+	msg, err := p.telemetry([]tag.Sample{{Tag: "speed", Value: uint16(1500)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.topic != "$aws/things/pump-1/shadow/update" {
+		t.Errorf("Unexpected topic: %s", msg.topic)
+	}
+	if string(msg.payload) != `{"state":{"reported":{"speed":1500}}}` {
+		t.Errorf("Unexpected payload: %s", msg.payload)
+	}
+
+	var got map[string]any
+	p.handle("$aws/things/pump-1/shadow/update/delta", []byte(`{"version":3,"state":{"speed":1200}}`), func(v map[string]any) error {
+		got = v
+		return nil
+	})
+	if got["speed"] != float64(1200) {
+		t.Errorf("Unexpected desired state: %v", got)
+	}
+}
+
+func TestAzureProvider_Methods(t *testing.T) {
+	p := &azureProvider{cfg: config.CloudConfig{DeviceID: "dev1"}}
+
+	reply := p.handle("$iothub/methods/POST/write/?$rid=7", []byte(`{"valve":true}`), func(v map[string]any) error {
+		if v["valve"] != true {
+			t.Errorf("Unexpected values: %v", v)
+		}
+		return nil
+	})
+	if reply == nil || reply.topic != "$iothub/methods/res/200/?$rid=7" {
+		t.Fatalf("Unexpected reply: %+v", reply)
+	}
+
+	reply = p.handle("$iothub/methods/POST/reboot/?$rid=8", []byte(`{}`), func(map[string]any) error { return nil })
+	if reply == nil || reply.topic != "$iothub/methods/res/404/?$rid=8" {
+		t.Fatalf("Unexpected reply for unknown method: %+v", reply)
+	}
+
+	var desired map[string]any
+	p.handle("$iothub/twin/PATCH/properties/desired/?$version=4", []byte(`{"setpoint":21,"$version":4}`), func(v map[string]any) error {
+		desired = v
+		return nil
+	})
+	if _, ok := desired["$version"]; ok || desired["setpoint"] != float64(21) {
+		b, _ := json.Marshal(desired)
+		t.Errorf("Unexpected desired properties: %s", b)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package cloud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+)
+
+const (
+	azureAPIVersion = "2021-04-12"
+	sasTokenTTL     = time.Hour
+)
+
+// provider adapts the connector to the MQTT dialect of a cloud platform.
+type provider interface {
+	// configure sets broker, identity and credentials on the client options.
+	configure(opts *mqtt.ClientOptions) error
+	// telemetry encodes a batch of samples into a message.
+	telemetry(samples []tag.Sample) (message, error)
+	// subscriptions returns the topic filters carrying write requests.
+	subscriptions() []string
+	// handle decodes a write request, passes the desired tag values to apply,
+	// and returns an optional reply to publish.
+	handle(topic string, payload []byte, apply func(map[string]any) error) *message
+}
+
+func newProvider(cfg config.CloudConfig) (provider, error) {
+	if cfg.Endpoint == "" || cfg.DeviceID == "" {
+		return nil, fmt.Errorf("cloud: endpoint and device_id are required")
+	}
+	switch cfg.Provider {
+	case "aws":
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("cloud: aws requires cert_file and key_file")
+		}
+		return &awsProvider{cfg: cfg}, nil
+	case "azure":
+		if cfg.SharedAccessKey == "" && (cfg.CertFile == "" || cfg.KeyFile == "") {
+			return nil, fmt.Errorf("cloud: azure requires shared_access_key or cert_file/key_file")
+		}
+		return &azureProvider{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("cloud: unknown provider: %s", cfg.Provider)
+	}
+}
+
+// awsProvider speaks AWS IoT Core device shadow semantics.
+// Samples are reported to the classic shadow and desired-state deltas are written to the tags.
+type awsProvider struct {
+	cfg config.CloudConfig
+}
+
+func (p *awsProvider) configure(opts *mqtt.ClientOptions) error {
+	tlsConfig, err := newTLSConfig(p.cfg)
+	if err != nil {
+		return err
+	}
+	opts.AddBroker(brokerURL(p.cfg.Endpoint))
+	opts.SetClientID(p.cfg.DeviceID)
+	opts.SetTLSConfig(tlsConfig)
+	return nil
+}
+
+func (p *awsProvider) shadowTopic(suffix string) string {
+	return "$aws/things/" + p.cfg.DeviceID + "/shadow/" + suffix
+}
+
+func (p *awsProvider) telemetry(samples []tag.Sample) (message, error) {
+	doc := map[string]any{
+		"state": map[string]any{"reported": sampleValues(samples)},
+	}
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return message{}, err
+	}
+	return message{topic: p.shadowTopic("update"), payload: payload}, nil
+}
+
+func (p *awsProvider) subscriptions() []string {
+	return []string{p.shadowTopic("update/delta")}
+}
+
+func (p *awsProvider) handle(topic string, payload []byte, apply func(map[string]any) error) *message {
+	var delta struct {
+		State map[string]any `json:"state"`
+	}
+	if err := json.Unmarshal(payload, &delta); err != nil {
+		logWriteError(topic, fmt.Errorf("invalid shadow delta: %w", err))
+		return nil
+	}
+	if err := apply(delta.State); err != nil {
+		logWriteError(topic, err)
+	}
+	// The reported state converges on the next telemetry publish, which clears the delta.
+	return nil
+}
+
+// azureProvider speaks Azure IoT Hub device semantics.
+// Samples are sent as device-to-cloud telemetry, desired twin properties and the
+// "write" direct method are written to the tags.
+type azureProvider struct {
+	cfg config.CloudConfig
+}
+
+func (p *azureProvider) configure(opts *mqtt.ClientOptions) error {
+	tlsConfig, err := newTLSConfig(p.cfg)
+	if err != nil {
+		return err
+	}
+	opts.AddBroker(brokerURL(p.cfg.Endpoint))
+	opts.SetClientID(p.cfg.DeviceID)
+	username := fmt.Sprintf("%s/%s/?api-version=%s", p.cfg.Endpoint, p.cfg.DeviceID, azureAPIVersion)
+	opts.SetUsername(username)
+	opts.SetTLSConfig(tlsConfig)
+	if p.cfg.SharedAccessKey != "" {
+		// Tokens expire, so a fresh one is generated for every (re)connect.
+		opts.SetCredentialsProvider(func() (string, string) {
+			resource := p.cfg.Endpoint + "/devices/" + p.cfg.DeviceID
+			token, err := sasToken(resource, p.cfg.SharedAccessKey, time.Now().Add(sasTokenTTL))
+			if err != nil {
+				slog.Error("Failed to generate SAS token", "device", p.cfg.DeviceID, "err", err)
+			}
+			return username, token
+		})
+	}
+	return nil
+}
+
+func (p *azureProvider) telemetry(samples []tag.Sample) (message, error) {
+	payload, err := json.Marshal(sampleValues(samples))
+	if err != nil {
+		return message{}, err
+	}
+	return message{topic: "devices/" + p.cfg.DeviceID + "/messages/events/", payload: payload}, nil
+}
+
+func (p *azureProvider) subscriptions() []string {
+	return []string{
+		"$iothub/twin/PATCH/properties/desired/#",
+		"$iothub/methods/POST/#",
+	}
+}
+
+func (p *azureProvider) handle(topic string, payload []byte, apply func(map[string]any) error) *message {
+	switch {
+	case strings.HasPrefix(topic, "$iothub/twin/PATCH/properties/desired/"):
+		var desired map[string]any
+		if err := json.Unmarshal(payload, &desired); err != nil {
+			logWriteError(topic, fmt.Errorf("invalid desired properties: %w", err))
+			return nil
+		}
+		for k := range desired {
+			if strings.HasPrefix(k, "$") { // metadata such as $version
+				delete(desired, k)
+			}
+		}
+		if err := apply(desired); err != nil {
+			logWriteError(topic, err)
+		}
+		return nil
+
+	case strings.HasPrefix(topic, "$iothub/methods/POST/"):
+		// $iothub/methods/POST/{method}/?$rid={request id}
+		rest := strings.TrimPrefix(topic, "$iothub/methods/POST/")
+		method, query, _ := strings.Cut(rest, "/?")
+		values, _ := url.ParseQuery(query)
+		rid := values.Get("$rid")
+
+		status, body := 200, map[string]any{}
+		if method != "write" {
+			status, body = 404, map[string]any{"error": "unknown method: " + method}
+		} else {
+			var req map[string]any
+			if err := json.Unmarshal(payload, &req); err != nil {
+				status, body = 400, map[string]any{"error": err.Error()}
+			} else if err := apply(req); err != nil {
+				status, body = 500, map[string]any{"error": err.Error()}
+			}
+		}
+		reply, _ := json.Marshal(body)
+		return &message{
+			topic:   fmt.Sprintf("$iothub/methods/res/%d/?$rid=%s", status, rid),
+			payload: reply,
+		}
+	}
+	return nil
+}
+
+// sasToken generates an Azure shared access signature for the resource URI.
+func sasToken(resource, key string, expiry time.Time) (string, error) {
+	decodedKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid shared access key: %w", err)
+	}
+	encodedURI := url.QueryEscape(resource)
+	exp := expiry.Unix()
+
+	mac := hmac.New(sha256.New, decodedKey)
+	fmt.Fprintf(mac, "%s\n%d", encodedURI, exp)
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%d", encodedURI, url.QueryEscape(sig), exp), nil
+}
+
+func newTLSConfig(cfg config.CloudConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cloud: failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cloud: failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("cloud: no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func brokerURL(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	if !strings.Contains(endpoint, ":") {
+		endpoint += ":8883"
+	}
+	return "ssl://" + endpoint
+}
+
+func sampleValues(samples []tag.Sample) map[string]any {
+	values := make(map[string]any, len(samples))
+	for _, s := range samples {
+		values[s.Tag] = s.Value
+	}
+	return values
+}
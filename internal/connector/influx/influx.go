@@ -0,0 +1,264 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package influx exports the tag values of a gateway in line protocol, so a historian
+// such as InfluxDB records them without a separate poller.
+//
+// Tags are polled through the gateway, and a point is written for each value that
+// moved outside its deadband. Points are written to the InfluxDB 2 or 1 write API,
+// chosen by the bucket or database configured, as plain line protocol to any other
+// HTTP URL, or as datagrams to a UDP listener such as Telegraf's. Points the sink
+// refuses or can't be reached for are kept, up to the buffer size, and written with
+// the next batch.
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// maxDatagram bounds the line protocol sent in one UDP datagram, below common MTUs.
+const maxDatagram = 1400
+
+// Exporter implements gateway.Service writing the tags of a registry to a sink.
+type Exporter struct {
+	cfg     config.InfluxConfig
+	gateway string
+	tags    *tag.Registry
+	handler transport.RequestHandler
+	filter  *tag.Filter
+
+	write   func(ctx context.Context, lines []string) error // Writes to the sink, replaced in tests
+	pending []string                                        // Lines not written yet, oldest first
+	log     *slog.Logger                                    // Labeled with the gateway once running
+}
+
+// New creates an exporter of the tags of the registry, read through handler,
+// normally the owning gateway's Handle method.
+func New(gateway string, cfg config.InfluxConfig, tags *tag.Registry, handler transport.RequestHandler) (*Exporter, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("influx: invalid url: %w", err)
+	}
+	e := &Exporter{
+		cfg:     cfg,
+		gateway: gateway,
+		tags:    tags,
+		handler: handler,
+		filter:  tag.NewFilter(tags.Tags()),
+		log:     slog.Default(),
+	}
+	switch u.Scheme {
+	case "http", "https":
+		target, err := writeURL(u, cfg)
+		if err != nil {
+			return nil, err
+		}
+		client := &http.Client{Timeout: cfg.Timeout}
+		e.write = func(ctx context.Context, lines []string) error {
+			return e.post(ctx, client, target, lines)
+		}
+	case "udp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("influx: udp url needs a host and port")
+		}
+		e.write = func(ctx context.Context, lines []string) error {
+			return e.send(ctx, u.Host, lines)
+		}
+	default:
+		return nil, fmt.Errorf("influx: unsupported url scheme %q, want http, https or udp", u.Scheme)
+	}
+	return e, nil
+}
+
+// writeURL returns the URL points are posted to: the InfluxDB 2 write API with a
+// bucket, the InfluxDB 1 one with a database, else the URL itself.
+func writeURL(u *url.URL, cfg config.InfluxConfig) (string, error) {
+	target := *u
+	q := target.Query()
+	switch {
+	case cfg.Bucket != "" && cfg.Database != "":
+		return "", fmt.Errorf("influx: bucket and database are exclusive")
+	case cfg.Bucket != "":
+		if cfg.Org == "" {
+			return "", fmt.Errorf("influx: bucket needs an org")
+		}
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/api/v2/write"
+		q.Set("org", cfg.Org)
+		q.Set("bucket", cfg.Bucket)
+	case cfg.Database != "":
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/write"
+		q.Set("db", cfg.Database)
+	default:
+		return target.String(), nil
+	}
+	q.Set("precision", "ns")
+	target.RawQuery = q.Encode()
+	return target.String(), nil
+}
+
+// Run polls the tags and writes their points until ctx is cancelled.
+func (e *Exporter) Run(ctx context.Context) error {
+	e.log = transport.Logger(ctx)
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			e.export(ctx)
+		}
+	}
+}
+
+// export reads all tags and writes the points outside their deadband, with those pending.
+func (e *Exporter) export(ctx context.Context) {
+	tags := e.tags.Tags()
+	samples, errs := tag.ReadAll(ctx, e.handler, tags)
+	for name, err := range errs {
+		e.log.Warn("Failed to read tag", "tag", name, "err", err)
+	}
+	for _, s := range e.filter.Apply(samples) {
+		t, _ := e.tags.Lookup(s.Tag)
+		e.pending = append(e.pending, e.line(t, s))
+	}
+	if dropped := len(e.pending) - e.cfg.BufferSize; dropped > 0 {
+		e.log.Warn("Influx buffer full, dropped oldest points", "dropped", dropped, "size", e.cfg.BufferSize)
+		e.pending = e.pending[dropped:]
+	}
+	if len(e.pending) == 0 {
+		return
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	if err := e.write(wctx, e.pending); err != nil {
+		e.log.Warn("Failed to write points", "url", e.cfg.URL, "pending", len(e.pending), "err", err)
+		return
+	}
+	e.pending = e.pending[:0]
+}
+
+// line encodes a sample in line protocol, e.g.
+// modbus,gateway=plant,slave=1,tag=power value=1520.5 1700000000000000000
+func (e *Exporter) line(t tag.Tag, s tag.Sample) string {
+	var b strings.Builder
+	measurement := strings.NewReplacer("{gateway}", e.gateway, "{tag}", s.Tag).Replace(e.cfg.Measurement)
+	b.WriteString(escape(measurement, ", "))
+
+	tags := map[string]string{"gateway": e.gateway, "slave": strconv.Itoa(int(t.SlaveID)), "tag": s.Tag}
+	for k, v := range e.cfg.Tags {
+		tags[k] = v
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // As InfluxDB recommends, for performance
+	for _, k := range keys {
+		if tags[k] == "" {
+			continue
+		}
+		b.WriteString("," + escape(k, ",= ") + "=" + escape(tags[k], ",= "))
+	}
+
+	b.WriteString(" value=" + fieldValue(s.Value))
+	b.WriteString(" " + strconv.FormatInt(s.Time.UnixNano(), 10))
+	return b.String()
+}
+
+// fieldValue encodes a value as a line protocol field: integers with the "i" suffix,
+// strings quoted.
+func fieldValue(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	case uint64:
+		return strconv.FormatUint(v, 10) + "i"
+	default:
+		return fmt.Sprintf("%di", v)
+	}
+}
+
+// escape backslash-escapes the characters special to the element of a line.
+func escape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (e *Exporter) post(ctx context.Context, client *http.Client, target string, lines []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case e.cfg.Token != "":
+		req.Header.Set("Authorization", "Token "+e.cfg.Token)
+	case e.cfg.Username != "":
+		req.SetBasicAuth(e.cfg.Username, e.cfg.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// send writes lines as datagrams of whole lines.
+func (e *Exporter) send(ctx context.Context, addr string, lines []string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var datagram []byte
+	for i, l := range lines {
+		datagram = append(datagram, l...)
+		datagram = append(datagram, '\n')
+		if i == len(lines)-1 || len(datagram)+len(lines[i+1])+1 > maxDatagram {
+			if _, err := conn.Write(datagram); err != nil {
+				return err
+			}
+			datagram = datagram[:0]
+		}
+	}
+	return nil
+}
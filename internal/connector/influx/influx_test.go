@@ -0,0 +1,172 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package influx
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+// meter serves holding registers of slave 3.
+type meter struct {
+	registers [8]uint16
+}
+
+func (m *meter) handle(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	r, err := pdu.ParseRequest(req)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	read := r.(pdu.ReadHoldingRegistersRequest)
+	return pdu.ReadResponse(req.FunctionCode, pdu.EncodeRegisters(m.registers[read.Address:read.Address+read.Quantity])), nil
+}
+
+func newExporter(t *testing.T, m *meter, cfg config.InfluxConfig) *Exporter {
+	t.Helper()
+	tags, err := tag.NewSet([]config.TagConfig{
+		{Name: "voltage", SlaveID: 3, Address: "0", Scale: 0.1, Deadband: 1},
+		{Name: "energy", SlaveID: 3, Address: "1", Type: "uint32"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, _ := tag.NewRegistry(tags)
+	cfg.Measurement = "power_{tag}"
+	cfg.Interval, cfg.Timeout, cfg.BufferSize = time.Second, time.Second, 3
+	e, err := New("plant", cfg, registry, m.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestExporter_Line(t *testing.T) {
+	e := newExporter(t, &meter{}, config.InfluxConfig{URL: "udp://localhost:8089", Tags: map[string]string{"site": "north yard", "gateway": ""}})
+	at := time.Unix(1700000000, 5)
+	for _, tt := range []struct {
+		value any
+		want  string
+	}{
+		{230.1, `power_voltage,site=north\ yard,slave=3,tag=voltage value=230.1 1700000000000000005`},
+		{uint32(42), `power_voltage,site=north\ yard,slave=3,tag=voltage value=42i 1700000000000000005`},
+		{true, `power_voltage,site=north\ yard,slave=3,tag=voltage value=true 1700000000000000005`},
+		{`SN "7"`, `power_voltage,site=north\ yard,slave=3,tag=voltage value="SN \"7\"" 1700000000000000005`},
+	} {
+		v, _ := e.tags.Lookup("voltage")
+		if got := e.line(v, tag.Sample{Tag: "voltage", Value: tt.value, Time: at}); got != tt.want {
+			t.Errorf("line(%v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExporter_HTTP(t *testing.T) {
+	var bodies []string
+	var auth, query string
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		auth, query = r.Header.Get("Authorization"), r.URL.Path+"?"+r.URL.RawQuery
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	m := &meter{}
+	m.registers[0], m.registers[2] = 2301, 7
+	e := newExporter(t, m, config.InfluxConfig{URL: srv.URL, Org: "home", Bucket: "energy", Token: "secret"})
+
+	// Points refused are kept, the oldest dropped beyond the buffer
+	e.export(context.Background())
+	m.registers[0], m.registers[2] = 2320, 8
+	e.export(context.Background())
+	if len(e.pending) != 3 {
+		t.Fatalf("pending = %d points, want the buffer of 3", len(e.pending))
+	}
+
+	// Voltage stays within its deadband, the energy without one is written again
+	fail = false
+	m.registers[0] = 2325
+	e.export(context.Background())
+	if len(bodies) != 1 || len(e.pending) != 0 {
+		t.Fatalf("writes = %d with %d pending, want one write of everything", len(bodies), len(e.pending))
+	}
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "power_voltage,gateway=plant,slave=3,tag=voltage value=232 ") ||
+		!strings.HasPrefix(lines[2], "power_energy,gateway=plant,slave=3,tag=energy value=8i ") {
+		t.Errorf("written lines = %q", lines)
+	}
+	if auth != "Token secret" || query != "/api/v2/write?bucket=energy&org=home&precision=ns" {
+		t.Errorf("written with %q to %s", auth, query)
+	}
+}
+
+func TestExporter_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	e := newExporter(t, &meter{}, config.InfluxConfig{URL: "udp://" + conn.LocalAddr().String()})
+
+	line := "m value=" + strings.Repeat("1", 1000) + "i 1"
+	if err := e.write(context.Background(), []string{line, line, "m value=2i 2"}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2*maxDatagram)
+	var got []string
+	for len(got) < 2 {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("datagram %d: %v", len(got), err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+	if got[0] != line+"\n" || got[1] != line+"\nm value=2i 2\n" {
+		t.Errorf("datagrams = %d and %d bytes, want whole lines within %d", len(got[0]), len(got[1]), maxDatagram)
+	}
+}
+
+func TestWriteURL(t *testing.T) {
+	for _, tt := range []struct {
+		cfg  config.InfluxConfig
+		want string
+	}{
+		{config.InfluxConfig{URL: "http://influx:8086/", Database: "plant"}, "http://influx:8086/write?db=plant&precision=ns"},
+		{config.InfluxConfig{URL: "http://collector/ingest"}, "http://collector/ingest"},
+	} {
+		u, _ := url.Parse(tt.cfg.URL)
+		if got, err := writeURL(u, tt.cfg); err != nil || got != tt.want {
+			t.Errorf("writeURL(%s) = %s, %v, want %s", tt.cfg.URL, got, err, tt.want)
+		}
+	}
+
+	registry, _ := tag.NewRegistry(nil)
+	for _, cfg := range []config.InfluxConfig{
+		{URL: "tcp://influx:8086"},
+		{URL: "udp://"},
+		{URL: "http://influx:8086", Bucket: "energy"},
+		{URL: "http://influx:8086", Bucket: "energy", Org: "home", Database: "plant"},
+	} {
+		if _, err := New("plant", cfg, registry, nil); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
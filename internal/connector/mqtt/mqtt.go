@@ -0,0 +1,332 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package mqtt publishes the tag values of a gateway to an MQTT broker, such as the
+// one of a home automation system bridging inverters and heat pumps.
+//
+// Tags are polled through the gateway and published as JSON when they moved outside
+// their deadband. A write through the gateway touching a tag publishes its new value
+// at once. With Home Assistant discovery, every tag is announced as a sensor of one
+// device per gateway, and the gateway's availability is published with a will.
+package mqtt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+const (
+	publishTimeout = 10 * time.Second
+	pendingWrites  = 64 // Writes waiting to be published, more are dropped until the next poll
+)
+
+// Payloads of the availability topic.
+const (
+	online  = "online"
+	offline = "offline"
+)
+
+// errOffline is returned by publishes while disconnected. The values are published
+// again once connected.
+var errOffline = errors.New("not connected")
+
+// unsafe matches the characters not allowed in Home Assistant object IDs.
+var unsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// write is the span of a table a write through the gateway changed.
+type write struct {
+	slaveID     byte
+	table       tag.Table
+	first, last uint16
+}
+
+// message is a publish to the broker.
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// Publisher implements gateway.Service publishing the tags of a registry.
+type Publisher struct {
+	cfg     config.MQTTConfig
+	gateway string
+	tags    *tag.Registry
+	handler transport.RequestHandler
+	filter  *tag.Filter
+	writes  chan write
+
+	send      func(message) error // Publishes to the broker, replaced in tests
+	announced map[string]bool     // Tags announced to Home Assistant since connecting
+	log       *slog.Logger        // Labeled with the gateway once running
+}
+
+// New creates a publisher of the tags of the registry, read through handler,
+// normally the owning gateway's Handle method.
+func New(gateway string, cfg config.MQTTConfig, tags *tag.Registry, handler transport.RequestHandler) (*Publisher, error) {
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("mqtt: qos must be 0, 1 or 2")
+	}
+	if !strings.Contains(cfg.Topic, "{tag}") {
+		return nil, fmt.Errorf("mqtt: topic %q must contain {tag}", cfg.Topic)
+	}
+	return &Publisher{
+		cfg:       cfg,
+		gateway:   gateway,
+		tags:      tags,
+		handler:   handler,
+		filter:    tag.NewFilter(tags.Tags()),
+		writes:    make(chan write, pendingWrites),
+		announced: make(map[string]bool),
+		log:       slog.Default(),
+	}, nil
+}
+
+// Observe queues the tags a write through the gateway touched for publishing. It is
+// registered with the gateway's Watch and never blocks.
+func (p *Publisher) Observe(slaveID byte, req modbus.ProtocolDataUnit) {
+	w, ok := parseWrite(slaveID, req)
+	if !ok {
+		return
+	}
+	select {
+	case p.writes <- w:
+	default:
+	}
+}
+
+// Run connects to the broker and publishes tag values until ctx is cancelled.
+func (p *Publisher) Run(ctx context.Context) error {
+	p.log = transport.Logger(ctx)
+	opts := paho.NewClientOptions().AddBroker(p.cfg.Broker)
+	opts.SetClientID(p.cfg.ClientID)
+	opts.SetUsername(p.cfg.Username)
+	opts.SetPassword(p.cfg.Password)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	if p.cfg.HomeAssistant {
+		opts.SetWill(p.availabilityTopic(), offline, 1, true)
+	}
+	connected := make(chan struct{}, 1)
+	opts.SetOnConnectHandler(func(paho.Client) {
+		p.log.Info("Connected to MQTT broker", "broker", p.cfg.Broker)
+		select {
+		case connected <- struct{}{}:
+		default:
+		}
+	})
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		p.log.Warn("Lost connection to MQTT broker", "broker", p.cfg.Broker, "err", err)
+	})
+
+	client := paho.NewClient(opts)
+	p.send = func(msg message) error {
+		if !client.IsConnectionOpen() {
+			return errOffline
+		}
+		token := client.Publish(msg.topic, p.cfg.QoS, msg.retain, msg.payload)
+		if !token.WaitTimeout(publishTimeout) {
+			return fmt.Errorf("publish timed out")
+		}
+		return token.Error()
+	}
+	// With ConnectRetry the token only completes once connected, so don't wait for it.
+	client.Connect()
+	defer client.Disconnect(250)
+	defer func() {
+		if p.cfg.HomeAssistant && client.IsConnectionOpen() {
+			p.publish(message{topic: p.availabilityTopic(), payload: []byte(offline), retain: true})
+		}
+	}()
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-connected:
+			// Announce again and publish every value, the broker may have lost them
+			p.announced = make(map[string]bool)
+			p.filter.Reset()
+			if p.cfg.HomeAssistant {
+				p.publish(message{topic: p.availabilityTopic(), payload: []byte(online), retain: true})
+			}
+			p.poll(ctx)
+		case <-ticker.C:
+			p.poll(ctx)
+		case w := <-p.writes:
+			p.refresh(ctx, w)
+		}
+	}
+}
+
+// poll reads all tags and publishes those outside their deadband.
+func (p *Publisher) poll(ctx context.Context) {
+	tags := p.tags.Tags()
+	p.announce(tags)
+	samples, errs := tag.ReadAll(ctx, p.handler, tags)
+	for name, err := range errs {
+		p.log.Warn("Failed to read tag", "tag", name, "err", err)
+	}
+	for _, s := range p.filter.Apply(samples) {
+		p.publishSample(s)
+	}
+}
+
+// refresh reads and publishes the tags a write touched.
+func (p *Publisher) refresh(ctx context.Context, w write) {
+	var touched []tag.Tag
+	for _, t := range p.tags.Tags() {
+		if w.touches(t) {
+			touched = append(touched, t)
+		}
+	}
+	if len(touched) == 0 {
+		return
+	}
+	samples, errs := tag.ReadAll(ctx, p.handler, touched)
+	for name, err := range errs {
+		p.log.Warn("Failed to read written tag", "tag", name, "err", err)
+	}
+	// The new value passes the deadband, it is recorded as published
+	p.filter.Apply(samples)
+	for _, s := range samples {
+		p.publishSample(s)
+	}
+}
+
+// announce publishes the Home Assistant discovery messages of tags not announced yet.
+func (p *Publisher) announce(tags []tag.Tag) {
+	if !p.cfg.HomeAssistant {
+		return
+	}
+	for _, t := range tags {
+		if p.announced[t.Name] {
+			continue
+		}
+		msg, err := p.discovery(t)
+		if err == nil {
+			err = p.publish(msg)
+		}
+		p.announced[t.Name] = err == nil
+	}
+}
+
+func (p *Publisher) publishSample(s tag.Sample) {
+	payload, err := json.Marshal(map[string]any{"value": s.Value, "time": s.Time.UTC().Format(time.RFC3339)})
+	if err != nil {
+		p.log.Error("Failed to encode tag value", "tag", s.Tag, "err", err)
+		return
+	}
+	p.publish(message{topic: p.topic(s.Tag), payload: payload, retain: p.cfg.Retain})
+}
+
+func (p *Publisher) publish(msg message) error {
+	err := p.send(msg)
+	if err != nil && !errors.Is(err, errOffline) {
+		p.log.Warn("Failed to publish to MQTT broker", "topic", msg.topic, "err", err)
+	}
+	return err
+}
+
+// topic returns the topic the values of a tag are published to.
+func (p *Publisher) topic(name string) string {
+	return strings.NewReplacer("{gateway}", p.gateway, "{tag}", name).Replace(p.cfg.Topic)
+}
+
+// availabilityTopic is where the gateway reports itself online or offline.
+func (p *Publisher) availabilityTopic() string {
+	return p.cfg.DiscoveryPrefix + "/" + p.deviceID() + "/availability"
+}
+
+func (p *Publisher) deviceID() string {
+	return "modbus_gateway_" + unsafe.ReplaceAllString(p.gateway, "_")
+}
+
+// discovery returns the Home Assistant discovery message of a tag: a binary sensor
+// for coils and discrete inputs, a sensor otherwise.
+func (p *Publisher) discovery(t tag.Tag) (message, error) {
+	component := "sensor"
+	valueTemplate := "{{ value_json.value }}"
+	if t.Table == tag.TableCoils || t.Table == tag.TableDiscreteInputs {
+		component = "binary_sensor"
+		valueTemplate = "{{ 'ON' if value_json.value else 'OFF' }}"
+	}
+	objectID := unsafe.ReplaceAllString(t.Name, "_")
+	doc := map[string]any{
+		"name":               t.Name,
+		"unique_id":          p.deviceID() + "_" + objectID,
+		"object_id":          objectID,
+		"state_topic":        p.topic(t.Name),
+		"value_template":     valueTemplate,
+		"availability_topic": p.availabilityTopic(),
+		"device": map[string]any{
+			"identifiers":  []string{p.deviceID()},
+			"name":         p.gateway,
+			"manufacturer": "modbus-gateway",
+		},
+	}
+	if t.Unit != "" {
+		doc["unit_of_measurement"] = t.Unit
+	}
+	if component == "sensor" && t.Type != tag.TypeString {
+		doc["state_class"] = "measurement"
+	}
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return message{}, err
+	}
+	topic := fmt.Sprintf("%s/%s/%s/%s/config", p.cfg.DiscoveryPrefix, component, p.deviceID(), objectID)
+	return message{topic: topic, payload: payload, retain: true}, nil
+}
+
+// parseWrite returns the span a write request changes.
+func parseWrite(slaveID byte, req modbus.ProtocolDataUnit) (write, bool) {
+	if req.FunctionCode == modbus.FuncCodeReadWriteMultipleRegisters && len(req.Data) >= 8 {
+		first, quantity := binary.BigEndian.Uint16(req.Data[4:]), binary.BigEndian.Uint16(req.Data[6:])
+		return write{slaveID: slaveID, table: tag.TableHoldingRegisters, first: first, last: first + max(quantity, 1) - 1}, true
+	}
+	r, err := pdu.ParseRequest(req)
+	if err != nil {
+		return write{}, false
+	}
+	w := write{slaveID: slaveID, table: tag.TableHoldingRegisters}
+	switch r := r.(type) {
+	case pdu.WriteSingleCoilRequest:
+		w.table, w.first, w.last = tag.TableCoils, r.Address, r.Address
+	case pdu.WriteMultipleCoilsRequest:
+		w.table, w.first, w.last = tag.TableCoils, r.Address, r.Address+uint16(max(len(r.Values), 1))-1
+	case pdu.WriteSingleRegisterRequest:
+		w.first, w.last = r.Address, r.Address
+	case pdu.WriteMultipleRegistersRequest:
+		w.first, w.last = r.Address, r.Address+uint16(max(len(r.Values), 1))-1
+	case pdu.MaskWriteRegisterRequest:
+		w.first, w.last = r.Address, r.Address
+	default:
+		return write{}, false
+	}
+	return w, true
+}
+
+// touches reports whether the write changed a register or bit of t.
+func (w write) touches(t tag.Tag) bool {
+	last := int(t.Address) + int(t.Quantity()) - 1
+	return t.SlaveID == w.slaveID && t.Table == w.table && int(w.first) <= last && w.last >= t.Address
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+// heatPump serves holding registers and coils of slave 1.
+type heatPump struct {
+	registers [16]uint16
+	coils     [16]bool
+}
+
+func (h *heatPump) handle(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	r, err := pdu.ParseRequest(req)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	switch r := r.(type) {
+	case pdu.ReadHoldingRegistersRequest:
+		return pdu.ReadResponse(req.FunctionCode, pdu.EncodeRegisters(h.registers[r.Address:r.Address+r.Quantity])), nil
+	case pdu.ReadCoilsRequest:
+		return pdu.ReadResponse(req.FunctionCode, pdu.PackBits(h.coils[r.Address:r.Address+r.Quantity])), nil
+	}
+	return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+}
+
+func newPublisher(t *testing.T, h *heatPump, cfg config.MQTTConfig) (*Publisher, *[]message) {
+	t.Helper()
+	tags, err := tag.NewSet([]config.TagConfig{
+		{Name: "flow temperature", SlaveID: 1, Address: "0", Type: "int16", Unit: "°C", Deadband: 5},
+		{Name: "pump", SlaveID: 1, Table: "coil", Address: "5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, _ := tag.NewRegistry(tags)
+	p, err := New("heating", cfg, registry, h.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []message
+	p.send = func(msg message) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	return p, &sent
+}
+
+func values(t *testing.T, msgs []message) map[string]any {
+	t.Helper()
+	got := make(map[string]any)
+	for _, m := range msgs {
+		var doc struct{ Value any }
+		if err := json.Unmarshal(m.payload, &doc); err != nil {
+			t.Fatalf("payload of %s: %v", m.topic, err)
+		}
+		got[m.topic] = doc.Value
+	}
+	return got
+}
+
+func TestPublisher_Poll(t *testing.T) {
+	h := &heatPump{}
+	h.registers[0], h.coils[5] = 35, true
+	p, sent := newPublisher(t, h, config.MQTTConfig{Topic: "home/{gateway}/{tag}", Retain: true, HomeAssistant: true, DiscoveryPrefix: "homeassistant"})
+	p.poll(context.Background())
+
+	if len(*sent) != 4 {
+		t.Fatalf("published %d messages, want 2 announcements and 2 values", len(*sent))
+	}
+	announcements, published := (*sent)[:2], (*sent)[2:]
+	var sensor map[string]any
+	json.Unmarshal(announcements[0].payload, &sensor)
+	if announcements[0].topic != "homeassistant/sensor/modbus_gateway_heating/flow_temperature/config" || !announcements[0].retain ||
+		sensor["state_topic"] != "home/heating/flow temperature" || sensor["unit_of_measurement"] != "°C" {
+		t.Errorf("sensor announcement = %s %s", announcements[0].topic, announcements[0].payload)
+	}
+	if announcements[1].topic != "homeassistant/binary_sensor/modbus_gateway_heating/pump/config" {
+		t.Errorf("coil announced at %s, want a binary sensor", announcements[1].topic)
+	}
+	if got := values(t, published); got["home/heating/flow temperature"] != 35.0 || got["home/heating/pump"] != true || !published[0].retain {
+		t.Errorf("published %v, want the flow temperature and pump state", got)
+	}
+
+	// Announced once, values within their deadband are not published again
+	*sent = nil
+	h.registers[0] = 37
+	p.poll(context.Background())
+	if got := values(t, *sent); len(got) != 1 || got["home/heating/pump"] != true {
+		t.Errorf("published %v on the next poll, want the pump state only", got)
+	}
+}
+
+func TestPublisher_Writes(t *testing.T) {
+	h := &heatPump{}
+	p, sent := newPublisher(t, h, config.MQTTConfig{Topic: "{tag}"})
+	p.poll(context.Background())
+
+	// A write of the flow temperature publishes it, even within its deadband
+	*sent = nil
+	h.registers[0] = 2
+	p.Observe(1, pdu.WriteMultipleRegistersRequest{Address: 0, Values: []uint16{2, 0}}.PDU())
+	p.Observe(2, pdu.WriteSingleRegisterRequest{Address: 0, Value: 1}.PDU())
+	p.Observe(1, pdu.WriteSingleCoilRequest{Address: 6, Value: true}.PDU())
+	p.Observe(1, pdu.ReadCoilsRequest{Address: 5, Quantity: 1}.PDU())
+	for len(p.writes) > 0 {
+		p.refresh(context.Background(), <-p.writes)
+	}
+	if got := values(t, *sent); len(got) != 1 || got["flow temperature"] != 2.0 {
+		t.Errorf("published %v after the writes, want the flow temperature only", got)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	registry, _ := tag.NewRegistry(nil)
+	for _, cfg := range []config.MQTTConfig{{Topic: "{gateway}/values"}, {Topic: "{tag}", QoS: 3}} {
+		if _, err := New("heating", cfg, registry, nil); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package devid caches Read Device Identification (0x2B/0x0E) responses per slave.
+// Masters commonly ask for the identity on every connect, which costs slow serial
+// buses a round trip for data that never changes. The identities collected on the
+// way double as an automatic asset inventory.
+package devid
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// meiReadDeviceID is the MEI type of Read Device Identification.
+const meiReadDeviceID = 0x0E
+
+// objectNames are the basic and regular objects of the specification.
+var objectNames = map[byte]string{
+	0x00: "vendor_name",
+	0x01: "product_code",
+	0x02: "major_minor_revision",
+	0x03: "vendor_url",
+	0x04: "product_name",
+	0x05: "model_name",
+	0x06: "user_application_name",
+}
+
+// Identity is what a slave reported about itself.
+type Identity struct {
+	SlaveID    byte              `json:"slave_id"`
+	Conformity byte              `json:"conformity_level"`
+	Objects    map[string]string `json:"objects"` // By object name, extended objects as "0x80"
+	Updated    time.Time         `json:"updated"`
+}
+
+type entry struct {
+	resp    modbus.ProtocolDataUnit
+	expires time.Time // Zero never expires
+}
+
+// Cache holds identification responses of the slaves behind one gateway instance.
+type Cache struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	responses  map[string]entry
+	identities map[byte]*Identity
+}
+
+// NewCache creates an empty cache.
+func NewCache(cfg config.DeviceIDConfig) *Cache {
+	return &Cache{
+		ttl:        cfg.TTL,
+		responses:  make(map[string]entry),
+		identities: make(map[byte]*Identity),
+	}
+}
+
+// Wrap returns ds with identification requests answered from the cache.
+func (c *Cache) Wrap(ds transport.Downstream) transport.Downstream {
+	return &downstream{Downstream: ds, cache: c}
+}
+
+// Identities returns the collected identities ordered by slave ID.
+func (c *Cache) Identities() []Identity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make([]Identity, 0, len(c.identities))
+	for _, id := range c.identities {
+		objects := make(map[string]string, len(id.Objects))
+		for k, v := range id.Objects {
+			objects[k] = v
+		}
+		ids = append(ids, Identity{SlaveID: id.SlaveID, Conformity: id.Conformity, Objects: objects, Updated: id.Updated})
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].SlaveID < ids[j].SlaveID })
+	return ids
+}
+
+func key(slaveID byte, req modbus.ProtocolDataUnit) string {
+	return fmt.Sprintf("%d/%s", slaveID, hex.EncodeToString(req.Data))
+}
+
+func (c *Cache) lookup(slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.responses[key(slaveID, req)]
+	if !ok || (!e.expires.IsZero() && time.Now().After(e.expires)) {
+		return modbus.ProtocolDataUnit{}, false
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: e.resp.FunctionCode, Data: append([]byte(nil), e.resp.Data...)}, true
+}
+
+// store caches a response and merges its objects into the slave's identity.
+func (c *Cache) store(slaveID byte, req, resp modbus.ProtocolDataUnit) error {
+	conformity, objects, err := parseResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	e := entry{resp: modbus.ProtocolDataUnit{FunctionCode: resp.FunctionCode, Data: append([]byte(nil), resp.Data...)}}
+	if c.ttl > 0 {
+		e.expires = now.Add(c.ttl)
+	}
+	c.responses[key(slaveID, req)] = e
+
+	id, ok := c.identities[slaveID]
+	if !ok {
+		id = &Identity{SlaveID: slaveID, Objects: make(map[string]string)}
+		c.identities[slaveID] = id
+	}
+	id.Conformity = conformity
+	id.Updated = now
+	for objectID, value := range objects {
+		name, ok := objectNames[objectID]
+		if !ok {
+			name = fmt.Sprintf("0x%02X", objectID)
+		}
+		id.Objects[name] = value
+	}
+	return nil
+}
+
+// parseResponse decodes the conformity level and objects of a response:
+// MEI type, read device ID code, conformity level, more follows, next object ID,
+// number of objects, then ID, length and value of each object.
+func parseResponse(resp modbus.ProtocolDataUnit) (byte, map[byte]string, error) {
+	d := resp.Data
+	if len(d) < 6 || d[0] != meiReadDeviceID {
+		return 0, nil, fmt.Errorf("malformed device identification response")
+	}
+	objects := make(map[byte]string, d[5])
+	pos := 6
+	for i := 0; i < int(d[5]); i++ {
+		if pos+2 > len(d) || pos+2+int(d[pos+1]) > len(d) {
+			return 0, nil, fmt.Errorf("truncated device identification object %d", i)
+		}
+		n := int(d[pos+1])
+		objects[d[pos]] = string(d[pos+2 : pos+2+n])
+		pos += 2 + n
+	}
+	return d[2], objects, nil
+}
+
+// downstream answers identification requests from the cache.
+type downstream struct {
+	transport.Downstream
+	cache *Cache
+}
+
+func (d *downstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	// Other requests and broadcasts, which are never answered, pass through
+	if req.FunctionCode != modbus.FuncCodeReadDeviceIdentification || len(req.Data) < 1 || req.Data[0] != meiReadDeviceID || slaveID == 0 {
+		return d.Downstream.Send(ctx, slaveID, req)
+	}
+
+	if resp, ok := d.cache.lookup(slaveID, req); ok {
+		return resp, nil
+	}
+	resp, err := d.Downstream.Send(ctx, slaveID, req)
+	if err != nil || resp.FunctionCode != req.FunctionCode {
+		return resp, err
+	}
+	// A response we can't decode is passed on, but not cached
+	d.cache.store(slaveID, req, resp)
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package devid
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// identityDownstream answers basic device identification and counts requests.
+type identityDownstream struct {
+	sent int
+}
+
+func (d *identityDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.sent++
+	if pdu.FunctionCode != modbus.FuncCodeReadDeviceIdentification {
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0, 0}}, nil
+	}
+	data := []byte{0x0E, 0x01, 0x81, 0x00, 0x00, 0x03}
+	for i, v := range []string{"Acme", "PM-100", "v1." + string('0'+slaveID)} {
+		data = append(append(data, byte(i), byte(len(v))), v...)
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: data}, nil
+}
+
+func (d *identityDownstream) Connect(ctx context.Context) error { return nil }
+func (d *identityDownstream) Close() error                      { return nil }
+
+var basic = modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadDeviceIdentification, Data: []byte{0x0E, 0x01, 0x00}}
+
+func TestCache(t *testing.T) {
+	inner := &identityDownstream{}
+	c := NewCache(config.DeviceIDConfig{Cache: true})
+	ds := c.Wrap(inner)
+	ctx := context.Background()
+
+	first, err := ds.Send(ctx, 1, basic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ds.Send(ctx, 1, basic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.sent != 1 || !bytes.Equal(first.Data, again.Data) {
+		t.Errorf("repeated query reached the device (%d requests) or differs", inner.sent)
+	}
+
+	// Other slaves and other functions aren't served from the cache
+	ds.Send(ctx, 2, basic)
+	ds.Send(ctx, 1, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}})
+	ds.Send(ctx, 1, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}})
+	if inner.sent != 4 {
+		t.Errorf("%d requests reached the device, want 4", inner.sent)
+	}
+
+	ids := c.Identities()
+	if len(ids) != 2 || ids[0].SlaveID != 1 || ids[1].SlaveID != 2 {
+		t.Fatalf("Identities() = %+v", ids)
+	}
+	if got := ids[1].Objects; got["vendor_name"] != "Acme" || got["product_code"] != "PM-100" || got["major_minor_revision"] != "v1.2" {
+		t.Errorf("objects = %v", got)
+	}
+	if ids[0].Conformity != 0x81 {
+		t.Errorf("conformity = 0x%02X, want 0x81", ids[0].Conformity)
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	inner := &identityDownstream{}
+	ds := NewCache(config.DeviceIDConfig{Cache: true, TTL: 10 * time.Millisecond}).Wrap(inner)
+
+	ds.Send(context.Background(), 1, basic)
+	time.Sleep(20 * time.Millisecond)
+	ds.Send(context.Background(), 1, basic)
+	if inner.sent != 2 {
+		t.Errorf("%d requests reached the device, want 2 after expiry", inner.sent)
+	}
+}
+
+func TestParseResponse_Truncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x0E, 0x01},
+		{0x0E, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x05, 'A'},
+		{0x0D, 0x01, 0x01, 0x00, 0x00, 0x00},
+	} {
+		if _, _, err := parseResponse(modbus.ProtocolDataUnit{FunctionCode: 0x2B, Data: data}); err == nil {
+			t.Errorf("parseResponse(% X) succeeded", data)
+		}
+	}
+}
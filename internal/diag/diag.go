@@ -0,0 +1,115 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package diag answers Diagnostics (0x08) requests in the gateway, with counters kept
+// per downstream, so masters can check the health of a bus the way they would ask a
+// serial slave. Return Query Data, Clear Counters and the bus message, communication
+// error and exception counts are answered on behalf of every slave of the downstream,
+// other sub-functions are forwarded to the slave.
+//
+// Requests are counted next to the wire, below queues, caches and breakers, so the
+// counts are those of the requests put on the bus. They are answered in front of all
+// of these, so a master can still ask while the bus is busy or the breaker is open.
+package diag
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Sub-functions of Diagnostics answered by the gateway.
+const (
+	SubReturnQueryData       = 0x00
+	SubClearCounters         = 0x0A
+	SubBusMessageCount       = 0x0B
+	SubBusCommunicationCount = 0x0C // CRC and framing errors
+	SubBusExceptionCount     = 0x0D
+)
+
+// Counters are the diagnostic counters of a downstream. Like those of a device,
+// they roll over at 65535 when reported.
+type Counters struct {
+	messages   atomic.Uint64
+	commErrors atomic.Uint64
+	exceptions atomic.Uint64
+}
+
+// Count returns ds with the requests sent through it counted.
+func (c *Counters) Count(ds transport.Downstream) transport.Downstream {
+	return &counting{Downstream: ds, c: c}
+}
+
+// Answer returns ds with the Diagnostics requests of the gateway answered from c.
+func (c *Counters) Answer(ds transport.Downstream) transport.Downstream {
+	return &answering{Downstream: ds, c: c}
+}
+
+// Clear resets the counters.
+func (c *Counters) Clear() {
+	c.messages.Store(0)
+	c.commErrors.Store(0)
+	c.exceptions.Store(0)
+}
+
+type counting struct {
+	transport.Downstream
+	c *Counters
+}
+
+// Send forwards the request and counts it and its outcome.
+func (d *counting) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.c.messages.Add(1)
+	resp, err := d.Downstream.Send(ctx, slaveID, pdu)
+	switch {
+	case errors.Is(err, modbus.ErrCRC), errors.Is(err, modbus.ErrInvalidFrame):
+		d.c.commErrors.Add(1)
+	case err == nil && resp.FunctionCode&0x80 != 0:
+		d.c.exceptions.Add(1)
+	}
+	return resp, err
+}
+
+type answering struct {
+	transport.Downstream
+	c *Counters
+}
+
+// Send answers the sub-functions of the gateway and forwards every other request.
+func (d *answering) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if pdu.FunctionCode != modbus.FuncCodeDiagnostics || len(pdu.Data) < 2 {
+		return d.Downstream.Send(ctx, slaveID, pdu)
+	}
+	sub := binary.BigEndian.Uint16(pdu.Data)
+	var count *atomic.Uint64
+	switch sub {
+	case SubReturnQueryData:
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: append([]byte(nil), pdu.Data...)}, nil
+	case SubClearCounters, SubBusMessageCount, SubBusCommunicationCount, SubBusExceptionCount:
+	default:
+		return d.Downstream.Send(ctx, slaveID, pdu)
+	}
+	// The data field of the counter sub-functions is 0000
+	if len(pdu.Data) != 4 || pdu.Data[2] != 0 || pdu.Data[3] != 0 {
+		return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: pdu.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalDataValue}
+	}
+
+	switch sub {
+	case SubClearCounters:
+		d.c.Clear()
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: append([]byte(nil), pdu.Data...)}, nil
+	case SubBusMessageCount:
+		count = &d.c.messages
+	case SubBusCommunicationCount:
+		count = &d.c.commErrors
+	case SubBusExceptionCount:
+		count = &d.c.exceptions
+	}
+	data := binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, sub), uint16(count.Load()))
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: data}, nil
+}
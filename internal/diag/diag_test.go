@@ -0,0 +1,89 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package diag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// busDownstream answers reads of slave 1, an exception for slave 2 and a CRC error for
+// slave 3. Diagnostics requests reaching it are answered with a marker.
+type busDownstream struct {
+	sent int
+}
+
+func (d *busDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.sent++
+	switch {
+	case pdu.FunctionCode == modbus.FuncCodeDiagnostics:
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0xDE, 0xAD}}, nil
+	case slaveID == 2:
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode | 0x80, Data: []byte{modbus.ExceptionCodeIllegalDataAddress}}, nil
+	case slaveID == 3:
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("%w: got 0000", modbus.ErrCRC)
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0, 0}}, nil
+}
+
+func (d *busDownstream) Connect(ctx context.Context) error { return nil }
+func (d *busDownstream) Close() error                      { return nil }
+
+func diagnostics(sub uint16, data ...byte) modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeDiagnostics, Data: append([]byte{byte(sub >> 8), byte(sub)}, data...)}
+}
+
+func TestCounters(t *testing.T) {
+	bus := &busDownstream{}
+	c := &Counters{}
+	ds := c.Answer(c.Count(bus))
+	ctx := context.Background()
+
+	read := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+	for _, slaveID := range []byte{1, 1, 2, 3} {
+		ds.Send(ctx, slaveID, read)
+	}
+
+	for _, tt := range []struct {
+		sub  uint16
+		want []byte
+	}{
+		{SubBusMessageCount, []byte{0x00, 0x0B, 0x00, 0x04}},
+		{SubBusCommunicationCount, []byte{0x00, 0x0C, 0x00, 0x01}},
+		{SubBusExceptionCount, []byte{0x00, 0x0D, 0x00, 0x01}},
+	} {
+		if resp, err := ds.Send(ctx, 1, diagnostics(tt.sub, 0, 0)); err != nil || !bytes.Equal(resp.Data, tt.want) {
+			t.Errorf("sub-function %02X = % X, %v, want % X", tt.sub, resp.Data, err, tt.want)
+		}
+	}
+
+	query := diagnostics(SubReturnQueryData, 0xA5, 0x37)
+	if resp, err := ds.Send(ctx, 1, query); err != nil || !bytes.Equal(resp.Data, query.Data) {
+		t.Errorf("Return Query Data = % X, %v, want % X", resp.Data, err, query.Data)
+	}
+	if bus.sent != 4 {
+		t.Errorf("requests on the bus = %d, want 4, diagnostics are answered by the gateway", bus.sent)
+	}
+
+	// Other sub-functions reach the slave, and are counted like any request
+	if resp, err := ds.Send(ctx, 1, diagnostics(0x01, 0, 0)); err != nil || !bytes.Equal(resp.Data, []byte{0xDE, 0xAD}) {
+		t.Errorf("Restart Communications = % X, %v, want it forwarded", resp.Data, err)
+	}
+
+	if _, err := ds.Send(ctx, 1, diagnostics(SubBusMessageCount, 0, 1)); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataValue {
+		t.Errorf("counter with data 0001 error = %v, want Illegal Data Value", err)
+	}
+
+	reset := diagnostics(SubClearCounters, 0, 0)
+	if resp, err := ds.Send(ctx, 1, reset); err != nil || !bytes.Equal(resp.Data, reset.Data) {
+		t.Errorf("Clear Counters = % X, %v, want echo", resp.Data, err)
+	}
+	if resp, _ := ds.Send(ctx, 1, diagnostics(SubBusMessageCount, 0, 0)); !bytes.Equal(resp.Data, []byte{0x00, 0x0B, 0x00, 0x00}) {
+		t.Errorf("bus message count after clearing = % X, want 0", resp.Data)
+	}
+}
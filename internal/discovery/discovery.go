@@ -0,0 +1,143 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package discovery finds the slaves answering on a downstream, to suggest a
+// configuration during commissioning or to create routes at runtime.
+//
+// A slave counts as present when it answers a probe, with data or with an exception:
+// a device rejecting the probed register still exists. Silence and the gateway
+// exceptions of a downstream gateway mean nobody is there.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// probe reads the first holding register, which nearly every device implements or rejects.
+var probe = pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 1}.PDU()
+
+// Answer is the answer of a slave to a probe.
+type Answer struct {
+	Exception *modbus.Error // Of an exception response, nil for data
+	Elapsed   time.Duration // From sending the probe to its answer
+}
+
+// Probe reports whether slaveID answers on ds within timeout.
+// Errors other than a missing answer, e.g. a failed connection, are returned.
+func Probe(ctx context.Context, ds transport.Downstream, slaveID byte, timeout time.Duration) (bool, error) {
+	_, ok, err := ProbeWith(ctx, ds, slaveID, probe, timeout)
+	return ok, err
+}
+
+// ProbeWith is Probe sending req, and returns the answer if slaveID answered.
+func ProbeWith(ctx context.Context, ds transport.Downstream, slaveID byte, req modbus.ProtocolDataUnit, timeout time.Duration) (Answer, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := ds.Send(ctx, slaveID, req)
+	answer := Answer{Elapsed: time.Since(start)}
+	if err == nil {
+		err = pdu.CheckResponse(req.FunctionCode, resp)
+	}
+	switch {
+	case err == nil:
+		return answer, true, nil
+	case errors.As(err, &answer.Exception):
+		code := answer.Exception.ExceptionCode
+		return answer, code != modbus.ExceptionCodeGatewayPathUnavailable && code != modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond, nil
+	case errors.Is(err, modbus.ErrTimeout), errors.Is(err, modbus.ErrCRC), errors.Is(err, modbus.ErrInvalidFrame):
+		// Silence, or a collision with noise on the bus
+		return Answer{}, false, nil
+	default:
+		return Answer{}, false, err
+	}
+}
+
+// Scan probes ids one after the other, as a bus serves one request at a time,
+// and returns those that answered. found is called for each as it is discovered.
+func Scan(ctx context.Context, ds transport.Downstream, ids []byte, timeout time.Duration, found func(byte)) ([]byte, error) {
+	var present []byte
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return present, err
+		}
+		ok, err := Probe(ctx, ds, id, timeout)
+		if err != nil {
+			return present, fmt.Errorf("slave %d: %w", id, err)
+		}
+		if ok {
+			present = append(present, id)
+			if found != nil {
+				found(id)
+			}
+		}
+	}
+	return present, nil
+}
+
+// FormatSlaveIDs formats sorted IDs like the slave_ids option, e.g. "1-3,7".
+func FormatSlaveIDs(ids []byte) string {
+	var parts []string
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] == ids[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, fmt.Sprint(ids[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", ids[i], ids[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// Router is a gateway service that scans a downstream once it is connected and
+// routes the slaves found to it.
+type Router struct {
+	gateway    string
+	downstream string
+	ds         transport.Downstream
+	ids        []byte
+	timeout    time.Duration
+	addRoute   func(slaveID byte, ds transport.Downstream) bool
+}
+
+// NewRouter creates a router probing ids on ds. addRoute adds a route at runtime
+// and reports false if the slave ID is already routed elsewhere.
+func NewRouter(gateway, downstream string, ds transport.Downstream, ids []byte, timeout time.Duration, addRoute func(byte, transport.Downstream) bool) *Router {
+	return &Router{gateway: gateway, downstream: downstream, ds: ds, ids: ids, timeout: timeout, addRoute: addRoute}
+}
+
+// Run scans the downstream once.
+func (r *Router) Run(ctx context.Context) error {
+	slog.Info("Discovering slaves", "gateway", r.gateway, "downstream", r.downstream, "slave_ids", FormatSlaveIDs(r.ids))
+	start := time.Now()
+	found, err := Scan(ctx, r.ds, r.ids, r.timeout, func(id byte) {
+		if !r.addRoute(id, r.ds) {
+			slog.Warn("Discovered slave is already routed elsewhere", "gateway", r.gateway, "downstream", r.downstream, "slave_id", id)
+			return
+		}
+		slog.Info("Discovered slave", "gateway", r.gateway, "downstream", r.downstream, "slave_id", id)
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("discovery on %s: %w", r.downstream, err)
+	}
+	slog.Info("Discovery finished", "gateway", r.gateway, "downstream", r.downstream, "slave_ids", FormatSlaveIDs(found), "elapsed", time.Since(start).Round(time.Millisecond))
+	return nil
+}
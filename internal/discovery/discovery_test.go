@@ -0,0 +1,124 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// bus answers for the slaves in present, with the error in fail for others.
+type bus struct {
+	present map[byte]error
+	fail    error
+}
+
+func (b *bus) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	err, ok := b.present[slaveID]
+	if !ok {
+		return modbus.ProtocolDataUnit{}, b.fail
+	}
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0, 0}}, nil
+}
+
+func (b *bus) Connect(ctx context.Context) error { return nil }
+func (b *bus) Close() error                      { return nil }
+
+func TestScan(t *testing.T) {
+	b := &bus{
+		present: map[byte]error{
+			1: nil,
+			2: &modbus.Error{FunctionCode: 0x83, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress},
+			4: &modbus.Error{FunctionCode: 0x83, ExceptionCode: modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond},
+			5: modbus.ErrCRC,
+		},
+		fail: modbus.ErrTimeout,
+	}
+	var seen []byte
+	got, err := Scan(context.Background(), b, []byte{1, 2, 3, 4, 5, 6}, time.Second, func(id byte) { seen = append(seen, id) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{1, 2}; !bytes.Equal(got, want) || !bytes.Equal(seen, want) {
+		t.Errorf("Scan() = %v, found %v, want %v", got, seen, want)
+	}
+
+	// A broken connection ends the scan
+	b.fail = modbus.ErrConnection
+	if _, err := Scan(context.Background(), b, []byte{1, 3}, time.Second, nil); !errors.Is(err, modbus.ErrConnection) {
+		t.Errorf("Scan() over a broken connection error = %v", err)
+	}
+}
+
+func TestProbeWith(t *testing.T) {
+	b := &bus{
+		present: map[byte]error{1: nil, 2: &modbus.Error{FunctionCode: 0x84, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}},
+		fail:    modbus.ErrTimeout,
+	}
+	req := pdu.ReadInputRegistersRequest{Address: 100, Quantity: 1}.PDU()
+	for _, tt := range []struct {
+		id        byte
+		ok        bool
+		exception byte
+	}{
+		{1, true, 0},
+		{2, true, modbus.ExceptionCodeIllegalDataAddress},
+		{3, false, 0},
+	} {
+		answer, ok, err := ProbeWith(context.Background(), b, tt.id, req, time.Second)
+		if err != nil || ok != tt.ok {
+			t.Errorf("ProbeWith(%d) = %v, %v, want %v", tt.id, ok, err, tt.ok)
+			continue
+		}
+		if got := answer.Exception; (got == nil) != (tt.exception == 0) || (got != nil && got.ExceptionCode != tt.exception) {
+			t.Errorf("ProbeWith(%d) exception = %v, want %d", tt.id, got, tt.exception)
+		}
+	}
+}
+
+func TestFormatSlaveIDs(t *testing.T) {
+	tests := []struct {
+		ids  []byte
+		want string
+	}{
+		{nil, ""},
+		{[]byte{7}, "7"},
+		{[]byte{1, 2, 3, 7}, "1-3,7"},
+		{[]byte{1, 3, 4, 5, 6, 10, 11, 247}, "1,3-6,10-11,247"},
+	}
+	for _, tt := range tests {
+		if got := FormatSlaveIDs(tt.ids); got != tt.want {
+			t.Errorf("FormatSlaveIDs(%v) = %q, want %q", tt.ids, got, tt.want)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	b := &bus{present: map[byte]error{3: nil, 9: nil}, fail: modbus.ErrTimeout}
+	routes := map[byte]transport.Downstream{9: &bus{}}
+	add := func(id byte, ds transport.Downstream) bool {
+		if _, ok := routes[id]; ok {
+			return false
+		}
+		routes[id] = ds
+		return true
+	}
+
+	if err := NewRouter("gw", "bus", b, []byte{1, 2, 3, 9}, time.Second, add).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if routes[3] != b || routes[9] == b || len(routes) != 2 {
+		t.Errorf("routes = %v", routes)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package failover serves the slaves of a downstream from a backup while it fails,
+// such as a hot-standby PLC next to the primary.
+//
+// Requests go to the active member of a group, the primary first. After consecutive
+// timeouts or connection failures the next member takes over, wrapping around after
+// the last backup. While a backup is active, the group probes the primary with a
+// read and switches back once it answers; exception responses count as answers.
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Group is a primary downstream and its backups, answering as one downstream.
+// It is also a gateway service, which probes the primary while failed over.
+type Group struct {
+	members []transport.Downstream
+	names   []string
+	cfg     config.FailoverConfig
+
+	mu       sync.Mutex
+	active   int // Index of the member requests go to
+	failures int // Consecutive, of the active member
+}
+
+// New creates a group of members, the primary first, labeled by names in logs.
+func New(members []transport.Downstream, names []string, cfg config.FailoverConfig) (*Group, error) {
+	if cfg.Function < modbus.FuncCodeReadCoils || cfg.Function > modbus.FuncCodeReadInputRegisters {
+		return nil, fmt.Errorf("failover probe function %d is not a read of coils, inputs or registers", cfg.Function)
+	}
+	return &Group{members: members, names: names, cfg: cfg}, nil
+}
+
+// Active returns the name of the member requests go to.
+func (g *Group) Active() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.names[g.active]
+}
+
+// Send forwards the request to the active member.
+func (g *Group) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	g.mu.Lock()
+	i := g.active
+	g.mu.Unlock()
+	resp, err := g.members[i].Send(ctx, slaveID, req)
+	g.record(ctx, i, err)
+	return resp, err
+}
+
+// record counts the outcome of a request to member i, failing over if it is still active.
+func (g *Group) record(ctx context.Context, i int, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if i != g.active {
+		return
+	}
+	if !failed(err) {
+		g.failures = 0
+		return
+	}
+	g.failures++
+	if g.failures >= g.cfg.Failures && len(g.members) > 1 {
+		g.active = (i + 1) % len(g.members)
+		g.failures = 0
+		transport.Logger(ctx).Warn("Failing over", "from", g.names[i], "to", g.names[g.active], "err", err)
+	}
+}
+
+// failed reports whether err shows the downstream unreachable.
+func failed(err error) bool {
+	return errors.Is(err, modbus.ErrTimeout) || errors.Is(err, modbus.ErrConnection) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Connect connects all members, so backups are ready to take over.
+func (g *Group) Connect(ctx context.Context) error {
+	var errs []error
+	for i, m := range g.members {
+		if err := m.Connect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", g.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all members.
+func (g *Group) Close() error {
+	var errs []error
+	for _, m := range g.members {
+		errs = append(errs, m.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Run probes the primary while a backup is active, until ctx is cancelled.
+func (g *Group) Run(ctx context.Context) error {
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			g.probe(ctx)
+		}
+	}
+}
+
+// probe reads from the primary if it isn't active, and falls back to it if it answers.
+func (g *Group) probe(ctx context.Context) {
+	g.mu.Lock()
+	active := g.active
+	g.mu.Unlock()
+	if active == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.Interval)
+	defer cancel()
+	req := modbus.ProtocolDataUnit{FunctionCode: g.cfg.Function, Data: []byte{byte(g.cfg.Address >> 8), byte(g.cfg.Address), 0, 1}}
+	if _, err := g.members[0].Send(ctx, g.cfg.SlaveID, req); err != nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	transport.Logger(ctx).Info("Primary recovered, falling back", "from", g.names[g.active], "to", g.names[0])
+	g.active = 0
+	g.failures = 0
+}
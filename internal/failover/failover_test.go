@@ -0,0 +1,89 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package failover
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// device answers with its marker, or fails with err.
+type device struct {
+	marker byte
+	err    error
+	sent   []modbus.ProtocolDataUnit
+}
+
+func (d *device) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.sent = append(d.sent, pdu)
+	if d.err != nil {
+		return modbus.ProtocolDataUnit{}, d.err
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, d.marker}}, nil
+}
+
+func (d *device) Connect(ctx context.Context) error { return nil }
+func (d *device) Close() error                      { return nil }
+
+var readRequest = modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+
+func TestGroup(t *testing.T) {
+	primary, backup := &device{marker: 1, err: modbus.ErrTimeout}, &device{marker: 2}
+	g, err := New([]transport.Downstream{primary, backup}, []string{"primary", "backup"},
+		config.FailoverConfig{Failures: 2, Interval: time.Second, SlaveID: 1, Function: 0x04, Address: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	send := func() (byte, error) {
+		resp, err := g.Send(ctx, 1, readRequest)
+		if err != nil {
+			return 0, err
+		}
+		return resp.Data[2], nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := send(); !errors.Is(err, modbus.ErrTimeout) {
+			t.Fatalf("request %d error = %v", i, err)
+		}
+	}
+	if marker, err := send(); err != nil || marker != 2 || g.Active() != "backup" {
+		t.Fatalf("request after 2 failures answered by %d, %v, active %s, want the backup", marker, err, g.Active())
+	}
+
+	// Probes read the configured input register, and keep the backup while the primary fails
+	g.probe(ctx)
+	if g.Active() != "backup" {
+		t.Fatal("fell back to a failing primary")
+	}
+	if probe := primary.sent[len(primary.sent)-1]; probe.FunctionCode != 0x04 || probe.Data[0] != 0 || probe.Data[1] != 100 {
+		t.Errorf("probe = %02X % X, want a read of input register 100", probe.FunctionCode, probe.Data)
+	}
+
+	primary.err = nil
+	g.probe(ctx)
+	if marker, err := send(); err != nil || marker != 1 || g.Active() != "primary" {
+		t.Errorf("request after recovery answered by %d, %v, active %s, want the primary", marker, err, g.Active())
+	}
+}
+
+func TestGroup_Exceptions(t *testing.T) {
+	primary := &device{err: &modbus.Error{FunctionCode: 0x83, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}}
+	g, _ := New([]transport.Downstream{primary, &device{}}, []string{"primary", "backup"}, config.FailoverConfig{Failures: 1, Function: 0x03})
+	g.Send(context.Background(), 1, readRequest)
+	if g.Active() != "primary" {
+		t.Error("failed over on an exception")
+	}
+
+	if _, err := New(nil, nil, config.FailoverConfig{Function: 0x06}); err == nil {
+		t.Error("New() with a write as probe succeeded")
+	}
+}
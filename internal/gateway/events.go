@@ -0,0 +1,53 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package gateway
+
+import (
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// Types of events
+const (
+	EventRequest    = "request"    // A request was handled, answered or failed
+	EventUpstream   = "upstream"   // An upstream started or stopped listening
+	EventDownstream = "downstream" // The connection of a supervised downstream went up or down
+)
+
+// Event is something that happened in a gateway, see Gateway.Events.
+type Event struct {
+	Type    string
+	Time    time.Time
+	Gateway string
+
+	// Upstream the request came from, "service" for requests of services, or the
+	// upstream that started or stopped listening
+	Upstream string
+	// Downstream the request was routed to, empty if none, or whose connection changed
+	Downstream string
+
+	// Requests only
+	SlaveID  byte
+	Request  modbus.ProtocolDataUnit
+	Response modbus.ProtocolDataUnit // Empty if the request failed
+	Duration time.Duration
+
+	Up  bool  // Whether the upstream listens or the downstream is connected
+	Err error // Why the request failed or the connection went down
+}
+
+// Emit passes ev to the Events callback, if any, stamped with the gateway and the
+// current time.
+func (g *Gateway) Emit(ev Event) {
+	if g == nil || g.Events == nil {
+		return
+	}
+	ev.Gateway = g.Name
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	g.Events(ev)
+}
@@ -8,15 +8,28 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ffutop/modbus-gateway/internal/acl"
+	"github.com/ffutop/modbus-gateway/internal/audit"
+	"github.com/ffutop/modbus-gateway/internal/breaker"
+	"github.com/ffutop/modbus-gateway/internal/capture"
+	"github.com/ffutop/modbus-gateway/internal/devid"
+	"github.com/ffutop/modbus-gateway/internal/probe"
+	"github.com/ffutop/modbus-gateway/internal/stats"
+	"github.com/ffutop/modbus-gateway/internal/tag"
 	"github.com/ffutop/modbus-gateway/modbus"
+	mbpdu "github.com/ffutop/modbus-gateway/modbus/pdu"
 	"github.com/ffutop/modbus-gateway/transport"
 )
 
+// defaultTimeout bounds requests to downstreams without a timeout of their own.
+const defaultTimeout = 2 * time.Second
+
 // Gateway represents a single gateway instance.
 // It bridges multiple Upstreams (Masters) to multiple Downstreams (Slaves) using routing.
 type Gateway struct {
@@ -24,6 +37,56 @@ type Gateway struct {
 	Upstreams    []transport.Upstream
 	Routes       map[byte]transport.Downstream
 	DefaultRoute transport.Downstream
+	Services     []Service
+	DeviceIDs    *devid.Cache // Identities of the slaves, nil unless caching is enabled
+	Stats        *stats.Recorder
+	Trace        *stats.Trace      // Last transactions, nil unless the dashboard is enabled
+	WriteACL     *acl.WriteACL     // Writes allowed to network masters, nil allows all
+	Audit        *audit.Trail      // Trail of writes, nil unless configured
+	Tags         *tag.Registry     // Named points, labeling the values of requests in debug logs; nil if none
+	TraceFrames  bool              // Log every ADU of the upstreams and downstreams in hex
+	Capture      *capture.Recorder // Records the ADUs while enabled, nil unless configured
+	Tracer       transport.Tracer  // Records the spans of requests, nil unless tracing is configured
+
+	// Events is called with the requests handled and the state changes of the
+	// upstreams and downstreams, nil if nothing listens. It must not block.
+	Events func(Event)
+
+	// Middlewares wrap the forwarding of requests that passed the checks of the
+	// gateway, the first seeing requests first. Set before the gateway starts.
+	Middlewares []transport.Middleware
+
+	// Labels of the upstreams by index, e.g. their listen address, and of the
+	// downstreams, for logs and reports. Unlabeled upstreams go by their index.
+	UpstreamNames   []string
+	DownstreamNames map[transport.Downstream]string
+
+	// Time a request to each downstream may take, including its retries, default 2s
+	Timeouts map[transport.Downstream]time.Duration
+
+	// Breakers of the downstreams by name, and of those the gateway can't serve without
+	Breakers map[string]*breaker.Downstream
+	Required map[string]*breaker.Downstream
+
+	// Probes of the downstreams by name, the gateway is unready until one of them answers
+	Probes map[string]*probe.Prober
+
+	// Downstreams whose storage may drop writes by name, such as local slaves
+	Persisted map[string]transport.Persisted
+
+	mu        sync.RWMutex           // Guards Routes once started, and listening
+	attached  []transport.Downstream // Downstreams without static routes
+	listening map[int]bool           // Upstreams accepting requests, by index
+	watchers  []func(slaveID byte, req modbus.ProtocolDataUnit)
+
+	chainOnce sync.Once
+	chain     transport.RequestHandler // forward wrapped in the middlewares
+}
+
+// Service is a background task bound to the gateway lifecycle, such as a cloud connector.
+// It is started once the downstreams are connected and must return when ctx is cancelled.
+type Service interface {
+	Run(ctx context.Context) error
 }
 
 // NewGateway creates a new Gateway instance
@@ -33,9 +96,55 @@ func NewGateway(name string, upstreams []transport.Upstream, routes map[byte]tra
 		Upstreams:    upstreams,
 		Routes:       routes,
 		DefaultRoute: defaultRoute,
+		Stats:        stats.NewRecorder(),
 	}
 }
 
+// AddService registers a background service to run alongside the gateway.
+func (g *Gateway) AddService(svc Service) {
+	g.Services = append(g.Services, svc)
+}
+
+// Attach adds a downstream that has no routes yet, such as one whose routes are
+// discovered at runtime. It is connected and closed along with the routed ones.
+func (g *Gateway) Attach(ds transport.Downstream) {
+	g.attached = append(g.attached, ds)
+}
+
+// Watch calls fn after every write the gateway forwarded successfully, with the
+// request of the master, e.g. to publish the values it changed. fn must not block.
+// Watchers are added before the gateway starts.
+func (g *Gateway) Watch(fn func(slaveID byte, req modbus.ProtocolDataUnit)) {
+	g.watchers = append(g.watchers, fn)
+}
+
+// AddRoute routes slaveID to ds while the gateway is running. It reports false
+// and leaves the route alone if slaveID is already routed.
+func (g *Gateway) AddRoute(slaveID byte, ds transport.Downstream) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, exists := g.Routes[slaveID]; exists {
+		return false
+	}
+	if g.Routes == nil {
+		g.Routes = make(map[byte]transport.Downstream)
+	}
+	g.Routes[slaveID] = ds
+	return true
+}
+
+// Handle dispatches a request through the routing table.
+// It lets services inside the process issue requests as if they were an upstream master.
+func (g *Gateway) Handle(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	return g.handleRequest(ctx, slaveID, pdu)
+}
+
+// AllSlaveIDs reports whether slave IDs as configured are "*", routing all slave IDs
+// no other downstream serves.
+func AllSlaveIDs(input string) bool {
+	return strings.TrimSpace(input) == "*"
+}
+
 // ParseSlaveIDs parses a string of slave IDs (e.g. "1,2,5-10") into a slice of bytes.
 func ParseSlaveIDs(input string) ([]byte, error) {
 	var ids []byte
@@ -87,33 +196,63 @@ func ParseSlaveIDs(input string) ([]byte, error) {
 func (g *Gateway) Start(ctx context.Context) error {
 	// Connect Downstreams (Unique instances)
 	uniqueDownstreams := make(map[transport.Downstream]struct{})
+	g.mu.RLock()
 	for _, ds := range g.Routes {
 		uniqueDownstreams[ds] = struct{}{}
 	}
+	g.mu.RUnlock()
+	for _, ds := range g.attached {
+		uniqueDownstreams[ds] = struct{}{}
+	}
 	if g.DefaultRoute != nil {
 		uniqueDownstreams[g.DefaultRoute] = struct{}{}
 	}
 
 	for ds := range uniqueDownstreams {
 		if err := ds.Connect(ctx); err != nil {
-			slog.Error("Failed to connect downstream", "gateway", g.Name, "err", err)
+			slog.Error("Failed to connect downstream", "gateway", g.Name, "downstream", g.DownstreamNames[ds], "err", err)
 			// We might continue even if downstream fails initially, it might recover
 		}
 	}
 
+	if g.TraceFrames {
+		ctx = transport.WithFrameTrace(ctx)
+	}
+	if g.Capture != nil {
+		ctx = transport.WithFrameSink(ctx, g.Capture)
+	}
+	if g.Tracer != nil {
+		ctx = transport.WithTracer(ctx, g.Tracer)
+	}
+
 	// Start Upstreams
 	var wg sync.WaitGroup
 	for i, us := range g.Upstreams {
 		wg.Add(1)
 		go func(ups transport.Upstream, idx int) {
 			defer wg.Done()
-			slog.Info("Starting upstream", "gateway", g.Name, "index", idx)
-			if err := ups.Start(ctx, g.handleRequest); err != nil {
-				slog.Error("Upstream stopped with error", "gateway", g.Name, "index", idx, "err", err)
+			name := g.upstreamName(idx)
+			log := slog.With("gateway", g.Name, "upstream", name)
+			log.Info("Starting upstream", "index", idx)
+			uctx := transport.WithListening(transport.WithLogger(transport.WithUpstream(ctx, name), log), func() { g.setListening(idx, true) })
+			if err := ups.Start(uctx, g.handleRequest); err != nil {
+				log.Error("Upstream stopped with error", "index", idx, "err", err)
 			}
+			g.setListening(idx, false)
 		}(us, i)
 	}
 
+	// Start Services
+	for _, svc := range g.Services {
+		wg.Add(1)
+		go func(svc Service) {
+			defer wg.Done()
+			if err := svc.Run(transport.WithLogger(ctx, slog.With("gateway", g.Name))); err != nil {
+				slog.Error("Service stopped with error", "gateway", g.Name, "err", err)
+			}
+		}(svc)
+	}
+
 	<-ctx.Done()
 
 	// Graceful shutdown
@@ -128,30 +267,184 @@ func (g *Gateway) Start(ctx context.Context) error {
 	return nil
 }
 
+// RouteNames returns the name of the downstream each slave ID is routed to, and that
+// of the default route, empty if there is none.
+func (g *Gateway) RouteNames() (map[byte]string, string) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	names := make(map[byte]string, len(g.Routes))
+	for id, ds := range g.Routes {
+		names[id] = g.DownstreamNames[ds]
+	}
+	if g.DefaultRoute == nil {
+		return names, ""
+	}
+	return names, g.DownstreamNames[g.DefaultRoute]
+}
+
+func (g *Gateway) setListening(idx int, on bool) {
+	g.mu.Lock()
+	if g.listening == nil {
+		g.listening = make(map[int]bool)
+	}
+	changed := g.listening[idx] != on
+	g.listening[idx] = on
+	g.mu.Unlock()
+	if changed {
+		g.Emit(Event{Type: EventUpstream, Upstream: g.upstreamName(idx), Up: on})
+	}
+}
+
+// Listening reports by label whether each upstream accepts requests. Upstreams are
+// not listening until started, and after failing to bind.
+func (g *Gateway) Listening() map[string]bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	states := make(map[string]bool, len(g.Upstreams))
+	for i := range g.Upstreams {
+		states[g.upstreamName(i)] = g.listening[i]
+	}
+	return states
+}
+
+// Unready returns what keeps the gateway from serving, sorted: the upstreams not
+// listening, the required downstreams whose breaker is open, and the probed
+// downstreams if none of them answers.
+func (g *Gateway) Unready() []string {
+	var down []string
+	for name, on := range g.Listening() {
+		if !on {
+			down = append(down, name)
+		}
+	}
+	for name, b := range g.Required {
+		if b.Open() {
+			down = append(down, name)
+		}
+	}
+	var probed []string
+	for name, p := range g.Probes {
+		if state, _, _ := p.State(); state == probe.StateUp {
+			probed = nil
+			break
+		}
+		probed = append(probed, name)
+	}
+	down = append(down, probed...)
+	sort.Strings(down)
+	return down
+}
+
+// upstreamName labels the upstream at idx.
+func (g *Gateway) upstreamName(idx int) string {
+	if idx < len(g.UpstreamNames) && g.UpstreamNames[idx] != "" {
+		return g.UpstreamNames[idx]
+	}
+	return strconv.Itoa(idx)
+}
+
 // handleRequest is the central dispatch function
-func (g *Gateway) handleRequest(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+func (g *Gateway) handleRequest(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (resp modbus.ProtocolDataUnit, err error) {
+	start := time.Now()
+	route := stats.Route{Upstream: transport.UpstreamFromContext(ctx), SlaveID: slaveID}
+	if route.Upstream == "" {
+		route.Upstream = "service"
+	}
+	ctx = transport.TraceRequest(ctx) // Requests of services
+	ctx, span := transport.StartSpan(ctx, transport.SpanRoute, append(transport.SpanAttrs(slaveID, pdu, -1),
+		slog.String("modbus.gateway", g.Name), slog.String("modbus.upstream", route.Upstream))...)
+	log := slog.With("gateway", g.Name, "upstream", route.Upstream, "slaveID", slaveID)
+	defer func() {
+		// Writes are audited as the master sent them, denied and failed ones too
+		if aerr := g.Audit.Observe(ctx, g.Name, slaveID, pdu, resp, err); aerr != nil {
+			log.Error("Failed to write audit trail", "err", aerr)
+		}
+		g.Stats.Observe(route, time.Since(start), resp, err)
+		g.Trace.Add(route, start, time.Since(start), pdu, resp, err)
+		transport.EndSpan(span, resp, err)
+		g.Emit(Event{Type: EventRequest, Time: start, Upstream: route.Upstream, Downstream: route.Downstream,
+			SlaveID: slaveID, Request: pdu, Response: resp, Duration: time.Since(start), Err: err})
+	}()
+
+	// Sanity Check, malformed requests never reach the slaves
+	if err := mbpdu.Validate(pdu); err != nil {
+		log.Warn("Malformed request rejected", "func", pdu.FunctionCode, "length", len(pdu.Data))
+		return modbus.ProtocolDataUnit{}, err
+	}
+
+	// Access Control
+	if w, ok := g.WriteACL.Allows(ctx, slaveID, pdu); !ok {
+		log.Warn("Write denied", "audit", "write_denied", "client", transport.ClientFromContext(ctx).String(),
+			"identity", transport.IdentityFromContext(ctx), "func", pdu.FunctionCode, "address", w.Address, "quantity", w.Quantity)
+		return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: pdu.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+	}
+
+	// Middlewares, then routing
+	g.chainOnce.Do(func() { g.chain = transport.Chain(g.forward, g.Middlewares...) })
+	return g.chain(context.WithValue(ctx, routeKey{}, &route), slaveID, pdu)
+}
+
+type routeKey struct{}
+
+// forward routes a request to its downstream, noting which in the route of ctx.
+func (g *Gateway) forward(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	route, ok := ctx.Value(routeKey{}).(*stats.Route)
+	if !ok {
+		route = &stats.Route{Upstream: "service"}
+	}
+	log := slog.With("gateway", g.Name, "upstream", route.Upstream, "slaveID", slaveID)
+
 	// Route Lookup
 	var target transport.Downstream
-	if ds, ok := g.Routes[slaveID]; ok {
+	g.mu.RLock()
+	ds, ok := g.Routes[slaveID]
+	g.mu.RUnlock()
+	if ok {
 		target = ds
 	} else if g.DefaultRoute != nil {
 		target = g.DefaultRoute
 	} else {
 		// No route found
-		slog.Warn("No route found for slave ID", "gateway", g.Name, "slaveID", slaveID)
-		return modbus.ProtocolDataUnit{}, fmt.Errorf("gateway path unavailable")
+		log.Warn("No route found for slave ID")
+		return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: pdu.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeGatewayPathUnavailable}
 	}
 
+	route.Downstream = g.DownstreamNames[target]
+	log = log.With("downstream", route.Downstream)
+	transport.SpanFromContext(ctx).SetAttributes(slog.String("modbus.downstream", route.Downstream))
+
 	// Forward to Downstream
-	// Note: We might want to add a timeout here if the upstream doesn't provide one via context
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second) // Safety timeout
+	timeout, ok := g.Timeouts[target]
+	if !ok {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(transport.WithLogger(ctx, log), timeout)
 	defer cancel()
 
 	respPdu, err := target.Send(ctx, slaveID, pdu)
 	if err != nil {
-		slog.Error("Downstream request failed", "gateway", g.Name, "slaveID", slaveID, "func", pdu.FunctionCode, "err", err)
+		log.Error("Downstream request failed", "func", pdu.FunctionCode, "err", err)
+		return modbus.ProtocolDataUnit{}, err
+	}
+
+	// Completeness Check, truncated or padded responses are answered with Server Device Failure
+	if err := mbpdu.ValidateResponse(pdu, respPdu); err != nil {
+		log.Error("Incomplete response from downstream", "func", pdu.FunctionCode, "err", err)
 		return modbus.ProtocolDataUnit{}, err
 	}
 
+	if g.Tags != nil && log.Enabled(ctx, slog.LevelDebug) {
+		if values := tag.Label(g.Tags.Tags(), slaveID, pdu, respPdu); values != "" {
+			log.Debug("Request served", "func", pdu.FunctionCode, "values", values)
+		}
+	}
+
+	switch pdu.FunctionCode {
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeWriteMultipleCoils,
+		modbus.FuncCodeWriteMultipleRegisters, modbus.FuncCodeMaskWriteRegister, modbus.FuncCodeReadWriteMultipleRegisters:
+		for _, fn := range g.watchers {
+			fn(slaveID, pdu)
+		}
+	}
 	return respPdu, nil
 }
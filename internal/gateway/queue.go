@@ -0,0 +1,61 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Queue bounds the requests waiting for a downstream. Up to Concurrency requests are
+// sent at once, up to Depth more wait their turn in arrival order, and requests beyond
+// that are answered with Server Device Busy right away, so a slow device doesn't hold
+// masters until they time out.
+type Queue struct {
+	transport.Downstream
+	depth    int
+	admitted chan struct{} // Held by the requests in flight and those waiting
+	slots    chan struct{} // Held by the requests in flight
+}
+
+// NewQueue returns ds behind a queue, or ds unchanged if cfg has no depth.
+func NewQueue(ds transport.Downstream, cfg config.QueueConfig) (transport.Downstream, error) {
+	if cfg.Depth < 0 || cfg.Concurrency < 0 {
+		return nil, fmt.Errorf("invalid queue depth %d with concurrency %d", cfg.Depth, cfg.Concurrency)
+	}
+	if cfg.Depth == 0 {
+		return ds, nil
+	}
+	concurrency := max(cfg.Concurrency, 1)
+	return &Queue{
+		Downstream: ds,
+		depth:      cfg.Depth,
+		admitted:   make(chan struct{}, concurrency+cfg.Depth),
+		slots:      make(chan struct{}, concurrency),
+	}, nil
+}
+
+// Send forwards the request once it is its turn, or refuses it if the queue is full.
+func (q *Queue) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	select {
+	case q.admitted <- struct{}{}:
+	default:
+		transport.Logger(ctx).Warn("Downstream queue full", "slaveID", slaveID, "func", req.FunctionCode, "depth", q.depth)
+		return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeServerDeviceBusy}
+	}
+	defer func() { <-q.admitted }()
+
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return modbus.ProtocolDataUnit{}, ctx.Err()
+	}
+	defer func() { <-q.slots }()
+	return q.Downstream.Send(ctx, slaveID, req)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package gateway
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// blockingDownstream answers requests once release is closed, counting those in flight.
+type blockingDownstream struct {
+	release  chan struct{}
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (b *blockingDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	n := b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	for {
+		peak := b.peak.Load()
+		if n <= peak || b.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	<-b.release
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, 0x01}}, nil
+}
+
+func (b *blockingDownstream) Connect(ctx context.Context) error { return nil }
+func (b *blockingDownstream) Close() error                      { return nil }
+
+func TestQueue(t *testing.T) {
+	b := &blockingDownstream{release: make(chan struct{})}
+	ds, err := NewQueue(b, config.QueueConfig{Depth: 2, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("NewQueue() error = %v", err)
+	}
+	req := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+
+	// Two requests in flight and two waiting fill the queue
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := ds.Send(context.Background(), 1, req)
+			errs <- err
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for (len(ds.(*Queue).admitted) < 4 || b.inFlight.Load() < 2) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := ds.Send(context.Background(), 1, req); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeServerDeviceBusy {
+		t.Errorf("Send() to full queue error = %v, want Server Device Busy", err)
+	}
+	if peak := b.peak.Load(); peak != 2 {
+		t.Errorf("%d requests in flight at once, want 2", peak)
+	}
+
+	// A waiting request gives up with its context
+	waiting, _ := NewQueue(b, config.QueueConfig{Depth: 1})
+	go waiting.Send(context.Background(), 1, req)
+	for b.inFlight.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := waiting.Send(ctx, 1, req); err != context.DeadlineExceeded {
+		t.Errorf("Send() of waiting request error = %v, want deadline exceeded", err)
+	}
+
+	close(b.release)
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Send() error = %v", err)
+		}
+	}
+
+	if ds, _ := NewQueue(b, config.QueueConfig{}); ds != b {
+		t.Error("NewQueue() without depth wrapped the downstream")
+	}
+	if _, err := NewQueue(b, config.QueueConfig{Depth: -1}); err == nil {
+		t.Error("NewQueue() accepted a negative depth")
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package loadgen generates synthetic requests against a gateway's own routes,
+// so a configuration's headroom can be validated before cutover.
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	engine "github.com/ffutop/modbus-gateway/internal/gateway"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// pattern is a parsed LoadPatternConfig.
+type pattern struct {
+	slaveIDs     []byte
+	functionCode byte
+	address      uint16
+	span         uint16
+	count        uint16
+	value        uint16
+	weight       int
+}
+
+// request builds a request of the pattern at the given offset from its address.
+func (p pattern) request(offset uint16) pdu.Request {
+	addr := p.address + offset
+	switch p.functionCode {
+	case modbus.FuncCodeReadCoils:
+		return pdu.ReadCoilsRequest{Address: addr, Quantity: p.count}
+	case modbus.FuncCodeReadDiscreteInputs:
+		return pdu.ReadDiscreteInputsRequest{Address: addr, Quantity: p.count}
+	case modbus.FuncCodeReadHoldingRegisters:
+		return pdu.ReadHoldingRegistersRequest{Address: addr, Quantity: p.count}
+	case modbus.FuncCodeReadInputRegisters:
+		return pdu.ReadInputRegistersRequest{Address: addr, Quantity: p.count}
+	case modbus.FuncCodeWriteSingleCoil:
+		return pdu.WriteSingleCoilRequest{Address: addr, Value: p.value != 0}
+	case modbus.FuncCodeWriteSingleRegister:
+		return pdu.WriteSingleRegisterRequest{Address: addr, Value: p.value}
+	case modbus.FuncCodeWriteMultipleCoils:
+		values := make([]bool, p.count)
+		for i := range values {
+			values[i] = p.value != 0
+		}
+		return pdu.WriteMultipleCoilsRequest{Address: addr, Values: values}
+	default:
+		values := make([]uint16, p.count)
+		for i := range values {
+			values[i] = p.value
+		}
+		return pdu.WriteMultipleRegistersRequest{Address: addr, Values: values}
+	}
+}
+
+// Generator implements gateway.Service, sending requests at a fixed rate through the gateway's handler.
+type Generator struct {
+	gateway  string
+	cfg      config.LoadGenConfig
+	handler  transport.RequestHandler
+	patterns []pattern
+	weights  int
+
+	mu    sync.Mutex
+	stats stats
+}
+
+// New creates a load generator for a gateway.
+func New(gateway string, cfg config.LoadGenConfig, handler transport.RequestHandler) (*Generator, error) {
+	if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive")
+	}
+	// Faster rates round the tick period down to zero
+	if cfg.Rate > 1e9 {
+		return nil, fmt.Errorf("rate exceeds 1e9 requests per second")
+	}
+	if cfg.Concurrency <= 0 {
+		return nil, fmt.Errorf("concurrency must be positive")
+	}
+	if cfg.ReportInterval <= 0 {
+		return nil, fmt.Errorf("report_interval must be positive")
+	}
+	if len(cfg.Patterns) == 0 {
+		return nil, fmt.Errorf("no patterns configured")
+	}
+
+	g := &Generator{gateway: gateway, cfg: cfg, handler: handler}
+	for i, pc := range cfg.Patterns {
+		p, err := newPattern(pc)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d: %w", i+1, err)
+		}
+		g.patterns = append(g.patterns, p)
+		g.weights += p.weight
+	}
+	return g, nil
+}
+
+func newPattern(pc config.LoadPatternConfig) (pattern, error) {
+	ids, err := engine.ParseSlaveIDs(pc.SlaveIDs)
+	if err != nil {
+		return pattern{}, err
+	}
+	if len(ids) == 0 {
+		return pattern{}, fmt.Errorf("slave_ids is required")
+	}
+	// The function code selects the table, a Modicon reference only contributes its address
+	_, addr, err := tag.ParseAddress("", pc.Address)
+	if err != nil {
+		return pattern{}, err
+	}
+	if pc.Weight < 0 {
+		return pattern{}, fmt.Errorf("negative weight")
+	}
+
+	p := pattern{
+		slaveIDs:     ids,
+		functionCode: pc.FunctionCode,
+		address:      addr,
+		span:         pc.Span,
+		count:        pc.Count,
+		value:        pc.Value,
+		weight:       pc.Weight,
+	}
+	if int(addr)+int(pc.Span)+int(pc.Count) > 0x10000 {
+		return pattern{}, fmt.Errorf("address range exceeds 65535")
+	}
+	switch pc.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters,
+		modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister,
+		modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters:
+	default:
+		return pattern{}, fmt.Errorf("unsupported function code %d", pc.FunctionCode)
+	}
+	// Let the parser check the quantity limits of the function code
+	if _, err := pdu.ParseRequest(p.request(0).PDU()); err != nil {
+		return pattern{}, fmt.Errorf("count %d out of range for function code %d", pc.Count, pc.FunctionCode)
+	}
+	return p, nil
+}
+
+// Run generates requests until the configured duration has elapsed or ctx is cancelled.
+func (g *Generator) Run(ctx context.Context) error {
+	if g.cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.cfg.Duration)
+		defer cancel()
+	}
+	slog.Info("Load generation started", "gateway", g.gateway, "rate", g.cfg.Rate, "duration", g.cfg.Duration, "concurrency", g.cfg.Concurrency)
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	slots := make(chan struct{}, g.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / g.cfg.Rate))
+	defer ticker.Stop()
+	report := time.NewTicker(g.cfg.ReportInterval)
+	defer report.Stop()
+
+	start := time.Now()
+	total := stats{}
+	window := start
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			total.add(g.flush())
+			total.log(g.gateway, "Load generation finished", time.Since(start))
+			return nil
+		case <-report.C:
+			s := g.flush()
+			s.log(g.gateway, "Load generation progress", time.Since(window))
+			total.add(s)
+			window = time.Now()
+		case <-ticker.C:
+			select {
+			case slots <- struct{}{}:
+			default:
+				// All slots busy, the routes can't keep up with the rate
+				g.record(0, nil, true)
+				continue
+			}
+			p := g.pick(rng)
+			slaveID := p.slaveIDs[rng.Intn(len(p.slaveIDs))]
+			var offset uint16
+			if p.span > 0 {
+				offset = uint16(rng.Intn(int(p.span)))
+			}
+			req := p.request(offset).PDU()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				begin := time.Now()
+				resp, err := g.handler(ctx, slaveID, req)
+				if err == nil {
+					err = pdu.CheckResponse(req.FunctionCode, resp)
+				}
+				if ctx.Err() == nil {
+					g.record(time.Since(begin), err, false)
+				}
+			}()
+		}
+	}
+}
+
+func (g *Generator) pick(rng *rand.Rand) pattern {
+	n := rng.Intn(g.weights)
+	for _, p := range g.patterns {
+		if n < p.weight {
+			return p
+		}
+		n -= p.weight
+	}
+	return g.patterns[len(g.patterns)-1]
+}
+
+func (g *Generator) record(latency time.Duration, err error, missed bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case missed:
+		g.stats.missed++
+	case err != nil:
+		if g.stats.errors == nil {
+			g.stats.errors = make(map[string]int)
+		}
+		g.stats.errors[modbus.Classify(err)]++
+	default:
+		g.stats.latencies = append(g.stats.latencies, latency)
+	}
+}
+
+// flush returns the statistics since the last flush.
+func (g *Generator) flush() stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.stats
+	g.stats = stats{}
+	return s
+}
+
+// stats are the outcomes of generated requests.
+type stats struct {
+	latencies []time.Duration // of successful requests
+	errors    map[string]int  // by class
+	missed    int             // ticks skipped because all slots were busy
+}
+
+func (s *stats) add(o stats) {
+	s.latencies = append(s.latencies, o.latencies...)
+	s.missed += o.missed
+	for class, n := range o.errors {
+		if s.errors == nil {
+			s.errors = make(map[string]int)
+		}
+		s.errors[class] += n
+	}
+}
+
+func (s *stats) failed() int {
+	var n int
+	for _, c := range s.errors {
+		n += c
+	}
+	return n
+}
+
+func (s *stats) log(gateway, msg string, elapsed time.Duration) {
+	attrs := []any{
+		"gateway", gateway,
+		"ok", len(s.latencies),
+		"failed", s.failed(),
+		"missed", s.missed,
+		"rate", fmt.Sprintf("%.1f/s", float64(len(s.latencies))/elapsed.Seconds()),
+	}
+	if len(s.latencies) > 0 {
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+		attrs = append(attrs, "p50", s.percentile(50), "p99", s.percentile(99), "max", s.latencies[len(s.latencies)-1])
+	}
+	for class, n := range s.errors {
+		attrs = append(attrs, "err_"+class, n)
+	}
+	slog.Info(msg, attrs...)
+}
+
+// percentile expects the latencies to be sorted.
+func (s *stats) percentile(p int) time.Duration {
+	i := (len(s.latencies)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return s.latencies[i]
+}
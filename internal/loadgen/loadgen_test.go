@@ -0,0 +1,97 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package loadgen
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+func TestGenerator_Run(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[byte]int)
+	)
+	handler := func(ctx context.Context, slaveID byte, p modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		req, err := pdu.ParseRequest(p)
+		if err != nil {
+			return pdu.ExceptionFromError(p.FunctionCode, err), nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		seen[p.FunctionCode]++
+		switch r := req.(type) {
+		case pdu.ReadHoldingRegistersRequest:
+			if slaveID < 1 || slaveID > 3 || r.Address < 100 || r.Address >= 110 || r.Quantity != 4 {
+				t.Errorf("unexpected read: slave %d %+v", slaveID, r)
+			}
+			return pdu.ReadResponse(p.FunctionCode, make([]byte, 8)), nil
+		case pdu.WriteSingleRegisterRequest:
+			if slaveID != 5 || r.Address != 0 || r.Value != 42 {
+				t.Errorf("unexpected write: slave %d %+v", slaveID, r)
+			}
+			return p, nil
+		}
+		t.Errorf("unexpected request %+v", req)
+		return p, nil
+	}
+
+	cfg := config.LoadGenConfig{
+		Rate:           500,
+		Duration:       200 * time.Millisecond,
+		Concurrency:    2,
+		ReportInterval: time.Minute,
+		Patterns: []config.LoadPatternConfig{
+			{SlaveIDs: "1-3", FunctionCode: 3, Address: "40101", Span: 10, Count: 4, Weight: 3},
+			{SlaveIDs: "5", FunctionCode: 6, Address: "0", Count: 1, Value: 42, Weight: 1},
+		},
+	}
+	g, err := New("test", cfg, handler)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := g.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if seen[modbus.FuncCodeReadHoldingRegisters] == 0 || seen[modbus.FuncCodeWriteSingleRegister] == 0 {
+		t.Errorf("expected both patterns to be used, got %v", seen)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	valid := config.LoadPatternConfig{SlaveIDs: "1", FunctionCode: 3, Count: 1, Weight: 1}
+	tests := []struct {
+		name   string
+		mutate func(*config.LoadGenConfig)
+	}{
+		{"no rate", func(c *config.LoadGenConfig) { c.Rate = 0 }},
+		{"rate too high", func(c *config.LoadGenConfig) { c.Rate = 2e9 }},
+		{"negative concurrency", func(c *config.LoadGenConfig) { c.Concurrency = -1 }},
+		{"no concurrency", func(c *config.LoadGenConfig) { c.Concurrency = 0 }},
+		{"negative report interval", func(c *config.LoadGenConfig) { c.ReportInterval = -time.Second }},
+		{"no patterns", func(c *config.LoadGenConfig) { c.Patterns = nil }},
+		{"no slave IDs", func(c *config.LoadGenConfig) { c.Patterns[0].SlaveIDs = "" }},
+		{"bad function code", func(c *config.LoadGenConfig) { c.Patterns[0].FunctionCode = 8 }},
+		{"too many registers", func(c *config.LoadGenConfig) { c.Patterns[0].Count = 126 }},
+		{"range overflow", func(c *config.LoadGenConfig) { c.Patterns[0].Address, c.Patterns[0].Span = "0xFFFA", 10 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.LoadGenConfig{Rate: 10, Concurrency: 1, ReportInterval: time.Second, Patterns: []config.LoadPatternConfig{valid}}
+			tt.mutate(&cfg)
+			if _, err := New("test", cfg, nil); err == nil {
+				t.Error("New() expected error")
+			}
+		})
+	}
+}
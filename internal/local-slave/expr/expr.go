@@ -0,0 +1,192 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package expr computes values of a local slave with Lua expressions, so the gateway
+// can act as a dynamic device simulator, e.g. for factory acceptance tests.
+//
+// An expression is evaluated each time its register or bit is read, and the value it
+// returns is stored before the read is answered. Expressions see t, the seconds since
+// the slave started, the functions of the math library, such as sin, without prefix,
+// and hr(address), ir(address), coil(address) and di(address) reading the current
+// values of the tables:
+//
+//	math.floor(sin(t) * 1000)  -- a sine wave of amplitude 1000
+//	hr(1) * 10                 -- ten times holding register 1
+//
+// Numbers are rounded and stored as 16 bits, negative ones in two's complement; a
+// bit is on for true or a number other than 0. The values of a read are computed in
+// address order, so an expression reading another computed value in the same read
+// sees the new one if it has the lower address.
+package expr
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+	"github.com/ffutop/modbus-gateway/internal/script"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// evalTimeout bounds an evaluation, so a runaway expression can't stall the slave.
+const evalTimeout = 100 * time.Millisecond
+
+// Def is an expression computing a value of a table.
+type Def struct {
+	Table   model.TableType
+	Address uint16
+	Expr    string
+}
+
+type compiled struct {
+	address uint16
+	source  string
+	fn      *lua.LFunction
+}
+
+// Engine evaluates the expressions of a data model.
+type Engine struct {
+	model *model.DataModel
+	start time.Time
+
+	mu    sync.Mutex // An LState is not safe for concurrent use
+	state *lua.LState
+	exprs map[model.TableType][]compiled // By address
+}
+
+// New compiles defs into an engine computing values of m.
+func New(m *model.DataModel, defs []Def) (*Engine, error) {
+	e := &Engine{model: m, start: time.Now(), state: script.NewState(), exprs: make(map[model.TableType][]compiled)}
+	L := e.state
+	if mathlib, ok := L.GetGlobal("math").(*lua.LTable); ok {
+		mathlib.ForEach(func(k, v lua.LValue) { L.SetGlobal(k.String(), v) })
+	}
+	for name, table := range map[string]model.TableType{
+		"coil": model.TableCoils, "di": model.TableDiscreteInputs, "hr": model.TableHoldingRegisters, "ir": model.TableInputRegisters,
+	} {
+		L.SetGlobal(name, L.NewFunction(e.reader(table)))
+	}
+
+	for _, d := range defs {
+		fn, err := L.LoadString("return " + d.Expr)
+		if err != nil {
+			L.Close()
+			return nil, fmt.Errorf("expression %q: %w", d.Expr, err)
+		}
+		e.exprs[d.Table] = append(e.exprs[d.Table], compiled{address: d.Address, source: d.Expr, fn: fn})
+	}
+	for _, exprs := range e.exprs {
+		sort.Slice(exprs, func(i, j int) bool { return exprs[i].address < exprs[j].address })
+		for i := 1; i < len(exprs); i++ {
+			if exprs[i].address == exprs[i-1].address {
+				L.Close()
+				return nil, fmt.Errorf("expressions %q and %q of the same address %d", exprs[i-1].source, exprs[i].source, exprs[i].address)
+			}
+		}
+	}
+	return e, nil
+}
+
+// reader returns the Lua function reading a value of table.
+func (e *Engine) reader(table model.TableType) lua.LGFunction {
+	return func(L *lua.LState) int {
+		address := L.CheckInt(1)
+		if address < 0 || address > model.MaxAddress {
+			L.ArgError(1, "address out of range")
+		}
+		var data []byte
+		switch table {
+		case model.TableCoils:
+			data, _ = e.model.ReadCoils(uint16(address), 1)
+		case model.TableDiscreteInputs:
+			data, _ = e.model.ReadDiscreteInputs(uint16(address), 1)
+		case model.TableHoldingRegisters:
+			data, _ = e.model.ReadHoldingRegisters(uint16(address), 1)
+		case model.TableInputRegisters:
+			data, _ = e.model.ReadInputRegisters(uint16(address), 1)
+		}
+		if len(data) == 2 {
+			L.Push(lua.LNumber(binary.BigEndian.Uint16(data)))
+		} else {
+			L.Push(lua.LNumber(data[0] & 1))
+		}
+		return 1
+	}
+}
+
+// Update evaluates the expressions of the quantity values of table from address and
+// stores their results. Nil computes nothing.
+func (e *Engine) Update(table model.TableType, address, quantity uint16) error {
+	if e == nil {
+		return nil
+	}
+	exprs := e.exprs[table]
+	last := int(address) + int(quantity) - 1
+	i := sort.Search(len(exprs), func(i int) bool { return exprs[i].address >= address })
+	if i == len(exprs) || int(exprs[i].address) > last {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), evalTimeout)
+	defer cancel()
+	e.state.SetContext(ctx)
+	defer e.state.RemoveContext()
+	e.state.SetGlobal("t", lua.LNumber(time.Since(e.start).Seconds()))
+
+	for ; i < len(exprs) && int(exprs[i].address) <= last; i++ {
+		c := exprs[i]
+		if err := e.state.CallByParam(lua.P{Fn: c.fn, NRet: 1, Protect: true}); err != nil {
+			return fmt.Errorf("expression %q: %w", c.source, err)
+		}
+		ret := e.state.Get(-1)
+		e.state.Pop(1)
+		data, err := encode(table, ret)
+		if err != nil {
+			return fmt.Errorf("expression %q: %w", c.source, err)
+		}
+		if err := e.model.Load(table, c.address, 1, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode returns the result of an expression as Load takes it.
+func encode(table model.TableType, ret lua.LValue) ([]byte, error) {
+	var n float64
+	switch v := ret.(type) {
+	case lua.LNumber:
+		n = float64(v)
+	case lua.LBool:
+		if v {
+			n = 1
+		}
+	default:
+		return nil, fmt.Errorf("returned %s, want a number or boolean", ret.Type())
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil, fmt.Errorf("returned %v", n)
+	}
+	if table == model.TableCoils || table == model.TableDiscreteInputs {
+		if n != 0 {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	}
+	return binary.BigEndian.AppendUint16(nil, uint16(int64(math.Round(n)))), nil
+}
+
+// Close closes the interpreter.
+func (e *Engine) Close() {
+	e.mu.Lock()
+	e.state.Close()
+	e.mu.Unlock()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package expr
+
+import (
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+)
+
+func TestEngine_Update(t *testing.T) {
+	m := model.NewDataModel()
+	e, err := New(m, []Def{
+		{Table: model.TableHoldingRegisters, Address: 2, Expr: "hr(1) * 10"},
+		{Table: model.TableHoldingRegisters, Address: 3, Expr: "hr(2) + 1"},
+		{Table: model.TableInputRegisters, Address: 100, Expr: "floor(sin(t) * 1000) - 2000"},
+		{Table: model.TableCoils, Address: 5, Expr: "hr(1) > 6"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	m.WriteSingleRegister(1, 7)
+	m.WriteSingleRegister(4, 99)
+	if err := e.Update(model.TableHoldingRegisters, 1, 4); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.HoldingRegisters[1:5]; got[0] != 7 || got[1] != 70 || got[2] != 71 || got[3] != 99 {
+		t.Errorf("holding registers 1-4 = %v, want [7 70 71 99]", got)
+	}
+
+	if err := e.Update(model.TableInputRegisters, 100, 1); err != nil {
+		t.Fatal(err)
+	}
+	if v := int16(m.InputRegisters[100]); v > -1000 || v < -3000 {
+		t.Errorf("input register 100 = %d, want a negative value in two's complement", v)
+	}
+
+	if err := e.Update(model.TableCoils, 0, 8); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Coils.Get(5) {
+		t.Error("coil 5 off, want on")
+	}
+
+	// Reads not covering an expression compute nothing
+	m.WriteSingleRegister(1, 1)
+	if err := e.Update(model.TableHoldingRegisters, 4, 10); err != nil || m.HoldingRegisters[2] != 70 {
+		t.Errorf("register 2 = %d, %v, want unchanged", m.HoldingRegisters[2], err)
+	}
+	if (*Engine)(nil).Update(model.TableCoils, 0, 1) != nil {
+		t.Error("nil engine failed")
+	}
+}
+
+func TestEngine_Errors(t *testing.T) {
+	for _, defs := range [][]Def{
+		{{Table: model.TableHoldingRegisters, Expr: "hr(1) *"}},
+		{{Table: model.TableCoils, Address: 1, Expr: "1"}, {Table: model.TableCoils, Address: 1, Expr: "0"}},
+	} {
+		if _, err := New(model.NewDataModel(), defs); err == nil {
+			t.Errorf("New(%v) succeeded", defs)
+		}
+	}
+
+	m := model.NewDataModel()
+	e, err := New(m, []Def{
+		{Table: model.TableHoldingRegisters, Address: 0, Expr: "'text'"},
+		{Table: model.TableHoldingRegisters, Address: 1, Expr: "hr(70000)"},
+		{Table: model.TableHoldingRegisters, Address: 2, Expr: "(function() while true do end end)()"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	for address := uint16(0); address < 3; address++ {
+		if err := e.Update(model.TableHoldingRegisters, address, 1); err == nil {
+			t.Errorf("Update() of address %d succeeded", address)
+		}
+	}
+}
@@ -11,7 +11,9 @@ import (
 )
 
 const (
-	MaxAddress = 65535
+	MaxAddress   = 65535
+	BitsSize     = (MaxAddress + 1) / 8 // Bytes of a packed bit table
+	MaxFIFOCount = 31                   // Registers a FIFO queue holds, as many as Read FIFO Queue returns
 )
 
 // TableType represents the type of Modbus data table.
@@ -29,21 +31,29 @@ const (
 type DataModel struct {
 	mu sync.RWMutex
 
-	// 0x Coils (Read/Write). Stored as 1 (ON) or 0 (OFF).
-	Coils []byte
-	// 1x Discrete Inputs (Read Only). Stored as 1 (ON) or 0 (OFF).
-	DiscreteInputs []byte
+	// 0x Coils (Read/Write). Packed, 8 per byte.
+	Coils Bits
+	// 1x Discrete Inputs (Read Only). Packed, 8 per byte.
+	DiscreteInputs Bits
 	// 4x Holding Registers (Read/Write).
 	HoldingRegisters []uint16
 	// 3x Input Registers (Read Only).
 	InputRegisters []uint16
+
+	// FIFO queues by pointer address, not persisted
+	fifos map[uint16]*fifo
+}
+
+type fifo struct {
+	values      []uint16 // Oldest first
+	clearOnRead bool
 }
 
 // NewDataModel creates a new memory model initialized to zero.
 func NewDataModel() *DataModel {
 	return &DataModel{
-		Coils:            make([]byte, MaxAddress+1),
-		DiscreteInputs:   make([]byte, MaxAddress+1),
+		Coils:            make(Bits, BitsSize),
+		DiscreteInputs:   make(Bits, BitsSize),
 		HoldingRegisters: make([]uint16, MaxAddress+1),
 		InputRegisters:   make([]uint16, MaxAddress+1),
 	}
@@ -58,19 +68,7 @@ func (m *DataModel) ReadCoils(address, quantity uint16) ([]byte, error) {
 		return nil, err
 	}
 
-	// Calculate byte count: (quantity + 7) / 8
-	byteCount := (int(quantity) + 7) / 8
-	result := make([]byte, byteCount)
-
-	for i := 0; i < int(quantity); i++ {
-		if m.Coils[int(address)+i] != 0 {
-			byteIdx := i / 8
-			bitIdx := uint(i % 8)
-			result[byteIdx] |= 1 << bitIdx
-		}
-	}
-
-	return result, nil
+	return m.Coils.Read(address, quantity), nil
 }
 
 // WriteSingleCoil writes a single coil. value should be 0xFF00 (ON) or 0x0000 (OFF).
@@ -84,9 +82,9 @@ func (m *DataModel) WriteSingleCoil(address uint16, value uint16) error {
 
 	switch value {
 	case 0xFF00:
-		m.Coils[address] = 1
+		m.Coils.Set(address, true)
 	case 0x0000:
-		m.Coils[address] = 0
+		m.Coils.Set(address, false)
 	default:
 		// Strictly speaking Modbus only allows these two, and we can just ignore others or error.
 	}
@@ -107,12 +105,7 @@ func (m *DataModel) WriteMultipleCoils(address, quantity uint16, data []byte) er
 		return fmt.Errorf("insufficient data length")
 	}
 
-	for i := 0; i < int(quantity); i++ {
-		byteIdx := i / 8
-		bitIdx := uint(i % 8)
-		val := (data[byteIdx] >> bitIdx) & 1
-		m.Coils[int(address)+i] = val
-	}
+	m.Coils.Write(address, quantity, data)
 	return nil
 }
 
@@ -125,17 +118,7 @@ func (m *DataModel) ReadDiscreteInputs(address, quantity uint16) ([]byte, error)
 		return nil, err
 	}
 
-	byteCount := (int(quantity) + 7) / 8
-	result := make([]byte, byteCount)
-
-	for i := 0; i < int(quantity); i++ {
-		if m.DiscreteInputs[int(address)+i] != 0 {
-			byteIdx := i / 8
-			bitIdx := uint(i % 8)
-			result[byteIdx] |= 1 << bitIdx
-		}
-	}
-	return result, nil
+	return m.DiscreteInputs.Read(address, quantity), nil
 }
 
 // ReadHoldingRegisters reads a range of holding registers and returns them as BigEndian bytes.
@@ -168,6 +151,20 @@ func (m *DataModel) WriteSingleRegister(address uint16, value uint16) error {
 	return nil
 }
 
+// MaskWriteRegister changes the bits of a holding register selected by a clear bit
+// of andMask to those of orMask: (current AND andMask) OR (orMask AND NOT andMask).
+func (m *DataModel) MaskWriteRegister(address, andMask, orMask uint16) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if int(address) > MaxAddress {
+		return fmt.Errorf("address out of range")
+	}
+
+	m.HoldingRegisters[address] = m.HoldingRegisters[address]&andMask | orMask&^andMask
+	return nil
+}
+
 // WriteMultipleRegisters writes a range of holding registers from BigEndian bytes.
 func (m *DataModel) WriteMultipleRegisters(address, quantity uint16, data []byte) error {
 	m.mu.Lock()
@@ -205,6 +202,97 @@ func (m *DataModel) ReadInputRegisters(address, quantity uint16) ([]byte, error)
 	return result, nil
 }
 
+// Load stores quantity values of any table at address, as packed bits or BigEndian
+// registers like in a read response, such as values read from a device.
+func (m *DataModel) Load(table TableType, address, quantity uint16, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := validateRange(address, quantity); err != nil {
+		return err
+	}
+
+	switch table {
+	case TableCoils, TableDiscreteInputs:
+		if len(data) < (int(quantity)+7)/8 {
+			return fmt.Errorf("insufficient data length")
+		}
+		bits := m.Coils
+		if table == TableDiscreteInputs {
+			bits = m.DiscreteInputs
+		}
+		bits.Write(address, quantity, data)
+	case TableHoldingRegisters, TableInputRegisters:
+		if len(data) < int(quantity)*2 {
+			return fmt.Errorf("insufficient data length")
+		}
+		registers := m.HoldingRegisters
+		if table == TableInputRegisters {
+			registers = m.InputRegisters
+		}
+		for i := 0; i < int(quantity); i++ {
+			registers[int(address)+i] = binary.BigEndian.Uint16(data[i*2:])
+		}
+	default:
+		return fmt.Errorf("unknown table %d", table)
+	}
+	return nil
+}
+
+// AddFIFO defines a FIFO queue at the pointer address, emptied by each read of it
+// if clearOnRead is set.
+func (m *DataModel) AddFIFO(address uint16, clearOnRead bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.fifos == nil {
+		m.fifos = make(map[uint16]*fifo)
+	}
+	m.fifos[address] = &fifo{clearOnRead: clearOnRead}
+}
+
+// IsFIFO reports whether a FIFO queue is defined at address.
+func (m *DataModel) IsFIFO(address uint16) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.fifos[address]
+	return ok
+}
+
+// PushFIFO appends values to the FIFO queue at address. A full queue drops its
+// oldest values to make room.
+func (m *DataModel) PushFIFO(address uint16, values ...uint16) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.fifos[address]
+	if !ok {
+		return fmt.Errorf("no FIFO queue at address %d", address)
+	}
+	q.values = append(q.values, values...)
+	if excess := len(q.values) - MaxFIFOCount; excess > 0 {
+		q.values = append(q.values[:0], q.values[excess:]...)
+	}
+	return nil
+}
+
+// ReadFIFO returns the values of the FIFO queue at address, oldest first.
+func (m *DataModel) ReadFIFO(address uint16) ([]uint16, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.fifos[address]
+	if !ok {
+		return nil, fmt.Errorf("no FIFO queue at address %d", address)
+	}
+	values := append([]uint16(nil), q.values...)
+	if q.clearOnRead {
+		q.values = q.values[:0]
+	}
+	return values, nil
+}
+
 func validateRange(address, quantity uint16) error {
 	if quantity == 0 {
 		return fmt.Errorf("quantity must be greater than 0")
@@ -215,3 +303,58 @@ func validateRange(address, quantity uint16) error {
 	}
 	return nil
 }
+
+// Bits is a packed bit table, LSB first like the bits of Modbus PDUs, so ranges
+// starting on a multiple of 8 are plain byte copies.
+type Bits []byte
+
+// Get returns the bit at address.
+func (b Bits) Get(address uint16) bool {
+	return b[address/8]&(1<<(address%8)) != 0
+}
+
+// Set sets the bit at address.
+func (b Bits) Set(address uint16, on bool) {
+	if on {
+		b[address/8] |= 1 << (address % 8)
+	} else {
+		b[address/8] &^= 1 << (address % 8)
+	}
+}
+
+// Read returns quantity bits from address packed as in a Modbus response, with
+// the unused bits of the last byte zero. The range must be within the table.
+func (b Bits) Read(address, quantity uint16) []byte {
+	out := make([]byte, (int(quantity)+7)/8)
+	first, shift := int(address)/8, address%8
+	for i := range out {
+		v := b[first+i] >> shift
+		if shift > 0 && first+i+1 < len(b) {
+			v |= b[first+i+1] << (8 - shift)
+		}
+		out[i] = v
+	}
+	if rest := quantity % 8; rest != 0 {
+		out[len(out)-1] &= 1<<rest - 1
+	}
+	return out
+}
+
+// Write stores quantity bits packed as in a Modbus request at address, a byte of
+// the table at a time. The range must be within the table.
+func (b Bits) Write(address, quantity uint16, data []byte) {
+	for i := 0; i < int(quantity); {
+		bit := int(address) + i
+		shift := bit % 8
+		n := min(8-shift, int(quantity)-i) // Bits landing in this byte of the table
+
+		// Source bits i to i+n-1, which may span two bytes of data
+		v := data[i/8] >> (i % 8)
+		if i%8+n > 8 {
+			v |= data[i/8+1] << (8 - i%8)
+		}
+		mask := byte(1<<n-1) << shift
+		b[bit/8] = b[bit/8]&^mask | v<<shift&mask
+		i += n
+	}
+}
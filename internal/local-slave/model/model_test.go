@@ -0,0 +1,137 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package model
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBits(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	b := make(Bits, BitsSize)
+	ref := make([]bool, MaxAddress+1) // One bool per bit, as the table was stored before
+
+	for n := 0; n < 2000; n++ {
+		quantity := uint16(1 + rng.Intn(2000))
+		address := uint16(rng.Intn(MaxAddress + 2 - int(quantity)))
+		if n%100 == 0 {
+			address = uint16(MaxAddress + 1 - int(quantity)) // The end of the table
+		}
+
+		data := make([]byte, (int(quantity)+7)/8)
+		rng.Read(data)
+		b.Write(address, quantity, data)
+		for i := 0; i < int(quantity); i++ {
+			ref[int(address)+i] = data[i/8]>>(i%8)&1 == 1
+		}
+
+		address = uint16(rng.Intn(MaxAddress + 2 - int(quantity)))
+		want := make([]byte, len(data))
+		for i := 0; i < int(quantity); i++ {
+			if ref[int(address)+i] {
+				want[i/8] |= 1 << (i % 8)
+			}
+		}
+		if got := b.Read(address, quantity); !bytes.Equal(got, want) {
+			t.Fatalf("Read(%d, %d) = % X, want % X", address, quantity, got, want)
+		}
+	}
+
+	for _, addr := range []uint16{0, 7, 8, 12345, MaxAddress} {
+		b.Set(addr, true)
+		if !b.Get(addr) {
+			t.Errorf("Get(%d) = false after Set(true)", addr)
+		}
+		b.Set(addr, false)
+		if b.Get(addr) {
+			t.Errorf("Get(%d) = true after Set(false)", addr)
+		}
+	}
+}
+
+func TestDataModel_Coils(t *testing.T) {
+	m := NewDataModel()
+	if err := m.WriteMultipleCoils(19, 10, []byte{0xCD, 0x01}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteSingleCoil(30, 0xFF00); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ReadCoils(19, 12)
+	if want := []byte{0xCD, 0x09}; err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadCoils() = % X, %v, want % X", got, err, want)
+	}
+	if _, err := m.ReadCoils(MaxAddress, 2); err == nil {
+		t.Error("ReadCoils past the end of the table succeeded")
+	}
+}
+
+func TestDataModel_Load(t *testing.T) {
+	m := NewDataModel()
+	if err := m.Load(TableDiscreteInputs, 3, 10, []byte{0xCD, 0x01}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(TableInputRegisters, 100, 2, []byte{0x12, 0x34, 0x56, 0x78}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.ReadDiscreteInputs(3, 10); err != nil || !bytes.Equal(got, []byte{0xCD, 0x01}) {
+		t.Errorf("ReadDiscreteInputs() = % X, %v", got, err)
+	}
+	if got, err := m.ReadInputRegisters(100, 2); err != nil || !bytes.Equal(got, []byte{0x12, 0x34, 0x56, 0x78}) {
+		t.Errorf("ReadInputRegisters() = % X, %v", got, err)
+	}
+	if got, _ := m.ReadHoldingRegisters(100, 2); !bytes.Equal(got, []byte{0, 0, 0, 0}) {
+		t.Errorf("Load of input registers changed holding registers to % X", got)
+	}
+	if err := m.Load(TableHoldingRegisters, 0, 2, []byte{0x12}); err == nil {
+		t.Error("Load with short data succeeded")
+	}
+}
+
+func TestDataModel_MaskWriteRegister(t *testing.T) {
+	// Example of the specification: 0x12 with AND 0xF2 and OR 0x25 becomes 0x17
+	m := NewDataModel()
+	if err := m.WriteSingleRegister(4, 0x12); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MaskWriteRegister(4, 0xF2, 0x25); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.HoldingRegisters[4]; got != 0x17 {
+		t.Errorf("register after mask write = %#x, want 0x17", got)
+	}
+}
+
+func TestDataModel_FIFO(t *testing.T) {
+	m := NewDataModel()
+	m.AddFIFO(10, false)
+	m.AddFIFO(20, true)
+	if !m.IsFIFO(10) || m.IsFIFO(11) {
+		t.Errorf("IsFIFO(10), IsFIFO(11) = %v, %v", m.IsFIFO(10), m.IsFIFO(11))
+	}
+	if err := m.PushFIFO(11, 1); err == nil {
+		t.Error("PushFIFO() to no queue succeeded")
+	}
+
+	for i := 0; i < MaxFIFOCount+5; i++ {
+		m.PushFIFO(10, uint16(i))
+	}
+	got, err := m.ReadFIFO(10)
+	if err != nil || len(got) != MaxFIFOCount || got[0] != 5 {
+		t.Errorf("ReadFIFO() of a full queue = %v, %v, want the last %d values", got, err, MaxFIFOCount)
+	}
+	if again, _ := m.ReadFIFO(10); len(again) != MaxFIFOCount {
+		t.Errorf("second ReadFIFO() = %d values, want the queue kept", len(again))
+	}
+
+	m.PushFIFO(20, 7, 8)
+	if got, _ := m.ReadFIFO(20); len(got) != 2 || got[0] != 7 || got[1] != 8 {
+		t.Errorf("ReadFIFO() = %v, want [7 8]", got)
+	}
+	if got, _ := m.ReadFIFO(20); len(got) != 0 {
+		t.Errorf("ReadFIFO() after clear on read = %v, want empty", got)
+	}
+}
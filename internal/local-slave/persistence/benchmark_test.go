@@ -60,6 +60,23 @@ func BenchmarkMmapStorage_OnWrite(b *testing.B) {
 	}
 }
 
+// BenchmarkBoltStorage_OnWrite benchmarks the OnWrite hook for BoltStorage (a commit each).
+func BenchmarkBoltStorage_OnWrite(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "bench.db")
+	ms := NewBoltStorage(path)
+	modelPtr, err := ms.Load()
+	if err != nil {
+		b.Fatalf("Failed to load bolt storage: %v", err)
+	}
+	defer ms.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		modelPtr.WriteSingleRegister(10, uint16(i))
+		ms.OnWrite(model.TableHoldingRegisters, 10, 1)
+	}
+}
+
 // BenchmarkMemoryStorage_Load benchmarks the Load operation for MemoryStorage.
 func BenchmarkMemoryStorage_Load(b *testing.B) {
 	ms := NewMemoryStorage()
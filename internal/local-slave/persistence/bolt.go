@@ -0,0 +1,180 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package persistence
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// buckets name the buckets of the tables in a BoltStorage.
+var buckets = map[model.TableType][]byte{
+	model.TableCoils:            []byte("coils"),
+	model.TableDiscreteInputs:   []byte("discrete_inputs"),
+	model.TableHoldingRegisters: []byte("holding_registers"),
+	model.TableInputRegisters:   []byte("input_registers"),
+}
+
+// batchDelay is how long a write waits for others to commit with, bbolt's default
+// of 10ms would slow down a master writing alone.
+const batchDelay = 2 * time.Millisecond
+
+// BoltStorage implements persistence in a bbolt database, a pure Go embedded
+// key/value store, so it needs neither cgo like SQL nor mmap semantics of the
+// platform. Each write is committed before it is answered, and writes arriving
+// together are committed in one transaction, so a crash loses none that were
+// answered and never leaves a write half done.
+//
+// Each table is a bucket of the values written, keyed by big-endian address:
+// registers are stored big-endian, bits as one byte, 0 or 1.
+type BoltStorage struct {
+	path  string
+	db    *bolt.DB
+	model *model.DataModel
+}
+
+// NewBoltStorage creates a new BoltStorage.
+func NewBoltStorage(path string) *BoltStorage {
+	return &BoltStorage{
+		path: path,
+	}
+}
+
+// Load opens the database, creating it if necessary, and loads the data model.
+func (s *BoltStorage) Load() (*model.DataModel, error) {
+	// A database is locked by the process using it, fail instead of waiting forever
+	db, err := bolt.Open(s.path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	m := model.NewDataModel()
+	err = db.Update(func(tx *bolt.Tx) error {
+		for table, name := range buckets {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			if err := b.ForEach(func(k, v []byte) error {
+				if len(k) != 2 || len(v) == 0 {
+					return nil // Not written by us
+				}
+				load(m, table, binary.BigEndian.Uint16(k), v)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load database: %w", err)
+	}
+	db.MaxBatchDelay = batchDelay
+	s.db, s.model = db, m
+	return m, nil
+}
+
+// load sets a value of table stored in the database.
+func load(m *model.DataModel, table model.TableType, address uint16, v []byte) {
+	switch table {
+	case model.TableCoils:
+		m.Coils.Set(address, v[0] != 0)
+	case model.TableDiscreteInputs:
+		m.DiscreteInputs.Set(address, v[0] != 0)
+	case model.TableHoldingRegisters:
+		if len(v) == 2 {
+			m.HoldingRegisters[address] = binary.BigEndian.Uint16(v)
+		}
+	case model.TableInputRegisters:
+		if len(v) == 2 {
+			m.InputRegisters[address] = binary.BigEndian.Uint16(v)
+		}
+	}
+}
+
+// Save stores every value of m, in one transaction.
+func (s *BoltStorage) Save(m *model.DataModel) error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for table := range buckets {
+			if err := put(tx, m, table, 0, model.MaxAddress+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// OnWrite stores the values written, committed with those of concurrent writes.
+func (s *BoltStorage) OnWrite(table model.TableType, address, quantity uint16) {
+	if s.db == nil {
+		return
+	}
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		return put(tx, s.model, table, int(address), int(quantity))
+	})
+	if err != nil {
+		slog.Error("Failed to persist values", "table", table, "address", address, "quantity", quantity, "err", err)
+	}
+}
+
+// put stores quantity values of table from address, as read from m.
+func put(tx *bolt.Tx, m *model.DataModel, table model.TableType, address, quantity int) error {
+	b := tx.Bucket(buckets[table])
+	if b == nil {
+		return fmt.Errorf("no bucket of table %d", table)
+	}
+	for i := 0; i < quantity; {
+		n := min(quantity-i, 2000) // In chunks, as a whole table doesn't fit a 16-bit quantity
+		data, err := read(m, table, uint16(address+i), uint16(n))
+		if err != nil {
+			return err
+		}
+		for j := 0; j < n; j++ {
+			var v []byte
+			switch table {
+			case model.TableCoils, model.TableDiscreteInputs:
+				v = []byte{data[j/8] >> (j % 8) & 1}
+			default:
+				v = data[2*j : 2*j+2]
+			}
+			if err := b.Put(binary.BigEndian.AppendUint16(nil, uint16(address+i+j)), v); err != nil {
+				return err
+			}
+		}
+		i += n
+	}
+	return nil
+}
+
+// read reads values of table, packed like in a read response.
+func read(m *model.DataModel, table model.TableType, address, quantity uint16) ([]byte, error) {
+	switch table {
+	case model.TableCoils:
+		return m.ReadCoils(address, quantity)
+	case model.TableDiscreteInputs:
+		return m.ReadDiscreteInputs(address, quantity)
+	case model.TableHoldingRegisters:
+		return m.ReadHoldingRegisters(address, quantity)
+	}
+	return m.ReadInputRegisters(address, quantity)
+}
+
+// Close closes the database.
+func (s *BoltStorage) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
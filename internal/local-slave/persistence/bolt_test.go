@@ -0,0 +1,72 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package persistence
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+)
+
+func TestBoltStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slave.db")
+	s := NewBoltStorage(path)
+	m, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	m.WriteMultipleCoils(3, 2, []byte{0x03})
+	s.OnWrite(model.TableCoils, 3, 2)
+	m.Load(model.TableDiscreteInputs, 65535, 1, []byte{0x01})
+	s.OnWrite(model.TableDiscreteInputs, 65535, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(address uint16) {
+			defer wg.Done()
+			m.WriteSingleRegister(address, address*100+1)
+			s.OnWrite(model.TableHoldingRegisters, address, 1)
+		}(uint16(i))
+	}
+	wg.Wait()
+	m.Load(model.TableInputRegisters, 7, 1, []byte{0xAB, 0xCD})
+	s.OnWrite(model.TableInputRegisters, 7, 1)
+
+	if _, err := NewBoltStorage(path).Load(); err == nil {
+		t.Error("Load() of a database in use succeeded")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = NewBoltStorage(path)
+	m, err = s.Load()
+	if err != nil {
+		t.Fatalf("Load() after reopening error = %v", err)
+	}
+	defer s.Close()
+	if !m.Coils.Get(3) || !m.Coils.Get(4) || m.Coils.Get(5) || !m.DiscreteInputs.Get(65535) {
+		t.Errorf("bits after reopening = % X, want coils 3 and 4 and discrete input 65535 on", m.Coils.Read(0, 8))
+	}
+	for i := uint16(0); i < 20; i++ {
+		if got := m.HoldingRegisters[i]; got != i*100+1 {
+			t.Errorf("holding register %d after reopening = %d, want %d", i, got, i*100+1)
+		}
+	}
+	if got := m.InputRegisters[7]; got != 0xABCD {
+		t.Errorf("input register 7 after reopening = %#x, want 0xabcd", got)
+	}
+
+	m.HoldingRegisters[60000] = 42
+	if err := s.Save(m); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	s.Close()
+	if m, err = s.Load(); err != nil || m.HoldingRegisters[60000] != 42 || m.HoldingRegisters[1] != 101 {
+		t.Errorf("Load() after Save() = %v, registers %d and %d", err, m.HoldingRegisters[60000], m.HoldingRegisters[1])
+	}
+}
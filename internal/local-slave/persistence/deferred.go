@@ -0,0 +1,131 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package persistence
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+)
+
+// Sync modes, when the writes to a local slave reach its storage
+const (
+	SyncAlways     = "always"      // Each write, before it is answered
+	SyncInterval   = "interval"    // The writes of each interval together
+	SyncOnShutdown = "on_shutdown" // Only when the storage is saved or closed
+)
+
+// DeferredStorage passes the writes to a Storage in batches: addresses written are
+// marked, and each run of consecutive addresses marked is passed on as one write,
+// every interval, or only on Save and Close if the interval is 0. A burst of writes
+// to a block of registers costs one sync instead of one each, and the writes since
+// the last sync are lost if the gateway crashes.
+type DeferredStorage struct {
+	Storage
+	interval time.Duration
+
+	mu    sync.Mutex
+	dirty map[model.TableType]model.Bits // Addresses written since the last sync
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDeferredStorage creates a DeferredStorage syncing s every interval.
+func NewDeferredStorage(s Storage, interval time.Duration) *DeferredStorage {
+	return &DeferredStorage{Storage: s, interval: interval, dirty: make(map[model.TableType]model.Bits)}
+}
+
+// Load loads the data model of the storage, and starts syncing it.
+func (d *DeferredStorage) Load() (*model.DataModel, error) {
+	m, err := d.Storage.Load()
+	if err != nil || d.interval <= 0 || d.stop != nil {
+		return m, err
+	}
+	d.stop, d.done = make(chan struct{}), make(chan struct{})
+	go d.run()
+	return m, nil
+}
+
+func (d *DeferredStorage) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.sync()
+		}
+	}
+}
+
+// OnWrite marks the addresses written, for the next sync.
+func (d *DeferredStorage) OnWrite(table model.TableType, address, quantity uint16) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bits, ok := d.dirty[table]
+	if !ok {
+		bits = make(model.Bits, model.BitsSize)
+		d.dirty[table] = bits
+	}
+	for i := 0; i < int(quantity) && int(address)+i <= model.MaxAddress; i++ {
+		bits.Set(address+uint16(i), true)
+	}
+}
+
+// sync passes the addresses written since the last sync to the storage, a run of
+// consecutive addresses at a time.
+func (d *DeferredStorage) sync() {
+	d.mu.Lock()
+	dirty := d.dirty
+	d.dirty = make(map[model.TableType]model.Bits)
+	d.mu.Unlock()
+
+	for table, bits := range dirty {
+		for address := 0; address <= model.MaxAddress; address++ {
+			if !bits.Get(uint16(address)) {
+				continue
+			}
+			run := 1
+			for address+run <= model.MaxAddress && run < math.MaxUint16 && bits.Get(uint16(address+run)) {
+				run++
+			}
+			d.Storage.OnWrite(table, uint16(address), uint16(run))
+			address += run - 1
+		}
+	}
+}
+
+// Dropped returns how many writes the storage dropped, 0 unless it drops any.
+func (d *DeferredStorage) Dropped() uint64 {
+	if dropper, ok := d.Storage.(interface{ Dropped() uint64 }); ok {
+		return dropper.Dropped()
+	}
+	return 0
+}
+
+// Save syncs the writes pending, then saves the storage.
+func (d *DeferredStorage) Save(m *model.DataModel) error {
+	d.sync()
+	return d.Storage.Save(m)
+}
+
+// Close stops syncing, syncs the writes pending and closes the storage.
+func (d *DeferredStorage) Close() error {
+	if d.stop != nil {
+		close(d.stop)
+		<-d.done
+		d.stop = nil
+	}
+	d.sync()
+	if closer, ok := d.Storage.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package persistence
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+)
+
+// recordingStorage records the writes passed to it.
+type recordingStorage struct {
+	MemoryStorage
+	mu     sync.Mutex
+	writes []string
+	closed bool
+}
+
+func (s *recordingStorage) OnWrite(table model.TableType, address, quantity uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes = append(s.writes, fmt.Sprintf("%d:%d+%d", table, address, quantity))
+}
+
+func (s *recordingStorage) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *recordingStorage) flushed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writes := s.writes
+	s.writes = nil
+	return writes
+}
+
+func TestDeferredStorage(t *testing.T) {
+	inner := &recordingStorage{}
+	d := NewDeferredStorage(inner, 0)
+	m, err := d.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint16(0); i < 300; i++ { // A burst of single writes
+		d.OnWrite(model.TableHoldingRegisters, 100+i, 1)
+	}
+	d.OnWrite(model.TableHoldingRegisters, 398, 5)
+	d.OnWrite(model.TableCoils, 65535, 1)
+	if writes := inner.flushed(); len(writes) != 0 {
+		t.Errorf("writes passed on before a sync: %v", writes)
+	}
+	if err := d.Save(m); err != nil {
+		t.Fatal(err)
+	}
+	writes := inner.flushed()
+	if len(writes) != 2 || !slices.Contains(writes, "2:100+303") || !slices.Contains(writes, "0:65535+1") {
+		t.Errorf("writes synced on Save() = %v, want a run of 303 registers and the last coil", writes)
+	}
+
+	d.OnWrite(model.TableInputRegisters, 7, 1)
+	if err := d.Close(); err != nil || !inner.closed {
+		t.Errorf("Close() = %v, storage closed %v", err, inner.closed)
+	}
+	if writes := inner.flushed(); len(writes) != 1 || writes[0] != "3:7+1" {
+		t.Errorf("writes synced on Close() = %v", writes)
+	}
+}
+
+func TestDeferredStorage_Interval(t *testing.T) {
+	inner := &recordingStorage{}
+	d := NewDeferredStorage(inner, 10*time.Millisecond)
+	if _, err := d.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.OnWrite(model.TableHoldingRegisters, 1, 2)
+	d.OnWrite(model.TableHoldingRegisters, 3, 1)
+
+	deadline := time.Now().Add(time.Second)
+	var writes []string
+	for len(writes) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		writes = inner.flushed()
+	}
+	if len(writes) != 1 || writes[0] != "2:1+3" {
+		t.Errorf("writes synced after an interval = %v, want one run of 3", writes)
+	}
+}
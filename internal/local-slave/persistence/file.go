@@ -5,27 +5,59 @@
 package persistence
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log/slog"
 	"os"
+	"sync"
 
 	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
 )
 
+// walLimit is the size of the write-ahead log at which it is compacted into the
+// snapshot, so rewriting the snapshot costs no more than the log appends did.
+const walLimit = totalSize
+
+// pageSize is the unit of the snapshot rewritten by a compaction.
+const pageSize = 4096
+
 // FileStorage implements persistence using file operations.
 // This provides OS-managed persistence and efficient memory usage.
 //
-// Layout:
-// - Coils: 65536 bytes (Offset 0)
-// - DiscreteInputs: 65536 bytes (Offset 65536)
-// - HoldingRegisters: 65536 * 2 bytes (Offset 131072)
-// - InputRegisters: 65536 * 2 bytes (Offset 262144)
-// Total Size: 393216 bytes
+// The file at path is a snapshot of the data model, and each write is appended to
+// a write-ahead log next to it, path + ".wal", and synced before it is answered,
+// which is a few bytes instead of the whole image. The log is compacted into the
+// snapshot once it grows to the size of the snapshot, on Save and on Close, by
+// rewriting only the pages of the snapshot holding values written since. Load
+// replays the log over the snapshot, up to a record torn by a crash, so a snapshot
+// interrupted while being rewritten is repaired too: the log is only emptied once
+// the snapshot is synced.
+//
+// Snapshot layout:
+// - Coils: 8192 bytes, packed (Offset 0)
+// - DiscreteInputs: 8192 bytes, packed (Offset 8192)
+// - HoldingRegisters: 65536 * 2 bytes (Offset 16384)
+// - InputRegisters: 65536 * 2 bytes (Offset 147456)
+// Total Size: 278528 bytes
+//
+// Log records: table (1 byte), address and quantity (2 bytes each, big-endian), the
+// values packed like in a read response, and the CRC-32 of all that.
+//
+// Files of the former layout, with a byte per coil and discrete input, are migrated on load.
 type FileStorage struct {
-	path string
-	file *os.File
-	data []byte
+	path  string
+	file  *os.File
+	data  []byte
+	model *model.DataModel
+
+	mu      sync.Mutex // Orders appends and compactions
+	wal     *os.File
+	walSize int64
+	dirty   []bool // Pages of the snapshot written since the last compaction
 }
 
 // NewFileStorage creates a new FileStorage.
@@ -37,6 +69,10 @@ func NewFileStorage(path string) *FileStorage {
 
 // Load loads the data model by file operations.
 func (ms *FileStorage) Load() (*model.DataModel, error) {
+	if err := migrateLegacy(ms.path); err != nil {
+		return nil, err
+	}
+
 	// Open file, creating if necessary
 	f, err := os.OpenFile(ms.path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
@@ -66,38 +102,194 @@ func (ms *FileStorage) Load() (*model.DataModel, error) {
 	ms.data = data
 
 	// Construct the DataModel backed by the file data slice
-	return mapBytesToModel(data), nil
+	ms.model = mapBytesToModel(data)
+	ms.dirty = make([]bool, (totalSize+pageSize-1)/pageSize)
+
+	wal, err := os.OpenFile(ms.path+".wal", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+	ms.wal = wal
+	records, err := replay(wal, ms.model)
+	if err == nil {
+		ms.walSize, err = wal.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		f.Close()
+		wal.Close()
+		return nil, fmt.Errorf("failed to replay write-ahead log: %w", err)
+	}
+	if records > 0 {
+		slog.Info("Replayed write-ahead log", "path", wal.Name(), "records", records)
+	}
+	// Compact what was replayed, dropping a torn record at the end
+	if ms.walSize > 0 {
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.mark(0, totalSize)
+		if err := ms.compact(); err != nil {
+			f.Close()
+			wal.Close()
+			return nil, err
+		}
+	}
+	return ms.model, nil
 }
 
-// Save flushes the data to disk.
+// replay applies the records of the log to m, up to the end or the first record
+// torn or corrupted, and returns how many it applied.
+func replay(wal *os.File, m *model.DataModel) (int, error) {
+	if _, err := wal.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(wal)
+	records := 0
+	for {
+		header := make([]byte, 5)
+		_, err := io.ReadFull(r, header)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		table := model.TableType(header[0])
+		address, quantity := binary.BigEndian.Uint16(header[1:]), binary.BigEndian.Uint16(header[3:])
+		record := append(header, make([]byte, valuesSize(table, quantity)+4)...)
+		if err == nil {
+			_, err = io.ReadFull(r, record[5:])
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			slog.Warn("Dropped a torn record at the end of the write-ahead log", "path", wal.Name())
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		body := record[:len(record)-4]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(record[len(body):]) || table > model.TableInputRegisters {
+			slog.Warn("Dropped a corrupted record and those after it in the write-ahead log", "path", wal.Name(), "records", records)
+			return records, nil
+		}
+		if err := m.Load(table, address, quantity, body[5:]); err != nil {
+			slog.Warn("Dropped an invalid record and those after it in the write-ahead log", "path", wal.Name(), "records", records, "err", err)
+			return records, nil
+		}
+		records++
+	}
+}
+
+// valuesSize returns the size of quantity values of table, packed like in a read
+// response.
+func valuesSize(table model.TableType, quantity uint16) int {
+	if table == model.TableCoils || table == model.TableDiscreteInputs {
+		return (int(quantity) + 7) / 8
+	}
+	return 2 * int(quantity)
+}
+
+// Save compacts the write-ahead log into the snapshot.
 func (ms *FileStorage) Save(m *model.DataModel) error {
-	return ms.sync()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.mark(0, totalSize)
+	return ms.compact()
 }
 
-// OnWrite triggers a sync for persistence.
+// OnWrite appends the values written to the write-ahead log and syncs it.
 func (ms *FileStorage) OnWrite(table model.TableType, address, quantity uint16) {
-	// For "Real-time" persistence, we sync the file.
-	// Given the requirement "ensure data can be recovered", we should sync.
-	if err := ms.sync(); err != nil {
-		slog.Error("Failed to sync file", "err", err)
+	if ms.model == nil {
+		return
+	}
+	values, err := read(ms.model, table, address, quantity)
+	if err != nil {
+		slog.Error("Failed to read values written", "table", table, "address", address, "quantity", quantity, "err", err)
+		return
+	}
+	record := make([]byte, 5, 5+len(values)+4)
+	record[0] = byte(table)
+	binary.BigEndian.PutUint16(record[1:], address)
+	binary.BigEndian.PutUint16(record[3:], quantity)
+	record = append(record, values...)
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.wal == nil {
+		return // Closed
+	}
+	if err := ms.append(record); err != nil {
+		slog.Error("Failed to persist values", "table", table, "address", address, "quantity", quantity, "err", err)
+		return
+	}
+	ms.mark(span(table, address, quantity))
+	if ms.walSize >= walLimit {
+		if err := ms.compact(); err != nil {
+			slog.Error("Failed to compact write-ahead log", "err", err)
+		}
+	}
+}
+
+// append writes a record to the log and syncs it, ms.mu held.
+func (ms *FileStorage) append(record []byte) error {
+	if _, err := ms.wal.Write(record); err != nil {
+		return fmt.Errorf("failed to write log: %w", err)
+	}
+	ms.walSize += int64(len(record))
+	if err := ms.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync log to disk: %w", err)
 	}
+	return nil
 }
 
-func (ms *FileStorage) sync() error {
-	if ms.data == nil || ms.file == nil {
+// mark marks the pages of the snapshot holding its n bytes at off as written, ms.mu
+// held.
+func (ms *FileStorage) mark(off, n int) {
+	for page := off / pageSize; page <= (off+n-1)/pageSize && page < len(ms.dirty); page++ {
+		ms.dirty[page] = true
+	}
+}
+
+// compact writes the pages of the snapshot marked, syncs it, then empties the log,
+// ms.mu held.
+func (ms *FileStorage) compact() error {
+	if ms.data == nil || ms.file == nil || ms.wal == nil {
 		return nil
 	}
-	if _, err := ms.file.WriteAt(ms.data, 0); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	for page := 0; page < len(ms.dirty); page++ {
+		if !ms.dirty[page] {
+			continue
+		}
+		end := page + 1
+		for end < len(ms.dirty) && ms.dirty[end] {
+			end++
+		}
+		off := page * pageSize
+		if _, err := ms.file.WriteAt(ms.data[off:min(end*pageSize, totalSize)], int64(off)); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		page = end
 	}
 	if err := ms.file.Sync(); err != nil {
 		return fmt.Errorf("failed to sync file to disk: %w", err)
 	}
-	return nil
+	if err := ms.wal.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate log: %w", err)
+	}
+	ms.walSize = 0
+	clear(ms.dirty)
+	return ms.wal.Sync()
 }
 
-// Close the file.
+// Close compacts the log and closes the files.
 func (ms *FileStorage) Close() error {
-	ms.file.Close()
-	return nil
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	err := ms.compact()
+	if ms.wal != nil {
+		ms.wal.Close()
+	}
+	if ms.file != nil {
+		ms.file.Close()
+	}
+	ms.file, ms.wal, ms.data = nil, nil, nil
+	return err
 }
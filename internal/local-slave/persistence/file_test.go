@@ -0,0 +1,86 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package persistence
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+)
+
+func TestFileStorage_WriteAheadLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "slave.bin")
+	s := NewFileStorage(path)
+	m, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defer s.Close()
+
+	m.WriteSingleRegister(10, 0x1234)
+	s.OnWrite(model.TableHoldingRegisters, 10, 1)
+	m.WriteMultipleCoils(5, 3, []byte{0x05})
+	s.OnWrite(model.TableCoils, 5, 3)
+	m.Load(model.TableInputRegisters, 65534, 2, []byte{0, 1, 0, 2})
+	s.OnWrite(model.TableInputRegisters, 65534, 2)
+
+	snapshot, _ := os.ReadFile(path)
+	if m := mapBytesToModel(snapshot); m.HoldingRegisters[10] != 0 {
+		t.Error("write went to the snapshot, want only the log")
+	}
+
+	// A crash: the files as they are, with a record torn at the end of the log
+	crashed := filepath.Join(dir, "crashed.bin")
+	wal, _ := os.ReadFile(path + ".wal")
+	if err := os.WriteFile(crashed, snapshot, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(crashed+".wal", append(wal, byte(model.TableHoldingRegisters), 0, 20, 0), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recovered := NewFileStorage(crashed)
+	rm, err := recovered.Load()
+	if err != nil {
+		t.Fatalf("Load() after a crash error = %v", err)
+	}
+	if rm.HoldingRegisters[10] != 0x1234 || !rm.Coils.Get(5) || rm.Coils.Get(6) || !rm.Coils.Get(7) || rm.InputRegisters[65535] != 2 {
+		t.Errorf("recovered register %#x, coils % X, input register %d", rm.HoldingRegisters[10], rm.Coils[:1], rm.InputRegisters[65535])
+	}
+	recovered.Close()
+	if fi, err := os.Stat(crashed + ".wal"); err != nil || fi.Size() != 0 {
+		t.Errorf("log after recovery: %v, want compacted", fi)
+	}
+
+	// Compacting rewrites the pages written only, a change to another stays
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0xAA}, offsetInput)
+	f.Close()
+	s.mu.Lock()
+	err = s.compact()
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatalf("compact() error = %v", err)
+	}
+	snapshot, _ = os.ReadFile(path)
+	if m := mapBytesToModel(snapshot); m.HoldingRegisters[10] != 0x1234 || snapshot[offsetInput] != 0xAA {
+		t.Errorf("snapshot after compaction: register %#x, untouched page %#x", m.HoldingRegisters[10], snapshot[offsetInput])
+	}
+
+	if err := s.Save(m); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if fi, err := os.Stat(path + ".wal"); err != nil || fi.Size() != 0 {
+		t.Errorf("log after Save(): %v, want empty", fi)
+	}
+	snapshot, _ = os.ReadFile(path)
+	if m := mapBytesToModel(snapshot); m.HoldingRegisters[10] != 0x1234 {
+		t.Errorf("snapshot register after Save() = %#x, want 0x1234", m.HoldingRegisters[10])
+	}
+}
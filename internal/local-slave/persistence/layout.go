@@ -1,24 +1,50 @@
 package persistence
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
 	"unsafe"
 
 	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
 )
 
 const (
-	sizeCoils    = model.MaxAddress + 1
-	sizeDiscrete = model.MaxAddress + 1
+	sizeCoils    = model.BitsSize
+	sizeDiscrete = model.BitsSize
 	sizeHolding  = (model.MaxAddress + 1) * 2
 	sizeInput    = (model.MaxAddress + 1) * 2
 	totalSize    = sizeCoils + sizeDiscrete + sizeHolding + sizeInput
 
+	// legacySize is the size of files written when coils and discrete inputs took a byte each
+	legacySize = 2*(model.MaxAddress+1) + sizeHolding + sizeInput
+
 	offsetCoils    = 0
 	offsetDiscrete = offsetCoils + sizeCoils
 	offsetHolding  = offsetDiscrete + sizeDiscrete
 	offsetInput    = offsetHolding + sizeHolding
 )
 
+// span returns the offset and length of the bytes holding quantity values of table
+// from address in the layout.
+func span(table model.TableType, address, quantity uint16) (int, int) {
+	switch table {
+	case model.TableCoils, model.TableDiscreteInputs:
+		first, last := int(address)/8, (int(address)+int(quantity)-1)/8
+		if table == model.TableCoils {
+			return offsetCoils + first, last - first + 1
+		}
+		return offsetDiscrete + first, last - first + 1
+	case model.TableHoldingRegisters:
+		return offsetHolding + 2*int(address), 2 * int(quantity)
+	}
+	return offsetInput + 2*int(address), 2 * int(quantity)
+}
+
 // mapBytesToModel constructs a DataModel backed by the provided data slice.
 // Warning: This function uses unsafe pointers to cast byte slices to uint16 slices.
 // The resulting DataModel relies on the host's endianness for multi-byte values.
@@ -27,10 +53,10 @@ const (
 func mapBytesToModel(data []byte) *model.DataModel {
 	m := &model.DataModel{}
 
-	// Coils (Bytes)
+	// Coils (Packed bits)
 	m.Coils = data[offsetCoils : offsetCoils+sizeCoils]
 
-	// Discrete Inputs (Bytes)
+	// Discrete Inputs (Packed bits)
 	m.DiscreteInputs = data[offsetDiscrete : offsetDiscrete+sizeDiscrete]
 
 	// Holding Registers (Uint16)
@@ -43,3 +69,72 @@ func mapBytesToModel(data []byte) *model.DataModel {
 
 	return m
 }
+
+// migrateLegacy rewrites a file of the legacy layout, with a byte per coil and
+// discrete input, to the packed layout. Files of other sizes are left alone.
+//
+// The packed image is written to a temporary file next to it and renamed over it,
+// so a crash leaves either the legacy file or the migrated one, never a mix that
+// would be migrated again on the next start.
+func migrateLegacy(path string) error {
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil || fi.Size() != legacySize {
+		return err
+	}
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read legacy file: %w", err)
+	}
+
+	data := make([]byte, totalSize)
+	for i := 0; i <= model.MaxAddress; i++ {
+		model.Bits(data[offsetCoils:]).Set(uint16(i), old[i] != 0)
+		model.Bits(data[offsetDiscrete:]).Set(uint16(i), old[model.MaxAddress+1+i] != 0)
+	}
+	copy(data[offsetHolding:], old[2*(model.MaxAddress+1):])
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".migrate-*")
+	if err != nil {
+		return fmt.Errorf("failed to create migrated file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // Once renamed, removes nothing
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fi.Mode().Perm())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write migrated file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace legacy file: %w", err)
+	}
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync directory of migrated file: %w", err)
+	}
+	slog.Info("Migrated persistence file to packed coils and discrete inputs", "path", path)
+	return nil
+}
+
+// syncDir syncs the entries of dir, such as a file renamed in it. Windows can't
+// sync directories, and makes renames durable itself.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package persistence
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+)
+
+func TestLoad_MigratesLegacyLayout(t *testing.T) {
+	for name, open := range map[string]func(string) Storage{
+		"file": func(path string) Storage { return NewFileStorage(path) },
+		"mmap": func(path string) Storage { return NewMmapStorage(path) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			// A byte per coil and discrete input, then the registers in host order
+			legacy := make([]byte, legacySize)
+			legacy[3], legacy[model.MaxAddress] = 1, 1
+			legacy[model.MaxAddress+1+9] = 1
+			binary.NativeEndian.PutUint16(legacy[2*(model.MaxAddress+1)+2*7:], 0x1234)
+			binary.NativeEndian.PutUint16(legacy[2*(model.MaxAddress+1)+sizeHolding+2*5:], 0xABCD)
+			path := filepath.Join(t.TempDir(), "slave.bin")
+			if err := os.WriteFile(path, legacy, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			s := open(path)
+			m, err := s.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			defer s.(interface{ Close() error }).Close()
+
+			if !m.Coils.Get(3) || !m.Coils.Get(model.MaxAddress) || m.Coils.Get(4) {
+				t.Errorf("coils not migrated: % X", m.Coils[:1])
+			}
+			if !m.DiscreteInputs.Get(9) || m.DiscreteInputs.Get(3) {
+				t.Errorf("discrete inputs not migrated: % X", m.DiscreteInputs[:2])
+			}
+			if m.HoldingRegisters[7] != 0x1234 || m.InputRegisters[5] != 0xABCD {
+				t.Errorf("registers not migrated: %04X, %04X", m.HoldingRegisters[7], m.InputRegisters[5])
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != totalSize {
+				t.Errorf("file size after migration = %d, want %d", fi.Size(), totalSize)
+			}
+			if left, _ := filepath.Glob(path + ".migrate-*"); len(left) != 0 {
+				t.Errorf("temporary files left after migration: %v", left)
+			}
+		})
+	}
+}
+
+func TestSpan(t *testing.T) {
+	for _, tt := range []struct {
+		table            model.TableType
+		address, count   uint16
+		wantOff, wantLen int
+	}{
+		{model.TableCoils, 5, 3, offsetCoils, 1},
+		{model.TableCoils, 7, 2, offsetCoils, 2},
+		{model.TableDiscreteInputs, 65535, 1, offsetDiscrete + 8191, 1},
+		{model.TableHoldingRegisters, 10, 3, offsetHolding + 20, 6},
+		{model.TableInputRegisters, 65535, 1, offsetInput + 131070, 2},
+	} {
+		if off, n := span(tt.table, tt.address, tt.count); off != tt.wantOff || n != tt.wantLen {
+			t.Errorf("span(%d, %d, %d) = %d, %d, want %d, %d", tt.table, tt.address, tt.count, off, n, tt.wantOff, tt.wantLen)
+		}
+	}
+}
@@ -17,11 +17,13 @@ import (
 // This provides OS-managed persistence and efficient memory usage.
 //
 // Layout:
-// - Coils: 65536 bytes (Offset 0)
-// - DiscreteInputs: 65536 bytes (Offset 65536)
-// - HoldingRegisters: 65536 * 2 bytes (Offset 131072)
-// - InputRegisters: 65536 * 2 bytes (Offset 262144)
-// Total Size: 393216 bytes
+// - Coils: 8192 bytes, packed (Offset 0)
+// - DiscreteInputs: 8192 bytes, packed (Offset 8192)
+// - HoldingRegisters: 65536 * 2 bytes (Offset 16384)
+// - InputRegisters: 65536 * 2 bytes (Offset 147456)
+// Total Size: 278528 bytes
+//
+// Files of the former layout, with a byte per coil and discrete input, are migrated on load.
 type MmapStorage struct {
 	path string
 	file *os.File
@@ -37,6 +39,10 @@ func NewMmapStorage(path string) *MmapStorage {
 
 // Load loads the data model by memory-mapping the file.
 func (ms *MmapStorage) Load() (*model.DataModel, error) {
+	if err := migrateLegacy(ms.path); err != nil {
+		return nil, err
+	}
+
 	// Open file, creating if necessary
 	f, err := os.OpenFile(ms.path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
@@ -78,13 +84,14 @@ func (ms *MmapStorage) Save(m *model.DataModel) error {
 	return ms.data.Flush()
 }
 
-// OnWrite triggers a flush for persistence.
+// OnWrite flushes the pages holding the values written.
 func (ms *MmapStorage) OnWrite(table model.TableType, address, quantity uint16) {
-	if ms.data == nil {
+	if ms.data == nil || quantity == 0 {
 		return
 	}
 	// For "Real-time" persistence, flush mmap data to disk
-	if err := ms.data.Flush(); err != nil {
+	off, n := span(table, address, quantity)
+	if err := flush(ms.data, off, n); err != nil {
 		slog.Error("Failed to flush mmap", "err", err)
 	}
 }
@@ -0,0 +1,14 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+//go:build !unix
+
+package persistence
+
+import "github.com/edsrzf/mmap-go"
+
+// flush syncs the whole mapping of data, ranges are flushed on Unix only.
+func flush(data mmap.MMap, off, n int) error {
+	return data.Flush()
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+//go:build unix
+
+package persistence
+
+import (
+	"os"
+
+	"github.com/edsrzf/mmap-go"
+	"golang.org/x/sys/unix"
+)
+
+// flush syncs the pages of data holding its n bytes at off, msync taking a range
+// starting on a page.
+func flush(data mmap.MMap, off, n int) error {
+	page := os.Getpagesize()
+	start, end := off/page*page, min(off+n, len(data))
+	return unix.Msync(data[start:end], unix.MS_SYNC)
+}
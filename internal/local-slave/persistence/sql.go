@@ -8,17 +8,51 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
 )
 
+const (
+	sqlQueueSize = 1024 // Writes waiting for the database, beyond which they are dropped
+	sqlBatchSize = 256  // Writes committed in one transaction at most
+
+	sqlWarnInterval = 10 * time.Second // Between warnings about writes dropped
+)
+
+const upsertQuery = "INSERT INTO modbus_registers (table_type, address, value) VALUES (?, ?, ?) ON CONFLICT(table_type, address) DO UPDATE SET value=excluded.value"
+
 // SQLStorage implements persistence using a SQL database.
 // It assumes a table `modbus_registers` exists (or creates it).
+//
+// Writes are queued and stored by a background writer, off the path of requests:
+// it commits the writes queued in one transaction, upserting each register with a
+// prepared statement. A write finding the queue full is dropped, counted by
+// Dropped and warned about at most every sqlWarnInterval. The writes of a
+// transaction that fails are dropped too, counted and warned about each time.
+// Writes still queued when the gateway crashes are lost; Close stores those queued
+// before closing the database.
 type SQLStorage struct {
 	driver string
 	dsn    string
 	db     *sql.DB
 	model  *model.DataModel
+
+	upsert  *sql.Stmt
+	mu      sync.RWMutex // Guards sending to queue against Close
+	queue   chan sqlWrite
+	done    chan struct{}
+	dropped atomic.Uint64
+	warned  atomic.Int64 // Unix nanoseconds of the last warning about writes dropped
+}
+
+// sqlWrite is a write queued, with the values written.
+type sqlWrite struct {
+	table   model.TableType
+	address uint16
+	values  []int64
 }
 
 // NewSQLStorage creates a new SQLStorage.
@@ -42,6 +76,11 @@ func (s *SQLStorage) Load() (*model.DataModel, error) {
 		db.Close()
 		return nil, fmt.Errorf("failed to init schema: %w", err)
 	}
+	upsert, err := db.Prepare(upsertQuery)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare upsert: %w", err)
+	}
 
 	m := model.NewDataModel()
 	s.model = m // Keep reference for OnWrite logic if needed (though we have values)
@@ -49,6 +88,7 @@ func (s *SQLStorage) Load() (*model.DataModel, error) {
 	// Load data from DB
 	rows, err := db.Query("SELECT table_type, address, value FROM modbus_registers")
 	if err != nil {
+		upsert.Close()
 		db.Close()
 		return nil, fmt.Errorf("failed to query registers: %w", err)
 	}
@@ -66,9 +106,9 @@ func (s *SQLStorage) Load() (*model.DataModel, error) {
 
 		switch model.TableType(t) {
 		case model.TableCoils:
-			m.Coils[addr] = byte(val)
+			m.Coils.Set(uint16(addr), val != 0)
 		case model.TableDiscreteInputs:
-			m.DiscreteInputs[addr] = byte(val)
+			m.DiscreteInputs.Set(uint16(addr), val != 0)
 		case model.TableHoldingRegisters:
 			m.HoldingRegisters[addr] = uint16(val)
 		case model.TableInputRegisters:
@@ -76,6 +116,9 @@ func (s *SQLStorage) Load() (*model.DataModel, error) {
 		}
 	}
 
+	s.upsert = upsert
+	s.queue, s.done = make(chan sqlWrite, sqlQueueSize), make(chan struct{})
+	go s.run(s.queue)
 	return m, nil
 }
 
@@ -102,50 +145,109 @@ func (s *SQLStorage) Save(m *model.DataModel) error {
 	return nil
 }
 
-// OnWrite upserts the changed register to the DB.
+// OnWrite queues the values written for the background writer, or drops them if
+// the queue is full.
 func (s *SQLStorage) OnWrite(table model.TableType, address, quantity uint16) {
-	if s.db == nil || s.model == nil {
+	if s.model == nil || quantity == 0 {
 		return
 	}
+	// OnWrite is called AFTER the model update, the values are read from it
+	data, err := read(s.model, table, address, quantity)
+	if err != nil {
+		slog.Error("Failed to read values written", "table", table, "address", address, "quantity", quantity, "err", err)
+		return
+	}
+	w := sqlWrite{table: table, address: address, values: make([]int64, quantity)}
+	for i := range w.values {
+		switch table {
+		case model.TableCoils, model.TableDiscreteInputs:
+			w.values[i] = int64(data[i/8] >> (i % 8) & 1)
+		default:
+			w.values[i] = int64(data[2*i])<<8 | int64(data[2*i+1])
+		}
+	}
 
-	// We need to read the new values from the model to write them.
-	// Since OnWrite is called AFTER model update, we can read s.model.
-	// To avoid blocking the caller too long, we might want to do this async,
-	// but "real-time persistence" implies safety.
-	// We'll do it synchronously for now or fire a goroutine?
-	// The prompt implies "real-time persistence" to prevent data loss on power failure.
-	// Sync write is safer.
-
-	// Use a transaction for the batch?
-	// But `quantity` is usually small (1 or a few).
-	// If quantity is large, batch insert is better.
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.queue == nil {
+		return // Closed
+	}
+	select {
+	case s.queue <- w:
+	default:
+		dropped := s.dropped.Add(1)
+		now, last := time.Now().UnixNano(), s.warned.Load()
+		if now-last >= int64(sqlWarnInterval) && s.warned.CompareAndSwap(last, now) {
+			slog.Warn("Persistence queue full, dropping writes", "dropped", dropped, "size", sqlQueueSize)
+		}
+	}
+}
 
-	for i := 0; i < int(quantity); i++ {
-		addr := int(address) + i
-		var val int64
+// Dropped returns how many writes were dropped as the queue was full or their
+// transaction failed.
+func (s *SQLStorage) Dropped() uint64 {
+	return s.dropped.Load()
+}
 
-		switch table {
-		case model.TableCoils:
-			val = int64(s.model.Coils[addr])
-		case model.TableDiscreteInputs:
-			val = int64(s.model.DiscreteInputs[addr])
-		case model.TableHoldingRegisters:
-			val = int64(s.model.HoldingRegisters[addr])
-		case model.TableInputRegisters:
-			val = int64(s.model.InputRegisters[addr])
+// run stores the writes of queue until it is closed, in batches. Close clears
+// s.queue, so it takes the queue as an argument.
+func (s *SQLStorage) run(queue <-chan sqlWrite) {
+	defer close(s.done)
+	for w := range queue {
+		batch := []sqlWrite{w}
+	drain:
+		for len(batch) < sqlBatchSize {
+			select {
+			case w, ok := <-queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, w)
+			default:
+				break drain
+			}
 		}
+		if err := s.store(batch); err != nil {
+			dropped := s.dropped.Add(uint64(len(batch)))
+			slog.Warn("Failed to persist registers, dropping writes", "writes", len(batch), "dropped", dropped, "err", err)
+		}
+	}
+}
 
-		// Upsert logic (SQLite compatible)
-		// "INSERT OR REPLACE" or "ON CONFLICT"
-		query := "INSERT INTO modbus_registers (table_type, address, value) VALUES (?, ?, ?) ON CONFLICT(table_type, address) DO UPDATE SET value=excluded.value"
-		_, err := s.db.Exec(query, int(table), addr, val)
-		if err != nil {
-			slog.Error("Failed to persist register", "table", table, "addr", addr, "err", err)
+// store upserts the registers of batch in one transaction.
+func (s *SQLStorage) store(batch []sqlWrite) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	upsert := tx.Stmt(s.upsert)
+	for _, w := range batch {
+		for i, v := range w.values {
+			if _, err := upsert.Exec(int(w.table), int(w.address)+i, v); err != nil {
+				tx.Rollback()
+				return err
+			}
 		}
 	}
+	return tx.Commit()
 }
 
+// Close stores the writes queued and closes the database.
 func (s *SQLStorage) Close() error {
+	s.mu.Lock()
+	if s.queue != nil {
+		close(s.queue)
+		s.queue = nil
+	}
+	s.mu.Unlock()
+	if s.done != nil {
+		<-s.done
+		s.done = nil
+	}
+	if s.upsert != nil {
+		s.upsert.Close()
+		s.upsert = nil
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
@@ -0,0 +1,192 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package persistence
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+)
+
+// fakeDB is a database of the "fakesql" driver, storing the upserts of
+// modbus_registers.
+type fakeDB struct {
+	mu       sync.Mutex
+	values   map[[2]int64]int64 // By table type and address
+	prepared int
+	commits  int
+	failing  bool          // Commit fails if set
+	gate     chan struct{} // Exec waits for it if not nil
+	waiting  chan struct{} // Closed once Exec waits for gate
+	once     sync.Once
+}
+
+var fakeDBs = map[string]*fakeDB{}
+
+func init() {
+	sql.Register("fakesql", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{db: fakeDBs[name]}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.prepared++
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return &fakeTx{db: c.db}, nil }
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx *fakeTx) Commit() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	if tx.db.failing {
+		return errors.New("database is locked")
+	}
+	tx.db.commits++
+	return nil
+}
+func (tx *fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(s.query, "INSERT") {
+		return driver.RowsAffected(0), nil
+	}
+	if s.db.gate != nil {
+		s.db.once.Do(func() { close(s.db.waiting) })
+		<-s.db.gate
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.values[[2]int64{args[0].(int64), args[1].(int64)}] = args[2].(int64)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	rows := &fakeRows{}
+	for k, v := range s.db.values {
+		rows.values = append(rows.values, []driver.Value{k[0], k[1], v})
+	}
+	return rows, nil
+}
+
+type fakeRows struct{ values [][]driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"table_type", "address", "value"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSQLStorage(t *testing.T) {
+	db := &fakeDB{values: make(map[[2]int64]int64)}
+	fakeDBs[t.Name()] = db
+	s := NewSQLStorage("fakesql", t.Name())
+	m, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	for i := uint16(0); i < 300; i++ {
+		m.WriteSingleRegister(i, i+1)
+		s.OnWrite(model.TableHoldingRegisters, i, 1)
+	}
+	m.WriteMultipleCoils(3, 2, []byte{0x02})
+	s.OnWrite(model.TableCoils, 3, 2)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if db.commits == 0 || db.commits > 301 || s.Dropped() != 0 {
+		t.Errorf("%d commits and %d writes dropped for 301 writes", db.commits, s.Dropped())
+	}
+	if db.prepared > 3 { // Schema, upsert and query
+		t.Errorf("%d statements prepared, want the upsert once", db.prepared)
+	}
+
+	s = NewSQLStorage("fakesql", t.Name())
+	if m, err = s.Load(); err != nil {
+		t.Fatalf("Load() after reopening error = %v", err)
+	}
+	defer s.Close()
+	if m.HoldingRegisters[0] != 1 || m.HoldingRegisters[299] != 300 || m.Coils.Get(3) || !m.Coils.Get(4) {
+		t.Errorf("after reopening registers %d and %d, coils % X", m.HoldingRegisters[0], m.HoldingRegisters[299], m.Coils[:1])
+	}
+}
+
+func TestSQLStorage_QueueFull(t *testing.T) {
+	db := &fakeDB{values: make(map[[2]int64]int64), gate: make(chan struct{}), waiting: make(chan struct{})}
+	fakeDBs[t.Name()] = db
+	s := NewSQLStorage("fakesql", t.Name())
+	if _, err := s.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// The writer is stuck on the first write, the queue takes sqlQueueSize more
+	s.OnWrite(model.TableHoldingRegisters, 0, 1)
+	<-db.waiting
+	for i := 1; i <= sqlQueueSize+10; i++ {
+		s.OnWrite(model.TableHoldingRegisters, uint16(i), 1)
+	}
+	if got := s.Dropped(); got != 10 {
+		t.Errorf("Dropped() = %d, want 10", got)
+	}
+	if got := NewDeferredStorage(s, 0).Dropped(); got != 10 {
+		t.Errorf("Dropped() of the deferred storage = %d, want 10", got)
+	}
+	if s.warned.Load() == 0 {
+		t.Error("no warning about the writes dropped")
+	}
+	close(db.gate)
+	s.Close()
+	if len(db.values) != sqlQueueSize+1 {
+		t.Errorf("%d writes stored, want %d", len(db.values), sqlQueueSize+1)
+	}
+}
+
+func TestSQLStorage_CommitFails(t *testing.T) {
+	db := &fakeDB{values: make(map[[2]int64]int64), failing: true}
+	fakeDBs[t.Name()] = db
+	s := NewSQLStorage("fakesql", t.Name())
+	m, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	for i := uint16(0); i < 3; i++ {
+		m.WriteSingleRegister(i, i+1)
+		s.OnWrite(model.TableHoldingRegisters, i, 1)
+	}
+	s.Close()
+	if got := s.Dropped(); got != 3 {
+		t.Errorf("Dropped() = %d, want the 3 writes of failed transactions", got)
+	}
+}
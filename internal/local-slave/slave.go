@@ -5,250 +5,249 @@
 package localslave
 
 import (
-	"encoding/binary"
+	"log/slog"
+	"slices"
+	"sort"
 
+	"github.com/ffutop/modbus-gateway/internal/local-slave/expr"
 	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
 	"github.com/ffutop/modbus-gateway/internal/local-slave/persistence"
 	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
 )
 
 // LocalSlave implements the Modbus protocol logic on top of a DataModel.
 type LocalSlave struct {
 	model   *model.DataModel
 	storage persistence.Storage
-}
 
-// NewLocalSlave creates a new LocalSlave.
-func NewLocalSlave(m *model.DataModel, s persistence.Storage) *LocalSlave {
-	return &LocalSlave{
-		model:   m,
-		storage: s,
-	}
+	ServerID       ServerID       // Answer to Report Server ID
+	Identification Identification // Objects of Read Device Identification
+	Addresses      Addresses      // Addresses served, nil for all
+	Expressions    *expr.Engine   // Values computed when read, nil for none
 }
 
-// Process executes the Modbus Function Code against the memory model.
-func (s *LocalSlave) Process(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	switch req.FunctionCode {
-	case modbus.FuncCodeReadCoils:
-		return s.handleReadCoils(req)
-	case modbus.FuncCodeReadDiscreteInputs:
-		return s.handleReadDiscreteInputs(req)
-	case modbus.FuncCodeReadHoldingRegisters:
-		return s.handleReadHoldingRegisters(req)
-	case modbus.FuncCodeReadInputRegisters:
-		return s.handleReadInputRegisters(req)
-	case modbus.FuncCodeWriteSingleCoil:
-		return s.handleWriteSingleCoil(req)
-	case modbus.FuncCodeWriteSingleRegister:
-		return s.handleWriteSingleRegister(req)
-	case modbus.FuncCodeWriteMultipleCoils:
-		return s.handleWriteMultipleCoils(req)
-	case modbus.FuncCodeWriteMultipleRegisters:
-		return s.handleWriteMultipleRegisters(req)
-	default:
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalFunction), nil
-	}
+// ServerID is what a slave reports about itself with Report Server ID.
+type ServerID struct {
+	ID         []byte // Device specific
+	Running    bool   // Run indicator status
+	Additional []byte
 }
 
-func (s *LocalSlave) handleReadCoils(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) != 4 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	quantity := binary.BigEndian.Uint16(req.Data[2:4])
-
-	if quantity < 1 || quantity > 2000 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	data, err := s.model.ReadCoils(address, quantity)
-	if err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
-	}
+// Identification holds the objects a slave reports with Read Device Identification,
+// by object ID: 0x00 to 0x02 are basic, up to 0x7F regular, the rest extended.
+type Identification map[byte]string
 
-	respData := make([]byte, 1+len(data))
-	respData[0] = byte(len(data))
-	copy(respData[1:], data)
-
-	return modbus.ProtocolDataUnit{
-		FunctionCode: req.FunctionCode,
-		Data:         respData,
-	}, nil
+// AddressRange is a range of addresses, First to Last inclusive.
+type AddressRange struct {
+	First, Last uint16
 }
 
-func (s *LocalSlave) handleReadDiscreteInputs(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) != 4 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	quantity := binary.BigEndian.Uint16(req.Data[2:4])
-
-	if quantity < 1 || quantity > 2000 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	data, err := s.model.ReadDiscreteInputs(address, quantity)
-	if err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
-	}
-
-	respData := make([]byte, 1+len(data))
-	respData[0] = byte(len(data))
-	copy(respData[1:], data)
-
-	return modbus.ProtocolDataUnit{
-		FunctionCode: req.FunctionCode,
-		Data:         respData,
-	}, nil
+// Addresses are the addresses a slave serves by table, requests to others are
+// answered with Illegal Data Address like a real device does. A table without
+// ranges serves all 65536 addresses.
+type Addresses map[model.TableType][]AddressRange
+
+// serves reports whether the ranges of table cover all quantity addresses from
+// address, possibly across adjacent ranges.
+func (a Addresses) serves(table model.TableType, address, quantity uint16) bool {
+	ranges, ok := a[table]
+	if !ok {
+		return true
+	}
+	next, last := int(address), int(address)+int(quantity)-1
+	for next <= last {
+		i := slices.IndexFunc(ranges, func(r AddressRange) bool { return int(r.First) <= next && next <= int(r.Last) })
+		if i < 0 {
+			return false
+		}
+		next = int(ranges[i].Last) + 1
+	}
+	return true
 }
 
-func (s *LocalSlave) handleReadHoldingRegisters(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) != 4 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	quantity := binary.BigEndian.Uint16(req.Data[2:4])
+// DefaultIdentification is what local slaves report unless configured otherwise.
+var DefaultIdentification = Identification{0x00: "modbus-gateway", 0x01: "local-slave", 0x02: "1.0"}
 
-	if quantity < 1 || quantity > 125 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	data, err := s.model.ReadHoldingRegisters(address, quantity)
-	if err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+// NewLocalSlave creates a new LocalSlave.
+func NewLocalSlave(m *model.DataModel, s persistence.Storage) *LocalSlave {
+	return &LocalSlave{
+		model:          m,
+		storage:        s,
+		ServerID:       ServerID{ID: []byte{0x01}, Running: true},
+		Identification: DefaultIdentification,
 	}
-
-	respData := make([]byte, 1+len(data))
-	respData[0] = byte(len(data))
-	copy(respData[1:], data)
-
-	return modbus.ProtocolDataUnit{
-		FunctionCode: req.FunctionCode,
-		Data:         respData,
-	}, nil
 }
 
-func (s *LocalSlave) handleReadInputRegisters(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) != 4 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	quantity := binary.BigEndian.Uint16(req.Data[2:4])
-
-	if quantity < 1 || quantity > 125 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	data, err := s.model.ReadInputRegisters(address, quantity)
+// Process executes the Modbus Function Code against the memory model.
+func (s *LocalSlave) Process(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	parsed, err := pdu.ParseRequest(req)
 	if err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
-	}
-
-	respData := make([]byte, 1+len(data))
-	respData[0] = byte(len(data))
-	copy(respData[1:], data)
-
-	return modbus.ProtocolDataUnit{
-		FunctionCode: req.FunctionCode,
-		Data:         respData,
-	}, nil
-}
-
-func (s *LocalSlave) handleWriteSingleCoil(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) != 4 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	value := binary.BigEndian.Uint16(req.Data[2:4])
-
-	if err := s.model.WriteSingleCoil(address, value); err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
-	}
-	s.storage.OnWrite(model.TableCoils, address, 1)
-
-	return req, nil // Echo request
-}
-
-func (s *LocalSlave) handleWriteSingleRegister(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) != 4 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	value := binary.BigEndian.Uint16(req.Data[2:4])
+		return pdu.ExceptionFromError(req.FunctionCode, err), nil
+	}
+
+	switch r := parsed.(type) {
+	case pdu.ReadCoilsRequest:
+		return s.read(req.FunctionCode, model.TableCoils, s.model.ReadCoils, r.Address, r.Quantity), nil
+	case pdu.ReadDiscreteInputsRequest:
+		return s.read(req.FunctionCode, model.TableDiscreteInputs, s.model.ReadDiscreteInputs, r.Address, r.Quantity), nil
+	case pdu.ReadHoldingRegistersRequest:
+		return s.read(req.FunctionCode, model.TableHoldingRegisters, s.model.ReadHoldingRegisters, r.Address, r.Quantity), nil
+	case pdu.ReadInputRegistersRequest:
+		return s.read(req.FunctionCode, model.TableInputRegisters, s.model.ReadInputRegisters, r.Address, r.Quantity), nil
+
+	case pdu.WriteSingleCoilRequest:
+		var value uint16
+		if r.Value {
+			value = 0xFF00
+		}
+		if !s.Addresses.serves(model.TableCoils, r.Address, 1) {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		if err := s.model.WriteSingleCoil(r.Address, value); err != nil {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		s.storage.OnWrite(model.TableCoils, r.Address, 1)
+		return req, nil // Echo request
+
+	case pdu.WriteSingleRegisterRequest:
+		if s.model.IsFIFO(r.Address) {
+			s.model.PushFIFO(r.Address, r.Value)
+			return req, nil
+		}
+		if !s.Addresses.serves(model.TableHoldingRegisters, r.Address, 1) {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		if err := s.model.WriteSingleRegister(r.Address, r.Value); err != nil {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		s.storage.OnWrite(model.TableHoldingRegisters, r.Address, 1)
+		return req, nil // Echo request
+
+	case pdu.WriteMultipleCoilsRequest:
+		quantity := uint16(len(r.Values))
+		if !s.Addresses.serves(model.TableCoils, r.Address, quantity) {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		if err := s.model.WriteMultipleCoils(r.Address, quantity, pdu.PackBits(r.Values)); err != nil {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		s.storage.OnWrite(model.TableCoils, r.Address, quantity)
+		return pdu.WriteMultipleResponse(req.FunctionCode, r.Address, quantity), nil
+
+	case pdu.WriteMultipleRegistersRequest:
+		quantity := uint16(len(r.Values))
+		if s.model.IsFIFO(r.Address) {
+			s.model.PushFIFO(r.Address, r.Values...)
+			return pdu.WriteMultipleResponse(req.FunctionCode, r.Address, quantity), nil
+		}
+		if !s.Addresses.serves(model.TableHoldingRegisters, r.Address, quantity) {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		if err := s.model.WriteMultipleRegisters(r.Address, quantity, pdu.EncodeRegisters(r.Values)); err != nil {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		s.storage.OnWrite(model.TableHoldingRegisters, r.Address, quantity)
+		return pdu.WriteMultipleResponse(req.FunctionCode, r.Address, quantity), nil
+
+	case pdu.MaskWriteRegisterRequest:
+		if !s.Addresses.serves(model.TableHoldingRegisters, r.Address, 1) {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		if err := s.model.MaskWriteRegister(r.Address, r.AndMask, r.OrMask); err != nil {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		s.storage.OnWrite(model.TableHoldingRegisters, r.Address, 1)
+		return req, nil // Echo request
+
+	case pdu.ReadFIFOQueueRequest:
+		values, err := s.model.ReadFIFO(r.Address)
+		if err != nil {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		return pdu.FIFOQueueResponse(values), nil
+
+	case pdu.ReportServerIDRequest:
+		return pdu.ServerIDResponse(s.ServerID.ID, s.ServerID.Running, s.ServerID.Additional), nil
+
+	case pdu.ReadDeviceIDRequest:
+		return s.identify(r), nil
 
-	if err := s.model.WriteSingleRegister(address, value); err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+	default:
+		return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalFunction), nil
 	}
-	s.storage.OnWrite(model.TableHoldingRegisters, address, 1)
-
-	return req, nil // Echo request
 }
 
-func (s *LocalSlave) handleWriteMultipleCoils(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) < 6 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
+// read answers the read functions, which only differ in the table they read from.
+func (s *LocalSlave) read(funcCode byte, table model.TableType, read func(address, quantity uint16) ([]byte, error), address, quantity uint16) modbus.ProtocolDataUnit {
+	if !s.Addresses.serves(table, address, quantity) {
+		return pdu.Exception(funcCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	quantity := binary.BigEndian.Uint16(req.Data[2:4])
-	byteCount := req.Data[4]
-
-	if quantity < 1 || quantity > 1968 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	if byte(len(req.Data)-5) != byteCount {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
+	if err := s.Expressions.Update(table, address, quantity); err != nil {
+		slog.Warn("Failed to compute values of the local slave", "err", err)
+		return pdu.Exception(funcCode, modbus.ExceptionCodeServerDeviceFailure)
 	}
-
-	if err := s.model.WriteMultipleCoils(address, quantity, req.Data[5:]); err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+	data, err := read(address, quantity)
+	if err != nil {
+		return pdu.Exception(funcCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
-	s.storage.OnWrite(model.TableCoils, address, quantity)
-	respData := make([]byte, 4)
-	binary.BigEndian.PutUint16(respData[0:2], address)
-	binary.BigEndian.PutUint16(respData[2:4], quantity)
-
-	return modbus.ProtocolDataUnit{
-		FunctionCode: req.FunctionCode,
-		Data:         respData,
-	}, nil
+	return pdu.ReadResponse(funcCode, data)
 }
 
-func (s *LocalSlave) handleWriteMultipleRegisters(req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	if len(req.Data) < 6 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	address := binary.BigEndian.Uint16(req.Data[0:2])
-	quantity := binary.BigEndian.Uint16(req.Data[2:4])
-	byteCount := req.Data[4]
-
-	if quantity < 1 || quantity > 123 {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	if byte(len(req.Data)-5) != byteCount {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue), nil
-	}
-
-	if err := s.model.WriteMultipleRegisters(address, quantity, req.Data[5:]); err != nil {
-		return s.exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
-	}
-	s.storage.OnWrite(model.TableHoldingRegisters, address, quantity)
-	respData := make([]byte, 4)
-
-	binary.BigEndian.PutUint16(respData[0:2], address)
-	binary.BigEndian.PutUint16(respData[2:4], quantity)
+// identify answers Read Device Identification. Stream access returns the objects of
+// the category from the one asked for, restarting at the first if it doesn't exist,
+// and as many as fit with more following.
+func (s *LocalSlave) identify(req pdu.ReadDeviceIDRequest) modbus.ProtocolDataUnit {
+	const fc = modbus.FuncCodeReadDeviceIdentification
+	ids := make([]int, 0, len(s.Identification))
+	conformity := byte(pdu.DeviceIDBasic)
+	for id := range s.Identification {
+		ids = append(ids, int(id))
+		conformity = max(conformity, category(id))
+	}
+	sort.Ints(ids)
+	conformity |= 0x80 // Individual access too
+
+	if req.Code == pdu.DeviceIDIndividual {
+		value, ok := s.Identification[req.ObjectID]
+		if !ok {
+			return pdu.Exception(fc, modbus.ExceptionCodeIllegalDataAddress)
+		}
+		return pdu.DeviceIDResponse(req.Code, conformity, []pdu.DeviceObject{{ID: req.ObjectID, Value: fit(value)}}, 0)
+	}
+
+	start := req.ObjectID
+	if _, ok := s.Identification[start]; !ok || category(start) > req.Code {
+		start = 0
+	}
+	var objects []pdu.DeviceObject
+	size := 0
+	for _, id := range ids {
+		if id < int(start) || category(byte(id)) > req.Code {
+			continue
+		}
+		value := fit(s.Identification[byte(id)])
+		if size += 2 + len(value); size > pdu.MaxDeviceObjects {
+			return pdu.DeviceIDResponse(req.Code, conformity, objects, byte(id))
+		}
+		objects = append(objects, pdu.DeviceObject{ID: byte(id), Value: value})
+	}
+	return pdu.DeviceIDResponse(req.Code, conformity, objects, 0)
+}
 
-	return modbus.ProtocolDataUnit{
-		FunctionCode: req.FunctionCode,
-		Data:         respData,
-	}, nil
+// fit truncates an object value to the size of a response on its own, so stream
+// access never answers without objects and the next object ID asked for again.
+func fit(value string) []byte {
+	return []byte(value[:min(len(value), pdu.MaxDeviceObjects-2)])
 }
 
-func (s *LocalSlave) exception(funcCode byte, code byte) modbus.ProtocolDataUnit {
-	return modbus.ProtocolDataUnit{
-		FunctionCode: funcCode | 0x80,
-		Data:         []byte{code},
+// category returns the read device ID code of the category an object belongs to.
+func category(id byte) byte {
+	switch {
+	case id <= 0x02:
+		return pdu.DeviceIDBasic
+	case id <= 0x7F:
+		return pdu.DeviceIDRegular
 	}
+	return pdu.DeviceIDExtended
 }
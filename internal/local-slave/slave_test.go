@@ -0,0 +1,39 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package localslave
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+	"github.com/ffutop/modbus-gateway/internal/local-slave/persistence"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+func TestLocalSlave_OversizedIdentification(t *testing.T) {
+	s := NewLocalSlave(model.NewDataModel(), persistence.NewMemoryStorage())
+	s.Identification = Identification{0x00: "vendor", 0x01: "product", 0x02: "1.0", 0x80: strings.Repeat("x", 300)}
+
+	// Stream access reaches the oversized object in a response of its own, truncated
+	req := pdu.ReadDeviceIDRequest{Code: pdu.DeviceIDExtended}
+	for i := 0; i < 3; i++ {
+		resp, err := s.Process(req.PDU())
+		if err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		data := resp.Data
+		if len(data) < 6 || data[5] == 0 {
+			t.Fatalf("response without objects to object %#x: % X", req.ObjectID, data)
+		}
+		if data[3] == 0 {
+			if data[6] != 0x80 || int(data[7]) != pdu.MaxDeviceObjects-2 {
+				t.Errorf("last response object %#x of %d bytes, want 0x80 truncated", data[6], data[7])
+			}
+			return
+		}
+		req.ObjectID = data[4]
+	}
+	t.Error("stream access doesn't end")
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package logfile writes the gateway log and frame captures to files rotated by
+// size and age.
+//
+// A rotated file is renamed with the time of rotation appended, e.g.
+// "gateway.log.20260102-150405", and optionally compressed to a .gz file in the
+// background. The oldest backups beyond a limit are removed.
+package logfile
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTime is the layout of the time appended to rotated files.
+const backupTime = "20060102-150405"
+
+// File is a log file, rotated as it is written.
+type File struct {
+	Path       string
+	MaxSize    int64         // Bytes after which the file is rotated, 0 never
+	MaxAge     time.Duration // Time after which the file is rotated, counted from opening it, 0 never
+	MaxBackups int           // Rotated files kept, 0 keeps all
+	Compress   bool          // Compress rotated files with gzip
+	Header     []byte        // Written at the start of every new file, e.g. the header of a file format
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	wg     sync.WaitGroup // Compression and cleanup in the background
+	bg     sync.Mutex     // Held by the one compressing or cleaning up
+
+	now func() time.Time // For tests
+}
+
+// Open opens the file at path for appending, creating it if needed. Rotation
+// settings may be set on the file before the first write.
+func Open(path string) (*File, error) {
+	l := &File{Path: path, now: time.Now}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *File) open() error {
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size, l.opened = f, info.Size(), l.now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if p would exceed MaxSize or the
+// file is older than MaxAge. A record larger than MaxSize goes to a file of its own.
+func (l *File) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return 0, os.ErrClosed
+	}
+	full := l.MaxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.MaxSize
+	old := l.MaxAge > 0 && l.now().Sub(l.opened) >= l.MaxAge
+	if full || old {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if l.size == 0 && len(l.Header) > 0 {
+		n, err := l.f.Write(l.Header)
+		l.size += int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file and opens a new one. The caller holds the lock.
+func (l *File) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+	backup := l.Path + "." + l.now().Format(backupTime)
+	for i := 1; exists(backup) || exists(backup+".gz"); i++ {
+		backup = fmt.Sprintf("%s.%s.%d", l.Path, l.now().Format(backupTime), i)
+	}
+	if err := os.Rename(l.Path, backup); err != nil {
+		return errors.Join(err, l.open())
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.bg.Lock()
+		defer l.bg.Unlock()
+		if l.Compress {
+			if err := compress(backup); err != nil {
+				slog.Warn("Failed to compress log file", "file", backup, "err", err)
+			}
+		}
+		l.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest backups beyond MaxBackups.
+func (l *File) prune() {
+	if l.MaxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(l.Path + ".[0-9]*")
+	if err != nil {
+		return
+	}
+	// Names sort by the time of rotation
+	sort.Slice(backups, func(i, j int) bool { return backupName(backups[i]) > backupName(backups[j]) })
+	for _, b := range backups[min(l.MaxBackups, len(backups)):] {
+		if err := os.Remove(b); err != nil {
+			slog.Warn("Failed to remove old log file", "file", b, "err", err)
+		}
+	}
+}
+
+// backupName is the name of a backup without its compression suffix.
+func backupName(file string) string {
+	return strings.TrimSuffix(file, ".gz")
+}
+
+// Close waits for compression in the background and closes the file.
+func (l *File) Close() error {
+	l.mu.Lock()
+	f := l.f
+	l.f = nil
+	l.mu.Unlock()
+	l.wg.Wait()
+	if f == nil {
+		return nil
+	}
+	return f.Close()
+}
+
+// compress replaces file with a gzip compressed file.gz. A file removed meanwhile as
+// too old is left alone.
+func compress(file string) (err error) {
+	in, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(file+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}()
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := errors.Join(zw.Close(), out.Close()); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package logfile
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFile_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.MaxSize = 16
+	l.MaxAge = time.Hour
+	l.MaxBackups = 2
+	l.Compress = true
+
+	write := func(s string) {
+		t.Helper()
+		if _, err := l.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first\n")
+	write("second\n")
+	now = now.Add(time.Second)
+	write("third\n") // Exceeds 16 bytes, first and second go to a backup
+	now = now.Add(time.Hour)
+	write("fourth\n") // Third is an hour old
+	now = now.Add(time.Second)
+	write("fifth line\n") // Exceeds 16 bytes, the backup of first and second is removed
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "fifth line\n" {
+		t.Errorf("current file = %q", b)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	sort.Strings(backups)
+	want := []string{path + ".20260102-160406.gz", path + ".20260102-160407.gz"}
+	if len(backups) != len(want) || backups[0] != want[0] || backups[1] != want[1] {
+		t.Fatalf("backups = %v, want the 2 newest %v", backups, want)
+	}
+	for i, content := range []string{"third\n", "fourth\n"} {
+		f, err := os.Open(backups[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(zr)
+		f.Close()
+		if string(b) != content {
+			t.Errorf("backup %s = %q, want %q", backups[i], b, content)
+		}
+	}
+}
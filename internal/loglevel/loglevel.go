@@ -0,0 +1,88 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package loglevel filters log records by the level of the gateway they are about,
+// so one gateway can log at debug level while the others stay quiet.
+package loglevel
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler passes records to its inner handler if they reach the level of their
+// gateway, named by their "gateway" attribute, or the default level for records
+// of no gateway with a level of its own. The inner handler must pass the lowest
+// level used.
+type Handler struct {
+	inner   slog.Handler
+	level   slog.Level            // Default
+	levels  map[string]slog.Level // By gateway
+	min     slog.Level            // Of all levels
+	gateway string                // Of the attributes added by WithAttrs
+	known   bool                  // Whether gateway is set
+}
+
+// New creates a handler passing records to inner, at the levels by gateway and the
+// default level for the others.
+func New(inner slog.Handler, level slog.Level, levels map[string]slog.Level) *Handler {
+	h := &Handler{inner: inner, level: level, levels: levels, min: level}
+	for _, l := range levels {
+		h.min = min(h.min, l)
+	}
+	return h
+}
+
+func (h *Handler) levelOf(gateway string) slog.Level {
+	if l, ok := h.levels[gateway]; ok {
+		return l
+	}
+	return h.level
+}
+
+// Enabled reports whether records of level may be passed. Without the gateway
+// known yet, the lowest level of all decides and Handle filters.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.known {
+		return level >= h.levelOf(h.gateway) && h.inner.Enabled(ctx, level)
+	}
+	return level >= h.min && h.inner.Enabled(ctx, level)
+}
+
+// Handle passes r to the inner handler if it reaches the level of its gateway.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	gateway := h.gateway
+	if !h.known {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "gateway" {
+				gateway = a.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if r.Level < h.levelOf(gateway) {
+		return nil
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler of the attributes, noting the gateway among them.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.inner = h.inner.WithAttrs(attrs)
+	for _, a := range attrs {
+		if a.Key == "gateway" {
+			c.gateway, c.known = a.Value.String(), true
+		}
+	}
+	return &c
+}
+
+// WithGroup returns a handler of the group, attributes in it name no gateway.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.inner = h.inner.WithGroup(name)
+	return &c
+}
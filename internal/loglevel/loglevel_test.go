@@ -0,0 +1,45 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package loglevel
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	inner := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	log := slog.New(New(inner, slog.LevelInfo, map[string]slog.Level{"flaky": slog.LevelDebug, "quiet": slog.LevelError}))
+
+	log.Debug("global debug")
+	log.Info("global info")
+	log.Debug("flaky debug", "gateway", "flaky")
+	log.With("gateway", "flaky").Debug("flaky debug with")
+	log.Debug("other debug", "gateway", "other")
+	log.With("gateway", "quiet").Warn("quiet warn")
+	log.With("gateway", "quiet").WithGroup("g").Error("quiet error")
+
+	got := buf.String()
+	for _, msg := range []string{"global info", "flaky debug", "flaky debug with", "quiet error"} {
+		if !strings.Contains(got, `msg="`+msg+`"`) {
+			t.Errorf("%q not logged:\n%s", msg, got)
+		}
+	}
+	for _, msg := range []string{"global debug", "other debug", "quiet warn"} {
+		if strings.Contains(got, `msg="`+msg+`"`) {
+			t.Errorf("%q logged:\n%s", msg, got)
+		}
+	}
+
+	if log.With("gateway", "other").Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug enabled for a gateway at the default level")
+	}
+	if !log.With("gateway", "flaky").Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug not enabled for the gateway at debug level")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package mirror polls blocks of a downstream in the background into data models of
+// the gateway, one per slave, so masters reading them are answered without waiting
+// for a slow bus.
+//
+// A read is answered from the mirror if it lies within one block whose last poll
+// is younger than the maximum age; anything else, including reads while polls fail,
+// goes to the device. Requests other than reads, such as writes, also reach the
+// device and mark the blocks of their slave stale until the next poll, so a master
+// never reads back a value older than its own write. With write-through, the writes
+// the device confirms are applied to the copy instead, which keeps answering reads,
+// and only other requests mark the blocks stale.
+package mirror
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// tables maps the table names of blocks to their model table and read function code.
+var tables = map[string]struct {
+	table    model.TableType
+	function byte
+	max      uint16
+}{
+	"coil":             {model.TableCoils, modbus.FuncCodeReadCoils, pdu.MaxReadBits},
+	"discrete_input":   {model.TableDiscreteInputs, modbus.FuncCodeReadDiscreteInputs, pdu.MaxReadBits},
+	"holding_register": {model.TableHoldingRegisters, modbus.FuncCodeReadHoldingRegisters, pdu.MaxReadRegisters},
+	"input_register":   {model.TableInputRegisters, modbus.FuncCodeReadInputRegisters, pdu.MaxReadRegisters},
+}
+
+type block struct {
+	slaveID  byte
+	table    model.TableType
+	function byte
+	address  uint16
+	quantity uint16
+	updated  time.Time // Of the last successful poll, zero before it and after a write
+	writes   uint64    // Writes to the slave, so a poll overtaken by one is discarded
+	failing  bool      // The last poll failed, to log changes only
+}
+
+// Mirror is a downstream whose configured blocks are answered from polled copies.
+// It is also a gateway service, which polls them while the gateway runs.
+type Mirror struct {
+	transport.Downstream
+	gateway    string
+	downstream string
+	interval   time.Duration
+	maxAge     time.Duration
+	through    bool // Confirmed writes update the copy
+	now        func() time.Time
+
+	mu     sync.Mutex
+	blocks []*block
+	models map[byte]*model.DataModel
+}
+
+// New mirrors the blocks of cfg polled from ds.
+func New(gateway, downstream string, ds transport.Downstream, cfg config.MirrorConfig) (*Mirror, error) {
+	if cfg.Interval <= 0 || cfg.MaxAge <= 0 {
+		return nil, fmt.Errorf("mirror interval and max_age must be positive")
+	}
+	m := &Mirror{
+		Downstream: ds,
+		gateway:    gateway,
+		downstream: downstream,
+		interval:   cfg.Interval,
+		maxAge:     cfg.MaxAge,
+		through:    cfg.WriteThrough,
+		now:        time.Now,
+		models:     make(map[byte]*model.DataModel),
+	}
+	for i, b := range cfg.Blocks {
+		t, ok := tables[b.Table]
+		if !ok {
+			return nil, fmt.Errorf("mirror block %d: unknown table %q", i, b.Table)
+		}
+		if b.Quantity == 0 || b.Quantity > t.max {
+			return nil, fmt.Errorf("mirror block %d: quantity %d out of range 1-%d", i, b.Quantity, t.max)
+		}
+		if int(b.Address)+int(b.Quantity) > model.MaxAddress+1 {
+			return nil, fmt.Errorf("mirror block %d: addresses beyond %d", i, model.MaxAddress)
+		}
+		m.blocks = append(m.blocks, &block{slaveID: b.SlaveID, table: t.table, function: t.function, address: b.Address, quantity: b.Quantity})
+		if m.models[b.SlaveID] == nil {
+			m.models[b.SlaveID] = model.NewDataModel()
+		}
+	}
+	return m, nil
+}
+
+// Send answers reads within a fresh block from the mirror, and forwards other requests.
+func (m *Mirror) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if resp, ok := m.answer(slaveID, req); ok {
+		return resp, nil
+	}
+	resp, err := m.Downstream.Send(ctx, slaveID, req)
+	if !isRead(req) && err == nil && resp.FunctionCode == req.FunctionCode {
+		m.mu.Lock()
+		applied := m.through && m.apply(slaveID, req)
+		for _, b := range m.blocks {
+			if b.slaveID == slaveID {
+				if !applied {
+					b.updated = time.Time{}
+				}
+				b.writes++ // Discards polls in flight either way
+			}
+		}
+		m.mu.Unlock()
+	}
+	return resp, err
+}
+
+// apply writes a write the device confirmed to the copy of its slave, reporting
+// whether it knew how to.
+func (m *Mirror) apply(slaveID byte, req modbus.ProtocolDataUnit) bool {
+	dm := m.models[slaveID]
+	if dm == nil {
+		return false
+	}
+	parsed, err := pdu.ParseRequest(req)
+	if err != nil {
+		return false
+	}
+	switch r := parsed.(type) {
+	case pdu.WriteSingleCoilRequest:
+		var value uint16
+		if r.Value {
+			value = 0xFF00
+		}
+		err = dm.WriteSingleCoil(r.Address, value)
+	case pdu.WriteMultipleCoilsRequest:
+		err = dm.WriteMultipleCoils(r.Address, uint16(len(r.Values)), pdu.PackBits(r.Values))
+	case pdu.WriteSingleRegisterRequest:
+		err = dm.WriteSingleRegister(r.Address, r.Value)
+	case pdu.WriteMultipleRegistersRequest:
+		err = dm.WriteMultipleRegisters(r.Address, uint16(len(r.Values)), pdu.EncodeRegisters(r.Values))
+	case pdu.MaskWriteRegisterRequest:
+		err = dm.MaskWriteRegister(r.Address, r.AndMask, r.OrMask)
+	default:
+		return false
+	}
+	return err == nil
+}
+
+func isRead(req modbus.ProtocolDataUnit) bool {
+	switch req.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters:
+		return true
+	}
+	return false
+}
+
+// answer reads req from the mirror, if a fresh block covers it.
+func (m *Mirror) answer(slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, bool) {
+	if !isRead(req) || len(req.Data) != 4 {
+		return modbus.ProtocolDataUnit{}, false
+	}
+	address := binary.BigEndian.Uint16(req.Data)
+	quantity := binary.BigEndian.Uint16(req.Data[2:])
+	if quantity == 0 {
+		return modbus.ProtocolDataUnit{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for _, b := range m.blocks {
+		if b.slaveID != slaveID || b.function != req.FunctionCode || b.updated.IsZero() || now.Sub(b.updated) > m.maxAge ||
+			address < b.address || int(address)+int(quantity) > int(b.address)+int(b.quantity) {
+			continue
+		}
+		data, err := read(m.models[slaveID], b.table, address, quantity)
+		if err != nil {
+			return modbus.ProtocolDataUnit{}, false
+		}
+		return pdu.ReadResponse(req.FunctionCode, data), true
+	}
+	return modbus.ProtocolDataUnit{}, false
+}
+
+func read(dm *model.DataModel, table model.TableType, address, quantity uint16) ([]byte, error) {
+	switch table {
+	case model.TableCoils:
+		return dm.ReadCoils(address, quantity)
+	case model.TableDiscreteInputs:
+		return dm.ReadDiscreteInputs(address, quantity)
+	case model.TableHoldingRegisters:
+		return dm.ReadHoldingRegisters(address, quantity)
+	}
+	return dm.ReadInputRegisters(address, quantity)
+}
+
+// Run polls every block once per interval until ctx is cancelled.
+func (m *Mirror) Run(ctx context.Context) error {
+	slog.Info("Mirroring blocks", "gateway", m.gateway, "downstream", m.downstream, "blocks", len(m.blocks), "interval", m.interval)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		for _, b := range m.blocks {
+			m.poll(ctx, b)
+			if ctx.Err() != nil {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads b from the device into the model of its slave.
+func (m *Mirror) poll(ctx context.Context, b *block) {
+	m.mu.Lock()
+	writes := b.writes
+	m.mu.Unlock()
+
+	req := modbus.ProtocolDataUnit{FunctionCode: b.function, Data: binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, b.address), b.quantity)}
+	resp, err := m.Downstream.Send(ctx, b.slaveID, req)
+	if err == nil && resp.FunctionCode != req.FunctionCode {
+		err = fmt.Errorf("exception response % X", resp.Data)
+	}
+	if err == nil {
+		err = pdu.ValidateResponse(req, resp)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil && b.writes != writes {
+		return // The values may predate the write, the next poll reads them again
+	}
+	if err == nil {
+		err = m.models[b.slaveID].Load(b.table, b.address, b.quantity, resp.Data[1:])
+	}
+	if err != nil {
+		if !b.failing && !errors.Is(err, context.Canceled) {
+			slog.Warn("Failed to poll mirrored block, reads of it go to the device", "gateway", m.gateway, "downstream", m.downstream,
+				"slave_id", b.slaveID, "func", b.function, "address", b.address, "quantity", b.quantity, "err", err)
+		}
+		b.failing = true
+		return
+	}
+	if b.failing {
+		slog.Info("Mirrored block polled again", "gateway", m.gateway, "downstream", m.downstream, "slave_id", b.slaveID, "address", b.address)
+	}
+	b.failing = false
+	b.updated = m.now()
+}
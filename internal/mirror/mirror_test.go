@@ -0,0 +1,154 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+// device holds registers whose value is their address plus offset, and counts requests.
+type device struct {
+	offset uint16
+	sent   int
+	down   bool
+}
+
+func (d *device) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.sent++
+	if d.down {
+		return modbus.ProtocolDataUnit{}, modbus.ErrTimeout
+	}
+	parsed, err := pdu.ParseRequest(req)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	switch r := parsed.(type) {
+	case pdu.ReadHoldingRegistersRequest:
+		values := make([]uint16, r.Quantity)
+		for i := range values {
+			values[i] = r.Address + uint16(i) + d.offset
+		}
+		return pdu.ReadResponse(req.FunctionCode, pdu.EncodeRegisters(values)), nil
+	case pdu.WriteSingleRegisterRequest:
+		d.offset = r.Value
+		return req, nil
+	case pdu.WriteMultipleRegistersRequest:
+		if r.Address == 99 {
+			return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), nil
+		}
+		return pdu.WriteMultipleResponse(req.FunctionCode, r.Address, uint16(len(r.Values))), nil
+	}
+	return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeIllegalFunction), nil
+}
+
+func (d *device) Connect(ctx context.Context) error { return nil }
+func (d *device) Close() error                      { return nil }
+
+func TestMirror(t *testing.T) {
+	now := time.Unix(0, 0)
+	dev := &device{}
+	m, err := New("plant", "bus", dev, config.MirrorConfig{Interval: time.Second, MaxAge: 3 * time.Second, Blocks: []config.BlockConfig{
+		{SlaveID: 1, Table: "holding_register", Address: 10, Quantity: 20},
+	}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	m.now = func() time.Time { return now }
+
+	read := func(address, quantity uint16) []byte {
+		t.Helper()
+		resp, err := m.Send(context.Background(), 1, pdu.ReadHoldingRegistersRequest{Address: address, Quantity: quantity}.PDU())
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		return resp.Data
+	}
+
+	// Before the first poll reads go to the device
+	read(10, 1)
+	m.poll(context.Background(), m.blocks[0])
+	if dev.sent != 2 {
+		t.Fatalf("%d requests sent, want 2", dev.sent)
+	}
+
+	if got, want := read(12, 2), []byte{4, 0, 12, 0, 13}; !bytes.Equal(got, want) {
+		t.Errorf("mirrored read = % X, want % X", got, want)
+	}
+	if dev.sent != 2 {
+		t.Errorf("mirrored read reached the device")
+	}
+	read(25, 10) // Beyond the block
+	if dev.sent != 3 {
+		t.Errorf("read beyond the block was not sent to the device")
+	}
+
+	// A write makes the device authoritative until the next poll
+	if _, err := m.Send(context.Background(), 1, pdu.WriteSingleRegisterRequest{Address: 0, Value: 100}.PDU()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(10, 1), []byte{2, 0, 110}; !bytes.Equal(got, want) {
+		t.Errorf("read after write = % X, want % X", got, want)
+	}
+	m.poll(context.Background(), m.blocks[0])
+	sent := dev.sent
+	if got, want := read(10, 1), []byte{2, 0, 110}; !bytes.Equal(got, want) || dev.sent != sent {
+		t.Errorf("mirrored read after poll = % X, want % X from the mirror", got, want)
+	}
+
+	// Failing polls leave the mirror to age out
+	dev.down = true
+	m.poll(context.Background(), m.blocks[0])
+	now = now.Add(4 * time.Second)
+	if _, err := m.Send(context.Background(), 1, pdu.ReadHoldingRegistersRequest{Address: 10, Quantity: 1}.PDU()); err == nil {
+		t.Error("read of a stale block was answered from the mirror")
+	}
+
+	for _, b := range []config.BlockConfig{
+		{Table: "register", Quantity: 1},
+		{Table: "holding_register", Quantity: 126},
+		{Table: "coil", Address: 65535, Quantity: 2},
+	} {
+		if _, err := New("plant", "bus", dev, config.MirrorConfig{Interval: time.Second, MaxAge: time.Second, Blocks: []config.BlockConfig{b}}); err == nil {
+			t.Errorf("New() accepted block %+v", b)
+		}
+	}
+}
+
+func TestMirror_WriteThrough(t *testing.T) {
+	dev := &device{}
+	m, err := New("plant", "bus", dev, config.MirrorConfig{Interval: time.Second, MaxAge: time.Hour, WriteThrough: true, Blocks: []config.BlockConfig{
+		{SlaveID: 1, Table: "holding_register", Address: 10, Quantity: 20},
+	}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	m.poll(context.Background(), m.blocks[0])
+
+	send := func(req modbus.ProtocolDataUnit) []byte {
+		t.Helper()
+		resp, err := m.Send(context.Background(), 1, req)
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		return resp.Data
+	}
+	send(pdu.WriteMultipleRegistersRequest{Address: 11, Values: []uint16{500, 501}}.PDU())
+	sent := dev.sent
+	if got, want := send(pdu.ReadHoldingRegistersRequest{Address: 10, Quantity: 4}.PDU()), []byte{8, 0, 10, 0x01, 0xF4, 0x01, 0xF5, 0, 13}; !bytes.Equal(got, want) || dev.sent != sent {
+		t.Errorf("read after a confirmed write = % X, want % X from the mirror", got, want)
+	}
+
+	// A write the device refuses leaves the copy as polled
+	send(pdu.WriteMultipleRegistersRequest{Address: 99, Values: []uint16{1}}.PDU())
+	if got, want := send(pdu.ReadHoldingRegistersRequest{Address: 11, Quantity: 1}.PDU()), []byte{2, 0x01, 0xF4}; !bytes.Equal(got, want) {
+		t.Errorf("read after a refused write = % X, want % X", got, want)
+	}
+}
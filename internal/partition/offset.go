@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package partition
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Offsets are added to the addresses of requests on their way to a device, by
+// table. Tables without an offset of their own are shifted by All.
+type Offsets struct {
+	All    int
+	Tables map[string]int
+}
+
+// ParseOffsets returns the address offsets of a downstream, reporting whether it
+// has any.
+func ParseOffsets(cfg config.DownstreamConfig) (Offsets, bool, error) {
+	o := Offsets{All: cfg.AddressOffset, Tables: cfg.AddressOffsets}
+	shifted := o.All != 0
+	for table, offset := range o.Tables {
+		switch table {
+		case TableCoil, TableDiscreteInput, TableHoldingRegister, TableInputRegister:
+		default:
+			return Offsets{}, false, fmt.Errorf("unknown table %q", table)
+		}
+		if offset < -0xFFFF || offset > 0xFFFF {
+			return Offsets{}, false, fmt.Errorf("offset %d of table %s out of range", offset, table)
+		}
+		shifted = shifted || offset != 0
+	}
+	if o.All < -0xFFFF || o.All > 0xFFFF {
+		return Offsets{}, false, fmt.Errorf("offset %d out of range", o.All)
+	}
+	return o, shifted, nil
+}
+
+func (o Offsets) of(table string) int {
+	if offset, ok := o.Tables[table]; ok {
+		return offset
+	}
+	return o.All
+}
+
+// Shifted is a downstream with the addresses of requests shifted by offsets, and
+// back in the addresses write responses echo. Requests shifted out of 0-65535 are
+// answered with Illegal Data Address.
+type Shifted struct {
+	transport.Downstream
+	offsets Offsets
+}
+
+// Shift returns ds with the addresses of requests shifted by offsets.
+func Shift(ds transport.Downstream, offsets Offsets) *Shifted {
+	return &Shifted{Downstream: ds, offsets: offsets}
+}
+
+// Send forwards the request with its addresses shifted.
+func (d *Shifted) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	spans := addresses(req)
+	offset := d.offsets.of(tables[req.FunctionCode])
+	if len(spans) == 0 || offset == 0 {
+		return d.Downstream.Send(ctx, slaveID, req)
+	}
+	data := append([]byte(nil), req.Data...)
+	for _, sp := range spans {
+		if int(sp.first)+offset < 0 || int(sp.last)+offset > 0xFFFF {
+			return modbus.ProtocolDataUnit{}, illegalDataAddress(req)
+		}
+		binary.BigEndian.PutUint16(data[sp.at:], uint16(int(sp.first)+offset))
+	}
+	resp, err := d.Downstream.Send(ctx, slaveID, modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: data})
+	if err != nil || resp.FunctionCode != req.FunctionCode {
+		return resp, err
+	}
+	return unshift(resp, offset), nil
+}
+
+// unshift shifts the address a write response echoes back by offset, to the one
+// the master sent.
+func unshift(resp modbus.ProtocolDataUnit, offset int) modbus.ProtocolDataUnit {
+	switch resp.FunctionCode {
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeWriteMultipleCoils,
+		modbus.FuncCodeWriteMultipleRegisters, modbus.FuncCodeMaskWriteRegister:
+		if len(resp.Data) >= 2 {
+			data := append([]byte(nil), resp.Data...)
+			binary.BigEndian.PutUint16(data, uint16(int(binary.BigEndian.Uint16(data))-offset))
+			resp.Data = data
+		}
+	}
+	return resp
+}
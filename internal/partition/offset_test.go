@@ -0,0 +1,57 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package partition
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+func TestShift(t *testing.T) {
+	offsets, shifted, err := ParseOffsets(config.DownstreamConfig{AddressOffset: -1000, AddressOffsets: map[string]int{TableCoil: 0, TableInputRegister: 5}})
+	if err != nil || !shifted {
+		t.Fatalf("ParseOffsets() = %v, %v", shifted, err)
+	}
+	dev := &device{marker: 1}
+	ds := Shift(dev, offsets)
+
+	for _, tt := range []struct {
+		req, want modbus.ProtocolDataUnit
+	}{
+		{request(3, 0x03, 0xE8, 0, 2), request(3, 0, 0, 0, 2)},       // 1000 of the holding registers to 0
+		{request(4, 0, 10, 0, 1), request(4, 0, 15, 0, 1)},           // Input registers by 5
+		{request(1, 0x03, 0xE8, 0, 8), request(1, 0x03, 0xE8, 0, 8)}, // Coils not shifted
+		{request(0x17, 0x03, 0xE9, 0, 1, 0x03, 0xEA, 0, 1, 2, 0, 7), request(0x17, 0, 1, 0, 1, 0, 2, 0, 1, 2, 0, 7)},
+	} {
+		if _, err := ds.Send(context.Background(), 1, tt.req); err != nil {
+			t.Fatalf("Send(% X) error = %v", tt.req.Data, err)
+		}
+		if dev.last.FunctionCode != tt.want.FunctionCode || !bytes.Equal(dev.last.Data, tt.want.Data) {
+			t.Errorf("Send(% X) forwarded % X, want % X", tt.req.Data, dev.last.Data, tt.want.Data)
+		}
+	}
+
+	// Write responses echo the address the master sent
+	write := request(modbus.FuncCodeWriteSingleRegister, 0x03, 0xF2, 0, 42)
+	resp, err := ds.Send(context.Background(), 1, write)
+	if err != nil || !bytes.Equal(dev.last.Data, []byte{0, 10, 0, 42}) || !bytes.Equal(resp.Data, write.Data) {
+		t.Errorf("write forwarded % X, answered % X, %v", dev.last.Data, resp.Data, err)
+	}
+
+	// Shifted below 0
+	if _, err := ds.Send(context.Background(), 1, request(3, 0, 10, 0, 1)); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataAddress {
+		t.Errorf("read shifted out of range error = %v, want Illegal Data Address", err)
+	}
+
+	if _, _, err := ParseOffsets(config.DownstreamConfig{AddressOffsets: map[string]int{"registers": 1}}); err == nil {
+		t.Error("ParseOffsets() accepted an unknown table")
+	}
+	if _, shifted, _ := ParseOffsets(config.DownstreamConfig{}); shifted {
+		t.Error("ParseOffsets() of no offsets reports shifted")
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package partition routes the requests to one slave ID to several downstreams by
+// address and function code, so devices merged behind one unit ID can serve a master
+// that can't address them separately, and writes can take another path than reads.
+//
+// Each downstream serves ranges of a table, optionally shifted by an offset on the
+// way to the device and back in write responses. A request must lie within one
+// range; one spanning two is answered with Illegal Data Address. Requests outside
+// every range go to the downstream without ranges, and so do requests that carry no
+// address, such as device identification, or to the first downstream if there is
+// none. A downstream restricted to some function codes only sees requests of those;
+// one no downstream serves is answered with Illegal Function. Among downstreams
+// without ranges, a restricted one takes precedence over the fallback.
+//
+// Shift shifts the addresses of all requests to one downstream the same way, by table.
+package partition
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ffutop/modbus-gateway/internal/acl"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Tables of the data model, as named in address ranges.
+const (
+	TableCoil            = "coil"
+	TableDiscreteInput   = "discrete_input"
+	TableHoldingRegister = "holding_register"
+	TableInputRegister   = "input_register"
+)
+
+// tables are the tables addressed by each function code.
+var tables = map[byte]string{
+	modbus.FuncCodeReadCoils:                  TableCoil,
+	modbus.FuncCodeWriteSingleCoil:            TableCoil,
+	modbus.FuncCodeWriteMultipleCoils:         TableCoil,
+	modbus.FuncCodeReadDiscreteInputs:         TableDiscreteInput,
+	modbus.FuncCodeReadHoldingRegisters:       TableHoldingRegister,
+	modbus.FuncCodeWriteSingleRegister:        TableHoldingRegister,
+	modbus.FuncCodeWriteMultipleRegisters:     TableHoldingRegister,
+	modbus.FuncCodeMaskWriteRegister:          TableHoldingRegister,
+	modbus.FuncCodeReadWriteMultipleRegisters: TableHoldingRegister,
+	modbus.FuncCodeReadInputRegisters:         TableInputRegister,
+}
+
+// Range is a range of addresses of a table.
+type Range struct {
+	Table       string // Empty for all tables
+	First, Last uint16
+	Offset      int // Added to the addresses forwarded
+}
+
+func (r Range) covers(table string, first, last uint16) bool {
+	return (r.Table == "" || r.Table == table) && first >= r.First && last <= r.Last
+}
+
+func (r Range) overlaps(table string, first, last uint16) bool {
+	return (r.Table == "" || table == "" || r.Table == table) && first <= r.Last && last >= r.First
+}
+
+// ParseRanges parses the address ranges of a downstream.
+func ParseRanges(cfgs []config.AddressRangeConfig) ([]Range, error) {
+	var ranges []Range
+	for _, cfg := range cfgs {
+		n := len(ranges)
+		switch cfg.Table {
+		case "", TableCoil, TableDiscreteInput, TableHoldingRegister, TableInputRegister:
+		default:
+			return nil, fmt.Errorf("unknown table %q", cfg.Table)
+		}
+		for _, part := range strings.Split(cfg.Addresses, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			first, last, isRange := strings.Cut(part, "-")
+			lo, err := strconv.ParseUint(strings.TrimSpace(first), 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address range %q: %w", part, err)
+			}
+			hi := lo
+			if isRange {
+				if hi, err = strconv.ParseUint(strings.TrimSpace(last), 0, 16); err != nil {
+					return nil, fmt.Errorf("invalid address range %q: %w", part, err)
+				}
+			}
+			if lo > hi {
+				return nil, fmt.Errorf("start of address range %d is greater than end %d", lo, hi)
+			}
+			if int(lo)+cfg.Offset < 0 || int(hi)+cfg.Offset > 0xFFFF {
+				return nil, fmt.Errorf("address range %q shifted by %d leaves 0-65535", part, cfg.Offset)
+			}
+			ranges = append(ranges, Range{Table: cfg.Table, First: uint16(lo), Last: uint16(hi), Offset: cfg.Offset})
+		}
+		if len(ranges) == n {
+			return nil, fmt.Errorf("address range of table %q has no addresses", cfg.Table)
+		}
+	}
+	return ranges, nil
+}
+
+// Part is a downstream and the ranges and function codes it serves.
+type Part struct {
+	Name       string
+	Ranges     []Range        // Empty serves the addresses no other part claims
+	Functions  *acl.Functions // Nil serves all function codes
+	Downstream transport.Downstream
+}
+
+// Router is a downstream dispatching requests to parts by address. Its members are
+// connected and closed by the gateway, they may serve other slave IDs as well.
+type Router struct {
+	parts    []Part
+	fallback transport.Downstream // Nil answers requests outside the ranges with Illegal Data Address
+}
+
+// New creates a router of parts, whose ranges must not overlap for a function code
+// both serve. The fallback serves all function codes.
+func New(parts []Part, fallback transport.Downstream) (*Router, error) {
+	for i, a := range parts {
+		for _, b := range parts[i+1:] {
+			if !a.Functions.Intersects(b.Functions) {
+				continue
+			}
+			if len(a.Ranges) == 0 && len(b.Ranges) == 0 {
+				return nil, fmt.Errorf("%s and %s both serve the remaining addresses of a function code", a.Name, b.Name)
+			}
+			for _, ra := range a.Ranges {
+				for _, rb := range b.Ranges {
+					if ra.overlaps(rb.Table, rb.First, rb.Last) {
+						return nil, fmt.Errorf("address ranges of %s and %s overlap", a.Name, b.Name)
+					}
+				}
+			}
+		}
+	}
+	return &Router{parts: parts, fallback: fallback}, nil
+}
+
+// Send forwards the request to the part serving its addresses.
+func (r *Router) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	rest := r.rest(req.FunctionCode)
+	spans := addresses(req)
+	if len(spans) == 0 {
+		if rest == nil {
+			rest = r.first(req.FunctionCode)
+		}
+		if rest == nil {
+			return modbus.ProtocolDataUnit{}, illegalFunction(req)
+		}
+		return rest.Send(ctx, slaveID, req)
+	}
+
+	// Both spans of a read/write request go to the same part
+	table := tables[req.FunctionCode]
+	part := -1
+	data := append([]byte(nil), req.Data...)
+	var offset int // Of the first span, which write responses echo
+	for i, sp := range spans {
+		p, rg, ok := r.find(req.FunctionCode, table, sp.first, sp.last)
+		if !ok || (i > 0 && p != part) {
+			return modbus.ProtocolDataUnit{}, illegalDataAddress(req)
+		}
+		part = p
+		if i == 0 {
+			offset = rg.Offset
+		}
+		binary.BigEndian.PutUint16(data[sp.at:], uint16(int(sp.first)+rg.Offset))
+	}
+	if part < 0 {
+		if rest != nil {
+			return rest.Send(ctx, slaveID, req)
+		}
+		if r.first(req.FunctionCode) == nil {
+			return modbus.ProtocolDataUnit{}, illegalFunction(req)
+		}
+		return modbus.ProtocolDataUnit{}, illegalDataAddress(req)
+	}
+
+	resp, err := r.parts[part].Downstream.Send(ctx, slaveID, modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: data})
+	if err != nil || resp.FunctionCode != req.FunctionCode || offset == 0 {
+		return resp, err
+	}
+	// Write responses echo the address, as the master sent it
+	return unshift(resp, offset), nil
+}
+
+// rest returns the downstream serving the addresses outside the ranges for fc, nil if none does.
+func (r *Router) rest(fc byte) transport.Downstream {
+	for _, p := range r.parts {
+		if len(p.Ranges) == 0 && p.Functions.Allows(fc) {
+			return p.Downstream
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback
+	}
+	return nil
+}
+
+// first returns the downstream of the first part serving fc, nil if none does.
+func (r *Router) first(fc byte) transport.Downstream {
+	for _, p := range r.parts {
+		if p.Functions.Allows(fc) {
+			return p.Downstream
+		}
+	}
+	return nil
+}
+
+// find returns the part serving fc whose range covers first to last, -1 if no range
+// touches them. It reports false if the addresses are served partly, by one range or another.
+func (r *Router) find(fc byte, table string, first, last uint16) (int, Range, bool) {
+	touched := false
+	for i, p := range r.parts {
+		if !p.Functions.Allows(fc) {
+			continue
+		}
+		for _, rg := range p.Ranges {
+			if rg.covers(table, first, last) {
+				return i, rg, true
+			}
+			touched = touched || rg.overlaps(table, first, last)
+		}
+	}
+	return -1, Range{}, !touched
+}
+
+// span is the addresses of a request, and the index of its start address in the data.
+type span struct {
+	first, last uint16
+	at          int
+}
+
+// addresses returns the addresses req reads or writes, none if it carries no address.
+func addresses(req modbus.ProtocolDataUnit) []span {
+	d := req.Data
+	at := func(i, quantity int) span {
+		first := binary.BigEndian.Uint16(d[i:])
+		return span{first: first, last: uint16(min(int(first)+max(quantity, 1)-1, 0xFFFF)), at: i}
+	}
+	switch req.FunctionCode {
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeMaskWriteRegister:
+		if len(d) >= 2 {
+			return []span{at(0, 1)}
+		}
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs, modbus.FuncCodeReadHoldingRegisters,
+		modbus.FuncCodeReadInputRegisters, modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters:
+		if len(d) >= 4 {
+			return []span{at(0, int(binary.BigEndian.Uint16(d[2:])))}
+		}
+	case modbus.FuncCodeReadWriteMultipleRegisters:
+		if len(d) >= 8 {
+			return []span{at(0, int(binary.BigEndian.Uint16(d[2:]))), at(4, int(binary.BigEndian.Uint16(d[6:])))}
+		}
+	}
+	return nil
+}
+
+func illegalFunction(req modbus.ProtocolDataUnit) error {
+	return &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+}
+
+func illegalDataAddress(req modbus.ProtocolDataUnit) error {
+	return &modbus.Error{FunctionCode: req.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+}
+
+// Connect does nothing, the gateway connects the members.
+func (r *Router) Connect(ctx context.Context) error { return nil }
+
+// Close does nothing, the gateway closes the members.
+func (r *Router) Close() error { return nil }
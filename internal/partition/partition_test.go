@@ -0,0 +1,171 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package partition
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/acl"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// device records the last request and answers writes with their echo, reads with its marker.
+type device struct {
+	marker byte
+	last   modbus.ProtocolDataUnit
+}
+
+func (d *device) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.last = pdu
+	if pdu.FunctionCode == modbus.FuncCodeWriteSingleRegister {
+		return pdu, nil
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, d.marker}}, nil
+}
+
+func (d *device) Connect(ctx context.Context) error { return nil }
+func (d *device) Close() error                      { return nil }
+
+func request(function byte, data ...byte) modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: function, Data: data}
+}
+
+func TestRouter(t *testing.T) {
+	low, high, rest := &device{marker: 1}, &device{marker: 2}, &device{marker: 3}
+	lowRanges, err := ParseRanges([]config.AddressRangeConfig{{Table: TableHoldingRegister, Addresses: "0-99"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	highRanges, err := ParseRanges([]config.AddressRangeConfig{{Table: TableHoldingRegister, Addresses: "100-199", Offset: -100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New([]Part{{Name: "low", Ranges: lowRanges, Downstream: low}, {Name: "high", Ranges: highRanges, Downstream: high}}, rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name   string
+		req    modbus.ProtocolDataUnit
+		marker byte
+		sent   []byte // Request data reaching the device
+	}{
+		{"low", request(0x03, 0x00, 0x0A, 0x00, 0x02), 1, []byte{0x00, 0x0A, 0x00, 0x02}},
+		{"high shifted", request(0x03, 0x00, 0x96, 0x00, 0x0A), 2, []byte{0x00, 0x32, 0x00, 0x0A}},
+		{"input registers", request(0x04, 0x00, 0x96, 0x00, 0x01), 3, []byte{0x00, 0x96, 0x00, 0x01}},
+		{"outside", request(0x03, 0x01, 0x2C, 0x00, 0x01), 3, []byte{0x01, 0x2C, 0x00, 0x01}},
+		{"no address", request(0x2B, 0x0E, 0x01, 0x00), 3, []byte{0x0E, 0x01, 0x00}},
+	} {
+		resp, err := r.Send(ctx, 1, tt.req)
+		var got []byte
+		switch tt.marker {
+		case 1:
+			got = low.last.Data
+		case 2:
+			got = high.last.Data
+		case 3:
+			got = rest.last.Data
+		}
+		if err != nil || resp.Data[2] != tt.marker || !bytes.Equal(got, tt.sent) {
+			t.Errorf("%s: answered by %v, %v with % X sent, want %d with % X", tt.name, resp.Data, err, got, tt.marker, tt.sent)
+		}
+	}
+
+	// Write responses echo the address the master sent
+	write := request(0x06, 0x00, 0x78, 0x12, 0x34)
+	if resp, err := r.Send(ctx, 1, write); err != nil || !bytes.Equal(resp.Data, write.Data) || high.last.Data[1] != 0x14 {
+		t.Errorf("write = % X, %v with % X sent, want its echo with address 20 sent", resp.Data, err, high.last.Data)
+	}
+
+	for _, req := range []modbus.ProtocolDataUnit{
+		request(0x03, 0x00, 0x5F, 0x00, 0x0A), // 95-104 spans both
+		request(0x17, 0x00, 0x00, 0x00, 0x01, 0x00, 0x64, 0x00, 0x01, 0x02, 0x00, 0x00),
+	} {
+		if _, err := r.Send(ctx, 1, req); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataAddress {
+			t.Errorf("request % X error = %v, want Illegal Data Address", req.Data, err)
+		}
+	}
+
+	noFallback, _ := New([]Part{{Name: "low", Ranges: lowRanges, Downstream: low}}, nil)
+	if _, err := noFallback.Send(ctx, 1, request(0x03, 0x01, 0x2C, 0x00, 0x01)); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataAddress {
+		t.Errorf("request outside without fallback error = %v, want Illegal Data Address", err)
+	}
+}
+
+func TestRouter_Functions(t *testing.T) {
+	engineering, mirror, meter := &device{marker: 1}, &device{marker: 2}, &device{marker: 3}
+	writes, _ := acl.ParseFunctions("5,6,15,16", "")
+	reads, _ := acl.ParseFunctions("", "5,6,15,16")
+	meterRanges, _ := ParseRanges([]config.AddressRangeConfig{{Table: TableHoldingRegister, Addresses: "100-199"}})
+	r, err := New([]Part{
+		{Name: "engineering", Functions: writes, Downstream: engineering},
+		{Name: "meter", Ranges: meterRanges, Functions: reads, Downstream: meter},
+	}, mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	write := request(0x06, 0x00, 0x96, 0x12, 0x34)
+	if resp, err := r.Send(ctx, 1, write); err != nil || !bytes.Equal(resp.Data, write.Data) || engineering.last.FunctionCode != 0x06 {
+		t.Errorf("write = % X, %v, want it sent to engineering", resp.Data, err)
+	}
+	for _, tt := range []struct {
+		req    modbus.ProtocolDataUnit
+		marker byte
+	}{
+		{request(0x03, 0x00, 0x00, 0x00, 0x01), 2},
+		{request(0x03, 0x00, 0x96, 0x00, 0x01), 3},
+		{request(0x2B, 0x0E, 0x01, 0x00), 2},
+	} {
+		if resp, err := r.Send(ctx, 1, tt.req); err != nil || resp.Data[2] != tt.marker {
+			t.Errorf("request %02X % X answered by %v, %v, want %d", tt.req.FunctionCode, tt.req.Data, resp.Data, err, tt.marker)
+		}
+	}
+
+	// Without a fallback, codes no part serves are refused
+	readOnly, _ := New([]Part{{Name: "mirror", Functions: reads, Downstream: mirror}}, nil)
+	for _, req := range []modbus.ProtocolDataUnit{write, request(0x10, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x00)} {
+		if _, err := readOnly.Send(ctx, 1, req); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalFunction {
+			t.Errorf("request %02X error = %v, want Illegal Function", req.FunctionCode, err)
+		}
+	}
+	if _, err := New([]Part{{Name: "a", Functions: writes}, {Name: "b"}}, nil); err == nil {
+		t.Error("New() with two parts serving the remaining addresses of writes succeeded")
+	}
+	if _, err := New([]Part{{Name: "a", Functions: writes}, {Name: "b", Functions: reads}}, nil); err != nil {
+		t.Errorf("New() with disjoint function codes failed: %v", err)
+	}
+}
+
+func TestNew_Overlap(t *testing.T) {
+	all, _ := ParseRanges([]config.AddressRangeConfig{{Addresses: "50-60"}})
+	coils, _ := ParseRanges([]config.AddressRangeConfig{{Table: TableCoil, Addresses: "0-99"}})
+	if _, err := New([]Part{{Name: "a", Ranges: all}, {Name: "b", Ranges: coils}}, nil); err == nil {
+		t.Error("New() with overlapping ranges succeeded")
+	}
+	reads, _ := acl.ParseFunctions("1-4", "")
+	writes, _ := acl.ParseFunctions("5,6,15,16", "")
+	if _, err := New([]Part{{Name: "a", Ranges: all, Functions: reads}, {Name: "b", Ranges: coils, Functions: writes}}, nil); err != nil {
+		t.Errorf("New() with overlapping ranges of disjoint function codes failed: %v", err)
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	for _, cfg := range []config.AddressRangeConfig{
+		{Table: "register", Addresses: "0-9"},
+		{Addresses: ""},
+		{Addresses: "10-5"},
+		{Addresses: "0-9", Offset: -1},
+	} {
+		if _, err := ParseRanges([]config.AddressRangeConfig{cfg}); err == nil {
+			t.Errorf("ParseRanges(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package probe checks periodically that a downstream answers, for readiness probes.
+//
+// A probe reads one coil or register of a slave. Any response shows the device is
+// reachable and counts as success, exception responses included; timeouts and
+// connection failures don't.
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// States of a probed downstream, as reported by State.
+const (
+	StatePending = "pending" // Not probed yet
+	StateUp      = "up"
+	StateDown    = "down"
+)
+
+// Prober probes a downstream. It is a service of the gateway.
+type Prober struct {
+	gateway    string
+	downstream string
+	ds         transport.Downstream
+	cfg        config.ProbeConfig
+	timeout    time.Duration
+
+	mu     sync.Mutex
+	probed time.Time // Of the last probe, zero before the first
+	err    error     // Of the last probe
+}
+
+// New creates a prober of ds, sending a read of cfg every cfg.Interval that may
+// take timeout.
+func New(gateway, downstream string, ds transport.Downstream, cfg config.ProbeConfig, timeout time.Duration) *Prober {
+	return &Prober{gateway: gateway, downstream: downstream, ds: ds, cfg: cfg, timeout: timeout}
+}
+
+// Run probes the downstream until ctx is cancelled, first right away.
+func (p *Prober) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		p.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Prober) probe(ctx context.Context) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	req := modbus.ProtocolDataUnit{FunctionCode: p.cfg.Function, Data: binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(nil, p.cfg.Address), 1)}
+	_, err := p.ds.Send(ctx, p.cfg.SlaveID, req)
+	var exception *modbus.Error
+	if errors.As(err, &exception) {
+		err = nil
+	}
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return // The gateway stops
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	log := slog.With("gateway", p.gateway, "downstream", p.downstream)
+	switch {
+	case err != nil && (p.err == nil || p.probed.IsZero()):
+		log.Warn("Downstream probe failed", "slaveID", p.cfg.SlaveID, "err", err)
+	case err == nil && p.err != nil:
+		log.Info("Downstream probe succeeded again")
+	}
+	p.probed, p.err = time.Now(), err
+}
+
+// State reports the state of the downstream, with the time and error of the last probe.
+func (p *Prober) State() (string, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.probed.IsZero():
+		return StatePending, p.probed, nil
+	case p.err != nil:
+		return StateDown, p.probed, p.err
+	}
+	return StateUp, p.probed, nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package probe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+type fakeDownstream struct {
+	err     error
+	slaveID byte
+	req     modbus.ProtocolDataUnit
+}
+
+func (d *fakeDownstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.slaveID, d.req = slaveID, req
+	return modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: []byte{2, 0, 0}}, d.err
+}
+
+func (d *fakeDownstream) Connect(ctx context.Context) error { return nil }
+func (d *fakeDownstream) Close() error                      { return nil }
+
+func TestProber(t *testing.T) {
+	ds := &fakeDownstream{}
+	p := New("plant", "plc", ds, config.ProbeConfig{SlaveID: 7, Function: 4, Address: 100}, 0)
+	if state, _, _ := p.State(); state != StatePending {
+		t.Errorf("state before probing = %s, want pending", state)
+	}
+
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{nil, StateUp},
+		{&modbus.Error{FunctionCode: 0x84, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}, StateUp},
+		{modbus.ErrConnection, StateDown},
+		{modbus.ErrTimeout, StateDown},
+	} {
+		ds.err = tt.err
+		p.probe(context.Background())
+		state, probed, err := p.State()
+		if state != tt.want || probed.IsZero() || (err != nil) != (tt.want == StateDown) {
+			t.Errorf("probe answered with %v: state %s, %v, %v, want %s", tt.err, state, probed, err, tt.want)
+		}
+	}
+	if ds.slaveID != 7 || ds.req.FunctionCode != 4 || string(ds.req.Data) != "\x00\x64\x00\x01" {
+		t.Errorf("probe read slave %d % X", ds.slaveID, ds.req.Data)
+	}
+}
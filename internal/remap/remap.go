@@ -0,0 +1,66 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package remap translates the slave IDs masters address into the unit IDs of the
+// devices behind a downstream, so devices sharing a unit ID on different buses can
+// be reached through one gateway. Responses carry no unit ID above the transport,
+// the upstream answers with the ID the master addressed.
+package remap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Downstream is a downstream with the slave IDs of requests translated.
+type Downstream struct {
+	transport.Downstream
+	ids map[byte]byte // Unit ID of the device by slave ID addressed
+}
+
+// Parse parses "10:1, 11:2", mapping the slave IDs addressed to those of the devices.
+func Parse(s string) (map[byte]byte, error) {
+	m := make(map[byte]byte)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid slave ID mapping %q, want addressed:device", pair)
+		}
+		addressed, err := strconv.ParseUint(strings.TrimSpace(from), 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slave ID mapping %q: %w", pair, err)
+		}
+		device, err := strconv.ParseUint(strings.TrimSpace(to), 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slave ID mapping %q: %w", pair, err)
+		}
+		if _, dup := m[byte(addressed)]; dup {
+			return nil, fmt.Errorf("slave ID %d mapped twice", addressed)
+		}
+		m[byte(addressed)] = byte(device)
+	}
+	return m, nil
+}
+
+// Wrap returns ds with the slave IDs of ids translated, others pass unchanged.
+func Wrap(ds transport.Downstream, ids map[byte]byte) *Downstream {
+	return &Downstream{Downstream: ds, ids: ids}
+}
+
+// Send forwards the request to the device the slave ID maps to.
+func (d *Downstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if id, ok := d.ids[slaveID]; ok {
+		slaveID = id
+	}
+	return d.Downstream.Send(ctx, slaveID, req)
+}
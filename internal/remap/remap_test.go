@@ -0,0 +1,54 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package remap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// echoDownstream answers with the slave ID it was sent.
+type echoDownstream struct{}
+
+func (echoDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{slaveID}}, nil
+}
+
+func (echoDownstream) Connect(ctx context.Context) error { return nil }
+func (echoDownstream) Close() error                      { return nil }
+
+func TestParse(t *testing.T) {
+	m, err := Parse(" 10:1, 11 : 2,0x20:0x01,")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := map[byte]byte{10: 1, 11: 2, 0x20: 1}
+	if len(m) != len(want) {
+		t.Fatalf("Parse() = %v, want %v", m, want)
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("Parse()[%d] = %d, want %d", k, m[k], v)
+		}
+	}
+
+	for _, s := range []string{"10", "10:", "256:1", "1:256", "a:1", "10:1,10:2"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	ds := Wrap(echoDownstream{}, map[byte]byte{10: 1})
+	req := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters}
+	for _, tt := range []struct{ addressed, device byte }{{10, 1}, {3, 3}} {
+		resp, err := ds.Send(context.Background(), tt.addressed, req)
+		if err != nil || resp.Data[0] != tt.device {
+			t.Errorf("Send(%d) reached slave %v, %v, want %d", tt.addressed, resp.Data, err, tt.device)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package retry bounds each attempt at a request to a downstream by its timeout and
+// repeats failed attempts, so a frame lost to noise on the bus doesn't fail the
+// request of the master.
+//
+// Only reads are repeated unless writes are allowed: a write whose response was
+// lost may have taken effect, and repeating it is not harmless on every device.
+// Exception responses are answers of the slave and are never repeated.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// maxBackoff caps the doubling wait between attempts.
+const maxBackoff = time.Minute
+
+// Downstream is a downstream with a timeout and retry policy.
+type Downstream struct {
+	transport.Downstream
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	writes  bool
+}
+
+// Wrap returns ds with the timeout and retry policy of cfg.
+func Wrap(ds transport.Downstream, cfg config.DownstreamConfig) (*Downstream, error) {
+	if cfg.Retries < 0 || cfg.Timeout < 0 || cfg.RetryBackoff < 0 {
+		return nil, fmt.Errorf("retries, timeout and retry_backoff must not be negative")
+	}
+	return &Downstream{Downstream: ds, timeout: cfg.Timeout, retries: cfg.Retries, backoff: min(cfg.RetryBackoff, maxBackoff), writes: cfg.RetryWrites}, nil
+}
+
+// Budget is the time a request takes at most, all attempts failing by timeout.
+func (d *Downstream) Budget() time.Duration {
+	budget := d.timeout
+	for i, wait := 0, d.backoff; i < d.retries; i, wait = i+1, next(wait) {
+		budget += wait + d.timeout
+	}
+	return budget
+}
+
+// next doubles the wait before the next attempt up to maxBackoff.
+func next(wait time.Duration) time.Duration {
+	return min(2*wait, maxBackoff)
+}
+
+// Send forwards the request, repeating it while attempts fail and retries are left.
+func (d *Downstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	retries := d.retries
+	if !d.writes && !modbus.IsRead(req.FunctionCode) {
+		retries = 0
+	}
+	wait := d.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := d.attempt(ctx, slaveID, req)
+		if err == nil || attempt == retries || !retryable(ctx, err) {
+			return resp, err
+		}
+		transport.Logger(ctx).Debug("Retrying request", "func", req.FunctionCode, "attempt", attempt+1, "err", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return resp, err
+		}
+		wait = next(wait)
+	}
+}
+
+func (d *Downstream) attempt(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	return d.Downstream.Send(ctx, slaveID, req)
+}
+
+// retryable reports whether an attempt failing with err is worth repeating: the
+// bus lost or garbled a frame, and the master is still waiting.
+func retryable(ctx context.Context, err error) bool {
+	var exception *modbus.Error
+	if errors.As(err, &exception) || ctx.Err() != nil {
+		return false
+	}
+	return errors.Is(err, modbus.ErrTimeout) || errors.Is(err, modbus.ErrConnection) ||
+		errors.Is(err, modbus.ErrCRC) || errors.Is(err, modbus.ErrInvalidFrame) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// flakyDownstream fails the first requests with errs, then answers. A nil error
+// blocks until the attempt times out.
+type flakyDownstream struct {
+	errs []error
+	sent int
+}
+
+func (f *flakyDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	f.sent++
+	if f.sent <= len(f.errs) {
+		if err := f.errs[f.sent-1]; err != nil {
+			return modbus.ProtocolDataUnit{}, err
+		}
+		<-ctx.Done()
+		return modbus.ProtocolDataUnit{}, ctx.Err()
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, 0x00, 0x01}}, nil
+}
+
+func (f *flakyDownstream) Connect(ctx context.Context) error { return nil }
+func (f *flakyDownstream) Close() error                      { return nil }
+
+var (
+	readRequest  = modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+	writeRequest = modbus.ProtocolDataUnit{FunctionCode: 0x06, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+	exception    = &modbus.Error{FunctionCode: 0x83, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+)
+
+func TestDownstream_Send(t *testing.T) {
+	cfg := config.DownstreamConfig{Timeout: 20 * time.Millisecond, Retries: 2, RetryBackoff: time.Millisecond}
+	for _, tt := range []struct {
+		name     string
+		writes   bool
+		req      modbus.ProtocolDataUnit
+		errs     []error
+		wantSent int
+		wantErr  error
+	}{
+		{"read recovers", false, readRequest, []error{modbus.ErrTimeout, nil}, 3, nil},
+		{"read gives up", false, readRequest, []error{modbus.ErrCRC, modbus.ErrCRC, modbus.ErrCRC}, 3, modbus.ErrCRC},
+		{"write not retried", false, writeRequest, []error{modbus.ErrTimeout}, 1, modbus.ErrTimeout},
+		{"write retried", true, writeRequest, []error{modbus.ErrConnection}, 2, nil},
+		{"exception not retried", false, readRequest, []error{exception}, 1, exception},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &flakyDownstream{errs: tt.errs}
+			cfg.RetryWrites = tt.writes
+			d, err := Wrap(inner, cfg)
+			if err != nil {
+				t.Fatalf("Wrap() error = %v", err)
+			}
+			_, err = d.Send(context.Background(), 1, tt.req)
+			if !errors.Is(err, tt.wantErr) || inner.sent != tt.wantSent {
+				t.Errorf("Send error = %v after %d attempts, want %v after %d", err, inner.sent, tt.wantErr, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestDownstream_Budget(t *testing.T) {
+	d, err := Wrap(&flakyDownstream{}, config.DownstreamConfig{Timeout: time.Second, Retries: 2, RetryBackoff: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	if got, want := d.Budget(), 3*time.Second+300*time.Millisecond; got != want {
+		t.Errorf("Budget = %v, want %v", got, want)
+	}
+
+	// The doubling wait stops at maxBackoff instead of overflowing
+	d, err = Wrap(&flakyDownstream{}, config.DownstreamConfig{Retries: 100, RetryBackoff: 40 * time.Second})
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	if got, want := d.Budget(), 40*time.Second+99*maxBackoff; got != want {
+		t.Errorf("Budget = %v, want %v", got, want)
+	}
+}
+
+func TestWrap_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  config.DownstreamConfig
+	}{
+		{"negative retries", config.DownstreamConfig{Retries: -1}},
+		{"negative timeout", config.DownstreamConfig{Timeout: -time.Second}},
+		{"negative backoff", config.DownstreamConfig{Retries: 1, RetryBackoff: -time.Millisecond}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Wrap(&flakyDownstream{}, tt.cfg); err == nil {
+				t.Error("Wrap() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package script attaches Lua hooks to a downstream route, letting small scripts
+// inspect, rewrite or reject requests and responses for vendor quirks that
+// the built-in configuration can't express.
+//
+// A script defines any of these global functions:
+//
+//	function on_request(req)         -- req = {slave_id=, function_code=, data=}
+//	function on_response(req, resp)  -- resp = {function_code=, data=}
+//
+// The tables may be modified in place to rewrite the PDU. Returning a number rejects
+// the request with that exception code, returning false rejects it with Illegal Function.
+// The data fields are Lua strings of raw PDU bytes, modbus.u16 and modbus.set_u16
+// read and write big-endian registers at a 1-based byte position.
+package script
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// callTimeout bounds a single hook invocation, so a runaway script can't stall the route.
+const callTimeout = 100 * time.Millisecond
+
+// Downstream wraps a transport.Downstream with Lua request and response hooks.
+type Downstream struct {
+	transport.Downstream
+	file string
+
+	mu         sync.Mutex // An LState is not safe for concurrent use
+	state      *lua.LState
+	onRequest  *lua.LFunction
+	onResponse *lua.LFunction
+}
+
+// Wrap loads the Lua file and returns ds with its hooks attached.
+func Wrap(ds transport.Downstream, file string) (*Downstream, error) {
+	L := NewState()
+	if err := L.DoFile(file); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("failed to load script %s: %w", file, err)
+	}
+	d := &Downstream{Downstream: ds, file: file, state: L}
+	d.onRequest, _ = L.GetGlobal("on_request").(*lua.LFunction)
+	d.onResponse, _ = L.GetGlobal("on_response").(*lua.LFunction)
+	if d.onRequest == nil && d.onResponse == nil {
+		L.Close()
+		return nil, fmt.Errorf("script %s defines neither on_request nor on_response", file)
+	}
+	return d, nil
+}
+
+// NewState creates an interpreter with only the side-effect free standard libraries
+// and the modbus helpers.
+func NewState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetGlobal("modbus", newModule(L))
+	return L
+}
+
+// Send runs on_request, forwards the (possibly rewritten) request and runs on_response.
+func (d *Downstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.mu.Lock()
+	req := d.newTable(slaveID, pdu)
+	forward := pdu // As rewritten by on_request
+	var err error
+	if d.onRequest != nil {
+		var ret lua.LValue
+		ret, err = d.call(ctx, d.onRequest, req)
+		if err == nil {
+			if code, rejected := rejection(ret); rejected {
+				d.mu.Unlock()
+				return exception(pdu.FunctionCode, code), nil
+			}
+			slaveID, forward, err = fromTable(req)
+		}
+	}
+	d.mu.Unlock()
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("script %s: on_request: %w", d.file, err)
+	}
+
+	resp, err := d.Downstream.Send(ctx, slaveID, forward)
+	if err != nil || d.onResponse == nil {
+		return resp, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rt := d.newTable(slaveID, resp)
+	ret, err := d.call(ctx, d.onResponse, req, rt)
+	if err == nil {
+		if code, rejected := rejection(ret); rejected {
+			return exception(pdu.FunctionCode, code), nil
+		}
+		_, resp, err = fromTable(rt)
+	}
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("script %s: on_response: %w", d.file, err)
+	}
+	return resp, nil
+}
+
+// Close closes the wrapped downstream and the interpreter.
+func (d *Downstream) Close() error {
+	err := d.Downstream.Close()
+	d.mu.Lock()
+	d.state.Close()
+	d.mu.Unlock()
+	return err
+}
+
+// call invokes a hook with the lock held and returns its first result.
+func (d *Downstream) call(ctx context.Context, fn *lua.LFunction, args ...lua.LValue) (lua.LValue, error) {
+	cctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	d.state.SetContext(cctx)
+	defer d.state.RemoveContext()
+
+	if err := d.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...); err != nil {
+		return nil, err
+	}
+	ret := d.state.Get(-1)
+	d.state.Pop(1)
+	return ret, nil
+}
+
+func (d *Downstream) newTable(slaveID byte, pdu modbus.ProtocolDataUnit) *lua.LTable {
+	t := d.state.NewTable()
+	t.RawSetString("slave_id", lua.LNumber(slaveID))
+	t.RawSetString("function_code", lua.LNumber(pdu.FunctionCode))
+	t.RawSetString("data", lua.LString(pdu.Data))
+	return t
+}
+
+func fromTable(t *lua.LTable) (byte, modbus.ProtocolDataUnit, error) {
+	id, ok1 := t.RawGetString("slave_id").(lua.LNumber)
+	fc, ok2 := t.RawGetString("function_code").(lua.LNumber)
+	data, ok3 := t.RawGetString("data").(lua.LString)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, modbus.ProtocolDataUnit{}, fmt.Errorf("slave_id, function_code and data must be set")
+	}
+	if id < 0 || id > 255 || fc < 1 || fc > 255 {
+		return 0, modbus.ProtocolDataUnit{}, fmt.Errorf("slave_id or function_code out of range")
+	}
+	return byte(id), modbus.ProtocolDataUnit{FunctionCode: byte(fc), Data: []byte(data)}, nil
+}
+
+// rejection interprets a hook result: a number is an exception code, false means Illegal Function.
+func rejection(ret lua.LValue) (byte, bool) {
+	switch v := ret.(type) {
+	case lua.LNumber:
+		return byte(v), true
+	case lua.LBool:
+		if !bool(v) {
+			return modbus.ExceptionCodeIllegalFunction, true
+		}
+	}
+	return 0, false
+}
+
+func exception(functionCode, code byte) modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: functionCode | 0x80, Data: []byte{code}}
+}
+
+// newModule builds the "modbus" helper table available to scripts.
+func newModule(L *lua.LState) *lua.LTable {
+	m := L.NewTable()
+	m.RawSetString("ILLEGAL_FUNCTION", lua.LNumber(modbus.ExceptionCodeIllegalFunction))
+	m.RawSetString("ILLEGAL_DATA_ADDRESS", lua.LNumber(modbus.ExceptionCodeIllegalDataAddress))
+	m.RawSetString("ILLEGAL_DATA_VALUE", lua.LNumber(modbus.ExceptionCodeIllegalDataValue))
+	m.RawSetString("SERVER_DEVICE_FAILURE", lua.LNumber(modbus.ExceptionCodeServerDeviceFailure))
+
+	// u16(data, pos) reads the big-endian register at 1-based byte position pos.
+	m.RawSetString("u16", L.NewFunction(func(L *lua.LState) int {
+		s, pos := L.CheckString(1), L.CheckInt(2)
+		if pos < 1 || pos+1 > len(s) {
+			L.ArgError(2, "position out of range")
+		}
+		L.Push(lua.LNumber(uint16(s[pos-1])<<8 | uint16(s[pos])))
+		return 1
+	}))
+	// set_u16(data, pos, value) returns data with the register at pos replaced.
+	m.RawSetString("set_u16", L.NewFunction(func(L *lua.LState) int {
+		s, pos, v := L.CheckString(1), L.CheckInt(2), L.CheckInt(3)
+		if pos < 1 || pos+1 > len(s) {
+			L.ArgError(2, "position out of range")
+		}
+		b := []byte(s)
+		b[pos-1], b[pos] = byte(v>>8), byte(v)
+		L.Push(lua.LString(b))
+		return 1
+	}))
+	return m
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package script
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// echoDownstream records the last request and answers with a fixed response.
+type echoDownstream struct {
+	slaveID byte
+	req     modbus.ProtocolDataUnit
+	resp    modbus.ProtocolDataUnit
+}
+
+func (e *echoDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	e.slaveID, e.req = slaveID, pdu
+	return e.resp, nil
+}
+
+func (e *echoDownstream) Connect(ctx context.Context) error { return nil }
+func (e *echoDownstream) Close() error                      { return nil }
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "hook.lua")
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+const quirks = `
+function on_request(req)
+  -- Writes to the calibration block are not allowed
+  if req.function_code == 6 and modbus.u16(req.data, 1) >= 9000 then
+    return modbus.ILLEGAL_DATA_ADDRESS
+  end
+  -- The device numbers its registers from 1
+  req.data = modbus.set_u16(req.data, 1, modbus.u16(req.data, 1) + 1)
+  req.slave_id = 7
+end
+
+function on_response(req, resp)
+  -- Firmware reports temperatures in tenths of Kelvin, convert to tenths of Celsius
+  if resp.function_code == 3 then
+    resp.data = modbus.set_u16(resp.data, 2, modbus.u16(resp.data, 2) - 2732)
+  end
+end
+`
+
+func TestDownstream_Send(t *testing.T) {
+	inner := &echoDownstream{resp: modbus.ProtocolDataUnit{FunctionCode: 3, Data: []byte{2, 0x0B, 0xB8}}}
+	ds, err := Wrap(inner, writeScript(t, quirks))
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	defer ds.Close()
+
+	resp, err := ds.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 10, 0, 1}})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if inner.slaveID != 7 || !bytes.Equal(inner.req.Data, []byte{0, 11, 0, 1}) {
+		t.Errorf("request not rewritten: slave %d data % X", inner.slaveID, inner.req.Data)
+	}
+	if !bytes.Equal(resp.Data, []byte{2, 0x01, 0x0C}) {
+		t.Errorf("response not rewritten: % X", resp.Data)
+	}
+
+	resp, err = ds.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 6, Data: []byte{0x23, 0x28, 0, 1}})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if resp.FunctionCode != 0x86 || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalDataAddress}) {
+		t.Errorf("expected rejection, got %+v", resp)
+	}
+}
+
+func TestDownstream_SendRewriteReject(t *testing.T) {
+	const src = `
+function on_request(req)
+  -- The device only implements read input registers
+  req.function_code = 4
+end
+
+function on_response(req, resp)
+  return modbus.SERVER_DEVICE_FAILURE
+end
+`
+	inner := &echoDownstream{resp: modbus.ProtocolDataUnit{FunctionCode: 4, Data: []byte{2, 0, 1}}}
+	ds, err := Wrap(inner, writeScript(t, src))
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	defer ds.Close()
+
+	resp, err := ds.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 0, 0, 1}})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if inner.req.FunctionCode != 4 {
+		t.Errorf("request not rewritten: function code %d", inner.req.FunctionCode)
+	}
+	if resp.FunctionCode != 0x83 || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeServerDeviceFailure}) {
+		t.Errorf("expected rejection of function code 3, got %+v", resp)
+	}
+}
+
+func TestDownstream_Errors(t *testing.T) {
+	inner := &echoDownstream{}
+	if _, err := Wrap(inner, writeScript(t, "x = 1")); err == nil {
+		t.Error("Wrap() without hooks expected error")
+	}
+	if _, err := Wrap(inner, writeScript(t, "function on_request(")); err == nil {
+		t.Error("Wrap() with syntax error expected error")
+	}
+
+	ds, err := Wrap(inner, writeScript(t, "function on_request(req) while true do end end"))
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	defer ds.Close()
+	if _, err := ds.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 0, 0, 1}}); err == nil {
+		t.Error("runaway script expected to time out")
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package stats accumulates per-route request counts, errors and latencies of a
+// gateway since it started, so short diagnostic runs end with a summary. A route
+// is labeled by the upstream, slave ID and downstream of its requests.
+//
+// Latencies go into a histogram with eight buckets per octave, which bounds
+// memory regardless of the run time at a resolution of about 9%.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+const (
+	bucketsPerOctave = 8
+	numBuckets       = 24 * bucketsPerOctave // 10µs to about 168s
+	minLatency       = 10 * time.Microsecond
+)
+
+// Route labels the requests counted together.
+type Route struct {
+	Upstream   string // Label of the upstream the requests came from
+	SlaveID    byte
+	Downstream string // Name of the downstream they were routed to, empty if unrouted
+}
+
+// Recorder collects the requests of one gateway instance.
+type Recorder struct {
+	start time.Time
+
+	mu     sync.Mutex
+	routes map[Route]*route
+}
+
+type route struct {
+	requests uint64
+	errors   map[string]uint64 // By class, see modbus.Classify
+	buckets  [numBuckets]uint64
+	max      time.Duration
+}
+
+// NewRecorder creates a recorder, counting from now.
+func NewRecorder() *Recorder {
+	return &Recorder{start: time.Now(), routes: make(map[Route]*route)}
+}
+
+// Observe records a request along key that took d. Exception responses count as errors.
+func (r *Recorder) Observe(key Route, d time.Duration, resp modbus.ProtocolDataUnit, err error) {
+	class := ""
+	switch {
+	case err != nil:
+		class = modbus.Classify(err)
+	case resp.FunctionCode&0x80 != 0:
+		class = "exception"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.routes[key]
+	if !ok {
+		rt = &route{errors: make(map[string]uint64)}
+		r.routes[key] = rt
+	}
+	rt.requests++
+	if class != "" {
+		rt.errors[class]++
+	}
+	rt.buckets[bucket(d)]++
+	if d > rt.max {
+		rt.max = d
+	}
+}
+
+func bucket(d time.Duration) int {
+	if d <= minLatency {
+		return 0
+	}
+	i := int(math.Ceil(bucketsPerOctave * math.Log2(float64(d)/float64(minLatency))))
+	if i >= numBuckets {
+		return numBuckets - 1
+	}
+	return i
+}
+
+// upperBound is the largest latency counted in bucket i.
+func upperBound(i int) time.Duration {
+	return time.Duration(float64(minLatency) * math.Exp2(float64(i)/bucketsPerOctave))
+}
+
+// Latency holds latency percentiles in milliseconds.
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Summary is the report of one route.
+type Summary struct {
+	Gateway    string            `json:"gateway"`
+	Upstream   string            `json:"upstream"`
+	SlaveID    byte              `json:"slave_id"`
+	Downstream string            `json:"downstream"`
+	Since      time.Time         `json:"since"`
+	Requests   uint64            `json:"requests"`
+	Errors     map[string]uint64 `json:"errors,omitempty"`
+	ErrorRate  float64           `json:"error_rate"`
+	Latency    Latency           `json:"latency_ms"`
+}
+
+// Summaries reports every route seen so far, ordered by slave ID and upstream.
+func (r *Recorder) Summaries(gateway string) []Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summaries := make([]Summary, 0, len(r.routes))
+	for key, rt := range r.routes {
+		s := Summary{Gateway: gateway, Upstream: key.Upstream, SlaveID: key.SlaveID, Downstream: key.Downstream, Since: r.start, Requests: rt.requests}
+		var failed uint64
+		if len(rt.errors) > 0 {
+			s.Errors = make(map[string]uint64, len(rt.errors))
+			for class, n := range rt.errors {
+				s.Errors[class] = n
+				failed += n
+			}
+		}
+		s.ErrorRate = float64(failed) / float64(rt.requests)
+		s.Latency = Latency{
+			P50: ms(rt.percentile(50)),
+			P90: ms(rt.percentile(90)),
+			P99: ms(rt.percentile(99)),
+			Max: ms(rt.max),
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.SlaveID != b.SlaveID {
+			return a.SlaveID < b.SlaveID
+		}
+		if a.Upstream != b.Upstream {
+			return a.Upstream < b.Upstream
+		}
+		return a.Downstream < b.Downstream
+	})
+	return summaries
+}
+
+// percentile returns the upper bound of the bucket holding the p-th percentile, capped at the maximum.
+func (rt *route) percentile(p float64) time.Duration {
+	rank := uint64(math.Ceil(p / 100 * float64(rt.requests)))
+	var seen uint64
+	for i, n := range rt.buckets {
+		seen += n
+		if seen >= rank && n > 0 {
+			return min(upperBound(i), rt.max)
+		}
+	}
+	return rt.max
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func ms(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// WriteTable writes summaries as a table, one route per line.
+func WriteTable(w io.Writer, summaries []Summary) error {
+	if len(summaries) == 0 {
+		_, err := fmt.Fprintln(w, "-- No requests")
+		return err
+	}
+	since := summaries[0].Since
+	fmt.Fprintf(w, "-- Requests since %s (%v)\n", since.Format(time.RFC3339), time.Since(since).Round(time.Second))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GATEWAY\tUPSTREAM\tSLAVE\tDOWNSTREAM\tREQUESTS\tERRORS\tERROR RATE\tP50\tP90\tP99\tMAX\t")
+	for _, s := range summaries {
+		classes := make([]string, 0, len(s.Errors))
+		var failed uint64
+		for class, n := range s.Errors {
+			classes = append(classes, fmt.Sprintf("%s %d", class, n))
+			failed += n
+		}
+		sort.Strings(classes)
+		errs := fmt.Sprint(failed)
+		if len(classes) > 0 {
+			errs += " (" + strings.Join(classes, ", ") + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s\t%.2f%%\t%.3fms\t%.3fms\t%.3fms\t%.3fms\t\n",
+			s.Gateway, s.Upstream, s.SlaveID, dash(s.Downstream), s.Requests, errs, s.ErrorRate*100,
+			s.Latency.P50, s.Latency.P90, s.Latency.P99, s.Latency.Max)
+	}
+	return tw.Flush()
+}
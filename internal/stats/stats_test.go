@@ -0,0 +1,114 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package stats
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+var ok = modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{2, 0, 0}}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	for i := 1; i <= 100; i++ {
+		r.Observe(Route{Upstream: "0.0.0.0:502", SlaveID: 1, Downstream: "plc"}, time.Duration(i)*time.Millisecond, ok, nil)
+	}
+	r.Observe(Route{Upstream: "0.0.0.0:502", SlaveID: 2, Downstream: "plc"}, time.Second, modbus.ProtocolDataUnit{}, modbus.ErrTimeout)
+	r.Observe(Route{Upstream: "0.0.0.0:502", SlaveID: 2, Downstream: "plc"}, time.Millisecond, modbus.ProtocolDataUnit{FunctionCode: 0x83, Data: []byte{2}}, nil)
+	r.Observe(Route{Upstream: "0.0.0.0:502", SlaveID: 2, Downstream: "plc"}, time.Millisecond, ok, nil)
+
+	r.Observe(Route{Upstream: "/dev/ttyS0", SlaveID: 1, Downstream: "plc"}, time.Millisecond, ok, nil)
+
+	s := r.Summaries("plant")
+	if len(s) != 3 || s[0].SlaveID != 1 || s[0].Upstream != "/dev/ttyS0" || s[1].Upstream != "0.0.0.0:502" || s[2].SlaveID != 2 {
+		t.Fatalf("Summaries() = %+v", s)
+	}
+	if s[1].Requests != 100 || s[1].ErrorRate != 0 || s[1].Errors != nil || s[1].Downstream != "plc" {
+		t.Errorf("slave 1 = %+v", s[1])
+	}
+	// Percentiles are bucket bounds, within 9% above the exact value
+	for _, c := range []struct{ got, want float64 }{{s[1].Latency.P50, 50}, {s[1].Latency.P90, 90}, {s[1].Latency.P99, 99}} {
+		if c.got < c.want || c.got > c.want*1.095 {
+			t.Errorf("percentile %v ms, want about %v ms", c.got, c.want)
+		}
+	}
+	if s[1].Latency.Max != 100 {
+		t.Errorf("max %v ms, want 100", s[0].Latency.Max)
+	}
+
+	if s[2].Errors["timeout"] != 1 || s[2].Errors["exception"] != 1 || math.Abs(s[2].ErrorRate-2.0/3) > 1e-9 {
+		t.Errorf("slave 2 = %+v", s[2])
+	}
+}
+
+func TestBucket(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Microsecond, 37 * time.Microsecond, time.Millisecond, 3 * time.Second, time.Hour} {
+		i := bucket(d)
+		if i < 0 || i >= numBuckets {
+			t.Fatalf("bucket(%v) = %d out of range", d, i)
+		}
+		if i < numBuckets-1 && d > upperBound(i) {
+			t.Errorf("%v above upper bound %v of its bucket", d, upperBound(i))
+		}
+		if i > 0 && d <= upperBound(i-1) {
+			t.Errorf("%v fits the previous bucket ending at %v", d, upperBound(i-1))
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	r := NewRecorder()
+	r.Observe(Route{Upstream: "0.0.0.0:502", SlaveID: 7, Downstream: "plc"}, 2*time.Millisecond, ok, nil)
+	r.Observe(Route{Upstream: "0.0.0.0:502", SlaveID: 7, Downstream: "plc"}, time.Second, modbus.ProtocolDataUnit{}, modbus.ErrTimeout)
+
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, r.Summaries("plant")); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"GATEWAY", "UPSTREAM", "plant", "0.0.0.0:502", "plc", "1 (timeout 1)", "50.00%", "1000.000ms"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table lacks %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	WriteTable(&buf, nil)
+	if !strings.Contains(buf.String(), "No requests") {
+		t.Errorf("empty table = %q", buf.String())
+	}
+}
+
+func TestTrace(t *testing.T) {
+	tr := NewTrace("plant", 2)
+	route := Route{Upstream: "0.0.0.0:502", SlaveID: 1, Downstream: "plc"}
+	read := modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}}
+	start := time.Now()
+	tr.Add(route, start, time.Millisecond, read, ok, nil)
+	tr.Add(route, start, 2*time.Millisecond, read, modbus.ProtocolDataUnit{FunctionCode: 0x83, Data: []byte{2}}, nil)
+	tr.Add(route, start, time.Second, read, modbus.ProtocolDataUnit{}, modbus.ErrTimeout)
+
+	txs := tr.Transactions()
+	if len(txs) != 2 {
+		t.Fatalf("Transactions() = %+v, want the last 2", txs)
+	}
+	if tx := txs[0]; tx.Gateway != "plant" || tx.Request != "0300000001" || tx.Response != "" || tx.Exception != modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond || tx.Error == "" || tx.Latency != 1000 {
+		t.Errorf("timed out transaction = %+v", tx)
+	}
+	if tx := txs[1]; tx.Response != "8302" || tx.Exception != 2 || tx.Error != "" || tx.Downstream != "plc" {
+		t.Errorf("exception transaction = %+v", tx)
+	}
+
+	var none *Trace
+	none.Add(route, start, time.Millisecond, read, ok, nil)
+	if txs := NewTrace("plant", 0).Transactions(); txs != nil {
+		t.Errorf("Transactions() of no trace = %+v", txs)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package stats
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// Transaction is a request and its outcome, for inspecting live traffic.
+type Transaction struct {
+	Gateway    string    `json:"gateway"`
+	Time       time.Time `json:"time"`
+	Upstream   string    `json:"upstream"`
+	SlaveID    byte      `json:"slave_id"`
+	Downstream string    `json:"downstream"`          // Empty if unrouted
+	Request    string    `json:"request"`             // PDU in hex, function code first
+	Response   string    `json:"response,omitempty"`  // PDU in hex, empty if the request failed
+	Latency    float64   `json:"latency_ms"`          // Milliseconds
+	Exception  byte      `json:"exception,omitempty"` // Exception code answered, by the slave or the gateway
+	Error      string    `json:"error,omitempty"`     // Why the gateway answered with an exception itself
+}
+
+// Trace keeps the last transactions of a gateway instance.
+type Trace struct {
+	gateway string
+
+	mu   sync.Mutex
+	ring []Transaction
+	next int // Index the next transaction goes to
+	full bool
+}
+
+// NewTrace creates a trace of the last n transactions of gateway. A size below 1
+// returns nil, which keeps none.
+func NewTrace(gateway string, n int) *Trace {
+	if n < 1 {
+		return nil
+	}
+	return &Trace{gateway: gateway, ring: make([]Transaction, n)}
+}
+
+// Add records a request along key that started at start and took d.
+func (t *Trace) Add(key Route, start time.Time, d time.Duration, req, resp modbus.ProtocolDataUnit, err error) {
+	if t == nil {
+		return
+	}
+	tx := Transaction{
+		Gateway:    t.gateway,
+		Time:       start,
+		Upstream:   key.Upstream,
+		SlaveID:    key.SlaveID,
+		Downstream: key.Downstream,
+		Request:    encode(req),
+		Latency:    ms(d),
+	}
+	switch {
+	case err != nil:
+		tx.Exception = modbus.ExceptionCodeOf(err)
+		tx.Error = err.Error()
+	default:
+		tx.Response = encode(resp)
+		if resp.FunctionCode&0x80 != 0 && len(resp.Data) > 0 {
+			tx.Exception = resp.Data[0]
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ring[t.next] = tx
+	t.next = (t.next + 1) % len(t.ring)
+	t.full = t.full || t.next == 0
+}
+
+// Transactions returns the transactions kept, newest first.
+func (t *Trace) Transactions() []Transaction {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.next
+	if t.full {
+		n = len(t.ring)
+	}
+	txs := make([]Transaction, 0, n)
+	for i := 1; i <= n; i++ {
+		txs = append(txs, t.ring[(t.next-i+len(t.ring))%len(t.ring)])
+	}
+	return txs
+}
+
+func encode(pdu modbus.ProtocolDataUnit) string {
+	return hex.EncodeToString(append([]byte{pdu.FunctionCode}, pdu.Data...))
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package sunspec
+
+// point is a data point of a SunSpec model.
+// Offsets are relative to the first register after the model ID and length.
+type point struct {
+	name   string
+	offset uint16
+	typ    string // SunSpec type: uint16, int16, acc32, float32, enum16, bitfield32, string, ...
+	length int    // Registers of a string
+	sf     string // Name of the scale factor point, if any
+}
+
+// model is the definition of a SunSpec information model.
+type model struct {
+	name   string
+	points []point
+}
+
+// commonModel is model 1, present on every SunSpec device.
+var commonModel = model{"common", []point{
+	{name: "Mn", offset: 0, typ: "string", length: 16},
+	{name: "Md", offset: 16, typ: "string", length: 16},
+	{name: "Opt", offset: 32, typ: "string", length: 8},
+	{name: "Vr", offset: 40, typ: "string", length: 8},
+	{name: "SN", offset: 48, typ: "string", length: 16},
+	{name: "DA", offset: 64, typ: "uint16"},
+}}
+
+// inverterModel covers the integer + scale factor inverter models 101, 102 and 103.
+var inverterModel = model{"inverter", []point{
+	{name: "A", offset: 0, typ: "uint16", sf: "A_SF"},
+	{name: "AphA", offset: 1, typ: "uint16", sf: "A_SF"},
+	{name: "AphB", offset: 2, typ: "uint16", sf: "A_SF"},
+	{name: "AphC", offset: 3, typ: "uint16", sf: "A_SF"},
+	{name: "A_SF", offset: 4, typ: "sunssf"},
+	{name: "PPVphAB", offset: 5, typ: "uint16", sf: "V_SF"},
+	{name: "PPVphBC", offset: 6, typ: "uint16", sf: "V_SF"},
+	{name: "PPVphCA", offset: 7, typ: "uint16", sf: "V_SF"},
+	{name: "PhVphA", offset: 8, typ: "uint16", sf: "V_SF"},
+	{name: "PhVphB", offset: 9, typ: "uint16", sf: "V_SF"},
+	{name: "PhVphC", offset: 10, typ: "uint16", sf: "V_SF"},
+	{name: "V_SF", offset: 11, typ: "sunssf"},
+	{name: "W", offset: 12, typ: "int16", sf: "W_SF"},
+	{name: "W_SF", offset: 13, typ: "sunssf"},
+	{name: "Hz", offset: 14, typ: "uint16", sf: "Hz_SF"},
+	{name: "Hz_SF", offset: 15, typ: "sunssf"},
+	{name: "VA", offset: 16, typ: "int16", sf: "VA_SF"},
+	{name: "VA_SF", offset: 17, typ: "sunssf"},
+	{name: "VAr", offset: 18, typ: "int16", sf: "VAr_SF"},
+	{name: "VAr_SF", offset: 19, typ: "sunssf"},
+	{name: "PF", offset: 20, typ: "int16", sf: "PF_SF"},
+	{name: "PF_SF", offset: 21, typ: "sunssf"},
+	{name: "WH", offset: 22, typ: "acc32", sf: "WH_SF"},
+	{name: "WH_SF", offset: 24, typ: "sunssf"},
+	{name: "DCA", offset: 25, typ: "uint16", sf: "DCA_SF"},
+	{name: "DCA_SF", offset: 26, typ: "sunssf"},
+	{name: "DCV", offset: 27, typ: "uint16", sf: "DCV_SF"},
+	{name: "DCV_SF", offset: 28, typ: "sunssf"},
+	{name: "DCW", offset: 29, typ: "int16", sf: "DCW_SF"},
+	{name: "DCW_SF", offset: 30, typ: "sunssf"},
+	{name: "TmpCab", offset: 31, typ: "int16", sf: "Tmp_SF"},
+	{name: "TmpSnk", offset: 32, typ: "int16", sf: "Tmp_SF"},
+	{name: "TmpTrns", offset: 33, typ: "int16", sf: "Tmp_SF"},
+	{name: "TmpOt", offset: 34, typ: "int16", sf: "Tmp_SF"},
+	{name: "Tmp_SF", offset: 35, typ: "sunssf"},
+	{name: "St", offset: 36, typ: "enum16"},
+	{name: "StVnd", offset: 37, typ: "enum16"},
+	{name: "Evt1", offset: 38, typ: "bitfield32"},
+	{name: "Evt2", offset: 40, typ: "bitfield32"},
+}}
+
+// floatInverterModel covers the floating point inverter models 111, 112 and 113.
+var floatInverterModel = model{"inverter", []point{
+	{name: "A", offset: 0, typ: "float32"},
+	{name: "AphA", offset: 2, typ: "float32"},
+	{name: "AphB", offset: 4, typ: "float32"},
+	{name: "AphC", offset: 6, typ: "float32"},
+	{name: "PPVphAB", offset: 8, typ: "float32"},
+	{name: "PPVphBC", offset: 10, typ: "float32"},
+	{name: "PPVphCA", offset: 12, typ: "float32"},
+	{name: "PhVphA", offset: 14, typ: "float32"},
+	{name: "PhVphB", offset: 16, typ: "float32"},
+	{name: "PhVphC", offset: 18, typ: "float32"},
+	{name: "W", offset: 20, typ: "float32"},
+	{name: "Hz", offset: 22, typ: "float32"},
+	{name: "VA", offset: 24, typ: "float32"},
+	{name: "VAr", offset: 26, typ: "float32"},
+	{name: "PF", offset: 28, typ: "float32"},
+	{name: "WH", offset: 30, typ: "float32"},
+	{name: "DCA", offset: 32, typ: "float32"},
+	{name: "DCV", offset: 34, typ: "float32"},
+	{name: "DCW", offset: 36, typ: "float32"},
+	{name: "TmpCab", offset: 38, typ: "float32"},
+	{name: "TmpSnk", offset: 40, typ: "float32"},
+	{name: "TmpTrns", offset: 42, typ: "float32"},
+	{name: "TmpOt", offset: 44, typ: "float32"},
+	{name: "St", offset: 46, typ: "enum16"},
+	{name: "StVnd", offset: 47, typ: "enum16"},
+	{name: "Evt1", offset: 48, typ: "bitfield32"},
+	{name: "Evt2", offset: 50, typ: "bitfield32"},
+}}
+
+// meterModel covers the integer + scale factor meter models 201 to 204.
+var meterModel = model{"meter", []point{
+	{name: "A", offset: 0, typ: "int16", sf: "A_SF"},
+	{name: "AphA", offset: 1, typ: "int16", sf: "A_SF"},
+	{name: "AphB", offset: 2, typ: "int16", sf: "A_SF"},
+	{name: "AphC", offset: 3, typ: "int16", sf: "A_SF"},
+	{name: "A_SF", offset: 4, typ: "sunssf"},
+	{name: "PhV", offset: 5, typ: "int16", sf: "V_SF"},
+	{name: "PhVphA", offset: 6, typ: "int16", sf: "V_SF"},
+	{name: "PhVphB", offset: 7, typ: "int16", sf: "V_SF"},
+	{name: "PhVphC", offset: 8, typ: "int16", sf: "V_SF"},
+	{name: "PPV", offset: 9, typ: "int16", sf: "V_SF"},
+	{name: "PPVphAB", offset: 10, typ: "int16", sf: "V_SF"},
+	{name: "PPVphBC", offset: 11, typ: "int16", sf: "V_SF"},
+	{name: "PPVphCA", offset: 12, typ: "int16", sf: "V_SF"},
+	{name: "V_SF", offset: 13, typ: "sunssf"},
+	{name: "Hz", offset: 14, typ: "int16", sf: "Hz_SF"},
+	{name: "Hz_SF", offset: 15, typ: "sunssf"},
+	{name: "W", offset: 16, typ: "int16", sf: "W_SF"},
+	{name: "WphA", offset: 17, typ: "int16", sf: "W_SF"},
+	{name: "WphB", offset: 18, typ: "int16", sf: "W_SF"},
+	{name: "WphC", offset: 19, typ: "int16", sf: "W_SF"},
+	{name: "W_SF", offset: 20, typ: "sunssf"},
+	{name: "VA", offset: 21, typ: "int16", sf: "VA_SF"},
+	{name: "VA_SF", offset: 25, typ: "sunssf"},
+	{name: "VAR", offset: 26, typ: "int16", sf: "VAR_SF"},
+	{name: "VAR_SF", offset: 30, typ: "sunssf"},
+	{name: "PF", offset: 31, typ: "int16", sf: "PF_SF"},
+	{name: "PF_SF", offset: 35, typ: "sunssf"},
+	{name: "TotWhExp", offset: 36, typ: "acc32", sf: "TotWh_SF"},
+	{name: "TotWhImp", offset: 44, typ: "acc32", sf: "TotWh_SF"},
+	{name: "TotWh_SF", offset: 52, typ: "sunssf"},
+}}
+
+// models maps the supported model IDs to their definitions.
+// Devices may expose other models, those are skipped during discovery.
+var models = map[uint16]model{
+	1:   commonModel,
+	101: inverterModel,
+	102: inverterModel,
+	103: inverterModel,
+	111: floatInverterModel,
+	112: floatInverterModel,
+	113: floatInverterModel,
+	201: meterModel,
+	202: meterModel,
+	203: meterModel,
+	204: meterModel,
+}
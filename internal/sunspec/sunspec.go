@@ -0,0 +1,250 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package sunspec discovers the SunSpec information models of solar inverters and
+// meters and generates typed, scaled tags for their data points.
+package sunspec
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+const (
+	marker    = 0x53756E53 // "SunS"
+	endModel  = 0xFFFF
+	maxModels = 64
+
+	// sfNotImplemented is returned by devices for scale factors they don't support.
+	sfNotImplemented = math.MinInt16
+
+	retryInterval = 30 * time.Second
+)
+
+// DefaultBaseAddresses are the registers the "SunS" marker is searched at, in order.
+var DefaultBaseAddresses = []uint16{40000, 0, 50000}
+
+// ModelInfo is an entry of a device's model chain.
+type ModelInfo struct {
+	ID      uint16
+	Address uint16 // First register after the model ID and length
+	Length  uint16 // Registers in the model
+}
+
+// Discover locates the SunSpec marker at one of the base addresses and walks the model chain.
+func Discover(ctx context.Context, h transport.RequestHandler, slaveID byte, bases []uint16) ([]ModelInfo, error) {
+	for _, base := range bases {
+		v, err := tag.Read(ctx, h, header(slaveID, base))
+		if err != nil || v.(uint32) != marker {
+			continue
+		}
+		transport.Logger(ctx).Debug("Found SunSpec marker", "slaveID", slaveID, "address", base)
+		return walk(ctx, h, slaveID, base+2)
+	}
+	return nil, fmt.Errorf("slave %d: no SunSpec marker found at %v", slaveID, bases)
+}
+
+func walk(ctx context.Context, h transport.RequestHandler, slaveID byte, addr uint16) ([]ModelInfo, error) {
+	var chain []ModelInfo
+	for len(chain) < maxModels {
+		v, err := tag.Read(ctx, h, header(slaveID, addr))
+		if err != nil {
+			return nil, fmt.Errorf("slave %d: failed to read model header at %d: %w", slaveID, addr, err)
+		}
+		id, length := uint16(v.(uint32)>>16), uint16(v.(uint32))
+		if id == endModel {
+			return chain, nil
+		}
+		next := uint32(addr) + 2 + uint32(length)
+		if next > math.MaxUint16 {
+			return nil, fmt.Errorf("slave %d: model %d at %d overflows the address space", slaveID, id, addr)
+		}
+		chain = append(chain, ModelInfo{ID: id, Address: addr + 2, Length: length})
+		addr = uint16(next)
+	}
+	return nil, fmt.Errorf("slave %d: model chain longer than %d models", slaveID, maxModels)
+}
+
+// header returns a tag reading the two registers of a marker or model header.
+func header(slaveID byte, addr uint16) tag.Tag {
+	return tag.Tag{Name: "sunspec_header", SlaveID: slaveID, Table: tag.TableHoldingRegisters, Address: addr, Type: tag.TypeUint32}
+}
+
+// GenerateTags creates a tag for every point of the supported models, named
+// <prefix>_<model>_<point>. Scale factors are read once and applied to the tags.
+func GenerateTags(ctx context.Context, h transport.RequestHandler, slaveID byte, prefix string, chain []ModelInfo) ([]tag.Tag, error) {
+	var tags []tag.Tag
+	seen := make(map[string]int)
+	for _, info := range chain {
+		def, ok := models[info.ID]
+		if !ok {
+			transport.Logger(ctx).Debug("Skipping unsupported SunSpec model", "slaveID", slaveID, "model", info.ID)
+			continue
+		}
+		seen[def.name]++
+		name := def.name
+		if n := seen[def.name]; n > 1 {
+			name = fmt.Sprintf("%s%d", def.name, n)
+		}
+
+		scales := make(map[string]float64)
+		for _, p := range def.points {
+			if p.typ == "sunssf" {
+				continue
+			}
+			typ, ok := dataType(p.typ)
+			if !ok {
+				continue
+			}
+			t := tag.Tag{
+				Name:    fmt.Sprintf("%s_%s_%s", prefix, name, p.name),
+				SlaveID: slaveID,
+				Table:   tag.TableHoldingRegisters,
+				Address: info.Address + p.offset,
+				Type:    typ,
+				Length:  p.length,
+			}
+			if p.offset+t.Quantity() > info.Length {
+				continue // Point not present in this (shorter) model revision
+			}
+			if p.sf != "" {
+				scale, err := readScale(ctx, h, slaveID, info, def, p.sf, scales)
+				if err != nil {
+					return nil, err
+				}
+				t.Scale = scale
+			}
+			tags = append(tags, t)
+		}
+	}
+	return tags, nil
+}
+
+// readScale reads a scale factor point and converts it to a multiplier, caching it per model.
+func readScale(ctx context.Context, h transport.RequestHandler, slaveID byte, info ModelInfo, def model, sf string, cache map[string]float64) (float64, error) {
+	if scale, ok := cache[sf]; ok {
+		return scale, nil
+	}
+	for _, p := range def.points {
+		if p.name != sf {
+			continue
+		}
+		if p.offset >= info.Length {
+			break
+		}
+		t := tag.Tag{Name: sf, SlaveID: slaveID, Table: tag.TableHoldingRegisters, Address: info.Address + p.offset, Type: tag.TypeInt16}
+		v, err := tag.Read(ctx, h, t)
+		if err != nil {
+			return 0, fmt.Errorf("slave %d: failed to read scale factor %s: %w", slaveID, sf, err)
+		}
+		var scale float64
+		if exp := v.(int16); exp != sfNotImplemented {
+			scale = math.Pow10(int(exp))
+		}
+		cache[sf] = scale
+		return scale, nil
+	}
+	cache[sf] = 0
+	return 0, nil
+}
+
+func dataType(typ string) (tag.DataType, bool) {
+	switch typ {
+	case "uint16", "enum16", "bitfield16", "count":
+		return tag.TypeUint16, true
+	case "int16":
+		return tag.TypeInt16, true
+	case "uint32", "acc32", "enum32", "bitfield32":
+		return tag.TypeUint32, true
+	case "int32":
+		return tag.TypeInt32, true
+	case "uint64", "acc64":
+		return tag.TypeUint64, true
+	case "int64":
+		return tag.TypeInt64, true
+	case "float32":
+		return tag.TypeFloat32, true
+	case "string":
+		return tag.TypeString, true
+	default:
+		return 0, false
+	}
+}
+
+// Scanner implements gateway.Service, discovering the configured devices once the
+// downstreams are up and adding their tags to the gateway's tag registry.
+type Scanner struct {
+	gateway  string
+	devices  []config.SunSpecConfig
+	registry *tag.Registry
+	handler  transport.RequestHandler
+}
+
+// NewScanner creates a scanner for the given devices.
+func NewScanner(gateway string, devices []config.SunSpecConfig, registry *tag.Registry, handler transport.RequestHandler) *Scanner {
+	return &Scanner{gateway: gateway, devices: devices, registry: registry, handler: handler}
+}
+
+// Run scans every device, retrying unreachable ones until all are discovered or ctx is cancelled.
+func (s *Scanner) Run(ctx context.Context) error {
+	pending := s.devices
+	for {
+		var failed []config.SunSpecConfig
+		for _, d := range pending {
+			if err := s.scan(ctx, d); err != nil {
+				slog.Warn("SunSpec discovery failed, will retry", "gateway", s.gateway, "slaveID", d.SlaveID, "err", err)
+				failed = append(failed, d)
+			}
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+		pending = failed
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// baseAddresses returns the registers the "SunS" marker of d is searched at, its
+// base address if set, 0 included.
+func baseAddresses(d config.SunSpecConfig) []uint16 {
+	if d.BaseAddress != nil {
+		return []uint16{*d.BaseAddress}
+	}
+	return DefaultBaseAddresses
+}
+
+func (s *Scanner) scan(ctx context.Context, d config.SunSpecConfig) error {
+	chain, err := Discover(ctx, s.handler, d.SlaveID, baseAddresses(d))
+	if err != nil {
+		return err
+	}
+	tags, err := GenerateTags(ctx, s.handler, d.SlaveID, d.Prefix, chain)
+	if err != nil {
+		return err
+	}
+	if err := s.registry.Add(tags...); err != nil {
+		// A naming conflict won't go away by retrying.
+		slog.Error("Failed to register SunSpec tags", "gateway", s.gateway, "slaveID", d.SlaveID, "err", err)
+		return nil
+	}
+
+	ids := make([]uint16, len(chain))
+	for i, m := range chain {
+		ids[i] = m.ID
+	}
+	slog.Info("Discovered SunSpec device", "gateway", s.gateway, "slaveID", d.SlaveID, "models", ids, "tags", len(tags))
+	return nil
+}
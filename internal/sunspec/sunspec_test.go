@@ -0,0 +1,131 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package sunspec
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// registerMap is a fake slave answering Read Holding Registers from a sparse register map.
+type registerMap map[uint16]uint16
+
+func (m registerMap) handle(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	addr := binary.BigEndian.Uint16(pdu.Data[0:2])
+	n := binary.BigEndian.Uint16(pdu.Data[2:4])
+	data := []byte{byte(n * 2)}
+	for i := uint16(0); i < n; i++ {
+		v, ok := m[addr+i]
+		if !ok {
+			return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode | 0x80, Data: []byte{modbus.ExceptionCodeIllegalDataAddress}}, nil
+		}
+		data = binary.BigEndian.AppendUint16(data, v)
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: data}, nil
+}
+
+func (m registerMap) fill(addr, n uint16) {
+	for i := uint16(0); i < n; i++ {
+		m[addr+i] = 0
+	}
+}
+
+func newDevice() registerMap {
+	m := registerMap{40000: 0x5375, 40001: 0x6E53}
+
+	// Common model
+	m[40002], m[40003] = 1, 66
+	m.fill(40004, 66)
+	m[40004], m[40005] = 'A'<<8|'C', 'M'<<8|'E'
+
+	// Three phase inverter, W = 1234 * 10^-1
+	m[40070], m[40071] = 103, 50
+	m.fill(40072, 50)
+	m[40072+12] = 1234
+	m[40072+13] = 0xFFFF
+	m[40072+4] = 0x8000 // A_SF not implemented
+
+	// Vendor model, not supported
+	m[40122], m[40123] = 64001, 2
+	m.fill(40124, 2)
+
+	m[40126], m[40127] = 0xFFFF, 0
+	return m
+}
+
+func TestDiscover(t *testing.T) {
+	dev := newDevice()
+	chain, err := Discover(context.Background(), dev.handle, 1, DefaultBaseAddresses)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	want := []ModelInfo{{1, 40004, 66}, {103, 40072, 50}, {64001, 40124, 2}}
+	if len(chain) != len(want) {
+		t.Fatalf("Discover() = %+v, want %+v", chain, want)
+	}
+	for i := range want {
+		if chain[i] != want[i] {
+			t.Errorf("model %d = %+v, want %+v", i, chain[i], want[i])
+		}
+	}
+
+	if _, err := Discover(context.Background(), registerMap{}.handle, 1, DefaultBaseAddresses); err == nil {
+		t.Error("Discover() on a non SunSpec device expected error")
+	}
+}
+
+func TestGenerateTags(t *testing.T) {
+	dev := newDevice()
+	ctx := context.Background()
+	chain, err := Discover(ctx, dev.handle, 1, DefaultBaseAddresses)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	tags, err := GenerateTags(ctx, dev.handle, 1, "pv", chain)
+	if err != nil {
+		t.Fatalf("GenerateTags() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want any
+	}{
+		{"pv_common_Mn", "ACME"},
+		{"pv_inverter_W", 123.4},
+		{"pv_inverter_A", uint16(0)}, // Unscaled, scale factor not implemented
+	}
+	for _, tt := range tests {
+		tg, ok := tag.Lookup(tags, tt.name)
+		if !ok {
+			t.Errorf("tag %s not generated", tt.name)
+			continue
+		}
+		got, err := tag.Read(ctx, dev.handle, tg)
+		if err != nil {
+			t.Errorf("Read(%s) error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Read(%s) = %v (%T), want %v (%T)", tt.name, got, got, tt.want, tt.want)
+		}
+	}
+	if _, ok := tag.Lookup(tags, "pv_inverter_W_SF"); ok {
+		t.Error("scale factor points must not become tags")
+	}
+}
+
+func TestBaseAddresses(t *testing.T) {
+	zero := uint16(0)
+	if got := baseAddresses(config.SunSpecConfig{BaseAddress: &zero}); len(got) != 1 || got[0] != 0 {
+		t.Errorf("base addresses with base_address 0 = %v, want [0]", got)
+	}
+	if got := baseAddresses(config.SunSpecConfig{}); len(got) != len(DefaultBaseAddresses) {
+		t.Errorf("base addresses unset = %v, want %v", got, DefaultBaseAddresses)
+	}
+}
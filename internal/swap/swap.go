@@ -0,0 +1,94 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package swap reorders the register values exchanged with devices that store
+// multi-register values in another byte or word order than their masters expect.
+//
+// Byte swapping exchanges the two bytes of every register; word swapping exchanges
+// the registers of every pair, counted from the first register of a request, so
+// 32-bit values must start at the address read or written, or an even number of
+// registers after it. A trailing odd register is left alone. Both apply to the
+// values of register reads and writes on their way to the device and back; coils,
+// and the addresses and quantities of requests, are never touched.
+package swap
+
+import (
+	"context"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Downstream is a downstream whose register values are reordered.
+type Downstream struct {
+	transport.Downstream
+	words, bytes bool
+}
+
+// Wrap returns ds with the words of register pairs swapped if words is set, and
+// the bytes of registers if bytes is set.
+func Wrap(ds transport.Downstream, words, bytes bool) *Downstream {
+	return &Downstream{Downstream: ds, words: words, bytes: bytes}
+}
+
+// Send forwards the request with the values it writes reordered, and reorders
+// the values of the response.
+func (d *Downstream) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	req = d.request(req)
+	resp, err := d.Downstream.Send(ctx, slaveID, req)
+	if err != nil || resp.FunctionCode != req.FunctionCode {
+		return resp, err
+	}
+	return d.response(resp), nil
+}
+
+// request reorders the values req writes.
+func (d *Downstream) request(req modbus.ProtocolDataUnit) modbus.ProtocolDataUnit {
+	switch req.FunctionCode {
+	case modbus.FuncCodeWriteSingleRegister:
+		req.Data = d.reorder(req.Data, 2, 2, false)
+	case modbus.FuncCodeMaskWriteRegister:
+		req.Data = d.reorder(req.Data, 2, 4, false) // The AND and OR masks are no pair
+	case modbus.FuncCodeWriteMultipleRegisters:
+		req.Data = d.reorder(req.Data, 5, len(req.Data)-5, d.words)
+	case modbus.FuncCodeReadWriteMultipleRegisters:
+		req.Data = d.reorder(req.Data, 9, len(req.Data)-9, d.words)
+	}
+	return req
+}
+
+// response reorders the values resp reads, and those write responses echo.
+func (d *Downstream) response(resp modbus.ProtocolDataUnit) modbus.ProtocolDataUnit {
+	switch resp.FunctionCode {
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters, modbus.FuncCodeReadWriteMultipleRegisters:
+		resp.Data = d.reorder(resp.Data, 1, len(resp.Data)-1, d.words)
+	case modbus.FuncCodeWriteSingleRegister:
+		resp.Data = d.reorder(resp.Data, 2, 2, false)
+	case modbus.FuncCodeMaskWriteRegister:
+		resp.Data = d.reorder(resp.Data, 2, 4, false)
+	}
+	return resp
+}
+
+// reorder returns a copy of data with the n bytes of registers at offset
+// reordered, their pairs swapped if words is set. Data too short is returned as
+// is, for the device to refuse.
+func (d *Downstream) reorder(data []byte, offset, n int, words bool) []byte {
+	if n < 2 || len(data) < offset+n || !words && !d.bytes {
+		return data
+	}
+	out := append([]byte(nil), data...)
+	regs := out[offset : offset+n-n%2]
+	if words {
+		for i := 0; i+4 <= len(regs); i += 4 {
+			regs[i], regs[i+1], regs[i+2], regs[i+3] = regs[i+2], regs[i+3], regs[i], regs[i+1]
+		}
+	}
+	if d.bytes {
+		for i := 0; i+2 <= len(regs); i += 2 {
+			regs[i], regs[i+1] = regs[i+1], regs[i]
+		}
+	}
+	return out
+}
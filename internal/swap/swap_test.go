@@ -0,0 +1,76 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package swap
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// device stores registers in its own order, little-endian words low first.
+type device struct {
+	regs [8]byte
+	last modbus.ProtocolDataUnit
+}
+
+func (d *device) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	d.last = pdu
+	switch pdu.FunctionCode {
+	case modbus.FuncCodeReadHoldingRegisters:
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: append([]byte{8}, d.regs[:]...)}, nil
+	case modbus.FuncCodeWriteMultipleRegisters:
+		copy(d.regs[:], pdu.Data[5:])
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: pdu.Data[:4]}, nil
+	}
+	return pdu, nil
+}
+
+func (d *device) Connect(ctx context.Context) error { return nil }
+func (d *device) Close() error                      { return nil }
+
+func TestSwap(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		words, bytes bool
+		device       []byte // 0x11223344 and 0x55667788 as the device stores them
+	}{
+		{"words", true, false, []byte{0x33, 0x44, 0x11, 0x22, 0x77, 0x88, 0x55, 0x66}},
+		{"bytes", false, true, []byte{0x22, 0x11, 0x44, 0x33, 0x66, 0x55, 0x88, 0x77}},
+		{"both", true, true, []byte{0x44, 0x33, 0x22, 0x11, 0x88, 0x77, 0x66, 0x55}},
+	} {
+		dev := &device{}
+		ds := Wrap(dev, tt.words, tt.bytes)
+		values := []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88}
+
+		write := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteMultipleRegisters, Data: append([]byte{0, 0, 0, 4, 8}, values...)}
+		if _, err := ds.Send(context.Background(), 1, write); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dev.regs[:], tt.device) {
+			t.Errorf("%s: write stored % X, want % X", tt.name, dev.regs, tt.device)
+		}
+		if !bytes.Equal(write.Data[5:], values) {
+			t.Errorf("%s: request of the master modified", tt.name)
+		}
+		resp, err := ds.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 4}})
+		if err != nil || !bytes.Equal(resp.Data[1:], values) {
+			t.Errorf("%s: read = % X, %v, want % X", tt.name, resp.Data, err, values)
+		}
+	}
+
+	// Single registers are no pair, and exceptions pass
+	dev := &device{}
+	ds := Wrap(dev, true, false)
+	single := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0, 1, 0x12, 0x34}}
+	if resp, _ := ds.Send(context.Background(), 1, single); !bytes.Equal(dev.last.Data, single.Data) || !bytes.Equal(resp.Data, single.Data) {
+		t.Errorf("word swap changed a single register write to % X", dev.last.Data)
+	}
+	ds = Wrap(dev, false, true)
+	if resp, _ := ds.Send(context.Background(), 1, single); !bytes.Equal(dev.last.Data, []byte{0, 1, 0x34, 0x12}) || !bytes.Equal(resp.Data, single.Data) {
+		t.Errorf("byte swap of a single register wrote % X and answered % X", dev.last.Data, resp.Data)
+	}
+}
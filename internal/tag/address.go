@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseReference parses a Modicon style reference as found in device manuals,
+// e.g. 40001 or 400001, into its table and zero-based protocol address.
+// The leading digit selects the table (0 coils, 1 discrete inputs, 3 input registers,
+// 4 holding registers), the remaining 4 or 5 digits are the one-based register number.
+func ParseReference(ref string) (Table, uint16, error) {
+	ref = strings.TrimSpace(ref)
+	if len(ref) != 5 && len(ref) != 6 {
+		return 0, 0, fmt.Errorf("invalid reference %q: expected 5 or 6 digits", ref)
+	}
+
+	var table Table
+	switch ref[0] {
+	case '0':
+		table = TableCoils
+	case '1':
+		table = TableDiscreteInputs
+	case '3':
+		table = TableInputRegisters
+	case '4':
+		table = TableHoldingRegisters
+	default:
+		return 0, 0, fmt.Errorf("invalid reference %q: unknown table prefix %c", ref, ref[0])
+	}
+
+	n, err := strconv.ParseUint(ref[1:], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid reference %q: %w", ref, err)
+	}
+	if n < 1 || n > 65536 {
+		return 0, 0, fmt.Errorf("invalid reference %q: register number out of range", ref)
+	}
+	return table, uint16(n - 1), nil
+}
+
+// ParseAddress resolves the table and address of a tag definition.
+// With an explicit table the address is a zero-based protocol address, decimal or
+// 0x-prefixed hex. Without one, 5 and 6 digit addresses are Modicon references and
+// shorter ones are holding register protocol addresses.
+func ParseAddress(table, address string) (Table, uint16, error) {
+	address = strings.TrimSpace(address)
+	if strings.TrimSpace(table) == "" && len(address) >= 5 && !strings.HasPrefix(address, "0x") {
+		return ParseReference(address)
+	}
+
+	t, err := ParseTable(table)
+	if err != nil {
+		return 0, 0, err
+	}
+	if address == "" {
+		return t, 0, nil
+	}
+	base := 10
+	if strings.HasPrefix(address, "0x") {
+		address, base = address[2:], 16
+	}
+	n, err := strconv.ParseUint(address, base, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address %q", address)
+	}
+	return t, uint16(n), nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package tag
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		table, address string
+		wantTable      Table
+		wantAddr       uint16
+		wantErr        bool
+	}{
+		{"", "40001", TableHoldingRegisters, 0, false},
+		{"", "49999", TableHoldingRegisters, 9998, false},
+		{"", "465536", TableHoldingRegisters, 65535, false},
+		{"", "30010", TableInputRegisters, 9, false},
+		{"", "10001", TableDiscreteInputs, 0, false},
+		{"", "000017", TableCoils, 16, false},
+		{"", "100", TableHoldingRegisters, 100, false},
+		{"", "0x10", TableHoldingRegisters, 16, false},
+		{"", "017", TableHoldingRegisters, 17, false},
+		{"holding_register", "40001", TableHoldingRegisters, 40001, false},
+		{"coil", "", TableCoils, 0, false},
+		{"", "40000", 0, 0, true},
+		{"", "465537", 0, 0, true},
+		{"", "20001", 0, 0, true},
+		{"", "4000x", 0, 0, true},
+		{"input_register", "70000", 0, 0, true},
+	}
+	for _, tt := range tests {
+		table, addr, err := ParseAddress(tt.table, tt.address)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAddress(%q, %q) error = %v, wantErr %v", tt.table, tt.address, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (table != tt.wantTable || addr != tt.wantAddr) {
+			t.Errorf("ParseAddress(%q, %q) = %v %d, want %v %d", tt.table, tt.address, table, addr, tt.wantTable, tt.wantAddr)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tag
+
+import (
+	"math"
+	"sync"
+)
+
+// Filter suppresses samples that did not change meaningfully since the last published value.
+// Each exporter owns its own Filter so that their publish histories are independent.
+type Filter struct {
+	mu   sync.Mutex
+	tags map[string]Tag
+	last map[string]Sample
+}
+
+// NewFilter creates a Filter for the given tags.
+func NewFilter(tags []Tag) *Filter {
+	f := &Filter{
+		tags: make(map[string]Tag, len(tags)),
+		last: make(map[string]Sample, len(tags)),
+	}
+	for _, t := range tags {
+		f.tags[t.Name] = t
+	}
+	return f
+}
+
+// Apply returns the samples that should be published and records them as published.
+// Tags without deadband or min_interval settings always pass.
+func (f *Filter) Apply(samples []Sample) []Sample {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := samples[:0:0]
+	for _, s := range samples {
+		if f.pass(s) {
+			f.last[s.Tag] = s
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Reset forgets the publish history, so the next sample of every tag passes.
+func (f *Filter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = make(map[string]Sample, len(f.tags))
+}
+
+func (f *Filter) pass(s Sample) bool {
+	t, ok := f.tags[s.Tag]
+	if !ok || (t.Deadband == 0 && t.DeadbandPercent == 0 && t.MinInterval == 0) {
+		return true
+	}
+	prev, ok := f.last[s.Tag]
+	if !ok {
+		return true
+	}
+	if t.MinInterval > 0 && s.Time.Sub(prev.Time) < t.MinInterval {
+		return false
+	}
+	if t.Deadband == 0 && t.DeadbandPercent == 0 {
+		return true
+	}
+
+	cur, ok1 := toFloat(s.Value)
+	old, ok2 := toFloat(prev.Value)
+	if !ok1 || !ok2 {
+		// Non-numeric values (bits, strings) have no magnitude, publish on change.
+		return s.Value != prev.Value
+	}
+
+	delta := math.Abs(cur - old)
+	if t.Deadband > 0 && delta <= t.Deadband {
+		return false
+	}
+	if t.DeadbandPercent > 0 && delta <= math.Abs(old)*t.DeadbandPercent/100 {
+		return false
+	}
+	return delta > 0
+}
+
+func toFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case uint16:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	default:
+		return 0, false
+	}
+}
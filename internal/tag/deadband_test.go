@@ -0,0 +1,54 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package tag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter_Apply(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	tags := []Tag{
+		{Name: "abs", Deadband: 5},
+		{Name: "pct", DeadbandPercent: 10},
+		{Name: "rate", MinInterval: 10 * time.Second},
+		{Name: "raw"},
+		{Name: "bit", Deadband: 1},
+	}
+
+	tests := []struct {
+		name  string
+		tag   string
+		value any
+		at    time.Duration
+		want  bool
+	}{
+		{"abs first sample", "abs", uint16(100), 0, true},
+		{"abs inside band", "abs", uint16(104), time.Second, false},
+		{"abs on band edge", "abs", uint16(95), 2 * time.Second, false},
+		{"abs outside band", "abs", uint16(106), 3 * time.Second, true},
+		{"pct first sample", "pct", float32(200), 0, true},
+		{"pct inside band", "pct", float32(215), time.Second, false},
+		{"pct outside band", "pct", float32(225), 2 * time.Second, true},
+		{"rate first sample", "rate", uint16(1), 0, true},
+		{"rate too soon", "rate", uint16(2), 5 * time.Second, false},
+		{"rate after interval", "rate", uint16(2), 11 * time.Second, true},
+		{"raw unchanged", "raw", uint16(7), 0, true},
+		{"raw unchanged again", "raw", uint16(7), time.Second, true},
+		{"bit first sample", "bit", false, 0, true},
+		{"bit unchanged", "bit", false, time.Second, false},
+		{"bit changed", "bit", true, 2 * time.Second, true},
+	}
+
+	f := NewFilter(tags)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := f.Apply([]Sample{{Tag: tt.tag, Value: tt.value, Time: t0.Add(tt.at)}})
+			if got := len(out) == 1; got != tt.want {
+				t.Errorf("Apply() passed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
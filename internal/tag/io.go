@@ -0,0 +1,152 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Read reads the current value of a tag through the handler.
+// Bit tables yield a bool, register tables a value of the tag's data type.
+func Read(ctx context.Context, h transport.RequestHandler, t Tag) (any, error) {
+	var req pdu.Request
+	switch t.Table {
+	case TableCoils:
+		req = pdu.ReadCoilsRequest{Address: t.Address, Quantity: 1}
+	case TableDiscreteInputs:
+		req = pdu.ReadDiscreteInputsRequest{Address: t.Address, Quantity: 1}
+	case TableHoldingRegisters:
+		req = pdu.ReadHoldingRegistersRequest{Address: t.Address, Quantity: t.Quantity()}
+	case TableInputRegisters:
+		req = pdu.ReadInputRegistersRequest{Address: t.Address, Quantity: t.Quantity()}
+	default:
+		return nil, fmt.Errorf("tag %s: unsupported table %v", t.Name, t.Table)
+	}
+
+	resp, err := roundTrip(ctx, h, t.SlaveID, req.PDU())
+	if err != nil {
+		return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+	}
+
+	if t.Table == TableCoils || t.Table == TableDiscreteInputs {
+		bits, err := pdu.ParseReadBits(resp, 1)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+		}
+		return bits[0], nil
+	}
+	data, err := pdu.RegisterBytes(resp)
+	if err != nil {
+		return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+	}
+	if len(data) < int(t.Quantity())*2 {
+		return nil, fmt.Errorf("tag %s: short response", t.Name)
+	}
+	v, err := t.Decode(data[:t.Quantity()*2])
+	if err != nil {
+		return nil, err
+	}
+	return t.scale(v), nil
+}
+
+// ReadAll reads every tag and returns the samples that succeeded.
+// Failed tags are reported through the returned error map, keyed by tag name.
+func ReadAll(ctx context.Context, h transport.RequestHandler, tags []Tag) ([]Sample, map[string]error) {
+	samples := make([]Sample, 0, len(tags))
+	var errs map[string]error
+	for _, t := range tags {
+		v, err := Read(ctx, h, t)
+		if err != nil {
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[t.Name] = err
+			continue
+		}
+		samples = append(samples, Sample{Tag: t.Name, Value: v, Time: time.Now()})
+	}
+	return samples, errs
+}
+
+// ErrInvalidValue is matched by the errors of Write for values the tag can't take,
+// as opposed to failures of the request.
+var ErrInvalidValue = errors.New("invalid value")
+
+// valueError keeps the message of an invalid value while matching ErrInvalidValue.
+type valueError struct{ error }
+
+func (e valueError) Is(target error) bool { return target == ErrInvalidValue }
+func (e valueError) Unwrap() error        { return e.error }
+
+// Write writes a value to a tag through the handler.
+// Accepted values are bools, numbers and strings (as decoded from JSON),
+// multi-register values are written with a single Write Multiple Registers request.
+func Write(ctx context.Context, h transport.RequestHandler, t Tag, value any) error {
+	if !t.Table.Writable() {
+		return valueError{fmt.Errorf("tag %s: table %v is read-only", t.Name, t.Table)}
+	}
+
+	var req pdu.Request
+	switch t.Table {
+	case TableCoils:
+		on, err := toBool(value)
+		if err != nil {
+			return valueError{fmt.Errorf("tag %s: %w", t.Name, err)}
+		}
+		req = pdu.WriteSingleCoilRequest{Address: t.Address, Value: on}
+	case TableHoldingRegisters:
+		raw, err := t.unscale(value)
+		if err != nil {
+			return valueError{err}
+		}
+		data, err := t.Encode(raw)
+		if err != nil {
+			return valueError{err}
+		}
+		regs := pdu.DecodeRegisters(data)
+		if len(regs) == 1 {
+			req = pdu.WriteSingleRegisterRequest{Address: t.Address, Value: regs[0]}
+		} else {
+			req = pdu.WriteMultipleRegistersRequest{Address: t.Address, Values: regs}
+		}
+	}
+
+	if _, err := roundTrip(ctx, h, t.SlaveID, req.PDU()); err != nil {
+		return fmt.Errorf("tag %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// roundTrip sends a request and converts exception responses into *modbus.Error.
+func roundTrip(ctx context.Context, h transport.RequestHandler, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	resp, err := h(ctx, slaveID, req)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	if err := pdu.CheckResponse(req.FunctionCode, resp); err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	return resp, nil
+}
+
+func toBool(v any) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case float64:
+		return x != 0, nil
+	case int:
+		return x != 0, nil
+	default:
+		return false, fmt.Errorf("cannot use %T as a coil value", v)
+	}
+}
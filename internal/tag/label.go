@@ -0,0 +1,107 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+// span is the part of a table a request read or wrote, with the values carried.
+type span struct {
+	table   Table
+	address uint16
+	bits    []bool // Coils and discrete inputs
+	data    []byte // Registers, big-endian
+}
+
+// Label names the tags whose values a request and its response carry, e.g.
+// "grid_power=3.2kW battery_charging=true", so logs read in engineering units
+// rather than hex. Tags only partly carried are left out. It is empty if the
+// request carries no tag.
+func Label(tags []Tag, slaveID byte, req, resp modbus.ProtocolDataUnit) string {
+	s, ok := carried(req, resp)
+	if !ok {
+		return ""
+	}
+	var labels []string
+	for _, t := range tags {
+		if t.SlaveID != slaveID || t.Table != s.table || t.Address < s.address {
+			continue
+		}
+		offset := int(t.Address - s.address)
+		if s.bits != nil {
+			if offset < len(s.bits) {
+				labels = append(labels, t.Name+"="+strconv.FormatBool(s.bits[offset]))
+			}
+			continue
+		}
+		end := (offset + int(t.Quantity())) * 2
+		if end > len(s.data) {
+			continue
+		}
+		v, err := t.Decode(s.data[offset*2 : end])
+		if err != nil {
+			continue
+		}
+		labels = append(labels, t.Name+"="+formatValue(t.scale(v))+t.Unit)
+	}
+	return strings.Join(labels, " ")
+}
+
+// carried returns the span of a request, read from the response for reads.
+func carried(req, resp modbus.ProtocolDataUnit) (span, bool) {
+	if req.FunctionCode == modbus.FuncCodeReadWriteMultipleRegisters && len(req.Data) >= 4 {
+		data, err := pdu.RegisterBytes(resp)
+		return span{table: TableHoldingRegisters, address: binary.BigEndian.Uint16(req.Data), data: data}, err == nil
+	}
+	r, err := pdu.ParseRequest(req)
+	if err != nil {
+		return span{}, false
+	}
+	switch r := r.(type) {
+	case pdu.ReadCoilsRequest:
+		bits, err := pdu.ParseReadBits(resp, r.Quantity)
+		return span{table: TableCoils, address: r.Address, bits: bits}, err == nil
+	case pdu.ReadDiscreteInputsRequest:
+		bits, err := pdu.ParseReadBits(resp, r.Quantity)
+		return span{table: TableDiscreteInputs, address: r.Address, bits: bits}, err == nil
+	case pdu.ReadHoldingRegistersRequest:
+		data, err := pdu.RegisterBytes(resp)
+		return span{table: TableHoldingRegisters, address: r.Address, data: data}, err == nil
+	case pdu.ReadInputRegistersRequest:
+		data, err := pdu.RegisterBytes(resp)
+		return span{table: TableInputRegisters, address: r.Address, data: data}, err == nil
+	case pdu.WriteSingleCoilRequest:
+		return span{table: TableCoils, address: r.Address, bits: []bool{r.Value}}, true
+	case pdu.WriteMultipleCoilsRequest:
+		return span{table: TableCoils, address: r.Address, bits: r.Values}, true
+	case pdu.WriteSingleRegisterRequest:
+		return span{table: TableHoldingRegisters, address: r.Address, data: pdu.EncodeRegisters([]uint16{r.Value})}, true
+	case pdu.WriteMultipleRegistersRequest:
+		return span{table: TableHoldingRegisters, address: r.Address, data: pdu.EncodeRegisters(r.Values)}, true
+	}
+	return span{}, false
+}
+
+// formatValue formats floats at float32 precision, so scaled values like 0.1*2301
+// read 230.1.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 32)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
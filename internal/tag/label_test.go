@@ -0,0 +1,41 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package tag
+
+import (
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+)
+
+func TestLabel(t *testing.T) {
+	tags := []Tag{
+		{Name: "grid_power", SlaveID: 1, Table: TableInputRegisters, Address: 10, Type: TypeInt16, Scale: 0.1, Unit: "kW"},
+		{Name: "energy", SlaveID: 1, Table: TableInputRegisters, Address: 11, Type: TypeUint32, Order: OrderCDAB, Unit: "Wh"},
+		{Name: "setpoint", SlaveID: 1, Table: TableHoldingRegisters, Address: 0, Type: TypeFloat32},
+		{Name: "relay", SlaveID: 1, Table: TableCoils, Address: 3, Type: TypeBool},
+		{Name: "other_meter", SlaveID: 2, Table: TableInputRegisters, Address: 10, Type: TypeInt16},
+	}
+	read := pdu.ReadInputRegistersRequest{Address: 10, Quantity: 3}.PDU()
+	tests := []struct {
+		name      string
+		req, resp modbus.ProtocolDataUnit
+		want      string
+	}{
+		{"read", read, pdu.ReadResponse(read.FunctionCode, pdu.EncodeRegisters([]uint16{32, 0x86A0, 0x0001})), "grid_power=3.2kW energy=100000Wh"},
+		{"partly read", read, pdu.ReadResponse(read.FunctionCode, pdu.EncodeRegisters([]uint16{0xFFE2})), "grid_power=-3kW"},
+		{"write", pdu.WriteMultipleRegistersRequest{Address: 0, Values: []uint16{0x4049, 0x0FDB}}.PDU(), modbus.ProtocolDataUnit{}, "setpoint=3.1415927"},
+		{"coil", pdu.WriteSingleCoilRequest{Address: 3, Value: true}.PDU(), modbus.ProtocolDataUnit{}, "relay=true"},
+		{"no tag", pdu.WriteSingleRegisterRequest{Address: 1, Value: 7}.PDU(), modbus.ProtocolDataUnit{}, ""},
+		{"exception", read, pdu.Exception(read.FunctionCode, modbus.ExceptionCodeIllegalDataAddress), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Label(tags, 1, tt.req, tt.resp); got != tt.want {
+				t.Errorf("Label() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tag
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry holds the tags of a gateway. Besides the tags from the config file it
+// accepts tags discovered at runtime, e.g. by SunSpec scanning, while exporters are running.
+type Registry struct {
+	mu    sync.RWMutex
+	tags  []Tag
+	index map[string]int
+}
+
+// NewRegistry creates a registry holding the given tags.
+func NewRegistry(tags []Tag) (*Registry, error) {
+	r := &Registry{index: make(map[string]int, len(tags))}
+	if err := r.Add(tags...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Add registers more tags. Nothing is added if any name is already taken.
+func (r *Registry) Add(tags ...Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		_, dup := seen[t.Name]
+		if _, exists := r.index[t.Name]; exists || dup {
+			return fmt.Errorf("duplicate tag name: %s", t.Name)
+		}
+		seen[t.Name] = struct{}{}
+	}
+	for _, t := range tags {
+		r.index[t.Name] = len(r.tags)
+		r.tags = append(r.tags, t)
+	}
+	return nil
+}
+
+// Tags returns a snapshot of all registered tags.
+func (r *Registry) Tags() []Tag {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Tag(nil), r.tags...)
+}
+
+// Lookup returns the tag with the given name.
+func (r *Registry) Lookup(name string) (Tag, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i, ok := r.index[name]
+	if !ok {
+		return Tag{}, false
+	}
+	return r.tags[i], true
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tag
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+)
+
+// Table identifies the Modbus data table a tag lives in.
+type Table int
+
+const (
+	TableCoils Table = iota
+	TableDiscreteInputs
+	TableHoldingRegisters
+	TableInputRegisters
+)
+
+// String returns the config name of the table.
+func (t Table) String() string {
+	switch t {
+	case TableCoils:
+		return "coil"
+	case TableDiscreteInputs:
+		return "discrete_input"
+	case TableHoldingRegisters:
+		return "holding_register"
+	case TableInputRegisters:
+		return "input_register"
+	default:
+		return fmt.Sprintf("table(%d)", int(t))
+	}
+}
+
+// Writable reports whether a master may write to the table.
+func (t Table) Writable() bool {
+	return t == TableCoils || t == TableHoldingRegisters
+}
+
+// ParseTable parses a table name as used in the config file.
+func ParseTable(name string) (Table, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "coil", "coils":
+		return TableCoils, nil
+	case "discrete_input", "discrete_inputs":
+		return TableDiscreteInputs, nil
+	case "holding_register", "holding_registers", "":
+		return TableHoldingRegisters, nil
+	case "input_register", "input_registers":
+		return TableInputRegisters, nil
+	default:
+		return 0, fmt.Errorf("unknown table: %s", name)
+	}
+}
+
+// Tag is a named data point on a slave device.
+type Tag struct {
+	Name    string
+	SlaveID byte
+	Table   Table
+	Address uint16
+
+	Type   DataType
+	Order  ByteOrder
+	Length int     // Registers spanned by a string
+	Scale  float64 // Multiplier applied to raw numeric values, 0 leaves them unscaled
+	Unit   string  // e.g. "W", empty if unknown
+
+	Deadband        float64
+	DeadbandPercent float64
+	MinInterval     time.Duration
+}
+
+// Sample is a value read from a tag at a point in time.
+type Sample struct {
+	Tag   string
+	Value any
+	Time  time.Time
+}
+
+// New creates a Tag from its config definition.
+func New(cfg config.TagConfig) (Tag, error) {
+	if cfg.Name == "" {
+		return Tag{}, fmt.Errorf("tag name is required")
+	}
+	table, address, err := ParseAddress(cfg.Table, cfg.Address)
+	if err != nil {
+		return Tag{}, fmt.Errorf("tag %s: %w", cfg.Name, err)
+	}
+	if cfg.Deadband < 0 || cfg.DeadbandPercent < 0 || cfg.MinInterval < 0 {
+		return Tag{}, fmt.Errorf("tag %s: deadband and min_interval must not be negative", cfg.Name)
+	}
+	if cfg.Scale != 0 && (table == TableCoils || table == TableDiscreteInputs) {
+		return Tag{}, fmt.Errorf("tag %s: %v tags can't be scaled", cfg.Name, table)
+	}
+
+	typ, err := ParseDataType(cfg.Type)
+	if err != nil {
+		return Tag{}, fmt.Errorf("tag %s: %w", cfg.Name, err)
+	}
+	order, err := ParseByteOrder(cfg.ByteOrder)
+	if err != nil {
+		return Tag{}, fmt.Errorf("tag %s: %w", cfg.Name, err)
+	}
+	switch {
+	case table == TableCoils || table == TableDiscreteInputs:
+		if cfg.Type != "" && typ != TypeBool {
+			return Tag{}, fmt.Errorf("tag %s: %v tags must be of type bool", cfg.Name, table)
+		}
+		typ = TypeBool
+	case typ == TypeBool:
+		return Tag{}, fmt.Errorf("tag %s: type bool requires a coil or discrete_input table", cfg.Name)
+	case typ == TypeString && (cfg.Length <= 0 || cfg.Length > 125):
+		return Tag{}, fmt.Errorf("tag %s: string length must be between 1 and 125 registers", cfg.Name)
+	}
+
+	return Tag{
+		Name:            cfg.Name,
+		SlaveID:         cfg.SlaveID,
+		Table:           table,
+		Address:         address,
+		Type:            typ,
+		Order:           order,
+		Length:          cfg.Length,
+		Scale:           cfg.Scale,
+		Unit:            cfg.Unit,
+		Deadband:        cfg.Deadband,
+		DeadbandPercent: cfg.DeadbandPercent,
+		MinInterval:     cfg.MinInterval,
+	}, nil
+}
+
+// NewSet creates the tags of a gateway, rejecting duplicate names.
+func NewSet(cfgs []config.TagConfig) ([]Tag, error) {
+	tags := make([]Tag, 0, len(cfgs))
+	seen := make(map[string]struct{}, len(cfgs))
+	for _, c := range cfgs {
+		t, err := New(c)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[t.Name]; ok {
+			return nil, fmt.Errorf("duplicate tag name: %s", t.Name)
+		}
+		seen[t.Name] = struct{}{}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// Lookup returns the tag with the given name.
+func Lookup(tags []Tag, name string) (Tag, bool) {
+	for _, t := range tags {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tag{}, false
+}
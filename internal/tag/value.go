@@ -0,0 +1,312 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DataType is the type of the value stored in one or more registers.
+type DataType int
+
+const (
+	TypeUint16 DataType = iota
+	TypeInt16
+	TypeUint32
+	TypeInt32
+	TypeUint64
+	TypeInt64
+	TypeFloat32
+	TypeFloat64
+	TypeString
+	TypeBool
+)
+
+var dataTypeNames = map[DataType]string{
+	TypeUint16:  "uint16",
+	TypeInt16:   "int16",
+	TypeUint32:  "uint32",
+	TypeInt32:   "int32",
+	TypeUint64:  "uint64",
+	TypeInt64:   "int64",
+	TypeFloat32: "float32",
+	TypeFloat64: "float64",
+	TypeString:  "string",
+	TypeBool:    "bool",
+}
+
+func (d DataType) String() string {
+	if name, ok := dataTypeNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", int(d))
+}
+
+// ParseDataType parses a data type name as used in the config file.
+func ParseDataType(name string) (DataType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "uint16", "word":
+		return TypeUint16, nil
+	case "int16":
+		return TypeInt16, nil
+	case "uint32", "dword":
+		return TypeUint32, nil
+	case "int32":
+		return TypeInt32, nil
+	case "uint64":
+		return TypeUint64, nil
+	case "int64":
+		return TypeInt64, nil
+	case "float32", "float", "real":
+		return TypeFloat32, nil
+	case "float64", "double":
+		return TypeFloat64, nil
+	case "string":
+		return TypeString, nil
+	case "bool":
+		return TypeBool, nil
+	default:
+		return 0, fmt.Errorf("unknown data type: %s", name)
+	}
+}
+
+// registers returns the number of registers a value of the type occupies.
+// Strings are variable length and return 0.
+func (d DataType) registers() int {
+	switch d {
+	case TypeUint32, TypeInt32, TypeFloat32:
+		return 2
+	case TypeUint64, TypeInt64, TypeFloat64:
+		return 4
+	case TypeString:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// ByteOrder describes how a device lays out multi-byte values across registers,
+// named after the position of the bytes of the big-endian value 0xAABBCCDD.
+type ByteOrder int
+
+const (
+	OrderABCD ByteOrder = iota // Big-endian, the Modbus default
+	OrderCDAB                  // Word swapped
+	OrderBADC                  // Byte swapped
+	OrderDCBA                  // Little-endian
+)
+
+func (o ByteOrder) String() string {
+	switch o {
+	case OrderABCD:
+		return "ABCD"
+	case OrderCDAB:
+		return "CDAB"
+	case OrderBADC:
+		return "BADC"
+	case OrderDCBA:
+		return "DCBA"
+	default:
+		return fmt.Sprintf("order(%d)", int(o))
+	}
+}
+
+// ParseByteOrder parses a byte order name as used in the config file.
+func ParseByteOrder(name string) (ByteOrder, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", "ABCD", "BIG", "BIG_ENDIAN":
+		return OrderABCD, nil
+	case "CDAB", "WORD_SWAP":
+		return OrderCDAB, nil
+	case "BADC", "BYTE_SWAP":
+		return OrderBADC, nil
+	case "DCBA", "LITTLE", "LITTLE_ENDIAN":
+		return OrderDCBA, nil
+	default:
+		return 0, fmt.Errorf("unknown byte order: %s", name)
+	}
+}
+
+func (o ByteOrder) swapsBytes() bool { return o == OrderBADC || o == OrderDCBA }
+func (o ByteOrder) swapsWords() bool { return o == OrderCDAB || o == OrderDCBA }
+
+// reorder converts register data between the device order and big-endian.
+// The transformation is its own inverse, so it serves both decoding and encoding.
+func (o ByteOrder) reorder(data []byte, swapWords bool) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	if o.swapsBytes() {
+		for i := 0; i+1 < len(out); i += 2 {
+			out[i], out[i+1] = out[i+1], out[i]
+		}
+	}
+	if swapWords && o.swapsWords() {
+		words := len(out) / 2
+		for i := 0; i < words/2; i++ {
+			j := words - 1 - i
+			out[2*i], out[2*i+1], out[2*j], out[2*j+1] = out[2*j], out[2*j+1], out[2*i], out[2*i+1]
+		}
+	}
+	return out
+}
+
+// Quantity returns the number of coils or registers the tag spans.
+func (t Tag) Quantity() uint16 {
+	if t.Type == TypeString {
+		return uint16(t.Length)
+	}
+	return uint16(t.Type.registers())
+}
+
+// Decode converts raw big-endian register bytes, as found in a read response,
+// into a typed value.
+func (t Tag) Decode(data []byte) (any, error) {
+	if want := int(t.Quantity()) * 2; len(data) != want {
+		return nil, fmt.Errorf("tag %s: expected %d bytes, got %d", t.Name, want, len(data))
+	}
+	// Strings are byte sequences, only the byte order within a word applies.
+	b := t.Order.reorder(data, t.Type != TypeString)
+
+	switch t.Type {
+	case TypeUint16:
+		return binary.BigEndian.Uint16(b), nil
+	case TypeInt16:
+		return int16(binary.BigEndian.Uint16(b)), nil
+	case TypeUint32:
+		return binary.BigEndian.Uint32(b), nil
+	case TypeInt32:
+		return int32(binary.BigEndian.Uint32(b)), nil
+	case TypeUint64:
+		return binary.BigEndian.Uint64(b), nil
+	case TypeInt64:
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case TypeFloat32:
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case TypeFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case TypeString:
+		return strings.TrimRight(string(b), "\x00 "), nil
+	default:
+		return nil, fmt.Errorf("tag %s: cannot decode %v from registers", t.Name, t.Type)
+	}
+}
+
+// Encode converts a value into the raw big-endian register bytes of a write request.
+// Accepted values are Go numbers, bools and strings, as decoded from JSON or YAML.
+func (t Tag) Encode(v any) ([]byte, error) {
+	b := make([]byte, int(t.Quantity())*2)
+
+	if t.Type == TypeString {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("tag %s: cannot use %T as a string", t.Name, v)
+		}
+		if len(s) > len(b) {
+			return nil, fmt.Errorf("tag %s: string longer than %d bytes", t.Name, len(b))
+		}
+		copy(b, s)
+		return t.Order.reorder(b, false), nil
+	}
+
+	f, ok := toFloat(v)
+	if !ok {
+		if x, isBool := v.(bool); isBool {
+			if x {
+				f = 1
+			}
+		} else {
+			return nil, fmt.Errorf("tag %s: cannot use %T as a number", t.Name, v)
+		}
+	}
+
+	switch t.Type {
+	case TypeUint16:
+		if err := checkInt(f, 0, math.MaxUint16); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+		}
+		binary.BigEndian.PutUint16(b, uint16(f))
+	case TypeInt16:
+		if err := checkInt(f, math.MinInt16, math.MaxInt16); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+		}
+		binary.BigEndian.PutUint16(b, uint16(int16(f)))
+	case TypeUint32:
+		if err := checkInt(f, 0, math.MaxUint32); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+		}
+		binary.BigEndian.PutUint32(b, uint32(f))
+	case TypeInt32:
+		if err := checkInt(f, math.MinInt32, math.MaxInt32); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+		}
+		binary.BigEndian.PutUint32(b, uint32(int32(f)))
+	case TypeUint64:
+		if u, ok := v.(uint64); ok {
+			binary.BigEndian.PutUint64(b, u)
+			break
+		}
+		if err := checkInt(f, 0, math.MaxUint64); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+		}
+		binary.BigEndian.PutUint64(b, uint64(f))
+	case TypeInt64:
+		if i, ok := v.(int64); ok {
+			binary.BigEndian.PutUint64(b, uint64(i))
+			break
+		}
+		if err := checkInt(f, math.MinInt64, math.MaxInt64); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", t.Name, err)
+		}
+		binary.BigEndian.PutUint64(b, uint64(int64(f)))
+	case TypeFloat32:
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+	case TypeFloat64:
+		binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	default:
+		return nil, fmt.Errorf("tag %s: cannot encode %v into registers", t.Name, t.Type)
+	}
+	return t.Order.reorder(b, true), nil
+}
+
+// scale converts a raw numeric value into engineering units.
+func (t Tag) scale(v any) any {
+	if t.Scale == 0 || t.Scale == 1 {
+		return v
+	}
+	if f, ok := toFloat(v); ok {
+		return f * t.Scale
+	}
+	return v
+}
+
+// unscale converts a value in engineering units into the raw value to encode.
+// Integer types are rounded, as 0.1 scaled values rarely divide exactly.
+func (t Tag) unscale(v any) (any, error) {
+	if t.Scale == 0 || t.Scale == 1 || t.Type == TypeString {
+		return v, nil
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return nil, fmt.Errorf("tag %s: cannot use %T as a number", t.Name, v)
+	}
+	f /= t.Scale
+	if t.Type != TypeFloat32 && t.Type != TypeFloat64 {
+		f = math.Round(f)
+	}
+	return f, nil
+}
+
+func checkInt(f, min, max float64) error {
+	if f != math.Trunc(f) {
+		return fmt.Errorf("value %v is not an integer", f)
+	}
+	if f < min || f > max {
+		return fmt.Errorf("value %v out of range [%v, %v]", f, min, max)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package tag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTag_DecodeEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		tag   Tag
+		data  []byte
+		value any
+	}{
+		{"uint16", Tag{Type: TypeUint16}, []byte{0x12, 0x34}, uint16(0x1234)},
+		{"int16", Tag{Type: TypeInt16}, []byte{0xFF, 0xFE}, int16(-2)},
+		{"int16 badc", Tag{Type: TypeInt16, Order: OrderBADC}, []byte{0xFE, 0xFF}, int16(-2)},
+		{"uint32 abcd", Tag{Type: TypeUint32}, []byte{0xAA, 0xBB, 0xCC, 0xDD}, uint32(0xAABBCCDD)},
+		{"uint32 cdab", Tag{Type: TypeUint32, Order: OrderCDAB}, []byte{0xCC, 0xDD, 0xAA, 0xBB}, uint32(0xAABBCCDD)},
+		{"uint32 badc", Tag{Type: TypeUint32, Order: OrderBADC}, []byte{0xBB, 0xAA, 0xDD, 0xCC}, uint32(0xAABBCCDD)},
+		{"uint32 dcba", Tag{Type: TypeUint32, Order: OrderDCBA}, []byte{0xDD, 0xCC, 0xBB, 0xAA}, uint32(0xAABBCCDD)},
+		{"int32", Tag{Type: TypeInt32}, []byte{0xFF, 0xFF, 0xFF, 0x9C}, int32(-100)},
+		{"float32", Tag{Type: TypeFloat32}, []byte{0x42, 0xF6, 0xE6, 0x66}, float32(123.45)},
+		{"float32 cdab", Tag{Type: TypeFloat32, Order: OrderCDAB}, []byte{0xE6, 0x66, 0x42, 0xF6}, float32(123.45)},
+		{"int64 dcba", Tag{Type: TypeInt64, Order: OrderDCBA}, []byte{0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, int64(-2)},
+		{"uint64 cdab", Tag{Type: TypeUint64, Order: OrderCDAB}, []byte{0x07, 0x08, 0x05, 0x06, 0x03, 0x04, 0x01, 0x02}, uint64(0x0102030405060708)},
+		{"float64", Tag{Type: TypeFloat64}, []byte{0x40, 0x09, 0x21, 0xFB, 0x54, 0x44, 0x2D, 0x18}, 3.141592653589793},
+		{"string", Tag{Type: TypeString, Length: 3}, []byte{'A', 'B', 'C', 'D', 'E', 0}, "ABCDE"},
+		{"string badc", Tag{Type: TypeString, Order: OrderBADC, Length: 2}, []byte{'B', 'A', 'D', 'C'}, "ABCD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tag.Decode(tt.data)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != tt.value {
+				t.Errorf("Decode() = %v (%T), want %v (%T)", got, got, tt.value, tt.value)
+			}
+
+			data, err := tt.tag.Encode(tt.value)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("Encode() = % X, want % X", data, tt.data)
+			}
+		})
+	}
+}
+
+func TestTag_EncodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		tag   Tag
+		value any
+	}{
+		{"uint16 overflow", Tag{Type: TypeUint16}, 70000.0},
+		{"uint16 negative", Tag{Type: TypeUint16}, -1.0},
+		{"int16 fraction", Tag{Type: TypeInt16}, 1.5},
+		{"int32 overflow", Tag{Type: TypeInt32}, 3e9},
+		{"string too long", Tag{Type: TypeString, Length: 1}, "ABC"},
+		{"string from number", Tag{Type: TypeString, Length: 1}, 1.0},
+		{"number from string", Tag{Type: TypeFloat32}, "1.0"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.tag.Encode(tt.value); err == nil {
+			t.Errorf("%s: Encode(%v) expected error", tt.name, tt.value)
+		}
+	}
+}
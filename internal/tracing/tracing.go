@@ -0,0 +1,354 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package tracing records the spans of requests through the gateways and exports
+// them to an OpenTelemetry collector over OTLP/HTTP, in its JSON encoding.
+//
+// A request is traced from its upstream receiving it, through the routing of the
+// gateway, to each exchange with a device, so the time it spends waiting for a bus,
+// on the wire and in retries shows in one trace. Spans carry the slave ID, function
+// code and transaction IDs of the request, and the frames sent and received are
+// events of their spans. Requests are sampled at their first span. Spans are exported
+// in batches; while the collector can't be reached they are kept up to the buffer
+// size, and the oldest dropped beyond it.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// Span kinds of OTLP
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+)
+
+// statusError is the OTLP status code of failed spans.
+const statusError = 2
+
+// scopeName names the instrumentation of the exported spans.
+const scopeName = "github.com/ffutop/modbus-gateway"
+
+type spanKey struct{}
+
+// Tracer implements transport.Tracer, and is a service exporting the spans ended.
+type Tracer struct {
+	cfg    config.TracingConfig
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []*span // Ended and not exported yet, oldest first
+	dropped int     // Since the last export
+}
+
+// New creates a tracer exporting to the collector of cfg.
+func New(cfg config.TracingConfig) (*Tracer, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: invalid endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("tracing: unsupported endpoint scheme %q, want http or https", u.Scheme)
+	}
+	// A base URL gets the traces path of OTLP/HTTP, as OTEL_EXPORTER_OTLP_ENDPOINT does
+	if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	}
+	return &Tracer{cfg: cfg, url: u.String(), client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// Start starts a span, the child of the span of ctx if any. A request without a
+// span yet is sampled, and the spans of a request not sampled record nothing.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, transport.Span) {
+	s := &span{tracer: t, name: name, start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parentID, s.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else {
+		s.sampled = rand.Float64() < t.cfg.SampleRate
+		crand.Read(s.traceID[:])
+		if id, ok := transport.CorrelationID(ctx); ok {
+			attrs = append(attrs, slog.Uint64("modbus.cid", id))
+		}
+	}
+	if s.sampled {
+		crand.Read(s.spanID[:])
+		s.attrs = append([]slog.Attr(nil), attrs...)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// add queues an ended span for export.
+func (t *Tracer) add(s *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) >= t.cfg.BufferSize {
+		t.pending = t.pending[1:]
+		t.dropped++
+	}
+	t.pending = append(t.pending, s)
+}
+
+// Run exports the spans ended every interval until ctx is cancelled, then those
+// left.
+func (t *Tracer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fctx, cancel := context.WithTimeout(context.Background(), t.cfg.Timeout)
+			defer cancel()
+			t.export(fctx)
+			return nil
+		case <-ticker.C:
+			t.export(ctx)
+		}
+	}
+}
+
+// export posts the pending spans, which are kept for the next export if it fails.
+func (t *Tracer) export(ctx context.Context) {
+	t.mu.Lock()
+	batch, dropped := t.pending, t.dropped
+	t.pending, t.dropped = nil, 0
+	t.mu.Unlock()
+	if dropped > 0 {
+		slog.Warn("Tracing buffer full, dropped oldest spans", "dropped", dropped, "size", t.cfg.BufferSize)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := t.post(ctx, t.encode(batch)); err != nil {
+		slog.Warn("Failed to export spans", "endpoint", t.url, "spans", len(batch), "err", err)
+		t.mu.Lock()
+		t.pending = append(batch, t.pending...)
+		if excess := len(t.pending) - t.cfg.BufferSize; excess > 0 {
+			t.pending = t.pending[excess:]
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *Tracer) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("export returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// encode returns the OTLP/JSON export request of spans.
+func (t *Tracer) encode(spans []*span) []byte {
+	out := make([]spanJSON, 0, len(spans))
+	for _, s := range spans {
+		out = append(out, s.json())
+	}
+	body, _ := json.Marshal(exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{attribute(slog.String("service.name", t.cfg.ServiceName))}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: out}},
+	}}})
+	return body
+}
+
+// span implements transport.Span.
+type span struct {
+	tracer   *Tracer
+	name     string
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // Zero for the first span of a request
+	sampled  bool
+	start    time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []slog.Attr
+	events []event
+	err    error
+}
+
+type event struct {
+	time  time.Time
+	name  string
+	attrs []slog.Attr
+}
+
+// SetAttributes adds attributes to the span.
+func (s *span) SetAttributes(attrs ...slog.Attr) {
+	if !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// AddEvent records an event at the current time.
+func (s *span) AddEvent(name string, attrs ...slog.Attr) {
+	if !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event{time: time.Now(), name: name, attrs: attrs})
+}
+
+// End ends the span and queues it for export. Only the first call counts.
+func (s *span) End(err error) {
+	if !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end, s.err = time.Now(), err
+	s.mu.Unlock()
+	s.tracer.add(s)
+}
+
+func (s *span) json() spanJSON {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := spanJSON{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              kindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parentID != ([8]byte{}) {
+		j.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	switch s.name {
+	case transport.SpanUpstream:
+		j.Kind = kindServer
+	case transport.SpanDownstream:
+		j.Kind = kindClient
+	}
+	for _, a := range s.attrs {
+		j.Attributes = append(j.Attributes, attribute(a))
+	}
+	for _, e := range s.events {
+		ej := eventJSON{TimeUnixNano: strconv.FormatInt(e.time.UnixNano(), 10), Name: e.name}
+		for _, a := range e.attrs {
+			ej.Attributes = append(ej.Attributes, attribute(a))
+		}
+		j.Events = append(j.Events, ej)
+	}
+	if s.err != nil {
+		j.Status = &status{Code: statusError, Message: s.err.Error()}
+	}
+	return j
+}
+
+// OTLP/JSON export request, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type (
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []spanJSON `json:"spans"`
+	}
+	scope struct {
+		Name string `json:"name"`
+	}
+	spanJSON struct {
+		TraceID           string      `json:"traceId"` // In hex, not base64 as protobuf JSON elsewhere
+		SpanID            string      `json:"spanId"`
+		ParentSpanID      string      `json:"parentSpanId,omitempty"`
+		Name              string      `json:"name"`
+		Kind              int         `json:"kind"`
+		StartTimeUnixNano string      `json:"startTimeUnixNano"` // 64-bit integers are strings
+		EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+		Attributes        []keyValue  `json:"attributes,omitempty"`
+		Events            []eventJSON `json:"events,omitempty"`
+		Status            *status     `json:"status,omitempty"`
+	}
+	eventJSON struct {
+		TimeUnixNano string     `json:"timeUnixNano"`
+		Name         string     `json:"name"`
+		Attributes   []keyValue `json:"attributes,omitempty"`
+	}
+	status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	anyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    string   `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// attribute converts a to OTLP, values of other kinds than numbers and booleans as
+// strings.
+func attribute(a slog.Attr) keyValue {
+	kv := keyValue{Key: a.Key}
+	switch v := a.Value.Resolve(); v.Kind() {
+	case slog.KindInt64:
+		kv.Value.IntValue = strconv.FormatInt(v.Int64(), 10)
+	case slog.KindUint64:
+		kv.Value.IntValue = strconv.FormatUint(v.Uint64(), 10)
+	case slog.KindBool:
+		b := v.Bool()
+		kv.Value.BoolValue = &b
+	case slog.KindFloat64:
+		f := v.Float64()
+		kv.Value.DoubleValue = &f
+	default:
+		s := v.String()
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func TestTracer_Export(t *testing.T) {
+	var got exportRequest
+	var path, auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("export %s: %v", body, err)
+		}
+	}))
+	defer collector.Close()
+
+	tracer, err := New(config.TracingConfig{Endpoint: collector.URL, Headers: map[string]string{"Authorization": "Bearer secret"},
+		ServiceName: "plant-gw", SampleRate: 1, Interval: time.Hour, Timeout: time.Second, BufferSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := modbus.ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 0, 0, 1}}
+	ctx := transport.TraceRequest(transport.WithTracer(context.Background(), tracer))
+	uctx, upstream := transport.StartSpan(ctx, transport.SpanUpstream, transport.SpanAttrs(1, req, 7)...)
+	rctx, route := transport.StartSpan(uctx, transport.SpanRoute)
+	dctx, downstream := transport.StartSpan(rctx, transport.SpanDownstream)
+	transport.TraceFrame(dctx, transport.DownstreamTx, []byte{1, 3, 0, 0, 0, 1, 0x84, 0x0A})
+	downstream.End(modbus.ErrTimeout)
+	transport.EndSpan(route, modbus.ProtocolDataUnit{FunctionCode: 0x83, Data: []byte{0x0B}}, nil)
+	upstream.End(nil)
+	tracer.export(context.Background())
+
+	if path != "/v1/traces" || auth != "Bearer secret" {
+		t.Errorf("exported to %s with authorization %q", path, auth)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("export = %+v", got)
+	}
+	if a := got.ResourceSpans[0].Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || *a[0].Value.StringValue != "plant-gw" {
+		t.Errorf("resource attributes = %+v", a)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(spans))
+	}
+	d, r, u := spans[0], spans[1], spans[2] // In the order they ended
+	if u.Name != transport.SpanUpstream || u.Kind != kindServer || u.ParentSpanID != "" || len(u.TraceID) != 32 {
+		t.Errorf("upstream span = %+v", u)
+	}
+	if r.Kind != kindInternal || r.ParentSpanID != u.SpanID || r.TraceID != u.TraceID {
+		t.Errorf("route span = %+v, want a child of %s", r, u.SpanID)
+	}
+	if d.Kind != kindClient || d.ParentSpanID != r.SpanID || d.TraceID != u.TraceID {
+		t.Errorf("downstream span = %+v, want a child of %s", d, r.SpanID)
+	}
+	if d.Status == nil || d.Status.Code != statusError || u.Status != nil {
+		t.Errorf("statuses %+v and %+v, want only the downstream failed", d.Status, u.Status)
+	}
+	if len(d.Events) != 1 || d.Events[0].Name != transport.DownstreamTx {
+		t.Errorf("downstream events = %+v", d.Events)
+	}
+
+	attrs := func(s spanJSON) map[string]string {
+		m := make(map[string]string)
+		for _, kv := range s.Attributes {
+			m[kv.Key] = kv.Value.IntValue
+		}
+		return m
+	}
+	if a := attrs(u); a["modbus.transaction_id"] != "7" || a["modbus.slave_id"] != "1" || a["modbus.cid"] == "" {
+		t.Errorf("upstream attributes = %v", a)
+	}
+	if a := attrs(r); a["modbus.exception_code"] != "11" {
+		t.Errorf("route attributes = %v, want exception code 11", a)
+	}
+}
+
+func TestTracer_Sampling(t *testing.T) {
+	tracer, err := New(config.TracingConfig{Endpoint: "http://collector:4318", SampleRate: 0, BufferSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, root := tracer.Start(context.Background(), transport.SpanUpstream)
+	_, child := tracer.Start(ctx, transport.SpanRoute)
+	child.End(nil)
+	root.End(errors.New("failed"))
+	if len(tracer.pending) != 0 {
+		t.Errorf("%d spans of an unsampled request queued", len(tracer.pending))
+	}
+	if tracer.url != "http://collector:4318/v1/traces" {
+		t.Errorf("url = %s", tracer.url)
+	}
+}
+
+func TestTracer_Buffer(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+	tracer, err := New(config.TracingConfig{Endpoint: collector.URL + "/v1/traces", SampleRate: 1, Timeout: time.Second, BufferSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(context.Background(), transport.SpanRoute)
+		span.End(nil)
+	}
+	if len(tracer.pending) != 2 || tracer.dropped != 1 {
+		t.Fatalf("%d spans pending, %d dropped, want 2 and 1", len(tracer.pending), tracer.dropped)
+	}
+	tracer.export(context.Background())
+	if len(tracer.pending) != 2 {
+		t.Errorf("%d spans kept after a failed export, want 2", len(tracer.pending))
+	}
+}
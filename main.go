@@ -6,128 +6,97 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"syscall"
 
+	"github.com/ffutop/modbus-gateway/internal/cli"
 	"github.com/ffutop/modbus-gateway/internal/config"
-	"github.com/ffutop/modbus-gateway/internal/gateway"
-	"github.com/ffutop/modbus-gateway/transport"
-	"github.com/ffutop/modbus-gateway/transport/local"
-	"github.com/ffutop/modbus-gateway/transport/rtu"
-	"github.com/ffutop/modbus-gateway/transport/tcp"
+	"github.com/ffutop/modbus-gateway/internal/logfile"
+	"github.com/ffutop/modbus-gateway/internal/loglevel"
+	"github.com/ffutop/modbus-gateway/pkg/gateway"
+	"github.com/ffutop/modbus-gateway/pkg/vserial"
 )
 
 func main() {
-	configFile := flag.String("config", "", "Path to config file")
+	// Subcommands, e.g. modbus-gateway poll -tcp 192.168.1.10:502 -addr 40001
+	if len(os.Args) > 1 {
+		if cmd, ok := cli.Lookup(os.Args[1]); ok {
+			if err := cmd.Run(os.Args[2:], os.Stdout); err != nil {
+				if !errors.Is(err, flag.ErrHelp) {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.Name, err)
+				}
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	configFile := flag.String("config", "", "Path to config file, or a directory of YAML files to merge")
+	report := flag.String("report", "", "Write per-route request counts, error rates and latencies to `file` on exit, - for stdout")
+	virtualSerial := flag.String("virtual-serial", "", "Create a connected pair of virtual serial ports at `path,path` for development")
+	legacy := legacyFlags(flag.CommandLine)
+	flag.Usage = func() {
+		cli.Usage(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	// Load Configuration
-	cfg, err := config.LoadConfig(*configFile)
+	// Load Configuration, from mbusd style flags if given instead of a file
+	var cfg *config.Config
+	var err error
+	if l, ok := legacy(); ok && *configFile != "" {
+		err = errors.New("mbusd style flags can't be combined with -config")
+	} else if ok {
+		if cfg, err = l.Config(); err == nil {
+			cfg.Fixup()
+		}
+	} else {
+		cfg, err = config.LoadConfig(*configFile)
+	}
 	if err != nil {
 		fmt.Printf("Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
-	setupLogger(cfg.Log)
+	closeLog := setupLogger(cfg)
+	defer closeLog()
+	if cfg.Legacy {
+		slog.Warn("Flat mbusd style configuration is deprecated, it is served as gateway \"default\" with one upstream and one downstream; move it to a gateways list like config.yaml",
+			"device", cfg.Gateways[0].Downstreams[0].Serial.Device, "listen", cfg.Gateways[0].Upstreams[0].Tcp.Address)
+	}
 
 	slog.Info("Starting Modbus Gateway...")
 
-	// Create Gateways
-	var gateways []*gateway.Gateway
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	for _, gwCfg := range cfg.Gateways {
-		// Setup Routing
-		routes := make(map[byte]transport.Downstream)
-		var defaultRoute transport.Downstream
-
-		// Compatibility Check: If only one downstream and no SlaveIDs, treat as default route
-		if len(gwCfg.Downstreams) == 1 && gwCfg.Downstreams[0].SlaveIDs == "" {
-			ds, err := createDownstream(gwCfg.Downstreams[0])
-			if err != nil {
-				slog.Error("Failed to create default downstream", "gateway", gwCfg.Name, "err", err)
-				continue
-			}
-			defaultRoute = ds
-			slog.Info("Configured default route (legacy mode)", "gateway", gwCfg.Name)
-		} else {
-			// Routing Mode
-			for _, dsCfg := range gwCfg.Downstreams {
-				ds, err := createDownstream(dsCfg)
-				if err != nil {
-					slog.Error("Failed to create downstream", "gateway", gwCfg.Name, "err", err)
-					continue
-				}
-
-				ids, err := gateway.ParseSlaveIDs(dsCfg.SlaveIDs)
-				if err != nil {
-					slog.Error("Failed to parse slave IDs", "gateway", gwCfg.Name, "slave_ids", dsCfg.SlaveIDs, "err", err)
-					os.Exit(1)
-				}
-
-				if len(ids) == 0 {
-					slog.Warn("Downstream configured without SlaveIDs in routing mode, it will be unreachable", "gateway", gwCfg.Name, "type", dsCfg.Type)
-					continue
-				}
-
-				for _, id := range ids {
-					if _, exists := routes[id]; exists {
-						slog.Error("Duplicate route for slave ID", "id", id, "gateway", gwCfg.Name)
-						os.Exit(1)
-					}
-					routes[id] = ds
-				}
-			}
-			slog.Info("Configured routing table", "gateway", gwCfg.Name, "routes_count", len(routes))
-		}
-
-		if len(routes) == 0 && defaultRoute == nil {
-			slog.Error("Gateway has no valid routes", "gateway", gwCfg.Name)
-			continue
-		}
-
-		// Create Upstreams
-		var upstreams []transport.Upstream
-		for _, usCfg := range gwCfg.Upstreams {
-			var us transport.Upstream
-			switch usCfg.Type {
-			case "tcp":
-				us = tcp.NewServer(usCfg.Tcp.Address)
-			case "rtu":
-				us = rtu.NewServer(usCfg.Serial)
-			default:
-				slog.Error("Unknown upstream type", "type", usCfg.Type, "gateway", gwCfg.Name)
-				continue
-			}
-			upstreams = append(upstreams, us)
+	// Virtual serial ports must exist before RTU transports open them.
+	if *virtualSerial != "" {
+		pair, err := openVirtualSerial(*virtualSerial)
+		if err != nil {
+			slog.Error("Failed to create virtual serial ports", "err", err)
+			os.Exit(1)
 		}
-
-		gw := gateway.NewGateway(gwCfg.Name, upstreams, routes, defaultRoute)
-		gateways = append(gateways, gw)
+		defer pair.Close()
 	}
 
-	if len(gateways) == 0 {
-		slog.Error("No valid gateways configured. Exiting.")
+	// Create Gateways
+	gw, err := gateway.New(cfg)
+	if err != nil {
+		slog.Error("Failed to create gateways. Exiting.", "err", err)
 		os.Exit(1)
 	}
 
 	// Start Gateways
-	var wg sync.WaitGroup
-	for _, gw := range gateways {
-		wg.Add(1)
-		go func(g *gateway.Gateway) {
-			defer wg.Done()
-			if err := g.Start(ctx); err != nil {
-				slog.Error("Gateway stopped with error", "name", g.Name, "err", err)
-			}
-		}(gw)
+	if err := gw.Start(context.Background()); err != nil {
+		slog.Error("Failed to start gateways", "err", err)
+		os.Exit(1)
 	}
 
 	// Wait for Signal
@@ -136,48 +105,143 @@ func main() {
 	<-sigChan
 
 	slog.Info("Shutting down...")
-	cancel()
-	wg.Wait()
+	gw.Stop()
+	if *report != "" {
+		if err := writeReport(gw, *report); err != nil {
+			slog.Error("Failed to write report", "err", err)
+		}
+	}
 	slog.Info("Goodbye.")
 }
 
-func createDownstream(cfg config.DownstreamConfig) (transport.Downstream, error) {
-	switch cfg.Type {
-	case "tcp":
-		return tcp.NewClient(cfg.Tcp.Address), nil
-	case "rtu":
-		return rtu.NewClient(cfg.Serial), nil
-	case "local":
-		return local.NewClient(cfg.Local), nil
-	default:
-		return nil, fmt.Errorf("unknown downstream type: %s", cfg.Type)
+// writeReport writes the request report as a table, or as JSON if file ends with .json.
+func writeReport(gw *gateway.Gateway, file string) error {
+	if file == "-" {
+		return gw.WriteReport(os.Stdout)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(file, ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(gw.Report())
+	} else {
+		err = gw.WriteReport(f)
+	}
+	return errors.Join(err, f.Close())
+}
+
+// legacyFlags defines mbusd's flags, which serve one serial line without a config
+// file. They are deprecated. The returned function returns the flat configuration,
+// if any of them was given.
+func legacyFlags(fs *flag.FlagSet) func() (config.LegacyConfig, bool) {
+	var l config.LegacyConfig
+	fs.StringVar(&l.Device, "p", "", "mbusd compatible, deprecated: serial `device` to serve without a config file")
+	fs.IntVar(&l.Speed, "s", 9600, "mbusd compatible, deprecated: baud `rate`")
+	fs.StringVar(&l.Mode, "m", "8n1", "mbusd compatible, deprecated: data bits, parity and stop bits")
+	rts := fs.Bool("t", false, "mbusd compatible, deprecated: switch RS485 direction by RTS")
+	fs.StringVar(&l.Address, "A", "", "mbusd compatible, deprecated: `address` to listen on, default all interfaces")
+	fs.IntVar(&l.Port, "P", 502, "mbusd compatible, deprecated: TCP `port` to listen on")
+	fs.IntVar(&l.MaxConn, "C", 32, "mbusd compatible, deprecated: connections served at once")
+	retries := fs.Int("N", 3, "mbusd compatible, deprecated: retries of a request")
+	fs.IntVar(&l.Pause, "R", 100, "mbusd compatible, deprecated: `milliseconds` between requests")
+	fs.IntVar(&l.Wait, "W", 500, "mbusd compatible, deprecated: `milliseconds` to wait for a response")
+	timeout := fs.Int("T", 60, "mbusd compatible, deprecated: `seconds` a connection may idle, 0 never closes")
+	level := fs.Int("v", 2, "mbusd compatible, deprecated: log `level`, 0 to 9")
+	fs.StringVar(&l.LogFile, "L", "", "mbusd compatible, deprecated: log `file`")
+	fs.Bool("d", false, "mbusd compatible, deprecated: stay in the foreground, as the gateway always does")
+
+	return func() (config.LegacyConfig, bool) {
+		given := false
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "p", "s", "m", "t", "A", "P", "C", "N", "R", "W", "T", "v", "L", "d":
+				given = true
+			}
+			if f.Name == "v" {
+				l.LogLevel = level
+			}
+		})
+		l.Retries, l.Timeout = retries, timeout
+		if *rts {
+			l.TrxControl = "rts"
+		}
+		return l, given
 	}
 }
 
-func setupLogger(cfg config.LogConfig) {
-	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+// openVirtualSerial creates a virtual serial pair linked at the two comma separated paths.
+func openVirtualSerial(paths string) (*vserial.Pair, error) {
+	a, b, ok := strings.Cut(paths, ",")
+	if !ok || a == "" || b == "" {
+		return nil, fmt.Errorf("want two comma separated paths, got %q", paths)
 	}
-	switch cfg.Level {
-	case "debug":
-		opts.Level = slog.LevelDebug
-	case "warn":
-		opts.Level = slog.LevelWarn
-	case "error":
-		opts.Level = slog.LevelError
+	pair, err := vserial.Open()
+	if err != nil {
+		return nil, err
 	}
+	if err := pair.Link(a, b); err != nil {
+		pair.Close()
+		return nil, err
+	}
+	slog.Info("Virtual serial ports created", "a", a, "b", b)
+	return pair, nil
+}
 
-	var handler slog.Handler
-	if cfg.File != "" && cfg.File != "-" {
-		f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// setupLogger sets the default logger up as configured, with the log levels of the
+// gateways overriding the global one. The returned function closes the log file.
+func setupLogger(cfg *config.Config) func() {
+	level := parseLevel(cfg.Log.Level)
+	levels := make(map[string]slog.Level)
+	lowest := level // Passed by the handler, the gateways' levels filter
+	for _, gw := range cfg.Gateways {
+		if gw.Log.Level != "" {
+			levels[gw.Name] = parseLevel(gw.Log.Level)
+			lowest = min(lowest, levels[gw.Name])
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lowest}
+
+	var out io.Writer = os.Stdout
+	closeLog := func() {}
+	if file := cfg.Log.File; file != "" && file != "-" {
+		f, err := logfile.Open(file)
 		if err != nil {
 			fmt.Printf("Failed to open log file, falling back to stdout: %v\n", err)
-			handler = slog.NewTextHandler(os.Stdout, opts)
 		} else {
-			handler = slog.NewTextHandler(f, opts)
+			f.MaxSize = int64(cfg.Log.MaxSize) << 20
+			f.MaxAge = cfg.Log.MaxAge
+			f.MaxBackups = cfg.Log.MaxBackups
+			f.Compress = cfg.Log.Compress
+			out = f
+			if cfg.Log.Stdout {
+				out = io.MultiWriter(os.Stdout, f)
+			}
+			closeLog = func() { f.Close() }
 		}
+	}
+
+	var handler slog.Handler
+	if cfg.Log.Format == "json" {
+		handler = slog.NewJSONHandler(out, opts)
 	} else {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(loglevel.New(handler, level, levels)))
+	return closeLog
+}
+
+// parseLevel parses a log level, info if unknown.
+func parseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
 	}
-	slog.SetDefault(slog.New(handler))
+	return slog.LevelInfo
 }
@@ -0,0 +1,91 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Error classes returned by all transports. Errors wrap one of these sentinels
+// together with their cause, so callers can branch with errors.Is:
+//
+//	if errors.Is(err, modbus.ErrTimeout) { ... }
+//
+// Exception responses of downstream slaves are forwarded as PDUs, not errors;
+// failures the gateway answers with an exception itself are returned as *Error.
+var (
+	// ErrTimeout means the slave did not answer in time.
+	ErrTimeout = errors.New("modbus: request timed out")
+	// ErrConnection means the link to the slave could not be opened or broke.
+	ErrConnection = errors.New("modbus: connection failed")
+	// ErrCRC means a frame failed its checksum.
+	ErrCRC = errors.New("modbus: crc mismatch")
+	// ErrInvalidFrame means a frame was malformed or did not match its request.
+	ErrInvalidFrame = errors.New("modbus: invalid frame")
+)
+
+// IOError classifies an error of a read, write or dial on a connection or serial port
+// as ErrTimeout or ErrConnection, keeping the cause. Nil, cancellation and already
+// classified errors are returned unchanged.
+func IOError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || classified(err) {
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %w", ErrConnection, err)
+}
+
+func classified(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrConnection) ||
+		errors.Is(err, ErrCRC) || errors.Is(err, ErrInvalidFrame)
+}
+
+// ExceptionCodeOf returns the exception code an upstream server answers with
+// when forwarding a request failed with err.
+func ExceptionCodeOf(err error) byte {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.ExceptionCode
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrConnection), errors.Is(err, context.DeadlineExceeded):
+		return ExceptionCodeGatewayTargetDeviceFailedToRespond
+	default:
+		return ExceptionCodeServerDeviceFailure
+	}
+}
+
+// ExceptionResponse returns the exception response an upstream server answers req
+// with when forwarding it failed with err, so the master isn't left to time out.
+func ExceptionResponse(req ProtocolDataUnit, err error) ProtocolDataUnit {
+	return ProtocolDataUnit{FunctionCode: req.FunctionCode | 0x80, Data: []byte{ExceptionCodeOf(err)}}
+}
+
+// Classify names the class of err for reports and metrics: "exception", "timeout",
+// "connection", "crc", "invalid_frame" or "other".
+func Classify(err error) string {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return "exception"
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrConnection):
+		return "connection"
+	case errors.Is(err, ErrCRC):
+		return "crc"
+	case errors.Is(err, ErrInvalidFrame):
+		return "invalid_frame"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestIOError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"deadline", os.ErrDeadlineExceeded, ErrTimeout},
+		{"context deadline", context.DeadlineExceeded, ErrTimeout},
+		{"eof", io.ErrUnexpectedEOF, ErrConnection},
+		{"crc", fmt.Errorf("%w: bad", ErrCRC), ErrCRC},
+		{"canceled", context.Canceled, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := IOError(tt.err)
+			if !errors.Is(err, tt.want) || !errors.Is(err, tt.err) {
+				t.Errorf("IOError(%v) = %v, want %v", tt.err, err, tt.want)
+			}
+		})
+	}
+	if IOError(nil) != nil {
+		t.Error("IOError(nil) != nil")
+	}
+}
+
+func TestExceptionCodeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want byte
+	}{
+		{fmt.Errorf("read: %w", &Error{FunctionCode: 0x83, ExceptionCode: ExceptionCodeGatewayPathUnavailable}), ExceptionCodeGatewayPathUnavailable},
+		{IOError(os.ErrDeadlineExceeded), ExceptionCodeGatewayTargetDeviceFailedToRespond},
+		{IOError(io.EOF), ExceptionCodeGatewayTargetDeviceFailedToRespond},
+		{fmt.Errorf("%w: short", ErrInvalidFrame), ExceptionCodeServerDeviceFailure},
+	}
+	for _, tt := range tests {
+		if got := ExceptionCodeOf(tt.err); got != tt.want {
+			t.Errorf("ExceptionCodeOf(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExceptionResponse(t *testing.T) {
+	req := ProtocolDataUnit{FunctionCode: FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+	resp := ExceptionResponse(req, IOError(os.ErrDeadlineExceeded))
+	if resp.FunctionCode != 0x83 || len(resp.Data) != 1 || resp.Data[0] != ExceptionCodeGatewayTargetDeviceFailedToRespond {
+		t.Errorf("ExceptionResponse = %02X % X, want 83 0B", resp.FunctionCode, resp.Data)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&Error{FunctionCode: 0x83, ExceptionCode: ExceptionCodeIllegalDataAddress}, "exception"},
+		{IOError(os.ErrDeadlineExceeded), "timeout"},
+		{IOError(io.EOF), "connection"},
+		{fmt.Errorf("decode: %w", ErrCRC), "crc"},
+		{fmt.Errorf("%w: short", ErrInvalidFrame), "invalid_frame"},
+		{errors.New("boom"), "other"},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
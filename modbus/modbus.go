@@ -36,10 +36,29 @@ const (
 	FuncCodeMaskWriteRegister = 22
 	// FuncCodeReadFIFOQueue 16-bit wise access
 	FuncCodeReadFIFOQueue = 24
+	// FuncCodeDiagnostics for the communication counters and loopback tests of a serial line
+	FuncCodeDiagnostics = 8
+	// FuncCodeReportServerID for the description, run status and other device specific data of a slave
+	FuncCodeReportServerID = 17
 	// FuncCodeReadDeviceIdentification for byte wise access
 	FuncCodeReadDeviceIdentification = 43
 )
 
+// reads are the function codes of reads without side effects on the slave.
+// Diagnostics is left out as it can restart a slave.
+var reads = map[byte]bool{
+	FuncCodeReadCoils: true, FuncCodeReadDiscreteInputs: true,
+	FuncCodeReadHoldingRegisters: true, FuncCodeReadInputRegisters: true,
+	0x07: true, 0x0B: true, 0x0C: true, 0x14: true, // Exception status, event counter and log, file record
+	FuncCodeReportServerID: true, FuncCodeReadFIFOQueue: true, FuncCodeReadDeviceIdentification: true,
+}
+
+// IsRead reports whether a request of the function code is a read, which may be
+// repeated without side effects on the slave.
+func IsRead(functionCode byte) bool {
+	return reads[functionCode]
+}
+
 // meiType specifies a MEI Type as defined in https://www.modbus.org/docs/Modbus_Application_Protocol_V1_1b.pdf#page=44
 type meiType byte
 
@@ -0,0 +1,19 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package modbus
+
+import "testing"
+
+func TestIsRead(t *testing.T) {
+	for fc, want := range map[byte]bool{
+		FuncCodeReadCoils: true, FuncCodeReadInputRegisters: true, 0x07: true, FuncCodeReportServerID: true,
+		FuncCodeReadFIFOQueue: true, FuncCodeReadDeviceIdentification: true,
+		FuncCodeWriteSingleCoil: false, FuncCodeWriteMultipleRegisters: false, FuncCodeMaskWriteRegister: false,
+		FuncCodeReadWriteMultipleRegisters: false, FuncCodeDiagnostics: false, 0x80 | FuncCodeReadCoils: false,
+	} {
+		if got := IsRead(fc); got != want {
+			t.Errorf("IsRead(0x%02X) = %v, want %v", fc, got, want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package pdu
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+func TestParseRequest_RoundTrip(t *testing.T) {
+	tests := []struct {
+		req  Request
+		data []byte
+	}{
+		{ReadCoilsRequest{Address: 0x13, Quantity: 19}, []byte{0x00, 0x13, 0x00, 0x13}},
+		{ReadDiscreteInputsRequest{Address: 0xC4, Quantity: 22}, []byte{0x00, 0xC4, 0x00, 0x16}},
+		{ReadHoldingRegistersRequest{Address: 0x6B, Quantity: 3}, []byte{0x00, 0x6B, 0x00, 0x03}},
+		{ReadInputRegistersRequest{Address: 0x08, Quantity: 1}, []byte{0x00, 0x08, 0x00, 0x01}},
+		{WriteSingleCoilRequest{Address: 0xAC, Value: true}, []byte{0x00, 0xAC, 0xFF, 0x00}},
+		{WriteSingleRegisterRequest{Address: 0x01, Value: 0x03}, []byte{0x00, 0x01, 0x00, 0x03}},
+		{WriteMultipleCoilsRequest{Address: 0x13, Values: []bool{true, false, true, true, false, false, true, true, true, false}},
+			[]byte{0x00, 0x13, 0x00, 0x0A, 0x02, 0xCD, 0x01}},
+		{WriteMultipleRegistersRequest{Address: 0x01, Values: []uint16{0x000A, 0x0102}},
+			[]byte{0x00, 0x01, 0x00, 0x02, 0x04, 0x00, 0x0A, 0x01, 0x02}},
+		{MaskWriteRegisterRequest{Address: 0x04, AndMask: 0xF2, OrMask: 0x25}, []byte{0x00, 0x04, 0x00, 0xF2, 0x00, 0x25}},
+		{ReadDeviceIDRequest{Code: DeviceIDBasic, ObjectID: 0x00}, []byte{0x0E, 0x01, 0x00}},
+		{ReadFIFOQueueRequest{Address: 0x04DE}, []byte{0x04, 0xDE}},
+	}
+	for _, tt := range tests {
+		p := tt.req.PDU()
+		if !bytes.Equal(p.Data, tt.data) {
+			t.Errorf("%T.PDU() data = % X, want % X", tt.req, p.Data, tt.data)
+		}
+		got, err := ParseRequest(p)
+		if err != nil {
+			t.Errorf("ParseRequest(%T) error = %v", tt.req, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.req) {
+			t.Errorf("ParseRequest() = %+v, want %+v", got, tt.req)
+		}
+	}
+}
+
+func TestParseRequest_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		p    modbus.ProtocolDataUnit
+		code byte
+	}{
+		{"unsupported function", modbus.ProtocolDataUnit{FunctionCode: 0x2B}, modbus.ExceptionCodeIllegalFunction},
+		{"short read", modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0}}, modbus.ExceptionCodeIllegalDataValue},
+		{"zero quantity", modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 0}}, modbus.ExceptionCodeIllegalDataValue},
+		{"too many registers", modbus.ProtocolDataUnit{FunctionCode: 0x04, Data: []byte{0, 0, 0, 126}}, modbus.ExceptionCodeIllegalDataValue},
+		{"too many coils", modbus.ProtocolDataUnit{FunctionCode: 0x01, Data: []byte{0, 0, 0x07, 0xD1}}, modbus.ExceptionCodeIllegalDataValue},
+		{"bad coil value", modbus.ProtocolDataUnit{FunctionCode: 0x05, Data: []byte{0, 0, 0x12, 0x34}}, modbus.ExceptionCodeIllegalDataValue},
+		{"byte count mismatch", modbus.ProtocolDataUnit{FunctionCode: 0x10, Data: []byte{0, 0, 0, 2, 4, 0, 1}}, modbus.ExceptionCodeIllegalDataValue},
+		{"CANopen general reference", modbus.ProtocolDataUnit{FunctionCode: 0x2B, Data: []byte{0x0D, 0, 0}}, modbus.ExceptionCodeIllegalFunction},
+		{"bad read device ID code", modbus.ProtocolDataUnit{FunctionCode: 0x2B, Data: []byte{0x0E, 5, 0}}, modbus.ExceptionCodeIllegalDataValue},
+		{"quantity mismatch", modbus.ProtocolDataUnit{FunctionCode: 0x0F, Data: []byte{0, 0, 0, 9, 1, 0xFF}}, modbus.ExceptionCodeIllegalDataValue},
+		{"long FIFO pointer", modbus.ProtocolDataUnit{FunctionCode: 0x18, Data: []byte{0, 0, 0}}, modbus.ExceptionCodeIllegalDataValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRequest(tt.p)
+			var merr *modbus.Error
+			if !errors.As(err, &merr) || merr.ExceptionCode != tt.code {
+				t.Errorf("ParseRequest() error = %v, want exception %d", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		p    modbus.ProtocolDataUnit
+		ok   bool
+	}{
+		{"read registers", modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 125}}, true},
+		{"too many registers", modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 126}}, false},
+		{"too many coils", modbus.ProtocolDataUnit{FunctionCode: 0x01, Data: []byte{0, 0, 0x07, 0xD1}}, false},
+		{"byte count mismatch", modbus.ProtocolDataUnit{FunctionCode: 0x10, Data: []byte{0, 0, 0, 2, 4, 0, 1}}, false},
+		{"mask write", modbus.ProtocolDataUnit{FunctionCode: 0x16, Data: []byte{0, 4, 0, 0xF2, 0, 0x25}}, true},
+		{"short mask write", modbus.ProtocolDataUnit{FunctionCode: 0x16, Data: []byte{0, 4, 0, 0xF2}}, false},
+		{"read/write", modbus.ProtocolDataUnit{FunctionCode: 0x17, Data: []byte{0, 3, 0, 6, 0, 0x0E, 0, 1, 2, 0, 0xFF}}, true},
+		{"read/write too many reads", modbus.ProtocolDataUnit{FunctionCode: 0x17, Data: []byte{0, 3, 0, 126, 0, 0x0E, 0, 1, 2, 0, 0xFF}}, false},
+		{"read/write too many writes", modbus.ProtocolDataUnit{FunctionCode: 0x17, Data: []byte{0, 3, 0, 6, 0, 0x0E, 0, 122, 2, 0, 0xFF}}, false},
+		{"read/write byte count mismatch", modbus.ProtocolDataUnit{FunctionCode: 0x17, Data: []byte{0, 3, 0, 6, 0, 0x0E, 0, 1, 4, 0, 0xFF}}, false},
+		{"other function", modbus.ProtocolDataUnit{FunctionCode: 0x2B, Data: []byte{0x0E, 1, 0}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.p)
+			if tt.ok && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if !tt.ok && modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataValue {
+				t.Errorf("Validate() error = %v, want Illegal Data Value", err)
+			}
+		})
+	}
+}
+
+func TestReportServerID(t *testing.T) {
+	req := ReportServerIDRequest{}.PDU()
+	if r, err := ParseRequest(req); err != nil || r != (ReportServerIDRequest{}) {
+		t.Errorf("ParseRequest() = %v, %v", r, err)
+	}
+	if err := Validate(modbus.ProtocolDataUnit{FunctionCode: 0x11, Data: []byte{0}}); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataValue {
+		t.Errorf("Validate() of 0x11 with data error = %v", err)
+	}
+	resp := ServerIDResponse([]byte{0x0A}, true, []byte("GW"))
+	if want := []byte{4, 0x0A, 0xFF, 'G', 'W'}; resp.FunctionCode != 0x11 || !bytes.Equal(resp.Data, want) {
+		t.Errorf("ServerIDResponse() = %02X % X", resp.FunctionCode, resp.Data)
+	}
+}
+
+func TestDeviceIDResponse(t *testing.T) {
+	objects := []DeviceObject{{ID: 0x00, Value: []byte("AB")}, {ID: 0x01, Value: []byte("P")}}
+	resp := DeviceIDResponse(DeviceIDBasic, 0x81, objects, 0x02)
+	want := []byte{0x0E, 0x01, 0x81, 0xFF, 0x02, 0x02, 0x00, 0x02, 'A', 'B', 0x01, 0x01, 'P'}
+	if resp.FunctionCode != 0x2B || !bytes.Equal(resp.Data, want) {
+		t.Errorf("DeviceIDResponse() = %02X % X, want % X", resp.FunctionCode, resp.Data, want)
+	}
+	if resp := DeviceIDResponse(DeviceIDIndividual, 0x81, objects[1:], 0); resp.Data[3] != 0x00 || resp.Data[4] != 0x00 {
+		t.Errorf("DeviceIDResponse() of the last object = % X, want no more to follow", resp.Data)
+	}
+}
+
+func TestFIFOQueueResponse(t *testing.T) {
+	// The example of the specification
+	resp := FIFOQueueResponse([]uint16{0x01B8, 0x1284})
+	want := []byte{0x00, 0x06, 0x00, 0x02, 0x01, 0xB8, 0x12, 0x84}
+	if resp.FunctionCode != 0x18 || !bytes.Equal(resp.Data, want) {
+		t.Errorf("FIFOQueueResponse() = %02X % X, want % X", resp.FunctionCode, resp.Data, want)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	read10 := ReadHoldingRegistersRequest{Address: 0, Quantity: 10}.PDU()
+	coils := ReadCoilsRequest{Address: 0, Quantity: 10}.PDU()
+	tests := []struct {
+		name      string
+		req, resp modbus.ProtocolDataUnit
+		ok        bool
+	}{
+		{"complete", read10, ReadResponse(0x03, make([]byte, 20)), true},
+		{"truncated", read10, ReadResponse(0x03, make([]byte, 18)), false},
+		{"padded", read10, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: append([]byte{20}, make([]byte, 21)...)}, false},
+		{"byte count mismatch", read10, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: append([]byte{18}, make([]byte, 20)...)}, false},
+		{"empty", read10, modbus.ProtocolDataUnit{FunctionCode: 0x03}, false},
+		{"coils", coils, ReadResponse(0x01, []byte{0xCD, 0x01}), true},
+		{"short coils", coils, ReadResponse(0x01, []byte{0xCD}), false},
+		{"exception", read10, Exception(0x03, modbus.ExceptionCodeIllegalDataAddress), true},
+		{"write", WriteSingleRegisterRequest{Address: 1, Value: 2}.PDU(), modbus.ProtocolDataUnit{FunctionCode: 0x06, Data: []byte{0, 1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateResponse(tt.req, tt.resp)
+			if tt.ok && err != nil {
+				t.Errorf("ValidateResponse() error = %v", err)
+			}
+			if !tt.ok && (!errors.Is(err, modbus.ErrInvalidFrame) || modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeServerDeviceFailure) {
+				t.Errorf("ValidateResponse() error = %v, want invalid frame", err)
+			}
+		})
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	regs, err := ParseReadRegisters(ReadResponse(0x03, []byte{0x02, 0x2B, 0x00, 0x00, 0x00, 0x64}))
+	if err != nil || !reflect.DeepEqual(regs, []uint16{0x022B, 0x0000, 0x0064}) {
+		t.Errorf("ParseReadRegisters() = %v, %v", regs, err)
+	}
+
+	bits, err := ParseReadBits(ReadResponse(0x01, []byte{0xCD, 0x01}), 10)
+	if err != nil || !reflect.DeepEqual(bits, []bool{true, false, true, true, false, false, true, true, true, false}) {
+		t.Errorf("ParseReadBits() = %v, %v", bits, err)
+	}
+	if _, err := ParseReadBits(ReadResponse(0x01, []byte{0xCD}), 10); err == nil {
+		t.Error("ParseReadBits() with short data expected error")
+	}
+
+	err = CheckResponse(0x03, Exception(0x03, modbus.ExceptionCodeIllegalDataAddress))
+	var merr *modbus.Error
+	if !errors.As(err, &merr) || merr.ExceptionCode != modbus.ExceptionCodeIllegalDataAddress {
+		t.Errorf("CheckResponse() exception error = %v", err)
+	}
+	if err := CheckResponse(0x03, modbus.ProtocolDataUnit{FunctionCode: 0x04}); err == nil {
+		t.Error("CheckResponse() with wrong function code expected error")
+	}
+}
+
+func TestResponseLength(t *testing.T) {
+	tests := []struct {
+		req  Request
+		want int
+	}{
+		{ReadCoilsRequest{Quantity: 9}, 3},
+		{ReadHoldingRegistersRequest{Quantity: 3}, 7},
+		{WriteMultipleRegistersRequest{Values: []uint16{1, 2}}, 4},
+	}
+	for _, tt := range tests {
+		if n, ok := ResponseLength(tt.req.PDU()); !ok || n != tt.want {
+			t.Errorf("ResponseLength(%T) = %d, %v, want %d", tt.req, n, ok, tt.want)
+		}
+	}
+	if _, ok := ResponseLength(modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFIFOQueue}); ok {
+		t.Error("ResponseLength(FIFO) expected undetermined")
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+/*
+Package pdu provides typed Modbus requests and responses with builders and parsers,
+so that servers, clients and tools don't slice PDU bytes by hand.
+
+Requests are built with their PDU method and decoded with ParseRequest. Malformed
+requests yield a *modbus.Error carrying the exception code a server should answer with.
+*/
+package pdu
+
+import (
+	"encoding/binary"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// Quantity limits of the Modbus application protocol specification.
+const (
+	MaxReadBits       = 2000
+	MaxReadRegisters  = 125
+	MaxWriteBits      = 1968
+	MaxWriteRegisters = 123
+	MaxRWRegisters    = 121 // Written by Read/Write Multiple Registers
+	MaxFIFOCount      = 31  // Registers of a FIFO queue returned by Read FIFO Queue
+)
+
+// Request is implemented by all typed requests.
+type Request interface {
+	PDU() modbus.ProtocolDataUnit
+}
+
+// ReadCoilsRequest is function code 0x01.
+type ReadCoilsRequest struct {
+	Address, Quantity uint16
+}
+
+// ReadDiscreteInputsRequest is function code 0x02.
+type ReadDiscreteInputsRequest struct {
+	Address, Quantity uint16
+}
+
+// ReadHoldingRegistersRequest is function code 0x03.
+type ReadHoldingRegistersRequest struct {
+	Address, Quantity uint16
+}
+
+// ReadInputRegistersRequest is function code 0x04.
+type ReadInputRegistersRequest struct {
+	Address, Quantity uint16
+}
+
+// WriteSingleCoilRequest is function code 0x05.
+type WriteSingleCoilRequest struct {
+	Address uint16
+	Value   bool
+}
+
+// WriteSingleRegisterRequest is function code 0x06.
+type WriteSingleRegisterRequest struct {
+	Address, Value uint16
+}
+
+// WriteMultipleCoilsRequest is function code 0x0F.
+type WriteMultipleCoilsRequest struct {
+	Address uint16
+	Values  []bool
+}
+
+// WriteMultipleRegistersRequest is function code 0x10.
+type WriteMultipleRegistersRequest struct {
+	Address uint16
+	Values  []uint16
+}
+
+// ReportServerIDRequest is function code 0x11.
+type ReportServerIDRequest struct{}
+
+// ReadDeviceIDRequest is function code 0x2B with MEI type 0x0E, Read Device Identification.
+type ReadDeviceIDRequest struct {
+	Code     byte // DeviceIDBasic to DeviceIDExtended for stream access, DeviceIDIndividual for one object
+	ObjectID byte // First object to read
+}
+
+// Read device ID codes of Read Device Identification.
+const (
+	DeviceIDBasic      = 0x01
+	DeviceIDRegular    = 0x02
+	DeviceIDExtended   = 0x03
+	DeviceIDIndividual = 0x04
+)
+
+// MEITypeReadDeviceID is the MEI type of Read Device Identification.
+const MEITypeReadDeviceID = 0x0E
+
+// MaskWriteRegisterRequest is function code 0x16. The register becomes
+// (current AND AndMask) OR (OrMask AND NOT AndMask).
+type MaskWriteRegisterRequest struct {
+	Address, AndMask, OrMask uint16
+}
+
+// ReadFIFOQueueRequest is function code 0x18.
+type ReadFIFOQueueRequest struct {
+	Address uint16 // FIFO pointer address
+}
+
+func (r ReadCoilsRequest) PDU() modbus.ProtocolDataUnit {
+	return addressQuantity(modbus.FuncCodeReadCoils, r.Address, r.Quantity)
+}
+
+func (r ReadDiscreteInputsRequest) PDU() modbus.ProtocolDataUnit {
+	return addressQuantity(modbus.FuncCodeReadDiscreteInputs, r.Address, r.Quantity)
+}
+
+func (r ReadHoldingRegistersRequest) PDU() modbus.ProtocolDataUnit {
+	return addressQuantity(modbus.FuncCodeReadHoldingRegisters, r.Address, r.Quantity)
+}
+
+func (r ReadInputRegistersRequest) PDU() modbus.ProtocolDataUnit {
+	return addressQuantity(modbus.FuncCodeReadInputRegisters, r.Address, r.Quantity)
+}
+
+func (r WriteSingleCoilRequest) PDU() modbus.ProtocolDataUnit {
+	var v uint16
+	if r.Value {
+		v = 0xFF00
+	}
+	return addressQuantity(modbus.FuncCodeWriteSingleCoil, r.Address, v)
+}
+
+func (r WriteSingleRegisterRequest) PDU() modbus.ProtocolDataUnit {
+	return addressQuantity(modbus.FuncCodeWriteSingleRegister, r.Address, r.Value)
+}
+
+func (r WriteMultipleCoilsRequest) PDU() modbus.ProtocolDataUnit {
+	p := addressQuantity(modbus.FuncCodeWriteMultipleCoils, r.Address, uint16(len(r.Values)))
+	bits := PackBits(r.Values)
+	p.Data = append(append(p.Data, byte(len(bits))), bits...)
+	return p
+}
+
+func (r WriteMultipleRegistersRequest) PDU() modbus.ProtocolDataUnit {
+	p := addressQuantity(modbus.FuncCodeWriteMultipleRegisters, r.Address, uint16(len(r.Values)))
+	regs := EncodeRegisters(r.Values)
+	p.Data = append(append(p.Data, byte(len(regs))), regs...)
+	return p
+}
+
+func (r ReportServerIDRequest) PDU() modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReportServerID}
+}
+
+func (r ReadDeviceIDRequest) PDU() modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadDeviceIdentification, Data: []byte{MEITypeReadDeviceID, r.Code, r.ObjectID}}
+}
+
+func (r MaskWriteRegisterRequest) PDU() modbus.ProtocolDataUnit {
+	p := addressQuantity(modbus.FuncCodeMaskWriteRegister, r.Address, r.AndMask)
+	p.Data = binary.BigEndian.AppendUint16(p.Data, r.OrMask)
+	return p
+}
+
+func (r ReadFIFOQueueRequest) PDU() modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFIFOQueue, Data: binary.BigEndian.AppendUint16(nil, r.Address)}
+}
+
+func addressQuantity(functionCode byte, address, quantity uint16) modbus.ProtocolDataUnit {
+	data := make([]byte, 4, 5)
+	binary.BigEndian.PutUint16(data[0:2], address)
+	binary.BigEndian.PutUint16(data[2:4], quantity)
+	return modbus.ProtocolDataUnit{FunctionCode: functionCode, Data: data}
+}
+
+// ParseRequest decodes a request PDU into one of the typed requests of this package.
+// Unsupported function codes yield Illegal Function, malformed requests Illegal Data Value.
+func ParseRequest(p modbus.ProtocolDataUnit) (Request, error) {
+	switch p.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs:
+		addr, qty, err := parseAddressQuantity(p, MaxReadBits)
+		if err != nil {
+			return nil, err
+		}
+		if p.FunctionCode == modbus.FuncCodeReadCoils {
+			return ReadCoilsRequest{addr, qty}, nil
+		}
+		return ReadDiscreteInputsRequest{addr, qty}, nil
+
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters:
+		addr, qty, err := parseAddressQuantity(p, MaxReadRegisters)
+		if err != nil {
+			return nil, err
+		}
+		if p.FunctionCode == modbus.FuncCodeReadHoldingRegisters {
+			return ReadHoldingRegistersRequest{addr, qty}, nil
+		}
+		return ReadInputRegistersRequest{addr, qty}, nil
+
+	case modbus.FuncCodeWriteSingleCoil:
+		if len(p.Data) != 4 {
+			return nil, illegalDataValue(p)
+		}
+		v := binary.BigEndian.Uint16(p.Data[2:4])
+		if v != 0x0000 && v != 0xFF00 {
+			return nil, illegalDataValue(p)
+		}
+		return WriteSingleCoilRequest{binary.BigEndian.Uint16(p.Data[0:2]), v == 0xFF00}, nil
+
+	case modbus.FuncCodeWriteSingleRegister:
+		if len(p.Data) != 4 {
+			return nil, illegalDataValue(p)
+		}
+		return WriteSingleRegisterRequest{binary.BigEndian.Uint16(p.Data[0:2]), binary.BigEndian.Uint16(p.Data[2:4])}, nil
+
+	case modbus.FuncCodeWriteMultipleCoils:
+		addr, qty, values, err := parseWriteMultiple(p, MaxWriteBits, (MaxWriteBits+7)/8)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != (int(qty)+7)/8 {
+			return nil, illegalDataValue(p)
+		}
+		return WriteMultipleCoilsRequest{addr, UnpackBits(values, int(qty))}, nil
+
+	case modbus.FuncCodeWriteMultipleRegisters:
+		addr, qty, values, err := parseWriteMultiple(p, MaxWriteRegisters, MaxWriteRegisters*2)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != int(qty)*2 {
+			return nil, illegalDataValue(p)
+		}
+		return WriteMultipleRegistersRequest{addr, DecodeRegisters(values)}, nil
+
+	case modbus.FuncCodeReportServerID:
+		if len(p.Data) != 0 {
+			return nil, illegalDataValue(p)
+		}
+		return ReportServerIDRequest{}, nil
+
+	case modbus.FuncCodeMaskWriteRegister:
+		if len(p.Data) != 6 {
+			return nil, illegalDataValue(p)
+		}
+		return MaskWriteRegisterRequest{binary.BigEndian.Uint16(p.Data[0:2]), binary.BigEndian.Uint16(p.Data[2:4]), binary.BigEndian.Uint16(p.Data[4:6])}, nil
+
+	case modbus.FuncCodeReadDeviceIdentification:
+		// Encapsulated interface transport also carries CANopen requests
+		if len(p.Data) == 0 || p.Data[0] != MEITypeReadDeviceID {
+			return nil, &modbus.Error{FunctionCode: p.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+		}
+		if len(p.Data) != 3 || p.Data[1] < DeviceIDBasic || p.Data[1] > DeviceIDIndividual {
+			return nil, illegalDataValue(p)
+		}
+		return ReadDeviceIDRequest{p.Data[1], p.Data[2]}, nil
+
+	case modbus.FuncCodeReadFIFOQueue:
+		if len(p.Data) != 2 {
+			return nil, illegalDataValue(p)
+		}
+		return ReadFIFOQueueRequest{binary.BigEndian.Uint16(p.Data)}, nil
+
+	default:
+		return nil, &modbus.Error{FunctionCode: p.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+	}
+}
+
+// Validate checks the length, quantities and byte counts of a request against the
+// limits of the specification, so a gateway can refuse malformed requests instead
+// of passing them to fragile slaves. Violations yield Illegal Data Value, function
+// codes without fixed limits are left to the slave.
+func Validate(p modbus.ProtocolDataUnit) error {
+	switch p.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters,
+		modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister,
+		modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters,
+		modbus.FuncCodeReportServerID, modbus.FuncCodeMaskWriteRegister, modbus.FuncCodeReadFIFOQueue:
+		_, err := ParseRequest(p)
+		return err
+
+	case modbus.FuncCodeReadWriteMultipleRegisters:
+		if len(p.Data) < 9 {
+			return illegalDataValue(p)
+		}
+		readQty := binary.BigEndian.Uint16(p.Data[2:4])
+		writeQty := binary.BigEndian.Uint16(p.Data[6:8])
+		byteCount := int(p.Data[8])
+		if readQty < 1 || readQty > MaxReadRegisters || writeQty < 1 || writeQty > MaxRWRegisters ||
+			byteCount != int(writeQty)*2 || len(p.Data)-9 != byteCount {
+			return illegalDataValue(p)
+		}
+	}
+	return nil
+}
+
+func parseAddressQuantity(p modbus.ProtocolDataUnit, max uint16) (uint16, uint16, error) {
+	if len(p.Data) != 4 {
+		return 0, 0, illegalDataValue(p)
+	}
+	qty := binary.BigEndian.Uint16(p.Data[2:4])
+	if qty < 1 || qty > max {
+		return 0, 0, illegalDataValue(p)
+	}
+	return binary.BigEndian.Uint16(p.Data[0:2]), qty, nil
+}
+
+// parseWriteMultiple checks the header of 0x0F and 0x10 requests and returns the value bytes.
+func parseWriteMultiple(p modbus.ProtocolDataUnit, maxQuantity uint16, maxBytes int) (uint16, uint16, []byte, error) {
+	if len(p.Data) < 6 {
+		return 0, 0, nil, illegalDataValue(p)
+	}
+	qty := binary.BigEndian.Uint16(p.Data[2:4])
+	byteCount := int(p.Data[4])
+	if qty < 1 || qty > maxQuantity || byteCount > maxBytes || len(p.Data)-5 != byteCount {
+		return 0, 0, nil, illegalDataValue(p)
+	}
+	return binary.BigEndian.Uint16(p.Data[0:2]), qty, p.Data[5:], nil
+}
+
+func illegalDataValue(p modbus.ProtocolDataUnit) error {
+	return &modbus.Error{FunctionCode: p.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeIllegalDataValue}
+}
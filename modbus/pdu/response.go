@@ -0,0 +1,230 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package pdu
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// ReadResponse builds the response of the read functions 0x01 to 0x04 from the
+// packed bits or big-endian registers, prefixing the byte count.
+func ReadResponse(functionCode byte, values []byte) modbus.ProtocolDataUnit {
+	data := make([]byte, 1+len(values))
+	data[0] = byte(len(values))
+	copy(data[1:], values)
+	return modbus.ProtocolDataUnit{FunctionCode: functionCode, Data: data}
+}
+
+// WriteMultipleResponse builds the response of 0x0F and 0x10, echoing address and quantity.
+func WriteMultipleResponse(functionCode byte, address, quantity uint16) modbus.ProtocolDataUnit {
+	return addressQuantity(functionCode, address, quantity)
+}
+
+// ServerIDResponse builds the response of 0x11 from the device specific server ID,
+// the run indicator status and additional data.
+func ServerIDResponse(id []byte, running bool, additional []byte) modbus.ProtocolDataUnit {
+	status := byte(0x00)
+	if running {
+		status = 0xFF
+	}
+	data := append(append(append([]byte{}, id...), status), additional...)
+	return ReadResponse(modbus.FuncCodeReportServerID, data)
+}
+
+// DeviceObject is an object of a Read Device Identification response.
+type DeviceObject struct {
+	ID    byte
+	Value []byte
+}
+
+// MaxDeviceObjects is the size of the objects fitting a Read Device Identification
+// response, each taking two bytes of ID and length besides its value.
+const MaxDeviceObjects = 253 - 7
+
+// DeviceIDResponse builds the response of 0x2B/0x0E to a request with the given read
+// device ID code. next is the object to ask for next if more follow, 0 if not.
+func DeviceIDResponse(code, conformity byte, objects []DeviceObject, next byte) modbus.ProtocolDataUnit {
+	more := byte(0x00)
+	if next != 0 {
+		more = 0xFF
+	}
+	data := []byte{MEITypeReadDeviceID, code, conformity, more, next, byte(len(objects))}
+	for _, o := range objects {
+		data = append(append(data, o.ID, byte(len(o.Value))), o.Value...)
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadDeviceIdentification, Data: data}
+}
+
+// FIFOQueueResponse builds the response of 0x18 from the registers queued, at most
+// MaxFIFOCount.
+func FIFOQueueResponse(values []uint16) modbus.ProtocolDataUnit {
+	data := binary.BigEndian.AppendUint16(nil, uint16(2+2*len(values)))
+	data = binary.BigEndian.AppendUint16(data, uint16(len(values)))
+	data = append(data, EncodeRegisters(values)...)
+	return modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFIFOQueue, Data: data}
+}
+
+// Exception builds an exception response to the given function code.
+func Exception(functionCode, exceptionCode byte) modbus.ProtocolDataUnit {
+	return modbus.ProtocolDataUnit{FunctionCode: functionCode | 0x80, Data: []byte{exceptionCode}}
+}
+
+// ExceptionFromError builds the exception response for an error returned by ParseRequest.
+// Other errors are answered with Server Device Failure.
+func ExceptionFromError(functionCode byte, err error) modbus.ProtocolDataUnit {
+	if e, ok := err.(*modbus.Error); ok {
+		return Exception(functionCode, e.ExceptionCode)
+	}
+	return Exception(functionCode, modbus.ExceptionCodeServerDeviceFailure)
+}
+
+// CheckResponse verifies that resp answers a request with the given function code.
+// Exception responses are returned as *modbus.Error.
+func CheckResponse(functionCode byte, resp modbus.ProtocolDataUnit) error {
+	if resp.FunctionCode == functionCode|0x80 {
+		var code byte
+		if len(resp.Data) > 0 {
+			code = resp.Data[0]
+		}
+		return &modbus.Error{FunctionCode: resp.FunctionCode, ExceptionCode: code}
+	}
+	if resp.FunctionCode != functionCode {
+		return fmt.Errorf("unexpected function code 0x%02X in response", resp.FunctionCode)
+	}
+	return nil
+}
+
+// ParseReadBits decodes the response of 0x01 or 0x02 into quantity bits.
+func ParseReadBits(resp modbus.ProtocolDataUnit, quantity uint16) ([]bool, error) {
+	values, err := readValues(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) < (int(quantity)+7)/8 {
+		return nil, fmt.Errorf("short response: %d bytes for %d bits", len(values), quantity)
+	}
+	return UnpackBits(values, int(quantity)), nil
+}
+
+// ParseReadRegisters decodes the response of 0x03 or 0x04.
+func ParseReadRegisters(resp modbus.ProtocolDataUnit) ([]uint16, error) {
+	values, err := readValues(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("odd register byte count %d", len(values))
+	}
+	return DecodeRegisters(values), nil
+}
+
+// RegisterBytes returns the raw register bytes of a 0x03 or 0x04 response.
+func RegisterBytes(resp modbus.ProtocolDataUnit) ([]byte, error) {
+	return readValues(resp)
+}
+
+func readValues(resp modbus.ProtocolDataUnit) ([]byte, error) {
+	if len(resp.Data) < 1 {
+		return nil, fmt.Errorf("empty response")
+	}
+	n := int(resp.Data[0])
+	if len(resp.Data) < 1+n {
+		return nil, fmt.Errorf("short response: byte count %d, got %d", n, len(resp.Data)-1)
+	}
+	return resp.Data[1 : 1+n], nil
+}
+
+// ResponseLength returns the expected length of the response PDU data, excluding the
+// function code, for a request. ok is false if the length can't be determined up front.
+func ResponseLength(req modbus.ProtocolDataUnit) (n int, ok bool) {
+	switch req.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs:
+		if len(req.Data) < 4 {
+			return 0, false
+		}
+		return 1 + (int(binary.BigEndian.Uint16(req.Data[2:4]))+7)/8, true
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters, modbus.FuncCodeReadWriteMultipleRegisters:
+		if len(req.Data) < 4 {
+			return 0, false
+		}
+		return 1 + int(binary.BigEndian.Uint16(req.Data[2:4]))*2, true
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteMultipleCoils,
+		modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeWriteMultipleRegisters:
+		return 4, true
+	case modbus.FuncCodeMaskWriteRegister:
+		return 6, true
+	case modbus.FuncCodeDiagnostics:
+		// Sub-function and data, echoed or replaced by a counter of the same size
+		return len(req.Data), true
+	default:
+		return 0, false
+	}
+}
+
+// ValidateResponse checks that a read response carries exactly the byte count the
+// quantity of req implies, so truncated or padded frames of faulty slaves are caught
+// instead of forwarded. They yield modbus.ErrInvalidFrame, which servers answer with
+// Server Device Failure. Exceptions and other function codes pass.
+func ValidateResponse(req, resp modbus.ProtocolDataUnit) error {
+	if resp.FunctionCode != req.FunctionCode {
+		return nil
+	}
+	switch req.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters,
+		modbus.FuncCodeReadWriteMultipleRegisters:
+	default:
+		return nil
+	}
+	n, ok := ResponseLength(req)
+	if !ok {
+		return nil
+	}
+	if len(resp.Data) != n || int(resp.Data[0]) != n-1 {
+		return fmt.Errorf("%w: response data % X does not hold the %d bytes of the requested quantity", modbus.ErrInvalidFrame, resp.Data, n-1)
+	}
+	return nil
+}
+
+// PackBits packs bits LSB first into bytes, as used by coil and discrete input PDUs.
+func PackBits(bits []bool) []byte {
+	b := make([]byte, (len(bits)+7)/8)
+	for i, v := range bits {
+		if v {
+			b[i/8] |= 1 << (i % 8)
+		}
+	}
+	return b
+}
+
+// UnpackBits unpacks n LSB first bits.
+func UnpackBits(b []byte, n int) []bool {
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = b[i/8]&(1<<(i%8)) != 0
+	}
+	return bits
+}
+
+// EncodeRegisters converts registers to big-endian bytes.
+func EncodeRegisters(regs []uint16) []byte {
+	b := make([]byte, len(regs)*2)
+	for i, v := range regs {
+		binary.BigEndian.PutUint16(b[i*2:], v)
+	}
+	return b
+}
+
+// DecodeRegisters converts big-endian bytes to registers, ignoring a trailing odd byte.
+func DecodeRegisters(b []byte) []uint16 {
+	regs := make([]uint16, len(b)/2)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(b[i*2:])
+	}
+	return regs
+}
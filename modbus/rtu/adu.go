@@ -22,7 +22,7 @@ func Decode(raw []byte) (adu *ApplicationDataUnit, err error) {
 	length := len(raw)
 	// Minimum size (including address, function and CRC)
 	if length < MinSize {
-		err = fmt.Errorf("modbus: request length '%v' does not meet minimum '%v'", length, MinSize)
+		err = fmt.Errorf("%w: length '%v' does not meet minimum '%v'", modbus.ErrInvalidFrame, length, MinSize)
 		return
 	}
 
@@ -31,7 +31,7 @@ func Decode(raw []byte) (adu *ApplicationDataUnit, err error) {
 	crc.Reset().PushBytes(raw[0 : length-2])
 	checksum := uint16(raw[length-1])<<8 | uint16(raw[length-2])
 	if checksum != crc.Value() {
-		err = fmt.Errorf("modbus: response crc '%v' does not match expected '%v'", checksum, crc.Value())
+		err = fmt.Errorf("%w: crc '%v' does not match expected '%v'", modbus.ErrCRC, checksum, crc.Value())
 		return
 	}
 	adu = &ApplicationDataUnit{}
@@ -75,12 +75,12 @@ func (req *ApplicationDataUnit) Verify(resp *ApplicationDataUnit) (err error) {
 	length := len(resp.Pdu.Data) + 4
 	// Minimum size (including address, function and CRC)
 	if length < MinSize {
-		err = fmt.Errorf("modbus: response length '%v' does not meet minimum '%v'", length, MinSize)
+		err = fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", modbus.ErrInvalidFrame, length, MinSize)
 		return
 	}
 	// Slave address must match
 	if req.SlaveID != resp.SlaveID {
-		err = fmt.Errorf("modbus: response slave id '%v' does not match request '%v'", resp.SlaveID, req.SlaveID)
+		err = fmt.Errorf("%w: response slave id '%v' does not match request '%v'", modbus.ErrInvalidFrame, resp.SlaveID, req.SlaveID)
 		return
 	}
 	return
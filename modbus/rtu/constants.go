@@ -26,4 +26,8 @@ const (
 
 	FuncCodeReadWriteMultipleRegister = 0x17
 	FuncCodeReadFIFOQueue             = 0x18
+
+	FuncCodeDiagnostics              = 0x08
+	FuncCodeReportServerID           = 0x11
+	FuncCodeReadDeviceIdentification = 0x2B
 )
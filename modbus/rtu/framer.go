@@ -5,21 +5,24 @@
 package rtu
 
 import (
-	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"time"
 
 	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
 )
 
-var ErrRequestTimedOut = errors.New("modbus: request timed out")
+// ErrRequestTimedOut is returned when no complete response arrived before the deadline.
+//
+// Deprecated: use modbus.ErrTimeout, which it is an alias for.
+var ErrRequestTimedOut = modbus.ErrTimeout
 
 const (
 	stateSlaveID = 1 << iota
 	stateFunctionCode
 	stateReadLength
+	stateReadLength16
 	stateReadPayload
 	stateCRC
 )
@@ -35,37 +38,35 @@ func (e *InvalidLengthError) Error() string {
 // CalculateResponseLength returns the expected length of a response ADU.
 func CalculateResponseLength(adu []byte) int {
 	length := MinSize
-	switch adu[1] {
-	case modbus.FuncCodeReadDiscreteInputs,
-		modbus.FuncCodeReadCoils:
-		count := int(binary.BigEndian.Uint16(adu[4:]))
-		length += 1 + count/8
-		if count%8 != 0 {
-			length++
-		}
-	case modbus.FuncCodeReadInputRegisters,
-		modbus.FuncCodeReadHoldingRegisters,
-		modbus.FuncCodeReadWriteMultipleRegisters:
-		count := int(binary.BigEndian.Uint16(adu[4:]))
-		length += 1 + count*2
-	case modbus.FuncCodeWriteSingleCoil,
-		modbus.FuncCodeWriteMultipleCoils,
-		modbus.FuncCodeWriteSingleRegister,
-		modbus.FuncCodeWriteMultipleRegisters:
-		length += 4
-	case modbus.FuncCodeMaskWriteRegister:
-		length += 6
-	case modbus.FuncCodeReadFIFOQueue,
-		modbus.FuncCodeReadDeviceIdentification:
-		// undetermined
-	default:
+	// FIFO queue and device identification responses are undetermined
+	// The request data ends before the CRC
+	if n, ok := pdu.ResponseLength(modbus.ProtocolDataUnit{FunctionCode: adu[1], Data: adu[2 : len(adu)-2]}); ok {
+		length += n
 	}
 	return length
 }
 
+// RequestHeaderLength returns how many bytes of a request ADU, slave id and function
+// code included, CalculateRequestLength needs to determine the length of the frame.
+// It never exceeds the length of a complete request, so reading the header doesn't
+// consume the start of the next frame.
+func RequestHeaderLength(funcCode byte) int {
+	switch funcCode {
+	case FuncCodeReportServerID:
+		return 4
+	case FuncCodeReadFIFOQueue:
+		return 6
+	case FuncCodeReadWriteMultipleRegister:
+		return 11
+	default:
+		return 7
+	}
+}
+
 // CalculateRequestLength returns the expected total length of the Request RTU ADU based on the header.
 func CalculateRequestLength(funcCode byte, header []byte) (int, error) {
-	// Header should be at least 7 bytes to cover ByteCount for 0x0F/0x10.
+	// Header should be RequestHeaderLength bytes, 7 to cover ByteCount for 0x0F/0x10
+	// and 11 for 0x17.
 	// [SlaveID, Func, Appd1, Appd2, Appd3, Appd4/ByteCount]
 
 	switch funcCode {
@@ -77,6 +78,22 @@ func CalculateRequestLength(funcCode byte, header []byte) (int, error) {
 		FuncCodeWriteSingleRegister:
 		// Fixed 8 bytes: [SlaveID, Func, Addr(2), Val(2), CRC(2)]
 		return 8, nil
+	case FuncCodeReadDeviceIdentification:
+		// Fixed 7 bytes: [SlaveID, Func, MEI, ReadDevIdCode, ObjectId, CRC(2)]
+		return 7, nil
+	case FuncCodeReportServerID:
+		// Fixed 4 bytes: [SlaveID, Func, CRC(2)]
+		return 4, nil
+	case FuncCodeMaskWriteRegister:
+		// Fixed 10 bytes: [SlaveID, Func, Addr(2), AndMask(2), OrMask(2), CRC(2)]
+		return 10, nil
+	case FuncCodeReadFIFOQueue:
+		// Fixed 6 bytes: [SlaveID, Func, FIFOPointerAddr(2), CRC(2)]
+		return 6, nil
+	case FuncCodeDiagnostics:
+		// Fixed 8 bytes: [SlaveID, Func, SubFunc(2), Data(2), CRC(2)]
+		// Longer query data of Return Query Data can't be told apart from the next frame
+		return 8, nil
 	case FuncCodeWriteMultipleCoils,
 		FuncCodeWriteMultipleRegister:
 		// Write Multiple
@@ -90,6 +107,17 @@ func CalculateRequestLength(funcCode byte, header []byte) (int, error) {
 		byteCount := int(header[6])
 		// Total = 7 (Header up to ByteCount) + N (Data) + 2 (CRC)
 		return 7 + byteCount + 2, nil
+	case FuncCodeReadWriteMultipleRegister:
+		// Req: [SlaveID, Func, ReadAddr(2), ReadQuant(2), WriteAddr(2), WriteQuant(2), ByteCount(1), Data(N), CRC(2)]
+		// ByteCount is at Offset 10 (0-indexed) = header[10]
+
+		if len(header) < 11 {
+			return 0, fmt.Errorf("need 11 bytes to determine length for 0x%02X, got %d", funcCode, len(header))
+		}
+
+		byteCount := int(header[10])
+		// Total = 11 (Header up to ByteCount) + N (Data) + 2 (CRC)
+		return 11 + byteCount + 2, nil
 	default:
 		// Assume unknown function codes are not supported or have fixed minimal length?
 		// For robustness, discard.
@@ -101,7 +129,7 @@ func CalculateRequestLength(funcCode byte, header []byte) (int, error) {
 // It uses a state machine to detect the frame based on the expected SlaveID and FunctionCode.
 func ReadResponse(slaveID, functionCode byte, r io.Reader, deadline time.Time) ([]byte, error) {
 	if r == nil {
-		return nil, fmt.Errorf("reader is nil")
+		return nil, fmt.Errorf("%w: reader is nil", modbus.ErrConnection)
 	}
 
 	buf := make([]byte, 1)
@@ -111,6 +139,10 @@ func ReadResponse(slaveID, functionCode byte, r io.Reader, deadline time.Time) (
 	var length, toRead byte
 	var n, crcCount int
 
+	// Device identification responses list objects of their own length each
+	var deviceID, inObject bool
+	var objects int // Still to read
+
 	for {
 		if time.Now().After(deadline) {
 			return nil, ErrRequestTimedOut
@@ -136,21 +168,30 @@ func ReadResponse(slaveID, functionCode byte, r io.Reader, deadline time.Time) (
 					FuncCodeReadHoldingRegister,
 					FuncCodeReadInputRegister,
 					FuncCodeReadWriteMultipleRegister,
-					FuncCodeReadFIFOQueue:
+					FuncCodeReportServerID:
 
 					state = stateReadLength
+				case FuncCodeReadFIFOQueue:
+					// ByteCount(2), FIFOCount(2), FIFOValueRegisters
+					state = stateReadLength16
 				case FuncCodeWriteSingleCoil,
 					FuncCodeWriteSingleRegister,
 					FuncCodeWriteMultipleRegister,
-					FuncCodeWriteMultipleCoils:
+					FuncCodeWriteMultipleCoils,
+					FuncCodeDiagnostics:
 
 					state = stateReadPayload
 					toRead = 4
 				case FuncCodeMaskWriteRegister:
 					state = stateReadPayload
 					toRead = 6
+				case FuncCodeReadDeviceIdentification:
+					// MEI, ReadDevIdCode, Conformity, MoreFollows, NextObjectId, NumberOfObjects
+					state = stateReadPayload
+					toRead = 6
+					deviceID = true
 				default:
-					return nil, fmt.Errorf("functioncode not handled: %d", functionCode)
+					return nil, fmt.Errorf("%w: functioncode not handled: %d", modbus.ErrInvalidFrame, functionCode)
 				}
 				data[n] = buf[0]
 				n++
@@ -170,12 +211,51 @@ func ReadResponse(slaveID, functionCode byte, r io.Reader, deadline time.Time) (
 			data[n] = length
 			n++
 			state = stateReadPayload
+		case stateReadLength16:
+			data[n] = buf[0]
+			n++
+			if n < 4 {
+				continue
+			}
+			count := int(data[2])<<8 | int(data[3])
+			if count > MaxSize-6 || count == 0 {
+				return nil, fmt.Errorf("%w: invalid FIFO byte count: %d", modbus.ErrInvalidFrame, count)
+			}
+			toRead = byte(count)
+			state = stateReadPayload
 		case stateReadPayload:
 			data[n] = buf[0]
 			toRead--
 			n++
-			if toRead == 0 {
-				state = stateCRC
+			if toRead > 0 {
+				continue
+			}
+			state = stateCRC
+			if !deviceID {
+				continue
+			}
+			switch {
+			case n == 8:
+				objects = int(data[7])
+			case !inObject:
+				// Object ID and length read, the value follows
+				inObject, toRead = true, data[n-1]
+			default:
+				inObject = false
+				objects--
+			}
+			if inObject && toRead == 0 {
+				inObject = false
+				objects--
+			}
+			switch {
+			case inObject:
+				state = stateReadPayload
+			case objects > 0:
+				state, toRead = stateReadPayload, 2
+			}
+			if n+int(toRead)+2 > MaxSize {
+				return nil, fmt.Errorf("%w: device identification response exceeds %d bytes", modbus.ErrInvalidFrame, MaxSize)
 			}
 		case stateCRC:
 			data[n] = buf[0]
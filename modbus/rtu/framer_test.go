@@ -4,7 +4,35 @@
 
 package rtu
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus/crc"
+)
+
+func TestCalculateResponseLength(t *testing.T) {
+	tests := []struct {
+		name string
+		adu  []byte // Request ADU including CRC
+		want int
+	}{
+		{"ReadHoldingRegisters", []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x0B}, 4 + 1 + 4},
+		{"WriteSingleRegister", []byte{0x01, 0x06, 0x00, 0x01, 0x00, 0x03, 0x9A, 0x9B}, 4 + 4},
+		// Return Query Data echoes sub-function and data
+		{"Diagnostics", []byte{0x01, 0x08, 0x00, 0x00, 0xA5, 0x37, 0xDA, 0x8D}, 4 + 4},
+		{"ReadFIFOQueue", []byte{0x01, 0x18, 0x04, 0xDE, 0x07, 0x0D}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateResponseLength(tt.adu); got != tt.want {
+				t.Errorf("CalculateResponseLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
 
 func TestCalculateRequestLength(t *testing.T) {
 	tests := []struct {
@@ -18,6 +46,12 @@ func TestCalculateRequestLength(t *testing.T) {
 		{"WriteSingleRegister", 0x06, []byte{0x01, 0x06, 0x00, 0x00, 0xAA, 0xBB}, 8, false},
 		{"WriteMultipleRegisters_ShortHeader", 0x10, []byte{0x01, 0x10, 0x00, 0x01, 0x00, 0x01}, 0, true},
 		{"WriteMultipleRegisters_Valid", 0x10, []byte{0x01, 0x10, 0x00, 0x01, 0x00, 0x01, 0x02}, 7 + 2 + 2, false},
+		{"ReportServerID", 0x11, []byte{0x01, 0x11, 0xC0, 0x2C}, 4, false},
+		{"MaskWriteRegister", 0x16, []byte{0x01, 0x16, 0x00, 0x04, 0x00, 0xF2, 0x00}, 10, false},
+		{"ReadWriteMultipleRegisters_ShortHeader", 0x17, []byte{0x01, 0x17, 0x00, 0x03, 0x00, 0x06, 0x00}, 0, true},
+		{"ReadWriteMultipleRegisters_Valid", 0x17, []byte{0x01, 0x17, 0x00, 0x03, 0x00, 0x06, 0x00, 0x0E, 0x00, 0x03, 0x06}, 11 + 6 + 2, false},
+		{"ReadFIFOQueue", 0x18, []byte{0x01, 0x18, 0x04, 0xDE, 0xAA, 0xBB}, 6, false},
+		{"Diagnostics", 0x08, []byte{0x01, 0x08, 0x00, 0x0B, 0x00, 0x00}, 8, false},
 		{"UnknownFunction", 0x99, []byte{0x01, 0x99}, 0, true},
 	}
 
@@ -34,3 +68,53 @@ func TestCalculateRequestLength(t *testing.T) {
 		})
 	}
 }
+
+func TestReadResponse_ReportServerID(t *testing.T) {
+	frame := []byte{0x01, 0x11, 0x04, 0x0A, 0x01, 0xFF, 'G'}
+	var c crc.CRC
+	c.Reset().PushBytes(frame)
+	sum := c.Value()
+	frame = append(frame, byte(sum), byte(sum>>8))
+
+	got, err := ReadResponse(0x01, 0x11, bytes.NewReader(frame), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	if !bytes.Equal(got, frame) {
+		t.Errorf("ReadResponse() = % X, want % X", got, frame)
+	}
+}
+
+func TestReadResponse_ReadDeviceIdentification(t *testing.T) {
+	// Basic stream access, two objects and more to follow from object 2
+	frame := []byte{0x01, 0x2B, 0x0E, 0x01, 0x81, 0xFF, 0x02, 0x02, 0x00, 0x03, 'A', 'B', 'C', 0x01, 0x02, 'P', '1'}
+	var c crc.CRC
+	c.Reset().PushBytes(frame)
+	sum := c.Value()
+	frame = append(frame, byte(sum), byte(sum>>8))
+
+	got, err := ReadResponse(0x01, 0x2B, bytes.NewReader(frame), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	if !bytes.Equal(got, frame) {
+		t.Errorf("ReadResponse() = % X, want % X", got, frame)
+	}
+}
+
+func TestReadResponse_ReadFIFOQueue(t *testing.T) {
+	// Byte count 0x0006, FIFO count 2, registers 0x01B8 and 0x1284
+	frame := []byte{0x01, 0x18, 0x00, 0x06, 0x00, 0x02, 0x01, 0xB8, 0x12, 0x84}
+	var c crc.CRC
+	c.Reset().PushBytes(frame)
+	sum := c.Value()
+	frame = append(frame, byte(sum), byte(sum>>8))
+
+	got, err := ReadResponse(0x01, 0x18, bytes.NewReader(frame), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	if !bytes.Equal(got, frame) {
+		t.Errorf("ReadResponse() = % X, want % X", got, frame)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package tcp frames Modbus TCP ADUs on a byte stream. The stream carries no
+// boundaries, a read may return part of an ADU or several of them, so ADUs are
+// delimited by the length field of their MBAP header.
+package tcp
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+const (
+	// HeaderSize is the size of the MBAP header up to the length field, which counts
+	// the bytes after it.
+	HeaderSize = 6
+
+	MinSize = 8   // MBAP header, unit ID and function code
+	MaxSize = 260 // MBAP header, unit ID and a PDU of 253 bytes
+)
+
+// ReadFrame reads one ADU from r. Callers reading a connection wrap it in a
+// bufio.Reader, so ADUs arriving together take a single read.
+//
+// A length field out of range returns modbus.ErrInvalidFrame. The stream can't be
+// resynchronized after it, the connection should be closed.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	// Counts at least the unit ID and function code
+	length := int(header[4])<<8 | int(header[5])
+	if HeaderSize+length < MinSize || HeaderSize+length > MaxSize {
+		return nil, fmt.Errorf("%w: MBAP length %d", modbus.ErrInvalidFrame, length)
+	}
+
+	frame := make([]byte, HeaderSize+length)
+	copy(frame, header)
+	if _, err := io.ReadFull(r, frame[HeaderSize:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+var (
+	readRequest  = []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x02}
+	readResponse = []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x07, 0x01, 0x03, 0x04, 0x00, 0x0A, 0x00, 0x0B}
+)
+
+func TestReadFrame(t *testing.T) {
+	stream := append(append([]byte(nil), readRequest...), readResponse...)
+	for _, tt := range []struct {
+		name string
+		r    io.Reader
+	}{
+		{"concatenated", bufio.NewReader(bytes.NewReader(stream))},
+		{"segmented", bufio.NewReader(iotest.OneByteReader(bytes.NewReader(stream)))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, want := range [][]byte{readRequest, readResponse} {
+				got, err := ReadFrame(tt.r)
+				if err != nil || !bytes.Equal(got, want) {
+					t.Fatalf("ReadFrame = % X, %v, want % X", got, err, want)
+				}
+			}
+			if _, err := ReadFrame(tt.r); err != io.EOF {
+				t.Errorf("ReadFrame at the end error = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestReadFrame_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		raw  []byte
+		want error
+	}{
+		{"length 1", []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x01}, modbus.ErrInvalidFrame},
+		{"length 255", []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0xFF, 0x01, 0x03}, modbus.ErrInvalidFrame},
+		{"truncated header", readRequest[:4], io.ErrUnexpectedEOF},
+		{"truncated PDU", readRequest[:HeaderSize], io.ErrUnexpectedEOF},
+	} {
+		if _, err := ReadFrame(bytes.NewReader(tt.raw)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,630 @@
+// Copyright (c) 2025-2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package gateway
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/acl"
+	"github.com/ffutop/modbus-gateway/internal/alarm"
+	"github.com/ffutop/modbus-gateway/internal/balance"
+	"github.com/ffutop/modbus-gateway/internal/breaker"
+	"github.com/ffutop/modbus-gateway/internal/cache"
+	"github.com/ffutop/modbus-gateway/internal/capture"
+	"github.com/ffutop/modbus-gateway/internal/chaos"
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/connector/cloud"
+	"github.com/ffutop/modbus-gateway/internal/connector/influx"
+	"github.com/ffutop/modbus-gateway/internal/connector/mqtt"
+	"github.com/ffutop/modbus-gateway/internal/devid"
+	"github.com/ffutop/modbus-gateway/internal/diag"
+	"github.com/ffutop/modbus-gateway/internal/discovery"
+	"github.com/ffutop/modbus-gateway/internal/failover"
+	engine "github.com/ffutop/modbus-gateway/internal/gateway"
+	"github.com/ffutop/modbus-gateway/internal/loadgen"
+	"github.com/ffutop/modbus-gateway/internal/mirror"
+	"github.com/ffutop/modbus-gateway/internal/partition"
+	"github.com/ffutop/modbus-gateway/internal/probe"
+	"github.com/ffutop/modbus-gateway/internal/remap"
+	"github.com/ffutop/modbus-gateway/internal/retry"
+	"github.com/ffutop/modbus-gateway/internal/script"
+	"github.com/ffutop/modbus-gateway/internal/sunspec"
+	"github.com/ffutop/modbus-gateway/internal/swap"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/transport"
+	"github.com/ffutop/modbus-gateway/transport/replay"
+)
+
+// build creates a single gateway instance. It returns nil without an error
+// if the instance ends up without routes and has to be skipped.
+func build(gwCfg config.GatewayConfig, extra []injected, extraUpstreams []Upstream) (built *engine.Gateway, err error) {
+	var gw *engine.Gateway // Receives the connection events of the downstreams once built
+
+	// Downstreams created, closed with their recording files unless the gateway is built
+	var created []transport.Downstream
+	defer func() {
+		if built == nil {
+			for _, ds := range created {
+				ds.Close()
+			}
+		}
+	}()
+
+	// Setup Routing
+	routes := make(map[byte]transport.Downstream)
+	var defaultRoute transport.Downstream
+	names := make(map[transport.Downstream]string) // Labels of the downstreams in logs and reports
+	timeouts := make(map[transport.Downstream]time.Duration)
+	breakers := make(map[string]*breaker.Downstream)
+	required := make(map[string]*breaker.Downstream)
+	probes := make(map[string]*probe.Prober)
+	persisted := make(map[string]transport.Persisted)
+	var mirrors []*mirror.Mirror       // Polling services of the downstreams
+	var groups []*failover.Group       // Probing the primaries of downstreams with backups
+	var members []transport.Downstream // Served through partition routers, connected by the gateway
+	create := func(cfg config.DownstreamConfig) (_ transport.Downstream, err error) {
+		// A lost connection opens the breaker unless backups take over
+		var b *breaker.Downstream
+		onState := func(up bool, err error) {
+			if b != nil && len(cfg.Backups) == 0 {
+				b.Report(up)
+			}
+			gw.Emit(engine.Event{Type: engine.EventDownstream, Downstream: downstreamName(cfg), Up: up, Err: err})
+		}
+		ds, err := createDownstream(gwCfg.Name, cfg, onState, persisted)
+		if err != nil {
+			return nil, err
+		}
+		// Closing the outermost layer built closes the ones below, recording files included
+		defer func() {
+			if err != nil {
+				ds.Close()
+			}
+		}()
+		// Everything above the group acts on whichever member is active
+		if len(cfg.Backups) > 0 {
+			g, err := createGroup(gwCfg.Name, cfg, ds)
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, g)
+			ds = g
+		}
+		// Diagnostics count the requests put on the bus
+		counters := &diag.Counters{}
+		ds = counters.Count(ds)
+		// The breaker sees a request fail once its retries are exhausted
+		r, err := retry.Wrap(ds, cfg)
+		if err != nil {
+			return nil, err
+		}
+		ds = r
+		if cfg.Breaker.Failures > 0 {
+			b = breaker.Wrap(ds, cfg.Breaker)
+			breakers[downstreamName(cfg)] = b
+			if cfg.Required {
+				required[downstreamName(cfg)] = b
+			}
+			ds = b
+		}
+		// Requests refused by the queue don't reach the breaker
+		queue, err := engine.NewQueue(ds, cfg.Queue)
+		if err != nil {
+			return nil, err
+		}
+		ds = queue
+		// Probes wait in the queue and reach the device, never a mirror or cache
+		if cfg.Probe.Interval > 0 {
+			probeCfg := cfg.Probe
+			if probeCfg.SlaveID == 0 {
+				probeCfg.SlaveID = 1
+				if ids, err := engine.ParseSlaveIDs(cfg.SlaveIDs); err == nil && len(ids) > 0 {
+					probeCfg.SlaveID = slices.Min(ids)
+				}
+			}
+			probes[downstreamName(cfg)] = probe.New(gwCfg.Name, downstreamName(cfg), ds, probeCfg, r.Budget())
+		}
+		// Polls of mirrored blocks wait in the queue, reads answered from the mirror don't
+		if len(cfg.Mirror.Blocks) > 0 {
+			m, err := mirror.New(gwCfg.Name, downstreamName(cfg), ds, cfg.Mirror)
+			if err != nil {
+				return nil, err
+			}
+			mirrors = append(mirrors, m)
+			ds = m
+		}
+		// Reads answered from the cache don't wait in the queue
+		if cfg.Cache.TTL > 0 {
+			ds = cache.Wrap(ds, cfg.Cache.TTL)
+		}
+		// Diagnostics are answered even while the bus is busy or the breaker is open
+		ds = counters.Answer(ds)
+		names[ds] = downstreamName(cfg)
+		if r.Budget() > 0 {
+			timeouts[ds] = r.Budget()
+		}
+		return ds, nil
+	}
+
+	// Downstreams whose routes are discovered once the gateway runs
+	type discovered struct {
+		cfg config.DownstreamConfig
+		ds  transport.Downstream
+		ids []byte
+	}
+	var discover []discovered
+
+	// Downstreams without slave IDs, or with "*", serve the slave IDs no other does
+	partitions := make(map[byte][]partition.Part) // Slave IDs shared by address or function code
+	for _, dsCfg := range gwCfg.Downstreams {
+		ranges, err := partition.ParseRanges(dsCfg.AddressRanges)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address ranges of %s: %w", downstreamName(dsCfg), err)
+		}
+		functions, err := acl.ParseFunctions(dsCfg.AllowFunctionCodes, dsCfg.DenyFunctionCodes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function codes of %s: %w", downstreamName(dsCfg), err)
+		}
+		ds, err := create(dsCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create downstream %s: %w", downstreamName(dsCfg), err)
+		}
+		created = append(created, ds)
+
+		var ids []byte
+		all := engine.AllSlaveIDs(dsCfg.SlaveIDs)
+		if !all {
+			if ids, err = engine.ParseSlaveIDs(dsCfg.SlaveIDs); err != nil {
+				return nil, fmt.Errorf("failed to parse slave IDs %q: %w", dsCfg.SlaveIDs, err)
+			}
+		}
+		mapped, err := remap.Parse(dsCfg.SlaveIDMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse slave ID map %q: %w", dsCfg.SlaveIDMap, err)
+		}
+		for id := range mapped {
+			ids = append(ids, id)
+		}
+
+		if dsCfg.Discover.SlaveIDs != "" {
+			probe, err := engine.ParseSlaveIDs(dsCfg.Discover.SlaveIDs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse discovery slave IDs %q: %w", dsCfg.Discover.SlaveIDs, err)
+			}
+			discover = append(discover, discovered{cfg: dsCfg, ds: ds, ids: probe})
+		}
+
+		if all || (len(ids) == 0 && dsCfg.Discover.SlaveIDs == "") {
+			if defaultRoute != nil {
+				return nil, fmt.Errorf("%s and %s both serve all slave IDs, give one of them slave_ids", names[defaultRoute], names[ds])
+			}
+			defaultRoute = ds
+			if len(ranges) > 0 || functions != nil {
+				// Answers the addresses and function codes it doesn't serve with an exception
+				router, err := partition.New([]partition.Part{{Name: names[ds], Ranges: ranges, Functions: functions, Downstream: ds}}, nil)
+				if err != nil {
+					return nil, fmt.Errorf("default route: %w", err)
+				}
+				names[router] = names[ds]
+				if t, ok := timeouts[ds]; ok {
+					timeouts[router] = t
+				}
+				members = append(members, ds)
+				defaultRoute = router
+			}
+		}
+
+		for _, id := range ids {
+			if len(ranges) > 0 || functions != nil {
+				partitions[id] = append(partitions[id], partition.Part{Name: names[ds], Ranges: ranges, Functions: functions, Downstream: ds})
+				continue
+			}
+			if _, exists := routes[id]; exists {
+				return nil, fmt.Errorf("duplicate route for slave ID %d", id)
+			}
+			routes[id] = ds
+		}
+	}
+
+	// The downstream of a shared slave ID without address ranges or function codes serves the rest
+	for id, parts := range partitions {
+		fallback := routes[id]
+		router, err := partition.New(parts, fallback)
+		if err != nil {
+			return nil, fmt.Errorf("slave ID %d: %w", id, err)
+		}
+		label := make([]string, 0, len(parts)+1)
+		var timeout time.Duration // Of the slowest member
+		for _, p := range parts {
+			label = append(label, p.Name)
+			members = append(members, p.Downstream)
+			timeout = max(timeout, timeouts[p.Downstream])
+		}
+		if fallback != nil {
+			label = append(label, names[fallback])
+			timeout = max(timeout, timeouts[fallback])
+		}
+		if timeout > 0 {
+			timeouts[router] = timeout
+		}
+		names[router] = strings.Join(label, ",")
+		routes[id] = router
+	}
+
+	// Downstreams injected through WithDownstream
+	for _, in := range extra {
+		names[in.ds] = "embedded"
+		if in.slaveIDs == "" {
+			if defaultRoute != nil {
+				return nil, fmt.Errorf("default route already configured")
+			}
+			defaultRoute = in.ds
+			continue
+		}
+		ids, err := engine.ParseSlaveIDs(in.slaveIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse slave IDs %q: %w", in.slaveIDs, err)
+		}
+		for _, id := range ids {
+			if _, exists := routes[id]; exists {
+				return nil, fmt.Errorf("duplicate route for slave ID %d", id)
+			}
+			routes[id] = in.ds
+		}
+	}
+
+	if len(routes) == 0 && defaultRoute == nil && len(discover) == 0 {
+		slog.Error("Gateway has no valid routes", "gateway", gwCfg.Name)
+		return nil, nil
+	}
+
+	// Answer repeated device identification queries from the gateway
+	var deviceIDs *devid.Cache
+	if gwCfg.DeviceID.Cache {
+		deviceIDs = devid.NewCache(gwCfg.DeviceID)
+		wrapped := make(map[transport.Downstream]transport.Downstream)
+		wrap := func(ds transport.Downstream) transport.Downstream {
+			if _, ok := wrapped[ds]; !ok {
+				wrapped[ds] = deviceIDs.Wrap(ds)
+				names[wrapped[ds]] = names[ds]
+				if t, ok := timeouts[ds]; ok {
+					timeouts[wrapped[ds]] = t
+				}
+			}
+			return wrapped[ds]
+		}
+		for id, ds := range routes {
+			routes[id] = wrap(ds)
+		}
+		if defaultRoute != nil {
+			defaultRoute = wrap(defaultRoute)
+		}
+		for i := range discover {
+			discover[i].ds = wrap(discover[i].ds)
+		}
+		slog.Info("Configured device identification cache", "gateway", gwCfg.Name, "ttl", gwCfg.DeviceID.TTL)
+	}
+
+	// Create Upstreams
+	var upstreams []transport.Upstream
+	var upstreamNames []string
+	for _, usCfg := range gwCfg.Upstreams {
+		us, err := transport.NewUpstream(usCfg)
+		if err == nil {
+			us, err = acl.NewFunctionFilter(us, usCfg.FunctionCodes)
+		}
+		if err == nil {
+			us, err = acl.NewDiode(us, usCfg.ReadOnly, usCfg.Scrub)
+		}
+		if err == nil {
+			us, err = acl.NewWindowFilter(us, usCfg.AccessWindows, usCfg.WriteWindows)
+		}
+		if err == nil {
+			us, err = acl.NewWriteLimiter(us, usCfg.WriteRate, usCfg.WriteBurst)
+		}
+		if err != nil {
+			slog.Error("Failed to create upstream", "type", usCfg.Type, "gateway", gwCfg.Name, "err", err)
+			continue
+		}
+		upstreams = append(upstreams, us)
+		upstreamNames = append(upstreamNames, upstreamName(usCfg))
+	}
+	for _, us := range extraUpstreams {
+		upstreams = append(upstreams, us)
+		upstreamNames = append(upstreamNames, "embedded")
+	}
+
+	writeACL, err := acl.New(gwCfg.WriteACL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid write ACL: %w", err)
+	}
+
+	gw = engine.NewGateway(gwCfg.Name, upstreams, routes, defaultRoute)
+	gw.DeviceIDs = deviceIDs
+	gw.WriteACL = writeACL
+	gw.UpstreamNames = upstreamNames
+	gw.DownstreamNames = names
+	gw.Timeouts = timeouts
+	gw.Breakers = breakers
+	gw.Required = required
+	gw.Probes = probes
+	gw.Persisted = persisted
+	gw.TraceFrames = gwCfg.Log.TraceFrames
+
+	for _, m := range mirrors {
+		gw.AddService(m)
+	}
+	for _, g := range groups {
+		gw.AddService(g)
+	}
+	for _, p := range probes {
+		gw.AddService(p)
+	}
+	for _, ds := range members {
+		gw.Attach(ds)
+	}
+
+	// Setup Route Discovery
+	for _, d := range discover {
+		gw.Attach(d.ds)
+		gw.AddService(discovery.NewRouter(gwCfg.Name, d.cfg.Name, d.ds, d.ids, d.cfg.Discover.Timeout, gw.AddRoute))
+		slog.Info("Configured route discovery", "gateway", gwCfg.Name, "downstream", d.cfg.Name, "slave_ids", d.cfg.Discover.SlaveIDs)
+	}
+
+	// The register map defines named points just like tags, both share one namespace
+	points := append(append([]config.TagConfig(nil), gwCfg.Tags...), gwCfg.Registers...)
+	tagSet, err := tag.NewSet(points)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag definitions: %w", err)
+	}
+	tags, err := tag.NewRegistry(tagSet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag definitions: %w", err)
+	}
+	gw.Tags = tags
+
+	// Setup SunSpec Discovery
+	if len(gwCfg.SunSpec) > 0 {
+		gw.AddService(sunspec.NewScanner(gwCfg.Name, gwCfg.SunSpec, tags, gw.Handle))
+		slog.Info("Configured SunSpec discovery", "gateway", gwCfg.Name, "devices", len(gwCfg.SunSpec))
+	}
+
+	// Setup Cloud Connector
+	if gwCfg.Cloud.Provider != "" {
+		connector, err := cloud.NewConnector(gwCfg.Cloud, tags, gw.Handle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cloud connector: %w", err)
+		}
+		gw.AddService(connector)
+		slog.Info("Configured cloud connector", "gateway", gwCfg.Name, "provider", gwCfg.Cloud.Provider, "tags", len(tagSet))
+	}
+
+	// Setup MQTT Publishing
+	if gwCfg.MQTT.Broker != "" {
+		publisher, err := mqtt.New(gwCfg.Name, gwCfg.MQTT, tags, gw.Handle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MQTT publisher: %w", err)
+		}
+		gw.Watch(publisher.Observe)
+		gw.AddService(publisher)
+		slog.Info("Configured MQTT publishing", "gateway", gwCfg.Name, "broker", gwCfg.MQTT.Broker, "tags", len(tagSet), "home_assistant", gwCfg.MQTT.HomeAssistant)
+	}
+
+	// Setup Influx Export
+	if gwCfg.Influx.URL != "" {
+		exporter, err := influx.New(gwCfg.Name, gwCfg.Influx, tags, gw.Handle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create influx exporter: %w", err)
+		}
+		gw.AddService(exporter)
+		slog.Info("Configured influx export", "gateway", gwCfg.Name, "url", gwCfg.Influx.URL, "tags", len(tagSet))
+	}
+
+	// Setup Alarm Rules
+	if len(gwCfg.Alarms.Rules) > 0 {
+		alarms, err := alarm.NewEngine(gwCfg.Name, gwCfg.Alarms, tagSet, gw.Handle)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alarm rules: %w", err)
+		}
+		gw.AddService(alarms)
+		slog.Info("Configured alarm rules", "gateway", gwCfg.Name, "rules", len(gwCfg.Alarms.Rules))
+	}
+
+	// Setup Load Generation
+	if gwCfg.LoadGen.Rate > 0 {
+		gen, err := loadgen.New(gwCfg.Name, gwCfg.LoadGen, gw.Handle)
+		if err != nil {
+			return nil, fmt.Errorf("invalid load generation: %w", err)
+		}
+		gw.AddService(gen)
+		slog.Warn("Configured synthetic load generation, requests will reach the downstream devices", "gateway", gwCfg.Name, "rate", gwCfg.LoadGen.Rate)
+	}
+
+	// Setup Frame Capture
+	if gwCfg.Capture.File != "" {
+		recorder, err := capture.New(gwCfg.Name, gwCfg.Capture)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open frame capture: %w", err)
+		}
+		gw.Capture = recorder
+		slog.Info("Configured frame capture", "gateway", gwCfg.Name, "file", gwCfg.Capture.File, "format", gwCfg.Capture.Format, "enabled", gwCfg.Capture.Enabled)
+	}
+
+	return gw, nil
+}
+
+// upstreamName labels an upstream by the address or device it serves.
+func upstreamName(cfg config.UpstreamConfig) string {
+	switch cfg.Type {
+	case "tcp", "rtu-over-tcp", "udp":
+		return cfg.Tcp.Address
+	case "rtu":
+		return cfg.Serial.Device
+	}
+	return ""
+}
+
+// downstreamName labels a downstream by its name, or else the address or device it connects to.
+func downstreamName(cfg config.DownstreamConfig) string {
+	switch {
+	case cfg.Name != "":
+		return cfg.Name
+	case cfg.Type == "tcp" || cfg.Type == "rtu-over-tcp" || cfg.Type == "udp":
+		return cfg.Tcp.Address
+	case cfg.Type == "rtu":
+		return cfg.Serial.Device
+	}
+	return cfg.Type
+}
+
+// createBalancer creates the members of a load balancing downstream.
+func createBalancer(gateway string, cfg config.DownstreamConfig) (*balance.Balancer, error) {
+	var members []transport.Downstream
+	var names []string
+	for _, m := range cfg.Balance.Members {
+		ds, err := createDownstream(gateway, m, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("member %s: %w", downstreamName(m), err)
+		}
+		members = append(members, ds)
+		names = append(names, downstreamName(m))
+	}
+	slog.Info("Configured load balancing", "gateway", gateway, "downstream", downstreamName(cfg), "members", names, "strategy", cfg.Balance.Strategy)
+	return balance.New(members, names, cfg.Balance)
+}
+
+// createGroup creates the backups of cfg and groups them with its downstream primary.
+func createGroup(gateway string, cfg config.DownstreamConfig, primary transport.Downstream) (_ *failover.Group, err error) {
+	members := []transport.Downstream{primary}
+	names := []string{downstreamName(cfg)}
+	// The caller closes the primary, the backups created are closed here
+	defer func() {
+		if err != nil {
+			for _, ds := range members[1:] {
+				ds.Close()
+			}
+		}
+	}()
+	for _, b := range cfg.Backups {
+		b.SlaveIDMap = cfg.SlaveIDMap // Backups answer for the slaves of the primary
+		b.AddressOffset, b.AddressOffsets = cfg.AddressOffset, cfg.AddressOffsets
+		ds, err := createDownstream(gateway, b, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("backup %s: %w", downstreamName(b), err)
+		}
+		members = append(members, ds)
+		names = append(names, downstreamName(b))
+	}
+
+	failoverCfg := cfg.Failover
+	if failoverCfg.SlaveID == 0 {
+		ids, err := engine.ParseSlaveIDs(cfg.SlaveIDs)
+		if err != nil || len(ids) == 0 {
+			return nil, fmt.Errorf("failover needs a slave_id to probe")
+		}
+		failoverCfg.SlaveID = slices.Min(ids)
+	}
+	slog.Info("Configured failover", "gateway", gateway, "downstream", names[0], "backups", names[1:])
+	return failover.New(members, names, failoverCfg)
+}
+
+// createDownstream creates the downstream of cfg. If its connection is supervised,
+// state changes are logged and passed to onState, which may be nil. If its storage
+// may drop writes, it is added to persisted by name unless persisted is nil.
+func createDownstream(gateway string, cfg config.DownstreamConfig, onState func(up bool, err error), persisted map[string]transport.Persisted) (transport.Downstream, error) {
+	var ds transport.Downstream
+	var err error
+	if cfg.Type == "load_balance" {
+		ds, err = createBalancer(gateway, cfg)
+	} else {
+		if cfg.Tcp.Heartbeat.Interval > 0 && cfg.Tcp.Heartbeat.SlaveID == 0 {
+			ids, err := engine.ParseSlaveIDs(cfg.SlaveIDs)
+			if err != nil || len(ids) == 0 {
+				return nil, fmt.Errorf("heartbeat needs a slave_id to read")
+			}
+			cfg.Tcp.Heartbeat.SlaveID = slices.Min(ids)
+		}
+		ds, err = transport.NewDownstream(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := ds.(transport.Supervised); ok {
+		log := slog.With("gateway", gateway, "downstream", downstreamName(cfg))
+		s.OnState(func(up bool, err error) {
+			if up {
+				log.Info("Downstream connection up")
+			} else {
+				log.Warn("Downstream connection down", "err", err)
+			}
+			if onState != nil {
+				onState(up, err)
+			}
+		})
+	}
+	if p, ok := ds.(transport.Persisted); ok && persisted != nil {
+		persisted[downstreamName(cfg)] = p
+	}
+
+	// Faults act on the wire, below recording and scripts
+	if cfg.Chaos.Enabled() {
+		if cfg.Chaos.DisconnectRate > 0 && cfg.Type == "local" {
+			return nil, fmt.Errorf("chaos disconnect_rate is not supported by local downstreams")
+		}
+		if ds, err = chaos.Wrap(ds, cfg.Chaos); err != nil {
+			return nil, err
+		}
+		slog.Warn("Configured fault injection, requests to the downstream will fail on purpose", "gateway", gateway, "downstream", downstreamName(cfg), "type", cfg.Type)
+	}
+
+	// Record what the device answered, before scripts rewrite it
+	var rec *replay.Recorder
+	if cfg.Record != "" {
+		if rec, err = replay.Record(ds, cfg.Record); err != nil {
+			return nil, err
+		}
+		ds = rec
+	}
+	if cfg.Script != "" {
+		if ds, err = script.Wrap(ds, cfg.Script); err != nil {
+			closeRecorder(rec)
+			return nil, err
+		}
+	}
+
+	// Scripts and recordings see the unit IDs of the devices
+	if cfg.SlaveIDMap != "" {
+		ids, err := remap.Parse(cfg.SlaveIDMap)
+		if err != nil {
+			closeRecorder(rec)
+			return nil, err
+		}
+		ds = remap.Wrap(ds, ids)
+	}
+	// And the addresses and byte order of the devices
+	if cfg.WordSwap || cfg.ByteSwap {
+		ds = swap.Wrap(ds, cfg.WordSwap, cfg.ByteSwap)
+	}
+	offsets, shifted, err := partition.ParseOffsets(cfg)
+	if err != nil {
+		closeRecorder(rec)
+		return nil, err
+	}
+	if shifted {
+		ds = partition.Shift(ds, offsets)
+	}
+	return ds, nil
+}
+
+// closeRecorder closes the recording file of a downstream that failed to build, if any.
+func closeRecorder(rec *replay.Recorder) {
+	if rec != nil {
+		rec.Close()
+	}
+}
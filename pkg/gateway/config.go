@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package gateway
+
+import (
+	"github.com/ffutop/modbus-gateway/internal/config"
+)
+
+// Configuration types, identical to the sections of the YAML config file.
+// They can be filled programmatically instead of loading a file.
+type (
+	Config             = config.Config
+	LogConfig          = config.LogConfig
+	GatewayLogConfig   = config.GatewayLogConfig
+	CaptureConfig      = config.CaptureConfig
+	AuditConfig        = config.AuditConfig
+	TracingConfig      = config.TracingConfig
+	GatewayConfig      = config.GatewayConfig
+	UpstreamConfig     = config.UpstreamConfig
+	DownstreamConfig   = config.DownstreamConfig
+	TcpConfig          = config.TcpConfig
+	SerialConfig       = config.SerialConfig
+	LocalConfig        = config.LocalConfig
+	PersistenceConfig  = config.PersistenceConfig
+	ServerIDConfig     = config.ServerIDConfig
+	DeviceInfoConfig   = config.DeviceInfoConfig
+	FIFOQueueConfig    = config.FIFOQueueConfig
+	InitialValueConfig = config.InitialValueConfig
+	ExpressionConfig   = config.ExpressionConfig
+	LocalUnitConfig    = config.LocalUnitConfig
+	TagConfig          = config.TagConfig
+	CloudConfig        = config.CloudConfig
+	MQTTConfig         = config.MQTTConfig
+	InfluxConfig       = config.InfluxConfig
+	AlarmConfig        = config.AlarmConfig
+	RuleConfig         = config.RuleConfig
+	ActionConfig       = config.ActionConfig
+	SunSpecConfig      = config.SunSpecConfig
+	DeviceIDConfig     = config.DeviceIDConfig
+	DiscoverConfig     = config.DiscoverConfig
+	APIConfig          = config.APIConfig
+	WriteRuleConfig    = config.WriteRuleConfig
+	WindowConfig       = config.WindowConfig
+	TLSConfig          = config.TLSConfig
+	DialTLSConfig      = config.DialTLSConfig
+	IdentityConfig     = config.IdentityConfig
+	ScrubConfig        = config.ScrubConfig
+	BreakerConfig      = config.BreakerConfig
+	ProbeConfig        = config.ProbeConfig
+	QueueConfig        = config.QueueConfig
+	CacheConfig        = config.CacheConfig
+	MirrorConfig       = config.MirrorConfig
+	BlockConfig        = config.BlockConfig
+	FailoverConfig     = config.FailoverConfig
+	BalanceConfig      = config.BalanceConfig
+	AddressRangeConfig = config.AddressRangeConfig
+)
+
+// LoadConfig loads a config file, see config.yaml for the format.
+// An empty path searches the default locations.
+func LoadConfig(file string) (*Config, error) {
+	return config.LoadConfig(file)
+}
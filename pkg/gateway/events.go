@@ -0,0 +1,48 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package gateway
+
+import (
+	engine "github.com/ffutop/modbus-gateway/internal/gateway"
+)
+
+// Event is something that happened in a gateway instance: a request handled, or
+// an upstream or downstream going up or down. See Subscribe.
+type Event = engine.Event
+
+// Types of events
+const (
+	EventRequest    = engine.EventRequest    // A request was handled, answered or failed
+	EventUpstream   = engine.EventUpstream   // An upstream started or stopped listening
+	EventDownstream = engine.EventDownstream // The connection of a supervised downstream went up or down
+)
+
+// Subscribe calls fn with the events of all instances until unsubscribe is called.
+// fn is called synchronously, from the goroutines serving the requests, so it must
+// not block; hand events off to a channel or buffer to process them at leisure.
+func (g *Gateway) Subscribe(fn func(Event)) (unsubscribe func()) {
+	g.subMu.Lock()
+	defer g.subMu.Unlock()
+	if g.subs == nil {
+		g.subs = make(map[int]func(Event))
+	}
+	id := g.nextSub
+	g.nextSub++
+	g.subs[id] = fn
+	return func() {
+		g.subMu.Lock()
+		defer g.subMu.Unlock()
+		delete(g.subs, id)
+	}
+}
+
+// publish passes ev to the subscribers.
+func (g *Gateway) publish(ev Event) {
+	g.subMu.RLock()
+	defer g.subMu.RUnlock()
+	for _, fn := range g.subs {
+		fn(ev)
+	}
+}
@@ -0,0 +1,785 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package gateway embeds Modbus gateways into other Go programs.
+//
+// A Gateway is built from the same Config as the modbus-gateway binary, either
+// loaded from a file or filled programmatically, and runs every gateway instance
+// defined in it:
+//
+//	cfg := &gateway.Config{Gateways: []gateway.GatewayConfig{{
+//		Name:        "plant",
+//		Upstreams:   []gateway.UpstreamConfig{{Type: "tcp", Tcp: gateway.TcpConfig{Address: ":5020"}}},
+//		Downstreams: []gateway.DownstreamConfig{{Type: "rtu", Serial: gateway.SerialConfig{Device: "/dev/ttyUSB0", BaudRate: 9600}}},
+//	}}}
+//	gw, err := gateway.New(cfg)
+//	...
+//	err = gw.Start(ctx)
+//	defer gw.Stop()
+//
+// Slaves implemented in Go are attached with WithDownstream and FromHandler,
+// and Handler issues requests through a gateway's routing table without a network hop.
+// Masters implemented in Go, or transports the binary lacks, implement Upstream and are
+// added with WithUpstream:
+//
+//	gw, err := gateway.New(cfg,
+//		gateway.WithDownstream("plant", "10", gateway.FromHandler(meter)),
+//		gateway.WithUpstream("plant", myUpstream))
+//
+// Transports to be configured by type, like the built-in ones, are registered
+// with transport.RegisterUpstream and transport.RegisterDownstream instead.
+//
+// WithMiddleware wraps the handling of requests, with the middlewares of this
+// package, such as Logging, Cache or RewriteSlaveIDs, or custom ones:
+//
+//	clamp := func(next gateway.RequestHandler) gateway.RequestHandler {
+//		return func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+//			... // e.g. refuse setpoints out of range
+//			return next(ctx, slaveID, pdu)
+//		}
+//	}
+//	gw, err := gateway.New(cfg, gateway.WithMiddleware("plant", gateway.Logging(slog.Default()), clamp))
+//
+// Subscribe follows what the gateways do, the requests they handle and the state
+// of their upstreams and downstreams:
+//
+//	unsubscribe := gw.Subscribe(func(ev gateway.Event) {
+//		if ev.Type == gateway.EventDownstream && !ev.Up {
+//			alert(ev.Gateway, ev.Downstream, ev.Err)
+//		}
+//	})
+//	defer unsubscribe()
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/api"
+	"github.com/ffutop/modbus-gateway/internal/audit"
+	"github.com/ffutop/modbus-gateway/internal/devid"
+	engine "github.com/ffutop/modbus-gateway/internal/gateway"
+	"github.com/ffutop/modbus-gateway/internal/stats"
+	"github.com/ffutop/modbus-gateway/internal/tag"
+	"github.com/ffutop/modbus-gateway/internal/tracing"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+
+	// Built-in transports, registered by their init functions
+	_ "github.com/ffutop/modbus-gateway/transport/local"
+	_ "github.com/ffutop/modbus-gateway/transport/replay"
+	_ "github.com/ffutop/modbus-gateway/transport/rtu"
+	_ "github.com/ffutop/modbus-gateway/transport/rtu-over-tcp"
+	_ "github.com/ffutop/modbus-gateway/transport/tcp"
+	_ "github.com/ffutop/modbus-gateway/transport/udp"
+)
+
+// Transport types, see package transport for registering custom ones.
+type (
+	Upstream       = transport.Upstream
+	Downstream     = transport.Downstream
+	RequestHandler = transport.RequestHandler
+	Middleware     = transport.Middleware
+)
+
+// FromHandler adapts a request handler to a Downstream, so slaves can be implemented in Go.
+func FromHandler(h RequestHandler) Downstream {
+	return &handlerDownstream{handler: h}
+}
+
+type handlerDownstream struct {
+	handler RequestHandler
+}
+
+func (d *handlerDownstream) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	return d.handler(ctx, slaveID, pdu)
+}
+
+func (d *handlerDownstream) Connect(ctx context.Context) error { return nil }
+func (d *handlerDownstream) Close() error                      { return nil }
+
+// Option customizes a Gateway beyond what the Config can express.
+type Option func(*options)
+
+type options struct {
+	downstreams map[string][]injected   // by gateway name
+	upstreams   map[string][]Upstream   // by gateway name
+	middlewares map[string][]Middleware // by gateway name
+}
+
+type injected struct {
+	slaveIDs string
+	ds       Downstream
+}
+
+// WithDownstream routes slaveIDs (e.g. "1,2,5-10") of the named gateway instance to ds,
+// in addition to its configured downstreams. Empty slaveIDs make ds the default route.
+func WithDownstream(gateway, slaveIDs string, ds Downstream) Option {
+	return func(o *options) {
+		o.downstreams[gateway] = append(o.downstreams[gateway], injected{slaveIDs: slaveIDs, ds: ds})
+	}
+}
+
+// WithUpstream adds us to the upstreams of the named gateway instance, in addition to
+// its configured ones. It is started with the gateway, handing the requests of its
+// masters to the gateway's routing table, and closed when the gateway stops.
+func WithUpstream(gateway string, us Upstream) Option {
+	return func(o *options) {
+		o.upstreams[gateway] = append(o.upstreams[gateway], us)
+	}
+}
+
+// WithMiddleware wraps the forwarding of requests by the named gateway instance in
+// mws, after those of earlier options; the first of them sees requests first.
+// Middlewares see the requests that passed the checks of the gateway, such as its
+// write ACL, before they are routed, so a slave ID they rewrite is routed as such.
+func WithMiddleware(gateway string, mws ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares[gateway] = append(o.middlewares[gateway], mws...)
+	}
+}
+
+// Gateway runs the gateway instances defined by a Config.
+type Gateway struct {
+	instances []*engine.Gateway
+	api       *api.Server     // Management API, nil unless an address is configured
+	audit     *audit.Trail    // Trail of writes, nil unless a file is configured
+	tracer    *tracing.Tracer // Exporter of the spans of requests, nil unless an endpoint is configured
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	started time.Time
+	wg      sync.WaitGroup
+
+	subMu   sync.RWMutex
+	subs    map[int]func(Event) // Subscribers by ID
+	nextSub int
+}
+
+// New builds the gateway instances of cfg. Instances that can't be built are
+// logged and skipped, as the binary does, but invalid definitions are errors.
+func New(cfg *Config, opts ...Option) (*Gateway, error) {
+	o := &options{downstreams: make(map[string][]injected), upstreams: make(map[string][]Upstream), middlewares: make(map[string][]Middleware)}
+	for _, opt := range opts {
+		opt(o)
+	}
+	cfg.Fixup()
+
+	g := &Gateway{}
+	for _, gwCfg := range cfg.Gateways {
+		gw, err := build(gwCfg, o.downstreams[gwCfg.Name], o.upstreams[gwCfg.Name])
+		if err != nil {
+			return nil, fmt.Errorf("gateway %s: %w", gwCfg.Name, err)
+		}
+		if gw == nil {
+			continue
+		}
+		gw.Events = g.publish
+		gw.Middlewares = o.middlewares[gwCfg.Name]
+		g.instances = append(g.instances, gw)
+		for _, r := range routeTable(gw) {
+			slog.Info("Route", "gateway", r.Gateway, "slave_ids", r.SlaveIDs, "downstream", r.Downstream)
+		}
+	}
+	if len(g.instances) == 0 {
+		return nil, fmt.Errorf("no valid gateways configured")
+	}
+
+	if cfg.Audit.File != "" {
+		trail, err := audit.Open(cfg.Audit.File)
+		if err != nil {
+			return nil, err
+		}
+		g.audit = trail
+		for _, gw := range g.instances {
+			gw.Audit = trail
+		}
+	}
+
+	if cfg.Tracing.Endpoint != "" {
+		tracer, err := tracing.New(cfg.Tracing)
+		if err != nil {
+			return nil, err
+		}
+		g.tracer = tracer
+		for _, gw := range g.instances {
+			gw.Tracer = tracer
+		}
+	}
+
+	if cfg.API.Address != "" {
+		g.api = api.New(cfg.API)
+		g.api.Handle("/api/devices", g.devices)
+		g.api.Handle("/api/report", g.report)
+		g.api.Handle("/api/routes", g.routes)
+		g.api.Handle("/api/breakers", g.breakers)
+		g.api.Handle("/api/tags", g.tags)
+		if cfg.API.Writes {
+			g.api.HandleWrite("/api/tags/", g.tag, g.writeTag)
+		} else {
+			g.api.Handle("/api/tags/", g.tag)
+		}
+		g.api.Handle("/api/capture", g.captures)
+		g.api.HandleWrite("/api/capture/", g.capture, g.setCapture)
+		g.api.HandleCheck("/healthz", g.healthy)
+		g.api.HandleCheck("/readyz", g.ready)
+		if cfg.API.Dashboard {
+			for _, gw := range g.instances {
+				gw.Trace = stats.NewTrace(gw.Name, cfg.API.Transactions)
+			}
+			g.api.Handle("/api/transactions", g.transactions)
+			g.api.ServeDashboard()
+		}
+	}
+	return g, nil
+}
+
+// Start starts all gateway instances in the background and returns immediately.
+// They run until ctx is cancelled or Stop is called.
+func (g *Gateway) Start(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cancel != nil {
+		return fmt.Errorf("gateway already started")
+	}
+
+	ctx, g.cancel = context.WithCancel(ctx)
+	g.started = time.Now()
+	for _, gw := range g.instances {
+		g.wg.Add(1)
+		go func(gw *engine.Gateway) {
+			defer g.wg.Done()
+			if err := gw.Start(ctx); err != nil {
+				slog.Error("Gateway stopped with error", "gateway", gw.Name, "err", err)
+			}
+		}(gw)
+	}
+	if g.tracer != nil {
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			g.tracer.Run(ctx)
+		}()
+	}
+	if g.api != nil {
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			if err := g.api.Run(ctx); err != nil {
+				slog.Error("Management API stopped with error", "err", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Stop shuts all gateway instances down and waits until they have stopped.
+func (g *Gateway) Stop() {
+	g.mu.Lock()
+	cancel := g.cancel
+	g.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	g.wg.Wait()
+	g.audit.Close()
+	for _, gw := range g.instances {
+		gw.Capture.Close()
+	}
+}
+
+// Run starts the gateway and blocks until ctx is cancelled.
+func (g *Gateway) Run(ctx context.Context) error {
+	if err := g.Start(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	g.Stop()
+	return nil
+}
+
+// Names returns the names of the gateway instances.
+func (g *Gateway) Names() []string {
+	names := make([]string, len(g.instances))
+	for i, gw := range g.instances {
+		names[i] = gw.Name
+	}
+	return names
+}
+
+// Handler returns the request handler of the named instance. Requests passed to it
+// are routed exactly like requests from an upstream master.
+func (g *Gateway) Handler(name string) (RequestHandler, bool) {
+	for _, gw := range g.instances {
+		if gw.Name == name {
+			return gw.Handle, true
+		}
+	}
+	return nil, false
+}
+
+// Device is a slave identity in the asset inventory.
+type Device struct {
+	Gateway string `json:"gateway"`
+	devid.Identity
+}
+
+// Devices returns the identities reported by the slaves of all instances that
+// cache device identification, the asset inventory served at /api/devices.
+func (g *Gateway) Devices() []Device {
+	devices := []Device{}
+	for _, gw := range g.instances {
+		if gw.DeviceIDs == nil {
+			continue
+		}
+		for _, id := range gw.DeviceIDs.Identities() {
+			devices = append(devices, Device{Gateway: gw.Name, Identity: id})
+		}
+	}
+	return devices
+}
+
+func (g *Gateway) devices(r *http.Request) (any, error) {
+	return g.Devices(), nil
+}
+
+// RouteReport summarizes the requests of one route since the gateway was created.
+type RouteReport = stats.Summary
+
+// Report returns request counts, error rates and latency percentiles per route of
+// all instances, as served at /api/report.
+func (g *Gateway) Report() []RouteReport {
+	report := []RouteReport{}
+	for _, gw := range g.instances {
+		report = append(report, gw.Stats.Summaries(gw.Name)...)
+	}
+	return report
+}
+
+// WriteReport writes the report as a table.
+func (g *Gateway) WriteReport(w io.Writer) error {
+	return stats.WriteTable(w, g.Report())
+}
+
+func (g *Gateway) report(r *http.Request) (any, error) {
+	return g.Report(), nil
+}
+
+// Route is an entry of the routing table served at /api/routes.
+type Route struct {
+	Gateway    string `json:"gateway"`
+	SlaveIDs   string `json:"slave_ids"` // e.g. "1-10,12", "*" for the default route
+	Downstream string `json:"downstream"`
+}
+
+// Routes returns the routing tables of all instances, one entry per downstream and
+// the default route last. Routes discovered at runtime are included.
+func (g *Gateway) Routes() []Route {
+	routes := []Route{}
+	for _, gw := range g.instances {
+		routes = append(routes, routeTable(gw)...)
+	}
+	return routes
+}
+
+// routeTable returns the routing table of an instance, as Routes does.
+func routeTable(gw *engine.Gateway) []Route {
+	names, defaultRoute := gw.RouteNames()
+	ids := make(map[string][]byte) // By downstream
+	for id, name := range names {
+		ids[name] = append(ids[name], id)
+	}
+	var routes []Route
+	for name, list := range ids {
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		routes = append(routes, Route{Gateway: gw.Name, SlaveIDs: formatSlaveIDs(list), Downstream: name})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Downstream < routes[j].Downstream })
+	if defaultRoute != "" {
+		routes = append(routes, Route{Gateway: gw.Name, SlaveIDs: "*", Downstream: defaultRoute})
+	}
+	return routes
+}
+
+// formatSlaveIDs formats sorted slave IDs as ranges, e.g. "1-10,12".
+func formatSlaveIDs(ids []byte) string {
+	var parts []string
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] == ids[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(int(ids[i])))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", ids[i], ids[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+func (g *Gateway) routes(r *http.Request) (any, error) {
+	return g.Routes(), nil
+}
+
+// Transaction is a request recorded for the dashboard.
+type Transaction = stats.Transaction
+
+// Transactions returns the last transactions of all instances, newest first, as
+// served at /api/transactions. It is empty unless the dashboard is enabled.
+func (g *Gateway) Transactions() []Transaction {
+	txs := []Transaction{}
+	for _, gw := range g.instances {
+		txs = append(txs, gw.Trace.Transactions()...)
+	}
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].Time.After(txs[j].Time) })
+	return txs
+}
+
+func (g *Gateway) transactions(r *http.Request) (any, error) {
+	return g.Transactions(), nil
+}
+
+// BreakerState is the state of the circuit breaker of a downstream, served at /api/breakers.
+type BreakerState struct {
+	Gateway    string `json:"gateway"`
+	Downstream string `json:"downstream"`
+	State      string `json:"state"`    // "closed", "open" or "half_open"
+	Failures   int    `json:"failures"` // Consecutive timeouts and connection failures
+	Required   bool   `json:"required"` // The gateway is unready while the breaker is open
+}
+
+// Breakers returns the state of the circuit breakers of all instances, sorted by
+// gateway and downstream.
+func (g *Gateway) Breakers() []BreakerState {
+	states := []BreakerState{}
+	for _, gw := range g.instances {
+		var entries []BreakerState
+		for name, b := range gw.Breakers {
+			_, required := gw.Required[name]
+			entries = append(entries, BreakerState{Gateway: gw.Name, Downstream: name, State: b.State(), Failures: b.Failures(), Required: required})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Downstream < entries[j].Downstream })
+		states = append(states, entries...)
+	}
+	return states
+}
+
+func (g *Gateway) breakers(r *http.Request) (any, error) {
+	return g.Breakers(), nil
+}
+
+// TagValue is a named point with its current value, served at /api/tags.
+type TagValue struct {
+	Gateway string `json:"gateway"`
+	Name    string `json:"name"`
+	SlaveID byte   `json:"slave_id"`
+	Table   string `json:"table"`
+	Address uint16 `json:"address"`
+	Type    string `json:"type"`
+	Unit    string `json:"unit,omitempty"`
+	Value   any    `json:"value"`           // In engineering units, null if the read failed
+	Error   string `json:"error,omitempty"` // Why the read failed
+}
+
+// ErrUnknownTag is returned for named points an instance doesn't define.
+var ErrUnknownTag = errors.New("unknown tag")
+
+// Tags reads the named points of all instances through their routes, tags and the
+// register map alike, including those discovered at runtime.
+func (g *Gateway) Tags(ctx context.Context) []TagValue {
+	values := []TagValue{}
+	for _, gw := range g.instances {
+		if gw.Tags == nil {
+			continue
+		}
+		for _, t := range gw.Tags.Tags() {
+			values = append(values, readTag(ctx, gw, t))
+		}
+	}
+	return values
+}
+
+// Tag reads a named point of the named instance, as served at /api/tags/{gateway}/{name}.
+func (g *Gateway) Tag(ctx context.Context, gateway, name string) (TagValue, error) {
+	gw, t, err := g.lookupTag(gateway, name)
+	if err != nil {
+		return TagValue{}, err
+	}
+	return readTag(ctx, gw, t), nil
+}
+
+// WriteTag writes a value to a named point of the named instance and returns the
+// value read back. The value is given in engineering units, a number, bool or string
+// as decoded from JSON, and encoded with the point's type, byte order and scale, so
+// 32-bit and wider values are written as one request in the word order of the device.
+// Errors of values the point can't take match tag.ErrInvalidValue.
+func (g *Gateway) WriteTag(ctx context.Context, gateway, name string, value any) (TagValue, error) {
+	gw, t, err := g.lookupTag(gateway, name)
+	if err != nil {
+		return TagValue{}, err
+	}
+	if err := tag.Write(ctx, gw.Handle, t, value); err != nil {
+		return TagValue{}, err
+	}
+	return readTag(ctx, gw, t), nil
+}
+
+func (g *Gateway) lookupTag(gateway, name string) (*engine.Gateway, tag.Tag, error) {
+	for _, gw := range g.instances {
+		if gw.Name != gateway || gw.Tags == nil {
+			continue
+		}
+		if t, ok := gw.Tags.Lookup(name); ok {
+			return gw, t, nil
+		}
+	}
+	return nil, tag.Tag{}, fmt.Errorf("%w: %s/%s", ErrUnknownTag, gateway, name)
+}
+
+func readTag(ctx context.Context, gw *engine.Gateway, t tag.Tag) TagValue {
+	v := TagValue{Gateway: gw.Name, Name: t.Name, SlaveID: t.SlaveID, Table: t.Table.String(), Address: t.Address, Type: t.Type.String(), Unit: t.Unit}
+	var err error
+	if v.Value, err = tag.Read(ctx, gw.Handle, t); err != nil {
+		v.Error = err.Error()
+	}
+	return v
+}
+
+func (g *Gateway) tags(r *http.Request) (any, error) {
+	return g.Tags(r.Context()), nil
+}
+
+func (g *Gateway) tag(r *http.Request) (any, error) {
+	gateway, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/tags/"), "/")
+	v, err := g.Tag(r.Context(), gateway, name)
+	if errors.Is(err, ErrUnknownTag) {
+		return nil, &api.StatusError{Code: http.StatusNotFound, Err: err}
+	}
+	return v, err
+}
+
+// maxWriteBody bounds the body of a write of a named point.
+const maxWriteBody = 64 << 10
+
+// writeTag writes the value of a body like {"value": 230.5}. The write is labeled as
+// coming from the API caller, so the write ACL and the audit trail apply to it as to
+// the writes of masters.
+func (g *Gateway) writeTag(r *http.Request) (any, error) {
+	gateway, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/tags/"), "/")
+	var body struct {
+		Value any `json:"value"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWriteBody)).Decode(&body); err != nil || body.Value == nil {
+		return nil, &api.StatusError{Code: http.StatusBadRequest, Err: errors.New(`body must be like {"value": 230.5}`)}
+	}
+
+	ctx := transport.WithUpstream(r.Context(), "api")
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = transport.WithClient(ctx, addr)
+	}
+	v, err := g.WriteTag(ctx, gateway, name, body.Value)
+	switch {
+	case errors.Is(err, ErrUnknownTag):
+		return nil, &api.StatusError{Code: http.StatusNotFound, Err: err}
+	case errors.Is(err, tag.ErrInvalidValue):
+		return nil, &api.StatusError{Code: http.StatusBadRequest, Err: err}
+	case err != nil:
+		return nil, &api.StatusError{Code: http.StatusBadGateway, Err: err}
+	}
+	slog.Info("Tag written through the API", "gateway", gateway, "tag", name, "value", body.Value, "client", r.RemoteAddr)
+	return v, nil
+}
+
+// CaptureState is the frame capture of a gateway, served at /api/capture.
+type CaptureState struct {
+	Gateway string `json:"gateway"`
+	File    string `json:"file"`
+	Format  string `json:"format"` // "pcapng" or "jsonl"
+	Enabled bool   `json:"enabled"`
+}
+
+// ErrNoCapture is returned for instances without a capture file configured.
+var ErrNoCapture = errors.New("no frame capture configured")
+
+// Captures returns the frame captures of all instances that configure one.
+func (g *Gateway) Captures() []CaptureState {
+	states := []CaptureState{}
+	for _, gw := range g.instances {
+		if gw.Capture != nil {
+			states = append(states, captureState(gw))
+		}
+	}
+	return states
+}
+
+// SetCapture starts or stops recording the frames of the named instance, as served
+// at /api/capture/{gateway}. Frames are recorded to the file configured.
+func (g *Gateway) SetCapture(gateway string, enabled bool) (CaptureState, error) {
+	for _, gw := range g.instances {
+		if gw.Name == gateway && gw.Capture != nil {
+			gw.Capture.Enable(enabled)
+			return captureState(gw), nil
+		}
+	}
+	return CaptureState{}, fmt.Errorf("%w: %s", ErrNoCapture, gateway)
+}
+
+func captureState(gw *engine.Gateway) CaptureState {
+	return CaptureState{Gateway: gw.Name, File: gw.Capture.File(), Format: gw.Capture.Format(), Enabled: gw.Capture.Enabled()}
+}
+
+func (g *Gateway) captures(r *http.Request) (any, error) {
+	return g.Captures(), nil
+}
+
+func (g *Gateway) capture(r *http.Request) (any, error) {
+	gateway := strings.TrimPrefix(r.URL.Path, "/api/capture/")
+	for _, state := range g.Captures() {
+		if state.Gateway == gateway {
+			return state, nil
+		}
+	}
+	return nil, &api.StatusError{Code: http.StatusNotFound, Err: fmt.Errorf("%w: %s", ErrNoCapture, gateway)}
+}
+
+// setCapture starts or stops a capture with a body like {"enabled": true}.
+func (g *Gateway) setCapture(r *http.Request) (any, error) {
+	gateway := strings.TrimPrefix(r.URL.Path, "/api/capture/")
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWriteBody)).Decode(&body); err != nil || body.Enabled == nil {
+		return nil, &api.StatusError{Code: http.StatusBadRequest, Err: errors.New(`body must be like {"enabled": true}`)}
+	}
+	state, err := g.SetCapture(gateway, *body.Enabled)
+	if errors.Is(err, ErrNoCapture) {
+		return nil, &api.StatusError{Code: http.StatusNotFound, Err: err}
+	}
+	return state, err
+}
+
+// Readiness is the state served at /readyz.
+type Readiness struct {
+	Ready       bool               `json:"ready"`
+	Down        []string           `json:"down,omitempty"` // What keeps the gateway unready, as "gateway/upstream" or "gateway/downstream"
+	Upstreams   []UpstreamStatus   `json:"upstreams"`
+	Downstreams []DownstreamStatus `json:"downstreams"`
+}
+
+// UpstreamStatus is the state of an upstream in the readiness report.
+type UpstreamStatus struct {
+	Gateway   string `json:"gateway"`
+	Upstream  string `json:"upstream"`
+	Listening bool   `json:"listening"` // Bound to its address or device and accepting requests
+}
+
+// DownstreamStatus is the state of a downstream in the readiness report.
+type DownstreamStatus struct {
+	Gateway    string     `json:"gateway"`
+	Downstream string     `json:"downstream"`
+	Breaker    string     `json:"breaker,omitempty"` // State of its circuit breaker, if any
+	Required   bool       `json:"required,omitempty"`
+	Probe      string     `json:"probe,omitempty"`          // "pending", "up" or "down", if probed
+	ProbedAt   *time.Time `json:"probed_at,omitempty"`      // Time of the last probe
+	Error      string     `json:"error,omitempty"`          // Of the last probe
+	Dropped    uint64     `json:"dropped_writes,omitempty"` // Writes its storage dropped, of a local slave
+}
+
+// Readiness reports the gateway unready while it isn't running, while an upstream
+// isn't listening, while the breaker of a downstream marked required is open, or
+// while none of the probed downstreams of an instance answers, so traffic can be
+// steered to a standby.
+func (g *Gateway) Readiness() Readiness {
+	g.mu.Lock()
+	started := g.cancel != nil
+	g.mu.Unlock()
+
+	state := Readiness{Upstreams: []UpstreamStatus{}, Downstreams: []DownstreamStatus{}}
+	for _, gw := range g.instances {
+		for _, name := range gw.Unready() {
+			state.Down = append(state.Down, gw.Name+"/"+name)
+		}
+
+		listening := gw.Listening()
+		for _, name := range sortedKeys(listening) {
+			state.Upstreams = append(state.Upstreams, UpstreamStatus{Gateway: gw.Name, Upstream: name, Listening: listening[name]})
+		}
+
+		names := make(map[string]bool)
+		for _, name := range gw.DownstreamNames {
+			names[name] = true
+		}
+		for _, name := range sortedKeys(names) {
+			ds := DownstreamStatus{Gateway: gw.Name, Downstream: name}
+			if b, ok := gw.Breakers[name]; ok {
+				ds.Breaker = b.State()
+				_, ds.Required = gw.Required[name]
+			}
+			if p, ok := gw.Probes[name]; ok {
+				var probed time.Time
+				var err error
+				ds.Probe, probed, err = p.State()
+				if !probed.IsZero() {
+					ds.ProbedAt = &probed
+				}
+				if err != nil {
+					ds.Error = err.Error()
+				}
+			}
+			if p, ok := gw.Persisted[name]; ok {
+				ds.Dropped = p.Dropped()
+			}
+			state.Downstreams = append(state.Downstreams, ds)
+		}
+	}
+	state.Ready = started && len(state.Down) == 0
+	return state
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (g *Gateway) ready(r *http.Request) (any, bool) {
+	state := g.Readiness()
+	return state, state.Ready
+}
+
+// Health is the state served at /healthz.
+type Health struct {
+	Alive bool      `json:"alive"`
+	Since time.Time `json:"since"` // Start of the gateway
+}
+
+// Health reports the gateway alive while it runs, regardless of its devices, for a
+// liveness probe. A process whose API can't answer is restarted by the probe timing out.
+func (g *Gateway) Health() Health {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return Health{Alive: g.cancel != nil, Since: g.started}
+}
+
+func (g *Gateway) healthy(r *http.Request) (any, bool) {
+	state := g.Health()
+	return state, state.Alive
+}
@@ -0,0 +1,1266 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func TestGateway_Embedded(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+		},
+	}}}
+
+	var seen byte
+	meter := FromHandler(func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		seen = slaveID
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0x12, 0x34}}, nil
+	})
+
+	gw, err := New(cfg, WithDownstream("plant", "10-12", meter))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := gw.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer gw.Stop()
+	if err := gw.Start(ctx); err == nil {
+		t.Error("second Start() expected error")
+	}
+
+	handle, ok := gw.Handler("plant")
+	if !ok {
+		t.Fatalf("Handler(plant) not found, have %v", gw.Names())
+	}
+
+	// Local slave
+	write := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0, 5, 0xAB, 0xCD}}
+	if _, err := handle(ctx, 1, write); err != nil {
+		t.Fatalf("write to local slave error = %v", err)
+	}
+	resp, err := handle(ctx, 1, modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 5, 0, 1}})
+	if err != nil || !bytes.Equal(resp.Data, []byte{2, 0xAB, 0xCD}) {
+		t.Errorf("read from local slave = %+v, %v", resp, err)
+	}
+
+	// Injected handler
+	resp, err = handle(ctx, 11, modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}})
+	if err != nil || seen != 11 || !bytes.Equal(resp.Data, []byte{2, 0x12, 0x34}) {
+		t.Errorf("read from injected handler = %+v, %v (slave %d)", resp, err, seen)
+	}
+
+	// Unrouted slave
+	if _, err := handle(ctx, 99, modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}); err == nil {
+		t.Error("request to unrouted slave expected error")
+	}
+}
+
+// chanUpstream is an upstream passing the requests of a channel to the gateway.
+type chanUpstream struct {
+	reqs chan modbus.ProtocolDataUnit
+	errs chan error
+}
+
+func (u *chanUpstream) Start(ctx context.Context, handler transport.RequestHandler) error {
+	transport.Listening(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case req := <-u.reqs:
+			_, err := handler(ctx, 1, req)
+			u.errs <- err
+		}
+	}
+}
+
+func (u *chanUpstream) Close() error { return nil }
+
+func TestGateway_Events(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Name: "slave", Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+		},
+	}}}
+	us := &chanUpstream{reqs: make(chan modbus.ProtocolDataUnit), errs: make(chan error)}
+	gw, err := New(cfg, WithUpstream("plant", us))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	events := make(chan Event, 10)
+	unsubscribe := gw.Subscribe(func(ev Event) { events <- ev })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := gw.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Stop()
+	if ev := <-events; ev.Type != EventUpstream || ev.Gateway != "plant" || ev.Upstream != "embedded" || !ev.Up {
+		t.Errorf("first event = %+v, want the upstream listening", ev)
+	}
+
+	write := pdu.WriteSingleRegisterRequest{Address: 5, Value: 0xABCD}.PDU()
+	us.reqs <- write
+	if err := <-us.errs; err != nil {
+		t.Fatalf("write through the upstream error = %v", err)
+	}
+	ev := <-events
+	if ev.Type != EventRequest || ev.Upstream != "embedded" || ev.Downstream != "slave" || ev.SlaveID != 1 ||
+		!reflect.DeepEqual(ev.Request, write) || ev.Response.FunctionCode != write.FunctionCode || ev.Err != nil || ev.Time.IsZero() {
+		t.Errorf("request event = %+v", ev)
+	}
+
+	unsubscribe()
+	us.reqs <- pdu.ReadHoldingRegistersRequest{Address: 5, Quantity: 1}.PDU()
+	<-us.errs
+	select {
+	case ev := <-events:
+		t.Errorf("event %+v after unsubscribing", ev)
+	default:
+	}
+}
+
+func TestGateway_Middleware(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+		},
+	}}}
+	// Setpoints above 1000 are written as 1000
+	clamp := func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+			if req.FunctionCode == modbus.FuncCodeWriteSingleRegister && binary.BigEndian.Uint16(req.Data[2:]) > 1000 {
+				req.Data = binary.BigEndian.AppendUint16(req.Data[:2:2], 1000)
+			}
+			return next(ctx, slaveID, req)
+		}
+	}
+	rewrite, err := RewriteSlaveIDs("10:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var observed []byte
+	metrics := Metrics(func(slaveID byte, req, resp modbus.ProtocolDataUnit, elapsed time.Duration, err error) {
+		observed = append(observed, slaveID)
+	})
+	gw, err := New(cfg, WithMiddleware("plant", metrics, rewrite), WithMiddleware("plant", clamp))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	if _, err := handle(context.Background(), 10, pdu.WriteSingleRegisterRequest{Address: 5, Value: 5000}.PDU()); err != nil {
+		t.Fatalf("write through the middlewares error = %v", err)
+	}
+	resp, err := handle(context.Background(), 1, pdu.ReadHoldingRegistersRequest{Address: 5, Quantity: 1}.PDU())
+	if err != nil || !bytes.Equal(resp.Data, []byte{2, 0x03, 0xE8}) {
+		t.Errorf("read of the clamped setpoint = %+v, %v, want 1000", resp, err)
+	}
+	if !bytes.Equal(observed, []byte{10, 1}) {
+		t.Errorf("metrics observed slaves %v, want 10 and 1", observed)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New(&Config{}); err == nil {
+		t.Error("New() without gateways expected error")
+	}
+
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name:        "dup",
+		Downstreams: []DownstreamConfig{{Type: "local", SlaveIDs: "1-3"}},
+	}}}
+	nop := FromHandler(func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return pdu, nil
+	})
+	if _, err := New(cfg, WithDownstream("dup", "3", nop)); err == nil {
+		t.Error("New() with duplicate route expected error")
+	}
+}
+
+func TestGateway_Devices(t *testing.T) {
+	cfg := &Config{
+		Gateways: []GatewayConfig{{Name: "plant", DeviceID: DeviceIDConfig{Cache: true}}},
+		API:      APIConfig{Address: "127.0.0.1:0"},
+	}
+	meter := FromHandler(func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x0E, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x04, 'A', 'c', 'm', 'e'}}, nil
+	})
+	gw, err := New(cfg, WithDownstream("plant", "", meter))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	if _, err := handle(context.Background(), 5, modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadDeviceIdentification, Data: []byte{0x0E, 0x01, 0x00}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	gw.api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/devices", nil))
+	var devices []struct {
+		Gateway string            `json:"gateway"`
+		SlaveID byte              `json:"slave_id"`
+		Objects map[string]string `json:"objects"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &devices); err != nil {
+		t.Fatalf("GET /api/devices = %d %s: %v", rec.Code, rec.Body, err)
+	}
+	if len(devices) != 1 || devices[0].Gateway != "plant" || devices[0].SlaveID != 5 || devices[0].Objects["vendor_name"] != "Acme" {
+		t.Errorf("GET /api/devices = %+v", devices)
+	}
+
+	rec = httptest.NewRecorder()
+	gw.api.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/devices", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/devices = %d, want 405", rec.Code)
+	}
+}
+
+func TestGateway_Discover(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{{
+			Type:     "local",
+			Local:    LocalConfig{Persistence: PersistenceConfig{Type: "memory"}},
+			Discover: DiscoverConfig{SlaveIDs: "4-5"},
+		}},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	read := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+	if _, err := handle(context.Background(), 5, read); err == nil {
+		t.Fatal("slave 5 routed before discovery")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := gw.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := handle(ctx, 5, read)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slave 5 not routed after discovery: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := handle(ctx, 6, read); err == nil {
+		t.Error("slave 6 routed although not probed")
+	}
+}
+
+func TestGateway_Readiness(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+
+	cfg := &Config{
+		Gateways: []GatewayConfig{{
+			Name: "plant",
+			Downstreams: []DownstreamConfig{
+				{Name: "plc", Type: "tcp", SlaveIDs: "1", Tcp: TcpConfig{Address: closed}, Required: true, Breaker: BreakerConfig{Failures: 2}},
+				{Type: "local", SlaveIDs: "2", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+			},
+		}},
+		API: APIConfig{Address: "127.0.0.1:0"},
+	}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	probe := func() int {
+		rec := httptest.NewRecorder()
+		gw.api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+	if code := probe(); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz before start = %d, want 503", code)
+	}
+	if err := gw.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Stop()
+	if code := probe(); code != http.StatusOK {
+		t.Errorf("GET /readyz = %d, want 200", code)
+	}
+
+	handle, _ := gw.Handler("plant")
+	read := pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 1}.PDU()
+	for i := 0; i < 2; i++ {
+		if _, err := handle(context.Background(), 1, read); !errors.Is(err, modbus.ErrConnection) {
+			t.Fatalf("read from unreachable slave error = %v", err)
+		}
+	}
+	if state := gw.Readiness(); state.Ready || len(state.Down) != 1 || state.Down[0] != "plant/plc" {
+		t.Errorf("Readiness() = %+v", state)
+	}
+	if code := probe(); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz with open breaker = %d, want 503", code)
+	}
+	want := []BreakerState{{Gateway: "plant", Downstream: "plc", State: "open", Failures: 2, Required: true}}
+	if got := gw.Breakers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Breakers() = %+v, want %+v", got, want)
+	}
+	if _, err := handle(context.Background(), 2, read); err != nil {
+		t.Errorf("read from other downstream error = %v", err)
+	}
+}
+
+func TestGateway_ReadinessProbes(t *testing.T) {
+	free := func() string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		return ln.Addr().String()
+	}
+	listen, closed := free(), free()
+
+	cfg := &Config{
+		Gateways: []GatewayConfig{{
+			Name:      "plant",
+			Upstreams: []UpstreamConfig{{Type: "tcp", Tcp: TcpConfig{Address: listen}}},
+			Downstreams: []DownstreamConfig{
+				{Name: "plc", Type: "tcp", SlaveIDs: "1", Tcp: TcpConfig{Address: closed}, Timeout: 100 * time.Millisecond, Probe: ProbeConfig{Interval: 10 * time.Millisecond}},
+				{Name: "meter", Type: "local", SlaveIDs: "2", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}, Probe: ProbeConfig{Interval: 10 * time.Millisecond}},
+			},
+		}},
+		API: APIConfig{Address: "127.0.0.1:0"},
+	}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	get := func(path string) (int, Readiness) {
+		rec := httptest.NewRecorder()
+		gw.api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var v Readiness
+		json.Unmarshal(rec.Body.Bytes(), &v)
+		return rec.Code, v
+	}
+	if code, v := get("/readyz"); code != http.StatusServiceUnavailable || len(v.Upstreams) != 1 || v.Upstreams[0].Listening {
+		t.Errorf("GET /readyz before start = %d %+v, want 503 and the upstream not listening", code, v)
+	}
+	if code, _ := get("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /healthz before start = %d, want 503", code)
+	}
+	if err := gw.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Stop()
+
+	// Ready once the upstream listens and the meter answers its probe, the plc never does
+	var state Readiness
+	for i := 0; i < 100 && !state.Ready; i++ {
+		time.Sleep(10 * time.Millisecond)
+		state = gw.Readiness()
+	}
+	if !state.Ready || !state.Upstreams[0].Listening {
+		t.Fatalf("Readiness() = %+v, want ready", state)
+	}
+	if code, _ := get("/readyz"); code != http.StatusOK {
+		t.Errorf("GET /readyz = %d, want 200", code)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200", code)
+	}
+	for i := 0; i < 100 && state.Downstreams[1].Probe != "down"; i++ {
+		time.Sleep(10 * time.Millisecond)
+		state = gw.Readiness()
+	}
+	meter, plc := state.Downstreams[0], state.Downstreams[1]
+	if meter.Downstream != "meter" || meter.Probe != "up" || meter.ProbedAt == nil {
+		t.Errorf("meter = %+v, want probed up", meter)
+	}
+	if plc.Downstream != "plc" || plc.Probe != "down" || plc.Error == "" {
+		t.Errorf("plc = %+v, want probed down", plc)
+	}
+
+	// Without a downstream answering its probe the gateway is unready
+	cfg.Gateways[0].Upstreams = nil
+	cfg.Gateways[0].Downstreams = cfg.Gateways[0].Downstreams[:1]
+	other, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := other.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	for i := 0; i < 100 && (len(state.Downstreams) != 1 || state.Downstreams[0].Probe != "down"); i++ {
+		time.Sleep(10 * time.Millisecond)
+		state = other.Readiness()
+	}
+	if state.Ready || len(state.Down) != 1 || state.Down[0] != "plant/plc" {
+		t.Errorf("Readiness() = %+v, want unready for plc", state)
+	}
+}
+
+func TestGateway_Report(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{Name: "plant"}}}
+	meter := FromHandler(func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if slaveID == 2 {
+			return modbus.ProtocolDataUnit{}, modbus.ErrTimeout
+		}
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0, 0}}, nil
+	})
+	gw, err := New(cfg, WithDownstream("plant", "1-2", meter))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	read := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+	handle(context.Background(), 1, read)
+	handle(context.Background(), 1, read)
+	handle(context.Background(), 2, read)
+
+	report := gw.Report()
+	if len(report) != 2 || report[0].Requests != 2 || report[1].Errors["timeout"] != 1 || report[1].ErrorRate != 1 {
+		t.Errorf("Report() = %+v", report)
+	}
+	if report[0].Upstream != "service" || report[0].Downstream != "embedded" {
+		t.Errorf("Report() labels = %q, %q", report[0].Upstream, report[0].Downstream)
+	}
+	var buf bytes.Buffer
+	if err := gw.WriteReport(&buf); err != nil || !strings.Contains(buf.String(), "plant") {
+		t.Errorf("WriteReport() = %q, %v", buf.String(), err)
+	}
+}
+
+func TestGateway_Dashboard(t *testing.T) {
+	cfg := &Config{
+		Gateways: []GatewayConfig{{Name: "plant"}},
+		API:      APIConfig{Address: "127.0.0.1:0", Dashboard: true, Transactions: 2},
+	}
+	meter := FromHandler(func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0x12, 0x34}}, nil
+	})
+	gw, err := New(cfg, WithDownstream("plant", "1-3,5", meter))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	read := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+	for _, slaveID := range []byte{1, 2, 9} {
+		handle(context.Background(), slaveID, read)
+	}
+
+	get := func(path string, v any) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if v != nil {
+			if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+				t.Fatalf("GET %s = %d %s: %v", path, rec.Code, rec.Body, err)
+			}
+		}
+		return rec
+	}
+
+	var routes []Route
+	get("/api/routes", &routes)
+	if want := []Route{{Gateway: "plant", SlaveIDs: "1-3,5", Downstream: "embedded"}}; !reflect.DeepEqual(routes, want) {
+		t.Errorf("GET /api/routes = %+v, want %+v", routes, want)
+	}
+
+	var txs []Transaction
+	get("/api/transactions", &txs)
+	if len(txs) != 2 {
+		t.Fatalf("GET /api/transactions = %+v, want the last 2", txs)
+	}
+	if tx := txs[0]; tx.SlaveID != 9 || tx.Exception != modbus.ExceptionCodeGatewayPathUnavailable || tx.Downstream != "" {
+		t.Errorf("unrouted transaction = %+v", tx)
+	}
+	if tx := txs[1]; tx.SlaveID != 2 || tx.Request != "0300000001" || tx.Response != "03021234" || tx.Downstream != "embedded" {
+		t.Errorf("read transaction = %+v", tx)
+	}
+
+	if rec := get("/", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "api/transactions") {
+		t.Errorf("GET / = %d, want the dashboard", rec.Code)
+	}
+	if rec := get("/missing", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /missing = %d, want 404", rec.Code)
+	}
+}
+
+func TestGateway_Tags(t *testing.T) {
+	cfg := &Config{
+		Gateways: []GatewayConfig{{
+			Name: "plant",
+			Tags: []TagConfig{{Name: "relay", SlaveID: 1, Table: "coil", Address: "0"}},
+			Registers: []TagConfig{
+				{Name: "grid_power", SlaveID: 1, Table: "input_register", Address: "10", Type: "int16", Scale: 0.1, Unit: "kW"},
+				{Name: "offline_meter", SlaveID: 2, Address: "0"},
+			},
+		}},
+		API: APIConfig{Address: "127.0.0.1:0"},
+	}
+	meter := FromHandler(func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if slaveID != 1 {
+			return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: pdu.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond}
+		}
+		if pdu.FunctionCode == modbus.FuncCodeReadCoils {
+			return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{1, 1}}, nil
+		}
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0, 32}}, nil
+	})
+	gw, err := New(cfg, WithDownstream("plant", "", meter))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	gw.api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/tags", nil))
+	var values []TagValue
+	if err := json.Unmarshal(rec.Body.Bytes(), &values); err != nil {
+		t.Fatalf("GET /api/tags = %d %s: %v", rec.Code, rec.Body, err)
+	}
+	if len(values) != 3 {
+		t.Fatalf("GET /api/tags = %+v, want the tag and both registers", values)
+	}
+	if v := values[0]; v.Name != "relay" || v.Value != true {
+		t.Errorf("relay = %+v", v)
+	}
+	if v := values[1]; v.Name != "grid_power" || v.Table != "input_register" || v.Unit != "kW" || v.Value != 3.2 {
+		t.Errorf("grid_power = %+v", v)
+	}
+	if v := values[2]; v.Name != "offline_meter" || v.Value != nil || v.Error == "" {
+		t.Errorf("offline_meter = %+v, want the read failure", v)
+	}
+
+	cfg.Gateways[0].Registers[1].Name = "relay"
+	if _, err := New(cfg, WithDownstream("plant", "", meter)); err == nil {
+		t.Error("New() with a register named like a tag succeeded")
+	}
+}
+
+func TestGateway_WriteTag(t *testing.T) {
+	cfg := &Config{
+		Gateways: []GatewayConfig{{
+			Name: "plant",
+			Downstreams: []DownstreamConfig{
+				{Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+			},
+			Registers: []TagConfig{
+				{Name: "setpoint", SlaveID: 1, Address: "0", Type: "float32", ByteOrder: "CDAB", Unit: "kW"},
+				{Name: "limit", SlaveID: 1, Address: "2", Type: "int32", Scale: 0.1},
+				{Name: "serial", SlaveID: 1, Address: "4", Type: "string", Length: 4},
+				{Name: "power", SlaveID: 1, Table: "input_register", Address: "0"},
+			},
+		}},
+		API: APIConfig{Address: "127.0.0.1:0", Writes: true},
+	}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	do := func(method, path, body string) (*httptest.ResponseRecorder, TagValue) {
+		rec := httptest.NewRecorder()
+		gw.api.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var v TagValue
+		json.Unmarshal(rec.Body.Bytes(), &v)
+		return rec, v
+	}
+
+	for _, tt := range []struct {
+		path, body string
+		want       any
+	}{
+		{"/api/tags/plant/setpoint", `{"value": 12.5}`, 12.5},
+		{"/api/tags/plant/limit", `{"value": -230.4}`, -230.4},
+		{"/api/tags/plant/serial", `{"value": "SN-42"}`, "SN-42"},
+	} {
+		if rec, v := do(http.MethodPut, tt.path, tt.body); rec.Code != http.StatusOK || v.Value != tt.want {
+			t.Errorf("PUT %s %s = %d %s, want %v", tt.path, tt.body, rec.Code, rec.Body, tt.want)
+		}
+		if rec, v := do(http.MethodGet, tt.path, ""); rec.Code != http.StatusOK || v.Value != tt.want {
+			t.Errorf("GET %s = %d %s, want %v", tt.path, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	// The words are composed in the order of the device, low word first
+	handle, _ := gw.Handler("plant")
+	resp, err := handle(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 4}})
+	if want := []byte{8, 0x00, 0x00, 0x41, 0x48, 0xFF, 0xFF, 0xF7, 0x00}; err != nil || !bytes.Equal(resp.Data, want) {
+		t.Errorf("registers = % x, %v, want % x", resp.Data, err, want)
+	}
+
+	for _, tt := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/api/tags/plant/limit", `{"value": "high"}`, http.StatusBadRequest},
+		{"/api/tags/plant/serial", `{"value": "much too long"}`, http.StatusBadRequest},
+		{"/api/tags/plant/power", `{"value": 1}`, http.StatusBadRequest},
+		{"/api/tags/plant/setpoint", `12.5`, http.StatusBadRequest},
+		{"/api/tags/plant/missing", `{"value": 1}`, http.StatusNotFound},
+		{"/api/tags/other/setpoint", `{"value": 1}`, http.StatusNotFound},
+	} {
+		if rec, _ := do(http.MethodPut, tt.path, tt.body); rec.Code != tt.code {
+			t.Errorf("PUT %s %s = %d %s, want %d", tt.path, tt.body, rec.Code, rec.Body, tt.code)
+		}
+	}
+
+	cfg.API.Writes = false
+	if gw, err = New(cfg); err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if rec, _ := do(http.MethodPut, "/api/tags/plant/setpoint", `{"value": 1}`); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT without writes enabled = %d, want 405", rec.Code)
+	}
+}
+
+func TestGateway_WriteACL(t *testing.T) {
+	trail := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name:     "plant",
+		WriteACL: []WriteRuleConfig{{Clients: []string{"10.1.0.0/16"}, SlaveIDs: "1", Addresses: "0-9"}},
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+		},
+	}}, Audit: AuditConfig{File: trail}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	write := pdu.WriteSingleRegisterRequest{Address: 5, Value: 42}.PDU()
+
+	allowed := transport.WithClient(context.Background(), &net.TCPAddr{IP: net.ParseIP("10.1.0.9"), Port: 1024})
+	if resp, err := handle(allowed, 1, write); err != nil || resp.FunctionCode != write.FunctionCode {
+		t.Errorf("allowed write = %+v, %v", resp, err)
+	}
+
+	denied := transport.WithClient(context.Background(), &net.TCPAddr{IP: net.ParseIP("10.9.0.9"), Port: 1024})
+	_, err = handle(denied, 1, write)
+	if modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataAddress {
+		t.Errorf("denied write error = %v", err)
+	}
+	if _, err := handle(denied, 1, pdu.ReadHoldingRegistersRequest{Address: 5, Quantity: 1}.PDU()); err != nil {
+		t.Errorf("read of a client without write access = %v", err)
+	}
+
+	// Both writes are audited with their result
+	gw.Stop()
+	data, _ := os.ReadFile(trail)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"client":"10.1.0.9:1024"`) || !strings.Contains(lines[0], `"result":"ok"`) ||
+		!strings.Contains(lines[1], `"client":"10.9.0.9:1024"`) || !strings.Contains(lines[1], `"result":"modbus: exception '2' (illegal data address)`) {
+		t.Errorf("audit trail =\n%s", data)
+	}
+}
+
+func TestGateway_RejectsIncompleteResponses(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{Name: "plant"}}}
+	meter := FromHandler(func(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return pdu.ReadResponse(req.FunctionCode, make([]byte, 2*int(slaveID))), nil // Registers as many as the slave ID
+	})
+	gw, err := New(cfg, WithDownstream("plant", "", meter))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	read := pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 3}.PDU()
+	if _, err := handle(context.Background(), 3, read); err != nil {
+		t.Errorf("complete response error = %v", err)
+	}
+	for _, slaveID := range []byte{2, 4} {
+		if _, err := handle(context.Background(), slaveID, read); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeServerDeviceFailure {
+			t.Errorf("response of %d registers to a read of 3: error = %v, want Server Device Failure", slaveID, err)
+		}
+	}
+	if report := gw.Report(); report[0].Errors["invalid_frame"] != 1 {
+		t.Errorf("Report() = %+v, want an invalid frame", report)
+	}
+}
+
+func TestGateway_ReportServerID(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDs: "1", Local: LocalConfig{ServerID: ServerIDConfig{ID: "0A01", Additional: "GW"}}},
+			{Type: "local", SlaveIDs: "2", Local: LocalConfig{ServerID: ServerIDConfig{Stopped: true}}},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	req := pdu.ReportServerIDRequest{}.PDU()
+	if resp, err := handle(context.Background(), 1, req); err != nil || !bytes.Equal(resp.Data, []byte{5, 0x0A, 0x01, 0xFF, 'G', 'W'}) {
+		t.Errorf("slave 1 Report Server ID = % X, %v", resp.Data, err)
+	}
+	if resp, err := handle(context.Background(), 2, req); err != nil || !bytes.Equal(resp.Data, []byte{2, 0x01, 0x00}) {
+		t.Errorf("slave 2 Report Server ID = % X, %v", resp.Data, err)
+	}
+
+	// A slave with an invalid server ID stops the gateway from starting, like other broken downstreams
+	cfg.Gateways[0].Downstreams[0].Local.ServerID.ID = "0xZZ"
+	if _, err = New(cfg); err == nil {
+		t.Error("New() with an invalid server ID expected error")
+	}
+}
+
+func TestGateway_ReadFIFOQueue(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{{Type: "local", SlaveIDs: "1", Local: LocalConfig{
+			FIFOQueues: []FIFOQueueConfig{{Address: 100}, {Address: 200, ClearOnRead: true}},
+		}}},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	ctx := context.Background()
+
+	// Events are queued by writing to the pointer address
+	handle(ctx, 1, pdu.WriteSingleRegisterRequest{Address: 100, Value: 0x01B8}.PDU())
+	handle(ctx, 1, pdu.WriteMultipleRegistersRequest{Address: 100, Values: []uint16{0x1284}}.PDU())
+	want := []byte{0, 6, 0, 2, 0x01, 0xB8, 0x12, 0x84}
+	for i := 0; i < 2; i++ {
+		if resp, err := handle(ctx, 1, pdu.ReadFIFOQueueRequest{Address: 100}.PDU()); err != nil || !bytes.Equal(resp.Data, want) {
+			t.Errorf("read %d of the queue = % X, %v, want % X", i+1, resp.Data, err, want)
+		}
+	}
+	if resp, _ := handle(ctx, 1, pdu.ReadHoldingRegistersRequest{Address: 100, Quantity: 1}.PDU()); !bytes.Equal(resp.Data, []byte{2, 0, 0}) {
+		t.Errorf("holding register at the pointer address = % X, want untouched", resp.Data)
+	}
+
+	// A full queue keeps the last 31 values
+	values := make([]uint16, 40)
+	for i := range values {
+		values[i] = uint16(i)
+	}
+	handle(ctx, 1, pdu.WriteMultipleRegistersRequest{Address: 200, Values: values}.PDU())
+	resp, err := handle(ctx, 1, pdu.ReadFIFOQueueRequest{Address: 200}.PDU())
+	if err != nil || len(resp.Data) != 4+2*31 || resp.Data[3] != 31 || resp.Data[5] != 9 {
+		t.Errorf("read of a full queue = % X, %v", resp.Data, err)
+	}
+	if resp, _ := handle(ctx, 1, pdu.ReadFIFOQueueRequest{Address: 200}.PDU()); !bytes.Equal(resp.Data, []byte{0, 2, 0, 0}) {
+		t.Errorf("read of a cleared queue = % X, want empty", resp.Data)
+	}
+
+	if resp, err := handle(ctx, 1, pdu.ReadFIFOQueueRequest{Address: 300}.PDU()); err != nil || resp.FunctionCode != 0x98 || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalDataAddress}) {
+		t.Errorf("read of no queue = %+v, %v, want Illegal Data Address", resp, err)
+	}
+}
+
+func TestGateway_LocalValidAddresses(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{{Type: "local", SlaveIDs: "1", Local: LocalConfig{
+			ValidAddresses: map[string]string{"holding_register": "0-9, 10-19, 100-109", "coil": "0-7"},
+		}}},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	for _, tt := range []struct {
+		name  string
+		req   modbus.ProtocolDataUnit
+		legal bool
+	}{
+		{"read across adjacent ranges", pdu.ReadHoldingRegistersRequest{Address: 5, Quantity: 15}.PDU(), true},
+		{"read past a range", pdu.ReadHoldingRegistersRequest{Address: 15, Quantity: 6}.PDU(), false},
+		{"read in a hole", pdu.ReadHoldingRegistersRequest{Address: 50, Quantity: 1}.PDU(), false},
+		{"write in a range", pdu.WriteSingleRegisterRequest{Address: 109, Value: 1}.PDU(), true},
+		{"write past a range", pdu.WriteMultipleRegistersRequest{Address: 108, Values: []uint16{1, 2, 3}}.PDU(), false},
+		{"mask write in a hole", pdu.MaskWriteRegisterRequest{Address: 20, AndMask: 0xFFFF}.PDU(), false},
+		{"coil write past a range", pdu.WriteSingleCoilRequest{Address: 8, Value: true}.PDU(), false},
+		{"read of a table not restricted", pdu.ReadInputRegistersRequest{Address: 60000, Quantity: 2}.PDU(), true},
+	} {
+		resp, err := handle(context.Background(), 1, tt.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		illegal := resp.FunctionCode == tt.req.FunctionCode|0x80 && bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalDataAddress})
+		if illegal == tt.legal {
+			t.Errorf("%s: response % X %X, want legal %v", tt.name, resp.FunctionCode, resp.Data, tt.legal)
+		}
+	}
+
+	cfg.Gateways[0].Downstreams[0].Local.ValidAddresses = map[string]string{"register": "0-9"}
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with valid addresses of an unknown table succeeded")
+	}
+}
+
+func TestGateway_LocalInitialValues(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "presets.csv")
+	csv := "table,address,values\nholding_register,101,0x0200 7\ncoil,3,1 0 1\n"
+	if err := os.WriteFile(file, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{{Type: "local", SlaveIDs: "1", Local: LocalConfig{
+			InitialValues: []InitialValueConfig{
+				{Table: "holding_register", Address: 100, Values: []uint16{1234, 1}},
+				{Table: "input_register", Address: 0, Values: []uint16{0xFFFF}},
+			},
+			InitialValuesFile: file,
+		}}},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		req  modbus.ProtocolDataUnit
+		want []byte
+	}{
+		{pdu.ReadHoldingRegistersRequest{Address: 100, Quantity: 3}.PDU(), []byte{6, 0x04, 0xD2, 0x02, 0x00, 0, 7}}, // The file overrides 101
+		{pdu.ReadInputRegistersRequest{Address: 0, Quantity: 1}.PDU(), []byte{2, 0xFF, 0xFF}},
+		{pdu.ReadCoilsRequest{Address: 0, Quantity: 8}.PDU(), []byte{1, 0x28}},
+	} {
+		if resp, err := handle(ctx, 1, tt.req); err != nil || !bytes.Equal(resp.Data, tt.want) {
+			t.Errorf("read fc %d = % X, %v, want % X", tt.req.FunctionCode, resp.Data, err, tt.want)
+		}
+	}
+
+	cfg.Gateways[0].Downstreams[0].Local.InitialValues = []InitialValueConfig{{Table: "coil", Address: 0, Values: []uint16{2}}}
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with a coil initialized to 2 succeeded")
+	}
+}
+
+func TestGateway_LocalProfiles(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDs: "1", Local: LocalConfig{Profile: "energy_meter"}},
+			{Type: "local", SlaveIDs: "2", Local: LocalConfig{Profile: "inverter", Expressions: []ExpressionConfig{
+				{Table: "input_register", Address: 4, Expr: "4999"}, // Overrides the frequency of the profile
+			}}},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	ctx := context.Background()
+
+	resp, err := handle(ctx, 1, pdu.ReadInputRegistersRequest{Address: 0, Quantity: 10}.PDU())
+	if err != nil || len(resp.Data) != 21 {
+		t.Fatalf("meter read = % X, %v", resp.Data, err)
+	}
+	if v := binary.BigEndian.Uint16(resp.Data[1:]); v < 2280 || v > 2320 {
+		t.Errorf("meter voltage L1 = %d, want about 2300", v)
+	}
+	if resp, _ := handle(ctx, 1, pdu.ReadInputRegistersRequest{Address: 10, Quantity: 1}.PDU()); resp.FunctionCode != 0x84 {
+		t.Errorf("read past the meter map = %+v, want Illegal Data Address", resp)
+	}
+	if resp, _ := handle(ctx, 1, pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 1}.PDU()); !bytes.Equal(resp.Data, []byte{2, 0x0B, 0xB9}) {
+		t.Errorf("meter model number = % X, want 3001", resp.Data)
+	}
+
+	handle(ctx, 2, pdu.WriteSingleRegisterRequest{Address: 0, Value: 0}.PDU()) // Power limit 0%
+	resp, err = handle(ctx, 2, pdu.ReadInputRegistersRequest{Address: 3, Quantity: 2}.PDU())
+	if err != nil || !bytes.Equal(resp.Data, []byte{4, 0, 0, 0x13, 0x87}) {
+		t.Errorf("inverter power and frequency = % X, %v, want 0 W and 49.99 Hz", resp.Data, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "pump.yaml")
+	profile := "initial_values:\n  - {table: input_register, address: 0, values: [42]}\n"
+	if err := os.WriteFile(file, []byte(profile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateways[0].Downstreams = cfg.Gateways[0].Downstreams[:1]
+	cfg.Gateways[0].Downstreams[0].Local.Profile = file
+	if gw, err = New(cfg); err != nil {
+		t.Fatalf("New() with a profile file error = %v", err)
+	}
+	handle, _ = gw.Handler("plant")
+	if resp, _ := handle(ctx, 1, pdu.ReadInputRegistersRequest{Address: 0, Quantity: 1}.PDU()); !bytes.Equal(resp.Data, []byte{2, 0, 42}) {
+		t.Errorf("value of a profile file = % X, want 42", resp.Data)
+	}
+
+	cfg.Gateways[0].Downstreams[0].Local.Profile = "boiler"
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with an unknown profile succeeded")
+	}
+}
+
+func TestGateway_LocalUnits(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{{Type: "local", SlaveIDs: "1-3", Local: LocalConfig{Units: []LocalUnitConfig{
+			{SlaveID: 1, LocalConfig: LocalConfig{Persistence: PersistenceConfig{Type: "file", Path: filepath.Join(dir, "unit1.dat")}}},
+			{SlaveID: 2, LocalConfig: LocalConfig{Profile: "energy_meter"}},
+		}}}},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+	ctx := context.Background()
+
+	for id := byte(1); id <= 3; id++ {
+		handle(ctx, id, pdu.WriteSingleRegisterRequest{Address: 50, Value: uint16(id) * 100}.PDU())
+	}
+	for id := byte(1); id <= 3; id++ {
+		resp, err := handle(ctx, id, pdu.ReadHoldingRegistersRequest{Address: 50, Quantity: 1}.PDU())
+		if want := byte(id) * 100; id != 2 && (err != nil || resp.Data[2] != want) {
+			t.Errorf("register 50 of slave %d = % X, %v, want %d", id, resp.Data, err, want)
+		}
+	}
+	// The profile of unit 2 applies to it only
+	if resp, _ := handle(ctx, 2, pdu.ReadHoldingRegistersRequest{Address: 50, Quantity: 1}.PDU()); resp.FunctionCode != 0x83 {
+		t.Errorf("read past the map of unit 2 = %+v, want Illegal Data Address", resp)
+	}
+	if resp, _ := handle(ctx, 3, pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 1}.PDU()); !bytes.Equal(resp.Data, []byte{2, 0, 0}) {
+		t.Errorf("register 0 of slave 3 = % X, want the shared model untouched by the profile", resp.Data)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "unit1.dat.wal")); err != nil || !bytes.Contains(data, []byte{0, 100}) {
+		t.Errorf("unit 1 not persisted: %v", err)
+	}
+
+	cfg.Gateways[0].Downstreams[0].Local.Units[1].Persistence = cfg.Gateways[0].Downstreams[0].Local.Units[0].Persistence
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with units persisting to the same file succeeded")
+	}
+}
+
+func TestGateway_ReadDeviceIdentification(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDs: "1", Local: LocalConfig{DeviceInfo: DeviceInfoConfig{VendorName: "ACME", ProductCode: "GW-1"}}},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	// The revision falls back to the default
+	basic := pdu.ReadDeviceIDRequest{Code: pdu.DeviceIDBasic}.PDU()
+	want := []byte{0x0E, 0x01, 0x81, 0x00, 0x00, 0x03, 0x00, 0x04, 'A', 'C', 'M', 'E', 0x01, 0x04, 'G', 'W', '-', '1', 0x02, 0x03, '1', '.', '0'}
+	if resp, err := handle(context.Background(), 1, basic); err != nil || !bytes.Equal(resp.Data, want) {
+		t.Errorf("basic stream access = % X, %v, want % X", resp.Data, err, want)
+	}
+	individual := pdu.ReadDeviceIDRequest{Code: pdu.DeviceIDIndividual, ObjectID: 0x01}.PDU()
+	want = []byte{0x0E, 0x04, 0x81, 0x00, 0x00, 0x01, 0x01, 0x04, 'G', 'W', '-', '1'}
+	if resp, err := handle(context.Background(), 1, individual); err != nil || !bytes.Equal(resp.Data, want) {
+		t.Errorf("individual access = % X, %v, want % X", resp.Data, err, want)
+	}
+	missing := pdu.ReadDeviceIDRequest{Code: pdu.DeviceIDIndividual, ObjectID: 0x80}.PDU()
+	if resp, err := handle(context.Background(), 1, missing); err != nil || resp.FunctionCode != 0xAB || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalDataAddress}) {
+		t.Errorf("individual access to a missing object = %+v, %v, want Illegal Data Address", resp, err)
+	}
+}
+
+func TestGateway_SlaveIDMap(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDMap: "10:1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+			{Type: "local", SlaveIDs: "2", SlaveIDMap: "11:1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	// Both devices answer to unit ID 1 on their own bus
+	write := pdu.WriteSingleRegisterRequest{Address: 0, Value: 0x1234}.PDU()
+	if _, err := handle(context.Background(), 10, write); err != nil {
+		t.Fatalf("write through slave 10 error = %v", err)
+	}
+	read := pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 1}.PDU()
+	for _, tt := range []struct {
+		slaveID byte
+		want    []byte
+	}{{10, []byte{2, 0x12, 0x34}}, {11, []byte{2, 0, 0}}, {2, []byte{2, 0, 0}}} {
+		if resp, err := handle(context.Background(), tt.slaveID, read); err != nil || !bytes.Equal(resp.Data, tt.want) {
+			t.Errorf("read through slave %d = % X, %v, want % X", tt.slaveID, resp.Data, err, tt.want)
+		}
+	}
+	if _, err := handle(context.Background(), 1, read); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeGatewayPathUnavailable {
+		t.Errorf("read of unmapped slave 1 error = %v, want Gateway Path Unavailable", err)
+	}
+
+	cfg.Gateways[0].Downstreams[1].SlaveIDMap = "10:1"
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with slave 10 mapped twice succeeded")
+	}
+}
+
+func TestGateway_DefaultRoute(t *testing.T) {
+	memory := LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Name: "meter", Type: "local", SlaveIDs: "1", Local: memory},
+			{Name: "bus", Type: "local", Local: memory},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	// Slave 1 is the meter's, any other the bus's
+	write := pdu.WriteSingleRegisterRequest{Address: 0, Value: 0x1234}.PDU()
+	if _, err := handle(context.Background(), 7, write); err != nil {
+		t.Fatalf("write to slave 7 error = %v", err)
+	}
+	read := pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 1}.PDU()
+	for _, tt := range []struct {
+		slaveID byte
+		want    []byte
+	}{{7, []byte{2, 0x12, 0x34}}, {200, []byte{2, 0x12, 0x34}}, {1, []byte{2, 0, 0}}} {
+		if resp, err := handle(context.Background(), tt.slaveID, read); err != nil || !bytes.Equal(resp.Data, tt.want) {
+			t.Errorf("read of slave %d = % X, %v, want % X", tt.slaveID, resp.Data, err, tt.want)
+		}
+	}
+	want := []Route{{Gateway: "plant", SlaveIDs: "1", Downstream: "meter"}, {Gateway: "plant", SlaveIDs: "*", Downstream: "bus"}}
+	if routes := gw.Routes(); !reflect.DeepEqual(routes, want) {
+		t.Errorf("Routes() = %+v, want %+v", routes, want)
+	}
+
+	// "*" says so explicitly, only one downstream may serve all
+	cfg.Gateways[0].Downstreams[1].SlaveIDs = "*"
+	if _, err := New(cfg); err != nil {
+		t.Errorf("New() with slave_ids \"*\" error = %v", err)
+	}
+	cfg.Gateways[0].Downstreams[0].SlaveIDs = ""
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with two default routes succeeded")
+	}
+}
+
+func TestGateway_AddressRanges(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Name: "meter", Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+			{Name: "inverter", Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}},
+				AddressRanges: []AddressRangeConfig{{Table: "holding_register", Addresses: "100-199", Offset: -100}}},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	// Register 100 of slave 1 is register 0 of the inverter, the meter keeps its own
+	write := pdu.WriteSingleRegisterRequest{Address: 100, Value: 0x1234}.PDU()
+	if resp, err := handle(context.Background(), 1, write); err != nil || !bytes.Equal(resp.Data, write.Data) {
+		t.Fatalf("write of register 100 = % X, %v, want its echo", resp.Data, err)
+	}
+	for _, tt := range []struct {
+		address uint16
+		want    []byte
+	}{{100, []byte{2, 0x12, 0x34}}, {0, []byte{2, 0, 0}}} {
+		read := pdu.ReadHoldingRegistersRequest{Address: tt.address, Quantity: 1}.PDU()
+		if resp, err := handle(context.Background(), 1, read); err != nil || !bytes.Equal(resp.Data, tt.want) {
+			t.Errorf("read of register %d = % X, %v, want % X", tt.address, resp.Data, err, tt.want)
+		}
+	}
+	if routes := gw.Routes(); len(routes) != 1 || routes[0].Downstream != "inverter,meter" {
+		t.Errorf("Routes() = %+v, want slave 1 routed to inverter,meter", routes)
+	}
+}
+
+func TestGateway_FunctionCodes(t *testing.T) {
+	memory := LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Name: "engineering", Type: "local", SlaveIDs: "1", Local: memory, AllowFunctionCodes: "5,6,15,16"},
+			{Name: "mirror", Type: "local", SlaveIDs: "1,2", Local: memory, DenyFunctionCodes: "5,6,15,16"},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	// The write reaches engineering, the read of it the mirror
+	write := pdu.WriteSingleRegisterRequest{Address: 5, Value: 0x1234}.PDU()
+	if resp, err := handle(context.Background(), 1, write); err != nil || !bytes.Equal(resp.Data, write.Data) {
+		t.Fatalf("write to slave 1 = % X, %v, want its echo", resp.Data, err)
+	}
+	read := pdu.ReadHoldingRegistersRequest{Address: 5, Quantity: 1}.PDU()
+	if resp, err := handle(context.Background(), 1, read); err != nil || !bytes.Equal(resp.Data, []byte{2, 0, 0}) {
+		t.Errorf("read of slave 1 = % X, %v, want the mirror's zero", resp.Data, err)
+	}
+	if _, err := handle(context.Background(), 2, write); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalFunction {
+		t.Errorf("write to slave 2 error = %v, want Illegal Function", err)
+	}
+
+	cfg.Gateways[0].Downstreams[0].DenyFunctionCodes = "3"
+	if _, err := New(cfg); err != nil {
+		t.Errorf("New() denying a code engineering doesn't allow error = %v", err)
+	}
+	cfg.Gateways[0].Downstreams[1].DenyFunctionCodes = "6"
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with two downstreams serving writes of slave 1 succeeded")
+	}
+}
+
+func TestGateway_RejectsMalformedRequests(t *testing.T) {
+	cfg := &Config{Gateways: []GatewayConfig{{
+		Name: "plant",
+		Downstreams: []DownstreamConfig{
+			{Type: "local", SlaveIDs: "1", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}},
+		},
+	}}}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handle, _ := gw.Handler("plant")
+
+	tooMany := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 200}}
+	if _, err := handle(context.Background(), 1, tooMany); modbus.ExceptionCodeOf(err) != modbus.ExceptionCodeIllegalDataValue {
+		t.Errorf("read of 200 registers error = %v", err)
+	}
+	if _, err := handle(context.Background(), 1, pdu.ReadHoldingRegistersRequest{Address: 0, Quantity: 125}.PDU()); err != nil {
+		t.Errorf("read of 125 registers error = %v", err)
+	}
+}
+
+func TestGateway_Capture(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	file := filepath.Join(t.TempDir(), "plant.jsonl")
+	cfg := &Config{
+		Gateways: []GatewayConfig{{
+			Name:        "plant",
+			Upstreams:   []UpstreamConfig{{Type: "tcp", Tcp: TcpConfig{Address: addr}}},
+			Downstreams: []DownstreamConfig{{Type: "local", Local: LocalConfig{Persistence: PersistenceConfig{Type: "memory"}}}},
+			Capture:     CaptureConfig{File: file},
+		}},
+		API: APIConfig{Address: "127.0.0.1:0"},
+	}
+	gw, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := gw.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path, body string) (*httptest.ResponseRecorder, CaptureState) {
+		rec := httptest.NewRecorder()
+		gw.api.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var v CaptureState
+		json.Unmarshal(rec.Body.Bytes(), &v)
+		return rec, v
+	}
+	want := CaptureState{Gateway: "plant", File: file, Format: "jsonl"}
+	if rec, v := do(http.MethodGet, "/api/capture/plant", ""); rec.Code != http.StatusOK || v != want {
+		t.Errorf("GET /api/capture/plant = %d %s, want %+v", rec.Code, rec.Body, want)
+	}
+	for _, tt := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/api/capture/plant", `{}`, http.StatusBadRequest},
+		{"/api/capture/other", `{"enabled": true}`, http.StatusNotFound},
+		{"/api/capture/plant", `{"enabled": true}`, http.StatusOK},
+	} {
+		if rec, _ := do(http.MethodPut, tt.path, tt.body); rec.Code != tt.code {
+			t.Errorf("PUT %s %s = %d %s, want %d", tt.path, tt.body, rec.Code, rec.Body, tt.code)
+		}
+	}
+
+	// A request through the upstream, with the capture enabled
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	request := []byte{0x00, 0x07, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x01}
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 260)); err != nil {
+		t.Fatal(err)
+	}
+	if _, v := do(http.MethodPut, "/api/capture/plant", `{"enabled": false}`); v.Enabled {
+		t.Errorf("capture still enabled: %+v", v)
+	}
+	gw.Stop()
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"dir":"upstream rx"`) || !strings.Contains(lines[0], `"adu":"000700000006010300000001"`) || !strings.Contains(lines[1], `"dir":"upstream tx"`) {
+		t.Errorf("capture = %s, want the request and response", b)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/acl"
+	"github.com/ffutop/modbus-gateway/internal/cache"
+	"github.com/ffutop/modbus-gateway/internal/remap"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// Logging logs every request to log once answered, failed ones as warnings.
+func Logging(log *slog.Logger) Middleware {
+	return func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+			start := time.Now()
+			resp, err := next(ctx, slaveID, pdu)
+			if err != nil {
+				log.Warn("Request failed", "slaveID", slaveID, "func", pdu.FunctionCode, "elapsed", time.Since(start), "err", err)
+			} else {
+				log.Info("Request served", "slaveID", slaveID, "func", pdu.FunctionCode, "elapsed", time.Since(start))
+			}
+			return resp, err
+		}
+	}
+}
+
+// Metrics calls observe with every request once answered, e.g. to count requests
+// and their response times in the metrics of the embedding program.
+func Metrics(observe func(slaveID byte, req, resp modbus.ProtocolDataUnit, elapsed time.Duration, err error)) Middleware {
+	return func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+			start := time.Now()
+			resp, err := next(ctx, slaveID, pdu)
+			observe(slaveID, pdu, resp, time.Since(start), err)
+			return resp, err
+		}
+	}
+}
+
+// FunctionCodes answers requests whose function code is not in codes, e.g. "1-4,6,16",
+// with Illegal Function, as function_codes of an upstream does for all of a gateway.
+func FunctionCodes(codes string) (Middleware, error) {
+	return acl.FunctionMiddleware(codes)
+}
+
+// Cache answers reads from the responses of the same reads within ttl, as the
+// cache of a downstream does. Writes to a slave drop its cached responses.
+func Cache(ttl time.Duration) Middleware {
+	return func(next RequestHandler) RequestHandler {
+		return cache.Wrap(FromHandler(next), ttl).Send
+	}
+}
+
+// RewriteSlaveIDs translates the slave IDs of requests as mapped in ids, e.g.
+// "10:1, 11:2", before they are routed. Other slave IDs pass unchanged.
+func RewriteSlaveIDs(ids string) (Middleware, error) {
+	m, err := remap.Parse(ids)
+	if err != nil {
+		return nil, err
+	}
+	return func(next RequestHandler) RequestHandler {
+		return remap.Wrap(FromHandler(next), m).Send
+	}, nil
+}
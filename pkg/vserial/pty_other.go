@@ -0,0 +1,16 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+//go:build !linux
+
+package vserial
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func openPTY() (*end, error) {
+	return nil, fmt.Errorf("vserial: virtual serial ports are not supported on %s", runtime.GOOS)
+}
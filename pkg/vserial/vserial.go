@@ -0,0 +1,112 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+/*
+Package vserial creates two pseudo-terminals wired to each other, standing in for a
+pair of serial ports connected by a null-modem cable. It replaces
+"socat pty,raw,echo=0 pty,raw,echo=0" in tests and during development, so RTU
+upstreams and downstreams can be exercised without hardware or external tools.
+
+	pair, err := vserial.Open()
+	if err != nil {
+		return err
+	}
+	defer pair.Close()
+	// the gateway opens pair.A, the simulated slave pair.B
+
+Pseudo-terminals are currently supported on Linux only.
+*/
+package vserial
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Pair is a connected pair of pseudo-terminals. Bytes written to one device can be read
+// from the other.
+type Pair struct {
+	// A and B are the device paths of the two ends, e.g. /dev/pts/3.
+	A, B string
+
+	ends  [2]*end
+	links []string
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// end is one pseudo-terminal. The slave side is kept open so reads on the master don't
+// fail while no serial client has the device open.
+type end struct {
+	master *os.File
+	slave  *os.File
+	name   string
+}
+
+// Open creates a pair of pseudo-terminals in raw mode and starts copying between them.
+func Open() (*Pair, error) {
+	a, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	b, err := openPTY()
+	if err != nil {
+		a.close()
+		return nil, err
+	}
+
+	p := &Pair{A: a.name, B: b.name, ends: [2]*end{a, b}}
+	p.wg.Add(2)
+	go p.copy(b.master, a.master)
+	go p.copy(a.master, b.master)
+	return p, nil
+}
+
+func (p *Pair) copy(dst io.Writer, src io.Reader) {
+	defer p.wg.Done()
+	io.Copy(dst, src)
+}
+
+// Link creates symlinks at pathA and pathB pointing to A and B, like the link option of
+// socat, so configuration files can use stable device names. Existing symlinks are
+// replaced; other files are left alone. The links are removed by Close.
+func (p *Pair) Link(pathA, pathB string) error {
+	for _, l := range []struct{ path, target string }{{pathA, p.A}, {pathB, p.B}} {
+		if fi, err := os.Lstat(l.path); err == nil {
+			if fi.Mode()&os.ModeSymlink == 0 {
+				return fmt.Errorf("vserial: %s exists and is not a symlink", l.path)
+			}
+			if err := os.Remove(l.path); err != nil {
+				return fmt.Errorf("vserial: %w", err)
+			}
+		}
+		if err := os.Symlink(l.target, l.path); err != nil {
+			return fmt.Errorf("vserial: %w", err)
+		}
+		p.links = append(p.links, l.path)
+	}
+	return nil
+}
+
+// Close stops copying, closes both pseudo-terminals and removes the links.
+func (p *Pair) Close() error {
+	var errs []error
+	p.once.Do(func() {
+		for _, e := range p.ends {
+			errs = append(errs, e.close())
+		}
+		p.wg.Wait()
+		for _, l := range p.links {
+			errs = append(errs, os.Remove(l))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func (e *end) close() error {
+	return errors.Join(e.master.Close(), e.slave.Close())
+}
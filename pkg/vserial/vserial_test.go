@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package vserial
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openPair(t *testing.T) *Pair {
+	t.Helper()
+	p, err := Open()
+	if err != nil {
+		t.Skipf("virtual serial ports unavailable: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func readFull(t *testing.T, f *os.File, n int) []byte {
+	t.Helper()
+	f.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatalf("read %s: %v", f.Name(), err)
+	}
+	return buf
+}
+
+func TestPair(t *testing.T) {
+	p := openPair(t)
+
+	a, err := os.OpenFile(p.A, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := os.OpenFile(p.B, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// A Modbus RTU frame with bytes a cooked terminal would translate (CR, XON, Ctrl-C).
+	frame := []byte{0x01, 0x03, 0x0D, 0x11, 0x03, 0x0A, 0x00, 0xFF}
+	if _, err := a.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFull(t, b, len(frame)); !bytes.Equal(got, frame) {
+		t.Errorf("A -> B: got % X, want % X", got, frame)
+	}
+
+	reply := []byte{0x01, 0x83, 0x02, 0xC0, 0xF1}
+	if _, err := b.Write(reply); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFull(t, a, len(reply)); !bytes.Equal(got, reply) {
+		t.Errorf("B -> A: got % X, want % X", got, reply)
+	}
+}
+
+func TestPair_Link(t *testing.T) {
+	p := openPair(t)
+	dir := t.TempDir()
+	linkA, linkB := filepath.Join(dir, "pts0"), filepath.Join(dir, "pts1")
+
+	// A stale link from an earlier run is replaced.
+	if err := os.Symlink("/dev/null", linkA); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Link(linkA, linkB); err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := os.Readlink(linkA); target != p.A {
+		t.Errorf("link A points to %q, want %q", target, p.A)
+	}
+	if target, _ := os.Readlink(linkB); target != p.B {
+		t.Errorf("link B points to %q, want %q", target, p.B)
+	}
+
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Link(regular, filepath.Join(dir, "other")); err == nil {
+		t.Error("Link replaced a regular file")
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(linkA); !os.IsNotExist(err) {
+		t.Errorf("link A not removed on Close: %v", err)
+	}
+}
@@ -22,10 +22,7 @@ const (
 	slaveID        = 1
 )
 
-var (
-	gatewayBinaryPath string
-	socatRunnerPath   string
-)
+var gatewayBinaryPath string
 
 // TestMain 是 Go 测试的入口，用于设置和拆除整个测试环境。
 func TestMain(m *testing.M) {
@@ -36,42 +33,14 @@ func TestMain(m *testing.M) {
 		log.Fatalf("无法获取当前工作目录: %v", err)
 	}
 	gatewayBinaryPath = filepath.Join(cwd, "..", "modbus-gateway")
-	socatRunnerPath = filepath.Join(cwd, "socat_runner.sh")
 
 	if _, err := os.Stat(gatewayBinaryPath); os.IsNotExist(err) {
 		log.Fatalf("modbus-gateway 二进制文件未找到: %s。请先编译项目。", gatewayBinaryPath)
 	}
-	if _, err := os.Stat(socatRunnerPath); os.IsNotExist(err) {
-		log.Fatalf("socat_runner.sh 脚本未找到: %s。", socatRunnerPath)
-	}
 
 	// --- 2. 设置测试环境 (Setup) ---
 	log.Println("正在启动测试环境...")
 
-	// 启动 socat 创建虚拟串口
-	go func() {
-		if err := runCommand("socat_runner", socatRunnerPath, "start"); err != nil {
-			log.Fatalf("启动 socat 失败: %v", err)
-		}
-	}()
-	// 给予 socat 足够的时间来创建设备文件
-	time.Sleep(1 * time.Second)
-	log.Println("虚拟串口已创建。")
-
-	// 启动 Modbus RTU 从站模拟器 (mbserver)
-	rtuServer := mbserver.NewServer()
-	// 预填充一些测试数据
-	rtuServer.HoldingRegisters[0] = 12345
-	rtuServer.HoldingRegisters[1] = 54321
-	rtuServer.Coils[0] = 1 // On
-	rtuServer.Coils[1] = 0 // Off
-	err = rtuServer.ListenRTU(&serial.Config{Address: pts1, BaudRate: 19200, DataBits: 8, Parity: "N", StopBits: 1})
-	if err != nil {
-		log.Fatalf("启动 Modbus RTU 从站模拟器失败: %v", err)
-	}
-	defer rtuServer.Close()
-	log.Printf("Modbus RTU 从站已在 %s 上启动。", pts1)
-
 	// Create temporary config file
 	configContent := fmt.Sprintf(`
 gateways:
@@ -103,9 +72,10 @@ log:
 
 	var gatewayCmd *exec.Cmd
 	go func() {
-		// 启动 modbus-gateway
+		// 启动 modbus-gateway，并由其创建虚拟串口对 (替代 socat)
 		gatewayCmd = exec.Command(gatewayBinaryPath,
 			"-config", configFile,
+			"-virtual-serial", pts0+","+pts1,
 		)
 		// 将子进程的标准输出和标准错误重定向到当前测试进程的输出
 		gatewayCmd.Stdout = os.Stdout
@@ -120,6 +90,20 @@ log:
 	// 等待网关完全启动
 	time.Sleep(2 * time.Second)
 
+	// 启动 Modbus RTU 从站模拟器 (mbserver)
+	rtuServer := mbserver.NewServer()
+	// 预填充一些测试数据
+	rtuServer.HoldingRegisters[0] = 12345
+	rtuServer.HoldingRegisters[1] = 54321
+	rtuServer.Coils[0] = 1 // On
+	rtuServer.Coils[1] = 0 // Off
+	err = rtuServer.ListenRTU(&serial.Config{Address: pts1, BaudRate: 19200, DataBits: 8, Parity: "N", StopBits: 1})
+	if err != nil {
+		log.Fatalf("启动 Modbus RTU 从站模拟器失败: %v", err)
+	}
+	defer rtuServer.Close()
+	log.Printf("Modbus RTU 从站已在 %s 上启动。", pts1)
+
 	// --- 3. 运行所有测试 ---
 	log.Println("开始执行测试用例...")
 	exitCode := m.Run()
@@ -134,27 +118,9 @@ log:
 		log.Println("modbus-gateway 进程已停止。")
 	}
 
-	// 停止 socat
-	if err := runCommand("socat_runner", socatRunnerPath, "stop"); err != nil {
-		log.Printf("停止 socat 失败: %v", err)
-	} else {
-		log.Println("socat 进程已停止。")
-	}
-
 	os.Exit(exitCode)
 }
 
-// runCommand 是一个执行外部命令的辅助函数
-func runCommand(name string, command string, args ...string) error {
-	cmd := exec.Command(command, args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("命令 '%s' 执行失败: %v, 输出: %s", name, err, string(output))
-	}
-	log.Printf("命令 '%s' 输出:\n%s", name, string(output))
-	return nil
-}
-
 // newTCPClient 创建并连接一个新的 Modbus TCP 客户端
 func newTCPClient(t *testing.T) modbus.Client {
 	handler := modbus.NewTCPClientHandler(fmt.Sprintf("127.0.0.1:%d", gatewayTCPPort))
@@ -0,0 +1,140 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// Allowlist restricts the clients a TCP or UDP upstream accepts to a set of networks,
+// less those denied.
+type Allowlist struct {
+	prefixes []netip.Prefix // Nil allows every network
+	denied   []netip.Prefix
+	rejected atomic.Uint64
+}
+
+// ParseAllowlist parses networks in CIDR notation or single addresses, e.g.
+// "10.1.0.0/16" or "192.168.5.7". An empty list returns nil, which allows everyone.
+func ParseAllowlist(entries []string) (*Allowlist, error) {
+	return ParseClients(entries, nil)
+}
+
+// ParseClients parses the networks clients may connect from, all if allowed is empty,
+// and those they may not, which take precedence, e.g. a compromised host inside an
+// allowed subnet. Two empty lists return nil, which allows everyone.
+func ParseClients(allowed, denied []string) (*Allowlist, error) {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil, nil
+	}
+	a := &Allowlist{}
+	var err error
+	if a.prefixes, err = parsePrefixes(allowed, "allowed"); err != nil {
+		return nil, err
+	}
+	if a.denied, err = parsePrefixes(denied, "denied"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parsePrefixes(entries []string, kind string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		var p netip.Prefix
+		if strings.Contains(e, "/") {
+			var err error
+			if p, err = netip.ParsePrefix(e); err != nil {
+				return nil, fmt.Errorf("invalid %s client %q: %w", kind, e, err)
+			}
+		} else {
+			addr, err := netip.ParseAddr(e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s client %q: %w", kind, e, err)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// Allows reports whether a client at addr may connect.
+func (a *Allowlist) Allows(addr net.Addr) bool {
+	if a == nil {
+		return true
+	}
+	var ip netip.Addr
+	var ok bool
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip, ok = netip.AddrFromSlice(addr.IP)
+	case *net.UDPAddr:
+		ip, ok = netip.AddrFromSlice(addr.IP)
+	}
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range a.denied {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if a.prefixes == nil {
+		return true
+	}
+	for _, p := range a.prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejected returns the number of connections rejected so far.
+func (a *Allowlist) Rejected() uint64 {
+	if a == nil {
+		return 0
+	}
+	return a.rejected.Load()
+}
+
+// Listener wraps ln to close connections from clients that are not allowed as soon as
+// they are accepted, logging them with the logger of ctx. A nil allowlist returns ln unchanged.
+func (a *Allowlist) Listener(ctx context.Context, ln net.Listener) net.Listener {
+	if a == nil {
+		return ln
+	}
+	return &allowListener{Listener: ln, allowlist: a, log: Logger(ctx)}
+}
+
+type allowListener struct {
+	net.Listener
+	allowlist *Allowlist
+	log       *slog.Logger
+}
+
+func (l *allowListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.allowlist.Allows(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		n := l.allowlist.rejected.Add(1)
+		l.log.Warn("Rejected client", "addr", conn.RemoteAddr(), "listen", l.Addr(), "rejected", n)
+		conn.Close()
+	}
+}
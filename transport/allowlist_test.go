@@ -0,0 +1,104 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAllowlist_Allows(t *testing.T) {
+	a, err := ParseAllowlist([]string{"10.1.0.0/16", "192.168.5.7", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"10.2.0.1", false},
+		{"192.168.5.7", true},
+		{"192.168.5.8", false},
+		{"::ffff:10.1.0.1", true},
+		{"fd12::1", true},
+		{"fe80::1", false},
+	}
+	for _, tt := range tests {
+		if got := a.Allows(&net.TCPAddr{IP: net.ParseIP(tt.ip), Port: 1234}); got != tt.want {
+			t.Errorf("Allows(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	var none *Allowlist
+	if !none.Allows(&net.TCPAddr{IP: net.ParseIP("1.2.3.4")}) {
+		t.Error("nil allowlist rejects clients")
+	}
+	if _, err := ParseAllowlist([]string{"10.1.0.0/33"}); err == nil {
+		t.Error("ParseAllowlist accepted an invalid prefix")
+	}
+	if _, err := ParseAllowlist([]string{"plant-scada"}); err == nil {
+		t.Error("ParseAllowlist accepted a host name")
+	}
+}
+
+func TestAllowlist_Listener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := ParseAllowlist([]string{"10.0.0.0/8"})
+	ln = a.Listener(context.Background(), ln)
+	defer ln.Close()
+	go ln.Accept()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() error = %v, want EOF from a rejected connection", err)
+	}
+	if a.Rejected() != 1 {
+		t.Errorf("Rejected() = %d, want 1", a.Rejected())
+	}
+}
+
+func TestParseClients(t *testing.T) {
+	a, err := ParseClients([]string{"10.1.0.0/16"}, []string{"10.1.9.0/24", "10.1.0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	denyOnly, err := ParseClients(nil, []string{"192.168.5.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip             string
+		want, wantDeny bool
+	}{
+		{"10.1.2.3", true, true},
+		{"10.1.9.1", false, true},
+		{"10.1.0.5", false, true},
+		{"10.2.0.1", false, true},
+		{"192.168.5.7", false, false},
+	}
+	for _, tt := range tests {
+		addr := &net.TCPAddr{IP: net.ParseIP(tt.ip), Port: 1234}
+		if got, gotDeny := a.Allows(addr), denyOnly.Allows(addr); got != tt.want || gotDeny != tt.wantDeny {
+			t.Errorf("Allows(%s) = %v, %v without allowed clients, want %v, %v", tt.ip, got, gotDeny, tt.want, tt.wantDeny)
+		}
+	}
+	if a, err := ParseClients(nil, nil); a != nil || err != nil {
+		t.Errorf("ParseClients() = %v, %v, want nil", a, err)
+	}
+	if _, err := ParseClients(nil, []string{"10.1.0.0/33"}); err == nil {
+		t.Error("ParseClients accepted an invalid denied prefix")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+import (
+	"net"
+	"sync"
+)
+
+// Conns counts the connections a TCP upstream serves, by client host, so a limit can
+// be enforced and the host holding them named when it is reached.
+type Conns struct {
+	mu    sync.Mutex
+	total int
+	hosts map[string]int
+}
+
+// Add counts a connection from addr, unless limit connections are served already
+// (0 is unlimited). It returns the connections held by the host of addr, including
+// this one if it was counted.
+func (c *Conns) Add(addr net.Addr, limit int) (bool, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	host := hostOf(addr)
+	if limit > 0 && c.total >= limit {
+		return false, c.hosts[host]
+	}
+	if c.hosts == nil {
+		c.hosts = make(map[string]int)
+	}
+	c.total++
+	c.hosts[host]++
+	return true, c.hosts[host]
+}
+
+// Done uncounts a connection from addr.
+func (c *Conns) Done(addr net.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	host := hostOf(addr)
+	c.total--
+	if c.hosts[host]--; c.hosts[host] <= 0 {
+		delete(c.hosts, host)
+	}
+}
+
+// Len returns the connections counted.
+func (c *Conns) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+func hostOf(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
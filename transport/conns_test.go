@@ -0,0 +1,35 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package transport
+
+import (
+	"net"
+	"testing"
+)
+
+func TestConns(t *testing.T) {
+	var c Conns
+	driver := func(port int) net.Addr { return &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: port} }
+	scada := &net.TCPAddr{IP: net.ParseIP("10.1.0.1"), Port: 502}
+
+	for port := 1; port <= 2; port++ {
+		if ok, held := c.Add(driver(port), 3); !ok || held != port {
+			t.Errorf("Add() of connection %d = %v, %d, want it counted", port, ok, held)
+		}
+	}
+	if ok, held := c.Add(scada, 3); !ok || held != 1 {
+		t.Errorf("Add() of scada = %v, %d, want it counted", ok, held)
+	}
+	if ok, held := c.Add(driver(4), 3); ok || held != 2 {
+		t.Errorf("Add() beyond the limit = %v, %d, want it rejected with 2 held by the host", ok, held)
+	}
+
+	c.Done(driver(1))
+	if ok, _ := c.Add(driver(5), 3); !ok || c.Len() != 3 {
+		t.Errorf("Add() after Done() = %v with %d counted, want it counted", ok, c.Len())
+	}
+	if ok, _ := c.Add(driver(6), 0); !ok {
+		t.Error("Add() without a limit rejected the connection")
+	}
+}
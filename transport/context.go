@@ -0,0 +1,85 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"net"
+)
+
+type (
+	clientKey   struct{}
+	identityKey struct{}
+	upstreamKey struct{}
+	loggerKey   struct{}
+	listenKey   struct{}
+)
+
+// WithClient returns ctx carrying the address of the master a request came from.
+// Network upstreams set it on the context passed to the RequestHandler.
+func WithClient(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, clientKey{}, addr)
+}
+
+// ClientFromContext returns the address of the master a request came from, or nil
+// for requests of serial upstreams and of services inside the process.
+func ClientFromContext(ctx context.Context) net.Addr {
+	addr, _ := ctx.Value(clientKey{}).(net.Addr)
+	return addr
+}
+
+// WithIdentity returns ctx carrying the name of the authenticated master a request came from.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the name of the authenticated master a request came
+// from, or "" if it wasn't authenticated.
+func IdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+	return identity
+}
+
+// WithUpstream returns ctx carrying the label of the upstream a request came from.
+// The gateway sets it on the context its upstreams are started with.
+func WithUpstream(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, upstreamKey{}, name)
+}
+
+// UpstreamFromContext returns the label of the upstream a request came from, or ""
+// for requests of services inside the process.
+func UpstreamFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(upstreamKey{}).(string)
+	return name
+}
+
+// WithLogger returns ctx carrying a logger with the labels of the gateway, upstream,
+// downstream and slave ctx is used for, so transports log them consistently.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the logger of ctx, or the default logger if it carries none.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithListening returns ctx on which Listening calls fn. The gateway sets it on the
+// context its upstreams are started with, to report readiness once they are bound.
+func WithListening(ctx context.Context, fn func()) context.Context {
+	return context.WithValue(ctx, listenKey{}, fn)
+}
+
+// Listening tells the gateway an upstream accepts requests, once it has bound its
+// address or opened its serial device. Upstreams call it from Start.
+func Listening(ctx context.Context) {
+	if fn, ok := ctx.Value(listenKey{}).(func()); ok {
+		fn()
+	}
+}
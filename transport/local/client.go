@@ -6,22 +6,43 @@ package local
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
 	"log/slog"
 
 	"github.com/ffutop/modbus-gateway/internal/config"
 	localslave "github.com/ffutop/modbus-gateway/internal/local-slave"
+	"github.com/ffutop/modbus-gateway/internal/local-slave/expr"
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
 	"github.com/ffutop/modbus-gateway/internal/local-slave/persistence"
+	"github.com/ffutop/modbus-gateway/internal/partition"
 	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
 )
 
-// Client implements Downstream interface for a local in-memory slave.
+// Client implements Downstream interface for local in-memory slaves: one for each
+// unit configured, and one answering the other slave IDs routed to it.
 type Client struct {
 	slave   *localslave.LocalSlave
 	storage persistence.Storage
+	units   map[byte]*Client // By slave ID
 }
 
 // NewClient creates a new Local Client.
 func NewClient(cfg config.LocalConfig) *Client {
+	c := newSlave(cfg)
+	for _, u := range cfg.Units {
+		slog.Info("Initializing local unit", "slave_id", u.SlaveID)
+		if c.units == nil {
+			c.units = make(map[byte]*Client)
+		}
+		c.units[u.SlaveID] = newSlave(u.LocalConfig)
+	}
+	return c
+}
+
+// newSlave creates a slave with its own data model and storage.
+func newSlave(cfg config.LocalConfig) *Client {
 	var storage persistence.Storage
 	switch cfg.Persistence.Type {
 	case "file":
@@ -30,6 +51,9 @@ func NewClient(cfg config.LocalConfig) *Client {
 	case "mmap":
 		slog.Info("Initializing local slave with MMAP persistence", "path", cfg.Persistence.Path)
 		storage = persistence.NewMmapStorage(cfg.Persistence.Path)
+	case "bolt":
+		slog.Info("Initializing local slave with bbolt persistence", "path", cfg.Persistence.Path)
+		storage = persistence.NewBoltStorage(cfg.Persistence.Path)
 	case "sql":
 		slog.Info("Initializing local slave with SQL persistence", "driver", "sqlite3", "dsn", cfg.Persistence.Path)
 		// Assuming Path contains DSN for now, or we need a new config field.
@@ -40,6 +64,18 @@ func NewClient(cfg config.LocalConfig) *Client {
 		slog.Info("Initializing local slave with memory storage (non-persistent)")
 		storage = persistence.NewMemoryStorage()
 	}
+	switch p := cfg.Persistence; p.SyncMode {
+	case persistence.SyncInterval:
+		storage = persistence.NewDeferredStorage(storage, p.SyncInterval)
+	case persistence.SyncOnShutdown:
+		storage = persistence.NewDeferredStorage(storage, 0)
+	}
+
+	if merged, err := applyProfile(cfg); err != nil {
+		slog.Error("Invalid profile, starting without it", "err", err)
+	} else {
+		cfg = merged
+	}
 
 	m, err := storage.Load()
 	if err != nil {
@@ -52,8 +88,40 @@ func NewClient(cfg config.LocalConfig) *Client {
 		}
 	}
 
+	if presets, err := parseInitialValues(cfg); err != nil {
+		slog.Error("Invalid initial values, starting without them", "err", err)
+	} else if err := seed(m, storage, presets); err != nil {
+		slog.Error("Failed to write initial values", "err", err)
+	}
+
 	// Initialize protocol logic
 	s := localslave.NewLocalSlave(m, storage)
+	if id, err := ParseServerID(cfg.ServerID); err != nil {
+		slog.Error("Invalid server ID, reporting the default", "err", err)
+	} else {
+		s.ServerID = id
+	}
+	if id, err := ParseIdentification(cfg.DeviceInfo); err != nil {
+		slog.Error("Invalid device identification, reporting the default", "err", err)
+	} else {
+		s.Identification = id
+	}
+
+	if addrs, err := ParseAddresses(cfg.ValidAddresses); err != nil {
+		slog.Error("Invalid valid_addresses, serving all addresses", "err", err)
+	} else {
+		s.Addresses = addrs
+	}
+
+	if engine, err := newExpressions(m, cfg.Expressions); err != nil {
+		slog.Error("Invalid expressions, serving stored values", "err", err)
+	} else {
+		s.Expressions = engine
+	}
+
+	for _, q := range cfg.FIFOQueues {
+		m.AddFIFO(q.Address, q.ClearOnRead)
+	}
 
 	return &Client{
 		slave:   s,
@@ -61,9 +129,96 @@ func NewClient(cfg config.LocalConfig) *Client {
 	}
 }
 
+// ParseServerID decodes the answer of a local slave to Report Server ID.
+func ParseServerID(cfg config.ServerIDConfig) (localslave.ServerID, error) {
+	id := localslave.ServerID{ID: []byte{0x01}, Running: !cfg.Stopped, Additional: []byte(cfg.Additional)}
+	if cfg.ID != "" {
+		var err error
+		if id.ID, err = hex.DecodeString(cfg.ID); err != nil {
+			return localslave.ServerID{}, fmt.Errorf("server ID %q: %w", cfg.ID, err)
+		}
+	}
+	// ID, run indicator and additional data follow function code and byte count in a PDU of 253 bytes
+	if n := len(id.ID) + 1 + len(id.Additional); n > 251 {
+		return localslave.ServerID{}, fmt.Errorf("server ID and additional data of %d bytes exceed the response", n-1)
+	}
+	return id, nil
+}
+
+// tables are the tables of the data model, as named in the configuration.
+var tables = map[string]model.TableType{
+	partition.TableCoil:            model.TableCoils,
+	partition.TableDiscreteInput:   model.TableDiscreteInputs,
+	partition.TableHoldingRegister: model.TableHoldingRegisters,
+	partition.TableInputRegister:   model.TableInputRegisters,
+}
+
+// ParseAddresses parses the addresses a local slave serves by table, e.g.
+// "0-99, 1000-1019" of holding_register. Nil serves all.
+func ParseAddresses(cfg map[string]string) (localslave.Addresses, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	addrs := make(localslave.Addresses)
+	for name, list := range cfg {
+		table, ok := tables[name]
+		if !ok {
+			return nil, fmt.Errorf("valid addresses of unknown table %q", name)
+		}
+		ranges, err := partition.ParseRanges([]config.AddressRangeConfig{{Table: name, Addresses: list}})
+		if err != nil {
+			return nil, fmt.Errorf("valid addresses of %s: %w", name, err)
+		}
+		for _, r := range ranges {
+			addrs[table] = append(addrs[table], localslave.AddressRange{First: r.First, Last: r.Last})
+		}
+	}
+	return addrs, nil
+}
+
+// newExpressions compiles the expressions of a local slave computing values of m,
+// nil if there are none.
+func newExpressions(m *model.DataModel, cfgs []config.ExpressionConfig) (*expr.Engine, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	defs := make([]expr.Def, len(cfgs))
+	for i, cfg := range cfgs {
+		table, ok := tables[cfg.Table]
+		if !ok {
+			return nil, fmt.Errorf("expression of unknown table %q", cfg.Table)
+		}
+		defs[i] = expr.Def{Table: table, Address: cfg.Address, Expr: cfg.Expr}
+	}
+	return expr.New(m, defs)
+}
+
+// ParseIdentification returns the objects a local slave reports with Read Device Identification.
+func ParseIdentification(cfg config.DeviceInfoConfig) (localslave.Identification, error) {
+	id := make(localslave.Identification)
+	for i, value := range []string{cfg.VendorName, cfg.ProductCode, cfg.Revision} {
+		if value == "" {
+			value = localslave.DefaultIdentification[byte(i)]
+		}
+		id[byte(i)] = value
+	}
+	// The basic objects must fit one response, as stream access restarts with them
+	size := 0
+	for _, value := range id {
+		size += 2 + len(value)
+	}
+	if size > pdu.MaxDeviceObjects {
+		return nil, fmt.Errorf("device identification of %d bytes exceeds the response", size)
+	}
+	return id, nil
+}
+
 // Send processes the PDU locally.
 func (c *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
 	// The LocalSlave is synchronous and fast, so we just call Process.
+	if u, ok := c.units[slaveID]; ok {
+		return u.slave.Process(pdu)
+	}
 	return c.slave.Process(pdu)
 }
 
@@ -72,10 +227,29 @@ func (c *Client) Connect(ctx context.Context) error {
 	return nil
 }
 
-// Close closes the storage.
+// Dropped returns how many writes the storages of the slaves dropped, such as
+// those finding the queue of an SQL storage full.
+func (c *Client) Dropped() uint64 {
+	var dropped uint64
+	for _, u := range c.units {
+		dropped += u.Dropped()
+	}
+	if dropper, ok := c.storage.(interface{ Dropped() uint64 }); ok {
+		dropped += dropper.Dropped()
+	}
+	return dropped
+}
+
+// Close closes the storage of each slave.
 func (c *Client) Close() error {
-	if closer, ok := c.storage.(interface{ Close() }); ok {
-		closer.Close()
+	for _, u := range c.units {
+		u.Close()
+	}
+	if c.slave.Expressions != nil {
+		c.slave.Expressions.Close()
+	}
+	if closer, ok := c.storage.(interface{ Close() error }); ok {
+		return closer.Close()
 	}
 	return nil
 }
@@ -0,0 +1,148 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package local
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/local-slave/model"
+	"github.com/ffutop/modbus-gateway/internal/local-slave/persistence"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/spf13/viper"
+)
+
+// preset is a run of initial values of a table, encoded as Load takes them.
+type preset struct {
+	table    model.TableType
+	address  uint16
+	quantity uint16
+	data     []byte
+}
+
+// parseInitialValues returns the values a local slave starts with, those of the
+// configuration followed by those of its file, so the file wins where both set one.
+func parseInitialValues(cfg config.LocalConfig) ([]preset, error) {
+	values := cfg.InitialValues
+	if cfg.InitialValuesFile != "" {
+		more, err := loadInitialValues(cfg.InitialValuesFile)
+		if err != nil {
+			return nil, fmt.Errorf("initial values: %w", err)
+		}
+		values = append(append([]config.InitialValueConfig(nil), values...), more...)
+	}
+
+	presets := make([]preset, 0, len(values))
+	for i, v := range values {
+		p, err := parsePreset(v)
+		if err != nil {
+			return nil, fmt.Errorf("initial values %d: %w", i+1, err)
+		}
+		presets = append(presets, p)
+	}
+	return presets, nil
+}
+
+func parsePreset(v config.InitialValueConfig) (preset, error) {
+	table, ok := tables[v.Table]
+	if !ok {
+		return preset{}, fmt.Errorf("unknown table %q", v.Table)
+	}
+	if len(v.Values) == 0 {
+		return preset{}, fmt.Errorf("no values at address %d", v.Address)
+	}
+	if int(v.Address)+len(v.Values) > model.MaxAddress+1 {
+		return preset{}, fmt.Errorf("%d values at address %d exceed the table", len(v.Values), v.Address)
+	}
+
+	p := preset{table: table, address: v.Address, quantity: uint16(len(v.Values))}
+	switch table {
+	case model.TableCoils, model.TableDiscreteInputs:
+		bits := make([]bool, len(v.Values))
+		for i, value := range v.Values {
+			if value > 1 {
+				return preset{}, fmt.Errorf("value %d of %s %d, want 0 or 1", value, v.Table, int(v.Address)+i)
+			}
+			bits[i] = value == 1
+		}
+		p.data = pdu.PackBits(bits)
+	default:
+		p.data = pdu.EncodeRegisters(v.Values)
+	}
+	return p, nil
+}
+
+// seed writes the initial values into m, and through to storage.
+func seed(m *model.DataModel, storage persistence.Storage, presets []preset) error {
+	for _, p := range presets {
+		if err := m.Load(p.table, p.address, p.quantity, p.data); err != nil {
+			return err
+		}
+		storage.OnWrite(p.table, p.address, p.quantity)
+	}
+	return nil
+}
+
+// loadInitialValues reads initial values from a CSV file of table, address and
+// values separated by spaces, unless its extension says YAML, where they are listed
+// under initial_values like in the configuration.
+func loadInitialValues(path string) ([]config.InitialValueConfig, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, err
+		}
+		var file struct {
+			InitialValues []config.InitialValueConfig `mapstructure:"initial_values"`
+		}
+		if err := v.Unmarshal(&file); err != nil {
+			return nil, err
+		}
+		return file.InitialValues, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var values []config.InitialValueConfig
+	for i, rec := range records {
+		if i == 0 && strings.EqualFold(rec[0], "table") {
+			continue // header
+		}
+		address, err := strconv.ParseUint(strings.TrimSpace(rec[1]), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s: record %d: invalid address: %w", path, i+1, err)
+		}
+		v := config.InitialValueConfig{Table: strings.TrimSpace(rec[0]), Address: uint16(address)}
+		for _, field := range strings.Fields(rec[2]) {
+			n, err := strconv.ParseUint(field, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("%s: record %d: invalid value %q: %w", path, i+1, field, err)
+			}
+			v.Values = append(v.Values, uint16(n))
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package local
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/spf13/viper"
+)
+
+// A profile simulates a device: a YAML file of the settings of a local slave, its
+// device_info, valid_addresses, initial_values and expressions, with the register
+// map documented in its comments.
+//
+//go:embed profiles/*.yaml
+var profiles embed.FS
+
+// Profiles returns the names of the bundled profiles.
+func Profiles() []string {
+	entries, _ := profiles.ReadDir("profiles")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile returns cfg with the settings of its profile, a bundled one by name or
+// a YAML file by path, under its own: these override the device_info fields and
+// valid_addresses tables they set and expressions of the same value, and their
+// initial values are written after those of the profile.
+func applyProfile(cfg config.LocalConfig) (config.LocalConfig, error) {
+	if cfg.Profile == "" {
+		return cfg, nil
+	}
+	p, err := loadProfile(cfg.Profile)
+	if err != nil {
+		return cfg, fmt.Errorf("profile %s: %w", cfg.Profile, err)
+	}
+
+	for _, field := range []struct{ own, profile *string }{
+		{&cfg.DeviceInfo.VendorName, &p.DeviceInfo.VendorName},
+		{&cfg.DeviceInfo.ProductCode, &p.DeviceInfo.ProductCode},
+		{&cfg.DeviceInfo.Revision, &p.DeviceInfo.Revision},
+	} {
+		if *field.own == "" {
+			*field.own = *field.profile
+		}
+	}
+	addrs := make(map[string]string)
+	for table, list := range p.ValidAddresses {
+		addrs[table] = list
+	}
+	for table, list := range cfg.ValidAddresses {
+		addrs[table] = list
+	}
+	cfg.ValidAddresses = addrs
+	cfg.InitialValues = append(p.InitialValues, cfg.InitialValues...)
+
+	type value struct {
+		table   string
+		address uint16
+	}
+	own := make(map[value]bool)
+	for _, e := range cfg.Expressions {
+		own[value{e.Table, e.Address}] = true
+	}
+	exprs := make([]config.ExpressionConfig, 0, len(p.Expressions)+len(cfg.Expressions))
+	for _, e := range p.Expressions {
+		if !own[value{e.Table, e.Address}] {
+			exprs = append(exprs, e)
+		}
+	}
+	cfg.Expressions = append(exprs, cfg.Expressions...)
+	return cfg, nil
+}
+
+// loadProfile reads a bundled profile, or the file of a name with a path or an
+// extension.
+func loadProfile(name string) (config.LocalConfig, error) {
+	var r io.Reader
+	if strings.ContainsAny(name, `/\.`) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return config.LocalConfig{}, err
+		}
+		r = bytes.NewReader(data)
+	} else {
+		data, err := profiles.ReadFile(path.Join("profiles", name+".yaml"))
+		if err != nil {
+			return config.LocalConfig{}, fmt.Errorf("no bundled profile, want one of %s or a YAML file", strings.Join(Profiles(), ", "))
+		}
+		r = bytes.NewReader(data)
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(r); err != nil {
+		return config.LocalConfig{}, err
+	}
+	var p config.LocalConfig
+	if err := v.Unmarshal(&p); err != nil {
+		return config.LocalConfig{}, err
+	}
+	return p, nil
+}
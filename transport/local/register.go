@@ -0,0 +1,94 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package local
+
+import (
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/internal/local-slave/persistence"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func init() {
+	transport.RegisterDownstream("local", func(cfg config.DownstreamConfig) (transport.Downstream, error) {
+		if err := validate(cfg.Local); err != nil {
+			return nil, err
+		}
+		paths := make(map[string]string)
+		if persistent(cfg.Local.Persistence) {
+			paths[cfg.Local.Persistence.Path] = "the local slave"
+		}
+		units := make(map[byte]bool)
+		for _, u := range cfg.Local.Units {
+			if units[u.SlaveID] {
+				return nil, fmt.Errorf("local unit %d defined twice", u.SlaveID)
+			}
+			units[u.SlaveID] = true
+			if len(u.Units) > 0 {
+				return nil, fmt.Errorf("local unit %d: units of a unit", u.SlaveID)
+			}
+			if err := validate(u.LocalConfig); err != nil {
+				return nil, fmt.Errorf("local unit %d: %w", u.SlaveID, err)
+			}
+			// Units have their own data model, they can't share where it persists
+			if p := u.Persistence; persistent(p) {
+				if other, ok := paths[p.Path]; ok {
+					return nil, fmt.Errorf("local unit %d: persistence path %q also used by %s", u.SlaveID, p.Path, other)
+				}
+				paths[p.Path] = fmt.Sprintf("unit %d", u.SlaveID)
+			}
+		}
+		return NewClient(cfg.Local), nil
+	})
+}
+
+func persistent(p config.PersistenceConfig) bool {
+	return p.Type == "file" || p.Type == "mmap" || p.Type == "bolt" || p.Type == "sql"
+}
+
+// validate checks the settings of a local slave, with its profile.
+func validate(cfg config.LocalConfig) error {
+	local, err := applyProfile(cfg) // NewClient applies it again
+	if err != nil {
+		return err
+	}
+	if _, err := ParseServerID(local.ServerID); err != nil {
+		return err
+	}
+	if _, err := ParseIdentification(local.DeviceInfo); err != nil {
+		return err
+	}
+	if _, err := parseInitialValues(local); err != nil {
+		return err
+	}
+	if _, err := ParseAddresses(local.ValidAddresses); err != nil {
+		return err
+	}
+	engine, err := newExpressions(nil, local.Expressions) // Compiled only
+	if err != nil {
+		return err
+	}
+	if engine != nil {
+		engine.Close()
+	}
+	seen := make(map[uint16]bool)
+	for _, q := range local.FIFOQueues {
+		if seen[q.Address] {
+			return fmt.Errorf("FIFO queue at address %d defined twice", q.Address)
+		}
+		seen[q.Address] = true
+	}
+	switch p := local.Persistence; p.SyncMode {
+	case "", persistence.SyncAlways, persistence.SyncOnShutdown:
+	case persistence.SyncInterval:
+		if p.SyncInterval < 0 {
+			return fmt.Errorf("negative persistence sync_interval %s", p.SyncInterval)
+		}
+	default:
+		return fmt.Errorf("unknown persistence sync_mode %q, want always, interval or on_shutdown", p.SyncMode)
+	}
+	return nil
+}
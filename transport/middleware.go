@@ -0,0 +1,18 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+// Middleware wraps the handling of requests, e.g. to log, refuse or rewrite them,
+// or answer them without asking a device. It returns a handler calling next to pass
+// a request on, and is called once when the handler chain is built.
+type Middleware func(next RequestHandler) RequestHandler
+
+// Chain returns h wrapped in mws, the first of them seeing requests first.
+func Chain(h RequestHandler, mws ...Middleware) RequestHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
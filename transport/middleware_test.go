@@ -0,0 +1,33 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next RequestHandler) RequestHandler {
+			return func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+				order = append(order, name)
+				return next(ctx, slaveID+1, pdu)
+			}
+		}
+	}
+	var seen byte
+	h := Chain(func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		seen = slaveID
+		return pdu, nil
+	}, mw("outer"), mw("inner"))
+
+	h(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 3})
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" || seen != 3 {
+		t.Errorf("chain ran %v and passed slave %d, want outer, inner and 3", order, seen)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+)
+
+// UpstreamFactory creates an Upstream from its config section.
+type UpstreamFactory func(cfg config.UpstreamConfig) (Upstream, error)
+
+// DownstreamFactory creates a Downstream from its config section.
+type DownstreamFactory func(cfg config.DownstreamConfig) (Downstream, error)
+
+var (
+	registryMu  sync.RWMutex
+	upstreams   = make(map[string]UpstreamFactory)
+	downstreams = make(map[string]DownstreamFactory)
+)
+
+// RegisterUpstream makes an upstream type available under the given config name.
+// It is meant to be called from the init function of a transport package
+// and panics if the name is registered twice or the factory is nil.
+func RegisterUpstream(name string, factory UpstreamFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("transport: RegisterUpstream factory is nil")
+	}
+	if _, dup := upstreams[name]; dup {
+		panic("transport: RegisterUpstream called twice for " + name)
+	}
+	upstreams[name] = factory
+}
+
+// RegisterDownstream makes a downstream type available under the given config name.
+// It is meant to be called from the init function of a transport package
+// and panics if the name is registered twice or the factory is nil.
+func RegisterDownstream(name string, factory DownstreamFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("transport: RegisterDownstream factory is nil")
+	}
+	if _, dup := downstreams[name]; dup {
+		panic("transport: RegisterDownstream called twice for " + name)
+	}
+	downstreams[name] = factory
+}
+
+// NewUpstream creates an upstream using the factory registered for cfg.Type.
+func NewUpstream(cfg config.UpstreamConfig) (Upstream, error) {
+	registryMu.RLock()
+	factory, ok := upstreams[cfg.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown upstream type: %s", cfg.Type)
+	}
+	return factory(cfg)
+}
+
+// NewDownstream creates a downstream using the factory registered for cfg.Type.
+func NewDownstream(cfg config.DownstreamConfig) (Downstream, error) {
+	registryMu.RLock()
+	factory, ok := downstreams[cfg.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown downstream type: %s", cfg.Type)
+	}
+	return factory(cfg)
+}
+
+// UpstreamTypes returns the sorted names of the registered upstream types.
+func UpstreamTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(upstreams)
+}
+
+// DownstreamTypes returns the sorted names of the registered downstream types.
+func DownstreamTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(downstreams)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+type radioModem struct{ address string }
+
+func (r *radioModem) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	return pdu, nil
+}
+func (r *radioModem) Connect(ctx context.Context) error { return nil }
+func (r *radioModem) Close() error                      { return nil }
+
+func TestRegisterDownstream(t *testing.T) {
+	RegisterDownstream("test-radio", func(cfg config.DownstreamConfig) (Downstream, error) {
+		return &radioModem{address: cfg.Tcp.Address}, nil
+	})
+
+	ds, err := NewDownstream(config.DownstreamConfig{Type: "test-radio", Tcp: config.TcpConfig{Address: "modem:9000"}})
+	if err != nil {
+		t.Fatalf("NewDownstream() error = %v", err)
+	}
+	if r, ok := ds.(*radioModem); !ok || r.address != "modem:9000" {
+		t.Errorf("NewDownstream() = %#v", ds)
+	}
+
+	if _, err := NewDownstream(config.DownstreamConfig{Type: "carrier-pigeon"}); err == nil {
+		t.Error("NewDownstream() with unknown type expected error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a type twice expected to panic")
+		}
+	}()
+	RegisterDownstream("test-radio", func(cfg config.DownstreamConfig) (Downstream, error) { return nil, nil })
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package replay records the responses of a real downstream and answers from
+// such a recording, so gateways can be developed without the device at hand.
+//
+// A recording is a JSON Lines file, one request/response pair per line with the
+// PDUs hex encoded. When a request was recorded more than once, the last response wins.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/modbus/pdu"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// entry is one line of a recording.
+type entry struct {
+	SlaveID  byte   `json:"slave_id"`
+	Request  string `json:"request"`
+	Response string `json:"response"`
+}
+
+func encode(p modbus.ProtocolDataUnit) string {
+	return hex.EncodeToString(append([]byte{p.FunctionCode}, p.Data...))
+}
+
+func decode(s string) (modbus.ProtocolDataUnit, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	if len(b) == 0 {
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("empty PDU")
+	}
+	return modbus.ProtocolDataUnit{FunctionCode: b[0], Data: b[1:]}, nil
+}
+
+func key(slaveID byte, req modbus.ProtocolDataUnit) string {
+	return fmt.Sprintf("%d/%s", slaveID, encode(req))
+}
+
+// Recorder wraps a downstream and appends every response it returns to a recording.
+type Recorder struct {
+	transport.Downstream
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Record wraps ds, appending its responses to the recording at path.
+func Record(ds transport.Downstream, path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	return &Recorder{Downstream: ds, file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Send forwards the request and records the response, exceptions included.
+func (r *Recorder) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	resp, err := r.Downstream.Send(ctx, slaveID, req)
+	if err != nil {
+		return resp, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(entry{SlaveID: slaveID, Request: encode(req), Response: encode(resp)}); err != nil {
+		transport.Logger(ctx).Warn("Failed to record response", "file", r.file.Name(), "err", err)
+	}
+	return resp, nil
+}
+
+// Close closes the recording and the wrapped downstream.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	r.file.Close()
+	r.mu.Unlock()
+	return r.Downstream.Close()
+}
+
+// Client implements Downstream, answering from a recording.
+type Client struct {
+	responses map[string]modbus.ProtocolDataUnit
+}
+
+// NewClient loads the recording at path.
+func NewClient(path string) (*Client, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+
+	c := &Client{responses: make(map[string]modbus.ProtocolDataUnit)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		req, err := decode(e.Request)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid request: %w", path, line, err)
+		}
+		resp, err := decode(e.Response)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid response: %w", path, line, err)
+		}
+		c.responses[key(e.SlaveID, req)] = resp
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	slog.Info("Loaded replay recording", "file", path, "responses", len(c.responses))
+	return c, nil
+}
+
+// Send answers with the recorded response. Requests that were never recorded
+// are answered as if the device did not respond.
+func (c *Client) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if resp, ok := c.responses[key(slaveID, req)]; ok {
+		return resp, nil
+	}
+	transport.Logger(ctx).Debug("No recorded response", "request", encode(req))
+	return pdu.Exception(req.FunctionCode, modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond), nil
+}
+
+// Connect is a no-op for a recording.
+func (c *Client) Connect(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op for a recording.
+func (c *Client) Close() error {
+	return nil
+}
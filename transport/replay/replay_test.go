@@ -0,0 +1,88 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// device answers reads of holding registers with a counter, so repeated requests differ.
+type device struct {
+	reads byte
+}
+
+func (d *device) Send(ctx context.Context, slaveID byte, req modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+	if req.FunctionCode != modbus.FuncCodeReadHoldingRegisters {
+		return modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode | 0x80, Data: []byte{modbus.ExceptionCodeIllegalFunction}}, nil
+	}
+	d.reads++
+	return modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: []byte{2, slaveID, d.reads}}, nil
+}
+
+func (d *device) Connect(ctx context.Context) error { return nil }
+func (d *device) Close() error                      { return nil }
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device.jsonl")
+	ctx := context.Background()
+
+	read := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+	write := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0, 0, 0, 1}}
+
+	rec, err := Record(&device{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slaveID := range []byte{1, 1, 2} {
+		if _, err := rec.Send(ctx, slaveID, read); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rec.Send(ctx, 1, write); err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+
+	c, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		slaveID byte
+		req     modbus.ProtocolDataUnit
+		want    modbus.ProtocolDataUnit
+	}{
+		{"last response wins", 1, read, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{2, 1, 2}}},
+		{"keyed by slave", 2, read, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{2, 2, 3}}},
+		{"recorded exception", 1, write, modbus.ProtocolDataUnit{FunctionCode: 0x86, Data: []byte{modbus.ExceptionCodeIllegalFunction}}},
+		{"not recorded", 3, read, modbus.ProtocolDataUnit{FunctionCode: 0x83, Data: []byte{modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Send(ctx, tt.slaveID, tt.req)
+			if err != nil || got.FunctionCode != tt.want.FunctionCode || !bytes.Equal(got.Data, tt.want.Data) {
+				t.Errorf("Send() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClient_Errors(t *testing.T) {
+	if _, err := NewClient(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("NewClient() with missing file expected error")
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.jsonl")
+	os.WriteFile(path, []byte(`{"slave_id":1,"request":"zz","response":"03020001"}`+"\n"), 0644)
+	if _, err := NewClient(path); err == nil {
+		t.Error("NewClient() with invalid hex expected error")
+	}
+}
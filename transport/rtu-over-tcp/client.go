@@ -6,44 +6,93 @@ package rtuovertcp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/ffutop/modbus-gateway/modbus"
 	rtupacket "github.com/ffutop/modbus-gateway/modbus/rtu"
+	"github.com/ffutop/modbus-gateway/transport"
 )
 
 const (
 	tcpTimeout = 10 * time.Second
+
+	defaultReconnectBackoff    = time.Second
+	defaultMaxReconnectBackoff = 30 * time.Second
 )
 
 // Client implements Downstream interface (Modbus RTU over TCP Client).
+//
+// Connect starts a supervisor, which redials a lost connection in the background
+// and, if Heartbeat is set, checks an idle one by reading from the device, so its
+// state is known before requests fail.
 type Client struct {
-	Address string
-	Timeout time.Duration
+	Address   string
+	Timeout   time.Duration
+	TLS       *tls.Config   // Nil dials plain TCP
+	KeepAlive time.Duration // Period of TCP keep-alive probes, 0 for the system default
+
+	// Time without requests after which the supervisor sends HeartbeatRequest to
+	// HeartbeatSlaveID, 0 disables heartbeats. Any response, exceptions included,
+	// shows the device alive, a timeout closes the connection
+	Heartbeat        time.Duration
+	HeartbeatSlaveID byte
+	HeartbeatRequest modbus.ProtocolDataUnit
+
+	// Wait before redialing a lost connection, doubling after each failed attempt up
+	// to MaxReconnectBackoff. Default 1s and 30s
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration
 
-	mu   sync.Mutex
-	conn net.Conn
+	mu       sync.Mutex
+	conn     net.Conn
+	lastErr  error     // Why the connection was lost
+	lastUsed time.Time // Last exchange with the device
+	wake     chan struct{}
+	stop     chan struct{} // Closed by Close, nil while no supervisor runs
+
+	onState func(up bool, err error)
 }
 
 // NewClient allocates and initializes a TCP Client.
 func NewClient(address string) *Client {
 	return &Client{
-		Address: address,
-		Timeout: tcpTimeout,
+		Address:             address,
+		Timeout:             tcpTimeout,
+		ReconnectBackoff:    defaultReconnectBackoff,
+		MaxReconnectBackoff: defaultMaxReconnectBackoff,
+		wake:                make(chan struct{}, 1),
 	}
 }
 
+// OnState implements transport.Supervised. The supervisor calls fn as the
+// connection goes down, with the reason, and once it is up again.
+func (mb *Client) OnState(fn func(up bool, err error)) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.onState = fn
+}
+
 // Send sends a PDU to a Slave (Downstream) and returns the response PDU.
-func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (resp modbus.ProtocolDataUnit, err error) {
+	ctx, span := transport.StartSpan(ctx, transport.SpanDownstream, append(transport.SpanAttrs(slaveID, pdu, -1), slog.String("server.address", mb.Address))...)
+	defer func() { transport.EndSpan(span, resp, err) }()
+
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
+	return mb.send(ctx, slaveID, pdu)
+}
 
+// send exchanges a request with the device. Caller must hold the mutex.
+func (mb *Client) send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
 	// Ensure connection is open
 	if err := mb.connect(); err != nil {
-		return modbus.ProtocolDataUnit{}, fmt.Errorf("modbus: failed to connect to %s: %w", mb.Address, err)
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("%w: %s: %w", modbus.ErrConnection, mb.Address, err)
 	}
 
 	adu := &rtupacket.ApplicationDataUnit{
@@ -56,25 +105,32 @@ func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDat
 		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to encode ADU: %w", err)
 	}
 
-	// Set Deadline for the interaction
-	if err = mb.conn.SetDeadline(time.Now().Add(mb.Timeout)); err != nil {
-		mb.close()
-		return modbus.ProtocolDataUnit{}, err
+	// Set Deadline for the interaction, the request's own if it is earlier
+	deadline := time.Now().Add(mb.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = mb.conn.SetDeadline(deadline); err != nil {
+		mb.close(err)
+		return modbus.ProtocolDataUnit{}, modbus.IOError(err)
 	}
 
 	// Send Request
+	transport.TraceFrame(ctx, transport.DownstreamTx, aduBytes)
 	if _, err := mb.conn.Write(aduBytes); err != nil {
-		mb.close() // Close connection on write failure to force reconnect next time
-		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to write to connection: %w", err)
+		mb.close(err) // Close connection on write failure to force reconnect next time
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to write to connection: %w", modbus.IOError(err))
 	}
 
 	// Read Response
 	// We use the same RTU framing logic because RTU-over-TCP is just RTU frames sent over TCP.
 	respBytes, err := rtupacket.ReadResponse(slaveID, pdu.FunctionCode, mb.conn, time.Now().Add(mb.Timeout))
 	if err != nil {
-		mb.close() // Close connection on read failure
-		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to read response: %w", err)
+		mb.close(err) // Close connection on read failure
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to read response: %w", modbus.IOError(err))
 	}
+	mb.lastUsed = time.Now()
+	transport.TraceFrame(ctx, transport.DownstreamRx, respBytes)
 
 	// Decode Response
 	respAdu, err := rtupacket.Decode(respBytes)
@@ -94,18 +150,28 @@ func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDat
 	return respAdu.Pdu, nil
 }
 
-// Connect implements Connector interface.
+// Connect implements Connector interface. It starts the supervisor, which runs until
+// ctx is cancelled or the client is closed, also if the first attempt fails.
 func (mb *Client) Connect(ctx context.Context) error {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
-	return mb.connect()
+	err := mb.connect()
+	if mb.stop == nil {
+		mb.stop = make(chan struct{})
+		go mb.supervise(ctx, mb.stop)
+	}
+	return err
 }
 
-// Close implements Connector interface.
+// Close implements Connector interface. It stops the supervisor.
 func (mb *Client) Close() error {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
-	mb.close()
+	if mb.stop != nil {
+		close(mb.stop)
+		mb.stop = nil
+	}
+	mb.close(net.ErrClosed)
 	return nil
 }
 
@@ -114,18 +180,91 @@ func (mb *Client) connect() error {
 	if mb.conn != nil {
 		return nil
 	}
-	conn, err := net.DialTimeout("tcp", mb.Address, mb.Timeout)
+	conn, err := transport.Dial(&net.Dialer{Timeout: mb.Timeout, KeepAlive: mb.KeepAlive}, mb.Address, mb.TLS)
 	if err != nil {
+		mb.lastErr = err
 		return err
 	}
 	mb.conn = conn
+	mb.lastErr = nil
+	mb.lastUsed = time.Now()
 	return nil
 }
 
-// close closes the connection and resets the state. Caller must hold the mutex.
-func (mb *Client) close() {
+// close closes the connection and resets the state, waking the supervisor to redial.
+// Caller must hold the mutex.
+func (mb *Client) close(err error) {
 	if mb.conn != nil {
 		mb.conn.Close()
 		mb.conn = nil
+		mb.lastErr = err
+		select {
+		case mb.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// supervise keeps the connection up until stop is closed or ctx is cancelled. It
+// reports each change of the connection state, outside the mutex.
+func (mb *Client) supervise(ctx context.Context, stop <-chan struct{}) {
+	log := transport.Logger(ctx).With("addr", mb.Address)
+	backoff := mb.ReconnectBackoff
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	up := true // As reported, the gateway assumes downstreams up until told otherwise
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-mb.wake:
+		case <-timer.C:
+		}
+
+		mb.mu.Lock()
+		if mb.stop != stop {
+			mb.mu.Unlock()
+			return // Closed while woken
+		}
+		if mb.conn == nil {
+			if err := mb.connect(); err != nil {
+				log.Debug("Failed to reconnect", "err", err, "backoff", backoff)
+			}
+		} else if mb.Heartbeat > 0 && time.Since(mb.lastUsed) >= mb.Heartbeat {
+			hbCtx, cancel := context.WithTimeout(ctx, mb.Timeout)
+			_, err := mb.send(hbCtx, mb.HeartbeatSlaveID, mb.HeartbeatRequest)
+			cancel()
+			var exception *modbus.Error
+			if err != nil && !errors.As(err, &exception) && mb.conn != nil {
+				mb.close(err) // Undecodable responses, the stream is out of step
+			}
+		}
+		connected, err, onState := mb.conn != nil, mb.lastErr, mb.onState
+		var wait time.Duration
+		switch {
+		case !connected:
+			wait = backoff
+			backoff = min(backoff*2, mb.MaxReconnectBackoff)
+		case mb.Heartbeat > 0:
+			backoff = mb.ReconnectBackoff
+			wait = max(time.Until(mb.lastUsed.Add(mb.Heartbeat)), 0)
+		default:
+			backoff = mb.ReconnectBackoff
+			wait = -1 // Until woken by a lost connection
+		}
+		mb.mu.Unlock()
+
+		if connected != up {
+			up = connected
+			log.Debug("Connection state changed", "up", up, "err", err, "retry_in", wait)
+			if onState != nil {
+				onState(up, err)
+			}
+		}
+		if wait >= 0 {
+			timer.Reset(wait)
+		}
 	}
 }
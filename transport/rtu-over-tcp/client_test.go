@@ -0,0 +1,134 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package rtuovertcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	rtupacket "github.com/ffutop/modbus-gateway/modbus/rtu"
+)
+
+// flakyDevice answers reads of one register with 0x1234. It drops its first
+// connection after answering one request, and serves the later ones for good.
+func flakyDevice(t *testing.T) (string, <-chan struct{}) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	requests := make(chan struct{}, 64)
+	go func() {
+		for first := true; ; first = false {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn, limit bool) {
+				defer conn.Close()
+				resp, _ := (&rtupacket.ApplicationDataUnit{SlaveID: 1, Pdu: modbus.ProtocolDataUnit{FunctionCode: 3, Data: []byte{2, 0x12, 0x34}}}).Encode()
+				req := make([]byte, 8)
+				for {
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+					requests <- struct{}{}
+					if _, err := conn.Write(resp); err != nil || limit {
+						return
+					}
+				}
+			}(conn, first)
+		}
+	}()
+	return l.Addr().String(), requests
+}
+
+func TestClient_Supervise(t *testing.T) {
+	addr, requests := flakyDevice(t)
+	c := NewClient(addr)
+	c.Timeout = time.Second
+	c.Heartbeat = 20 * time.Millisecond
+	c.HeartbeatSlaveID = 1
+	c.HeartbeatRequest = modbus.ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 0, 0, 1}}
+	c.ReconnectBackoff = 10 * time.Millisecond
+	states := make(chan bool, 8)
+	c.OnState(func(up bool, err error) {
+		if !up && err == nil {
+			t.Error("connection down without a reason")
+		}
+		states <- up
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The heartbeat after the device dropped the connection finds it down, the
+	// supervisor redials without a request being sent
+	for _, want := range []bool{false, true} {
+		select {
+		case up := <-states:
+			if up != want {
+				t.Fatalf("state up = %v, want %v", up, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no state change to up = %v", want)
+		}
+	}
+	n := len(requests)
+	time.Sleep(100 * time.Millisecond)
+	if len(requests) <= n {
+		t.Error("no heartbeats on the new connection")
+	}
+	resp, err := c.Send(context.Background(), 1, c.HeartbeatRequest)
+	if err != nil || len(resp.Data) != 3 {
+		t.Errorf("Send() = %v, %v", resp, err)
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close() // Nothing listens
+
+	c := NewClient(addr)
+	c.ReconnectBackoff = 10 * time.Millisecond
+	c.MaxReconnectBackoff = 40 * time.Millisecond
+	states := make(chan bool, 8)
+	c.OnState(func(up bool, err error) { states <- up })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Connect(ctx); err == nil {
+		t.Fatal("Connect() to a closed port succeeded")
+	}
+	defer c.Close()
+	if up := <-states; up {
+		t.Fatal("first state reported up")
+	}
+
+	// Redialed once the device listens, within the longest backoff
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port taken meanwhile: %v", err)
+	}
+	defer l.Close()
+	select {
+	case up := <-states:
+		if !up {
+			t.Error("state reported down twice")
+		}
+	case <-time.After(time.Second):
+		t.Error("not reconnected")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package rtuovertcp
+
+import (
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func init() {
+	transport.RegisterUpstream("rtu-over-tcp", func(cfg config.UpstreamConfig) (transport.Upstream, error) {
+		allowlist, err := transport.ParseClients(cfg.AllowedClients, cfg.DeniedClients)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg, err := transport.NewTLS(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		s := NewServer(cfg.Tcp.Address)
+		s.Allowlist = allowlist
+		s.TLS = tlsCfg
+		s.MaxConns = cfg.MaxConnections
+		s.IdleTimeout = cfg.IdleTimeout
+		s.Serialize = cfg.Serialize
+		return s, nil
+	})
+	transport.RegisterDownstream("rtu-over-tcp", func(cfg config.DownstreamConfig) (transport.Downstream, error) {
+		tlsCfg, err := transport.NewDialTLS(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Tcp.ReconnectBackoff < 0 || cfg.Tcp.MaxReconnectBackoff < 0 || cfg.Tcp.Heartbeat.Interval < 0 {
+			return nil, fmt.Errorf("reconnect_backoff, max_reconnect_backoff and heartbeat interval must not be negative")
+		}
+		hb := cfg.Tcp.Heartbeat
+		if hb.Interval > 0 && (hb.Function < modbus.FuncCodeReadCoils || hb.Function > modbus.FuncCodeReadInputRegisters) {
+			return nil, fmt.Errorf("heartbeat function %d is not a read of coils, inputs or registers", hb.Function)
+		}
+		c := NewClient(cfg.Tcp.Address)
+		c.TLS = tlsCfg
+		c.KeepAlive = cfg.Tcp.KeepAlive
+		if cfg.Tcp.ReconnectBackoff > 0 {
+			c.ReconnectBackoff = cfg.Tcp.ReconnectBackoff
+		}
+		if cfg.Tcp.MaxReconnectBackoff > 0 {
+			c.MaxReconnectBackoff = cfg.Tcp.MaxReconnectBackoff
+		}
+		c.MaxReconnectBackoff = max(c.MaxReconnectBackoff, c.ReconnectBackoff)
+		c.Heartbeat = hb.Interval
+		c.HeartbeatSlaveID = hb.SlaveID
+		c.HeartbeatRequest = modbus.ProtocolDataUnit{FunctionCode: hb.Function, Data: []byte{byte(hb.Address >> 8), byte(hb.Address), 0, 1}}
+		return c, nil
+	})
+}
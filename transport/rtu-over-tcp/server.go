@@ -9,8 +9,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"net"
+	"os"
+	"time"
 
 	"github.com/ffutop/modbus-gateway/modbus"
 	rtupacket "github.com/ffutop/modbus-gateway/modbus/rtu"
@@ -19,9 +20,23 @@ import (
 
 // Server implements a Modbus RTU over TCP Server.
 // It listens on a TCP port and handles incoming connections as Modbus RTU streams.
+//
+// Each connection is a master with one request in flight at a time. Requests of
+// different masters reach the handler concurrently, and are ordered by the locks of
+// the downstreams they share, unless Serialize queues them in arrival order, which
+// is also fair as no master can queue more than one request.
 type Server struct {
-	Address  string
+	Address   string
+	Allowlist *transport.Allowlist // Clients accepted, nil accepts all
+	TLS       *transport.TLS       // Nil serves plain TCP
+	MaxConns  int                  // Connections served at once, 0 is unlimited
+	Serialize bool                 // Handle one request of all connections at a time
+
+	IdleTimeout time.Duration // Connections without a request this long are closed, 0 never
+
 	listener net.Listener
+	conns    transport.Conns
+	turn     chan struct{} // Held while a request is handled, if serialized
 }
 
 // NewServer creates a new RTU over TCP Server.
@@ -33,12 +48,17 @@ func NewServer(address string) *Server {
 
 // Start starts the TCP server.
 func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) error {
+	log := transport.Logger(ctx)
 	listener, err := net.Listen("tcp", s.Address)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", s.Address, err)
 	}
-	s.listener = listener
-	slog.Info("RTU over TCP server listening", "addr", s.Address)
+	s.listener = s.TLS.Listener(s.Allowlist.Listener(ctx, listener))
+	log.Info("RTU over TCP server listening", "addr", s.Address)
+	transport.Listening(ctx)
+	if s.Serialize {
+		s.turn = make(chan struct{}, 1)
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -52,11 +72,19 @@ func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) er
 			case <-ctx.Done():
 				return nil
 			default:
-				slog.Error("Failed to accept connection", "err", err)
+				log.Error("Failed to accept connection", "err", err)
 				continue
 			}
 		}
-		go s.handleConnection(ctx, conn, handler)
+		if ok, held := s.conns.Add(conn.RemoteAddr(), s.MaxConns); !ok {
+			log.Warn("Rejected RTU over TCP client, too many connections", "addr", conn.RemoteAddr(), "max", s.MaxConns, "client_conns", held)
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer s.conns.Done(conn.RemoteAddr())
+			s.handleConnection(ctx, conn, handler)
+		}()
 	}
 }
 
@@ -70,7 +98,22 @@ func (s *Server) Close() error {
 
 func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler transport.RequestHandler) {
 	defer conn.Close()
-	slog.Info("New RTU over TCP client connected", "addr", conn.RemoteAddr())
+	log := transport.Logger(ctx)
+	log.Info("New RTU over TCP client connected", "addr", conn.RemoteAddr())
+	ctx = transport.WithClient(ctx, conn.RemoteAddr())
+	ctx, err := s.TLS.Accept(ctx, conn)
+	if err != nil {
+		log.Warn("Rejected TLS client", "addr", conn.RemoteAddr(), "err", err)
+		return
+	}
+
+	// Per connection stats, logged on disconnect
+	var requests, exceptions int
+	connected := time.Now()
+	defer func() {
+		log.Info("RTU over TCP client disconnected", "addr", conn.RemoteAddr(), "requests", requests,
+			"exceptions", exceptions, "duration", time.Since(connected).Round(time.Millisecond))
+	}()
 
 	// Buffer for reading (reusing max size from RTU package)
 	buf := make([]byte, rtupacket.MaxSize)
@@ -84,10 +127,15 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler tr
 
 		// 1. Read first byte (SlaveID) to detect start of frame
 		// We limit read to 1 byte to strictly control the stream consumption
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
 		n, err := conn.Read(buf[:1])
 		if err != nil {
-			if err != io.EOF {
-				slog.Error("Connection read error", "addr", conn.RemoteAddr(), "err", err)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Warn("Closing idle RTU over TCP client", "addr", conn.RemoteAddr(), "idle_timeout", s.IdleTimeout)
+			} else if err != io.EOF {
+				log.Error("Connection read error", "addr", conn.RemoteAddr(), "err", err)
 			}
 			return
 		}
@@ -96,10 +144,10 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler tr
 		}
 
 		// 2. Read enough header bytes to determine frame length.
-		// We need at least 7 bytes total (including SlaveID) for some commands (like 0x10)
-		// to contain the ByteCount field.
+		// Some commands (like 0x10) need 7 bytes (including SlaveID) to contain the
+		// ByteCount field, shorter requests (like 0x18) must not read into the next frame.
 		current := 1
-		need := 7
+		need := 2
 
 		for current < need {
 			n, err := conn.Read(buf[current:need])
@@ -107,13 +155,16 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler tr
 				return // Stop on error
 			}
 			current += n
+			if current == 2 {
+				need = rtupacket.RequestHeaderLength(buf[1])
+			}
 		}
 
 		// 3. Determine expected length
 		functionCode := buf[1]
 		expectedLen, err := rtupacket.CalculateRequestLength(functionCode, buf[:current])
 		if err != nil {
-			slog.Warn("Invalid RTU frame header", "func", functionCode, "err", err)
+			log.Warn("Invalid RTU frame header", "func", functionCode, "err", err)
 			// Strategy: Close connection on protocol violation to reset stream state
 			// or try to skip? Closing is safer for RTU over TCP.
 			return
@@ -129,26 +180,27 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler tr
 		}
 
 		// 5. Decode and Verify CRC
+		rctx, span := transport.StartSpan(transport.TraceRequest(ctx), transport.SpanUpstream)
+		transport.TraceFrame(rctx, transport.UpstreamRx, buf[:expectedLen])
 		adu, err := rtupacket.Decode(buf[:expectedLen])
 		if err != nil {
-			slog.Warn("RTU frame decode failed", "err", err)
+			log.Warn("RTU frame decode failed", "err", err)
+			span.End(err)
 			continue
 		}
+		span.SetAttributes(transport.SpanAttrs(adu.SlaveID, adu.Pdu, -1)...)
 
 		// 6. Handle Request
-		respPdu, err := handler(ctx, adu.SlaveID, adu.Pdu)
+		requests++
+		respPdu, err := s.serve(rctx, handler, adu)
 		if err != nil {
-			slog.Error("Handler failed", "err", err)
-			// Map error to Modbus exception code
-			exceptionCode := modbus.ExceptionCodeServerDeviceFailure
-			if errors.Is(err, context.DeadlineExceeded) {
-				exceptionCode = modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond
-			}
-			// Construct Exception PDU: Function Code | 0x80
-			respPdu = modbus.ProtocolDataUnit{
-				FunctionCode: adu.Pdu.FunctionCode | 0x80,
-				Data:         []byte{byte(exceptionCode)},
-			}
+			log.Error("Handler failed", "err", err)
+			respPdu = modbus.ExceptionResponse(adu.Pdu, err)
+		}
+
+		if attr, ok := transport.ExceptionAttr(respPdu); ok {
+			span.SetAttributes(attr)
+			exceptions++
 		}
 
 		// 7. Send Response
@@ -159,13 +211,30 @@ func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler tr
 
 		respRaw, err := respAdu.Encode()
 		if err != nil {
-			slog.Error("Failed to encode response", "err", err)
+			log.Error("Failed to encode response", "err", err)
+			span.End(err)
 			continue
 		}
 
-		if _, err := conn.Write(respRaw); err != nil {
-			slog.Error("Failed to write response", "err", err)
+		transport.TraceFrame(rctx, transport.UpstreamTx, respRaw)
+		_, err = conn.Write(respRaw)
+		span.End(err)
+		if err != nil {
+			log.Error("Failed to write response", "err", err)
 			return
 		}
 	}
-}
\ No newline at end of file
+}
+
+// serve hands a request to handler, after those of other connections queued first if serialized.
+func (s *Server) serve(ctx context.Context, handler transport.RequestHandler, adu *rtupacket.ApplicationDataUnit) (modbus.ProtocolDataUnit, error) {
+	if s.turn != nil {
+		select {
+		case s.turn <- struct{}{}:
+			defer func() { <-s.turn }()
+		case <-ctx.Done():
+			return modbus.ProtocolDataUnit{}, ctx.Err()
+		}
+	}
+	return handler(ctx, adu.SlaveID, adu.Pdu)
+}
@@ -5,7 +5,10 @@ package rtuovertcp
 
 import (
 	"context"
+	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -86,3 +89,74 @@ func TestServer_LifeCycle(t *testing.T) {
 	cancel()
 	s.Close()
 }
+
+func TestServer_MultipleMasters(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewServer(addr)
+	s.MaxConns = 2
+	s.Serialize = true
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var active atomic.Int32
+	var overlapped atomic.Bool
+	go s.Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if active.Add(1) > 1 {
+			overlapped.Store(true)
+		}
+		defer active.Add(-1)
+		time.Sleep(20 * time.Millisecond)
+		return modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x02, slaveID, 0x00}}, nil
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+
+	// The third master is over the limit
+	conns[2].SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conns[2].Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read on connection over the limit: err = %v, want EOF", err)
+	}
+
+	var wg sync.WaitGroup
+	for i, conn := range conns[:2] {
+		wg.Add(1)
+		go func(slaveID byte, conn net.Conn) {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				req, _ := (&rtupacket.ApplicationDataUnit{SlaveID: slaveID, Pdu: modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}}).Encode()
+				if _, err := conn.Write(req); err != nil {
+					t.Errorf("Write failed: %v", err)
+					return
+				}
+				resp, err := rtupacket.ReadResponse(slaveID, 0x03, conn, time.Now().Add(time.Second))
+				if err != nil {
+					t.Errorf("ReadResponse failed: %v", err)
+					return
+				}
+				if resp[3] != slaveID {
+					t.Errorf("master %d got the response of slave %d", slaveID, resp[3])
+				}
+			}
+		}(byte(i+1), conn)
+	}
+	wg.Wait()
+
+	if overlapped.Load() {
+		t.Error("requests of different masters handled at once with serialize")
+	}
+}
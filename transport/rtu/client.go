@@ -6,6 +6,7 @@
 package rtu
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"github.com/ffutop/modbus-gateway/internal/config"
 	"github.com/ffutop/modbus-gateway/modbus"
 	rtupacket "github.com/ffutop/modbus-gateway/modbus/rtu"
+	"github.com/ffutop/modbus-gateway/transport"
 )
 
 // Client implements Downstream interface (Modbus RTU Master).
@@ -33,13 +35,33 @@ func NewClient(cfg config.SerialConfig) *Client {
 	client.serialPort.Config.StopBits = cfg.StopBits
 	client.serialPort.Config.Parity = cfg.Parity
 	client.serialPort.Config.Timeout = cfg.Timeout
+	client.RqstPause = cfg.RqstPause
+	client.Echo = cfg.Echo
+	client.ReopenBackoff = defaultReopenBackoff
+	if cfg.ReopenBackoff > 0 {
+		client.ReopenBackoff = cfg.ReopenBackoff
+	}
+	client.MaxReopenBackoff = defaultMaxReopenBackoff
+	if cfg.MaxReopenBackoff > 0 {
+		client.MaxReopenBackoff = cfg.MaxReopenBackoff
+	}
 
-	client.IdleTimeout = serialIdleTimeout
+	switch {
+	case cfg.KeepOpen, cfg.IdleTimeout < 0:
+		client.IdleTimeout = 0 // Never close
+	case cfg.IdleTimeout == 0:
+		client.IdleTimeout = serialIdleTimeout
+	default:
+		client.IdleTimeout = cfg.IdleTimeout
+	}
 	return client
 }
 
 // Send sends a PDU to the Downstream Slave
-func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (resp modbus.ProtocolDataUnit, err error) {
+	ctx, span := transport.StartSpan(ctx, transport.SpanDownstream, append(transport.SpanAttrs(slaveID, pdu, -1), slog.String("modbus.serial.device", mb.serialPort.Config.Address))...)
+	defer func() { transport.EndSpan(span, resp, err) }()
+
 	// Wrap PDU into RTU ADU
 	adu := &rtupacket.ApplicationDataUnit{
 		SlaveID: slaveID,
@@ -74,6 +96,10 @@ func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDat
 // rtuSerialTransporter implements underlying serial comms.
 type rtuSerialTransporter struct {
 	serialPort
+
+	RqstPause time.Duration // Bus idle time between the end of a transaction and the next request
+	Echo      bool          // Half-duplex adapter without echo suppression, requests are read back first
+	lastDone  time.Time     // End of the last transaction
 }
 
 func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error) {
@@ -81,32 +107,84 @@ func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (ad
 	defer mb.mu.Unlock()
 
 	if err = mb.connect(ctx); err != nil {
-		return
+		return nil, modbus.IOError(err)
+	}
+
+	// Slow slaves miss requests following their response too closely; the bus stays
+	// idle for the request pause, and at least 3.5 characters, after each transaction
+	if wait := time.Until(mb.lastDone.Add(max(mb.RqstPause, mb.calculateDelay(0)))); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, modbus.IOError(ctx.Err())
+		case <-time.After(wait):
+		}
 	}
+	defer func() { mb.lastDone = time.Now() }()
+
 	mb.lastActivity = time.Now()
 	mb.startCloseTimer()
 
-	slog.Debug("send to modbus slave", "request", hex.EncodeToString(aduRequest))
+	transport.Logger(ctx).Debug("send to modbus slave", "request", hex.EncodeToString(aduRequest))
+	transport.TraceFrame(ctx, transport.DownstreamTx, aduRequest)
 	if _, err = mb.port.Write(aduRequest); err != nil {
-		return
+		return nil, mb.fail(ctx, err)
 	}
 
 	bytesToRead := rtupacket.CalculateResponseLength(aduRequest)
+	sendChars := len(aduRequest)
+	if mb.Echo {
+		if err = mb.readEcho(aduRequest, time.Now().Add(mb.Config.Timeout)); err != nil {
+			return nil, mb.fail(ctx, err)
+		}
+		sendChars = 0 // Sent already
+	}
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-time.After(mb.calculateDelay(len(aduRequest) + bytesToRead)):
+		return nil, modbus.IOError(ctx.Err())
+	case <-time.After(mb.calculateDelay(sendChars + bytesToRead)):
 	}
 
 	data, err := rtupacket.ReadResponse(aduRequest[0], aduRequest[1], mb.port, time.Now().Add(mb.Config.Timeout))
 	if err != nil {
-		return nil, err
+		return nil, mb.fail(ctx, err)
 	}
-	slog.Debug("recv from modbus slave", "response", hex.EncodeToString(data[:]))
+	transport.Logger(ctx).Debug("recv from modbus slave", "response", hex.EncodeToString(data[:]))
+	transport.TraceFrame(ctx, transport.DownstreamRx, data)
 	aduResponse = data
 	return
 }
 
+// fail classifies an error of the port. If the device is gone, e.g. a USB adapter
+// unplugged, the port is closed so the next request opens it again, instead of every
+// request failing on the stale handle. Caller must hold the mutex.
+func (mb *rtuSerialTransporter) fail(ctx context.Context, err error) error {
+	if gone(err) {
+		transport.Logger(ctx).Warn("Serial device failed, reopening", "device", mb.Config.Address, "err", err)
+		mb.close()
+	}
+	return modbus.IOError(err)
+}
+
+// readEcho reads back the echo of frame and discards it, so the framer only sees the response.
+func (mb *rtuSerialTransporter) readEcho(frame []byte, deadline time.Time) error {
+	echo := make([]byte, len(frame))
+	for n := 0; n < len(echo); {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: no echo of the request", modbus.ErrTimeout)
+		}
+		m, err := mb.port.Read(echo[n:])
+		if err != nil {
+			return modbus.IOError(err)
+		}
+		n += m
+	}
+	if !bytes.Equal(echo, frame) {
+		// Another master or noise on the bus
+		return fmt.Errorf("%w: echo % X does not match the request % X", modbus.ErrInvalidFrame, echo, frame)
+	}
+	return nil
+}
+
 // calculateDelay calculates the needed delay to separate frames.
 func (mb *rtuSerialTransporter) calculateDelay(chars int) time.Duration {
 	var characterDelay, frameDelay int
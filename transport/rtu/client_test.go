@@ -6,12 +6,17 @@ package rtu
 import (
 	"bytes"
 	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/ffutop/modbus-gateway/internal/config"
 	"github.com/ffutop/modbus-gateway/modbus"
 	"github.com/ffutop/modbus-gateway/modbus/crc"
+	"github.com/ffutop/modbus-gateway/pkg/vserial"
 )
 
 func TestClient_Send(t *testing.T) {
@@ -80,6 +85,106 @@ func TestClient_Send(t *testing.T) {
 	}
 }
 
+func TestNewClient_IdleTimeout(t *testing.T) {
+	tests := []struct {
+		cfg  config.SerialConfig
+		want time.Duration
+	}{
+		{config.SerialConfig{}, serialIdleTimeout},
+		{config.SerialConfig{IdleTimeout: 5 * time.Minute}, 5 * time.Minute},
+		{config.SerialConfig{IdleTimeout: -time.Second}, 0},
+		{config.SerialConfig{IdleTimeout: time.Second, KeepOpen: true}, 0},
+	}
+	for _, tt := range tests {
+		if got := NewClient(tt.cfg).IdleTimeout; got != tt.want {
+			t.Errorf("NewClient(%+v).IdleTimeout = %v, want %v", tt.cfg, got, tt.want)
+		}
+	}
+
+	// A port kept open survives idle periods
+	client := NewClient(config.SerialConfig{KeepOpen: true})
+	client.port = &mockPort{}
+	client.startCloseTimer()
+	client.closeIdle()
+	if client.port == nil {
+		t.Error("port kept open was closed when idle")
+	}
+
+	client = NewClient(config.SerialConfig{IdleTimeout: time.Millisecond})
+	client.port = &mockPort{}
+	client.closeIdle()
+	if client.port != nil {
+		t.Error("idle port was not closed")
+	}
+}
+
+func TestClient_RqstPause(t *testing.T) {
+	respADU := []byte{0x01, 0x03, 0x02, 0xAA, 0xBB}
+	var c crc.CRC
+	c.Reset().PushBytes(respADU)
+	sum := c.Value()
+	respADU = append(respADU, byte(sum), byte(sum>>8))
+
+	client := NewClient(config.SerialConfig{BaudRate: 115200, RqstPause: 50 * time.Millisecond})
+	client.port = &mockPort{Reader: bytes.NewReader(append(append([]byte(nil), respADU...), respADU...)), Writer: &bytes.Buffer{}}
+	client.Config.Timeout = 100 * time.Millisecond
+
+	ctx := context.Background()
+	pdu := modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+	if _, err := client.Send(ctx, 1, pdu); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	start := time.Now()
+	if _, err := client.Send(ctx, 1, pdu); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("second request sent after %v, want the 50ms request pause", d)
+	}
+
+	// The pause gives way to a canceled request
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.Send(ctx, 1, pdu); err == nil {
+		t.Error("Send during the request pause succeeded with a canceled context")
+	}
+}
+
+func TestClient_Echo(t *testing.T) {
+	req := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}
+	resp := []byte{0x01, 0x03, 0x02, 0xAA, 0xBB}
+	var c crc.CRC
+	c.Reset().PushBytes(req)
+	sum := c.Value()
+	req = append(req, byte(sum), byte(sum>>8))
+	c.Reset().PushBytes(resp)
+	sum = c.Value()
+	resp = append(resp, byte(sum), byte(sum>>8))
+
+	pdu := modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x00, 0x00, 0x01}}
+	send := func(echo []byte) (modbus.ProtocolDataUnit, error) {
+		client := NewClient(config.SerialConfig{BaudRate: 115200, Echo: true})
+		client.port = &mockPort{Reader: bytes.NewReader(append(append([]byte(nil), echo...), resp...)), Writer: &bytes.Buffer{}}
+		client.Config.Timeout = 100 * time.Millisecond
+		return client.Send(context.Background(), 1, pdu)
+	}
+
+	got, err := send(req)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if !bytes.Equal(got.Data, []byte{0x02, 0xAA, 0xBB}) {
+		t.Errorf("Response Data mismatch: %X", got.Data)
+	}
+
+	// An echo differing from the request means a collision on the bus
+	garbled := append([]byte(nil), req...)
+	garbled[3] ^= 0xFF
+	if _, err := send(garbled); !errors.Is(err, modbus.ErrInvalidFrame) {
+		t.Errorf("Send with garbled echo: err = %v, want invalid frame", err)
+	}
+}
+
 func TestClient_CRCError(t *testing.T) {
 	// Construct Response with BAD CRC
 	respADU := []byte{0x01, 0x03, 0x02, 0xAA, 0xBB, 0xFF, 0xFF} // Bad CRC
@@ -102,3 +207,87 @@ func TestClient_CRCError(t *testing.T) {
 		// t.Log("Got expected error:", err)
 	}
 }
+
+func TestClientServer_VirtualSerial(t *testing.T) {
+	pair, err := vserial.Open()
+	if err != nil {
+		t.Skipf("virtual serial ports unavailable: %v", err)
+	}
+	defer pair.Close()
+
+	serialConfig := func(device string) config.SerialConfig {
+		return config.SerialConfig{Device: device, BaudRate: 19200, DataBits: 8, Parity: "N", StopBits: 1, Timeout: time.Second}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := NewServer(serialConfig(pair.B))
+	go server.Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, slaveID, pdu.Data[1]}}, nil
+	})
+
+	client := NewClient(serialConfig(pair.A))
+	defer client.Close()
+
+	resp, err := client.Send(ctx, 7, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x2A, 0x00, 0x01}})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if want := []byte{0x02, 0x07, 0x2A}; resp.FunctionCode != 0x03 || !bytes.Equal(resp.Data, want) {
+		t.Errorf("Response mismatch: %02X % X", resp.FunctionCode, resp.Data)
+	}
+}
+
+// unpluggedPort fails like the handle of a USB adapter removed from the bus.
+type unpluggedPort struct{}
+
+func (unpluggedPort) Read(p []byte) (int, error)  { return 0, syscall.EIO }
+func (unpluggedPort) Write(p []byte) (int, error) { return 0, syscall.EIO }
+func (unpluggedPort) Close() error                { return nil }
+
+func TestClient_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	client := NewClient(config.SerialConfig{Device: filepath.Join(dir, "ttyUSB*"), BaudRate: 19200, DataBits: 8, Parity: "N", StopBits: 1, Timeout: time.Second, ReopenBackoff: 20 * time.Millisecond, KeepOpen: true})
+	defer client.Close()
+	client.port = unpluggedPort{}
+	pdu := modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x2A, 0x00, 0x01}}
+
+	if _, err := client.Send(context.Background(), 7, pdu); !errors.Is(err, modbus.ErrConnection) {
+		t.Fatalf("Send on an unplugged adapter: err = %v, want a connection error", err)
+	}
+	if client.port != nil {
+		t.Fatal("port of an unplugged adapter kept open")
+	}
+
+	// Nothing matches until the adapter shows up again, attempts meanwhile fail at once
+	if _, err := client.Send(context.Background(), 7, pdu); err == nil || !strings.Contains(err.Error(), "no device matches") {
+		t.Fatalf("Send without a device: err = %v", err)
+	}
+	if _, err := client.Send(context.Background(), 7, pdu); err == nil || !strings.Contains(err.Error(), "retrying in") {
+		t.Fatalf("Send during the backoff: err = %v", err)
+	}
+
+	pair, err := vserial.Open()
+	if err != nil {
+		t.Skipf("virtual serial ports unavailable: %v", err)
+	}
+	defer pair.Close()
+	if err := pair.Link(filepath.Join(dir, "ttyUSB1"), filepath.Join(dir, "slave")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := NewServer(config.SerialConfig{Device: filepath.Join(dir, "slave"), BaudRate: 19200, DataBits: 8, Parity: "N", StopBits: 1, Timeout: time.Second})
+	go server.Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{0x02, slaveID, pdu.Data[1]}}, nil
+	})
+
+	time.Sleep(50 * time.Millisecond) // Beyond the doubled backoff
+	resp, err := client.Send(ctx, 7, pdu)
+	if err != nil {
+		t.Fatalf("Send after the adapter came back: %v", err)
+	}
+	if want := []byte{0x02, 0x07, 0x2A}; !bytes.Equal(resp.Data, want) {
+		t.Errorf("Response mismatch: % X", resp.Data)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package rtu
+
+import (
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func init() {
+	transport.RegisterUpstream("rtu", func(cfg config.UpstreamConfig) (transport.Upstream, error) {
+		return NewServer(cfg.Serial), nil
+	})
+	transport.RegisterDownstream("rtu", func(cfg config.DownstreamConfig) (transport.Downstream, error) {
+		return NewClient(cfg.Serial), nil
+	})
+}
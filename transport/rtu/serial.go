@@ -6,10 +6,15 @@ package rtu
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/grid-x/serial"
@@ -19,6 +24,9 @@ const (
 	// Default timeout
 	serialTimeout     = 5 * time.Second
 	serialIdleTimeout = 60 * time.Second
+
+	defaultReopenBackoff    = time.Second
+	defaultMaxReopenBackoff = 30 * time.Second
 )
 
 // serialPort has configuration and I/O controller.
@@ -28,11 +36,21 @@ type serialPort struct {
 
 	IdleTimeout time.Duration
 
+	// Wait after a failed attempt to open the port before the next, doubling after
+	// each up to MaxReopenBackoff. Requests meanwhile fail at once. Zero retries
+	// with every request
+	ReopenBackoff    time.Duration
+	MaxReopenBackoff time.Duration
+
 	mu sync.Mutex
 	// port is platform-dependent data structure for serial port.
 	port         io.ReadWriteCloser
 	lastActivity time.Time
 	closeTimer   *time.Timer
+
+	openErr error         // Why the last attempt to open failed, nil once open
+	backoff time.Duration // Wait after the last failed attempt
+	retryAt time.Time     // No attempt to open before
 }
 
 func (modbus *serialPort) Connect(ctx context.Context) (err error) {
@@ -49,16 +67,58 @@ func (modbus *serialPort) connect(ctx context.Context) error {
 		return ctx.Err()
 	default:
 	}
-	if modbus.port == nil {
-		port, err := serial.Open(&modbus.Config)
-		if err != nil {
-			return fmt.Errorf("could not open %s: %w", modbus.Config.Address, err)
-		}
-		modbus.port = port
+	if modbus.port != nil {
+		return nil
+	}
+	if wait := time.Until(modbus.retryAt); wait > 0 {
+		return fmt.Errorf("could not open %s: %w, retrying in %v", modbus.Config.Address, modbus.openErr, wait.Round(time.Millisecond))
+	}
+	device, err := findDevice(modbus.Config.Address)
+	if err == nil {
+		cfg := modbus.Config
+		cfg.Address = device
+		modbus.port, err = serial.Open(&cfg)
+	}
+	if err != nil {
+		modbus.openErr = err
+		modbus.backoff = min(max(modbus.backoff*2, modbus.ReopenBackoff), max(modbus.MaxReopenBackoff, modbus.ReopenBackoff))
+		modbus.retryAt = time.Now().Add(modbus.backoff)
+		return fmt.Errorf("could not open %s: %w", modbus.Config.Address, err)
+	}
+	if modbus.openErr != nil || device != modbus.Config.Address {
+		slog.Info("Serial port opened", "device", device, "pattern", modbus.Config.Address)
 	}
+	modbus.openErr = nil
+	modbus.backoff = 0
+	modbus.retryAt = time.Time{}
 	return nil
 }
 
+// findDevice returns the device matching pattern, the first in lexical order if it
+// has wildcards, e.g. "/dev/serial/by-id/usb-FTDI_*" finding an adapter again after
+// it was plugged into another port and renamed.
+func findDevice(pattern string) (string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return pattern, nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no device matches %s", pattern)
+	}
+	sort.Strings(matches)
+	return matches[0], nil
+}
+
+// gone reports whether err shows the device itself failed, e.g. a USB adapter
+// unplugged, rather than a slave not answering. The port has to be opened again.
+func gone(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ENXIO) || errors.Is(err, syscall.ENODEV) ||
+		errors.Is(err, syscall.EBADF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 func (modbus *serialPort) Close() (err error) {
 	modbus.mu.Lock()
 	defer modbus.mu.Unlock()
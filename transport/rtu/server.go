@@ -8,7 +8,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log/slog"
 
 	"github.com/ffutop/modbus-gateway/internal/config"
 	"github.com/ffutop/modbus-gateway/modbus"
@@ -33,8 +32,13 @@ func NewServer(cfg config.SerialConfig) *Server {
 
 // Start starts the RTU server.
 func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) error {
+	log := transport.Logger(ctx)
+	device, err := findDevice(s.Config.Device)
+	if err != nil {
+		return fmt.Errorf("failed to open serial port %s: %w", s.Config.Device, err)
+	}
 	spConfig := &serial.Config{
-		Address:  s.Config.Device,
+		Address:  device,
 		BaudRate: s.Config.BaudRate,
 		DataBits: s.Config.DataBits,
 		StopBits: s.Config.StopBits,
@@ -47,7 +51,8 @@ func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) er
 		return fmt.Errorf("failed to open serial port %s: %w", s.Config.Device, err)
 	}
 	defer port.Close()
-	slog.Info("RTU Server listening", "device", s.Config.Device)
+	log.Info("RTU Server listening", "device", device)
+	transport.Listening(ctx)
 
 	go func() {
 		<-ctx.Done()
@@ -58,6 +63,7 @@ func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) er
 }
 
 func (s *Server) scanLoop(ctx context.Context, port io.ReadWriteCloser, handler transport.RequestHandler) error {
+	log := transport.Logger(ctx)
 	buf := make([]byte, rtupacket.MaxSize)
 
 	for {
@@ -80,9 +86,9 @@ func (s *Server) scanLoop(ctx context.Context, port io.ReadWriteCloser, handler
 			continue
 		}
 
-		// Read header (attempt 7 bytes total to cover ByteCount for variable length functions)
+		// Read header, as far as the function code needs to tell the frame length
 		current := 1
-		need := 7
+		need := 2
 
 		for current < need {
 			n, err := port.Read(buf[current:need])
@@ -90,6 +96,9 @@ func (s *Server) scanLoop(ctx context.Context, port io.ReadWriteCloser, handler
 				break
 			}
 			current += n
+			if current == 2 {
+				need = rtupacket.RequestHeaderLength(buf[1])
+			}
 		}
 
 		if current < 2 {
@@ -101,6 +110,7 @@ func (s *Server) scanLoop(ctx context.Context, port io.ReadWriteCloser, handler
 		// Determine expected length
 		expectedLen, err := rtupacket.CalculateRequestLength(functionCode, buf[:current])
 		if err != nil {
+			log.Warn("Dropped invalid RTU frame header", "func", functionCode, "err", err)
 			continue
 		}
 
@@ -125,11 +135,18 @@ func (s *Server) scanLoop(ctx context.Context, port io.ReadWriteCloser, handler
 		}
 
 		// Dispatch
+		rctx, span := transport.StartSpan(transport.TraceRequest(ctx), transport.SpanUpstream, transport.SpanAttrs(adu.SlaveID, adu.Pdu, -1)...)
+		transport.TraceFrame(rctx, transport.UpstreamRx, buf[:expectedLen])
 		go func(sid byte, pdu modbus.ProtocolDataUnit) {
-			respPDU, err := handler(ctx, sid, pdu)
+			respPDU, err := handler(rctx, sid, pdu)
+			defer func() { span.End(err) }()
 			if err != nil {
-				slog.Error("Upstream handler failed", "err", err)
-				return
+				log.Error("Upstream handler failed", "err", err)
+				respPDU = modbus.ExceptionResponse(pdu, err)
+				err = nil
+			}
+			if attr, ok := transport.ExceptionAttr(respPDU); ok {
+				span.SetAttributes(attr)
 			}
 
 			// Construct Response ADU
@@ -140,11 +157,12 @@ func (s *Server) scanLoop(ctx context.Context, port io.ReadWriteCloser, handler
 
 			respBuf, err := respAdu.Encode()
 			if err != nil {
-				slog.Error("Failed to encode response ADU", "err", err)
+				log.Error("Failed to encode response ADU", "err", err)
 				return
 			}
 
-			_, _ = port.Write(respBuf)
+			transport.TraceFrame(rctx, transport.UpstreamTx, respBuf)
+			_, err = port.Write(respBuf)
 
 		}(adu.SlaveID, adu.Pdu)
 	}
@@ -89,6 +89,10 @@ func TestServer_FunctionCodes(t *testing.T) {
 	}{
 		{"ReadCoils", 0x01, []byte{0x01, 0x00, 0x00, 0x00, 0x01}, 8},
 		{"WriteSingleRegister", 0x06, []byte{0x06, 0x00, 0x00, 0xAA, 0xBB}, 8},
+		{"ReportServerID", 0x11, []byte{0x11}, 4},
+		{"MaskWriteRegister", 0x16, []byte{0x16, 0x00, 0x04, 0x00, 0xF2, 0x00, 0x25}, 10},
+		{"ReadWriteMultipleRegisters", 0x17, []byte{0x17, 0x00, 0x03, 0x00, 0x06, 0x00, 0x0E, 0x00, 0x01, 0x02, 0x00, 0xFF}, 1 + 1 + 4 + 4 + 1 + 2 + 2},
+		{"ReadFIFOQueue", 0x18, []byte{0x18, 0x04, 0xDE}, 6},
 		// 0x10 Header: Func(1)+Addr(2)+Quant(2)+ByteCount(1) + Data(N)
 		// 0x10 Write 2 Regs (4 bytes)
 		{"WriteMultipleRegisters", 0x10, []byte{0x10, 0x00, 0x01, 0x00, 0x02, 0x04, 0x11, 0x22, 0x33, 0x44}, 1 + 1 + 2 + 2 + 1 + 4 + 2},
@@ -133,4 +137,37 @@ func TestServer_FunctionCodes(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestScanLoop_ShortRequests(t *testing.T) {
+	// Read FIFO Queue and Report Server ID requests are shorter than the header of
+	// write multiple requests, reading the header must not swallow the next frame.
+	var input []byte
+	for _, frame := range [][]byte{{0x01, 0x18, 0x04, 0xDE}, {0x01, 0x11}, {0x01, 0x03, 0x00, 0x00, 0x00, 0x01}} {
+		var c crc.CRC
+		c.Reset().PushBytes(frame)
+		sum := c.Value()
+		input = append(append(input, frame...), byte(sum), byte(sum>>8))
+	}
+	port := &mockPort{Reader: bytes.NewReader(input), Writer: io.Discard}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	handled := make(chan byte, 3)
+	handler := func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		handled <- pdu.FunctionCode
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{}}, nil
+	}
+
+	go (&Server{}).scanLoop(ctx, port, handler)
+
+	got := map[byte]bool{}
+	for len(got) < 3 {
+		select {
+		case code := <-handled:
+			got[code] = true
+		case <-time.After(300 * time.Millisecond):
+			t.Fatalf("handled function codes %v, want 0x18, 0x11 and 0x03", got)
+		}
+	}
+}
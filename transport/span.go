@@ -0,0 +1,101 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// Names of the spans of a request, from its upstream to the device answering it
+const (
+	SpanUpstream   = "modbus.upstream"   // From receiving the request of a master to writing its response
+	SpanRoute      = "modbus.route"      // Handling by the gateway, from checks and routing to the response of a downstream
+	SpanDownstream = "modbus.downstream" // One exchange with a device, each retry has its own
+)
+
+type (
+	tracerKey struct{}
+	spanKey   struct{}
+)
+
+// Span is a timed step of a request, see Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...slog.Attr)
+	// AddEvent records a point in time of the span, e.g. a frame sent.
+	AddEvent(name string, attrs ...slog.Attr)
+	// End ends the span, as failed if err is not nil.
+	End(err error)
+}
+
+// Tracer records the spans of requests, e.g. to export them to OpenTelemetry.
+// Start returns ctx carrying the new span, which is the parent of the spans started
+// under it.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// WithTracer returns ctx under which transports and the gateway start spans of the
+// requests with t.
+func WithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// StartSpan starts a span of a request with the tracer of ctx, or a span recording
+// nothing if ctx carries none. The span must be ended.
+func StartSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	t, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		return ctx, noopSpan{}
+	}
+	ctx, span := t.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFromContext returns the span last started under ctx, or a span recording
+// nothing.
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// SpanAttrs returns the attributes of a request common to its spans: the slave ID,
+// the function code and, unless negative, the transaction ID of its frames.
+func SpanAttrs(slaveID byte, pdu modbus.ProtocolDataUnit, tid int) []slog.Attr {
+	attrs := []slog.Attr{slog.Int("modbus.slave_id", int(slaveID)), slog.Int("modbus.function_code", int(pdu.FunctionCode))}
+	if tid >= 0 {
+		attrs = append(attrs, slog.Int("modbus.transaction_id", tid))
+	}
+	return attrs
+}
+
+// ExceptionAttr returns the attribute of the exception code of resp, if it is an
+// exception response.
+func ExceptionAttr(resp modbus.ProtocolDataUnit) (slog.Attr, bool) {
+	if resp.FunctionCode&0x80 == 0 || len(resp.Data) == 0 {
+		return slog.Attr{}, false
+	}
+	return slog.Int("modbus.exception_code", int(resp.Data[0])), true
+}
+
+// EndSpan ends span of a request answered with resp or failed with err, noting the
+// exception code of resp if it is an exception response.
+func EndSpan(span Span, resp modbus.ProtocolDataUnit, err error) {
+	if attr, ok := ExceptionAttr(resp); ok {
+		span.SetAttributes(attr)
+	}
+	span.End(err)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...slog.Attr)    {}
+func (noopSpan) AddEvent(string, ...slog.Attr) {}
+func (noopSpan) End(error)                     {}
@@ -8,13 +8,27 @@ import (
 	"fmt"
 
 	"github.com/ffutop/modbus-gateway/modbus"
+	tcppacket "github.com/ffutop/modbus-gateway/modbus/tcp"
 )
 
+// Verification levels of response headers.
 const (
-	tcpMinSize = 8
-	tcpMaxSize = 260
+	VerifyStrict        = "strict"         // Transaction and unit ID must match the request
+	VerifyTransactionID = "transaction_id" // Transaction ID must match, the unit ID is not checked
+	VerifyNone          = "none"           // Responses are matched to requests by order
 )
 
+// ParseVerify checks a verification level, empty is VerifyTransactionID.
+func ParseVerify(s string) (string, error) {
+	switch s {
+	case "":
+		return VerifyTransactionID, nil
+	case VerifyStrict, VerifyTransactionID, VerifyNone:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown verify level %q, want %q, %q or %q", s, VerifyStrict, VerifyTransactionID, VerifyNone)
+}
+
 type ApplicationDataUnit struct {
 	TransactionID uint16
 	ProtocolID    uint16
@@ -24,8 +38,8 @@ type ApplicationDataUnit struct {
 }
 
 func Decode(raw []byte) (adu *ApplicationDataUnit, err error) {
-	if len(raw) < tcpMinSize {
-		err = fmt.Errorf("modbus: request length '%v' does not meet minimum '%v'", len(raw), tcpMinSize)
+	if len(raw) < tcppacket.MinSize {
+		err = fmt.Errorf("%w: length '%v' does not meet minimum '%v'", modbus.ErrInvalidFrame, len(raw), tcppacket.MinSize)
 		return
 	}
 	adu = &ApplicationDataUnit{}
@@ -40,8 +54,8 @@ func Decode(raw []byte) (adu *ApplicationDataUnit, err error) {
 
 func (adu *ApplicationDataUnit) Encode() (raw []byte, err error) {
 	length := len(adu.Pdu.Data) + 8
-	if length > tcpMaxSize {
-		err = fmt.Errorf("modbus: length of data '%v' must not be bigger than '%v'", length, tcpMaxSize)
+	if length > tcppacket.MaxSize {
+		err = fmt.Errorf("modbus: length of data '%v' must not be bigger than '%v'", length, tcppacket.MaxSize)
 		return
 	}
 	raw = make([]byte, length)
@@ -59,10 +73,18 @@ func (adu *ApplicationDataUnit) Encode() (raw []byte, err error) {
 	return
 }
 
-func (req *ApplicationDataUnit) Verify(resp *ApplicationDataUnit) (err error) {
+// Verify checks the header of resp against the request at the given level.
+func (req *ApplicationDataUnit) Verify(resp *ApplicationDataUnit, level string) (err error) {
+	if level == VerifyNone {
+		return
+	}
 	// Transaction ID must match
 	if resp.TransactionID != req.TransactionID {
-		err = fmt.Errorf("modbus: response transaction id '%v' does not match request '%v'", resp.TransactionID, req.TransactionID)
+		err = fmt.Errorf("%w: response transaction id '%v' does not match request '%v'", modbus.ErrInvalidFrame, resp.TransactionID, req.TransactionID)
+		return
+	}
+	if level == VerifyStrict && resp.SlaveID != req.SlaveID {
+		err = fmt.Errorf("%w: response unit id '%v' does not match request '%v'", modbus.ErrInvalidFrame, resp.SlaveID, req.SlaveID)
 		return
 	}
 	return
@@ -5,17 +5,21 @@
 package tcp
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ffutop/modbus-gateway/modbus"
+	tcppacket "github.com/ffutop/modbus-gateway/modbus/tcp"
+	"github.com/ffutop/modbus-gateway/transport"
 )
 
 const (
@@ -23,40 +27,78 @@ const (
 )
 
 // Client implements Downstream interface (Modbus TCP Client).
+//
+// Requests share up to PoolSize persistent connections to the device, dialed on
+// demand and again after a failure. Up to MaxInFlight requests are sent on one
+// connection before their responses arrive, which are matched by transaction ID.
 type Client struct {
-	Address string
-	Timeout time.Duration
+	Address     string
+	Timeout     time.Duration
+	Verify      string        // Checks of response headers, see ParseVerify
+	PoolSize    int           // Connections to the device, default 1
+	MaxInFlight int           // Requests awaiting a response per connection, default 1
+	KeepAlive   time.Duration // Period of TCP keep-alive probes, 0 for the system default
+	TLS         *tls.Config   // Nil dials plain TCP
 
 	mu            sync.Mutex
-	conn          net.Conn
-	transactionID uint32 // Atomic counter
+	pool          []*conn // Created on first use
+	next          int     // Connection tried first by the next request
+	transactionID uint32  // Atomic counter
+}
+
+// conn is a connection of the pool. Its responses are read by a goroutine of their
+// own and handed to the requests waiting for them.
+type conn struct {
+	slots chan struct{} // Held by the requests in flight
+
+	mu        sync.Mutex
+	nc        net.Conn
+	pending   map[uint16]chan result
+	abandoned map[uint16]time.Time // Requests that timed out with others in flight, until their late responses expire
+	writeMu   sync.Mutex
+}
+
+type result struct {
+	raw []byte
+	err error
 }
 
 // NewClient allocates and initializes a TCP Client.
 func NewClient(address string) *Client {
 	return &Client{
-		Address: address,
-		Timeout: tcpTimeout,
+		Address:     address,
+		Timeout:     tcpTimeout,
+		Verify:      VerifyTransactionID,
+		PoolSize:    1,
+		MaxInFlight: 1,
 	}
 }
 
 // Send sends a PDU to a Slave (Downstream) and returns the response PDU.
-func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
-	mb.mu.Lock()
-	defer mb.mu.Unlock()
+func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (resp modbus.ProtocolDataUnit, err error) {
+	ctx, span := transport.StartSpan(ctx, transport.SpanDownstream, append(transport.SpanAttrs(slaveID, pdu, -1), slog.String("server.address", mb.Address))...)
+	defer func() { transport.EndSpan(span, resp, err) }()
 
-	if err := mb.connect(); err != nil {
-		return modbus.ProtocolDataUnit{}, fmt.Errorf("modbus: failed to connect to %s: %w", mb.Address, err)
+	c, err := mb.acquire(ctx)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, err
+	}
+	defer func() { <-c.slots }()
+
+	nc, err := mb.connect(c)
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("%w: %s: %w", modbus.ErrConnection, mb.Address, err)
 	}
 
 	// Transaction ID: Incrementing
 	tid := uint16(atomic.AddUint32(&mb.transactionID, 1))
+	span.SetAttributes(slog.Int("modbus.transaction_id", int(tid)))
 
 	adu := &ApplicationDataUnit{
 		TransactionID: tid,
 		ProtocolID:    0,
-		Length:        uint16(1 + len(pdu.Data)), // SlaveID + Data
-		SlaveID:       slaveID,                   // Unit Identifier
+		Length:        uint16(1 + 1 + len(pdu.Data)), // SlaveID + FunctionCode + Data
+		SlaveID:       slaveID,                       // Unit Identifier
 		Pdu:           pdu,
 	}
 
@@ -65,93 +107,228 @@ func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDat
 		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to encode ADU: %w", err)
 	}
 
-	if err := mb.conn.SetDeadline(time.Now().Add(mb.Timeout)); err != nil {
-		mb.close()
-		return modbus.ProtocolDataUnit{}, err
+	// The request's own deadline applies if it is earlier than the timeout
+	deadline := time.Now().Add(mb.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
 	}
 
-	respBytes, err := mb.sendAndRead(mb.conn, aduBytes)
+	ch := make(chan result, 1)
+	c.mu.Lock()
+	if c.nc != nc {
+		c.mu.Unlock()
+		return modbus.ProtocolDataUnit{}, modbus.IOError(net.ErrClosed)
+	}
+	c.pending[tid] = ch
+	delete(c.abandoned, tid) // Its transaction ID came round again
+	c.mu.Unlock()
+
+	transport.TraceFrame(ctx, transport.DownstreamTx, aduBytes)
+	c.writeMu.Lock()
+	err = nc.SetWriteDeadline(deadline)
+	if err == nil {
+		_, err = nc.Write(aduBytes)
+	}
+	c.writeMu.Unlock()
 	if err != nil {
-		mb.close() // Disconnect on IO error
-		return modbus.ProtocolDataUnit{}, err
+		c.fail(nc, err) // Disconnect on IO error
+		return modbus.ProtocolDataUnit{}, modbus.IOError(err)
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	var r result
+	select {
+	case r = <-ch:
+	case <-timer.C:
+		c.abandon(nc, tid, mb.Timeout)
+		return modbus.ProtocolDataUnit{}, modbus.IOError(os.ErrDeadlineExceeded)
+	}
+	if r.err != nil {
+		return modbus.ProtocolDataUnit{}, r.err
 	}
+	transport.Logger(ctx).Debug("recv from modbus tcp slave", "response", hex.EncodeToString(r.raw))
+	transport.TraceFrame(ctx, transport.DownstreamRx, r.raw)
 
 	// Decode Response
-	respAdu, err := Decode(respBytes)
+	respAdu, err := Decode(r.raw)
 	if err != nil {
 		// Try to keep connection open on decode error, unless it's critical
 		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to decode response ADU: %w", err)
 	}
 
 	// Verify
-	if err := adu.Verify(respAdu); err != nil {
+	if err := adu.Verify(respAdu, mb.Verify); err != nil {
+		// The response of an earlier request may follow, start over on a new connection
+		c.fail(nc, err)
 		return modbus.ProtocolDataUnit{}, fmt.Errorf("verification failed: %w", err)
 	}
 
 	return respAdu.Pdu, nil
 }
 
-func (mb *Client) sendAndRead(conn net.Conn, aduRequest []byte) ([]byte, error) {
-	if _, err := conn.Write(aduRequest); err != nil {
-		return nil, err
+// acquire takes a slot on the first connection of the pool with one free, or
+// waits for one on the next connection in turn.
+func (mb *Client) acquire(ctx context.Context) (*conn, error) {
+	mb.mu.Lock()
+	if mb.pool == nil {
+		mb.pool = make([]*conn, max(mb.PoolSize, 1))
+		for i := range mb.pool {
+			mb.pool[i] = &conn{slots: make(chan struct{}, max(mb.MaxInFlight, 1))}
+		}
 	}
+	first := mb.next
+	mb.next = (mb.next + 1) % len(mb.pool)
+	mb.mu.Unlock()
 
-	// Read MBAP Header (first 6 bytes)
-	mbapHeader := make([]byte, 6)
-	if _, err := io.ReadFull(conn, mbapHeader); err != nil {
-		return nil, err
+	for i := range mb.pool {
+		c := mb.pool[(first+i)%len(mb.pool)]
+		select {
+		case c.slots <- struct{}{}:
+			return c, nil
+		default:
+		}
 	}
+	c := mb.pool[first]
+	select {
+	case c.slots <- struct{}{}:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
 
-	// Parse Length
-	length := int(mbapHeader[4])<<8 | int(mbapHeader[5])
-
-	// Read remaining bytes (UnitID + PDU)
-	payload := make([]byte, length)
-	if _, err := io.ReadFull(conn, payload); err != nil {
+// connect returns the connection of c, dialing it and starting its reader if there is none.
+func (mb *Client) connect(c *conn) (net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.nc != nil {
+		return c.nc, nil
+	}
+	dialer := net.Dialer{Timeout: mb.Timeout, KeepAlive: mb.KeepAlive}
+	nc, err := transport.Dial(&dialer, mb.Address, mb.TLS)
+	if err != nil {
 		return nil, err
 	}
+	c.nc = nc
+	c.pending = make(map[uint16]chan result)
+	c.abandoned = make(map[uint16]time.Time)
+	go c.read(nc)
+	return nc, nil
+}
 
-	// Combine header and payload
-	response := make([]byte, 6+length)
-	copy(response, mbapHeader)
-	copy(response[6:], payload)
+// read hands the responses arriving on nc to the requests waiting for them, until nc fails.
+func (c *conn) read(nc net.Conn) {
+	rd := bufio.NewReader(nc)
+	for {
+		raw, err := tcppacket.ReadFrame(rd)
+		if err != nil {
+			c.fail(nc, err)
+			return
+		}
+		tid := uint16(raw[0])<<8 | uint16(raw[1])
 
-	slog.Debug("recv from modbus tcp slave", "response", hex.EncodeToString(response))
-	return response, nil
+		c.mu.Lock()
+		if c.nc != nc {
+			c.mu.Unlock()
+			return
+		}
+		c.expire()
+		ch, ok := c.pending[tid]
+		_, late := c.abandoned[tid]
+		switch {
+		case ok:
+			delete(c.pending, tid)
+		case late:
+			delete(c.abandoned, tid)
+		case len(c.pending) == 1:
+			// The only request in flight takes it, verification decides whether it fits
+			for id, only := range c.pending {
+				ch = only
+				delete(c.pending, id)
+			}
+		default:
+			c.mu.Unlock()
+			c.fail(nc, fmt.Errorf("%w: response transaction id '%v' matches no request", modbus.ErrInvalidFrame, tid))
+			return
+		}
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- result{raw: raw}
+		}
+	}
 }
 
-// Connect implements Connector interface.
-func (mb *Client) Connect(ctx context.Context) error {
-	mb.mu.Lock()
-	defer mb.mu.Unlock()
-	return mb.connect()
+// abandon gives up on the response to tid. A request timing out alone closes the
+// connection, as the device may be stuck; otherwise a late response arriving within
+// another timeout is discarded.
+func (c *conn) abandon(nc net.Conn, tid uint16, timeout time.Duration) {
+	c.mu.Lock()
+	if c.nc != nc {
+		c.mu.Unlock()
+		return
+	}
+	if len(c.pending) > 1 {
+		delete(c.pending, tid)
+		c.expire()
+		c.abandoned[tid] = time.Now().Add(timeout)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	c.fail(nc, os.ErrDeadlineExceeded)
 }
 
-// Close implements Connector interface.
-func (mb *Client) Close() error {
-	mb.mu.Lock()
-	defer mb.mu.Unlock()
-	mb.close()
-	return nil
+// expire forgets the abandoned requests whose late responses are no longer expected.
+// c.mu must be held.
+func (c *conn) expire() {
+	now := time.Now()
+	for tid, until := range c.abandoned {
+		if now.After(until) {
+			delete(c.abandoned, tid)
+		}
+	}
 }
 
-// connect ensures there is an active connection. Caller must hold the mutex.
-func (mb *Client) connect() error {
-	if mb.conn != nil {
-		return nil
+// fail closes nc if it is still the connection of c, failing the requests in flight with err.
+func (c *conn) fail(nc net.Conn, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.nc != nc {
+		return
+	}
+	c.nc.Close()
+	c.nc = nil
+	for _, ch := range c.pending {
+		ch <- result{err: modbus.IOError(err)}
 	}
-	conn, err := net.DialTimeout("tcp", mb.Address, mb.Timeout)
+	c.pending = nil
+	c.abandoned = nil
+}
+
+// Connect implements Connector interface.
+func (mb *Client) Connect(ctx context.Context) error {
+	c, err := mb.acquire(ctx)
 	if err != nil {
 		return err
 	}
-	mb.conn = conn
-	return nil
+	defer func() { <-c.slots }()
+	_, err = mb.connect(c)
+	return err
 }
 
-// close closes the connection and resets the state. Caller must hold the mutex.
-func (mb *Client) close() {
-	if mb.conn != nil {
-		mb.conn.Close()
-		mb.conn = nil
+// Close implements Connector interface.
+func (mb *Client) Close() error {
+	mb.mu.Lock()
+	pool := mb.pool
+	mb.mu.Unlock()
+	for _, c := range pool {
+		c.mu.Lock()
+		nc := c.nc
+		c.mu.Unlock()
+		if nc != nil {
+			c.fail(nc, net.ErrClosed)
+		}
 	}
-}
\ No newline at end of file
+	return nil
+}
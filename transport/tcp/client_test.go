@@ -6,8 +6,10 @@ package tcp
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"io"
 	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -118,8 +120,29 @@ func TestClient_Timeout(t *testing.T) {
 		Data:         []byte{0x00, 0x00, 0x00, 0x01},
 	}
 	_, err = client.Send(context.Background(), 1, pdu)
-	if err == nil {
-		t.Error("Expected timeout error, got nil")
+	if !errors.Is(err, modbus.ErrTimeout) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
+
+func TestClient_ConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := NewClient(addr)
+	client.Timeout = 200 * time.Millisecond
+	defer client.Close()
+
+	_, err = client.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}})
+	if !errors.Is(err, modbus.ErrConnection) {
+		t.Errorf("Expected connection error, got %v", err)
+	}
+	if code := modbus.ExceptionCodeOf(err); code != modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond {
+		t.Errorf("ExceptionCodeOf() = %d", code)
 	}
 }
 
@@ -156,3 +179,196 @@ func TestClient_MalformedResponse(t *testing.T) {
 		// Acceptable
 	}
 }
+
+func TestClient_Verify(t *testing.T) {
+	// The device answers with a transaction ID off by one and unit ID 0xFF
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				req := make([]byte, 12)
+				for {
+					if _, err := io.ReadFull(c, req); err != nil {
+						return
+					}
+					resp := []byte{0, 0, 0, 0, 0, 5, 0xFF, 0x03, 0x02, 0xAA, 0xBB}
+					binary.BigEndian.PutUint16(resp, binary.BigEndian.Uint16(req)+1)
+					c.Write(resp)
+				}
+			}(conn)
+		}
+	}()
+
+	pdu := modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0x00, 0x01, 0x00, 0x01}}
+	for _, level := range []string{VerifyStrict, VerifyTransactionID, VerifyNone} {
+		client := NewClient(listener.Addr().String())
+		client.Timeout = time.Second
+		client.Verify = level
+		resp, err := client.Send(context.Background(), 1, pdu)
+		client.Close()
+		if level == VerifyNone {
+			if err != nil || resp.FunctionCode != 0x03 {
+				t.Errorf("%s: Send() = %v, %v", level, resp, err)
+			}
+		} else if !errors.Is(err, modbus.ErrInvalidFrame) {
+			t.Errorf("%s: Send() error = %v, want invalid frame", level, err)
+		}
+	}
+
+	// Unit ID checked by strict verification only
+	req := &ApplicationDataUnit{TransactionID: 7, SlaveID: 1}
+	resp := &ApplicationDataUnit{TransactionID: 7, SlaveID: 2}
+	if err := req.Verify(resp, VerifyTransactionID); err != nil {
+		t.Errorf("Verify(transaction_id) = %v", err)
+	}
+	if err := req.Verify(resp, VerifyStrict); !errors.Is(err, modbus.ErrInvalidFrame) {
+		t.Errorf("Verify(strict) = %v, want invalid frame", err)
+	}
+
+	if _, err := ParseVerify("loose"); err == nil {
+		t.Error("ParseVerify accepted an unknown level")
+	}
+}
+
+func TestClient_Pool(t *testing.T) {
+	// The device answers batches of requests in reverse order, with the transaction ID as value
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var accepted, batchSize atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func(c net.Conn) {
+				defer c.Close()
+				for {
+					var batch [][]byte
+					for len(batch) < int(batchSize.Load()) {
+						req := make([]byte, 12)
+						if _, err := io.ReadFull(c, req); err != nil {
+							return
+						}
+						batch = append(batch, req)
+					}
+					for i := len(batch) - 1; i >= 0; i-- {
+						resp := []byte{batch[i][0], batch[i][1], 0, 0, 0, 5, batch[i][6], 0x03, 0x02, batch[i][0], batch[i][1]}
+						c.Write(resp)
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	for _, tt := range []struct {
+		poolSize, maxInFlight int
+		conns                 int32
+	}{{1, 4, 1}, {2, 2, 2}, {4, 1, 4}} {
+		accepted.Store(0)
+		batchSize.Store(int32(tt.maxInFlight))
+		client := NewClient(listener.Addr().String())
+		client.Timeout = time.Second
+		client.PoolSize = tt.poolSize
+		client.MaxInFlight = tt.maxInFlight
+
+		// Requests on a connection wait for the whole batch, so each must get its own response back
+		errs := make(chan error, 4)
+		for i := 0; i < 4; i++ {
+			go func() {
+				resp, err := client.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}})
+				if err == nil && (len(resp.Data) != 3 || resp.Data[0] != 2) {
+					err = errors.New("unexpected response")
+				}
+				errs <- err
+			}()
+		}
+		for i := 0; i < 4; i++ {
+			if err := <-errs; err != nil {
+				t.Errorf("pool %d, in flight %d: Send() error = %v", tt.poolSize, tt.maxInFlight, err)
+			}
+		}
+		if n := accepted.Load(); n != tt.conns {
+			t.Errorf("pool %d, in flight %d: %d connections, want %d", tt.poolSize, tt.maxInFlight, n, tt.conns)
+		}
+		client.Close()
+	}
+}
+
+func TestClient_LateResponse(t *testing.T) {
+	// The device answers two requests in order once both arrived, too late for the first
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var batch [][]byte
+		for len(batch) < 2 {
+			req := make([]byte, 12)
+			if _, err := io.ReadFull(c, req); err != nil {
+				return
+			}
+			batch = append(batch, req)
+		}
+		time.Sleep(150 * time.Millisecond)
+		for _, req := range batch {
+			c.Write([]byte{req[0], req[1], 0, 0, 0, 5, req[6], 0x03, 0x02, req[0], req[1]})
+		}
+		io.Copy(io.Discard, c)
+	}()
+
+	client := NewClient(listener.Addr().String())
+	client.Timeout = time.Second
+	client.MaxInFlight = 2
+	defer client.Close()
+	req := modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}}
+
+	errs := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.Send(ctx, 1, req)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := client.Send(context.Background(), 1, req); err != nil {
+		t.Fatalf("Send() of the request in flight error = %v", err)
+	}
+	if err := <-errs; !errors.Is(err, modbus.ErrTimeout) {
+		t.Errorf("Send() of the request timing out error = %v, want timeout", err)
+	}
+
+	// The late response was discarded and nothing is left waiting for it
+	c := client.pool[0]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.nc == nil || len(c.pending) != 0 || len(c.abandoned) != 0 {
+		t.Errorf("connected %v with %d pending and %d abandoned requests, want none", c.nc != nil, len(c.pending), len(c.abandoned))
+	}
+
+	// Abandoned requests are forgotten once their late responses are no longer expected
+	c.abandoned[1] = time.Now().Add(-time.Second)
+	c.expire()
+	if len(c.abandoned) != 0 {
+		t.Errorf("%d abandoned requests after they expired", len(c.abandoned))
+	}
+}
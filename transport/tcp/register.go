@@ -0,0 +1,60 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package tcp
+
+import (
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+func init() {
+	transport.RegisterUpstream("tcp", func(cfg config.UpstreamConfig) (transport.Upstream, error) {
+		allowlist, err := transport.ParseClients(cfg.AllowedClients, cfg.DeniedClients)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg, err := transport.NewTLS(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Tcp.MaxInFlight < 0 || cfg.MaxConnections < 0 || cfg.IdleTimeout < 0 {
+			return nil, fmt.Errorf("max_in_flight, max_connections and idle_timeout must not be negative")
+		}
+		s := NewServer(cfg.Tcp.Address)
+		s.Allowlist = allowlist
+		s.TLS = tlsCfg
+		s.MaxConns = cfg.MaxConnections
+		s.IdleTimeout = cfg.IdleTimeout
+		if cfg.Tcp.MaxInFlight > 0 {
+			s.MaxInFlight = cfg.Tcp.MaxInFlight
+		}
+		return s, nil
+	})
+	transport.RegisterDownstream("tcp", func(cfg config.DownstreamConfig) (transport.Downstream, error) {
+		verify, err := ParseVerify(cfg.Tcp.Verify)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Tcp.PoolSize < 0 || cfg.Tcp.MaxInFlight < 0 {
+			return nil, fmt.Errorf("pool_size and max_in_flight must not be negative")
+		}
+		if cfg.Tcp.MaxInFlight > 1 && verify == VerifyNone {
+			return nil, fmt.Errorf("max_in_flight %d needs responses matched by transaction ID, not verify %q", cfg.Tcp.MaxInFlight, verify)
+		}
+		tlsCfg, err := transport.NewDialTLS(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		c := NewClient(cfg.Tcp.Address)
+		c.TLS = tlsCfg
+		c.Verify = verify
+		c.PoolSize = max(cfg.Tcp.PoolSize, 1)
+		c.MaxInFlight = max(cfg.Tcp.MaxInFlight, 1)
+		c.KeepAlive = cfg.Tcp.KeepAlive
+		return c, nil
+	})
+}
@@ -5,41 +5,61 @@
 package tcp
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"net"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/ffutop/modbus-gateway/modbus"
+	tcppacket "github.com/ffutop/modbus-gateway/modbus/tcp"
 	"github.com/ffutop/modbus-gateway/transport"
 )
 
+// defaultMaxInFlight bounds the requests of one master handled at once.
+const defaultMaxInFlight = 16
+
 // Server implements a Modbus TCP Server.
 type Server struct {
-	Address string
-	Handler transport.RequestHandler
+	Address   string
+	Handler   transport.RequestHandler
+	Allowlist *transport.Allowlist // Clients accepted, nil accepts all
+	TLS       *transport.TLS       // Nil serves plain TCP
+
+	// Requests of one master handled at once, default 16. Masters pipelining more
+	// wait until a response has been sent.
+	MaxInFlight int
+
+	MaxConns    int           // Connections served at once, 0 is unlimited
+	IdleTimeout time.Duration // Connections without a request this long are closed, 0 never
 
 	listener net.Listener
+	conns    transport.Conns
 }
 
 // NewServer creates a new TCP Server.
 func NewServer(address string) *Server {
 	return &Server{
-		Address: address,
+		Address:     address,
+		MaxInFlight: defaultMaxInFlight,
 	}
 }
 
 // Start starts the TCP server.
 func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) error {
+	log := transport.Logger(ctx)
 	s.Handler = handler
 	listener, err := net.Listen("tcp", s.Address)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", s.Address, err)
 	}
-	s.listener = listener
-	slog.Info("Modbus TCP server listening", "addr", s.Address)
+	s.listener = s.TLS.Listener(s.Allowlist.Listener(ctx, listener))
+	log.Info("Modbus TCP server listening", "addr", s.Address)
+	transport.Listening(ctx)
 
 	go func() {
 		<-ctx.Done()
@@ -54,11 +74,19 @@ func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) er
 			case <-ctx.Done():
 				return nil
 			default:
-				slog.Error("Failed to accept connection", "err", err)
+				log.Error("Failed to accept connection", "err", err)
 				continue
 			}
 		}
-		go s.handleConnection(ctx, conn)
+		if ok, held := s.conns.Add(conn.RemoteAddr(), s.MaxConns); !ok {
+			log.Warn("Rejected TCP client, too many connections", "addr", conn.RemoteAddr(), "max", s.MaxConns, "client_conns", held)
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer s.conns.Done(conn.RemoteAddr())
+			s.handleConnection(ctx, conn)
+		}()
 	}
 }
 
@@ -72,80 +100,105 @@ func (s *Server) Close() error {
 
 func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
-	slog.Info("New TCP client connected", "addr", conn.RemoteAddr())
+	log := transport.Logger(ctx)
+	log.Info("New TCP client connected", "addr", conn.RemoteAddr())
+	ctx = transport.WithClient(ctx, conn.RemoteAddr())
+	ctx, err := s.TLS.Accept(ctx, conn)
+	if err != nil {
+		log.Warn("Rejected TLS client", "addr", conn.RemoteAddr(), "err", err)
+		return
+	}
+	if s.Handler == nil {
+		log.Error("No handler defined for TCP server")
+		return
+	}
+
+	// Requests in flight finish before the connection closes, their responses are dropped
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var writeMu sync.Mutex
+	slots := make(chan struct{}, max(s.MaxInFlight, 1))
+	rd := bufio.NewReader(conn)
 
 	for {
-		// Check context
-		select {
-		case <-ctx.Done():
-			return
-		default:
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
 		}
-
-		// max MODBUS TCP ADU = 260 bytes.
-		buf := make([]byte, 260+1) // +1 to detect overflow
-		n, err := conn.Read(buf)
+		// Frames are delimited by their MBAP length, so pipelined requests are read
+		// while earlier ones are still handled
+		raw, err := tcppacket.ReadFrame(rd)
 		if err != nil {
-			if err == io.EOF {
-				slog.Info("TCP client disconnected gracefully", "addr", conn.RemoteAddr())
-			} else {
-				slog.Error("Failed to read from connection", "addr", conn.RemoteAddr(), "err", err)
+			switch {
+			case errors.Is(err, io.EOF):
+				log.Info("TCP client disconnected gracefully", "addr", conn.RemoteAddr())
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				log.Warn("Closing idle TCP client", "addr", conn.RemoteAddr(), "idle_timeout", s.IdleTimeout)
+			case errors.Is(err, modbus.ErrInvalidFrame):
+				// The stream can't be resynchronized
+				log.Error("Invalid request length", "addr", conn.RemoteAddr(), "err", err)
+			default:
+				log.Error("Failed to read from connection", "addr", conn.RemoteAddr(), "err", err)
 			}
 			return
 		}
 
-		if n > 260 {
-			slog.Error("Invalid request length", "length", n)
-			return
-		}
-
-		adu, err := Decode(buf[:n])
+		rctx, span := transport.StartSpan(transport.TraceRequest(ctx), transport.SpanUpstream)
+		transport.TraceFrame(rctx, transport.UpstreamRx, raw)
+		adu, err := Decode(raw)
 		if err != nil {
-			slog.Error("Failed to decode TCP request", "err", err)
+			log.Error("Failed to decode TCP request", "err", err)
+			span.End(err)
 			continue
 		}
+		span.SetAttributes(transport.SpanAttrs(adu.SlaveID, adu.Pdu, int(adu.TransactionID))...)
 
-		if s.Handler == nil {
-			slog.Error("No handler defined for TCP server")
+		// Reading stops while the master has MaxInFlight requests pending
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			span.End(ctx.Err())
 			return
 		}
-
-		respPdu, err := s.Handler(ctx, adu.SlaveID, adu.Pdu)
-		if err != nil {
-			slog.Error("Handler failed", "err", err)
-
-			// Map error to Modbus exception code
-			exceptionCode := modbus.ExceptionCodeServerDeviceFailure
-			if errors.Is(err, context.DeadlineExceeded) || err.Error() == "modbus: request timed out" {
-				exceptionCode = modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			respRaw, err := s.serve(rctx, adu)
+			defer func() { span.End(err) }()
+			if err != nil {
+				log.Error("Failed to encode TCP response", "err", err)
+				return
 			}
-
-			// Construct Exception PDU: Function Code | 0x80
-			respPdu = modbus.ProtocolDataUnit{
-				FunctionCode: adu.Pdu.FunctionCode | 0x80,
-				Data:         []byte{byte(exceptionCode)},
+			transport.TraceFrame(rctx, transport.UpstreamTx, respRaw)
+			// Responses go out as they complete, the master matches them by transaction ID
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if _, err = conn.Write(respRaw); err != nil {
+				log.Error("Failed to write response to connection", "err", err)
+				conn.Close() // Unblocks the read loop
 			}
-		}
-
-		// Construct Response ADU
-		respAdu := &ApplicationDataUnit{
-			TransactionID: adu.TransactionID,
-			ProtocolID:    adu.ProtocolID,
-			Length:        uint16(1 + 1 + len(respPdu.Data)), // SlaveID + FunctionCode + Data
-			SlaveID:       adu.SlaveID,
-			Pdu:           respPdu,
-		}
+		}()
+	}
+}
 
-		respRaw, err := respAdu.Encode()
-		if err != nil {
-			slog.Error("Failed to encode TCP response", "err", err)
-			continue
-		}
+// serve handles one request and encodes its response.
+func (s *Server) serve(ctx context.Context, adu *ApplicationDataUnit) ([]byte, error) {
+	respPdu, err := s.Handler(ctx, adu.SlaveID, adu.Pdu)
+	if err != nil {
+		transport.Logger(ctx).Error("Handler failed", "err", err)
+		respPdu = modbus.ExceptionResponse(adu.Pdu, err)
+	}
+	if attr, ok := transport.ExceptionAttr(respPdu); ok {
+		transport.SpanFromContext(ctx).SetAttributes(attr)
+	}
 
-		_, err = conn.Write(respRaw)
-		if err != nil {
-			slog.Error("Failed to write response to connection", "err", err)
-			return
-		}
+	// Construct Response ADU
+	respAdu := &ApplicationDataUnit{
+		TransactionID: adu.TransactionID,
+		ProtocolID:    adu.ProtocolID,
+		Length:        uint16(1 + 1 + len(respPdu.Data)), // SlaveID + FunctionCode + Data
+		SlaveID:       adu.SlaveID,
+		Pdu:           respPdu,
 	}
+	return respAdu.Encode()
 }
@@ -4,13 +4,18 @@
 package tcp
 
 import (
+	"bufio"
 	"context"
 	"encoding/binary"
+	"errors"
 	"net"
+	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ffutop/modbus-gateway/modbus"
+	tcppacket "github.com/ffutop/modbus-gateway/modbus/tcp"
 )
 
 func TestServer_Start_And_Handle(t *testing.T) {
@@ -167,3 +172,194 @@ func (m *mockHandler) Handle(ctx context.Context, slaveID byte, pdu modbus.Proto
 	m.called = true
 	return modbus.ProtocolDataUnit{}, nil
 }
+
+func TestServer_Pipelining(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewServer(addr)
+	s.MaxInFlight = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Slave 1 answers slowly, so the requests after it overtake it
+	var inFlight, peak atomic.Int32
+	go s.Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		if slaveID == 1 {
+			time.Sleep(100 * time.Millisecond)
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return modbus.ProtocolDataUnit{FunctionCode: pdu.FunctionCode, Data: []byte{2, 0, slaveID}}, nil
+	})
+
+	var conn net.Conn
+	for i := 0; i < 20; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	// Three requests in one segment, transaction ID 100+slave ID
+	var frames []byte
+	for slaveID := byte(1); slaveID <= 3; slaveID++ {
+		adu := &ApplicationDataUnit{TransactionID: 100 + uint16(slaveID), Length: 6, SlaveID: slaveID,
+			Pdu: modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}}}
+		raw, _ := adu.Encode()
+		frames = append(frames, raw...)
+	}
+	if _, err := conn.Write(frames); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	rd := bufio.NewReader(conn)
+	var order []uint16
+	for i := 0; i < 3; i++ {
+		raw, err := tcppacket.ReadFrame(rd)
+		if err != nil {
+			t.Fatalf("response %d: %v", i, err)
+		}
+		resp, _ := Decode(raw)
+		if want := 100 + uint16(resp.SlaveID); resp.TransactionID != want || resp.Pdu.Data[2] != resp.SlaveID {
+			t.Errorf("response % X does not match its request", raw)
+		}
+		order = append(order, resp.TransactionID)
+	}
+	if order[2] != 101 {
+		t.Errorf("responses in order %v, want the slow request last", order)
+	}
+	if p := peak.Load(); p != 2 {
+		t.Errorf("requests handled at once = %d, want MaxInFlight 2", p)
+	}
+}
+
+func TestServer_ExceptionResponses(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewServer(addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The slave ID picks how forwarding fails
+	go s.Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		switch slaveID {
+		case 1:
+			return modbus.ProtocolDataUnit{}, modbus.IOError(os.ErrDeadlineExceeded)
+		case 2:
+			return modbus.ProtocolDataUnit{}, &modbus.Error{FunctionCode: pdu.FunctionCode | 0x80, ExceptionCode: modbus.ExceptionCodeGatewayPathUnavailable}
+		}
+		return modbus.ProtocolDataUnit{}, errors.New("boom")
+	})
+
+	var conn net.Conn
+	for i := 0; i < 20; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	rd := bufio.NewReader(conn)
+
+	for _, tt := range []struct {
+		slaveID byte
+		want    byte
+	}{
+		{1, modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond},
+		{2, modbus.ExceptionCodeGatewayPathUnavailable},
+		{3, modbus.ExceptionCodeServerDeviceFailure},
+	} {
+		adu := &ApplicationDataUnit{TransactionID: uint16(tt.slaveID), Length: 6, SlaveID: tt.slaveID,
+			Pdu: modbus.ProtocolDataUnit{FunctionCode: 0x03, Data: []byte{0, 0, 0, 1}}}
+		raw, _ := adu.Encode()
+		if _, err := conn.Write(raw); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := tcppacket.ReadFrame(rd)
+		if err != nil {
+			t.Fatalf("slave %d: %v", tt.slaveID, err)
+		}
+		if resp, _ := Decode(raw); resp.Pdu.FunctionCode != 0x83 || len(resp.Pdu.Data) != 1 || resp.Pdu.Data[0] != tt.want {
+			t.Errorf("slave %d response = % X, want exception %02X", tt.slaveID, raw, tt.want)
+		}
+	}
+}
+
+func TestServer_ConnectionLimits(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewServer(addr)
+	s.MaxConns = 1
+	s.IdleTimeout = 100 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Start(ctx, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		return pdu, nil
+	})
+
+	var first net.Conn
+	for i := 0; i < 20; i++ {
+		if first, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if first == nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer first.Close()
+	for s.conns.Len() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The connection beyond the limit is closed on accept
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() of the excess connection error = %v, want it closed", err)
+	}
+
+	// The first is closed once idle, and frees its slot
+	first.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := first.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() of the idle connection error = %v, want it closed", err)
+	}
+	for i := 0; s.conns.Len() != 0; i++ {
+		if i == 100 {
+			t.Fatal("idle connection still counted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+)
+
+// handshakeTimeout bounds how long a client may take to complete the TLS handshake.
+const handshakeTimeout = 10 * time.Second
+
+// TLS terminates TLS on a TCP upstream and names the masters by their client certificates.
+type TLS struct {
+	config     *tls.Config
+	identities []config.IdentityConfig
+}
+
+// NewTLS loads the server certificate and the CA verifying client certificates.
+// A config without a certificate returns nil, which leaves the upstream in plain TCP.
+func NewTLS(cfg config.TLSConfig) (*TLS, error) {
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		if cfg.ClientCAFile != "" || len(cfg.Identities) > 0 || cfg.RequireClientCert {
+			return nil, errors.New("tls: cert_file and key_file are required")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: failed to load server certificate: %w", err)
+	}
+	t := &TLS{
+		config:     &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}},
+		identities: cfg.Identities,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", cfg.ClientCAFile)
+		}
+		t.config.ClientCAs = pool
+		t.config.ClientAuth = tls.RequireAndVerifyClientCert
+	} else if len(cfg.Identities) > 0 {
+		return nil, errors.New("tls: identities require client_ca_file")
+	} else if cfg.RequireClientCert {
+		// Without a CA any master would be served, unauthenticated
+		return nil, errors.New("tls: require_client_cert needs client_ca_file")
+	}
+	for i, id := range cfg.Identities {
+		if id.Name == "" || (id.CommonName == "" && id.SAN == "") {
+			return nil, fmt.Errorf("tls: identity %d needs a name and a common_name or san", i)
+		}
+	}
+	return t, nil
+}
+
+// Listener wraps ln to serve TLS. A nil TLS returns ln unchanged.
+func (t *TLS) Listener(ln net.Listener) net.Listener {
+	if t == nil {
+		return ln
+	}
+	return tls.NewListener(ln, t.config)
+}
+
+// Accept completes the handshake of conn and returns ctx carrying the identity of the
+// client certificate. Clients whose certificate maps to no configured identity are refused.
+// A nil TLS returns ctx unchanged.
+func (t *TLS) Accept(ctx context.Context, conn net.Conn) (context.Context, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if t == nil || !ok {
+		return ctx, nil
+	}
+	hctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(hctx); err != nil {
+		return ctx, fmt.Errorf("tls handshake: %w", err)
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ctx, nil
+	}
+	identity, ok := t.identify(certs[0])
+	if !ok {
+		return ctx, fmt.Errorf("client certificate %q maps to no identity", certs[0].Subject.CommonName)
+	}
+	return WithIdentity(ctx, identity), nil
+}
+
+// identify maps a client certificate to an identity. Without identities configured,
+// the common name is the identity.
+func (t *TLS) identify(cert *x509.Certificate) (string, bool) {
+	if len(t.identities) == 0 {
+		return cert.Subject.CommonName, cert.Subject.CommonName != ""
+	}
+	for _, id := range t.identities {
+		if id.CommonName != "" && id.CommonName != cert.Subject.CommonName {
+			continue
+		}
+		if id.SAN != "" && !hasSAN(cert, id.SAN) {
+			continue
+		}
+		return id.Name, true
+	}
+	return "", false
+}
+
+func hasSAN(cert *x509.Certificate, san string) bool {
+	for _, name := range cert.DNSNames {
+		if name == san {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if email == san {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.String() == san {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDialTLS loads the CA and client certificate of a downstream connection.
+// A config with nothing set returns nil, which dials plain TCP.
+func NewDialTLS(cfg config.DialTLSConfig) (*tls.Config, error) {
+	if cfg == (config.DialTLSConfig{}) {
+		return nil, nil
+	}
+	c := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: failed to read CA file: %w", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", cfg.CAFile)
+		}
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: failed to load client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// Dial connects to address with dialer, completing the TLS handshake within the
+// dialer's timeout if cfg is not nil.
+func Dial(dialer *net.Dialer, address string, cfg *tls.Config) (net.Conn, error) {
+	if cfg == nil {
+		return dialer.Dial("tcp", address)
+	}
+	return tls.DialWithDialer(dialer, "tcp", address, cfg)
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	ca.write(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(t *testing.T, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue returns a certificate for cn, with dns as subject alternative name.
+func (ca *testCA) issue(t *testing.T, cn, dns string, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{dns},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	ca.write(t, cn+".pem", "CERTIFICATE", der)
+	ca.write(t, cn+".key", "EC PRIVATE KEY", keyDER)
+	cert, err := tls.LoadX509KeyPair(filepath.Join(ca.dir, cn+".pem"), filepath.Join(ca.dir, cn+".key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTLS_Identity(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "gateway", "gateway.local", x509.ExtKeyUsageServerAuth)
+	primary := ca.issue(t, "scada-01", "scada-01.plant", x509.ExtKeyUsageClientAuth)
+	unknown := ca.issue(t, "laptop", "laptop.plant", x509.ExtKeyUsageClientAuth)
+
+	srv, err := NewTLS(config.TLSConfig{
+		CertFile:     filepath.Join(ca.dir, "gateway.pem"),
+		KeyFile:      filepath.Join(ca.dir, "gateway.key"),
+		ClientCAFile: filepath.Join(ca.dir, "ca.pem"),
+		Identities:   []config.IdentityConfig{{Name: "scada-primary", SAN: "scada-01.plant"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = srv.Listener(ln)
+	defer ln.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	accept := func(cert tls.Certificate) (string, error) {
+		go func() {
+			conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: pool, ServerName: "gateway.local", Certificates: []tls.Certificate{cert}})
+			if err == nil {
+				conn.Handshake()
+				conn.Close()
+			}
+		}()
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		ctx, err := srv.Accept(context.Background(), conn)
+		return IdentityFromContext(ctx), err
+	}
+
+	if id, err := accept(primary); err != nil || id != "scada-primary" {
+		t.Errorf("identity of scada-01 = %q, %v", id, err)
+	}
+	if _, err := accept(unknown); err == nil {
+		t.Error("certificate of no identity was accepted")
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	if tlsCfg, err := NewTLS(config.TLSConfig{}); tlsCfg != nil || err != nil {
+		t.Errorf("NewTLS(empty) = %v, %v, want plain TCP", tlsCfg, err)
+	}
+	if _, err := NewTLS(config.TLSConfig{ClientCAFile: "ca.pem"}); err == nil {
+		t.Error("NewTLS accepted a client CA without a server certificate")
+	}
+	if _, err := NewTLS(config.TLSConfig{RequireClientCert: true}); err == nil {
+		t.Error("NewTLS served plain TCP although client certificates are required")
+	}
+	ca := newTestCA(t)
+	ca.issue(t, "gateway", "gateway.local", x509.ExtKeyUsageServerAuth)
+	cert, key := filepath.Join(ca.dir, "gateway.pem"), filepath.Join(ca.dir, "gateway.key")
+	if _, err := NewTLS(config.TLSConfig{CertFile: cert, KeyFile: key, RequireClientCert: true}); err == nil {
+		t.Error("NewTLS accepted require_client_cert without a client CA")
+	}
+	if _, err := NewTLS(config.TLSConfig{CertFile: cert, KeyFile: key, ClientCAFile: filepath.Join(ca.dir, "ca.pem"), RequireClientCert: true}); err != nil {
+		t.Errorf("NewTLS() with a client CA error = %v", err)
+	}
+}
+
+func TestDial(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "gateway", "gateway.local", x509.ExtKeyUsageServerAuth)
+	ca.issue(t, "scada-01", "scada-01.plant", x509.ExtKeyUsageClientAuth)
+
+	srv, err := NewTLS(config.TLSConfig{
+		CertFile:     filepath.Join(ca.dir, "gateway.pem"),
+		KeyFile:      filepath.Join(ca.dir, "gateway.key"),
+		ClientCAFile: filepath.Join(ca.dir, "ca.pem"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = srv.Listener(ln)
+	defer ln.Close()
+	identities := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if ctx, err := srv.Accept(context.Background(), conn); err == nil {
+				identities <- IdentityFromContext(ctx)
+			}
+			conn.Close()
+		}
+	}()
+
+	client := config.DialTLSConfig{
+		ServerName: "gateway.local",
+		CAFile:     filepath.Join(ca.dir, "ca.pem"),
+		CertFile:   filepath.Join(ca.dir, "scada-01.pem"),
+		KeyFile:    filepath.Join(ca.dir, "scada-01.key"),
+	}
+	dial := func(cfg config.DialTLSConfig) error {
+		tlsCfg, err := NewDialTLS(cfg)
+		if err != nil {
+			t.Fatalf("NewDialTLS() error = %v", err)
+		}
+		conn, err := Dial(&net.Dialer{Timeout: time.Second}, ln.Addr().String(), tlsCfg)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	if err := dial(client); err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	if id := <-identities; id != "scada-01" {
+		t.Errorf("identity of the gateway at the server = %q, want scada-01", id)
+	}
+
+	wrongName := client
+	wrongName.ServerName = "other.local"
+	if err := dial(wrongName); err == nil {
+		t.Error("Dial() accepted a certificate of another server name")
+	}
+	systemRoots := client
+	systemRoots.CAFile = ""
+	if err := dial(systemRoots); err == nil {
+		t.Error("Dial() accepted a certificate of an unknown CA")
+	}
+	insecure := systemRoots
+	insecure.InsecureSkipVerify = true
+	if err := dial(insecure); err != nil {
+		t.Errorf("Dial() skipping verification error = %v", err)
+	}
+
+	if tlsCfg, err := NewDialTLS(config.DialTLSConfig{}); tlsCfg != nil || err != nil {
+		t.Errorf("NewDialTLS(empty) = %v, %v, want plain TCP", tlsCfg, err)
+	}
+	if _, err := NewDialTLS(config.DialTLSConfig{CertFile: client.CertFile}); err == nil {
+		t.Error("NewDialTLS accepted a client certificate without its key")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Directions of traced frames
+const (
+	UpstreamRx   = "upstream rx"   // Request of a master
+	UpstreamTx   = "upstream tx"   // Response to a master
+	DownstreamTx = "downstream tx" // Request to a device
+	DownstreamRx = "downstream rx" // Response of a device
+)
+
+type (
+	traceKey   struct{}
+	traceIDKey struct{}
+	sinkKey    struct{}
+)
+
+// FrameSink receives every ADU transports send and receive under a context it was
+// added to with WithFrameSink, e.g. to record them. Frame must not keep adu.
+type FrameSink interface {
+	Frame(dir string, cid uint64, adu []byte)
+}
+
+// traceIDs numbers the requests whose frames are traced.
+var traceIDs atomic.Uint64
+
+// WithFrameTrace returns ctx under which transports log every ADU they send and
+// receive, see TraceFrame.
+func WithFrameTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceKey{}, true)
+}
+
+// WithFrameSink returns ctx under which transports pass every ADU they send and
+// receive to sink, along with the correlation ID of its request.
+func WithFrameSink(ctx context.Context, sink FrameSink) context.Context {
+	return context.WithValue(ctx, sinkKey{}, sink)
+}
+
+// TraceRequest returns ctx carrying a new correlation ID for the frames of one
+// request, upstream and downstream, if frames are traced, passed to a sink or spans
+// recorded under ctx and it carries none yet. Upstreams call it for each request
+// they receive.
+func TraceRequest(ctx context.Context) context.Context {
+	on, _ := ctx.Value(traceKey{}).(bool)
+	_, sink := ctx.Value(sinkKey{}).(FrameSink)
+	_, tracer := ctx.Value(tracerKey{}).(Tracer)
+	if !on && !sink && !tracer {
+		return ctx
+	}
+	if _, ok := ctx.Value(traceIDKey{}).(uint64); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDKey{}, traceIDs.Add(1))
+}
+
+// CorrelationID returns the correlation ID of the request of ctx, if TraceRequest
+// assigned one.
+func CorrelationID(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(traceIDKey{}).(uint64)
+	return id, ok
+}
+
+// TraceFrame logs adu in hex at info level with the correlation ID of its request,
+// if frames are traced under ctx, passes it to the sink of ctx if any and records it
+// as an event of the span of ctx. dir is one of UpstreamRx, UpstreamTx, DownstreamTx
+// and DownstreamRx.
+func TraceFrame(ctx context.Context, dir string, adu []byte) {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		span.AddEvent(dir, slog.Int("modbus.adu_length", len(adu)))
+	}
+	on, _ := ctx.Value(traceKey{}).(bool)
+	sink, _ := ctx.Value(sinkKey{}).(FrameSink)
+	if !on && sink == nil {
+		return
+	}
+	id, _ := ctx.Value(traceIDKey{}).(uint64)
+	if on {
+		Logger(ctx).Info("Frame", "dir", dir, "cid", id, "adu", fmt.Sprintf("% X", adu))
+	}
+	if sink != nil {
+		sink.Frame(dir, id, adu)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package transport
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTraceFrame(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithLogger(context.Background(), slog.New(slog.NewTextHandler(&buf, nil)))
+
+	// Off unless enabled
+	TraceFrame(TraceRequest(ctx), UpstreamRx, []byte{1, 3})
+	if buf.Len() != 0 {
+		t.Fatalf("frame traced without tracing enabled: %s", buf.String())
+	}
+
+	ctx = WithFrameTrace(ctx)
+	first := TraceRequest(ctx)
+	if TraceRequest(first) != first {
+		t.Error("TraceRequest() replaced the correlation ID of a request")
+	}
+	second := TraceRequest(ctx)
+	TraceFrame(first, UpstreamRx, []byte{0x01, 0x03, 0x00, 0x0A})
+	TraceFrame(second, DownstreamTx, []byte{0x02})
+	TraceFrame(first, UpstreamTx, []byte{0x01, 0x83, 0x02})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("traced %d frames, want 3:\n%s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], `dir="upstream rx"`) || !strings.Contains(lines[0], `adu="01 03 00 0A"`) {
+		t.Errorf("frame = %s", lines[0])
+	}
+	cid := func(line string) string {
+		_, rest, _ := strings.Cut(line, "cid=")
+		id, _, _ := strings.Cut(rest, " ")
+		return id
+	}
+	if cid(lines[0]) != cid(lines[2]) || cid(lines[0]) == cid(lines[1]) {
+		t.Errorf("correlation IDs %s, %s, %s, want the first and last equal", cid(lines[0]), cid(lines[1]), cid(lines[2]))
+	}
+}
+
+type recordedSpan struct {
+	name   string
+	events []string
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(...slog.Attr)           {}
+func (s *recordedSpan) AddEvent(name string, _ ...slog.Attr) { s.events = append(s.events, name) }
+func (s *recordedSpan) End(err error)                        { s.err, s.ended = err, true }
+
+type recordingTracer struct{ spans []*recordedSpan }
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...slog.Attr) (context.Context, Span) {
+	s := &recordedSpan{name: name}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestStartSpan(t *testing.T) {
+	ctx, span := StartSpan(context.Background(), SpanUpstream)
+	span.End(nil) // Records nothing without a tracer
+	if _, ok := CorrelationID(TraceRequest(ctx)); ok {
+		t.Error("correlation ID assigned without tracing")
+	}
+
+	tracer := &recordingTracer{}
+	ctx = TraceRequest(WithTracer(context.Background(), tracer))
+	if _, ok := CorrelationID(ctx); !ok {
+		t.Error("no correlation ID assigned with a tracer")
+	}
+	uctx, upstream := StartSpan(ctx, SpanUpstream)
+	TraceFrame(uctx, UpstreamRx, []byte{1, 3})
+	dctx, downstream := StartSpan(uctx, SpanDownstream)
+	if SpanFromContext(dctx) != downstream {
+		t.Error("SpanFromContext() isn't the span last started")
+	}
+	TraceFrame(dctx, DownstreamTx, []byte{1, 3})
+	downstream.End(nil)
+	upstream.End(nil)
+
+	if len(tracer.spans) != 2 || !tracer.spans[0].ended || !tracer.spans[1].ended {
+		t.Fatalf("spans = %+v", tracer.spans)
+	}
+	if ev := tracer.spans[0].events; len(ev) != 1 || ev[0] != UpstreamRx {
+		t.Errorf("upstream events = %v", ev)
+	}
+	if ev := tracer.spans[1].events; len(ev) != 1 || ev[0] != DownstreamTx {
+		t.Errorf("downstream events = %v", ev)
+	}
+}
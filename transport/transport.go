@@ -18,6 +18,7 @@ type RequestHandler func(ctx context.Context, slaveID byte, pdu modbus.ProtocolD
 // It acts as a Server.
 type Upstream interface {
 	// Start starts the server and blocks. It should be called in a goroutine.
+	// Once it accepts requests it calls Listening, the gateway is unready until then.
 	Start(ctx context.Context, handler RequestHandler) error
 	Close() error
 }
@@ -30,3 +31,18 @@ type Downstream interface {
 	Connect(ctx context.Context) error
 	Close() error
 }
+
+// Supervised is implemented by downstreams watching their connection in the
+// background, so its state is known before requests fail.
+type Supervised interface {
+	// OnState sets the function called as the connection goes down, with the
+	// reason, and once it is up again.
+	OnState(fn func(up bool, err error))
+}
+
+// Persisted is implemented by downstreams keeping their registers in a storage
+// that may drop writes, such as local slaves.
+type Persisted interface {
+	// Dropped returns how many writes the storage dropped.
+	Dropped() uint64
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+// Package udp implements Modbus over UDP, as spoken by controllers without a TCP
+// stack: every datagram carries one ADU framed like Modbus TCP, MBAP header first.
+//
+// UDP loses and duplicates datagrams. The client sends requests again when their
+// response is late, and the server answers a request it has already served from the
+// response it sent, so a retransmitted write takes effect once.
+package udp
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	tcppacket "github.com/ffutop/modbus-gateway/modbus/tcp"
+	"github.com/ffutop/modbus-gateway/transport"
+	"github.com/ffutop/modbus-gateway/transport/tcp"
+)
+
+const (
+	udpTimeout                = 10 * time.Second
+	defaultRetransmitInterval = 500 * time.Millisecond
+
+	// maxDatagram is read at once, larger than any valid ADU so oversized ones are detected
+	maxDatagram = 1500
+)
+
+// Client implements Downstream interface (Modbus UDP Client).
+//
+// Requests share one socket. Their responses are matched by transaction ID, so
+// several may be in flight, and duplicates of a response already taken are dropped.
+type Client struct {
+	Address            string
+	Timeout            time.Duration // Applies unless the request's deadline is earlier
+	Verify             string        // tcp.VerifyStrict or tcp.VerifyTransactionID
+	RetransmitInterval time.Duration // Time without a response before a request is sent again, default 500ms
+	RetransmitWrites   bool          // Send writes again too, for devices where repeating one is harmless
+
+	mu            sync.Mutex
+	conn          *net.UDPConn
+	pending       map[uint16]chan []byte
+	transactionID uint32 // Atomic counter
+}
+
+// NewClient allocates and initializes a UDP Client.
+func NewClient(address string) *Client {
+	return &Client{
+		Address:            address,
+		Timeout:            udpTimeout,
+		Verify:             tcp.VerifyTransactionID,
+		RetransmitInterval: defaultRetransmitInterval,
+	}
+}
+
+// Send sends a PDU to a Slave (Downstream) and returns the response PDU.
+func (mb *Client) Send(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (resp modbus.ProtocolDataUnit, err error) {
+	ctx, span := transport.StartSpan(ctx, transport.SpanDownstream, append(transport.SpanAttrs(slaveID, pdu, -1), slog.String("server.address", mb.Address))...)
+	defer func() { transport.EndSpan(span, resp, err) }()
+
+	conn, err := mb.connect()
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("%w: %s: %w", modbus.ErrConnection, mb.Address, err)
+	}
+
+	tid := uint16(atomic.AddUint32(&mb.transactionID, 1))
+	span.SetAttributes(slog.Int("modbus.transaction_id", int(tid)))
+	adu := &tcp.ApplicationDataUnit{
+		TransactionID: tid,
+		Length:        uint16(1 + 1 + len(pdu.Data)), // SlaveID + FunctionCode + Data
+		SlaveID:       slaveID,
+		Pdu:           pdu,
+	}
+	aduBytes, err := adu.Encode()
+	if err != nil {
+		return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to encode ADU: %w", err)
+	}
+
+	ch := make(chan []byte, 1)
+	mb.mu.Lock()
+	if mb.conn != conn {
+		mb.mu.Unlock()
+		return modbus.ProtocolDataUnit{}, modbus.IOError(net.ErrClosed)
+	}
+	mb.pending[tid] = ch
+	mb.mu.Unlock()
+	defer func() {
+		mb.mu.Lock()
+		delete(mb.pending, tid)
+		mb.mu.Unlock()
+	}()
+
+	deadline := time.Now().Add(mb.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+
+	// Writes are sent once unless repeating them is harmless: the first may have
+	// taken effect with its response lost
+	var resend <-chan time.Time
+	var ticker *time.Ticker
+	if mb.RetransmitInterval > 0 && (mb.RetransmitWrites || modbus.IsRead(pdu.FunctionCode)) {
+		ticker = time.NewTicker(mb.RetransmitInterval)
+		defer ticker.Stop()
+		resend = ticker.C
+	}
+
+	log := transport.Logger(ctx)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			log.Debug("Retransmitting UDP request", "transaction_id", tid, "attempt", attempt)
+		}
+		transport.TraceFrame(ctx, transport.DownstreamTx, aduBytes)
+		if _, err := conn.Write(aduBytes); err != nil {
+			return modbus.ProtocolDataUnit{}, modbus.IOError(err)
+		}
+		select {
+		case raw := <-ch:
+			log.Debug("recv from modbus udp slave", "response", hex.EncodeToString(raw))
+			transport.TraceFrame(ctx, transport.DownstreamRx, raw)
+			respAdu, err := tcp.Decode(raw)
+			if err != nil {
+				return modbus.ProtocolDataUnit{}, fmt.Errorf("failed to decode response ADU: %w", err)
+			}
+			if err := adu.Verify(respAdu, mb.Verify); err != nil {
+				return modbus.ProtocolDataUnit{}, fmt.Errorf("verification failed: %w", err)
+			}
+			return respAdu.Pdu, nil
+		case <-resend:
+		case <-timeout.C:
+			return modbus.ProtocolDataUnit{}, modbus.IOError(os.ErrDeadlineExceeded)
+		case <-ctx.Done():
+			return modbus.ProtocolDataUnit{}, modbus.IOError(ctx.Err())
+		}
+	}
+}
+
+// connect returns the socket, opening it and starting its reader if there is none.
+func (mb *Client) connect() (*net.UDPConn, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.conn != nil {
+		return mb.conn, nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", mb.Address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	mb.conn = conn
+	mb.pending = make(map[uint16]chan []byte)
+	go mb.read(conn)
+	return conn, nil
+}
+
+// read hands the responses arriving on conn to the requests waiting for them, until
+// conn is closed. Datagrams that are no valid ADU or match no request are dropped.
+func (mb *Client) read(conn *net.UDPConn) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			mb.mu.Lock()
+			closed := mb.conn != conn
+			mb.mu.Unlock()
+			if closed {
+				return
+			}
+			// E.g. an ICMP port unreachable, requests are sent again or time out
+			continue
+		}
+		if n < tcppacket.MinSize || tcppacket.HeaderSize+(int(buf[4])<<8|int(buf[5])) != n {
+			continue
+		}
+		tid := uint16(buf[0])<<8 | uint16(buf[1])
+
+		mb.mu.Lock()
+		ch, ok := mb.pending[tid]
+		if ok {
+			delete(mb.pending, tid)
+		}
+		mb.mu.Unlock()
+		if ok {
+			ch <- append([]byte(nil), buf[:n]...)
+		}
+	}
+}
+
+// Connect implements Connector interface. UDP has no connection, it only resolves
+// the address and opens the socket.
+func (mb *Client) Connect(ctx context.Context) error {
+	_, err := mb.connect()
+	return err
+}
+
+// Close implements Connector interface.
+func (mb *Client) Close() error {
+	mb.mu.Lock()
+	conn := mb.conn
+	mb.conn = nil
+	mb.mu.Unlock()
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package udp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+)
+
+// lossyDevice answers read requests with register 0x1234, ignoring the first drop
+// datagrams it receives. It returns the requests received.
+func lossyDevice(t *testing.T, drop int) (string, <-chan []byte) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	received := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			received <- req
+			if drop > 0 {
+				drop--
+				continue
+			}
+			resp := append(append([]byte(nil), req[:4]...), 0, 5, req[6], req[7], 2, 0x12, 0x34)
+			conn.WriteTo(resp, addr)
+			conn.WriteTo(resp, addr) // Duplicated on the way
+		}
+	}()
+	return conn.LocalAddr().String(), received
+}
+
+var readRegister = modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}}
+
+func TestClient_Retransmit(t *testing.T) {
+	addr, received := lossyDevice(t, 2)
+	c := NewClient(addr)
+	c.RetransmitInterval = 20 * time.Millisecond
+	defer c.Close()
+
+	resp, err := c.Send(context.Background(), 1, readRegister)
+	if err != nil || !bytes.Equal(resp.Data, []byte{2, 0x12, 0x34}) {
+		t.Fatalf("Send() = %v, %v", resp, err)
+	}
+	first := <-received
+	for i := 0; i < 2; i++ {
+		if again := <-received; !bytes.Equal(again, first) {
+			t.Errorf("retransmission % x differs from the request % x", again, first)
+		}
+	}
+
+	// The duplicate of the last response is dropped, the next request gets its own
+	resp, err = c.Send(context.Background(), 1, readRegister)
+	if err != nil || !bytes.Equal(resp.Data, []byte{2, 0x12, 0x34}) {
+		t.Fatalf("second Send() = %v, %v", resp, err)
+	}
+	if next := <-received; next[1] != first[1]+1 {
+		t.Errorf("second request has transaction ID %d, want %d", next[1], first[1]+1)
+	}
+}
+
+func TestClient_WritesSentOnce(t *testing.T) {
+	addr, received := lossyDevice(t, 1)
+	c := NewClient(addr)
+	c.RetransmitInterval = 10 * time.Millisecond
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	write := modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0, 1, 0, 7}}
+	if _, err := c.Send(ctx, 1, write); !errors.Is(err, modbus.ErrTimeout) {
+		t.Errorf("Send() of a lost write = %v, want a timeout", err)
+	}
+	if n := len(received); n != 1 {
+		t.Errorf("write sent %d times, want once", n)
+	}
+
+	c.RetransmitWrites = true
+	if _, err := c.Send(context.Background(), 1, write); err != nil {
+		t.Errorf("Send() with retransmitted writes = %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package udp
+
+import (
+	"fmt"
+
+	"github.com/ffutop/modbus-gateway/internal/config"
+	"github.com/ffutop/modbus-gateway/transport"
+	"github.com/ffutop/modbus-gateway/transport/tcp"
+)
+
+func init() {
+	transport.RegisterUpstream("udp", func(cfg config.UpstreamConfig) (transport.Upstream, error) {
+		allowlist, err := transport.ParseClients(cfg.AllowedClients, cfg.DeniedClients)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Tcp.MaxInFlight < 0 {
+			return nil, fmt.Errorf("max_in_flight must not be negative")
+		}
+		s := NewServer(cfg.Tcp.Address)
+		s.Allowlist = allowlist
+		if cfg.Tcp.MaxInFlight > 0 {
+			s.MaxInFlight = cfg.Tcp.MaxInFlight
+		}
+		return s, nil
+	})
+	transport.RegisterDownstream("udp", func(cfg config.DownstreamConfig) (transport.Downstream, error) {
+		verify, err := tcp.ParseVerify(cfg.Tcp.Verify)
+		if err != nil {
+			return nil, err
+		}
+		if verify == tcp.VerifyNone {
+			return nil, fmt.Errorf("verify %q is not available over udp, responses are matched by transaction ID", verify)
+		}
+		if cfg.Tcp.RetransmitInterval < 0 {
+			return nil, fmt.Errorf("retransmit_interval must not be negative")
+		}
+		c := NewClient(cfg.Tcp.Address)
+		c.Verify = verify
+		c.RetransmitWrites = cfg.RetryWrites
+		if cfg.Tcp.RetransmitInterval > 0 {
+			c.RetransmitInterval = cfg.Tcp.RetransmitInterval
+		}
+		return c, nil
+	})
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	tcppacket "github.com/ffutop/modbus-gateway/modbus/tcp"
+	"github.com/ffutop/modbus-gateway/transport"
+	"github.com/ffutop/modbus-gateway/transport/tcp"
+)
+
+const (
+	// defaultMaxInFlight bounds the requests of all masters handled at once.
+	defaultMaxInFlight = 16
+
+	// duplicateWindow is how long a request is remembered, so a master sending it
+	// again gets the response already sent instead of the request being served twice.
+	duplicateWindow = 10 * time.Second
+)
+
+// Server implements a Modbus UDP Server.
+type Server struct {
+	Address   string
+	Handler   transport.RequestHandler
+	Allowlist *transport.Allowlist // Clients answered, nil answers all
+
+	// Requests handled at once, default 16. Datagrams arriving beyond wait in the
+	// socket buffer, and are dropped by the system once it is full.
+	MaxInFlight int
+
+	conn net.PacketConn
+
+	mu     sync.Mutex
+	seen   map[request]*served
+	pruned time.Time // Last time requests beyond the window were forgotten
+}
+
+// request identifies a request of a master by its transaction.
+type request struct {
+	client string
+	tid    uint16
+}
+
+// served is a request handled or in progress, with the response once it is sent.
+type served struct {
+	at   time.Time
+	raw  []byte // The request
+	resp []byte // Nil while in progress
+}
+
+// NewServer creates a new UDP Server.
+func NewServer(address string) *Server {
+	return &Server{
+		Address:     address,
+		MaxInFlight: defaultMaxInFlight,
+	}
+}
+
+// Start starts the UDP server.
+func (s *Server) Start(ctx context.Context, handler transport.RequestHandler) error {
+	log := transport.Logger(ctx)
+	s.Handler = handler
+	conn, err := net.ListenPacket("udp", s.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.Address, err)
+	}
+	s.conn = conn
+	s.seen = make(map[request]*served)
+	log.Info("Modbus UDP server listening", "addr", conn.LocalAddr())
+	transport.Listening(ctx)
+
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	slots := make(chan struct{}, max(s.MaxInFlight, 1))
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Error("Failed to read datagram", "err", err)
+			continue
+		}
+		if !s.Allowlist.Allows(addr) {
+			log.Warn("Rejected client", "addr", addr)
+			continue
+		}
+		raw := append([]byte(nil), buf[:n]...)
+		if n < tcppacket.MinSize || n > tcppacket.MaxSize || tcppacket.HeaderSize+(int(raw[4])<<8|int(raw[5])) != n {
+			log.Warn("Invalid UDP request length", "addr", addr, "length", n)
+			continue
+		}
+		if !s.first(conn, addr, raw) {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.handle(transport.WithClient(ctx, addr), conn, addr, raw)
+		}()
+	}
+}
+
+// first reports whether raw is a new request. A request seen before is answered
+// with the response already sent, or dropped while it is still in progress.
+func (s *Server) first(conn net.PacketConn, addr net.Addr, raw []byte) bool {
+	key := request{client: addr.String(), tid: uint16(raw[0])<<8 | uint16(raw[1])}
+	now := time.Now()
+
+	s.mu.Lock()
+	r, ok := s.seen[key]
+	if ok && now.Sub(r.at) < duplicateWindow && string(r.raw) == string(raw) {
+		resp := r.resp
+		s.mu.Unlock()
+		if resp != nil {
+			conn.WriteTo(resp, addr)
+		}
+		return false
+	}
+	if now.Sub(s.pruned) >= time.Second {
+		for k, r := range s.seen {
+			if now.Sub(r.at) >= duplicateWindow {
+				delete(s.seen, k)
+			}
+		}
+		s.pruned = now
+	}
+	s.seen[key] = &served{at: now, raw: raw}
+	s.mu.Unlock()
+	return true
+}
+
+// handle serves one request and sends its response.
+func (s *Server) handle(ctx context.Context, conn net.PacketConn, addr net.Addr, raw []byte) {
+	log := transport.Logger(ctx)
+	ctx, span := transport.StartSpan(transport.TraceRequest(ctx), transport.SpanUpstream)
+	var err error
+	defer func() { span.End(err) }()
+	transport.TraceFrame(ctx, transport.UpstreamRx, raw)
+	adu, err := tcp.Decode(raw)
+	if err != nil {
+		log.Error("Failed to decode UDP request", "err", err)
+		return
+	}
+	span.SetAttributes(transport.SpanAttrs(adu.SlaveID, adu.Pdu, int(adu.TransactionID))...)
+	respPdu, err := s.Handler(ctx, adu.SlaveID, adu.Pdu)
+	if err != nil {
+		log.Error("Handler failed", "err", err)
+		respPdu = modbus.ExceptionResponse(adu.Pdu, err)
+		err = nil
+	}
+	if attr, ok := transport.ExceptionAttr(respPdu); ok {
+		span.SetAttributes(attr)
+	}
+	respAdu := &tcp.ApplicationDataUnit{
+		TransactionID: adu.TransactionID,
+		ProtocolID:    adu.ProtocolID,
+		Length:        uint16(1 + 1 + len(respPdu.Data)), // SlaveID + FunctionCode + Data
+		SlaveID:       adu.SlaveID,
+		Pdu:           respPdu,
+	}
+	resp, err := respAdu.Encode()
+	if err != nil {
+		log.Error("Failed to encode UDP response", "err", err)
+		return
+	}
+
+	s.mu.Lock()
+	if r, ok := s.seen[request{client: addr.String(), tid: adu.TransactionID}]; ok && string(r.raw) == string(raw) {
+		r.resp = resp
+	}
+	s.mu.Unlock()
+	transport.TraceFrame(ctx, transport.UpstreamTx, resp)
+	if _, err = conn.WriteTo(resp, addr); err != nil {
+		log.Error("Failed to write response datagram", "addr", addr, "err", err)
+	}
+}
+
+// Close closes the server socket.
+func (s *Server) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
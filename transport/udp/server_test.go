@@ -0,0 +1,108 @@
+// Copyright (c) 2026 Li Jinling. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD-3 Clause License. See the LICENSE file for details.
+package udp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ffutop/modbus-gateway/modbus"
+	"github.com/ffutop/modbus-gateway/transport"
+)
+
+// startServer serves on a free port. Datagrams sent before it listens are lost,
+// like any others, clients send again.
+func startServer(t *testing.T, s *Server, handler transport.RequestHandler) string {
+	t.Helper()
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Address = l.LocalAddr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Start(ctx, handler)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s.Address
+}
+
+func TestServer_Duplicates(t *testing.T) {
+	var writes atomic.Int32
+	s := NewServer("")
+	addr := startServer(t, s, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		if transport.ClientFromContext(ctx) == nil {
+			t.Error("request without client address")
+		}
+		writes.Add(1)
+		return pdu, nil
+	})
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	write := []byte{0x00, 0x07, 0x00, 0x00, 0x00, 0x06, 0x01, 0x06, 0x00, 0x01, 0x00, 0x2A}
+	buf := make([]byte, maxDatagram)
+	for i := 0; i < 3; {
+		conn.Write(write)
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil && i == 0 {
+			continue // Not listening yet
+		}
+		if err != nil || !bytes.Equal(buf[:n], write) {
+			t.Fatalf("response %d = % x, %v, want the echo", i, buf[:n], err)
+		}
+		i++
+	}
+	if n := writes.Load(); n != 1 {
+		t.Errorf("retransmitted write served %d times, want once", n)
+	}
+
+	// A client following the protocol gets through, the truncated datagram is dropped
+	conn.Write(write[:10])
+	c := NewClient(addr)
+	defer c.Close()
+	resp, err := c.Send(context.Background(), 1, modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0, 2, 0, 1}})
+	if err != nil || !bytes.Equal(resp.Data, []byte{0, 2, 0, 1}) {
+		t.Errorf("Send() = %v, %v", resp, err)
+	}
+	if n := writes.Load(); n != 2 {
+		t.Errorf("served %d requests, want 2", n)
+	}
+}
+
+func TestServer_Allowlist(t *testing.T) {
+	allowlist, err := transport.ParseClients(nil, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("")
+	s.Allowlist = allowlist
+	addr := startServer(t, s, func(ctx context.Context, slaveID byte, pdu modbus.ProtocolDataUnit) (modbus.ProtocolDataUnit, error) {
+		t.Error("request of a denied client served")
+		return pdu, nil
+	})
+
+	c := NewClient(addr)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Send(ctx, 1, readRegister); err == nil {
+		t.Error("Send() from a denied client succeeded")
+	}
+}